@@ -2,7 +2,12 @@ package snmpclient2
 
 import (
 	"errors"
+	"fmt"
 	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/runner-mei/snmpclient2/asn1"
 )
@@ -29,6 +34,10 @@ func AsInt64(value Variable) (int64, error) {
 			return 0, errors.New("type Assertion to int64 failed, it is too big.")
 		}
 		return int64(value.Uint()), nil
+	case asn1.TagOctetString:
+		if i64, err := strconv.ParseInt(strings.TrimSpace(string(value.Bytes())), 10, 64); err == nil {
+			return i64, nil
+		}
 	}
 	return 0, errors.New("type Assertion to int64 failed")
 }
@@ -56,6 +65,10 @@ func AsUint64(value Variable) (uint64, error) {
 		}
 	case asn1.TagGauge32, asn1.TagCounter32, asn1.TagTimeticks, asn1.TagCounter64:
 		return value.Uint(), nil
+	case asn1.TagOctetString:
+		if u64, err := strconv.ParseUint(strings.TrimSpace(string(value.Bytes())), 10, 64); err == nil {
+			return u64, nil
+		}
 	}
 	return 0, errors.New("type Assertion to uint64 failed")
 }
@@ -79,6 +92,10 @@ func AsUint32(value Variable) (uint32, error) {
 }
 
 func AsString(value Variable) (string, error) {
+	switch value.(type) {
+	case *Float, *Double:
+		return value.ToString(), nil
+	}
 	if value.Syntex() == asn1.TagOctetString ||
 		value.Syntex() == asn1.TagUTF8String ||
 		value.Syntex() == asn1.TagPrintableString ||
@@ -88,3 +105,191 @@ func AsString(value Variable) (string, error) {
 	}
 	return "", errors.New("type Assertion to string failed")
 }
+
+// AsFloat64 returns the Float, the Double or the integer types as float64
+func AsFloat64(value Variable) (float64, error) {
+	switch v := value.(type) {
+	case *Float:
+		return float64(v.Value), nil
+	case *Double:
+		return v.Value, nil
+	}
+	if i64, err := AsInt64(value); err == nil {
+		return float64(i64), nil
+	}
+	if u64, err := AsUint64(value); err == nil {
+		return float64(u64), nil
+	}
+	return 0, errors.New("type Assertion to float64 failed")
+}
+
+// AsBytes returns the octets of the OctetString, the Opaque or the
+// IpAddress
+func AsBytes(value Variable) ([]byte, error) {
+	switch value.Syntex() {
+	case asn1.TagOctetString, asn1.TagOpaque, asn1.TagIPAddress:
+		return value.Bytes(), nil
+	}
+	return nil, errors.New("type Assertion to []byte failed")
+}
+
+// AsIP returns the IpAddress, or the OctetString of 4 or 16 octets (e.g.
+// an InetAddress)
+func AsIP(value Variable) (net.IP, error) {
+	switch value.Syntex() {
+	case asn1.TagIPAddress, asn1.TagOctetString:
+		if bs := value.Bytes(); len(bs) == net.IPv4len || len(bs) == net.IPv6len {
+			return net.IP(append([]byte(nil), bs...)), nil
+		}
+	}
+	return nil, errors.New("type Assertion to net.IP failed")
+}
+
+// AsDuration returns the TimeTicks (e.g. sysUpTime) as time.Duration
+func AsDuration(value Variable) (time.Duration, error) {
+	if ticks, ok := value.(*TimeTicks); ok {
+		return ticks.Duration(), nil
+	}
+	return 0, errors.New("type Assertion to time.Duration failed")
+}
+
+// AsOid returns a copy of the Oid
+func AsOid(value Variable) (Oid, error) {
+	if oid, ok := value.(*Oid); ok {
+		return NewOid(append([]int(nil), oid.Value...)), nil
+	}
+	return Oid{}, errors.New("type Assertion to Oid failed")
+}
+
+// FormatMAC returns the OctetString of 6 octets (e.g. ifPhysAddress) as
+// "aa:bb:cc:dd:ee:ff"
+func FormatMAC(value Variable) (string, error) {
+	if value.Syntex() != asn1.TagOctetString {
+		return "", errors.New("type Assertion to MAC address failed")
+	}
+	bs := value.Bytes()
+	if len(bs) != 6 {
+		return "", fmt.Errorf("type Assertion to MAC address failed, it has %d octets", len(bs))
+	}
+	return net.HardwareAddr(bs).String(), nil
+}
+
+// ParseDateAndTime returns the DateAndTime of SNMPv2-TC (e.g. hrSystemDate),
+// which is an OctetString of 8 octets, or of 11 octets with the offset from
+// UTC. The time of 8 octets is returned in UTC since the offset is unknown.
+func ParseDateAndTime(value Variable) (time.Time, error) {
+	if value.Syntex() != asn1.TagOctetString {
+		return time.Time{}, errors.New("type Assertion to DateAndTime failed")
+	}
+	bs := value.Bytes()
+	if len(bs) != 8 && len(bs) != 11 {
+		return time.Time{}, fmt.Errorf("type Assertion to DateAndTime failed, it has %d octets", len(bs))
+	}
+	year := int(bs[0])<<8 | int(bs[1])
+	month, day, hour, minute, second, deci := bs[2], bs[3], bs[4], bs[5], bs[6], bs[7]
+	if month < 1 || month > 12 || day < 1 || day > 31 || hour > 23 ||
+		minute > 59 || second > 60 || deci > 9 {
+		return time.Time{}, fmt.Errorf("type Assertion to DateAndTime failed, it is invalid - %s", ToHexStr(bs, " "))
+	}
+
+	loc := time.UTC
+	if len(bs) == 11 {
+		direction, hours, minutes := bs[8], bs[9], bs[10]
+		if (direction != '+' && direction != '-') || hours > 13 || minutes > 59 {
+			return time.Time{}, fmt.Errorf("type Assertion to DateAndTime failed, the offset is invalid - %s", ToHexStr(bs[8:], " "))
+		}
+		offset := int(hours)*3600 + int(minutes)*60
+		if direction == '-' {
+			offset = -offset
+		}
+		loc = time.FixedZone("", offset)
+	}
+	return time.Date(year, time.Month(month), int(day), int(hour), int(minute), int(second),
+		int(deci)*int(100*time.Millisecond), loc), nil
+}
+
+// IsPrintable returns true if the value is an OctetString of UTF-8 text
+// without the control characters except the white spaces, it is false if
+// the octets should be rendered in hex.
+func IsPrintable(value Variable) bool {
+	switch value.Syntex() {
+	case asn1.TagOctetString, asn1.TagUTF8String, asn1.TagPrintableString, asn1.TagGeneralString:
+		return isPrintable(value.Bytes())
+	}
+	return false
+}
+
+// AsInt64 is AsInt64 of the Variable, TimeTicks is the count of the ticks
+func (v *VariableBinding) AsInt64() (int64, error) {
+	return AsInt64(v.Variable)
+}
+
+// AsUint64 is AsUint64 of the Variable
+func (v *VariableBinding) AsUint64() (uint64, error) {
+	return AsUint64(v.Variable)
+}
+
+// AsString returns the text of the string types, and the string
+// representation of the others
+func (v *VariableBinding) AsString() string {
+	if s, err := AsString(v.Variable); err == nil {
+		return s
+	}
+	return v.Variable.ToString()
+}
+
+// AsBytes returns the octets of the Variable, it is nil if the Variable is
+// not a kind of OctetString
+func (v *VariableBinding) AsBytes() []byte {
+	bs, _ := AsBytes(v.Variable)
+	return bs
+}
+
+// AsIP is AsIP of the Variable
+func (v *VariableBinding) AsIP() (net.IP, error) {
+	return AsIP(v.Variable)
+}
+
+// AsOid is AsOid of the Variable
+func (v *VariableBinding) AsOid() (Oid, error) {
+	return AsOid(v.Variable)
+}
+
+// AsDuration is AsDuration of the Variable
+func (v *VariableBinding) AsDuration() (time.Duration, error) {
+	return AsDuration(v.Variable)
+}
+
+func (v VariableBindings) lookup(oid Oid) (*VariableBinding, error) {
+	if vb := v.MatchOid(oid); vb != nil {
+		return vb, nil
+	}
+	return nil, fmt.Errorf("oid %s is not found", oid.ToString())
+}
+
+// LookupAsInt64 is AsInt64 of the VariableBinding of the oid
+func (v VariableBindings) LookupAsInt64(oid Oid) (int64, error) {
+	vb, err := v.lookup(oid)
+	if err != nil {
+		return 0, err
+	}
+	return vb.AsInt64()
+}
+
+// LookupAsUint64 is AsUint64 of the VariableBinding of the oid
+func (v VariableBindings) LookupAsUint64(oid Oid) (uint64, error) {
+	vb, err := v.lookup(oid)
+	if err != nil {
+		return 0, err
+	}
+	return vb.AsUint64()
+}
+
+// LookupAsString is AsString of the VariableBinding of the oid
+func (v VariableBindings) LookupAsString(oid Oid) (string, error) {
+	vb, err := v.lookup(oid)
+	if err != nil {
+		return "", err
+	}
+	return vb.AsString(), nil
+}
@@ -0,0 +1,390 @@
+package snmpclient2
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// AsyncSNMP shares one connection among concurrent requests. A background
+// reader dispatches the responses to the pending requests by their ids,
+// the responses which match no pending request are dropped.
+type AsyncSNMP struct {
+	dropped uint64 // first for the 64-bit alignment of atomic
+
+	snmp *SNMP
+
+	writeMu  sync.Mutex // serializes the writes on stream connections
+	secMu    sync.Mutex // serializes the message processing (V3 keeps state)
+	mu       sync.Mutex
+	pendings map[int]*asyncCall
+	closed   chan struct{}
+	wg       sync.WaitGroup
+}
+
+type asyncCall struct {
+	conn    net.Conn
+	mp      MessageProcessing
+	sendMsg Message
+	done    chan asyncResult
+	notify  func(asyncResult) // called instead of done by DoAsync
+}
+
+// deliver passes the result to the caller, it is called once by the one
+// that removes the call from the pendings
+func (c *asyncCall) deliver(res asyncResult) {
+	if c.notify != nil {
+		c.notify(res)
+		return
+	}
+	c.done <- res
+}
+
+type asyncResult struct {
+	buf []byte
+	err error
+}
+
+var errAsyncClosed = errors.New("AsyncSNMP is closed")
+
+// asyncTimeoutError is a net.Error so that the requests are retried
+type asyncTimeoutError struct{}
+
+func (asyncTimeoutError) Error() string   { return "i/o timeout" }
+func (asyncTimeoutError) Timeout() bool   { return true }
+func (asyncTimeoutError) Temporary() bool { return true }
+
+// Create an AsyncSNMP Object
+func NewAsyncSNMP(network, address string, args Arguments) (*AsyncSNMP, error) {
+	snmp, err := NewSNMP(network, address, args)
+	if err != nil {
+		return nil, err
+	}
+	return &AsyncSNMP{snmp: snmp}, nil
+}
+
+// Open a connection and start the reader, a V3 engine is discovered first
+func (a *AsyncSNMP) Open() (err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed != nil {
+		return nil
+	}
+
+	if err = a.snmp.Open(); err != nil {
+		return
+	}
+	a.snmp.conn.SetReadDeadline(time.Time{})
+	a.pendings = map[int]*asyncCall{}
+	a.closed = make(chan struct{})
+	a.wg.Add(1)
+	go a.serve(a.snmp.conn, a.closed)
+	return
+}
+
+// Close the connection, the pending requests fail
+func (a *AsyncSNMP) Close() {
+	a.mu.Lock()
+	closed := a.closed
+	a.closed = nil
+	if closed != nil {
+		close(closed)
+		a.snmp.Close()
+	}
+	a.mu.Unlock()
+	a.wg.Wait()
+}
+
+// Dropped returns the number of responses which matched no pending request,
+// e.g. duplicated or late responses
+func (a *AsyncSNMP) Dropped() uint64 {
+	return atomic.LoadUint64(&a.dropped)
+}
+
+// SetRequest returns the error status of the response as the error of
+// ErrorFromPdu, like SNMP.SetRequest
+func (a *AsyncSNMP) SetRequest(variableBindings VariableBindings) (PDU, error) {
+	pdu := NewPduWithVarBinds(a.snmp.args.Version, SetRequest, variableBindings)
+	result, _, err := a.Do(context.Background(), pdu)
+	if err == nil {
+		err = ErrorFromPdu(pdu, result)
+	}
+	return result, err
+}
+
+func (a *AsyncSNMP) GetRequest(oids Oids) (PDU, error) {
+	result, _, err := a.Do(context.Background(), NewPduWithOids(a.snmp.args.Version, GetRequest, oids))
+	return result, err
+}
+
+func (a *AsyncSNMP) GetNextRequest(oids Oids) (PDU, error) {
+	result, _, err := a.Do(context.Background(), NewPduWithOids(a.snmp.args.Version, GetNextRequest, oids))
+	return result, err
+}
+
+func (a *AsyncSNMP) GetBulkRequest(oids Oids, nonRepeaters, maxRepetitions int) (PDU, error) {
+	pdu, err := a.bulkPdu(oids, nonRepeaters, maxRepetitions)
+	if err != nil {
+		return nil, err
+	}
+	result, _, err := a.Do(context.Background(), pdu)
+	return result, err
+}
+
+// bulkPdu returns the GetBulkRequest PDU after checking the arguments
+func (a *AsyncSNMP) bulkPdu(oids Oids, nonRepeaters, maxRepetitions int) (PDU, error) {
+	if err := a.snmp.args.validateBulk(nonRepeaters, maxRepetitions); err != nil {
+		return nil, err
+	}
+	pdu := NewPduWithOids(a.snmp.args.Version, GetBulkRequest, oids)
+	pdu.SetNonrepeaters(nonRepeaters)
+	pdu.SetMaxRepetitions(maxRepetitions)
+	return pdu, nil
+}
+
+// Do sends a prepared PDU and waits its response, it is safe to call Do
+// from multiple goroutines. Each attempt waits Timeout of the Arguments.
+// The returned RequestInfo carries the correlation value attached to ctx by
+// WithCorrelation like SNMP.Do.
+func (a *AsyncSNMP) Do(ctx context.Context, pdu PDU) (result PDU, info RequestInfo, err error) {
+	info.Correlation = CorrelationFromContext(ctx)
+	start := time.Now()
+	if err = a.Open(); err == nil {
+		err = retry(ctx, int(a.snmp.args.Retries), a.snmp.args.backoff, func() error {
+			if e := ctx.Err(); e != nil {
+				return canceledError(e)
+			}
+			info.Attempts++
+			result, err = a.send(ctx, pdu)
+			return err
+		})
+	}
+	info.RequestId = pdu.RequestId()
+	info.Elapsed = time.Since(start)
+	if err != nil {
+		result = nil
+		err = withCorrelation(err, info.Correlation)
+	}
+	return
+}
+
+func (a *AsyncSNMP) send(ctx context.Context, pdu PDU) (PDU, error) {
+	call, id, err := a.register(pdu, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer a.unregister(id)
+
+	buf, err := call.sendMsg.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	a.writeMu.Lock()
+	call.conn.SetWriteDeadline(time.Now().Add(a.snmp.args.Timeout))
+	err = writeMessage(call.conn, buf)
+	a.writeMu.Unlock()
+	if err != nil || !confirmedType(pdu.PduType()) {
+		return nil, err
+	}
+
+	timer := time.NewTimer(a.snmp.args.Timeout)
+	defer timer.Stop()
+
+	var res asyncResult
+	select {
+	case res = <-call.done:
+	case <-timer.C:
+		return nil, asyncTimeoutError{}
+	case <-ctx.Done():
+		return nil, canceledError(ctx.Err())
+	}
+	return a.receive(call, pdu, res)
+}
+
+// receive returns the response PDU of the result
+func (a *AsyncSNMP) receive(call *asyncCall, pdu PDU, res asyncResult) (PDU, error) {
+	if res.err != nil {
+		return nil, res.err
+	}
+
+	a.secMu.Lock()
+	defer a.secMu.Unlock()
+	result, err := call.mp.PrepareDataElements(a.snmp, call.sendMsg, res.buf)
+	if result != nil && len(pdu.VariableBindings()) != 0 {
+		if err = a.snmp.checkPdu(result); err != nil {
+			result = nil
+		}
+	}
+	return result, err
+}
+
+// register prepares the message of the PDU and adds it to the pendings, the
+// result is passed to notify if it is not nil
+func (a *AsyncSNMP) register(pdu PDU, notify func(asyncResult)) (*asyncCall, int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed == nil {
+		return nil, 0, errAsyncClosed
+	}
+
+	for {
+		a.secMu.Lock()
+		sendMsg, err := a.snmp.mp.PrepareOutgoingMessage(a.snmp, pdu)
+		a.secMu.Unlock()
+		if err != nil {
+			return nil, 0, err
+		}
+		id := messageId(sendMsg)
+		if _, ok := a.pendings[id]; !ok {
+			call := &asyncCall{
+				conn:    a.snmp.conn,
+				mp:      a.snmp.mp,
+				sendMsg: sendMsg,
+				notify:  notify,
+			}
+			if notify == nil {
+				call.done = make(chan asyncResult, 1)
+			}
+			a.pendings[id] = call
+			return call, id, nil
+		}
+	}
+}
+
+func (a *AsyncSNMP) unregister(id int) {
+	a.mu.Lock()
+	delete(a.pendings, id)
+	a.mu.Unlock()
+}
+
+// take removes the call from the pendings, it returns false if the call is
+// already removed, e.g. its response is received
+func (a *AsyncSNMP) take(id int, call *asyncCall) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.pendings[id] != call {
+		return false
+	}
+	delete(a.pendings, id)
+	return true
+}
+
+// messageId returns the id which a response to msg carries in the clear,
+// the PDU of V3 may be encrypted so the message id is used.
+func messageId(msg Message) int {
+	if m, ok := msg.(*MessageV3); ok {
+		return m.MessageId
+	}
+	return msg.PDU().RequestId()
+}
+
+func (a *AsyncSNMP) serve(conn net.Conn, closed chan struct{}) {
+	defer a.wg.Done()
+
+	stream := isStream(a.snmp.Network)
+	size := a.snmp.args.recvSize()
+	if stream && size < mega {
+		size = mega
+	}
+
+	for {
+		var buf []byte
+		var err error
+		if stream {
+			buf, err = readMessage(conn, size)
+		} else {
+			buf = make([]byte, size)
+			var n int
+			n, err = conn.Read(buf)
+			buf = buf[:n]
+		}
+		if err != nil {
+			if !stream && isPortUnreachable(err) {
+				a.snmp.warnf("failed to read the response from %s - %v", a.snmp.Address, err)
+				continue
+			}
+			a.stop(err, closed)
+			return
+		}
+
+		id, ok := a.peekId(buf)
+		if ok {
+			a.mu.Lock()
+			call := a.pendings[id]
+			delete(a.pendings, id)
+			a.mu.Unlock()
+			if call != nil {
+				call.deliver(asyncResult{buf: buf})
+				continue
+			}
+		}
+		atomic.AddUint64(&a.dropped, 1)
+	}
+}
+
+// isPortUnreachable reports whether the read of a datagram failed by the
+// ICMP port unreachable of a previous request, it fails that read only and
+// the pending requests time out then
+func isPortUnreachable(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED) ||
+		strings.Contains(err.Error(), "forcibly closed by the remote host") // Windows
+}
+
+func (a *AsyncSNMP) peekId(buf []byte) (int, bool) {
+	return peekId(a.snmp.args.Version, buf)
+}
+
+// peekId returns the id of the message of the version which a response
+// carries in the clear, the PDU of V3 may be encrypted so the message id
+// is used.
+func peekId(version SnmpVersion, buf []byte) (int, bool) {
+	if version == V3 {
+		msg := NewMessage(V3, &ScopedPdu{}).(*MessageV3)
+		if _, err := msg.Unmarshal(buf); err != nil {
+			return 0, false
+		}
+		return msg.MessageId, true
+	}
+
+	pdu := &PduV1{}
+	msg := NewMessage(version, pdu)
+	if _, err := msg.Unmarshal(buf); err != nil {
+		return 0, false
+	}
+	if _, err := pdu.Unmarshal(msg.PduBytes()); err != nil {
+		return 0, false
+	}
+	return pdu.RequestId(), true
+}
+
+// stop fails the pending requests after the reader stopped
+func (a *AsyncSNMP) stop(err error, closed chan struct{}) {
+	select {
+	case <-closed:
+		err = errAsyncClosed
+	default:
+	}
+
+	a.mu.Lock()
+	calls := make([]*asyncCall, 0, len(a.pendings))
+	for id, call := range a.pendings {
+		calls = append(calls, call)
+		delete(a.pendings, id)
+	}
+	if a.closed == closed {
+		// the connection is broken, the next request reopens it
+		a.closed = nil
+		a.snmp.Close()
+	}
+	a.mu.Unlock()
+
+	// the callbacks of DoAsync may send again
+	for _, call := range calls {
+		call.deliver(asyncResult{err: err})
+	}
+}
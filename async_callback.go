@@ -0,0 +1,183 @@
+package snmpclient2
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// An AsyncHandler receives the response or the error of a request of
+// DoAsync, the RequestInfo carries the correlation value attached to its
+// context by WithCorrelation and the request id, so that the completions of
+// many outstanding requests are matched to them.
+type AsyncHandler func(PDU, RequestInfo, error)
+
+// DoAsync sends a prepared PDU and returns at once, fn is called with the
+// response or the error when the request completes. No goroutine waits for
+// the response: fn is called from the reader or a timer goroutine, so it
+// must not block, but it may send the next request. Each attempt waits
+// Timeout of the Arguments and is retried like Do.
+func (a *AsyncSNMP) DoAsync(ctx context.Context, pdu PDU, fn AsyncHandler) {
+	r := &asyncRequest{a: a, ctx: ctx, pdu: pdu, fn: fn, start: time.Now()}
+	r.send()
+}
+
+// SetAsync is SetRequest that calls fn instead of waiting, see DoAsync
+func (a *AsyncSNMP) SetAsync(variableBindings VariableBindings, fn AsyncHandler) {
+	a.DoAsync(context.Background(), NewPduWithVarBinds(a.snmp.args.Version, SetRequest, variableBindings), fn)
+}
+
+// GetAsync is GetRequest that calls fn instead of waiting, see DoAsync
+func (a *AsyncSNMP) GetAsync(oids Oids, fn AsyncHandler) {
+	a.DoAsync(context.Background(), NewPduWithOids(a.snmp.args.Version, GetRequest, oids), fn)
+}
+
+// GetNextAsync is GetNextRequest that calls fn instead of waiting, see
+// DoAsync
+func (a *AsyncSNMP) GetNextAsync(oids Oids, fn AsyncHandler) {
+	a.DoAsync(context.Background(), NewPduWithOids(a.snmp.args.Version, GetNextRequest, oids), fn)
+}
+
+// GetBulkAsync is GetBulkRequest that calls fn instead of waiting, see
+// DoAsync. fn is called before GetBulkAsync returns if the arguments are
+// invalid.
+func (a *AsyncSNMP) GetBulkAsync(oids Oids, nonRepeaters, maxRepetitions int, fn AsyncHandler) {
+	pdu, err := a.bulkPdu(oids, nonRepeaters, maxRepetitions)
+	if err != nil {
+		fn(nil, RequestInfo{}, err)
+		return
+	}
+	a.DoAsync(context.Background(), pdu, fn)
+}
+
+// asyncRequest is a request of DoAsync. An attempt is completed by the
+// response, the timer or ctx, whichever takes its call from the pendings.
+type asyncRequest struct {
+	a        *AsyncSNMP
+	ctx      context.Context
+	pdu      PDU
+	fn       AsyncHandler
+	start    time.Time
+	tries    int
+	attempts int
+
+	mu      sync.Mutex // held while an attempt is being sent
+	call    *asyncCall
+	timer   *time.Timer
+	stopCtx chan struct{} // closed to stop watching ctx
+}
+
+// send starts an attempt of the request
+func (r *asyncRequest) send() {
+	if err := r.ctx.Err(); err != nil {
+		r.finish(nil, canceledError(err))
+		return
+	}
+	if err := r.a.Open(); err != nil {
+		r.finish(nil, err)
+		return
+	}
+
+	r.mu.Lock()
+	call, id, err := r.a.register(r.pdu, r.receive)
+	if err != nil {
+		r.mu.Unlock()
+		r.finish(nil, err)
+		return
+	}
+	r.call = call
+	r.attempts++
+
+	buf, err := call.sendMsg.Marshal()
+	if err == nil {
+		r.a.writeMu.Lock()
+		call.conn.SetWriteDeadline(time.Now().Add(r.a.snmp.args.Timeout))
+		err = writeMessage(call.conn, buf)
+		r.a.writeMu.Unlock()
+	}
+	if err != nil || !confirmedType(r.pdu.PduType()) {
+		taken := r.a.take(id, call)
+		r.mu.Unlock()
+		if taken {
+			r.complete(nil, err)
+		}
+		return
+	}
+
+	r.timer = time.AfterFunc(r.a.snmp.args.Timeout, func() {
+		if r.a.take(id, call) {
+			r.stopWaiting()
+			r.complete(nil, asyncTimeoutError{})
+		}
+	})
+	if done := r.ctx.Done(); done != nil {
+		stop := make(chan struct{})
+		r.stopCtx = stop
+		go func() {
+			select {
+			case <-done:
+				if r.a.take(id, call) {
+					r.stopWaiting()
+					r.finish(nil, canceledError(r.ctx.Err()))
+				}
+			case <-stop:
+			}
+		}()
+	}
+	r.mu.Unlock()
+}
+
+// receive is the notify of the call, it is called by the reader with the
+// response or by stop with the error
+func (r *asyncRequest) receive(res asyncResult) {
+	r.stopWaiting()
+	r.mu.Lock()
+	call := r.call
+	r.mu.Unlock()
+	r.complete(r.a.receive(call, r.pdu, res))
+}
+
+// stopWaiting stops the timer and the ctx hook of the attempt, it waits the
+// attempt being sent
+func (r *asyncRequest) stopWaiting() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.timer != nil {
+		r.timer.Stop()
+	}
+	if r.stopCtx != nil {
+		close(r.stopCtx)
+		r.stopCtx = nil
+	}
+}
+
+// complete sends the request again if the attempt is timed out or is not in
+// the time window, otherwise the result is passed to fn
+func (r *asyncRequest) complete(result PDU, err error) {
+	err, again := retryable(err)
+	if again && r.tries < int(r.a.snmp.args.Retries) {
+		r.tries++
+		if d := r.a.snmp.args.backoff(r.tries); d > 0 {
+			time.AfterFunc(d, r.send)
+			return
+		}
+		r.send()
+		return
+	}
+	r.finish(result, err)
+}
+
+// finish passes the result and the RequestInfo of the request to fn
+func (r *asyncRequest) finish(result PDU, err error) {
+	info := RequestInfo{
+		Correlation: CorrelationFromContext(r.ctx),
+		RequestId:   r.pdu.RequestId(),
+		Attempts:    r.attempts,
+		Elapsed:     time.Since(r.start),
+	}
+	if err != nil {
+		result = nil
+		err = withCorrelation(err, info.Correlation)
+	}
+	r.fn(result, info, err)
+}
@@ -0,0 +1,263 @@
+package snmpclient2_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/runner-mei/snmpclient2"
+)
+
+func TestAsyncSNMP(t *testing.T) {
+	var mibs string
+	for i := 1; i <= 100; i++ {
+		mibs += fmt.Sprintf("iso.3.6.1.2.1.2.2.1.2.%d = STRING: \"if%d\"\n", i, i)
+	}
+	srv, err := snmpclient2.NewUdpServerFromString("async", "127.0.0.1:0", mibs, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	snmp, _ := snmpclient2.NewAsyncSNMP("udp", "127.0.0.1:"+srv.GetPort(), snmpclient2.Arguments{
+		Version:   snmpclient2.V2c,
+		Community: "public",
+		Timeout:   2 * time.Second,
+		Retries:   2,
+	})
+	defer snmp.Close()
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			oids, _ := snmpclient2.NewOids([]string{fmt.Sprintf("1.3.6.1.2.1.2.2.1.2.%d", i)})
+			pdu, err := snmp.GetRequest(oids)
+			if err != nil {
+				t.Errorf("GetRequest() - has error %v", err)
+				return
+			}
+			vb := pdu.VariableBindings().MatchOid(oids[0])
+			if expected := fmt.Sprintf("if%d", i); vb == nil || string(vb.Variable.Bytes()) != expected {
+				t.Errorf("GetRequest() - expected [%s], actual [%v]", expected, vb)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestAsyncSNMPDuplicate(t *testing.T) {
+	handler := memAgent(t, map[string]snmpclient2.Variable{
+		"1.3.6.1.2.1.1.1.0": snmpclient2.NewOctetString([]byte("Test Agent")),
+	})
+	dialer := newMemDialer(func(req []byte) [][]byte {
+		res := handler(req)
+		return append(res, res...)
+	})
+	snmp, _ := snmpclient2.NewAsyncSNMP("udp", "127.0.0.1:161", snmpclient2.Arguments{
+		Version:   snmpclient2.V2c,
+		Community: "public",
+		Timeout:   time.Second,
+		Dialer:    dialer,
+	})
+	defer snmp.Close()
+
+	oids, _ := snmpclient2.NewOids([]string{"1.3.6.1.2.1.1.1.0"})
+	for i := 0; i < 3; i++ {
+		if _, err := snmp.GetRequest(oids); err != nil {
+			t.Fatalf("GetRequest() - has error %v", err)
+		}
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for snmp.Dropped() < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := snmp.Dropped(); n != 3 {
+		t.Errorf("Dropped() - expected [%d], actual [%d]", 3, n)
+	}
+
+	snmp.Close()
+	if _, err := snmp.GetRequest(oids); err != nil {
+		t.Errorf("GetRequest() - reopen has error %v", err)
+	}
+}
+
+func TestAsyncSNMPCorrelation(t *testing.T) {
+	dialer := newMemDialer(memAgent(t, map[string]snmpclient2.Variable{
+		"1.3.6.1.2.1.1.1.0": snmpclient2.NewOctetString([]byte("Test Agent")),
+	}))
+	snmp, _ := snmpclient2.NewAsyncSNMP("udp", "127.0.0.1:161", snmpclient2.Arguments{
+		Version:   snmpclient2.V2c,
+		Community: "public",
+		Timeout:   time.Second,
+		Dialer:    dialer,
+	})
+	defer snmp.Close()
+
+	oids, _ := snmpclient2.NewOids([]string{"1.3.6.1.2.1.1.1.0"})
+	ctx := snmpclient2.WithCorrelation(context.Background(), "job-42")
+	res, info, err := snmp.Do(ctx, snmpclient2.NewPduWithOids(snmpclient2.V2c, snmpclient2.GetRequest, oids))
+	if err != nil {
+		t.Fatalf("Do() - has error %v", err)
+	}
+	if info.Correlation != "job-42" || info.Attempts != 1 || info.RequestId != res.RequestId() {
+		t.Errorf("Do() - unexpected info %+v", info)
+	}
+
+	silent, _ := snmpclient2.NewAsyncSNMP("udp", "127.0.0.1:161", snmpclient2.Arguments{
+		Version:   snmpclient2.V2c,
+		Community: "public",
+		Timeout:   10 * time.Millisecond,
+		Retries:   1,
+		Dialer:    newMemDialer(func([]byte) [][]byte { return nil }),
+	})
+	defer silent.Close()
+	_, info, err = silent.Do(ctx, snmpclient2.NewPduWithOids(snmpclient2.V2c, snmpclient2.GetRequest, oids))
+	if e, ok := err.(snmpclient2.CorrelatedError); !ok || e.Correlation != "job-42" || !e.Timeout() {
+		t.Errorf("Do() - expected a CorrelatedError of the timeout, actual [%v]", err)
+	}
+	if info.Attempts != 2 {
+		t.Errorf("Do() - expected [%d] attempts, actual [%d]", 2, info.Attempts)
+	}
+}
+
+func TestAsyncSNMPCallback(t *testing.T) {
+	var mibs string
+	for i := 1; i <= 100; i++ {
+		mibs += fmt.Sprintf("iso.3.6.1.2.1.2.2.1.2.%d = STRING: \"if%d\"\n", i, i)
+	}
+	srv, err := snmpclient2.NewUdpServerFromString("async", "127.0.0.1:0", mibs, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	snmp, _ := snmpclient2.NewAsyncSNMP("udp", "127.0.0.1:"+srv.GetPort(), snmpclient2.Arguments{
+		Version:   snmpclient2.V2c,
+		Community: "public",
+		Timeout:   2 * time.Second,
+		Retries:   2,
+	})
+	defer snmp.Close()
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 100; i++ {
+		wg.Add(1)
+		oids, _ := snmpclient2.NewOids([]string{fmt.Sprintf("1.3.6.1.2.1.2.2.1.2.%d", i)})
+		expected := fmt.Sprintf("if%d", i)
+		snmp.GetAsync(oids, func(pdu snmpclient2.PDU, info snmpclient2.RequestInfo, err error) {
+			defer wg.Done()
+			if err != nil {
+				t.Errorf("GetAsync() - has error %v", err)
+				return
+			}
+			if vb := pdu.VariableBindings().MatchOid(oids[0]); vb == nil || vb.AsString() != expected {
+				t.Errorf("GetAsync() - expected [%s], actual [%v]", expected, vb)
+			}
+		})
+	}
+	wg.Wait()
+
+	wg.Add(1)
+	snmp.GetBulkAsync(nil, -1, 10, func(pdu snmpclient2.PDU, info snmpclient2.RequestInfo, err error) {
+		defer wg.Done()
+		if _, ok := err.(snmpclient2.ArgumentError); !ok {
+			t.Errorf("GetBulkAsync() - expected an ArgumentError, actual [%v]", err)
+		}
+	})
+	wg.Wait()
+}
+
+func TestAsyncSNMPCallbackTimeout(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	snmp, _ := snmpclient2.NewAsyncSNMP("udp", conn.LocalAddr().String(), snmpclient2.Arguments{
+		Version:   snmpclient2.V2c,
+		Community: "public",
+		Timeout:   50 * time.Millisecond,
+		Retries:   2,
+	})
+	defer snmp.Close()
+
+	oids, _ := snmpclient2.NewOids([]string{"1.3.6.1.2.1.1.1.0"})
+	errs := make(chan error, 2)
+	start := time.Now()
+	infos := make(chan snmpclient2.RequestInfo, 1)
+	snmp.GetAsync(oids, func(pdu snmpclient2.PDU, info snmpclient2.RequestInfo, err error) {
+		infos <- info
+		errs <- err
+	})
+	err = <-errs
+	if e, ok := err.(net.Error); !ok || !e.Timeout() {
+		t.Errorf("GetAsync() - expected a timeout, actual [%v]", err)
+	}
+	if info := <-infos; info.Attempts != 3 || info.RequestId == 0 {
+		t.Errorf("GetAsync() - unexpected info %+v", info)
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("GetAsync() - expected 3 attempts, elapsed [%s]", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(snmpclient2.WithCorrelation(context.Background(), "job-42"))
+	snmp.DoAsync(ctx, snmpclient2.NewPduWithOids(snmpclient2.V2c, snmpclient2.GetRequest, oids), func(pdu snmpclient2.PDU, info snmpclient2.RequestInfo, err error) {
+		infos <- info
+		errs <- err
+	})
+	cancel()
+	if e, ok := (<-errs).(snmpclient2.ResponseError); !ok || e.Cause != context.Canceled || e.Correlation != "job-42" {
+		t.Errorf("DoAsync() - expected [%v], actual [%v]", context.Canceled, e)
+	}
+	if info := <-infos; info.Correlation != "job-42" {
+		t.Errorf("DoAsync() - expected [%s], actual [%v]", "job-42", info.Correlation)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	select {
+	case err = <-errs:
+		t.Errorf("DoAsync() - fn is called twice, [%v]", err)
+	default:
+	}
+}
+
+func TestAsyncSNMPPortUnreachable(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := conn.LocalAddr().String()
+	conn.Close()
+
+	snmp, _ := snmpclient2.NewAsyncSNMP("udp", address, snmpclient2.Arguments{
+		Version:   snmpclient2.V2c,
+		Community: "public",
+		Timeout:   200 * time.Millisecond,
+		Retries:   10,
+	})
+	defer snmp.Close()
+
+	// the first attempts are refused by ICMP, the agent starts later
+	errs := make(chan error, 1)
+	go func() {
+		_, err := snmp.GetRequest(snmpclient2.MustParseOids("1.3.6.1.2.1.1.1.0"))
+		errs <- err
+	}()
+	time.Sleep(300 * time.Millisecond)
+	srv, err := snmpclient2.NewUdpServerFromString("unreachable", address,
+		`iso.3.6.1.2.1.1.1.0 = STRING: "Test Agent"`, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	if err = <-errs; err != nil {
+		t.Errorf("GetRequest() - has error %v", err)
+	}
+}
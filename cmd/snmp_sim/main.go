@@ -3,6 +3,8 @@ package main
 import (
 	"flag"
 	"fmt"
+	"log"
+	"net/http"
 	"os"
 
 	"github.com/runner-mei/snmpclient2"
@@ -12,10 +14,21 @@ var (
 	address = flag.String("listen", ":161", "")
 	file    = flag.String("file", "", "")
 	miss    = flag.Int("miss", 0, "")
+	control = flag.String("control", "", "the address of the HTTP control API, e.g. 127.0.0.1:8161")
 )
 
+// stdLogger writes the warnings of the simulator to the standard logger
+type stdLogger struct{}
+
+func (stdLogger) Debugf(format string, args ...interface{}) {}
+
+func (stdLogger) Warnf(format string, args ...interface{}) {
+	log.Printf(format, args...)
+}
+
 func main() {
 	flag.Parse()
+	snmpclient2.SetLogger(stdLogger{})
 
 	if "" == *file {
 		fmt.Println("file is required.")
@@ -28,6 +41,14 @@ func main() {
 	}
 	srv.SetMiss(*miss)
 	fmt.Println("listen at:", srv.GetPort())
+	if "" != *control {
+		go func() {
+			if e := http.ListenAndServe(*control, srv.ControlHandler(*file)); nil != e {
+				fmt.Println(e)
+			}
+		}()
+		fmt.Println("control at:", *control)
+	}
 
 	os.Stdin.Read(make([]byte, 1))
 	srv.Close()
@@ -149,6 +149,18 @@ func (e ErrorStatus) String() string {
 	}
 }
 
+// The generic-trap of the Trap-PDU (RFC1157 Section 4.1.6), the
+// specific-trap is significant only for EnterpriseSpecific
+const (
+	ColdStart = iota
+	WarmStart
+	LinkDown
+	LinkUp
+	AuthenticationFailure
+	EgpNeighborLoss
+	EnterpriseSpecific
+)
+
 type SecurityLevel int
 
 const (
@@ -173,24 +185,33 @@ func (s SecurityLevel) String() string {
 type AuthProtocol string
 
 const (
-	Md5 AuthProtocol = "MD5"
-	Sha AuthProtocol = "SHA"
+	Md5    AuthProtocol = "MD5"
+	Sha    AuthProtocol = "SHA"
+	Sha224 AuthProtocol = "SHA224" // usmHMAC128SHA224AuthProtocol (RFC7860)
+	Sha256 AuthProtocol = "SHA256" // usmHMAC192SHA256AuthProtocol (RFC7860)
+	Sha384 AuthProtocol = "SHA384" // usmHMAC256SHA384AuthProtocol (RFC7860)
+	Sha512 AuthProtocol = "SHA512" // usmHMAC384SHA512AuthProtocol (RFC7860)
 )
 
 type PrivProtocol string
 
 const (
-	Des PrivProtocol = "DES"
-	Aes PrivProtocol = "AES"
+	Des       PrivProtocol = "DES"
+	Aes       PrivProtocol = "AES"
+	TripleDes PrivProtocol = "3DES" // usm3DESEDEPrivProtocol (draft-reeder-snmpv3-usm-3desede)
 )
 
 const (
-	timeoutDefault = 5 * time.Second
-	recvBufferSize = 1 << 11
-	msgSizeDefault = 1400
-	msgSizeMinimum = 484
-	tagMask        = 0x1f
-	mega           = 1 << 20
+	timeoutDefault         = 5 * time.Second
+	healthTimeoutDefault   = 2 * time.Second
+	maxWalkVarBindsDefault = 1000000
+	recvBufferSize         = 1 << 11
+	msgSizeDefault         = 1400
+	msgSizeMinimum         = 484
+	udpMessageSizeMax      = 65507
+	engineIdMaxLength      = 32
+	tagMask                = 0x1f
+	mega                   = 1 << 20
 )
 
 // // ASN.1 Class
@@ -303,6 +324,7 @@ func (r reportStatusOid) String() string {
 }
 
 var (
-	OidSysUpTime = MustParseOidFromString("1.3.6.1.2.1.1.3.0")
-	OidSnmpTrap  = MustParseOidFromString("1.3.6.1.6.3.1.1.4.1.0")
+	OidSysUpTime       = MustParseOidFromString("1.3.6.1.2.1.1.3.0")
+	OidSnmpTrap        = MustParseOidFromString("1.3.6.1.6.3.1.1.4.1.0")
+	OidSnmpEngineBoots = MustParseOidFromString("1.3.6.1.6.3.10.2.1.2.0")
 )
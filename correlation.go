@@ -0,0 +1,87 @@
+package snmpclient2
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+type correlationKey struct{}
+
+// WithCorrelation returns a copy of ctx carrying an opaque value which
+// identifies the request to the caller, e.g. the id of an upstream job.
+// The value is reported back in RequestInfo, the errors of the request, the
+// CorrelatedTraceHandler and the lines of the Logger, it never changes the
+// message sent to the agent.
+func WithCorrelation(ctx context.Context, value interface{}) context.Context {
+	return context.WithValue(ctx, correlationKey{}, value)
+}
+
+// CorrelationFromContext returns the value attached by WithCorrelation.
+func CorrelationFromContext(ctx context.Context) interface{} {
+	if ctx == nil {
+		return nil
+	}
+	return ctx.Value(correlationKey{})
+}
+
+// RequestInfo describes a completed request.
+type RequestInfo struct {
+	Correlation interface{}   // Value attached by WithCorrelation
+	RequestId   int           // Request id of the last attempt
+	Attempts    int           // Number of attempts
+	Elapsed     time.Duration // Time spent including the retries
+}
+
+// A CorrelatedError is an error of a request with a correlation value, other
+// than a ResponseError which carries the value itself, e.g. a timeout or an
+// error of the dialer. It is a net.Error, a timeout is still a timeout.
+type CorrelatedError struct {
+	Err         error       // Error of the request
+	Correlation interface{} // Correlation value of the request, see WithCorrelation
+}
+
+func (e CorrelatedError) Error() string {
+	return e.Err.Error()
+}
+
+func (e CorrelatedError) Unwrap() error {
+	return e.Err
+}
+
+func (e CorrelatedError) Timeout() bool {
+	ne, ok := e.Err.(net.Error)
+	return ok && ne.Timeout()
+}
+
+func (e CorrelatedError) Temporary() bool {
+	ne, ok := e.Err.(interface{ Temporary() bool })
+	return ok && ne.Temporary()
+}
+
+func withCorrelation(err error, correlation interface{}) error {
+	if correlation == nil {
+		return err
+	}
+	switch e := err.(type) {
+	case ResponseError:
+		e.Correlation = correlation
+		return e
+	case notInTimeWindowError:
+		e.Correlation = correlation
+		return e.ResponseError
+	case CorrelatedError:
+		return e
+	}
+	return CorrelatedError{Err: err, Correlation: correlation}
+}
+
+// correlationNote returns the note of the correlation value in a line of the
+// Logger, it is empty if there is no value
+func correlationNote(correlation interface{}) string {
+	if correlation == nil {
+		return ""
+	}
+	return fmt.Sprintf(", correlation [%v]", correlation)
+}
@@ -0,0 +1,99 @@
+package snmpclient2_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/runner-mei/snmpclient2"
+)
+
+func TestCorrelation(t *testing.T) {
+	dialer := newMemDialer(memAgent(t, map[string]snmpclient2.Variable{
+		"1.3.6.1.2.1.1.1.0": snmpclient2.NewOctetString([]byte("Test Agent")),
+	}))
+	snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:161", snmpclient2.Arguments{
+		Version:   snmpclient2.V2c,
+		Community: "public",
+		Dialer:    dialer,
+	})
+	defer snmp.Close()
+
+	oids, _ := snmpclient2.NewOids([]string{"1.3.6.1.2.1.1.1.0"})
+	ctx := snmpclient2.WithCorrelation(context.Background(), "job-42")
+	pdu := snmpclient2.NewPduWithOids(snmpclient2.V2c, snmpclient2.GetRequest, oids)
+
+	res, info, err := snmp.Do(ctx, pdu)
+	if err != nil {
+		t.Fatalf("Do() - has error %v", err)
+	}
+	if info.Correlation != "job-42" {
+		t.Errorf("Do() - expected [%s], actual [%v]", "job-42", info.Correlation)
+	}
+	if info.Attempts != 1 || info.RequestId != res.RequestId() {
+		t.Errorf("Do() - unexpected info %+v", info)
+	}
+}
+
+func TestCorrelationError(t *testing.T) {
+	dialer := newMemDialer(func([]byte) [][]byte {
+		return [][]byte{{0x30, 0x00}}
+	})
+	snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:161", snmpclient2.Arguments{
+		Version:   snmpclient2.V2c,
+		Community: "public",
+		Dialer:    dialer,
+	})
+	defer snmp.Close()
+
+	oids, _ := snmpclient2.NewOids([]string{"1.3.6.1.2.1.1.1.0"})
+	ctx := snmpclient2.WithCorrelation(context.Background(), 42)
+	pdu := snmpclient2.NewPduWithOids(snmpclient2.V2c, snmpclient2.GetRequest, oids)
+
+	_, _, err := snmp.Do(ctx, pdu)
+	e, ok := err.(snmpclient2.ResponseError)
+	if !ok {
+		t.Fatalf("Do() - expected ResponseError, actual [%v]", err)
+	}
+	if e.Correlation != 42 {
+		t.Errorf("Do() - expected [%d], actual [%v]", 42, e.Correlation)
+	}
+}
+
+func TestCorrelationTimeout(t *testing.T) {
+	dialer := newMemDialer(func([]byte) [][]byte { return nil })
+	snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:161", snmpclient2.Arguments{
+		Version:   snmpclient2.V2c,
+		Community: "public",
+		Timeout:   10 * time.Millisecond,
+		Dialer:    dialer,
+	})
+	defer snmp.Close()
+
+	var logger recordLogger
+	snmp.SetLogger(&logger)
+	var traced []interface{}
+	snmp.SetCorrelatedTraceHandler(func(direction snmpclient2.Direction, raw []byte, msg snmpclient2.Message,
+		err error, correlation interface{}) {
+		traced = append(traced, correlation)
+	})
+
+	oids, _ := snmpclient2.NewOids([]string{"1.3.6.1.2.1.1.1.0"})
+	ctx := snmpclient2.WithCorrelation(context.Background(), "job-7")
+	pdu := snmpclient2.NewPduWithOids(snmpclient2.V2c, snmpclient2.GetRequest, oids)
+
+	_, info, err := snmp.Do(ctx, pdu)
+	e, ok := err.(snmpclient2.CorrelatedError)
+	if !ok {
+		t.Fatalf("Do() - expected CorrelatedError, actual [%v]", err)
+	}
+	if e.Correlation != "job-7" || !e.Timeout() || info.Correlation != "job-7" {
+		t.Errorf("Do() - unexpected error %#v", e)
+	}
+	if len(traced) != 1 || traced[0] != "job-7" {
+		t.Errorf("SetCorrelatedTraceHandler() - expected [job-7], actual %v", traced)
+	}
+	if !logger.contains("is failed - ") || !logger.contains(", correlation [job-7]") {
+		t.Errorf("SetLogger() - expected the correlation, actual %v", logger.lines)
+	}
+}
@@ -0,0 +1,341 @@
+package snmpclient2
+
+import (
+	"context"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/runner-mei/snmpclient2/asn1"
+)
+
+// Dispatcher shares one unconnected UDP socket among the SNMP and the
+// AsyncSNMP objects of many agents, it is the Dialer of their Arguments.
+// The id of every message written by a connection is registered with the
+// address of the agent, and a reader routes each datagram by the id and
+// the address to the one connection which sent the request, so thousands
+// of agents are polled over one socket.
+type Dispatcher struct {
+	misrouted  uint64 // first for the 64-bit alignment of atomic
+	overflowed uint64
+
+	conn      net.PacketConn
+	mu        sync.Mutex
+	peers     map[string][]*dispatchConn
+	pendings  map[dispatchKey]dispatchPending
+	lastSweep time.Time
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// dispatchKey is the id of a request, the message id of SNMPv3, and the
+// address of its agent
+type dispatchKey struct {
+	peer string
+	id   int
+}
+
+type dispatchPending struct {
+	conn   *dispatchConn
+	sentAt time.Time
+}
+
+// NewDispatcher listens on the local address of the network, e.g. "udp"
+// and ":0", and starts the reader
+func NewDispatcher(network, laddr string) (*Dispatcher, error) {
+	conn, err := net.ListenPacket(network, laddr)
+	if err != nil {
+		return nil, err
+	}
+	d := &Dispatcher{conn: conn, peers: map[string][]*dispatchConn{},
+		pendings: map[dispatchKey]dispatchPending{}, lastSweep: time.Now()}
+	d.wg.Add(1)
+	go d.serve()
+	return d, nil
+}
+
+// DialContext returns a connection to the agent at address over the shared
+// socket, the network must be UDP
+func (d *Dispatcher) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if network != "udp" && network != "udp4" && network != "udp6" {
+		return nil, ArgumentError{
+			Value:   network,
+			Message: "Dispatcher supports the UDP transport only",
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	raddr, err := net.ResolveUDPAddr(network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &dispatchConn{
+		d:       d,
+		raddr:   raddr,
+		key:     raddr.String(),
+		packets: make(chan []byte, dispatchQueueSize),
+		closed:  make(chan struct{}),
+		changed: make(chan struct{}),
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return nil, net.ErrClosed
+	}
+	d.peers[c.key] = append(d.peers[c.key], c)
+	return c, nil
+}
+
+// LocalAddr returns the address of the shared socket
+func (d *Dispatcher) LocalAddr() net.Addr {
+	return d.conn.LocalAddr()
+}
+
+// Dropped returns the number of the datagrams which are routed to no
+// connection, it is Misrouted plus Overflowed
+func (d *Dispatcher) Dropped() uint64 {
+	return d.Misrouted() + d.Overflowed()
+}
+
+// Misrouted returns the number of the datagrams which match no pending
+// request, e.g. from an unknown address, a late response or a duplicate
+func (d *Dispatcher) Misrouted() uint64 {
+	return atomic.LoadUint64(&d.misrouted)
+}
+
+// Overflowed returns the number of the datagrams which are dropped because
+// the queue of their connection is full, e.g. of a slow reader
+func (d *Dispatcher) Overflowed() uint64 {
+	return atomic.LoadUint64(&d.overflowed)
+}
+
+// Close the socket, the connections fail
+func (d *Dispatcher) Close() error {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return nil
+	}
+	d.closed = true
+	err := d.conn.Close()
+	var conns []*dispatchConn
+	for _, peers := range d.peers {
+		conns = append(conns, peers...)
+	}
+	d.peers = map[string][]*dispatchConn{}
+	d.pendings = map[dispatchKey]dispatchPending{}
+	d.mu.Unlock()
+
+	for _, c := range conns {
+		c.Close()
+	}
+	d.wg.Wait()
+	return err
+}
+
+func (d *Dispatcher) serve() {
+	defer d.wg.Done()
+
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, addr, err := d.conn.ReadFrom(buf)
+		if err != nil {
+			if e, ok := err.(net.Error); ok && e.Timeout() {
+				continue
+			}
+			return
+		}
+		id, ok := peekMessageId(buf[:n])
+		if !ok {
+			atomic.AddUint64(&d.misrouted, 1)
+			continue
+		}
+		key := dispatchKey{peer: addr.String(), id: id}
+		d.mu.Lock()
+		pending, ok := d.pendings[key]
+		delete(d.pendings, key)
+		d.mu.Unlock()
+		if !ok {
+			atomic.AddUint64(&d.misrouted, 1)
+			continue
+		}
+
+		select {
+		case pending.conn.packets <- append([]byte(nil), buf[:n]...):
+		default:
+			atomic.AddUint64(&d.overflowed, 1)
+		}
+	}
+}
+
+// register makes c the owner of the response to the message b, the
+// requests which are never answered expire after dispatchPendingTimeout
+func (d *Dispatcher) register(c *dispatchConn, b []byte) {
+	id, ok := peekMessageId(b)
+	if !ok {
+		return
+	}
+	now := time.Now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return
+	}
+	d.pendings[dispatchKey{peer: c.key, id: id}] = dispatchPending{conn: c, sentAt: now}
+	if now.Sub(d.lastSweep) < dispatchPendingTimeout {
+		return
+	}
+	d.lastSweep = now
+	for key, pending := range d.pendings {
+		if now.Sub(pending.sentAt) >= dispatchPendingTimeout {
+			delete(d.pendings, key)
+		}
+	}
+}
+
+// peekMessageId returns the id of the message which a response carries in
+// the clear, the request id of V1 and V2c or the message id of V3
+func peekMessageId(b []byte) (int, bool) {
+	var raw asn1.RawValue
+	if _, err := asn1.Unmarshal(b, &raw); err != nil {
+		return 0, false
+	}
+	var version int
+	if _, err := asn1.Unmarshal(raw.Bytes, &version); err != nil {
+		return 0, false
+	}
+	if v := SnmpVersion(version); v != V1 && v != V2c && v != V3 {
+		return 0, false
+	}
+	return peekId(SnmpVersion(version), b)
+}
+
+func (d *Dispatcher) remove(c *dispatchConn) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	peers := d.peers[c.key]
+	for i, p := range peers {
+		if p == c {
+			peers = append(peers[:i:i], peers[i+1:]...)
+			break
+		}
+	}
+	if len(peers) == 0 {
+		delete(d.peers, c.key)
+	} else {
+		d.peers[c.key] = peers
+	}
+	for key, pending := range d.pendings {
+		if pending.conn == c {
+			delete(d.pendings, key)
+		}
+	}
+}
+
+const (
+	maxDatagramSize        = 65535
+	dispatchQueueSize      = 64
+	dispatchPendingTimeout = 10 * time.Minute
+)
+
+// dispatchConn is a connection over the socket of a Dispatcher, the
+// datagrams from the agent are queued by the reader of the Dispatcher
+type dispatchConn struct {
+	d       *Dispatcher
+	raddr   *net.UDPAddr
+	key     string
+	packets chan []byte
+	once    sync.Once
+	closed  chan struct{}
+
+	mu       sync.Mutex
+	deadline time.Time
+	changed  chan struct{} // closed when the deadline is changed
+}
+
+func (c *dispatchConn) Read(b []byte) (int, error) {
+	for {
+		c.mu.Lock()
+		deadline, changed := c.deadline, c.changed
+		c.mu.Unlock()
+
+		var timer *time.Timer
+		var expired <-chan time.Time
+		if !deadline.IsZero() {
+			d := time.Until(deadline)
+			if d <= 0 {
+				return 0, os.ErrDeadlineExceeded
+			}
+			timer = time.NewTimer(d)
+			expired = timer.C
+		}
+
+		n, err, ok := 0, error(nil), true
+		select {
+		case packet := <-c.packets:
+			n = copy(b, packet)
+		case <-c.closed:
+			err = net.ErrClosed
+		case <-expired:
+			err = os.ErrDeadlineExceeded
+		case <-changed:
+			ok = false
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ok {
+			return n, err
+		}
+	}
+}
+
+func (c *dispatchConn) Write(b []byte) (int, error) {
+	select {
+	case <-c.closed:
+		return 0, net.ErrClosed
+	default:
+	}
+	c.d.register(c, b)
+	return c.d.conn.WriteTo(b, c.raddr)
+}
+
+func (c *dispatchConn) Close() error {
+	c.once.Do(func() {
+		close(c.closed)
+		c.d.remove(c)
+	})
+	return nil
+}
+
+func (c *dispatchConn) LocalAddr() net.Addr {
+	return c.d.conn.LocalAddr()
+}
+
+func (c *dispatchConn) RemoteAddr() net.Addr {
+	return c.raddr
+}
+
+func (c *dispatchConn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+// SetReadDeadline wakes the blocked Read up to check the new deadline
+func (c *dispatchConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deadline = t
+	close(c.changed)
+	c.changed = make(chan struct{})
+	return nil
+}
+
+// SetWriteDeadline does nothing, the socket is shared by the connections
+func (c *dispatchConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
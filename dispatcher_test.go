@@ -0,0 +1,166 @@
+package snmpclient2_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/runner-mei/snmpclient2"
+)
+
+func TestDispatcher(t *testing.T) {
+	dispatcher, err := snmpclient2.NewDispatcher("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dispatcher.Close()
+
+	var agents []*snmpclient2.AsyncSNMP
+	var syncAgents []*snmpclient2.SNMP
+	for a := 0; a < 3; a++ {
+		var mibs string
+		for i := 1; i <= 20; i++ {
+			mibs += fmt.Sprintf("iso.3.6.1.2.1.2.2.1.2.%d = STRING: \"agent%d-if%d\"\n", i, a, i)
+		}
+		srv, err := snmpclient2.NewUdpServerFromString(fmt.Sprintf("agent%d", a), "127.0.0.1:0", mibs, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer srv.Close()
+
+		args := snmpclient2.Arguments{
+			Version:   snmpclient2.V2c,
+			Community: "public",
+			Timeout:   2 * time.Second,
+			Retries:   2,
+			Dialer:    dispatcher,
+		}
+		snmp, _ := snmpclient2.NewAsyncSNMP("udp", "127.0.0.1:"+srv.GetPort(), args)
+		defer snmp.Close()
+		agents = append(agents, snmp)
+
+		syncSnmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:"+srv.GetPort(), args)
+		defer syncSnmp.Close()
+		syncAgents = append(syncAgents, syncSnmp)
+	}
+
+	var wg sync.WaitGroup
+	for a := range agents {
+		for i := 1; i <= 20; i++ {
+			oids, _ := snmpclient2.NewOids([]string{fmt.Sprintf("1.3.6.1.2.1.2.2.1.2.%d", i)})
+			expected := fmt.Sprintf("agent%d-if%d", a, i)
+			check := func(pdu snmpclient2.PDU, err error) {
+				if err != nil {
+					t.Errorf("GetRequest(%s) - has error %v", expected, err)
+					return
+				}
+				if vb := pdu.VariableBindings().MatchOid(oids[0]); vb == nil || vb.AsString() != expected {
+					t.Errorf("GetRequest() - expected [%s], actual [%v]", expected, vb)
+				}
+			}
+
+			wg.Add(2)
+			agents[a].GetAsync(oids, func(pdu snmpclient2.PDU, _ snmpclient2.RequestInfo, err error) {
+				defer wg.Done()
+				check(pdu, err)
+			})
+			go func(snmp *snmpclient2.SNMP) {
+				defer wg.Done()
+				check(snmp.GetRequest(oids))
+			}(syncAgents[a])
+		}
+	}
+	wg.Wait()
+
+	tcp, _ := snmpclient2.NewSNMP("tcp", "127.0.0.1:161", snmpclient2.Arguments{
+		Version:   snmpclient2.V2c,
+		Community: "public",
+		Dialer:    dispatcher,
+	})
+	if err = tcp.Open(); err == nil {
+		t.Error("Open() - expected an error over tcp")
+	}
+
+	dispatcher.Close()
+	oids, _ := snmpclient2.NewOids([]string{"1.3.6.1.2.1.2.2.1.2.1"})
+	if _, err = agents[0].GetRequest(oids); err == nil {
+		t.Error("GetRequest() - expected an error after Close")
+	}
+}
+
+func TestDispatcherRouting(t *testing.T) {
+	dispatcher, err := snmpclient2.NewDispatcher("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dispatcher.Close()
+
+	srv, err := snmpclient2.NewUdpServerFromString("agent", "127.0.0.1:0",
+		"iso.3.6.1.2.1.1.1.0 = STRING: \"Test Agent\"\n", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	address := "127.0.0.1:" + srv.GetPort()
+
+	request := func(id int) []byte {
+		pdu := snmpclient2.NewPduWithOids(snmpclient2.V2c, snmpclient2.GetRequest,
+			snmpclient2.MustParseOids("1.3.6.1.2.1.1.1.0"))
+		pdu.SetRequestId(id)
+		msg := snmpclient2.NewMessage(snmpclient2.V2c, pdu).(*snmpclient2.MessageV1)
+		msg.Community = []byte("public")
+		b, _ := pdu.Marshal()
+		msg.SetPduBytes(b)
+		b, _ = msg.Marshal()
+		return b
+	}
+
+	// the sessions to the same agent receive their own responses only
+	first, _ := dispatcher.DialContext(context.Background(), "udp", address)
+	defer first.Close()
+	second, _ := dispatcher.DialContext(context.Background(), "udp", address)
+	defer second.Close()
+	first.Write(request(1))
+	second.Write(request(2))
+	buf := make([]byte, 1500)
+	for _, c := range []net.Conn{first, second} {
+		c.SetReadDeadline(time.Now().Add(time.Second))
+		if _, err = c.Read(buf); err != nil {
+			t.Fatalf("Read() - has error %v", err)
+		}
+		c.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+		if _, err = c.Read(buf); err == nil {
+			t.Error("Read() - expected the response of the other session is not routed")
+		}
+	}
+
+	// the requests which are not read overflow the queue of the session
+	for i := 0; i < 100; i++ {
+		first.Write(request(100 + i))
+	}
+	deadline := time.Now().Add(time.Second)
+	for dispatcher.Overflowed() < 36 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := dispatcher.Overflowed(); n != 36 {
+		t.Errorf("Overflowed() - expected [%d], actual [%d]", 36, n)
+	}
+
+	// the duplicate of the response is routed to no session
+	srv.SetDuplicateRate(1)
+	second.Write(request(3))
+	second.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err = second.Read(buf); err != nil {
+		t.Fatalf("Read() - has error %v", err)
+	}
+	deadline = time.Now().Add(time.Second)
+	for dispatcher.Misrouted() < 1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := dispatcher.Misrouted(); n != 1 || dispatcher.Dropped() != 37 {
+		t.Errorf("Misrouted() - expected [%d], actual [%d]", 1, n)
+	}
+}
@@ -0,0 +1,319 @@
+package snmpclient2
+
+import (
+	"encoding/hex"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dsnParam is a query parameter of the DSN, format returns "" if the
+// field is the zero value
+type dsnParam struct {
+	name   string
+	parse  func(a *Arguments, v string) error
+	format func(a *Arguments) string
+}
+
+const dsnRedacted = "xxxxx"
+
+func durationParam(name string, field func(a *Arguments) *time.Duration) dsnParam {
+	return dsnParam{name,
+		func(a *Arguments, v string) (err error) {
+			*field(a), err = time.ParseDuration(v)
+			return
+		},
+		func(a *Arguments) string {
+			if d := *field(a); d != 0 {
+				return d.String()
+			}
+			return ""
+		}}
+}
+
+func intParam(name string, field func(a *Arguments) *int) dsnParam {
+	return dsnParam{name,
+		func(a *Arguments, v string) (err error) {
+			*field(a), err = strconv.Atoi(v)
+			return
+		},
+		func(a *Arguments) string {
+			if i := *field(a); i != 0 {
+				return strconv.Itoa(i)
+			}
+			return ""
+		}}
+}
+
+func boolParam(name string, field func(a *Arguments) *bool) dsnParam {
+	return dsnParam{name,
+		func(a *Arguments, v string) (err error) {
+			*field(a), err = strconv.ParseBool(v)
+			return
+		},
+		func(a *Arguments) string {
+			if *field(a) {
+				return "true"
+			}
+			return ""
+		}}
+}
+
+func stringParam(name string, field func(a *Arguments) *string) dsnParam {
+	return dsnParam{name,
+		func(a *Arguments, v string) error {
+			*field(a) = v
+			return nil
+		},
+		func(a *Arguments) string { return *field(a) }}
+}
+
+// secretParam is a password or a key, it is redacted by DSN
+func secretParam(name string, parse func(a *Arguments, v string) error, set func(a *Arguments) bool) dsnParam {
+	return dsnParam{name, parse,
+		func(a *Arguments) string {
+			if set(a) {
+				return dsnRedacted
+			}
+			return ""
+		}}
+}
+
+// the parameters of all the Arguments except Version, Community and
+// UserName, which are the scheme and the user of the URL, and Dialer,
+// OnEngineDiscovered, EngineCache, EngineConfig, RequestIdGenerator,
+// OidResolver and TLSConfig, which are not strings
+var dsnParams = []dsnParam{
+	durationParam("timeout", func(a *Arguments) *time.Duration { return &a.Timeout }),
+	durationParam("connect_timeout", func(a *Arguments) *time.Duration { return &a.ConnectTimeout }),
+	{"retries",
+		func(a *Arguments, v string) error {
+			n, err := strconv.ParseUint(v, 10, 32)
+			a.Retries = uint(n)
+			return err
+		},
+		func(a *Arguments) string {
+			if a.Retries != 0 {
+				return strconv.FormatUint(uint64(a.Retries), 10)
+			}
+			return ""
+		}},
+	durationParam("retry_backoff", func(a *Arguments) *time.Duration { return &a.RetryBackoff }),
+	boolParam("retry_jitter", func(a *Arguments) *bool { return &a.RetryJitter }),
+	durationParam("health_timeout", func(a *Arguments) *time.Duration { return &a.HealthTimeout }),
+	intParam("max_size", func(a *Arguments) *int { return &a.MessageMaxSize }),
+	{"level",
+		func(a *Arguments, v string) (err error) {
+			a.SecurityLevel, err = ParseSecurityLevel(v)
+			return
+		},
+		func(a *Arguments) string {
+			if a.SecurityLevel != NoAuthNoPriv {
+				s := a.SecurityLevel.String()
+				return strings.ToLower(s[:1]) + s[1:]
+			}
+			return ""
+		}},
+	{"auth",
+		func(a *Arguments, v string) (err error) {
+			a.AuthProtocol, err = ParseAuthProtocol(v)
+			return
+		},
+		func(a *Arguments) string { return strings.ToLower(string(a.AuthProtocol)) }},
+	secretParam("authpass",
+		func(a *Arguments, v string) error {
+			a.AuthPassword = v
+			return nil
+		},
+		func(a *Arguments) bool { return a.AuthPassword != "" }),
+	secretParam("authkey",
+		func(a *Arguments, v string) (err error) {
+			a.AuthKey, err = hex.DecodeString(StripHexPrefix(v))
+			return
+		},
+		func(a *Arguments) bool { return len(a.AuthKey) != 0 }),
+	{"priv",
+		func(a *Arguments, v string) (err error) {
+			a.PrivProtocol, err = ParsePrivProtocol(v)
+			return
+		},
+		func(a *Arguments) string { return strings.ToLower(string(a.PrivProtocol)) }},
+	secretParam("privpass",
+		func(a *Arguments, v string) error {
+			a.PrivPassword = v
+			return nil
+		},
+		func(a *Arguments) bool { return a.PrivPassword != "" }),
+	secretParam("privkey",
+		func(a *Arguments, v string) (err error) {
+			a.PrivKey, err = hex.DecodeString(StripHexPrefix(v))
+			return
+		},
+		func(a *Arguments) bool { return len(a.PrivKey) != 0 }),
+	stringParam("engine", func(a *Arguments) *string { return &a.SecurityEngineId }),
+	stringParam("context_engine", func(a *Arguments) *string { return &a.ContextEngineId }),
+	stringParam("context", func(a *Arguments) *string { return &a.ContextName }),
+	stringParam("local", func(a *Arguments) *string { return &a.LocalAddress }),
+	stringParam("cert", func(a *Arguments) *string { return &a.CertFile }),
+	stringParam("key", func(a *Arguments) *string { return &a.KeyFile }),
+	stringParam("ca", func(a *Arguments) *string { return &a.CAFile }),
+	boolParam("allow_engine_mismatch", func(a *Arguments) *bool { return &a.AllowEngineIdMismatch }),
+	boolParam("disable_resync", func(a *Arguments) *bool { return &a.DisableTimeWindowResync }),
+	boolParam("disable_rediscovery", func(a *Arguments) *bool { return &a.DisableRediscovery }),
+	boolParam("split_on_too_big", func(a *Arguments) *bool { return &a.SplitOnTooBig }),
+	boolParam("adaptive_repetitions", func(a *Arguments) *bool { return &a.AdaptiveRepetitions }),
+	boolParam("lenient", func(a *Arguments) *bool { return &a.LenientDecoding }),
+	boolParam("strict", func(a *Arguments) *bool { return &a.StrictResponse }),
+	boolParam("pdu_errors", func(a *Arguments) *bool { return &a.ReturnPduErrors }),
+	intParam("max_walk_varbinds", func(a *Arguments) *int { return &a.MaxWalkVarBinds }),
+	durationParam("max_walk_duration", func(a *Arguments) *time.Duration { return &a.MaxWalkDuration }),
+}
+
+// ParseArguments returns the Arguments of the DSN, see ParseDSN
+func ParseArguments(dsn string) (Arguments, error) {
+	_, args, err := ParseDSN(dsn)
+	return args, err
+}
+
+// ParseDSN returns the address and the Arguments of the DSN, e.g.
+//
+//	snmp://public@10.0.0.1:161?version=2c&timeout=3s&retries=2
+//	snmp3://monitor@switch:161?level=authPriv&auth=sha&authpass=...&priv=aes&privpass=...&context=vlan-10
+//
+// The user is the Community of the version 1 and 2c, which is the default
+// of "snmp", or the UserName of the version 3, which is the default of
+// "snmp3". The query parameters are the other fields of Arguments, e.g.
+// "connect_timeout" of ConnectTimeout, an unknown parameter is an error.
+// The defaults are applied to the Arguments after they are validated.
+// The network of the "transport" parameter is returned by ParseTarget.
+func ParseDSN(dsn string) (string, Arguments, error) {
+	_, address, args, err := ParseTarget(dsn)
+	return address, args, err
+}
+
+// ParseTarget returns the network, the address and the Arguments of the
+// DSN for NewSNMP. The network is the "transport" parameter, e.g.
+//
+//	snmp3://monitor@switch?transport=tls&level=authPriv&cert=client.pem&key=client.key
+//
+// The default is "udp". The Arguments are validated on the network.
+func ParseTarget(dsn string) (network string, address string, args Arguments, err error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		// the error of url.Parse has the DSN with the passwords
+		if e, ok := err.(*url.Error); ok {
+			err = e.Err
+		}
+		return "", "", args, ArgumentError{Value: "DSN", Message: "Invalid DSN - " + err.Error()}
+	}
+	switch u.Scheme {
+	case "snmp":
+		args.Version = V2c
+	case "snmp3":
+		args.Version = V3
+	default:
+		return "", "", args, ArgumentError{Value: u.Scheme, Message: "Scheme of DSN must be snmp or snmp3"}
+	}
+	if u.Host == "" {
+		return "", "", args, ArgumentError{Value: redactDSN(u), Message: "Host of DSN is missing"}
+	}
+
+	query, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return "", "", args, ArgumentError{Value: redactDSN(u), Message: "Invalid query of DSN - " + err.Error()}
+	}
+	if v, ok := query["version"]; ok {
+		if args.Version, err = ParseVersion(v[len(v)-1]); err != nil {
+			return "", "", args, ArgumentError{Value: v[len(v)-1], Message: err.Error()}
+		}
+		if u.Scheme == "snmp3" && args.Version != V3 {
+			return "", "", args, ArgumentError{Value: v[len(v)-1], Message: "Version of snmp3 must be 3"}
+		}
+		delete(query, "version")
+	}
+
+	if nil != u.User {
+		if _, ok := u.User.Password(); ok {
+			return "", "", args, ArgumentError{
+				Value:   redactDSN(u),
+				Message: "Password of the user is unsupported, use authpass and privpass",
+			}
+		}
+		if args.Version == V3 {
+			args.UserName = u.User.Username()
+		} else {
+			args.Community = u.User.Username()
+		}
+	}
+
+	network = "udp"
+	if v, ok := query["transport"]; ok {
+		network = v[len(v)-1]
+		if !isDsnTransport(network) {
+			return "", "", args, ArgumentError{Value: network, Message: "Unknown transport of DSN"}
+		}
+		delete(query, "transport")
+	}
+
+	for _, p := range dsnParams {
+		v, ok := query[p.name]
+		if !ok {
+			continue
+		}
+		if err = p.parse(&args, v[len(v)-1]); err != nil {
+			return "", "", args, ArgumentError{Value: p.name, Message: "Invalid parameter of DSN - " + err.Error()}
+		}
+		delete(query, p.name)
+	}
+	for name := range query {
+		return "", "", args, ArgumentError{Value: name, Message: "Unknown parameter of DSN"}
+	}
+
+	if err = args.validateFor(network); err != nil {
+		return "", "", args, err
+	}
+	args.setDefault()
+	return network, u.Host, args, nil
+}
+
+// isDsnTransport reports whether network is a transport of NewSNMP
+func isDsnTransport(network string) bool {
+	switch network {
+	case "udp", "udp4", "udp6", "tcp", "tcp4", "tcp6":
+		return true
+	}
+	return isTsm(network)
+}
+
+// redactDSN returns the DSN without the query, which has the passwords
+func redactDSN(u *url.URL) string {
+	redacted := *u
+	redacted.User = nil
+	redacted.RawQuery = ""
+	return redacted.String()
+}
+
+// DSN returns the DSN of the Arguments and the address for ParseDSN, the
+// passwords and the keys are redacted, it is for logging.
+func (a *Arguments) DSN(address string) string {
+	u := url.URL{Scheme: "snmp", Host: address}
+	if a.Version == V3 {
+		u.Scheme = "snmp3"
+		u.User = url.User(a.UserName)
+	} else if a.Community != "" {
+		u.User = url.User(a.Community)
+	}
+
+	query := url.Values{}
+	if a.Version != V3 {
+		query.Set("version", a.Version.String())
+	}
+	for _, p := range dsnParams {
+		if v := p.format(a); v != "" {
+			query.Set(p.name, v)
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
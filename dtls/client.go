@@ -0,0 +1,225 @@
+package dtls
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+)
+
+// clientHandshake runs the handshake of the client (RFC6347 Section 4.2.2)
+func (c *Conn) clientHandshake(h *handshake) error {
+	config := c.config
+	suites := suitesOf(config)
+	if len(suites) == 0 {
+		return errors.New("dtls: no cipher suite of CipherSuites is supported")
+	}
+	if config.ServerName == "" && !config.InsecureSkipVerify {
+		return errors.New("dtls: either ServerName or InsecureSkipVerify must be specified")
+	}
+
+	h.clientRandom = make([]byte, 32)
+	if _, err := rand.Read(h.clientRandom); err != nil {
+		return err
+	}
+	hello := &clientHello{version: versionDtls12, random: h.clientRandom}
+	for _, s := range suites {
+		hello.suites = append(hello.suites, s.id)
+	}
+	hello.curves = curvesOf(config)
+	hello.schemes = signatureSchemes
+	hello.extendedMaster = true
+	hello.renegotiation = true
+	if net.ParseIP(config.ServerName) == nil {
+		hello.serverName = config.ServerName
+	}
+	if err := h.send(h.addMessage(typeClientHello, 0, hello.marshal())); err != nil {
+		return err
+	}
+
+	m, err := h.readMessage()
+	if err != nil {
+		return err
+	}
+	if m.typ == typeHelloVerifyRequest {
+		p := newParser(m.body)
+		p.u16() // server_version
+		hello.cookie = p.vector(1)
+		if !p.done() || len(hello.cookie) == 0 {
+			return alertDecodeError
+		}
+		// the first ClientHello and HelloVerifyRequest are not in the transcript
+		h.transcript = nil
+		if err = h.send(h.addMessage(typeClientHello, 0, hello.marshal())); err != nil {
+			return err
+		}
+		if m, err = h.readMessage(); err != nil {
+			return err
+		}
+	}
+
+	if m.typ != typeServerHello {
+		return alertUnexpectedMessage
+	}
+	serverHello := &serverHello{}
+	if !serverHello.unmarshal(m.body) {
+		return alertDecodeError
+	}
+	if serverHello.version != versionDtls12 {
+		return alertProtocolVersion
+	}
+	if h.suite = suiteById(suites, serverHello.suite); h.suite == nil {
+		return alertHandshakeFailure
+	}
+	h.serverRandom = serverHello.random
+	h.extendedMaster = serverHello.extendedMaster
+
+	if m, err = h.readMessage(); err != nil {
+		return err
+	}
+	if m.typ != typeCertificate {
+		return alertUnexpectedMessage
+	}
+	rawCerts, ok := unmarshalCertificates(m.body)
+	if !ok || len(rawCerts) == 0 {
+		return alertDecodeError
+	}
+	certs, err := c.verifyCertificates(rawCerts, x509.ExtKeyUsageServerAuth, config.RootCAs, !config.InsecureSkipVerify)
+	if err != nil {
+		return err
+	}
+	if isEcdsaKey(certs[0].PublicKey) != h.suite.ecdsa {
+		c.sendAlert(alertUnsupportedCertificate)
+		return errors.New("dtls: the certificate of the server does not match the cipher suite")
+	}
+
+	if m, err = h.readMessage(); err != nil {
+		return err
+	}
+	if m.typ != typeServerKeyExchange {
+		return alertUnexpectedMessage
+	}
+	keyExchange := &serverKeyExchange{}
+	if !keyExchange.unmarshal(m.body) {
+		return alertDecodeError
+	}
+	curve := curveOf(keyExchange.curve)
+	if curve == nil || !hasCurve(hello.curves, keyExchange.curve) || !hasScheme(hello.schemes, keyExchange.scheme) {
+		return alertIllegalParameter
+	}
+	signed := append(append(append([]byte(nil), h.clientRandom...), h.serverRandom...), keyExchange.params()...)
+	if err = verifySignature(certs[0].PublicKey, keyExchange.scheme, signed, keyExchange.signature); err != nil {
+		c.sendAlert(alertDecryptError)
+		return err
+	}
+	peerKey, err := curve.NewPublicKey(keyExchange.publicKey)
+	if err != nil {
+		return alertIllegalParameter
+	}
+
+	if m, err = h.readMessage(); err != nil {
+		return err
+	}
+	var request *certificateRequest
+	if m.typ == typeCertificateRequest {
+		request = &certificateRequest{}
+		if !request.unmarshal(m.body) {
+			return alertDecodeError
+		}
+		if m, err = h.readMessage(); err != nil {
+			return err
+		}
+	}
+	if m.typ != typeServerHelloDone || len(m.body) != 0 {
+		return alertUnexpectedMessage
+	}
+
+	var flight []flightEntry
+	var cert *tls.Certificate
+	if request != nil {
+		if cert, err = c.clientCertificate(request); err != nil {
+			return err
+		}
+		var chain [][]byte
+		if cert != nil {
+			chain = cert.Certificate
+		}
+		flight = append(flight, h.addMessage(typeCertificate, 0, marshalCertificates(chain)))
+	}
+
+	key, err := curve.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	var b builder
+	b.bytes(1, key.PublicKey().Bytes())
+	flight = append(flight, h.addMessage(typeClientKeyExchange, 0, b))
+	preMasterSecret, err := key.ECDH(peerKey)
+	if err != nil {
+		return alertIllegalParameter
+	}
+	clientCipher, serverCipher, err := h.deriveKeys(preMasterSecret)
+	if err != nil {
+		return err
+	}
+
+	if cert != nil {
+		signer, ok := cert.PrivateKey.(crypto.Signer)
+		if !ok {
+			return errors.New("dtls: the certificate of the client has no private key")
+		}
+		scheme, err := signatureSchemeOf(signer, request.schemes)
+		if err != nil {
+			return alertHandshakeFailure
+		}
+		signature, err := sign(signer, scheme, h.transcript)
+		if err != nil {
+			return err
+		}
+		flight = append(flight, h.addMessage(typeCertificateVerify, 0, marshalSignature(scheme, signature)))
+	}
+
+	c.writeMutex.Lock()
+	c.writeCiphers[1] = clientCipher
+	c.writeMutex.Unlock()
+	h.peerReadCipher = serverCipher
+	flight = append(flight, flightEntry{typ: contentChangeCipherSpec, data: []byte{1}})
+	flight = append(flight, h.addMessage(typeFinished, 1, h.finished("client finished", h.transcript)))
+	if err = h.send(flight...); err != nil {
+		return err
+	}
+
+	if m, err = h.readMessage(); err != nil {
+		return err
+	}
+	if m.typ != typeFinished || m.epoch != 1 {
+		return alertUnexpectedMessage
+	}
+	if !equal(m.body, h.finished("server finished", h.transcriptBefore(m))) {
+		return alertDecryptError
+	}
+
+	c.peerCertificates = certs
+	c.cipherSuite = h.suite.id
+	return nil
+}
+
+// clientCertificate returns the certificate of the client requested by the
+// server, nil if it has none
+func (c *Conn) clientCertificate(request *certificateRequest) (*tls.Certificate, error) {
+	if c.config.GetClientCertificate != nil {
+		info := &tls.CertificateRequestInfo{AcceptableCAs: request.authorities,
+			SignatureSchemes: request.schemes, Version: tls.VersionTLS12}
+		cert, err := c.config.GetClientCertificate(info)
+		if err != nil || cert == nil || len(cert.Certificate) == 0 {
+			return nil, err
+		}
+		return cert, nil
+	}
+	if len(c.config.Certificates) == 0 {
+		return nil, nil
+	}
+	return &c.config.Certificates[0], nil
+}
@@ -0,0 +1,478 @@
+// Package dtls provides the DTLS 1.2 (RFC6347) transport of SNMP (RFC6353)
+// for snmpclient2, the standard library has no DTLS.
+//
+// The handshake is the full ECDHE handshake with the certificates of a
+// crypto/tls Config, the cipher suites are the ECDHE ones with AES-GCM,
+// the sessions are not resumed and the connections are not renegotiated.
+// A Conn is a net.Conn over a connected datagram conn, each Write is sent
+// as a record of one datagram and each Read returns the data of a record.
+//
+//	conn, err := net.Dial("udp", "10.0.0.1:10161")
+//	...
+//	dtlsConn := dtls.Client(conn, &tls.Config{ServerName: "10.0.0.1", Certificates: certs, RootCAs: roots})
+//	if err := dtlsConn.HandshakeContext(ctx); err != nil {
+//		...
+//	}
+package dtls
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	contentChangeCipherSpec = 20
+	contentAlert            = 21
+	contentHandshake        = 22
+	contentApplicationData  = 23
+
+	versionDtls10 = 0xfeff
+	versionDtls12 = 0xfefd
+
+	recordHeaderLen = 13
+	maxPlaintext    = 16384
+	maxDatagram     = 1200 // the datagrams of the handshake flights, below the MTU of IPv6
+	maxSequence     = 1<<48 - 1
+)
+
+// alert is the description of an alert (RFC5246 Section 7.2), the errors
+// of the handshake which are sent to the peer
+type alert uint8
+
+const (
+	alertCloseNotify            alert = 0
+	alertUnexpectedMessage      alert = 10
+	alertHandshakeFailure       alert = 40
+	alertBadCertificate         alert = 42
+	alertUnsupportedCertificate alert = 43
+	alertIllegalParameter       alert = 47
+	alertUnknownCa              alert = 48
+	alertDecodeError            alert = 50
+	alertDecryptError           alert = 51
+	alertProtocolVersion        alert = 70
+)
+
+var alertText = map[alert]string{
+	alertCloseNotify:            "close notify",
+	alertUnexpectedMessage:      "unexpected message",
+	alertHandshakeFailure:       "handshake failure",
+	alertBadCertificate:         "bad certificate",
+	alertUnsupportedCertificate: "unsupported certificate",
+	alertIllegalParameter:       "illegal parameter",
+	alertUnknownCa:              "unknown certificate authority",
+	alertDecodeError:            "error decoding message",
+	alertDecryptError:           "error decrypting message",
+	alertProtocolVersion:        "protocol version not supported",
+}
+
+func (a alert) String() string {
+	if s, ok := alertText[a]; ok {
+		return s
+	}
+	return fmt.Sprintf("alert(%d)", uint8(a))
+}
+
+func (a alert) Error() string {
+	return "dtls: " + a.String()
+}
+
+// RemoteError is the fatal alert of the peer
+type RemoteError struct {
+	Alert uint8
+}
+
+func (e RemoteError) Error() string {
+	return "dtls: remote error: " + alert(e.Alert).String()
+}
+
+// replayWindow detects the duplicated records of an epoch (RFC6347 Section 4.1.2.6)
+type replayWindow struct {
+	latest uint64
+	bits   uint64
+	used   bool
+}
+
+func (w *replayWindow) seen(seq uint64) bool {
+	if !w.used || seq > w.latest {
+		return false
+	}
+	if d := w.latest - seq; d < 64 {
+		return w.bits&(1<<d) != 0
+	}
+	return true
+}
+
+func (w *replayWindow) mark(seq uint64) {
+	switch {
+	case !w.used:
+		w.used, w.latest, w.bits = true, seq, 1
+	case seq > w.latest:
+		if d := seq - w.latest; d < 64 {
+			w.bits = w.bits<<d | 1
+		} else {
+			w.bits = 1
+		}
+		w.latest = seq
+	default:
+		w.bits |= 1 << (w.latest - seq)
+	}
+}
+
+// flightEntry is a message of a flight, the handshake message with its
+// header or the ChangeCipherSpec
+type flightEntry struct {
+	typ   uint8
+	epoch uint16
+	data  []byte
+}
+
+// Conn is a DTLS connection over a connected datagram conn
+type Conn struct {
+	conn     net.Conn
+	config   *tls.Config
+	isClient bool
+
+	handshakeMutex sync.Mutex
+	handshakeErr   error
+	handshakeDone  int32 // accessed atomically, 1 after the handshake
+
+	peerCertificates []*x509.Certificate
+	cipherSuite      uint16
+
+	readMutex   sync.Mutex // guards the read state, held by the handshake
+	readEpoch   uint16
+	readCiphers [2]*recordCipher
+	replay      [2]replayWindow
+	readBuf     []byte
+	datagram    []byte // the unread records of the last datagram
+
+	writeMutex   sync.Mutex // guards the write state
+	writeCiphers [2]*recordCipher
+	writeSeq     [2]uint64
+	lastFlight   []flightEntry // the final flight of the server, sent again on a retransmission
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// Client returns the client side of DTLS over conn, config must set either
+// ServerName or InsecureSkipVerify like crypto/tls
+func Client(conn net.Conn, config *tls.Config) *Conn {
+	return &Conn{conn: conn, config: config, isClient: true}
+}
+
+// Server returns the server side of DTLS over conn, which is the datagrams
+// of a peer, config must have a certificate
+func Server(conn net.Conn, config *tls.Config) *Conn {
+	return &Conn{conn: conn, config: config}
+}
+
+// Handshake runs the handshake if it has not yet been run
+func (c *Conn) Handshake() error {
+	return c.HandshakeContext(context.Background())
+}
+
+// HandshakeContext runs the handshake if it has not yet been run, the
+// flights are retransmitted until ctx is done or the timer of a minute
+// expires. The deadlines of the connection are reset by the handshake
+func (c *Conn) HandshakeContext(ctx context.Context) error {
+	c.handshakeMutex.Lock()
+	defer c.handshakeMutex.Unlock()
+	if atomic.LoadInt32(&c.handshakeDone) == 1 {
+		return nil
+	}
+	if c.handshakeErr != nil {
+		return c.handshakeErr
+	}
+
+	c.readMutex.Lock()
+	defer c.readMutex.Unlock()
+	if ctx.Done() != nil {
+		// unblock the Read when ctx is canceled
+		done, exited := make(chan struct{}), make(chan struct{})
+		go func() {
+			defer close(exited)
+			select {
+			case <-ctx.Done():
+				c.conn.SetDeadline(time.Now())
+			case <-done:
+			}
+		}()
+		defer func() {
+			close(done)
+			<-exited
+			c.conn.SetDeadline(time.Time{})
+		}()
+	} else {
+		defer c.conn.SetDeadline(time.Time{})
+	}
+
+	h := &handshake{c: c, ctx: ctx, fragments: map[uint16]*fragmentBuffer{}, timeout: initialTimeout}
+	var err error
+	if c.isClient {
+		err = c.clientHandshake(h)
+	} else {
+		err = c.serverHandshake(h)
+	}
+	if err != nil {
+		if a, ok := err.(alert); ok {
+			c.sendAlert(a)
+		}
+		c.handshakeErr = err
+		return err
+	}
+	atomic.StoreInt32(&c.handshakeDone, 1)
+	return nil
+}
+
+// PeerCertificates returns the certificate chain of the peer after the
+// handshake, it is empty if the client has not sent a certificate
+func (c *Conn) PeerCertificates() []*x509.Certificate {
+	c.handshakeMutex.Lock()
+	defer c.handshakeMutex.Unlock()
+	return c.peerCertificates
+}
+
+// CipherSuite returns the cipher suite negotiated by the handshake, the
+// ids are the ones of crypto/tls
+func (c *Conn) CipherSuite() uint16 {
+	c.handshakeMutex.Lock()
+	defer c.handshakeMutex.Unlock()
+	return c.cipherSuite
+}
+
+// Read reads the data of a record, the data larger than b is truncated
+func (c *Conn) Read(b []byte) (int, error) {
+	if err := c.Handshake(); err != nil {
+		return 0, err
+	}
+	c.readMutex.Lock()
+	defer c.readMutex.Unlock()
+	for {
+		typ, epoch, payload, err := c.readRecord()
+		if err != nil {
+			return 0, err
+		}
+		switch typ {
+		case contentApplicationData:
+			return copy(b, payload), nil
+		case contentAlert:
+			if err = c.handleAlert(payload); err != nil {
+				return 0, err
+			}
+		case contentHandshake:
+			// the client retransmits its final flight when the one of the
+			// server is lost, each of them ends with Finished
+			if !c.isClient && epoch == 1 && len(payload) > 0 && payload[0] == typeFinished {
+				c.writeFlight(c.lastFlight)
+			}
+		}
+	}
+}
+
+// Write sends b as a record of one datagram
+func (c *Conn) Write(b []byte) (int, error) {
+	if err := c.Handshake(); err != nil {
+		return 0, err
+	}
+	if len(b) > maxPlaintext {
+		return 0, errors.New("dtls: the data is larger than a record")
+	}
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	record, err := c.newRecord(nil, contentApplicationData, 1, b)
+	if err != nil {
+		return 0, err
+	}
+	if _, err = c.conn.Write(record); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Close sends close_notify and closes the underlying conn
+func (c *Conn) Close() error {
+	c.closeOnce.Do(func() {
+		if atomic.LoadInt32(&c.handshakeDone) == 1 {
+			c.sendAlert(alertCloseNotify)
+		}
+		c.closeErr = c.conn.Close()
+	})
+	return c.closeErr
+}
+
+func (c *Conn) LocalAddr() net.Addr                { return c.conn.LocalAddr() }
+func (c *Conn) RemoteAddr() net.Addr               { return c.conn.RemoteAddr() }
+func (c *Conn) SetDeadline(t time.Time) error      { return c.conn.SetDeadline(t) }
+func (c *Conn) SetReadDeadline(t time.Time) error  { return c.conn.SetReadDeadline(t) }
+func (c *Conn) SetWriteDeadline(t time.Time) error { return c.conn.SetWriteDeadline(t) }
+
+// sendAlert sends the alert in the current epoch, close_notify is a warning
+// and the others are fatal
+func (c *Conn) sendAlert(a alert) {
+	level := byte(2)
+	if a == alertCloseNotify {
+		level = 1
+	}
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	epoch := uint16(0)
+	if c.writeCiphers[1] != nil {
+		epoch = 1
+	}
+	if record, err := c.newRecord(nil, contentAlert, epoch, []byte{level, byte(a)}); err == nil {
+		c.conn.Write(record)
+	}
+}
+
+// handleAlert returns the error of a fatal alert or close_notify, the
+// warnings are ignored
+func (c *Conn) handleAlert(payload []byte) error {
+	if len(payload) != 2 {
+		return nil
+	}
+	if alert(payload[1]) == alertCloseNotify {
+		return io.EOF
+	}
+	if payload[0] == 2 {
+		return RemoteError{Alert: payload[1]}
+	}
+	return nil
+}
+
+// newRecord appends the record of the payload in the epoch to b, the caller
+// holds writeMutex
+func (c *Conn) newRecord(b []byte, typ uint8, epoch uint16, payload []byte) ([]byte, error) {
+	seq := c.writeSeq[epoch]
+	if seq > maxSequence {
+		return nil, errors.New("dtls: the sequence numbers are exhausted")
+	}
+	c.writeSeq[epoch]++
+
+	header := make([]byte, recordHeaderLen, recordHeaderLen+len(payload)+recordOverhead)
+	header[0] = typ
+	binary.BigEndian.PutUint16(header[1:], versionDtls12)
+	binary.BigEndian.PutUint64(header[3:], seq)
+	binary.BigEndian.PutUint16(header[3:], epoch)
+
+	var record []byte
+	if cipher := c.writeCiphers[epoch]; cipher != nil {
+		record = cipher.seal(header, payload)
+	} else {
+		record = append(header, payload...)
+	}
+	binary.BigEndian.PutUint16(record[11:], uint16(len(record)-recordHeaderLen))
+	return append(b, record...), nil
+}
+
+// readRecord returns the next valid record, the records which are invalid,
+// duplicated or not of the current epoch are silently discarded (RFC6347
+// Section 4.1.2.7). The plaintext records of the epoch 0 are not accepted
+// after ChangeCipherSpec, they are not authenticated. The caller holds
+// readMutex and the payload is valid until the next read
+func (c *Conn) readRecord() (typ uint8, epoch uint16, payload []byte, err error) {
+	if c.readBuf == nil {
+		c.readBuf = make([]byte, 65536)
+	}
+	for {
+		if len(c.datagram) == 0 {
+			n, err := c.conn.Read(c.readBuf)
+			if err != nil {
+				return 0, 0, nil, err
+			}
+			c.datagram = c.readBuf[:n]
+		}
+		if len(c.datagram) < recordHeaderLen {
+			c.datagram = nil
+			continue
+		}
+		length := int(binary.BigEndian.Uint16(c.datagram[11:]))
+		if recordHeaderLen+length > len(c.datagram) {
+			c.datagram = nil
+			continue
+		}
+		header, fragment := c.datagram[:recordHeaderLen], c.datagram[recordHeaderLen:recordHeaderLen+length]
+		c.datagram = c.datagram[recordHeaderLen+length:]
+
+		typ, epoch = header[0], binary.BigEndian.Uint16(header[3:])
+		seq := binary.BigEndian.Uint64(header[3:]) & maxSequence
+		if header[1] != 0xfe || epoch != c.readEpoch || c.replay[epoch].seen(seq) {
+			continue
+		}
+		if cipher := c.readCiphers[epoch]; cipher != nil {
+			if payload, err = cipher.open(header, fragment); err != nil {
+				continue
+			}
+		} else if typ == contentApplicationData {
+			continue
+		} else {
+			payload = fragment
+		}
+		c.replay[epoch].mark(seq)
+		return typ, epoch, payload, nil
+	}
+}
+
+// writeFlight sends the flight, the handshake messages are fragmented and
+// the records are packed in the datagrams of maxDatagram octets. The
+// records of a retransmission have the new sequence numbers
+func (c *Conn) writeFlight(flight []flightEntry) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	var datagram []byte
+	add := func(typ uint8, epoch uint16, payload []byte) error {
+		size := recordHeaderLen + len(payload)
+		if c.writeCiphers[epoch] != nil {
+			size += recordOverhead
+		}
+		if len(datagram) > 0 && len(datagram)+size > maxDatagram {
+			if _, err := c.conn.Write(datagram); err != nil {
+				return err
+			}
+			datagram = datagram[:0]
+		}
+		var err error
+		datagram, err = c.newRecord(datagram, typ, epoch, payload)
+		return err
+	}
+
+	maxFragment := maxDatagram - recordHeaderLen - recordOverhead - handshakeHeaderLen
+	for _, e := range flight {
+		if e.typ != contentHandshake {
+			if err := add(e.typ, e.epoch, e.data); err != nil {
+				return err
+			}
+			continue
+		}
+		header, body := e.data[:handshakeHeaderLen], e.data[handshakeHeaderLen:]
+		for offset := 0; offset == 0 || offset < len(body); offset += maxFragment {
+			end := offset + maxFragment
+			if end > len(body) {
+				end = len(body)
+			}
+			fragment := make([]byte, handshakeHeaderLen, handshakeHeaderLen+end-offset)
+			copy(fragment, header)
+			putUint24(fragment[6:], offset)
+			putUint24(fragment[9:], end-offset)
+			if err := add(e.typ, e.epoch, append(fragment, body[offset:end]...)); err != nil {
+				return err
+			}
+		}
+	}
+	if len(datagram) > 0 {
+		if _, err := c.conn.Write(datagram); err != nil {
+			return err
+		}
+	}
+	return nil
+}
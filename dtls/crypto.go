@@ -0,0 +1,307 @@
+package dtls
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"hash"
+)
+
+// cipherSuite is an ECDHE cipher suite with AES-GCM, the only ones of the
+// package (RFC5289)
+type cipherSuite struct {
+	id     uint16
+	ecdsa  bool // the certificate is ECDSA or Ed25519, else RSA
+	keyLen int
+	hash   crypto.Hash // the hash of the PRF
+}
+
+// the cipher suites in the order of preference, the ids are the ones of
+// crypto/tls
+var cipherSuites = []*cipherSuite{
+	{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, true, 16, crypto.SHA256},
+	{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, false, 16, crypto.SHA256},
+	{tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384, true, 32, crypto.SHA384},
+	{tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384, false, 32, crypto.SHA384},
+}
+
+// suitesOf returns the cipher suites enabled by config.CipherSuites
+func suitesOf(config *tls.Config) []*cipherSuite {
+	if len(config.CipherSuites) == 0 {
+		return cipherSuites
+	}
+	var suites []*cipherSuite
+	for _, s := range cipherSuites {
+		for _, id := range config.CipherSuites {
+			if s.id == id {
+				suites = append(suites, s)
+				break
+			}
+		}
+	}
+	return suites
+}
+
+func suiteById(suites []*cipherSuite, id uint16) *cipherSuite {
+	for _, s := range suites {
+		if s.id == id {
+			return s
+		}
+	}
+	return nil
+}
+
+// the named groups of ECDHE, the ids are the ones of crypto/tls
+var defaultCurves = []tls.CurveID{tls.X25519, tls.CurveP256, tls.CurveP384}
+
+func curvesOf(config *tls.Config) []tls.CurveID {
+	if len(config.CurvePreferences) == 0 {
+		return defaultCurves
+	}
+	var curves []tls.CurveID
+	for _, id := range config.CurvePreferences {
+		if curveOf(id) != nil {
+			curves = append(curves, id)
+		}
+	}
+	return curves
+}
+
+func curveOf(id tls.CurveID) ecdh.Curve {
+	switch id {
+	case tls.X25519:
+		return ecdh.X25519()
+	case tls.CurveP256:
+		return ecdh.P256()
+	case tls.CurveP384:
+		return ecdh.P384()
+	}
+	return nil
+}
+
+// the signature algorithms accepted from the peer (RFC5246 Section 7.4.1.4.1)
+var signatureSchemes = []tls.SignatureScheme{
+	tls.ECDSAWithP256AndSHA256,
+	tls.ECDSAWithP384AndSHA384,
+	tls.ECDSAWithP521AndSHA512,
+	tls.Ed25519,
+	tls.PSSWithSHA256,
+	tls.PSSWithSHA384,
+	tls.PSSWithSHA512,
+	tls.PKCS1WithSHA256,
+	tls.PKCS1WithSHA384,
+	tls.PKCS1WithSHA512,
+}
+
+// hashOf returns the hash of a signature scheme, 0 of Ed25519
+func hashOf(scheme tls.SignatureScheme) crypto.Hash {
+	switch scheme {
+	case tls.ECDSAWithP256AndSHA256, tls.PSSWithSHA256, tls.PKCS1WithSHA256:
+		return crypto.SHA256
+	case tls.ECDSAWithP384AndSHA384, tls.PSSWithSHA384, tls.PKCS1WithSHA384:
+		return crypto.SHA384
+	case tls.ECDSAWithP521AndSHA512, tls.PSSWithSHA512, tls.PKCS1WithSHA512:
+		return crypto.SHA512
+	}
+	return 0
+}
+
+func hashSum(h crypto.Hash, data []byte) []byte {
+	switch h {
+	case crypto.SHA384:
+		sum := sha512.Sum384(data)
+		return sum[:]
+	case crypto.SHA512:
+		sum := sha512.Sum512(data)
+		return sum[:]
+	}
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
+
+var errUnsupportedSignature = errors.New("dtls: unsupported signature algorithm")
+
+// verifySignature verifies the signature of the data by the public key
+func verifySignature(pub crypto.PublicKey, scheme tls.SignatureScheme, data, sig []byte) error {
+	switch pub := pub.(type) {
+	case *ecdsa.PublicKey:
+		if scheme != tls.ECDSAWithP256AndSHA256 && scheme != tls.ECDSAWithP384AndSHA384 &&
+			scheme != tls.ECDSAWithP521AndSHA512 {
+			return errUnsupportedSignature
+		}
+		if !ecdsa.VerifyASN1(pub, hashSum(hashOf(scheme), data), sig) {
+			return errors.New("dtls: invalid ECDSA signature")
+		}
+	case ed25519.PublicKey:
+		if scheme != tls.Ed25519 {
+			return errUnsupportedSignature
+		}
+		if !ed25519.Verify(pub, data, sig) {
+			return errors.New("dtls: invalid Ed25519 signature")
+		}
+	case *rsa.PublicKey:
+		h := hashOf(scheme)
+		switch scheme {
+		case tls.PSSWithSHA256, tls.PSSWithSHA384, tls.PSSWithSHA512:
+			return rsa.VerifyPSS(pub, h, hashSum(h, data), sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		case tls.PKCS1WithSHA256, tls.PKCS1WithSHA384, tls.PKCS1WithSHA512:
+			return rsa.VerifyPKCS1v15(pub, h, hashSum(h, data), sig)
+		}
+		return errUnsupportedSignature
+	default:
+		return errors.New("dtls: unsupported public key")
+	}
+	return nil
+}
+
+// signatureSchemeOf selects the scheme of the key among the ones accepted
+// by the peer
+func signatureSchemeOf(key crypto.Signer, accepted []tls.SignatureScheme) (tls.SignatureScheme, error) {
+	var candidates []tls.SignatureScheme
+	switch pub := key.Public().(type) {
+	case *ecdsa.PublicKey:
+		switch pub.Curve.Params().BitSize {
+		case 384:
+			candidates = []tls.SignatureScheme{tls.ECDSAWithP384AndSHA384}
+		case 521:
+			candidates = []tls.SignatureScheme{tls.ECDSAWithP521AndSHA512}
+		default:
+			candidates = []tls.SignatureScheme{tls.ECDSAWithP256AndSHA256}
+		}
+	case ed25519.PublicKey:
+		candidates = []tls.SignatureScheme{tls.Ed25519}
+	case *rsa.PublicKey:
+		candidates = []tls.SignatureScheme{tls.PSSWithSHA256, tls.PKCS1WithSHA256,
+			tls.PSSWithSHA384, tls.PKCS1WithSHA384}
+	}
+	for _, c := range candidates {
+		for _, a := range accepted {
+			if c == a {
+				return c, nil
+			}
+		}
+	}
+	return 0, errUnsupportedSignature
+}
+
+// sign signs the data with the key by the scheme
+func sign(key crypto.Signer, scheme tls.SignatureScheme, data []byte) ([]byte, error) {
+	h := hashOf(scheme)
+	var opts crypto.SignerOpts = h
+	switch scheme {
+	case tls.Ed25519:
+		return key.Sign(rand.Reader, data, crypto.Hash(0))
+	case tls.PSSWithSHA256, tls.PSSWithSHA384, tls.PSSWithSHA512:
+		opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: h}
+	}
+	return key.Sign(rand.Reader, hashSum(h, data), opts)
+}
+
+// isEcdsaKey reports whether the key signs by the ECDSA cipher suites
+func isEcdsaKey(pub crypto.PublicKey) bool {
+	switch pub.(type) {
+	case *ecdsa.PublicKey, ed25519.PublicKey:
+		return true
+	}
+	return false
+}
+
+// prf is the PRF of TLS 1.2 (RFC5246 Section 5)
+func prf(h crypto.Hash, secret []byte, label string, seed []byte, length int) []byte {
+	newHash := sha256.New
+	if h == crypto.SHA384 {
+		newHash = sha512.New384
+	}
+	labelSeed := append([]byte(label), seed...)
+	return pHash(newHash, secret, labelSeed, length)
+}
+
+func pHash(newHash func() hash.Hash, secret, seed []byte, length int) []byte {
+	mac := hmac.New(newHash, secret)
+	mac.Write(seed)
+	a := mac.Sum(nil)
+
+	out := make([]byte, 0, length+mac.Size())
+	for len(out) < length {
+		mac.Reset()
+		mac.Write(a)
+		mac.Write(seed)
+		out = mac.Sum(out)
+
+		mac.Reset()
+		mac.Write(a)
+		a = mac.Sum(a[:0])
+	}
+	return out[:length]
+}
+
+// recordCipher protects the records of an epoch by AES-GCM (RFC5288), the
+// explicit nonce is the epoch and the sequence number of the record
+type recordCipher struct {
+	aead cipher.AEAD
+	salt [4]byte
+}
+
+const (
+	explicitNonceLen = 8
+	recordOverhead   = explicitNonceLen + 16
+)
+
+func newRecordCipher(key, salt []byte) (*recordCipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	c := &recordCipher{aead: aead}
+	copy(c.salt[:], salt)
+	return c, nil
+}
+
+// additionalData returns the additional data of the record, the header
+// with the length of the plaintext (RFC6347 Section 4.1.2.1)
+func additionalData(header []byte, length int) []byte {
+	ad := make([]byte, 13)
+	copy(ad, header[3:11])
+	ad[8] = header[0]
+	copy(ad[9:11], header[1:3])
+	binary.BigEndian.PutUint16(ad[11:], uint16(length))
+	return ad
+}
+
+// seal appends the protected fragment of the record to the header
+func (c *recordCipher) seal(header, plaintext []byte) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, c.salt[:])
+	copy(nonce[4:], header[3:11])
+
+	out := append(header, nonce[4:]...)
+	return c.aead.Seal(out, nonce, plaintext, additionalData(header, len(plaintext)))
+}
+
+// open returns the plaintext of the protected fragment of the record
+func (c *recordCipher) open(header, fragment []byte) ([]byte, error) {
+	if len(fragment) < recordOverhead {
+		return nil, errors.New("dtls: record too short")
+	}
+	nonce := make([]byte, 12)
+	copy(nonce, c.salt[:])
+	copy(nonce[4:], fragment[:explicitNonceLen])
+	ciphertext := fragment[explicitNonceLen:]
+	return c.aead.Open(nil, nonce, ciphertext,
+		additionalData(header, len(ciphertext)-c.aead.Overhead()))
+}
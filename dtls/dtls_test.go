@@ -0,0 +1,268 @@
+package dtls_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/runner-mei/snmpclient2/dtls"
+)
+
+// newCertificate returns a certificate of the name signed by parent, it is
+// self-signed if parent is nil
+func newCertificate(t *testing.T, name string, rsaKey bool, parent *tls.Certificate) tls.Certificate {
+	var key interface{}
+	var pub interface{}
+	if rsaKey {
+		k, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, pub = k, &k.PublicKey
+	} else {
+		k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, pub = k, &k.PublicKey
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  parent == nil,
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, pub, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _ := x509.ParseCertificate(der)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+// lossyConn drops the first datagrams written
+type lossyConn struct {
+	net.Conn
+	mutex sync.Mutex
+	drops int
+}
+
+func (c *lossyConn) Write(b []byte) (int, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.drops > 0 {
+		c.drops--
+		return len(b), nil
+	}
+	return c.Conn.Write(b)
+}
+
+// pipe returns the connected datagram conns of a client and a server
+func pipe(t *testing.T) (client, server net.Conn) {
+	a, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Close()
+	b.Close()
+	if client, err = net.DialUDP("udp", a.LocalAddr().(*net.UDPAddr), b.LocalAddr().(*net.UDPAddr)); err != nil {
+		t.Fatal(err)
+	}
+	if server, err = net.DialUDP("udp", b.LocalAddr().(*net.UDPAddr), a.LocalAddr().(*net.UDPAddr)); err != nil {
+		t.Fatal(err)
+	}
+	return client, server
+}
+
+func TestHandshake(t *testing.T) {
+	ca := newCertificate(t, "ca", false, nil)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+
+	for _, test := range []struct {
+		name      string
+		rsaServer bool
+		rsaClient bool
+		suites    []uint16
+		drops     int
+	}{
+		{name: "ecdsa"},
+		{name: "rsa", rsaServer: true, rsaClient: true},
+		{name: "aes256", suites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384}},
+		{name: "loss", rsaServer: true, drops: 2},
+	} {
+		agentCert := newCertificate(t, "agent", test.rsaServer, &ca)
+		clientCert := newCertificate(t, "monitor", test.rsaClient, &ca)
+
+		clientConn, serverConn := pipe(t)
+		server := dtls.Server(&lossyConn{Conn: serverConn, drops: test.drops}, &tls.Config{
+			Certificates: []tls.Certificate{agentCert},
+			ClientCAs:    pool,
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+		})
+		client := dtls.Client(clientConn, &tls.Config{
+			Certificates: []tls.Certificate{clientCert},
+			RootCAs:      pool,
+			ServerName:   "127.0.0.1",
+			CipherSuites: test.suites,
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		errs := make(chan error, 1)
+		go func() {
+			errs <- server.HandshakeContext(ctx)
+		}()
+		if err := client.HandshakeContext(ctx); err != nil {
+			t.Fatalf("%s: HandshakeContext() - has error %v, server %v", test.name, err, <-errs)
+		}
+		if err := <-errs; err != nil {
+			t.Fatalf("%s: server: HandshakeContext() - has error %v", test.name, err)
+		}
+		cancel()
+		if certs := server.PeerCertificates(); len(certs) != 1 || certs[0].Subject.CommonName != "monitor" {
+			t.Errorf("%s: PeerCertificates() - expected [monitor], actual %v", test.name, certs)
+		}
+		if len(test.suites) > 0 && client.CipherSuite() != test.suites[0] {
+			t.Errorf("%s: CipherSuite() - expected [%x], actual [%x]", test.name, test.suites[0], client.CipherSuite())
+		}
+
+		buf := make([]byte, 100)
+		for _, msg := range []string{"ping", "pong"} {
+			if _, err := client.Write([]byte(msg)); err != nil {
+				t.Fatalf("%s: Write() - has error %v", test.name, err)
+			}
+			server.SetReadDeadline(time.Now().Add(5 * time.Second))
+			n, err := server.Read(buf)
+			if err != nil || string(buf[:n]) != msg {
+				t.Errorf("%s: Read() - expected [%s], actual [%s], %v", test.name, msg, buf[:n], err)
+			}
+			server.Write(buf[:n])
+			client.SetReadDeadline(time.Now().Add(5 * time.Second))
+			if n, err = client.Read(buf); err != nil || string(buf[:n]) != msg {
+				t.Errorf("%s: Read() - expected [%s], actual [%s], %v", test.name, msg, buf[:n], err)
+			}
+		}
+
+		client.Close()
+		server.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if _, err := server.Read(buf); err != io.EOF {
+			t.Errorf("%s: Read() - expected [EOF] after close_notify, actual [%v]", test.name, err)
+		}
+		server.Close()
+	}
+}
+
+func TestHandshakeUnknownAuthority(t *testing.T) {
+	ca := newCertificate(t, "ca", false, nil)
+	other := newCertificate(t, "other", false, nil)
+	pool := x509.NewCertPool()
+	pool.AddCert(other.Leaf)
+
+	clientConn, serverConn := pipe(t)
+	defer clientConn.Close()
+	defer serverConn.Close()
+	server := dtls.Server(serverConn, &tls.Config{
+		Certificates: []tls.Certificate{newCertificate(t, "agent", false, &ca)},
+	})
+	client := dtls.Client(clientConn, &tls.Config{RootCAs: pool, ServerName: "127.0.0.1"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.HandshakeContext(ctx)
+	}()
+	if err := client.HandshakeContext(ctx); err == nil {
+		t.Error("HandshakeContext() - expected an error of the unknown authority")
+	}
+	if err, ok := (<-errs).(dtls.RemoteError); !ok || err.Alert != 48 {
+		t.Errorf("server: HandshakeContext() - expected the alert [unknown certificate authority], actual [%v]", err)
+	}
+	if _, err := client.Write([]byte("ping")); err == nil {
+		t.Error("Write() - expected the error of the handshake")
+	}
+}
+
+func TestHandshakeTimeout(t *testing.T) {
+	// the server does not answer
+	clientConn, serverConn := pipe(t)
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	client := dtls.Client(clientConn, &tls.Config{InsecureSkipVerify: true})
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := client.HandshakeContext(ctx)
+	if e, ok := err.(net.Error); !ok || !e.Timeout() {
+		t.Errorf("HandshakeContext() - expected a timeout, actual [%v]", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("HandshakeContext() - expected to return by the deadline, elapsed [%v]", elapsed)
+	}
+}
+
+func TestSpoofedAlert(t *testing.T) {
+	ca := newCertificate(t, "ca", false, nil)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+
+	clientConn, serverConn := pipe(t)
+	defer clientConn.Close()
+	defer serverConn.Close()
+	server := dtls.Server(serverConn, &tls.Config{
+		Certificates: []tls.Certificate{newCertificate(t, "agent", false, &ca)},
+	})
+	client := dtls.Client(clientConn, &tls.Config{RootCAs: pool, ServerName: "127.0.0.1"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.HandshakeContext(ctx)
+	}()
+	if err := client.HandshakeContext(ctx); err != nil {
+		t.Fatalf("HandshakeContext() - has error %v, server %v", err, <-errs)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("server: HandshakeContext() - has error %v", err)
+	}
+
+	// the plaintext close_notify and fatal alert of the epoch 0 are not
+	// authenticated
+	for _, payload := range [][]byte{{1, 0}, {2, 40}} {
+		record := []byte{21, 0xfe, 0xfd, 0, 0, 0, 0, 0, 0, 0, 100, 0, 2}
+		serverConn.Write(append(record, payload...))
+	}
+	server.Write([]byte("pong"))
+
+	buf := make([]byte, 100)
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if n, err := client.Read(buf); err != nil || string(buf[:n]) != "pong" {
+		t.Errorf("Read() - expected [pong] after the spoofed alerts, actual [%s], %v", buf[:n], err)
+	}
+}
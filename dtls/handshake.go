@@ -0,0 +1,250 @@
+package dtls
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"time"
+)
+
+const (
+	typeClientHello        = 1
+	typeServerHello        = 2
+	typeHelloVerifyRequest = 3
+	typeCertificate        = 11
+	typeServerKeyExchange  = 12
+	typeCertificateRequest = 13
+	typeServerHelloDone    = 14
+	typeCertificateVerify  = 15
+	typeClientKeyExchange  = 16
+	typeFinished           = 20
+
+	handshakeHeaderLen  = 12
+	maxHandshakeMessage = 65536
+	maxFutureMessages   = 16 // the messages buffered ahead of the next one
+
+	initialTimeout = time.Second // the retransmission timer (RFC6347 Section 4.2.4.1)
+	maxTimeout     = 60 * time.Second
+)
+
+func putUint24(b []byte, v int) {
+	b[0], b[1], b[2] = byte(v>>16), byte(v>>8), byte(v)
+}
+
+func uint24(b []byte) int {
+	return int(b[0])<<16 | int(b[1])<<8 | int(b[2])
+}
+
+// handshakeMessage is a reassembled handshake message
+type handshakeMessage struct {
+	typ   uint8
+	seq   uint16
+	epoch uint16 // the epoch of the records
+	body  []byte
+}
+
+// fragmentBuffer reassembles the fragments of a message
+type fragmentBuffer struct {
+	typ      uint8
+	epoch    uint16
+	body     []byte
+	received []bool
+	missing  int
+}
+
+// handshake is the state of a running handshake
+type handshake struct {
+	c   *Conn
+	ctx context.Context
+
+	sendSeq    uint16 // message_seq of the next message sent
+	recvSeq    uint16 // message_seq of the next message expected
+	fragments  map[uint16]*fragmentBuffer
+	transcript []byte // the messages for Finished and CertificateVerify
+
+	flight         []flightEntry
+	timeout        time.Duration
+	peerRetransmit bool          // the peer has sent its previous flight again
+	peerReadCipher *recordCipher // the epoch 1 of the peer, it is read after ChangeCipherSpec
+	clientRandom   []byte
+	serverRandom   []byte
+	suite          *cipherSuite
+	extendedMaster bool
+	masterSecret   []byte
+}
+
+// addMessage appends the message to the transcript and returns its entry
+// of a flight
+func (h *handshake) addMessage(typ uint8, epoch uint16, body []byte) flightEntry {
+	data := make([]byte, handshakeHeaderLen, handshakeHeaderLen+len(body))
+	data[0] = typ
+	putUint24(data[1:], len(body))
+	binary.BigEndian.PutUint16(data[4:], h.sendSeq)
+	putUint24(data[9:], len(body))
+	data = append(data, body...)
+	h.sendSeq++
+	h.transcript = append(h.transcript, data...)
+	return flightEntry{typ: contentHandshake, epoch: epoch, data: data}
+}
+
+// send sends the next flight and restarts the retransmission timer
+func (h *handshake) send(flight ...flightEntry) error {
+	h.flight = flight
+	h.timeout = initialTimeout
+	return h.c.writeFlight(flight)
+}
+
+// readMessage returns the next message in the order of message_seq, and
+// appends it to the transcript. The flight is retransmitted when the timer
+// expires or the peer retransmits its flight
+func (h *handshake) readMessage() (*handshakeMessage, error) {
+	c := h.c
+	for {
+		if f := h.fragments[h.recvSeq]; f != nil && f.missing == 0 {
+			delete(h.fragments, h.recvSeq)
+			m := &handshakeMessage{typ: f.typ, seq: h.recvSeq, epoch: f.epoch, body: f.body}
+			h.recvSeq++
+			h.transcript = append(h.transcript, m.marshal()...)
+			return m, nil
+		}
+
+		deadline := time.Now().Add(h.timeout)
+		ctxDeadline, hasDeadline := h.ctx.Deadline()
+		if hasDeadline && ctxDeadline.Before(deadline) {
+			deadline = ctxDeadline
+		}
+		c.conn.SetReadDeadline(deadline)
+		typ, epoch, payload, err := c.readRecord()
+		if err != nil {
+			if e := h.ctx.Err(); e != nil {
+				return nil, e
+			}
+			if e, ok := err.(net.Error); !ok || !e.Timeout() || (hasDeadline && !time.Now().Before(ctxDeadline)) {
+				return nil, err
+			}
+			// the peer is given up after the timer of maxTimeout
+			if h.timeout *= 2; h.timeout > maxTimeout {
+				return nil, err
+			}
+			if err = c.writeFlight(h.flight); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		switch typ {
+		case contentChangeCipherSpec:
+			// the ChangeCipherSpec before the keys is lost, the peer sends
+			// it again with Finished
+			if epoch == 0 && c.readEpoch == 0 && h.peerReadCipher != nil {
+				c.readCiphers[1] = h.peerReadCipher
+				c.readEpoch = 1
+			}
+		case contentAlert:
+			if err = c.handleAlert(payload); err != nil {
+				return nil, err
+			}
+		case contentHandshake:
+			if err = h.addFragments(epoch, payload); err != nil {
+				return nil, err
+			}
+		}
+		if h.peerRetransmit && len(c.datagram) == 0 {
+			h.peerRetransmit = false
+			if err = c.writeFlight(h.flight); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// addFragments buffers the fragments of a handshake record
+func (h *handshake) addFragments(epoch uint16, payload []byte) error {
+	for len(payload) > 0 {
+		if len(payload) < handshakeHeaderLen {
+			return alertDecodeError
+		}
+		typ, length := payload[0], uint24(payload[1:])
+		seq := binary.BigEndian.Uint16(payload[4:])
+		offset, fragmentLen := uint24(payload[6:]), uint24(payload[9:])
+		if len(payload) < handshakeHeaderLen+fragmentLen || offset+fragmentLen > length ||
+			length > maxHandshakeMessage {
+			return alertDecodeError
+		}
+		data := payload[handshakeHeaderLen : handshakeHeaderLen+fragmentLen]
+		payload = payload[handshakeHeaderLen+fragmentLen:]
+
+		if seq < h.recvSeq {
+			h.peerRetransmit = true
+			continue
+		}
+		if seq >= h.recvSeq+maxFutureMessages {
+			continue
+		}
+		f := h.fragments[seq]
+		if f == nil {
+			f = &fragmentBuffer{typ: typ, epoch: epoch, body: make([]byte, length),
+				received: make([]bool, length), missing: length}
+			h.fragments[seq] = f
+		}
+		if f.typ != typ || len(f.body) != length {
+			return alertUnexpectedMessage
+		}
+		if epoch < f.epoch {
+			f.epoch = epoch
+		}
+		copy(f.body[offset:], data)
+		for i := offset; i < offset+fragmentLen; i++ {
+			if !f.received[i] {
+				f.received[i] = true
+				f.missing--
+			}
+		}
+	}
+	return nil
+}
+
+// marshal returns the message with the header of an unfragmented message,
+// which is the form of the transcript (RFC6347 Section 4.2.6)
+func (m *handshakeMessage) marshal() []byte {
+	data := make([]byte, handshakeHeaderLen, handshakeHeaderLen+len(m.body))
+	data[0] = m.typ
+	putUint24(data[1:], len(m.body))
+	binary.BigEndian.PutUint16(data[4:], m.seq)
+	putUint24(data[9:], len(m.body))
+	return append(data, m.body...)
+}
+
+// transcriptBefore returns the transcript without the last message m
+func (h *handshake) transcriptBefore(m *handshakeMessage) []byte {
+	return h.transcript[:len(h.transcript)-handshakeHeaderLen-len(m.body)]
+}
+
+// deriveKeys computes the master secret of the premaster secret, the
+// extended master secret hashes the transcript (RFC7627), and returns the
+// ciphers of the client and of the server
+func (h *handshake) deriveKeys(preMasterSecret []byte) (client, server *recordCipher, err error) {
+	if h.extendedMaster {
+		h.masterSecret = prf(h.suite.hash, preMasterSecret, "extended master secret",
+			hashSum(h.suite.hash, h.transcript), 48)
+	} else {
+		h.masterSecret = prf(h.suite.hash, preMasterSecret, "master secret",
+			append(append([]byte(nil), h.clientRandom...), h.serverRandom...), 48)
+	}
+
+	n := h.suite.keyLen
+	keys := prf(h.suite.hash, h.masterSecret, "key expansion",
+		append(append([]byte(nil), h.serverRandom...), h.clientRandom...), 2*n+8)
+	if client, err = newRecordCipher(keys[:n], keys[2*n:2*n+4]); err != nil {
+		return nil, nil, err
+	}
+	if server, err = newRecordCipher(keys[n:2*n], keys[2*n+4:]); err != nil {
+		return nil, nil, err
+	}
+	return client, server, nil
+}
+
+// finished returns the verify_data of Finished over the transcript
+func (h *handshake) finished(label string, transcript []byte) []byte {
+	return prf(h.suite.hash, h.masterSecret, label, hashSum(h.suite.hash, transcript), 12)
+}
@@ -0,0 +1,357 @@
+package dtls
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+)
+
+const (
+	extensionServerName           = 0
+	extensionSupportedGroups      = 10
+	extensionEcPointFormats       = 11
+	extensionSignatureAlgorithms  = 13
+	extensionExtendedMasterSecret = 23
+	extensionRenegotiationInfo    = 0xff01
+
+	curveTypeNamed = 3
+)
+
+// builder appends the fields of a message
+type builder []byte
+
+func (b *builder) u8(v uint8)   { *b = append(*b, v) }
+func (b *builder) u16(v uint16) { *b = binary.BigEndian.AppendUint16(*b, v) }
+func (b *builder) u24(v int)    { *b = append(*b, byte(v>>16), byte(v>>8), byte(v)) }
+
+// vector appends the vector of the content with a length of n octets
+func (b *builder) vector(n int, content func(*builder)) {
+	start := len(*b)
+	*b = append(*b, make([]byte, n)...)
+	content(b)
+	length := len(*b) - start - n
+	for i := n - 1; i >= 0; i-- {
+		(*b)[start+i] = byte(length)
+		length >>= 8
+	}
+}
+
+func (b *builder) bytes(n int, v []byte) {
+	b.vector(n, func(b *builder) { *b = append(*b, v...) })
+}
+
+// parser reads the fields of a message, a field out of the message clears
+// ok and reads as zero
+type parser struct {
+	b  []byte
+	ok bool
+}
+
+func newParser(b []byte) *parser {
+	return &parser{b: b, ok: true}
+}
+
+func (p *parser) next(n int) []byte {
+	if !p.ok || len(p.b) < n {
+		p.ok, p.b = false, nil
+		return make([]byte, n)
+	}
+	v := p.b[:n]
+	p.b = p.b[n:]
+	return v
+}
+
+func (p *parser) u8() uint8   { return p.next(1)[0] }
+func (p *parser) u16() uint16 { return binary.BigEndian.Uint16(p.next(2)) }
+func (p *parser) u24() int    { return uint24(p.next(3)) }
+
+// vector reads a vector with a length of n octets
+func (p *parser) vector(n int) []byte {
+	length := 0
+	for _, v := range p.next(n) {
+		length = length<<8 | int(v)
+	}
+	if !p.ok {
+		return nil
+	}
+	return p.next(length)
+}
+
+// done reports whether the message is read completely
+func (p *parser) done() bool {
+	return p.ok && len(p.b) == 0
+}
+
+// helloExtensions are the extensions of ClientHello and ServerHello
+type helloExtensions struct {
+	serverName     string
+	curves         []tls.CurveID
+	schemes        []tls.SignatureScheme
+	extendedMaster bool
+	renegotiation  bool
+}
+
+func (e *helloExtensions) marshal(b *builder) {
+	b.vector(2, func(b *builder) {
+		if e.serverName != "" {
+			b.u16(extensionServerName)
+			b.vector(2, func(b *builder) {
+				b.vector(2, func(b *builder) {
+					b.u8(0) // host_name
+					b.bytes(2, []byte(e.serverName))
+				})
+			})
+		}
+		if len(e.curves) > 0 {
+			b.u16(extensionSupportedGroups)
+			b.vector(2, func(b *builder) {
+				b.vector(2, func(b *builder) {
+					for _, c := range e.curves {
+						b.u16(uint16(c))
+					}
+				})
+			})
+			b.u16(extensionEcPointFormats)
+			b.vector(2, func(b *builder) { b.bytes(1, []byte{0}) })
+		}
+		if len(e.schemes) > 0 {
+			b.u16(extensionSignatureAlgorithms)
+			b.vector(2, func(b *builder) {
+				b.vector(2, func(b *builder) {
+					for _, s := range e.schemes {
+						b.u16(uint16(s))
+					}
+				})
+			})
+		}
+		if e.extendedMaster {
+			b.u16(extensionExtendedMasterSecret)
+			b.u16(0)
+		}
+		if e.renegotiation {
+			b.u16(extensionRenegotiationInfo)
+			b.vector(2, func(b *builder) { b.bytes(1, nil) })
+		}
+	})
+}
+
+// unmarshal reads the extensions, they are optional
+func (e *helloExtensions) unmarshal(p *parser) {
+	if p.done() {
+		return
+	}
+	extensions := newParser(p.vector(2))
+	for extensions.ok && len(extensions.b) > 0 {
+		typ := extensions.u16()
+		data := newParser(extensions.vector(2))
+		switch typ {
+		case extensionServerName:
+			names := newParser(data.vector(2))
+			for names.ok && len(names.b) > 0 {
+				nameType, name := names.u8(), names.vector(2)
+				if nameType == 0 {
+					e.serverName = string(name)
+				}
+			}
+			p.ok = p.ok && names.ok
+		case extensionSupportedGroups:
+			curves := newParser(data.vector(2))
+			for curves.ok && len(curves.b) > 0 {
+				e.curves = append(e.curves, tls.CurveID(curves.u16()))
+			}
+			p.ok = p.ok && curves.ok
+		case extensionSignatureAlgorithms:
+			schemes := newParser(data.vector(2))
+			for schemes.ok && len(schemes.b) > 0 {
+				e.schemes = append(e.schemes, tls.SignatureScheme(schemes.u16()))
+			}
+			p.ok = p.ok && schemes.ok
+		case extensionExtendedMasterSecret:
+			e.extendedMaster = true
+		case extensionRenegotiationInfo:
+			e.renegotiation = true
+		}
+		p.ok = p.ok && data.ok
+	}
+	p.ok = p.ok && extensions.ok
+}
+
+// clientHello is ClientHello with the cookie of DTLS (RFC6347 Section 4.2.1)
+type clientHello struct {
+	version uint16
+	random  []byte
+	cookie  []byte
+	suites  []uint16
+	helloExtensions
+}
+
+func (m *clientHello) marshal() []byte {
+	var b builder
+	b.u16(m.version)
+	b = append(b, m.random...)
+	b.bytes(1, nil) // session_id
+	b.bytes(1, m.cookie)
+	b.vector(2, func(b *builder) {
+		for _, s := range m.suites {
+			b.u16(s)
+		}
+	})
+	b.bytes(1, []byte{0}) // null compression
+	m.helloExtensions.marshal(&b)
+	return b
+}
+
+func (m *clientHello) unmarshal(body []byte) bool {
+	p := newParser(body)
+	m.version = p.u16()
+	m.random = p.next(32)
+	p.vector(1) // session_id
+	m.cookie = p.vector(1)
+	suites := newParser(p.vector(2))
+	for suites.ok && len(suites.b) > 0 {
+		m.suites = append(m.suites, suites.u16())
+	}
+	p.vector(1) // compression_methods
+	m.helloExtensions.unmarshal(p)
+	return p.done() && suites.ok
+}
+
+// serverHello is ServerHello
+type serverHello struct {
+	version uint16
+	random  []byte
+	suite   uint16
+	helloExtensions
+}
+
+func (m *serverHello) marshal() []byte {
+	var b builder
+	b.u16(m.version)
+	b = append(b, m.random...)
+	b.bytes(1, nil) // session_id
+	b.u16(m.suite)
+	b.u8(0) // null compression
+	m.helloExtensions.marshal(&b)
+	return b
+}
+
+func (m *serverHello) unmarshal(body []byte) bool {
+	p := newParser(body)
+	m.version = p.u16()
+	m.random = p.next(32)
+	p.vector(1) // session_id
+	m.suite = p.u16()
+	if p.u8() != 0 {
+		return false
+	}
+	m.helloExtensions.unmarshal(p)
+	return p.done()
+}
+
+// marshalCertificates returns the body of Certificate
+func marshalCertificates(chain [][]byte) []byte {
+	var b builder
+	b.vector(3, func(b *builder) {
+		for _, cert := range chain {
+			b.bytes(3, cert)
+		}
+	})
+	return b
+}
+
+func unmarshalCertificates(body []byte) ([][]byte, bool) {
+	p := newParser(body)
+	certs := newParser(p.vector(3))
+	var chain [][]byte
+	for certs.ok && len(certs.b) > 0 {
+		chain = append(chain, certs.vector(3))
+	}
+	return chain, p.done() && certs.ok
+}
+
+// serverKeyExchange is ServerKeyExchange of ECDHE (RFC8422 Section 5.4)
+type serverKeyExchange struct {
+	curve     tls.CurveID
+	publicKey []byte
+	scheme    tls.SignatureScheme
+	signature []byte
+}
+
+// params returns the ECDH parameters, which are signed with the randoms
+func (m *serverKeyExchange) params() []byte {
+	var b builder
+	b.u8(curveTypeNamed)
+	b.u16(uint16(m.curve))
+	b.bytes(1, m.publicKey)
+	return b
+}
+
+func (m *serverKeyExchange) marshal() []byte {
+	b := builder(m.params())
+	b.u16(uint16(m.scheme))
+	b.bytes(2, m.signature)
+	return b
+}
+
+func (m *serverKeyExchange) unmarshal(body []byte) bool {
+	p := newParser(body)
+	if p.u8() != curveTypeNamed {
+		return false
+	}
+	m.curve = tls.CurveID(p.u16())
+	m.publicKey = p.vector(1)
+	m.scheme = tls.SignatureScheme(p.u16())
+	m.signature = p.vector(2)
+	return p.done()
+}
+
+// certificateRequest is CertificateRequest of TLS 1.2, the types are
+// ecdsa_sign and rsa_sign
+type certificateRequest struct {
+	schemes     []tls.SignatureScheme
+	authorities [][]byte
+}
+
+func (m *certificateRequest) marshal() []byte {
+	var b builder
+	b.bytes(1, []byte{64, 1})
+	b.vector(2, func(b *builder) {
+		for _, s := range m.schemes {
+			b.u16(uint16(s))
+		}
+	})
+	b.vector(2, func(b *builder) {
+		for _, name := range m.authorities {
+			b.bytes(2, name)
+		}
+	})
+	return b
+}
+
+func (m *certificateRequest) unmarshal(body []byte) bool {
+	p := newParser(body)
+	p.vector(1) // certificate_types
+	schemes := newParser(p.vector(2))
+	for schemes.ok && len(schemes.b) > 0 {
+		m.schemes = append(m.schemes, tls.SignatureScheme(schemes.u16()))
+	}
+	names := newParser(p.vector(2))
+	for names.ok && len(names.b) > 0 {
+		m.authorities = append(m.authorities, names.vector(2))
+	}
+	return p.done() && schemes.ok && names.ok
+}
+
+// marshalSignature returns the body of CertificateVerify
+func marshalSignature(scheme tls.SignatureScheme, signature []byte) []byte {
+	var b builder
+	b.u16(uint16(scheme))
+	b.bytes(2, signature)
+	return b
+}
+
+func unmarshalSignature(body []byte) (tls.SignatureScheme, []byte, bool) {
+	p := newParser(body)
+	scheme := tls.SignatureScheme(p.u16())
+	signature := p.vector(2)
+	return scheme, signature, p.done()
+}
@@ -0,0 +1,326 @@
+package dtls
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+)
+
+// serverHandshake runs the handshake of the server, the cookie of the
+// client is verified before the handshake (RFC6347 Section 4.2.1)
+func (c *Conn) serverHandshake(h *handshake) error {
+	config := c.config
+	cookieSecret := make([]byte, 32)
+	if _, err := rand.Read(cookieSecret); err != nil {
+		return err
+	}
+
+	var hello *clientHello
+	var m *handshakeMessage
+	for {
+		var err error
+		if m, err = h.readMessage(); err != nil {
+			return err
+		}
+		if m.typ != typeClientHello {
+			return alertUnexpectedMessage
+		}
+		hello = &clientHello{}
+		if !hello.unmarshal(m.body) {
+			return alertDecodeError
+		}
+		mac := hmac.New(sha256.New, cookieSecret)
+		mac.Write([]byte(c.conn.RemoteAddr().String()))
+		mac.Write(hello.random)
+		cookie := mac.Sum(nil)
+		if hmac.Equal(hello.cookie, cookie) {
+			break
+		}
+
+		var b builder
+		b.u16(versionDtls10)
+		b.bytes(1, cookie)
+		h.sendSeq = m.seq
+		verify := h.addMessage(typeHelloVerifyRequest, 0, b)
+		// the first ClientHello and HelloVerifyRequest are not in the transcript
+		h.transcript = nil
+		if err = h.send(verify); err != nil {
+			return err
+		}
+	}
+	// DTLS 1.2 is 0xfefd, the older versions are greater
+	if hello.version > versionDtls12 {
+		return alertProtocolVersion
+	}
+	h.clientRandom = hello.random
+
+	cert, err := c.serverCertificate(hello)
+	if err != nil {
+		return err
+	}
+	signer, ok := cert.PrivateKey.(crypto.Signer)
+	if !ok || len(cert.Certificate) == 0 {
+		return errors.New("dtls: the certificate of the server has no private key")
+	}
+	ecdsa := isEcdsaKey(signer.Public())
+	for _, s := range suitesOf(config) {
+		if s.ecdsa == ecdsa && hasSuite(hello.suites, s.id) {
+			h.suite = s
+			break
+		}
+	}
+	if h.suite == nil {
+		return alertHandshakeFailure
+	}
+	curveId := tls.CurveP256
+	if len(hello.curves) > 0 {
+		curveId = 0
+		for _, id := range curvesOf(config) {
+			if hasCurve(hello.curves, id) {
+				curveId = id
+				break
+			}
+		}
+	}
+	curve := curveOf(curveId)
+	if curve == nil {
+		return alertHandshakeFailure
+	}
+	scheme, err := signatureSchemeOf(signer, hello.schemes)
+	if err != nil {
+		return alertHandshakeFailure
+	}
+	h.extendedMaster = hello.extendedMaster
+
+	h.serverRandom = make([]byte, 32)
+	if _, err = rand.Read(h.serverRandom); err != nil {
+		return err
+	}
+	serverHello := &serverHello{version: versionDtls12, random: h.serverRandom, suite: h.suite.id}
+	serverHello.extendedMaster = hello.extendedMaster
+	// the secure renegotiation is offered by the extension or by
+	// TLS_EMPTY_RENEGOTIATION_INFO_SCSV (RFC5746 Section 3.6)
+	serverHello.renegotiation = hello.renegotiation || hasSuite(hello.suites, 0x00ff)
+	h.sendSeq = m.seq
+	flight := []flightEntry{
+		h.addMessage(typeServerHello, 0, serverHello.marshal()),
+		h.addMessage(typeCertificate, 0, marshalCertificates(cert.Certificate)),
+	}
+
+	key, err := curve.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	keyExchange := &serverKeyExchange{curve: curveId, publicKey: key.PublicKey().Bytes(), scheme: scheme}
+	signed := append(append(append([]byte(nil), h.clientRandom...), h.serverRandom...), keyExchange.params()...)
+	if keyExchange.signature, err = sign(signer, scheme, signed); err != nil {
+		return err
+	}
+	flight = append(flight, h.addMessage(typeServerKeyExchange, 0, keyExchange.marshal()))
+	if config.ClientAuth >= tls.RequestClientCert {
+		request := &certificateRequest{schemes: signatureSchemes}
+		flight = append(flight, h.addMessage(typeCertificateRequest, 0, request.marshal()))
+	}
+	flight = append(flight, h.addMessage(typeServerHelloDone, 0, nil))
+	if err = h.send(flight...); err != nil {
+		return err
+	}
+
+	if m, err = h.readMessage(); err != nil {
+		return err
+	}
+	var certs []*x509.Certificate
+	if config.ClientAuth >= tls.RequestClientCert {
+		if m.typ != typeCertificate {
+			return alertUnexpectedMessage
+		}
+		rawCerts, ok := unmarshalCertificates(m.body)
+		if !ok {
+			return alertDecodeError
+		}
+		if len(rawCerts) == 0 && (config.ClientAuth == tls.RequireAnyClientCert ||
+			config.ClientAuth == tls.RequireAndVerifyClientCert) {
+			c.sendAlert(alertHandshakeFailure)
+			return errors.New("dtls: the client has not sent a certificate")
+		}
+		if len(rawCerts) > 0 {
+			verify := config.ClientAuth >= tls.VerifyClientCertIfGiven
+			if certs, err = c.verifyCertificates(rawCerts, x509.ExtKeyUsageClientAuth, config.ClientCAs, verify); err != nil {
+				return err
+			}
+		}
+		if m, err = h.readMessage(); err != nil {
+			return err
+		}
+	}
+
+	if m.typ != typeClientKeyExchange {
+		return alertUnexpectedMessage
+	}
+	p := newParser(m.body)
+	point := p.vector(1)
+	if !p.done() {
+		return alertDecodeError
+	}
+	peerKey, err := curve.NewPublicKey(point)
+	if err != nil {
+		return alertIllegalParameter
+	}
+	preMasterSecret, err := key.ECDH(peerKey)
+	if err != nil {
+		return alertIllegalParameter
+	}
+	clientCipher, serverCipher, err := h.deriveKeys(preMasterSecret)
+	if err != nil {
+		return err
+	}
+	h.peerReadCipher = clientCipher
+
+	if len(certs) > 0 {
+		if m, err = h.readMessage(); err != nil {
+			return err
+		}
+		if m.typ != typeCertificateVerify {
+			return alertUnexpectedMessage
+		}
+		scheme, signature, ok := unmarshalSignature(m.body)
+		if !ok {
+			return alertDecodeError
+		}
+		if !hasScheme(signatureSchemes, scheme) {
+			return alertIllegalParameter
+		}
+		if err = verifySignature(certs[0].PublicKey, scheme, h.transcriptBefore(m), signature); err != nil {
+			c.sendAlert(alertDecryptError)
+			return err
+		}
+	}
+
+	if m, err = h.readMessage(); err != nil {
+		return err
+	}
+	if m.typ != typeFinished || m.epoch != 1 {
+		return alertUnexpectedMessage
+	}
+	if !equal(m.body, h.finished("client finished", h.transcriptBefore(m))) {
+		return alertDecryptError
+	}
+
+	c.writeMutex.Lock()
+	c.writeCiphers[1] = serverCipher
+	c.writeMutex.Unlock()
+	flight = []flightEntry{
+		{typ: contentChangeCipherSpec, data: []byte{1}},
+		h.addMessage(typeFinished, 1, h.finished("server finished", h.transcript)),
+	}
+	if err = h.send(flight...); err != nil {
+		return err
+	}
+	c.lastFlight = flight
+
+	c.peerCertificates = certs
+	c.cipherSuite = h.suite.id
+	return nil
+}
+
+// serverCertificate returns the certificate of the server for the hello
+func (c *Conn) serverCertificate(hello *clientHello) (*tls.Certificate, error) {
+	if c.config.GetCertificate != nil {
+		info := &tls.ClientHelloInfo{ServerName: hello.serverName, CipherSuites: hello.suites,
+			SupportedCurves: hello.curves, SignatureSchemes: hello.schemes}
+		cert, err := c.config.GetCertificate(info)
+		if err != nil || cert != nil {
+			return cert, err
+		}
+	}
+	if len(c.config.Certificates) == 0 {
+		return nil, errors.New("dtls: no certificate of the server")
+	}
+	return &c.config.Certificates[0], nil
+}
+
+// verifyCertificates parses the chain of the peer and verifies it by the
+// roots unless verify is false, VerifyPeerCertificate is called then
+func (c *Conn) verifyCertificates(rawCerts [][]byte, usage x509.ExtKeyUsage, roots *x509.CertPool, verify bool) ([]*x509.Certificate, error) {
+	certs := make([]*x509.Certificate, len(rawCerts))
+	for i, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			c.sendAlert(alertBadCertificate)
+			return nil, err
+		}
+		certs[i] = cert
+	}
+
+	var chains [][]*x509.Certificate
+	if verify {
+		opts := x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: x509.NewCertPool(),
+			KeyUsages:     []x509.ExtKeyUsage{usage},
+		}
+		if c.isClient {
+			opts.DNSName = c.config.ServerName
+		}
+		if c.config.Time != nil {
+			opts.CurrentTime = c.config.Time()
+		}
+		for _, cert := range certs[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+		var err error
+		if chains, err = certs[0].Verify(opts); err != nil {
+			if _, ok := err.(x509.UnknownAuthorityError); ok {
+				c.sendAlert(alertUnknownCa)
+			} else {
+				c.sendAlert(alertBadCertificate)
+			}
+			return nil, err
+		}
+	}
+	if c.config.VerifyPeerCertificate != nil {
+		if err := c.config.VerifyPeerCertificate(rawCerts, chains); err != nil {
+			c.sendAlert(alertBadCertificate)
+			return nil, err
+		}
+	}
+	return certs, nil
+}
+
+// hasSuite, hasCurve and hasScheme report whether the id is in the ones
+// offered by the peer
+func hasSuite(ids []uint16, id uint16) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+func hasCurve(ids []tls.CurveID, id tls.CurveID) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+func hasScheme(schemes []tls.SignatureScheme, scheme tls.SignatureScheme) bool {
+	for _, v := range schemes {
+		if v == scheme {
+			return true
+		}
+	}
+	return false
+}
+
+func equal(a, b []byte) bool {
+	return subtle.ConstantTimeCompare(a, b) == 1
+}
@@ -0,0 +1,143 @@
+package snmpclient2
+
+import (
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+// An EngineEntry is the authoritative engine of an agent learned by an
+// SNMP object, with the keys of the user localized to the engine.
+type EngineEntry struct {
+	EngineId    []byte
+	EngineBoots int64
+	EngineTime  int64     // snmpEngineTime at UpdatedTime
+	UpdatedTime time.Time // Time when the engine is learned or synchronized
+	AuthKey     []byte
+	PrivKey     []byte
+
+	// fingerprint of the protocols and passwords which the keys are from
+	credentials [sha256.Size]byte
+}
+
+// An EngineCache keeps the engines discovered by the SNMP objects, so that
+// an SNMP object set in Arguments.EngineCache skips the discovery and the
+// localization of the keys when it opens against the same agent and user.
+// An EngineCache is safe for concurrent use by multiple SNMP objects.
+type EngineCache struct {
+	mutex   sync.Mutex
+	maxAge  time.Duration
+	entries map[string]*EngineEntry
+}
+
+// NewEngineCache returns an EngineCache whose entries are discovered again
+// after maxAge, the entries never expire if maxAge is 0.
+func NewEngineCache(maxAge time.Duration) *EngineCache {
+	return &EngineCache{maxAge: maxAge, entries: map[string]*EngineEntry{}}
+}
+
+func engineCacheKey(address, userName string) string {
+	return address + "\x00" + userName
+}
+
+// Get returns the entry of the agent and the user, ok is false if the entry
+// is not exists or is expired.
+func (c *EngineCache) Get(address, userName string) (entry EngineEntry, ok bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	key := engineCacheKey(address, userName)
+	e := c.entries[key]
+	if e == nil {
+		return
+	}
+	if c.expired(e, time.Now()) {
+		delete(c.entries, key)
+		return
+	}
+	return *e, true
+}
+
+// Put stores the entry of the agent and the user
+func (c *EngineCache) Put(address, userName string, entry EngineEntry) {
+	entry.EngineId = append([]byte(nil), entry.EngineId...)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.entries[engineCacheKey(address, userName)] = &entry
+}
+
+// Invalidate removes the entry of the agent and the user
+func (c *EngineCache) Invalidate(address, userName string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.entries, engineCacheKey(address, userName))
+}
+
+// Purge removes the expired entries, which are otherwise removed only when
+// they are got, and returns the number of them
+func (c *EngineCache) Purge() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now, n := time.Now(), 0
+	for key, e := range c.entries {
+		if c.expired(e, now) {
+			delete(c.entries, key)
+			n++
+		}
+	}
+	return n
+}
+
+func (c *EngineCache) expired(e *EngineEntry, now time.Time) bool {
+	return c.maxAge > 0 && now.Sub(e.UpdatedTime) > c.maxAge
+}
+
+// Len returns the number of the entries
+func (c *EngineCache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.entries)
+}
+
+func credentialsOf(args *Arguments) [sha256.Size]byte {
+	return sha256.Sum256([]byte(string(args.AuthProtocol) + "\x00" + args.AuthPassword +
+		"\x00" + args.PrivPassword))
+}
+
+// load restores the engine of the agent from the cache, it returns false if
+// the engine is unknown.
+func (u *USM) load(cache *EngineCache, address string, args *Arguments) bool {
+	entry, ok := cache.Get(address, args.UserName)
+	if !ok {
+		return false
+	}
+
+	u.AuthEngineId = entry.EngineId
+	u.AuthEngineBoots = entry.EngineBoots
+	u.AuthEngineTime = entry.EngineTime
+	u.UpdatedTime = entry.UpdatedTime
+	if entry.credentials == credentialsOf(args) {
+		u.keyEngineId = entry.EngineId
+		u.authKey = entry.AuthKey
+		u.privKey = entry.PrivKey
+	}
+	return true
+}
+
+// store saves the engine of the agent and the localized keys to the cache
+func (u *USM) store(cache *EngineCache, address string, args *Arguments) {
+	entry := EngineEntry{
+		EngineId:    u.AuthEngineId,
+		EngineBoots: u.AuthEngineBoots,
+		EngineTime:  u.AuthEngineTime,
+		UpdatedTime: u.UpdatedTime,
+	}
+	if args.SecurityLevel > NoAuthNoPriv && len(args.AuthKey) == 0 {
+		u.localizedKeys(args)
+		entry.AuthKey = u.authKey
+		entry.PrivKey = u.privKey
+		entry.credentials = credentialsOf(args)
+	}
+	cache.Put(address, args.UserName, entry)
+}
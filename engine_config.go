@@ -0,0 +1,155 @@
+package snmpclient2
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// An EngineStore keeps the engine ID and the snmpEngineBoots of the local
+// engine over the restarts of the process
+type EngineStore interface {
+	// Load returns the stored engine, engineId is nil if it is not stored
+	Load() (engineId []byte, engineBoots int64, err error)
+	Save(engineId []byte, engineBoots int64) error
+}
+
+// A FileEngineStore is an EngineStore of a file, which is a line of the
+// engine ID in hex and the boots, e.g. "80001f88046c6f63616c 3"
+type FileEngineStore struct {
+	Path string
+}
+
+func (f FileEngineStore) Load() ([]byte, int64, error) {
+	b, err := ioutil.ReadFile(f.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, 0, nil
+		}
+		return nil, 0, err
+	}
+	fields := strings.Fields(string(b))
+	if len(fields) != 2 {
+		return nil, 0, fmt.Errorf("engine file '%s' is malformed", f.Path)
+	}
+	engineId, err := hex.DecodeString(fields[0])
+	if err != nil {
+		return nil, 0, fmt.Errorf("engine file '%s' is malformed - %v", f.Path, err)
+	}
+	engineBoots, err := strconv.ParseInt(fields[1], 10, 32)
+	if err != nil {
+		return nil, 0, fmt.Errorf("engine file '%s' is malformed - %v", f.Path, err)
+	}
+	return engineId, engineBoots, nil
+}
+
+// Save replaces the file atomically, so that the boots are never lost by a
+// crash while it is written
+func (f FileEngineStore) Save(engineId []byte, engineBoots int64) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(f.Path), filepath.Base(f.Path)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(tmp, "%s %d\n", hex.EncodeToString(engineId), engineBoots)
+	if e := tmp.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), f.Path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// An EngineConfig is the local authoritative engine which sends the SNMPv3
+// traps as Arguments.EngineConfig (RFC3414 Section 2.2). Its boots are
+// incremented and saved to the store whenever it is created, so that the
+// receivers accept the traps after the process is restarted.
+type EngineConfig struct {
+	mutex       sync.Mutex
+	store       EngineStore
+	engineId    []byte
+	engineBoots int64
+	started     time.Time
+}
+
+// NewEngineConfig boots the engine of the ID in hex, the stored ID is used
+// if engineId is empty. The boots restart from 1 if the ID differs from
+// the stored one.
+func NewEngineConfig(engineId string, store EngineStore) (*EngineConfig, error) {
+	storedId, engineBoots, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	id := storedId
+	if engineId != "" {
+		if id, err = engineIdToBytes(StripHexPrefix(engineId)); err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(id, storedId) {
+			engineBoots = 0
+		}
+	}
+	if len(id) == 0 {
+		return nil, ArgumentError{
+			Value:   engineId,
+			Message: "EngineId is required if it is not stored",
+		}
+	}
+
+	c := &EngineConfig{store: store, engineId: id, engineBoots: engineBoots}
+	if err = c.reboot(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// LoadEngineConfig is NewEngineConfig with the FileEngineStore of file
+func LoadEngineConfig(engineId, file string) (*EngineConfig, error) {
+	return NewEngineConfig(engineId, FileEngineStore{Path: file})
+}
+
+// EngineId returns the ID of the engine
+func (c *EngineConfig) EngineId() []byte {
+	return append([]byte(nil), c.engineId...)
+}
+
+// EngineBootsTime returns snmpEngineBoots and snmpEngineTime of the engine,
+// the boots are incremented when the time reaches 2147483647
+func (c *EngineConfig) EngineBootsTime() (engineBoots, engineTime int64, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	engineTime = int64(time.Since(c.started).Seconds())
+	if engineTime >= math.MaxInt32 {
+		if err = c.reboot(); err != nil {
+			return
+		}
+		engineTime = 0
+	}
+	return c.engineBoots, engineTime, nil
+}
+
+// reboot increments the boots and saves them
+func (c *EngineConfig) reboot() error {
+	if c.engineBoots >= math.MaxInt32-1 {
+		return fmt.Errorf("EngineBoots reached the max value, [%d]", math.MaxInt32)
+	}
+	if err := c.store.Save(c.engineId, c.engineBoots+1); err != nil {
+		return err
+	}
+	c.engineBoots++
+	c.started = time.Now()
+	return nil
+}
@@ -0,0 +1,183 @@
+package snmpclient2
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// The format of the engine ID (RFC 3411 Section 5, SnmpEngineID)
+type EngineIdFormat uint8
+
+const (
+	EngineIdIPv4   EngineIdFormat = 1
+	EngineIdIPv6   EngineIdFormat = 2
+	EngineIdMAC    EngineIdFormat = 3
+	EngineIdText   EngineIdFormat = 4
+	EngineIdOctets EngineIdFormat = 5
+)
+
+func (f EngineIdFormat) String() string {
+	switch f {
+	case EngineIdIPv4:
+		return "ipv4"
+	case EngineIdIPv6:
+		return "ipv6"
+	case EngineIdMAC:
+		return "mac"
+	case EngineIdText:
+		return "text"
+	case EngineIdOctets:
+		return "octets"
+	}
+	if f >= 128 {
+		return "enterprise(" + strconv.Itoa(int(f)) + ")"
+	}
+	return "reserved(" + strconv.Itoa(int(f)) + ")"
+}
+
+// the names of the well known private enterprise numbers of the agents
+var enterpriseNames = map[uint32]string{
+	9:     "cisco",
+	311:   "microsoft",
+	1916:  "extreme",
+	2011:  "huawei",
+	2636:  "juniper",
+	6527:  "nokia",
+	8072:  "net-snmp",
+	14988: "mikrotik",
+	25506: "h3c",
+}
+
+// GenerateEngineId returns the engine ID of the enterprise in hex, data is
+// the address of the IPv4, IPv6 and MAC formats, or the administratively
+// assigned octets of the text and octets formats. The formats from 128
+// are enterprise specific, data is the octets then.
+func GenerateEngineId(enterpriseNumber uint32, format EngineIdFormat, data []byte) (string, error) {
+	if enterpriseNumber > 0x7fffffff {
+		return "", ArgumentError{
+			Value:   enterpriseNumber,
+			Message: "Enterprise number is range 0..2147483647",
+		}
+	}
+
+	max := engineIdMaxLength - 5
+	switch format {
+	case EngineIdIPv4:
+		ip := net.IP(data).To4()
+		if nil == ip {
+			return "", ArgumentError{Value: data, Message: "Data of the ipv4 format must be an IPv4 address"}
+		}
+		data = ip
+	case EngineIdIPv6:
+		if len(data) != net.IPv6len {
+			return "", ArgumentError{Value: data, Message: "Data of the ipv6 format must be an IPv6 address"}
+		}
+	case EngineIdMAC:
+		if len(data) != 6 {
+			return "", ArgumentError{Value: data, Message: "Data of the mac format must be 6 octets"}
+		}
+	case EngineIdText, EngineIdOctets:
+		if l := len(data); l < 1 || l > max {
+			return "", ArgumentError{
+				Value:   data,
+				Message: fmt.Sprintf("Data of the %s format is range 1..%d octets", format, max),
+			}
+		}
+	default:
+		if format < 128 {
+			return "", ArgumentError{Value: format, Message: "Illegal EngineIdFormat"}
+		}
+		if l := len(data); l < 1 || l > max {
+			return "", ArgumentError{
+				Value:   data,
+				Message: fmt.Sprintf("Data of the enterprise specific format is range 1..%d octets", max),
+			}
+		}
+	}
+
+	b := make([]byte, 5, 5+len(data))
+	binary.BigEndian.PutUint32(b, enterpriseNumber|0x80000000)
+	b[4] = byte(format)
+	return hex.EncodeToString(append(b, data...)), nil
+}
+
+// An EngineIdInfo is the decoded engine ID
+type EngineIdInfo struct {
+	EnterpriseNumber uint32
+	// The engine ID is of the format of RFC 3411, or of the SNMPv1 style
+	// which is the enterprise number followed by 8 octets
+	Conformant bool
+	Format     EngineIdFormat // 0 if it is not Conformant
+	Data       []byte
+}
+
+// Enterprise returns the name of the well known enterprise, or the
+// enterprise number
+func (e EngineIdInfo) Enterprise() string {
+	if name, ok := enterpriseNames[e.EnterpriseNumber]; ok {
+		return name
+	}
+	return "enterprise " + strconv.FormatUint(uint64(e.EnterpriseNumber), 10)
+}
+
+// String returns the description of the engine ID, e.g.
+//
+//	engine: net-snmp, format=text, 'linuxhost'
+//
+// the data is in hex if it does not match the format
+func (e EngineIdInfo) String() string {
+	format := "snmpv1"
+	if e.Conformant {
+		format = e.Format.String()
+	}
+	data := hex.EncodeToString(e.Data)
+	switch {
+	case !e.Conformant:
+	case e.Format == EngineIdIPv4 && len(e.Data) == net.IPv4len,
+		e.Format == EngineIdIPv6 && len(e.Data) == net.IPv6len:
+		data = net.IP(e.Data).String()
+	case e.Format == EngineIdMAC && len(e.Data) == 6:
+		data = net.HardwareAddr(e.Data).String()
+	case e.Format == EngineIdText && isPrintable(e.Data):
+		data = "'" + string(e.Data) + "'"
+	}
+	return fmt.Sprintf("engine: %s, format=%s, %s", e.Enterprise(), format, data)
+}
+
+// ParseEngineId decodes the engine ID in hex, the "0x" prefix is optional.
+// The data which does not match the format is accepted as is, the agents
+// in the field are not always conformant.
+func ParseEngineId(s string) (EngineIdInfo, error) {
+	s = StripHexPrefix(s)
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return EngineIdInfo{}, ArgumentError{
+			Value:   s,
+			Message: "EngineId must be a hexadecimal string - " + err.Error(),
+		}
+	}
+	return parseEngineId(b)
+}
+
+func parseEngineId(b []byte) (EngineIdInfo, error) {
+	// RFC 3411 Section 5
+	if l := len(b); l < 5 || l > engineIdMaxLength {
+		return EngineIdInfo{}, ArgumentError{
+			Value:   hex.EncodeToString(b),
+			Message: fmt.Sprintf("EngineId length is range 5..%d octets, actual %d", engineIdMaxLength, l),
+		}
+	}
+
+	info := EngineIdInfo{EnterpriseNumber: binary.BigEndian.Uint32(b) &^ 0x80000000}
+	if b[0]&0x80 == 0 {
+		info.Data = b[4:]
+		return info, nil
+	}
+	info.Conformant = true
+	info.Format = EngineIdFormat(b[4])
+	info.Data = b[5:]
+	return info, nil
+}
@@ -0,0 +1,101 @@
+package snmpclient2_test
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/runner-mei/snmpclient2"
+)
+
+func TestGenerateEngineId(t *testing.T) {
+	for _, test := range []struct {
+		enterprise uint32
+		format     snmpclient2.EngineIdFormat
+		data       []byte
+		expected   string
+		info       string
+	}{
+		{8072, snmpclient2.EngineIdText, []byte("linuxhost"), "80001f88046c696e7578686f7374",
+			"engine: net-snmp, format=text, 'linuxhost'"},
+		{9, snmpclient2.EngineIdIPv4, net.ParseIP("192.168.1.1"), "8000000901c0a80101",
+			"engine: cisco, format=ipv4, 192.168.1.1"},
+		{2636, snmpclient2.EngineIdIPv6, net.ParseIP("2001:db8::1"), "80000a4c0220010db8000000000000000000000001",
+			"engine: juniper, format=ipv6, 2001:db8::1"},
+		{12345, snmpclient2.EngineIdMAC, []byte{0x00, 0x1b, 0x21, 0x0a, 0x0b, 0x0c}, "8000303903001b210a0b0c",
+			"engine: enterprise 12345, format=mac, 00:1b:21:0a:0b:0c"},
+		{8072, snmpclient2.EngineIdOctets, []byte{0x01, 0x02}, "80001f88050102",
+			"engine: net-snmp, format=octets, 0102"},
+		{8072, 128, []byte{0xaa}, "80001f8880aa",
+			"engine: net-snmp, format=enterprise(128), aa"},
+	} {
+		s, err := snmpclient2.GenerateEngineId(test.enterprise, test.format, test.data)
+		if err != nil {
+			t.Errorf("GenerateEngineId(%s) - has error %v", test.format, err)
+			continue
+		}
+		if s != test.expected {
+			t.Errorf("GenerateEngineId(%s) - expected [%s], actual [%s]", test.format, test.expected, s)
+		}
+
+		info, err := snmpclient2.ParseEngineId("0x" + s)
+		if err != nil {
+			t.Errorf("ParseEngineId(%s) - has error %v", s, err)
+			continue
+		}
+		if info.String() != test.info {
+			t.Errorf("ParseEngineId(%s) - expected [%s], actual [%s]", s, test.info, info)
+		}
+		if info.EnterpriseNumber != test.enterprise || info.Format != test.format || !info.Conformant {
+			t.Errorf("ParseEngineId(%s) - expected [%d %s], actual %+v", s, test.enterprise, test.format, info)
+		}
+	}
+
+	for _, test := range []struct {
+		enterprise uint32
+		format     snmpclient2.EngineIdFormat
+		data       []byte
+	}{
+		{0x80000000, snmpclient2.EngineIdText, []byte("host")},
+		{8072, snmpclient2.EngineIdIPv4, []byte{1, 2, 3}},
+		{8072, snmpclient2.EngineIdIPv6, []byte{1, 2, 3, 4}},
+		{8072, snmpclient2.EngineIdMAC, []byte{1, 2, 3, 4}},
+		{8072, snmpclient2.EngineIdText, nil},
+		{8072, snmpclient2.EngineIdText, bytes.Repeat([]byte("a"), 28)},
+		{8072, 6, []byte{1}},
+	} {
+		if s, err := snmpclient2.GenerateEngineId(test.enterprise, test.format, test.data); err == nil {
+			t.Errorf("GenerateEngineId(%d, %s, %x) - expected an error, actual [%s]",
+				test.enterprise, test.format, test.data, s)
+		}
+	}
+}
+
+func TestParseEngineId(t *testing.T) {
+	info, err := snmpclient2.ParseEngineId("000000090200000000000001")
+	if err != nil {
+		t.Fatalf("ParseEngineId() - has error %v", err)
+	}
+	if info.Conformant || info.EnterpriseNumber != 9 || len(info.Data) != 8 {
+		t.Errorf("ParseEngineId() - expected an SNMPv1 style engine id, actual %+v", info)
+	}
+	if expected := "engine: cisco, format=snmpv1, 0200000000000001"; info.String() != expected {
+		t.Errorf("ParseEngineId() - expected [%s], actual [%s]", expected, info)
+	}
+
+	// the data which does not match the format is accepted
+	info, err = snmpclient2.ParseEngineId("80001f880101")
+	if err != nil || info.Format != snmpclient2.EngineIdIPv4 || info.String() != "engine: net-snmp, format=ipv4, 01" {
+		t.Errorf("ParseEngineId() - expected a malformed ipv4, actual [%s] %v", info, err)
+	}
+
+	for _, s := range []string{"80001f88", "80001f8804zz", "80001f8804" + string(bytes.Repeat([]byte("61"), 28))} {
+		if _, err = snmpclient2.ParseEngineId(s); err == nil {
+			t.Errorf("ParseEngineId(%s) - expected an error", s)
+		}
+		args := &snmpclient2.Arguments{Version: snmpclient2.V3, UserName: "MyName", SecurityEngineId: s}
+		if e := snmpclient2.ArgsValidate(args); e == nil || e.Error() != err.Error() {
+			t.Errorf("validate(%s) - expected [%v], actual [%v]", s, err, e)
+		}
+	}
+}
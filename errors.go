@@ -3,10 +3,12 @@ package snmpclient2
 import (
 	"errors"
 	"fmt"
+	"strings"
 )
 
 var UnsupportedOperation error = errors.New("Unsupported operation")
 var TimeoutError = errors.New("time out")
+var WouldBlockError = errors.New("would block")
 
 // An ArgumentError suggests that the arguments are wrong
 type ArgumentError struct {
@@ -20,9 +22,11 @@ func (e ArgumentError) Error() string {
 
 // A ResponseError suggests that the response from the remote agent is wrong or is not obtained
 type ResponseError struct {
-	Cause   error  // Cause of the error
-	Message string // Error message
-	Detail  string // Detail of the error for debugging
+	Cause       error       // Cause of the error
+	Message     string      // Error message
+	Detail      string      // Detail of the error for debugging
+	Correlation interface{} // Correlation value of the request, see WithCorrelation
+	Report      string      // Oid of the report PDU received from the agent (V3 specific)
 }
 
 func (e ResponseError) Error() string {
@@ -36,3 +40,163 @@ func (e ResponseError) Error() string {
 type notInTimeWindowError struct {
 	ResponseError
 }
+
+// unknownEngineIdError is a report of usmStatsUnknownEngineIDs, the engine
+// is discovered again
+type unknownEngineIdError struct {
+	ResponseError
+}
+
+// responseMismatchError is a response to another request, e.g. a late
+// response to a previous attempt
+type responseMismatchError struct {
+	ResponseError
+}
+
+// walkAbortedError aborts a walk of a misbehaving agent, the walk returns
+// the bindings collected so far with the ResponseError
+type walkAbortedError struct {
+	ResponseError
+}
+
+// A WalkTruncatedError suggests that a walk is stopped by MaxWalkVarBinds or
+// MaxWalkDuration, the bindings collected so far are returned with it
+type WalkTruncatedError struct {
+	Limit      string // Name of the limit which is reached
+	Count      int    // Number of the variable bindings collected
+	Incomplete Oids   // Base OIDs of the subtrees which are not walked to the end
+}
+
+func (e WalkTruncatedError) Error() string {
+	incomplete := make([]string, len(e.Incomplete))
+	for i, oid := range e.Incomplete {
+		incomplete[i] = oid.ToString()
+	}
+	return fmt.Sprintf("Walk is truncated by %s after [%d] variable bindings, incomplete [%s]",
+		e.Limit, e.Count, strings.Join(incomplete, ", "))
+}
+
+// An EngineIdMismatchError suggests that the discovered authoritative engine
+// is not the configured SecurityEngineId
+type EngineIdMismatchError struct {
+	Address  string // Address of the agent
+	Expected []byte // Configured engine ID
+	Actual   []byte // Discovered engine ID
+}
+
+func (e EngineIdMismatchError) Error() string {
+	return fmt.Sprintf("EngineId mismatch at %s - expected [%s], actual [%s]",
+		e.Address, ToHexStr(e.Expected, ""), ToHexStr(e.Actual, ""))
+}
+
+// An InformNotAcknowledgedError suggests that the receiver does not
+// acknowledge the InformRequest, i.e. no response is received after the
+// retries or the response has an error status
+type InformNotAcknowledgedError struct {
+	Attempts int   // Number of the InformRequests sent
+	Cause    error // Timeout or the PduError of the response
+}
+
+func (e InformNotAcknowledgedError) Error() string {
+	return fmt.Sprintf("InformRequest is not acknowledged after [%d] attempts, cause `%v`", e.Attempts, e.Cause)
+}
+
+// A PduError is the error status of a response PDU, see ErrorFromPdu. The
+// error statuses of SNMPv1 and the common ones of SNMPv2 are the types
+// which embed PduError, errors.As of *PduError matches them all. The types
+// are made by ErrorFromPdu, which sets the Status of them.
+type PduError struct {
+	Status ErrorStatus // Error status of the response
+	Index  int         // Error index of the response, 0 if it is not set
+	Oid    Oid         // Oid of the request at Index
+}
+
+func (e PduError) Error() string {
+	if e.Index <= 0 {
+		return fmt.Sprintf("Received an error status from the agent - %s", e.Status)
+	}
+	return fmt.Sprintf("Received an error status from the agent - %s, index [%d] oid [%s]",
+		e.Status, e.Index, e.Oid.ToString())
+}
+
+// ErrorStatus returns the error status, the handlers of an UdpServer return
+// the PduError to answer it, e.g. PduError{Status: NoSuchName}
+func (e PduError) ErrorStatus() ErrorStatus {
+	return e.Status
+}
+
+// As matches the PduError of the types which embed it
+func (e PduError) As(target interface{}) bool {
+	if p, ok := target.(*PduError); ok {
+		*p = e
+		return true
+	}
+	return false
+}
+
+type TooBigError struct{ PduError }
+type NoSuchNameError struct{ PduError }
+type BadValueError struct{ PduError }
+type ReadOnlyError struct{ PduError }
+type GenErrError struct{ PduError }
+type NoAccessError struct{ PduError }
+type WrongTypeError struct{ PduError }
+type WrongValueError struct{ PduError }
+type NoCreationError struct{ PduError }
+type InconsistentValueError struct{ PduError }
+type ResourceUnavailableError struct{ PduError }
+type CommitFailedError struct{ PduError }
+type NotWritableError struct{ PduError }
+
+// AuthorizationFailedError is the error status AuthorizationError, which
+// is the name of the ErrorStatus
+type AuthorizationFailedError struct{ PduError }
+
+// ErrorFromPdu returns the error of the error status of the response, it is
+// nil if the status is NoError. The Oid is of the request at the error
+// index, or of the response if req is nil.
+func ErrorFromPdu(req, resp PDU) error {
+	if nil == resp || resp.ErrorStatus() == NoError {
+		return nil
+	}
+	e := PduError{Status: resp.ErrorStatus(), Index: resp.ErrorIndex()}
+	vbs := resp.VariableBindings()
+	if nil != req {
+		vbs = req.VariableBindings()
+	}
+	if e.Index > 0 && e.Index <= len(vbs) {
+		e.Oid = vbs[e.Index-1].Oid
+	}
+
+	switch e.Status {
+	case TooBig:
+		return TooBigError{e}
+	case NoSuchName:
+		return NoSuchNameError{e}
+	case BadValue:
+		return BadValueError{e}
+	case ReadOnly:
+		return ReadOnlyError{e}
+	case GenError:
+		return GenErrError{e}
+	case NoAccess:
+		return NoAccessError{e}
+	case WrongType:
+		return WrongTypeError{e}
+	case WrongValue:
+		return WrongValueError{e}
+	case NoCreation:
+		return NoCreationError{e}
+	case InconsistentValue:
+		return InconsistentValueError{e}
+	case ResourceUnavailable:
+		return ResourceUnavailableError{e}
+	case CommitFailed:
+		return CommitFailedError{e}
+	case AuthorizationError:
+		return AuthorizationFailedError{e}
+	case NotWritable:
+		return NotWritableError{e}
+	}
+	return e
+}
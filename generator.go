@@ -0,0 +1,205 @@
+package snmpclient2
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A ValueGenerator returns the value of an OID of the simulator at the
+// time now, all the values of a request are generated at the same time.
+type ValueGenerator func(now time.Time) Variable
+
+// NewCounter32Generator returns a Counter32 which starts at start and
+// increases rate per second from now on, it wraps at 2^32.
+func NewCounter32Generator(start uint32, rate float64) ValueGenerator {
+	since := time.Now()
+	return func(now time.Time) Variable {
+		delta := increase(rate, now.Sub(since), 1<<32)
+		return NewCounter32(uint32(uint64(start) + delta))
+	}
+}
+
+// NewCounter64Generator returns a Counter64 which starts at start and
+// increases rate per second from now on, it wraps at 2^64.
+func NewCounter64Generator(start uint64, rate float64) ValueGenerator {
+	since := time.Now()
+	return func(now time.Time) Variable {
+		return NewCounter64(start + increase(rate, now.Sub(since), 1<<64))
+	}
+}
+
+// increase returns rate * elapsed modulo m
+func increase(rate float64, elapsed time.Duration, m float64) uint64 {
+	if rate <= 0 || elapsed <= 0 {
+		return 0
+	}
+	return uint64(math.Mod(rate*elapsed.Seconds(), m))
+}
+
+// NewSineGauge32Generator returns a Gauge32 which follows a sine wave
+// between min and max with the period.
+func NewSineGauge32Generator(min, max uint32, period time.Duration) ValueGenerator {
+	since := time.Now()
+	mid := (float64(min) + float64(max)) / 2
+	amplitude := (float64(max) - float64(min)) / 2
+	return func(now time.Time) Variable {
+		if period <= 0 {
+			return NewGauge32(uint32(mid))
+		}
+		phase := 2 * math.Pi * float64(now.Sub(since)) / float64(period)
+		return NewGauge32(uint32(math.Floor(mid + amplitude*math.Sin(phase) + 0.5)))
+	}
+}
+
+// NewJitterGauge32Generator returns a Gauge32 which is value plus a random
+// jitter in [-jitter, jitter] at every request, it is clamped at 0 and
+// 2^32-1.
+func NewJitterGauge32Generator(value, jitter uint32) ValueGenerator {
+	j := newJitter(float64(jitter))
+	return func(now time.Time) Variable {
+		return NewGauge32(uint32(math.Max(0, math.Min(math.MaxUint32, float64(value)+j.next()))))
+	}
+}
+
+// jitter is a random source safe for the concurrent requests
+type jitter struct {
+	mutex  sync.Mutex
+	random *rand.Rand
+	max    float64
+}
+
+func newJitter(max float64) *jitter {
+	return &jitter{random: rand.New(rand.NewSource(time.Now().UnixNano())), max: max}
+}
+
+// next returns an integer in [-max, max]
+func (j *jitter) next() float64 {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	return math.Floor(j.random.Float64()*(2*j.max+1)) - j.max
+}
+
+// NewUpTimeGenerator returns the TimeTicks since the time, e.g. sysUpTime
+func NewUpTimeGenerator(since time.Time) ValueGenerator {
+	return func(now time.Time) Variable {
+		return NewTimeTicks(uint32(uint64(now.Sub(since) / timeTicksUnit)))
+	}
+}
+
+// SetDynamic generates the value of the oid by gen, the oid is added if it
+// is not exists. A nil gen keeps the current value.
+func (self *UdpServer) SetDynamic(oid Oid, gen ValueGenerator) {
+	self.mibsMutex.Lock()
+	defer self.mibsMutex.Unlock()
+
+	if nil == self.mibs {
+		self.mibs = NewMibTree()
+	}
+	if item, ok := self.mibs.Get(oid).(*OidAndValue); ok {
+		if nil == gen {
+			item.Value = item.ValueAt(time.Now())
+		}
+		item.Dynamic = gen
+		return
+	}
+	if nil != gen {
+		self.mibs.Insert(&OidAndValue{Oid: oid, Value: gen(time.Now()), Dynamic: gen})
+	}
+}
+
+// UpTimeGenerator returns the sysUpTime of the server since it is created
+func (self *UdpServer) UpTimeGenerator() ValueGenerator {
+	return NewUpTimeGenerator(self.created_at)
+}
+
+var valueAnnotation = regexp.MustCompile(`\s+(rate|jitter)=([0-9]*\.?[0-9]+)\s*$`)
+
+// An annotation at the end of a line of the data is the generator of the
+// value, e.g. "rate=100" of a counter or "jitter=5" of a gauge. A TimeTicks
+// of "rate=100" is the sysUpTime since the data is loaded.
+type annotation struct {
+	name  string
+	value float64
+}
+
+// stripAnnotations removes the annotations at the end of the lines, and
+// returns them by the OIDs of the lines.
+func stripAnnotations(text []byte, format MibFormat) ([]byte, map[string]annotation, error) {
+	if MibFormatJSON == format || MibFormatPcap == format || !strings.Contains(string(text), "rate=") && !strings.Contains(string(text), "jitter=") {
+		return text, nil, nil
+	}
+
+	lines := strings.Split(string(text), "\n")
+	var annotations map[string]annotation
+	for idx, line := range lines {
+		m := valueAnnotation.FindStringSubmatchIndex(strings.TrimRight(line, "\r"))
+		if m == nil {
+			continue
+		}
+		value, err := strconv.ParseFloat(line[m[4]:m[5]], 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: %v", idx+1, err)
+		}
+
+		var oid Oid
+		if MibFormatSnmprec == format {
+			oid, err = ParseOidFromString(strings.Trim(strings.TrimSpace(strings.SplitN(line, "|", 2)[0]), "."))
+		} else {
+			oid, err = parseWalkOid(strings.SplitN(line, "=", 2)[0])
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: %v", idx+1, err)
+		}
+
+		if annotations == nil {
+			annotations = map[string]annotation{}
+		}
+		annotations[oid.ToString()] = annotation{name: line[m[2]:m[3]], value: value}
+		lines[idx] = line[:m[0]] + line[m[1]:]
+	}
+	return []byte(strings.Join(lines, "\n")), annotations, nil
+}
+
+// generator returns the generator of the annotation starting at value
+func (a annotation) generator(value Variable) (ValueGenerator, error) {
+	if "jitter" == a.name {
+		return jitterGenerator(value, a.value)
+	}
+	return rateGenerator(value, a.value)
+}
+
+// jitterGenerator returns the generator of the value plus a random jitter
+func jitterGenerator(value Variable, max float64) (ValueGenerator, error) {
+	switch v := value.(type) {
+	case *Gauge32:
+		return NewJitterGauge32Generator(v.Value, uint32(math.Min(max, math.MaxUint32))), nil
+	case *Integer:
+		j := newJitter(max)
+		return func(now time.Time) Variable {
+			return NewInteger(int32(math.Max(math.MinInt32, math.Min(math.MaxInt32, float64(v.Value)+j.next()))))
+		}, nil
+	}
+	return nil, fmt.Errorf("jitter is unsupported for %s", value.String())
+}
+
+// rateGenerator returns the generator of the value increasing rate per second
+func rateGenerator(value Variable, rate float64) (ValueGenerator, error) {
+	switch v := value.(type) {
+	case *Counter32:
+		return NewCounter32Generator(v.Value, rate), nil
+	case *Counter64:
+		return NewCounter64Generator(v.Value, rate), nil
+	case *TimeTicks:
+		g := NewCounter32Generator(v.Value, rate)
+		return func(now time.Time) Variable {
+			return NewTimeTicks(g(now).(*Counter32).Value)
+		}, nil
+	}
+	return nil, fmt.Errorf("rate is unsupported for %s", value.String())
+}
@@ -0,0 +1,109 @@
+package snmpclient2_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/runner-mei/snmpclient2"
+)
+
+func TestGenerators(t *testing.T) {
+	now := time.Now()
+	for _, test := range []struct {
+		gen      snmpclient2.ValueGenerator
+		at       time.Time
+		expected string
+	}{
+		{snmpclient2.NewCounter32Generator(math.MaxUint32-9, 10), now.Add(10*time.Second + 50*time.Millisecond), "[counter32]90"},
+		{snmpclient2.NewCounter64Generator(math.MaxUint64-9, 10), now.Add(10*time.Second + 50*time.Millisecond), "[counter64]90"},
+		{snmpclient2.NewCounter32Generator(7, 100), now.Add(-time.Second), "[counter32]7"},
+		{snmpclient2.NewSineGauge32Generator(0, 100, 4*time.Second), now.Add(time.Second), "[gauge32]100"},
+		{snmpclient2.NewSineGauge32Generator(0, 100, 4*time.Second), now.Add(3 * time.Second), "[gauge32]0"},
+		{snmpclient2.NewUpTimeGenerator(now.Add(-5 * time.Second)), now, "[timeticks]500"},
+		{snmpclient2.NewJitterGauge32Generator(math.MaxUint32, 0), now, "[gauge32]4294967295"},
+	} {
+		if v := test.gen(test.at); v.String() != test.expected {
+			t.Errorf("generator - expected [%s], actual [%s]", test.expected, v.String())
+		}
+	}
+}
+
+func TestUdpServerDynamic(t *testing.T) {
+	mibs := `iso.3.6.1.2.1.2.2.1.10.1 = Counter32: 1000 rate=100000000
+iso.3.6.1.2.1.2.2.1.16.1 = Counter32: 2000
+iso.3.6.1.2.1.2.2.1.5.1 = Gauge32: 100 jitter=5
+iso.3.6.1.2.1.2.2.1.7.1 = INTEGER: 1 jitter=2`
+	srv, err := snmpclient2.NewUdpServerFromString("dynamic", "127.0.0.1:0", mibs, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	inOctets, _ := snmpclient2.ParseOidFromString("1.3.6.1.2.1.2.2.1.10.1")
+	outOctets, _ := snmpclient2.ParseOidFromString("1.3.6.1.2.1.2.2.1.16.1")
+	sysUpTime, _ := snmpclient2.ParseOidFromString("1.3.6.1.2.1.1.3.0")
+	srv.SetDynamic(outOctets, snmpclient2.NewCounter32Generator(2000, 100000000))
+	srv.SetDynamic(sysUpTime, srv.UpTimeGenerator())
+
+	snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:"+srv.GetPort(), snmpclient2.Arguments{
+		Version:   snmpclient2.V2c,
+		Community: "public",
+		Timeout:   time.Second,
+	})
+	defer snmp.Close()
+
+	get := func() snmpclient2.VariableBindings {
+		pdu, err := snmp.GetRequest(snmpclient2.Oids{inOctets, outOctets, sysUpTime})
+		if err != nil {
+			t.Fatalf("GetRequest() - has error %v", err)
+		}
+		return pdu.VariableBindings()
+	}
+
+	first := get()
+	time.Sleep(10 * time.Millisecond)
+	second := get()
+	if len(first) != 3 || len(second) != 3 {
+		t.Fatalf("GetRequest() - expected [3] variables, actual [%d] [%d]", len(first), len(second))
+	}
+	for i := 0; i < 3; i++ {
+		if second[i].Variable.Uint() <= first[i].Variable.Uint() {
+			t.Errorf("GetRequest() - %s is not increasing, [%d] [%d]", first[i].Oid.ToString(),
+				first[i].Variable.Uint(), second[i].Variable.Uint())
+		}
+	}
+
+	// the values of a request are generated at the same time
+	pdu, err := snmp.GetRequest(snmpclient2.Oids{inOctets, inOctets})
+	if err != nil {
+		t.Fatalf("GetRequest() - has error %v", err)
+	}
+	if vbs := pdu.VariableBindings(); len(vbs) != 2 || vbs[0].Variable.Uint() != vbs[1].Variable.Uint() {
+		t.Errorf("GetRequest() - expected the same values, actual [%v]", vbs)
+	}
+
+	// the values with jitter are around the loaded ones
+	jittered := snmpclient2.MustParseOids("1.3.6.1.2.1.2.2.1.5.1", "1.3.6.1.2.1.2.2.1.7.1")
+	for i := 0; i < 20; i++ {
+		pdu, err = snmp.GetRequest(jittered)
+		if err != nil {
+			t.Fatalf("GetRequest() - has error %v", err)
+		}
+		vbs := pdu.VariableBindings()
+		if len(vbs) != 2 || vbs[0].Variable.Uint() < 95 || vbs[0].Variable.Uint() > 105 ||
+			vbs[1].Variable.Int() < -1 || vbs[1].Variable.Int() > 3 {
+			t.Fatalf("GetRequest() - expected the values with jitter, actual [%v]", vbs)
+		}
+	}
+
+	for _, text := range []string{
+		`iso.3.6.1.2.1.1.5.0 = STRING: "x" rate=1`,
+		`iso.3.6.1.2.1.1.5.0 = STRING: "x" jitter=1`,
+		`iso.3.6.1.2.1.2.2.1.10.1 = Counter32: 1000 jitter=1`,
+	} {
+		if _, err = snmpclient2.NewUdpServerFromString("dynamic", "127.0.0.1:0", text, false); err == nil {
+			t.Errorf("NewUdpServerFromString(%s) - expected an error of the generator", text)
+		}
+	}
+}
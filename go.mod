@@ -0,0 +1,3 @@
+module github.com/runner-mei/snmpclient2
+
+go 1.20
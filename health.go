@@ -0,0 +1,115 @@
+package snmpclient2
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// HealthStatus classifies the result of HealthCheck
+type HealthStatus string
+
+const (
+	HealthOK          HealthStatus = "ok"           // the agent answered
+	HealthTimeout     HealthStatus = "timeout"      // the agent is unreachable or ignores the community
+	HealthAuthFailure HealthStatus = "auth_failure" // the agent rejected the credentials (V3 specific)
+	HealthDecodeError HealthStatus = "decode_error" // the response could not be decoded
+	HealthError       HealthStatus = "error"        // any other failure
+)
+
+// HealthState is the result of HealthCheck, it is meant to be persisted
+// by the caller and passed to the next check.
+type HealthState struct {
+	Status      HealthStatus  `json:"status"`
+	SysUpTime   uint32        `json:"sys_up_time"`            // sysUpTime.0 in hundredths of a second
+	EngineBoots int64         `json:"engine_boots,omitempty"` // snmpEngineBoots.0 (V3 specific)
+	Rebooted    bool          `json:"rebooted"`               // the agent restarted since the previous state
+	Latency     time.Duration `json:"latency"`
+	CheckedAt   time.Time     `json:"checked_at"`
+	Error       string        `json:"error,omitempty"`
+}
+
+// HealthCheck sends one request for sysUpTime.0 (and snmpEngineBoots.0 for V3)
+// within HealthTimeout, and compares the answer with prev to detect a reboot.
+// The returned error is the cause of a Status other than HealthOK.
+func (s *SNMP) HealthCheck(prev HealthState) (state HealthState, err error) {
+	return s.HealthCheckContext(context.Background(), prev)
+}
+
+// HealthCheckContext is HealthCheck that aborts when ctx is done, the
+// HealthTimeout still applies
+func (s *SNMP) HealthCheckContext(ctx context.Context, prev HealthState) (state HealthState, err error) {
+	ctx, cancel := context.WithTimeout(ctx, s.args.HealthTimeout)
+	defer cancel()
+
+	oids := Oids{OidSysUpTime}
+	if s.args.Version == V3 {
+		oids = append(oids, OidSnmpEngineBoots)
+	}
+
+	state.CheckedAt = time.Now()
+	pdu, info, err := s.request(ctx, NewPduWithOids(s.args.Version, GetRequest, oids))
+	state.Latency = info.Elapsed
+	if err == nil && pdu.ErrorStatus() != NoError {
+		err = ResponseError{
+			Message: "Failed to get sysUpTime - " + pdu.ErrorStatus().String(),
+			Detail:  "PDU - " + pdu.String(),
+		}
+	}
+	if err == nil {
+		vb := pdu.VariableBindings().MatchOid(OidSysUpTime)
+		if vb == nil || vb.Variable.IsError() {
+			err = ResponseError{
+				Message: "sysUpTime is not available",
+				Detail:  "PDU - " + pdu.String(),
+			}
+		} else {
+			state.SysUpTime = uint32(vb.Variable.Uint())
+		}
+	}
+	if err != nil {
+		state.Status = classifyHealth(err)
+		state.Error = err.Error()
+		// keep the last known values so that the next check can compare
+		state.SysUpTime = prev.SysUpTime
+		state.EngineBoots = prev.EngineBoots
+		return state, err
+	}
+
+	if vb := pdu.VariableBindings().MatchOid(OidSnmpEngineBoots); vb != nil && !vb.Variable.IsError() {
+		state.EngineBoots = vb.Variable.Int()
+	} else if usm, ok := s.mp.Security().(*USM); ok {
+		state.EngineBoots = usm.AuthEngineBoots
+	}
+
+	state.Status = HealthOK
+	if !prev.CheckedAt.IsZero() {
+		state.Rebooted = state.SysUpTime < prev.SysUpTime ||
+			(prev.EngineBoots > 0 && state.EngineBoots > prev.EngineBoots)
+	}
+	return state, nil
+}
+
+func classifyHealth(err error) HealthStatus {
+	switch e := err.(type) {
+	case net.Error:
+		if e.Timeout() {
+			return HealthTimeout
+		}
+	case ResponseError:
+		switch reportStatusOid(e.Report) {
+		case usmStatsUnsupportedSecLevels, usmStatsUnknownUserNames,
+			usmStatsWrongDigests, usmStatsDecryptionErrors:
+			return HealthAuthFailure
+		}
+		if e.Cause == context.DeadlineExceeded {
+			return HealthTimeout
+		}
+		if e.Cause != nil {
+			return HealthDecodeError
+		}
+	case EngineIdMismatchError:
+		return HealthAuthFailure
+	}
+	return HealthError
+}
@@ -0,0 +1,89 @@
+package snmpclient2_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/runner-mei/snmpclient2"
+)
+
+func TestHealthCheck(t *testing.T) {
+	mibs := map[string]snmpclient2.Variable{
+		"1.3.6.1.2.1.1.3.0": snmpclient2.NewTimeTicks(1000),
+	}
+	snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:161", snmpclient2.Arguments{
+		Version:   snmpclient2.V2c,
+		Community: "public",
+		Dialer:    newMemDialer(memAgent(t, mibs)),
+	})
+	defer snmp.Close()
+
+	state, err := snmp.HealthCheck(snmpclient2.HealthState{})
+	if err != nil {
+		t.Fatalf("HealthCheck() - has error %v", err)
+	}
+	if state.Status != snmpclient2.HealthOK || state.SysUpTime != 1000 || state.Rebooted {
+		t.Errorf("HealthCheck() - unexpected state %+v", state)
+	}
+
+	// the state survives persistence
+	b, err := json.Marshal(state)
+	if err != nil {
+		t.Fatalf("json.Marshal() - has error %v", err)
+	}
+	var prev snmpclient2.HealthState
+	if err = json.Unmarshal(b, &prev); err != nil {
+		t.Fatalf("json.Unmarshal() - has error %v", err)
+	}
+
+	mibs["1.3.6.1.2.1.1.3.0"] = snmpclient2.NewTimeTicks(2000)
+	state, _ = snmp.HealthCheck(prev)
+	if state.Status != snmpclient2.HealthOK || state.Rebooted {
+		t.Errorf("HealthCheck() - unexpected state %+v", state)
+	}
+
+	mibs["1.3.6.1.2.1.1.3.0"] = snmpclient2.NewTimeTicks(10)
+	state, _ = snmp.HealthCheck(state)
+	if !state.Rebooted {
+		t.Errorf("HealthCheck() - expected a reboot, actual %+v", state)
+	}
+}
+
+func TestHealthCheckFailure(t *testing.T) {
+	snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:161", snmpclient2.Arguments{
+		Version:       snmpclient2.V2c,
+		Community:     "public",
+		Timeout:       10 * time.Second,
+		HealthTimeout: 50 * time.Millisecond,
+		Dialer:        newMemDialer(func([]byte) [][]byte { return nil }),
+	})
+	defer snmp.Close()
+
+	start := time.Now()
+	prev := snmpclient2.HealthState{SysUpTime: 1000, CheckedAt: start}
+	state, err := snmp.HealthCheck(prev)
+	if err == nil || state.Status != snmpclient2.HealthTimeout {
+		t.Errorf("HealthCheck() - expected [%s], actual [%s] %v", snmpclient2.HealthTimeout, state.Status, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("HealthCheck() - ignored HealthTimeout, elapsed [%s]", elapsed)
+	}
+	if state.SysUpTime != 1000 {
+		t.Errorf("HealthCheck() - expected [%d], actual [%d]", 1000, state.SysUpTime)
+	}
+
+	snmp, _ = snmpclient2.NewSNMP("udp", "127.0.0.1:161", snmpclient2.Arguments{
+		Version:   snmpclient2.V2c,
+		Community: "public",
+		Dialer: newMemDialer(func([]byte) [][]byte {
+			return [][]byte{{0x30, 0x03, 0x02, 0x01}}
+		}),
+	})
+	defer snmp.Close()
+
+	state, err = snmp.HealthCheck(prev)
+	if err == nil || state.Status != snmpclient2.HealthDecodeError {
+		t.Errorf("HealthCheck() - expected [%s], actual [%s] %v", snmpclient2.HealthDecodeError, state.Status, err)
+	}
+}
@@ -0,0 +1,162 @@
+package snmpclient2
+
+import (
+	"fmt"
+	"net"
+)
+
+// IndexKind describes how a component of a table index is encoded in the
+// sub-identifiers (RFC2578 Section 7.7)
+type IndexKind int
+
+const (
+	IndexKindInt           IndexKind = iota // an INTEGER or Unsigned32, one sub-identifier
+	IndexKindString                         // an OCTET STRING, length-prefixed
+	IndexKindImpliedString                  // an IMPLIED OCTET STRING, the remaining sub-identifiers
+	IndexKindIPAddress                      // an IpAddress, four sub-identifiers
+	IndexKindOid                            // an OBJECT IDENTIFIER, length-prefixed
+)
+
+func (k IndexKind) String() string {
+	switch k {
+	case IndexKindInt:
+		return "Int"
+	case IndexKindString:
+		return "String"
+	case IndexKindImpliedString:
+		return "ImpliedString"
+	case IndexKindIPAddress:
+		return "IPAddress"
+	case IndexKindOid:
+		return "Oid"
+	default:
+		return "Unknown"
+	}
+}
+
+// IndexAfter returns the sub-identifiers following prefix, e.g. the index
+// of an instance of the column prefix
+func (v *Oid) IndexAfter(prefix Oid) (Oid, error) {
+	if !v.Contains(&prefix) {
+		return Oid{}, ArgumentError{
+			Value:   v.ToString(),
+			Message: fmt.Sprintf("Oid is not under %s", prefix.ToString()),
+		}
+	}
+	return NewOid(v.Value[len(prefix.Value):]), nil
+}
+
+// IndexInt consumes an integer from the head of the index, and returns
+// the remaining sub-identifiers
+func (v *Oid) IndexInt() (int, Oid, error) {
+	if len(v.Value) < 1 {
+		return 0, Oid{}, indexError(v, IndexKindInt, "index is truncated")
+	}
+	return v.Value[0], NewOid(v.Value[1:]), nil
+}
+
+// IndexString consumes an octet string from the head of the index, the
+// string is length-prefixed unless implied (then it takes the remaining
+// sub-identifiers)
+func (v *Oid) IndexString(implied bool) (string, Oid, error) {
+	kind, subs := IndexKindImpliedString, v.Value
+	if !implied {
+		kind = IndexKindString
+		if len(subs) < 1 {
+			return "", Oid{}, indexError(v, kind, "index is truncated")
+		}
+		l := subs[0]
+		if l < 0 || l > len(subs)-1 {
+			return "", Oid{}, indexError(v, kind,
+				fmt.Sprintf("length %d exceeds the remaining %d sub-identifiers", l, len(subs)-1))
+		}
+		subs = subs[1 : 1+l]
+	}
+
+	b := make([]byte, len(subs))
+	for i, sub := range subs {
+		if sub < 0 || sub > 255 {
+			return "", Oid{}, indexError(v, kind, fmt.Sprintf("sub-identifier %d is not an octet", sub))
+		}
+		b[i] = byte(sub)
+	}
+	if implied {
+		return string(b), Oid{}, nil
+	}
+	return string(b), NewOid(v.Value[1+len(subs):]), nil
+}
+
+// IndexIPAddress consumes an IpAddress from the head of the index
+func (v *Oid) IndexIPAddress() (net.IP, Oid, error) {
+	if len(v.Value) < net.IPv4len {
+		return nil, Oid{}, indexError(v, IndexKindIPAddress, "index is truncated")
+	}
+	ip := make(net.IP, net.IPv4len)
+	for i, sub := range v.Value[:net.IPv4len] {
+		if sub < 0 || sub > 255 {
+			return nil, Oid{}, indexError(v, IndexKindIPAddress,
+				fmt.Sprintf("sub-identifier %d is not an octet", sub))
+		}
+		ip[i] = byte(sub)
+	}
+	return ip, NewOid(v.Value[net.IPv4len:]), nil
+}
+
+// IndexOid consumes a length-prefixed OBJECT IDENTIFIER from the head of the index
+func (v *Oid) IndexOid() (Oid, Oid, error) {
+	if len(v.Value) < 1 {
+		return Oid{}, Oid{}, indexError(v, IndexKindOid, "index is truncated")
+	}
+	l := v.Value[0]
+	if l < 0 || l > len(v.Value)-1 {
+		return Oid{}, Oid{}, indexError(v, IndexKindOid,
+			fmt.Sprintf("length %d exceeds the remaining %d sub-identifiers", l, len(v.Value)-1))
+	}
+	return NewOid(append([]int(nil), v.Value[1:1+l]...)), NewOid(v.Value[1+l:]), nil
+}
+
+// DecodeIndex decodes the index by spec, the values are int, string, net.IP
+// and Oid for the kinds. All of the sub-identifiers must be consumed.
+func (v *Oid) DecodeIndex(spec ...IndexKind) ([]interface{}, error) {
+	values := make([]interface{}, 0, len(spec))
+	rest := *v
+	for i, kind := range spec {
+		var value interface{}
+		var err error
+		switch kind {
+		case IndexKindInt:
+			value, rest, err = rest.IndexInt()
+		case IndexKindString:
+			value, rest, err = rest.IndexString(false)
+		case IndexKindImpliedString:
+			if i != len(spec)-1 {
+				return nil, ArgumentError{Value: spec, Message: "IMPLIED is only allowed for the last component"}
+			}
+			value, rest, err = rest.IndexString(true)
+		case IndexKindIPAddress:
+			value, rest, err = rest.IndexIPAddress()
+		case IndexKindOid:
+			value, rest, err = rest.IndexOid()
+		default:
+			return nil, ArgumentError{Value: kind, Message: "Unknown IndexKind"}
+		}
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	if len(rest.Value) != 0 {
+		return nil, ArgumentError{
+			Value:   v.ToString(),
+			Message: fmt.Sprintf("Failed to decode index - %d sub-identifiers are left", len(rest.Value)),
+		}
+	}
+	return values, nil
+}
+
+func indexError(v *Oid, kind IndexKind, message string) error {
+	return ArgumentError{
+		Value:   v.ToString(),
+		Message: fmt.Sprintf("Failed to decode %s index - %s", kind, message),
+	}
+}
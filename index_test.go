@@ -0,0 +1,61 @@
+package snmpclient2_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/runner-mei/snmpclient2"
+)
+
+func TestDecodeIndex(t *testing.T) {
+	// ipNetToMediaPhysAddress.<ifIndex>.<ipAddress>
+	oid, _ := snmpclient2.ParseOidFromString("1.3.6.1.2.1.4.22.1.2.3.192.168.1.10")
+	column, _ := snmpclient2.ParseOidFromString("1.3.6.1.2.1.4.22.1.2")
+	index, err := oid.IndexAfter(column)
+	if err != nil {
+		t.Fatalf("IndexAfter() - has error %v", err)
+	}
+	values, err := index.DecodeIndex(snmpclient2.IndexKindInt, snmpclient2.IndexKindIPAddress)
+	if err != nil {
+		t.Fatalf("DecodeIndex() - has error %v", err)
+	}
+	if values[0].(int) != 3 || !values[1].(net.IP).Equal(net.IPv4(192, 168, 1, 10)) {
+		t.Errorf("DecodeIndex() - unexpected values %v", values)
+	}
+
+	// a length-prefixed string followed by an implied string
+	index, _ = snmpclient2.ParseOidFromString("2.97.98.99.100")
+	values, err = index.DecodeIndex(snmpclient2.IndexKindString, snmpclient2.IndexKindImpliedString)
+	if err != nil {
+		t.Fatalf("DecodeIndex() - has error %v", err)
+	}
+	if values[0].(string) != "ab" || values[1].(string) != "cd" {
+		t.Errorf("DecodeIndex() - unexpected values %v", values)
+	}
+
+	s, rest, err := index.IndexString(false)
+	if err != nil || s != "ab" || rest.ToString() != "99.100" {
+		t.Errorf("IndexString() - unexpected [%s] [%s] %v", s, rest.ToString(), err)
+	}
+
+	// truncated and malformed indices
+	for _, test := range []struct {
+		index string
+		spec  []snmpclient2.IndexKind
+	}{
+		{"5.97.98", []snmpclient2.IndexKind{snmpclient2.IndexKindString}},
+		{"192.168.1", []snmpclient2.IndexKind{snmpclient2.IndexKindIPAddress}},
+		{"1.2", []snmpclient2.IndexKind{snmpclient2.IndexKindInt}},
+		{"1.256", []snmpclient2.IndexKind{snmpclient2.IndexKindInt, snmpclient2.IndexKindImpliedString}},
+		{"1", []snmpclient2.IndexKind{snmpclient2.IndexKindImpliedString, snmpclient2.IndexKindInt}},
+	} {
+		index, _ = snmpclient2.ParseOidFromString(test.index)
+		if _, err = index.DecodeIndex(test.spec...); err == nil {
+			t.Errorf("DecodeIndex(%s) - no error for %v", test.index, test.spec)
+		}
+	}
+
+	if _, err = oid.IndexAfter(snmpclient2.OidSysUpTime); err == nil {
+		t.Error("IndexAfter() - no error for an unrelated prefix")
+	}
+}
@@ -0,0 +1,306 @@
+package snmpclient2
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+)
+
+// jsonVariableBinding is the JSON form of a VariableBinding, e.g.
+//
+//	{"oid":"1.3.6.1.2.1.1.1.0","type":"OctetString","value":"Linux host"}
+//
+// An OctetString which is not printable UTF-8 is in hex with "encoding".
+type jsonVariableBinding struct {
+	Oid      string          `json:"oid"`
+	Type     string          `json:"type"`
+	Value    json.RawMessage `json:"value,omitempty"`
+	Encoding string          `json:"encoding,omitempty"`
+}
+
+// VariableTypeName returns the name of the type of the variable in JSON
+func VariableTypeName(v Variable) string {
+	switch v.(type) {
+	case *Integer:
+		return "Integer"
+	case *Ipaddress:
+		return "IpAddress"
+	case *Opaque:
+		return "Opaque"
+	case *OctetString:
+		return "OctetString"
+	case *Null:
+		return "Null"
+	case *Oid:
+		return "Oid"
+	case *Counter32:
+		return "Counter32"
+	case *Gauge32:
+		return "Gauge32"
+	case *TimeTicks:
+		return "TimeTicks"
+	case *Counter64:
+		return "Counter64"
+	case *Float:
+		return "Float"
+	case *Double:
+		return "Double"
+	case *NoSucheObject:
+		return "NoSuchObject"
+	case *NoSucheInstance:
+		return "NoSuchInstance"
+	case *EndOfMibView:
+		return "EndOfMibView"
+	}
+	return ""
+}
+
+// MarshalJSON encodes the variable binding as an object of "oid", "type"
+// and "value", the Counter64 is a string to keep the precision.
+func (v VariableBinding) MarshalJSON() ([]byte, error) {
+	if v.Variable == nil {
+		return nil, fmt.Errorf("variable of '%s' is nil", v.Oid.ToString())
+	}
+	jv := jsonVariableBinding{Oid: v.Oid.ToString(), Type: VariableTypeName(v.Variable)}
+
+	var value interface{}
+	switch t := v.Variable.(type) {
+	case *Integer:
+		value = t.Value
+	case *Ipaddress:
+		value = t.ToString()
+	case *Opaque:
+		value = hex.EncodeToString(t.Value)
+	case *OctetString:
+		if isPrintable(t.Value) {
+			value = string(t.Value)
+		} else {
+			value, jv.Encoding = hex.EncodeToString(t.Value), "hex"
+		}
+	case *Oid:
+		value = t.ToString()
+	case *Counter32:
+		value = t.Value
+	case *Gauge32:
+		value = t.Value
+	case *TimeTicks:
+		value = t.Value
+	case *Counter64:
+		value = strconv.FormatUint(t.Value, 10)
+	case *Float:
+		value = jsonFloat(float64(t.Value), 32)
+	case *Double:
+		value = jsonFloat(t.Value, 64)
+	case *Null, *NoSucheObject, *NoSucheInstance, *EndOfMibView:
+	default:
+		return nil, fmt.Errorf("variable of '%s' is unsupported - %T", v.Oid.ToString(), v.Variable)
+	}
+	if value != nil {
+		b, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		jv.Value = b
+	}
+	return json.Marshal(jv)
+}
+
+// UnmarshalJSON decodes the object of MarshalJSON, a Counter64 is either a
+// string or a number.
+func (v *VariableBinding) UnmarshalJSON(b []byte) error {
+	var jv jsonVariableBinding
+	if err := json.Unmarshal(b, &jv); err != nil {
+		return err
+	}
+	oid, err := ParseOidFromString(jv.Oid)
+	if err != nil {
+		return err
+	}
+	variable, err := jv.variable()
+	if err != nil {
+		return fmt.Errorf("value of '%s' is invalid - %v", jv.Oid, err)
+	}
+	v.Oid = oid
+	v.Variable = variable
+	return nil
+}
+
+func (jv *jsonVariableBinding) variable() (Variable, error) {
+	switch jv.Type {
+	case "Null":
+		return NewNull(), nil
+	case "NoSuchObject":
+		return NewNoSucheObject(), nil
+	case "NoSuchInstance":
+		return NewNoSucheInstance(), nil
+	case "EndOfMibView":
+		return NewEndOfMibView(), nil
+	}
+	if len(jv.Value) == 0 {
+		return nil, fmt.Errorf("value of %s is missing", jv.Type)
+	}
+
+	var s string
+	switch jv.Type {
+	case "Integer":
+		var i int32
+		err := json.Unmarshal(jv.Value, &i)
+		return NewInteger(i), err
+	case "Counter32", "Gauge32", "TimeTicks":
+		var u uint32
+		if err := json.Unmarshal(jv.Value, &u); err != nil {
+			return nil, err
+		}
+		switch jv.Type {
+		case "Counter32":
+			return NewCounter32(u), nil
+		case "Gauge32":
+			return NewGauge32(u), nil
+		}
+		return NewTimeTicks(u), nil
+	case "Counter64", "Float", "Double":
+		// a string or a number
+		if err := json.Unmarshal(jv.Value, &s); err != nil {
+			s = string(jv.Value)
+		}
+		if jv.Type == "Counter64" {
+			u, err := strconv.ParseUint(s, 10, 64)
+			return NewCounter64(u), err
+		}
+		if jv.Type == "Float" {
+			f, err := strconv.ParseFloat(s, 32)
+			return NewFloat(float32(f)), err
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		return NewDouble(f), err
+	}
+
+	if err := json.Unmarshal(jv.Value, &s); err != nil {
+		return nil, err
+	}
+	switch jv.Type {
+	case "OctetString":
+		if jv.Encoding == "hex" {
+			return NewOctetStringFromString(s)
+		}
+		return NewOctetString([]byte(s)), nil
+	case "Opaque":
+		return NewOpaqueFromString(s)
+	case "IpAddress":
+		return NewIPAddressFromString(s)
+	case "Oid":
+		return NewOidFromString(s)
+	}
+	return nil, fmt.Errorf("type '%s' is unsupported", jv.Type)
+}
+
+// isPrintable returns true if b is the UTF-8 text without the control
+// characters except the white spaces
+func isPrintable(b []byte) bool {
+	if !utf8.Valid(b) {
+		return false
+	}
+	for _, r := range string(b) {
+		if !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// jsonFloat returns f, or a string if f is not a JSON number
+func jsonFloat(f float64, bitSize int) interface{} {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return strconv.FormatFloat(f, 'g', -1, bitSize)
+	}
+	if bitSize == 32 {
+		return float32(f)
+	}
+	return f
+}
+
+// MarshalJSON encodes the PDU with the variable bindings of
+// VariableBinding.MarshalJSON
+func (pdu *PduV1) MarshalJSON() ([]byte, error) {
+	variableBindings := pdu.variableBindings
+	if variableBindings == nil {
+		variableBindings = VariableBindings{}
+	}
+	return json.Marshal(struct {
+		PduType          string           `json:"type"`
+		RequestId        int              `json:"request_id"`
+		ErrorStatus      string           `json:"error_status"`
+		ErrorIndex       int              `json:"error_index"`
+		VariableBindings VariableBindings `json:"variable_bindings"`
+	}{pdu.pduType.String(), pdu.requestId, pdu.ErrorStatus().String(), pdu.errorIndex, variableBindings})
+}
+
+// UnmarshalJSON decodes the object of MarshalJSON
+func (pdu *PduV1) UnmarshalJSON(b []byte) error {
+	var jp struct {
+		PduType          string           `json:"type"`
+		RequestId        int              `json:"request_id"`
+		ErrorStatus      string           `json:"error_status"`
+		ErrorIndex       int              `json:"error_index"`
+		VariableBindings VariableBindings `json:"variable_bindings"`
+	}
+	if err := json.Unmarshal(b, &jp); err != nil {
+		return err
+	}
+
+	pduType := PduType(-1)
+	for t := GetRequest; t <= Report; t++ {
+		if t.String() == jp.PduType {
+			pduType = t
+			break
+		}
+	}
+	if pduType < 0 {
+		return fmt.Errorf("type '%s' of pdu is unsupported", jp.PduType)
+	}
+	errorStatus := NoError
+	if jp.ErrorStatus != "" {
+		errorStatus = ErrorStatus(-1)
+		for e := NoError; e <= InconsistentName; e++ {
+			if e.String() == jp.ErrorStatus {
+				errorStatus = e
+				break
+			}
+		}
+		if errorStatus < 0 {
+			return fmt.Errorf("error status '%s' of pdu is unsupported", jp.ErrorStatus)
+		}
+	}
+
+	pdu.pduType = pduType
+	pdu.requestId = jp.RequestId
+	pdu.errorStatus = errorStatus
+	pdu.errorIndex = jp.ErrorIndex
+	pdu.variableBindings = jp.VariableBindings
+	return nil
+}
+
+// ReadJSON reads the JSON array of the variable bindings, which is the
+// output of json.Marshal of VariableBindings.
+func ReadJSON(reader io.Reader, cb func(oid Oid, value Variable) error) error {
+	var variableBindings VariableBindings
+	if err := json.NewDecoder(reader).Decode(&variableBindings); err != nil {
+		return err
+	}
+	for _, vb := range variableBindings {
+		if err := cb(vb.Oid, vb.Variable); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isJSONArray(text []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(text), []byte("["))
+}
@@ -0,0 +1,134 @@
+package snmpclient2_test
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/runner-mei/snmpclient2"
+)
+
+func TestVariableBindingJSON(t *testing.T) {
+	oid := snmpclient2.MustParseOidFromString("1.3.6.1.2.1.1.1.0")
+	for _, test := range []struct {
+		variable snmpclient2.Variable
+		expected string
+	}{
+		{snmpclient2.NewInteger(-2147483648), `"type":"Integer","value":-2147483648`},
+		{snmpclient2.NewOctetString([]byte("Linux host")), `"type":"OctetString","value":"Linux host"`},
+		{snmpclient2.NewOctetString([]byte("\"quoted\"\n")), `"type":"OctetString","value":"\"quoted\"\n"`},
+		{snmpclient2.NewOctetString([]byte{0x00, 0x1b, 0x21, 0xff}), `"type":"OctetString","value":"001b21ff","encoding":"hex"`},
+		{snmpclient2.NewOctetString([]byte{}), `"type":"OctetString","value":""`},
+		{snmpclient2.NewNull(), `"type":"Null"`},
+		{oidPtr(snmpclient2.MustParseOidFromString("1.3.6.1.4.1.9")), `"type":"Oid","value":"1.3.6.1.4.1.9"`},
+		{snmpclient2.NewIpaddress(192, 168, 0, 1), `"type":"IpAddress","value":"192.168.0.1"`},
+		{snmpclient2.NewCounter32(math.MaxUint32), `"type":"Counter32","value":4294967295`},
+		{snmpclient2.NewGauge32(0), `"type":"Gauge32","value":0`},
+		{snmpclient2.NewTimeTicks(123456), `"type":"TimeTicks","value":123456`},
+		{snmpclient2.NewOpaque([]byte{0x01, 0x02}), `"type":"Opaque","value":"0102"`},
+		{snmpclient2.NewFloat(1.5), `"type":"Float","value":1.5`},
+		{snmpclient2.NewDouble(math.Inf(-1)), `"type":"Double","value":"-Inf"`},
+		{snmpclient2.NewCounter64(math.MaxUint64), `"type":"Counter64","value":"18446744073709551615"`},
+		{snmpclient2.NewNoSucheObject(), `"type":"NoSuchObject"`},
+		{snmpclient2.NewNoSucheInstance(), `"type":"NoSuchInstance"`},
+		{snmpclient2.NewEndOfMibView(), `"type":"EndOfMibView"`},
+	} {
+		b, err := json.Marshal(snmpclient2.NewVarBind(oid, test.variable))
+		if err != nil {
+			t.Errorf("Marshal(%s) - has error %v", test.variable, err)
+			continue
+		}
+		if expected := `{"oid":"1.3.6.1.2.1.1.1.0",` + test.expected + `}`; string(b) != expected {
+			t.Errorf("Marshal(%s) - expected [%s], actual [%s]", test.variable, expected, b)
+		}
+
+		var vb snmpclient2.VariableBinding
+		if err = json.Unmarshal(b, &vb); err != nil {
+			t.Errorf("Unmarshal(%s) - has error %v", b, err)
+			continue
+		}
+		if !vb.Oid.Equal(&oid) || vb.Variable.String() != test.variable.String() {
+			t.Errorf("Unmarshal(%s) - expected [%s], actual [%s]", b, test.variable, vb.Variable)
+		}
+	}
+
+	var vb snmpclient2.VariableBinding
+	if err := json.Unmarshal([]byte(`{"oid":"1.3.6.1.2.1.31.1.1.1.6.1","type":"Counter64","value":12345}`), &vb); err != nil ||
+		vb.Variable.Uint() != 12345 {
+		t.Errorf("Unmarshal() - expected a Counter64 of a number, actual %v %v", vb.Variable, err)
+	}
+	for _, s := range []string{
+		`{"oid":"1.3.6.1","type":"Integer","value":"1"}`,
+		`{"oid":"1.3.6.1","type":"Integer","value":2147483648}`,
+		`{"oid":"1.3.6.1","type":"Counter32"}`,
+		`{"oid":"1.3.6.1","type":"IpAddress","value":"::1"}`,
+		`{"oid":"1.3.6.1","type":"Unknown","value":1}`,
+		`{"oid":"a.b","type":"Null"}`,
+	} {
+		if err := json.Unmarshal([]byte(s), &vb); err == nil {
+			t.Errorf("Unmarshal(%s) - expected an error", s)
+		}
+	}
+}
+
+func oidPtr(oid snmpclient2.Oid) *snmpclient2.Oid {
+	return &oid
+}
+
+func TestPduJSON(t *testing.T) {
+	pdu := snmpclient2.NewPdu(snmpclient2.V2c, snmpclient2.GetResponse)
+	pdu.SetRequestId(7)
+	pdu.AppendVariableBinding(snmpclient2.MustParseOidFromString("1.3.6.1.2.1.1.5.0"),
+		snmpclient2.NewOctetString([]byte("router")))
+	b, err := json.Marshal(pdu)
+	if err != nil {
+		t.Fatalf("Marshal() - has error %v", err)
+	}
+	expected := `{"type":"GetResponse","request_id":7,"error_status":"NoError","error_index":0,` +
+		`"variable_bindings":[{"oid":"1.3.6.1.2.1.1.5.0","type":"OctetString","value":"router"}]}`
+	if string(b) != expected {
+		t.Errorf("Marshal() - expected [%s], actual [%s]", expected, b)
+	}
+
+	var decoded snmpclient2.PduV1
+	if err = json.Unmarshal(b, &decoded); err != nil {
+		t.Fatalf("Unmarshal() - has error %v", err)
+	}
+	if decoded.String() != pdu.String() {
+		t.Errorf("Unmarshal() - expected [%s], actual [%s]", pdu.String(), decoded.String())
+	}
+
+	for _, text := range []string{
+		`{"type":"Response","variable_bindings":[]}`,
+		`{"type":"GetResponse","error_status":"Bad","variable_bindings":[]}`,
+		`{"type":"GetResponse","variable_bindings":[{"oid":"1.3","type":"Counter32","value":-1}]}`,
+	} {
+		if err = json.Unmarshal([]byte(text), &decoded); err == nil {
+			t.Errorf("Unmarshal(%s) - expected an error", text)
+		}
+	}
+}
+
+func TestUdpServerJSON(t *testing.T) {
+	srv, err := snmpclient2.NewUdpServerFromString("json", "127.0.0.1:0", `[
+  {"oid":"1.3.6.1.2.1.1.1.0","type":"OctetString","value":"JSON agent"},
+  {"oid":"1.3.6.1.2.1.1.3.0","type":"TimeTicks","value":100}
+]`, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:"+srv.GetPort(), snmpclient2.Arguments{
+		Version: snmpclient2.V2c, Community: "public", Timeout: time.Second})
+	defer snmp.Close()
+	pdu, err := snmp.GetRequest(snmpclient2.MustParseOids("1.3.6.1.2.1.1.1.0", "1.3.6.1.2.1.1.3.0"))
+	if err != nil {
+		t.Fatalf("GetRequest() - has error %v", err)
+	}
+	vbs := pdu.VariableBindings()
+	if len(vbs) != 2 || vbs[0].AsString() != "JSON agent" || vbs[1].Variable.Uint() != 100 {
+		t.Errorf("GetRequest() - expected the data of the JSON, actual %v", vbs)
+	}
+}
@@ -0,0 +1,136 @@
+package snmpclient2
+
+import (
+	"fmt"
+
+	"github.com/runner-mei/snmpclient2/asn1"
+)
+
+// splitTLV splits the head TLV of b to the header and the contents, the
+// length is clamped to the available bytes if it exceeds them.
+func splitTLV(b []byte) (header []byte, contents []byte, rest []byte, clamped bool, err error) {
+	if len(b) < 2 {
+		return nil, nil, nil, false, asn1.SyntaxError{Msg: "data truncated"}
+	}
+	if b[0]&0x1f == 0x1f {
+		return nil, nil, nil, false, asn1.StructuralError{Msg: "multi-byte tag is unsupported"}
+	}
+
+	offset, length := 2, int(b[1])
+	if length&0x80 != 0 {
+		n := length & 0x7f
+		if 0 == n || n > 4 {
+			return nil, nil, nil, false, asn1.StructuralError{Msg: "invalid length"}
+		}
+		if len(b) < 2+n {
+			return nil, nil, nil, false, asn1.SyntaxError{Msg: "data truncated"}
+		}
+		length = 0
+		for _, c := range b[2 : 2+n] {
+			length = length<<8 | int(c)
+		}
+		offset += n
+	}
+	if length < 0 || offset+length > len(b) {
+		length = len(b) - offset
+		clamped = true
+	}
+	return b[:offset], b[offset : offset+length], b[offset+length:], clamped, nil
+}
+
+// joinTLV encodes the TLV of the tag of the header and the contents
+func joinTLV(header, contents []byte) []byte {
+	b := make([]byte, 0, 6+len(contents))
+	b = appendHeader(b, header[0], len(contents))
+	return append(b, contents...)
+}
+
+// clampTLV returns b whose head TLV is clamped to the available bytes, b is
+// returned as is if it is well formed or is unable to parse.
+func clampTLV(b []byte) []byte {
+	header, contents, _, clamped, err := splitTLV(b)
+	if err != nil || !clamped {
+		return b
+	}
+	return joinTLV(header, contents)
+}
+
+// normalizeTLV returns the head TLV of b and the rest, the length of the TLV
+// is clamped and the redundant leading octets of an integer are removed.
+func normalizeTLV(b []byte) (tlv []byte, rest []byte, err error) {
+	header, contents, rest, clamped, err := splitTLV(b)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch header[0] {
+	case asn1.TagInteger, asn1.TagCounter32, asn1.TagGauge32, asn1.TagTimeticks, asn1.TagCounter64:
+		stripped := contents
+		for len(stripped) > 1 &&
+			((stripped[0] == 0x00 && stripped[1]&0x80 == 0) ||
+				(stripped[0] == 0xff && stripped[1]&0x80 != 0)) {
+			stripped = stripped[1:]
+		}
+		if len(stripped) != len(contents) {
+			return joinTLV(header, stripped), rest, nil
+		}
+	}
+	if clamped {
+		return joinTLV(header, contents), rest, nil
+	}
+	return b[:len(b)-len(rest)], rest, nil
+}
+
+// unmarshalLenient decodes the contents of the sequence of the variable
+// binding, the lengths are clamped and the non-minimal integers are accepted.
+func (v *VariableBinding) unmarshalLenient(contents []byte) error {
+	tlv, next, err := normalizeTLV(contents)
+	if err != nil {
+		return err
+	}
+	var oid Oid
+	if _, err = (&oid).Unmarshal(tlv); err != nil {
+		return err
+	}
+
+	if tlv, _, err = normalizeTLV(next); err != nil {
+		return err
+	}
+	variable, _, err := unmarshalVariable(tlv)
+	if err != nil {
+		return err
+	}
+
+	v.Oid = oid
+	v.Variable = variable
+	return nil
+}
+
+// unmarshalVariableBindingsLenient decodes the variable bindings, the
+// variable binding which is unable to decode is skipped and is recorded in
+// the warnings.
+func (pdu *PduV1) unmarshalVariableBindingsLenient(b []byte) error {
+	for idx := 0; len(b) > 0; idx++ {
+		var variableBinding VariableBinding
+		rest, err := variableBinding.Unmarshal(b)
+		if err != nil {
+			var header, contents []byte
+			if header, contents, rest, _, err = splitTLV(b); err != nil {
+				return err
+			}
+			if header[0] != asn1.TagSequence|0x20 {
+				return asn1.StructuralError{Msg: fmt.Sprintf(
+					"Invalid VariableBinding object - Tag [%02x] : [%s]", header[0], ToHexStr(b, " "))}
+			}
+			if err = variableBinding.unmarshalLenient(contents); err != nil {
+				pdu.decodeWarnings = append(pdu.decodeWarnings, fmt.Sprintf(
+					"VariableBinding[%d] is skipped - %v : [%s]", idx, err, ToHexStr(contents, " ")))
+				b = rest
+				continue
+			}
+		}
+		pdu.variableBindings = append(pdu.variableBindings, variableBinding)
+		b = rest
+	}
+	return nil
+}
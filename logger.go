@@ -0,0 +1,129 @@
+package snmpclient2
+
+import (
+	"sync/atomic"
+)
+
+// A Logger receives the diagnostics of the library, such as the retries,
+// the engine discovery, the reports and the dropped messages. It must be
+// safe for concurrent use.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+}
+
+type loggerHolder struct {
+	logger Logger
+}
+
+// loggerRef keeps a Logger which is replaced while it is used
+type loggerRef struct {
+	value atomic.Value
+}
+
+func (r *loggerRef) set(logger Logger) {
+	r.value.Store(loggerHolder{logger})
+}
+
+func (r *loggerRef) get() Logger {
+	h, _ := r.value.Load().(loggerHolder)
+	return h.logger
+}
+
+// debugf and warnf write to the Logger, or to the global Logger if it is
+// not set
+func (r *loggerRef) warnf(format string, args ...interface{}) {
+	l := r.get()
+	if nil == l {
+		l = globalLogger.get()
+	}
+	if nil != l {
+		l.Warnf(format, args...)
+	}
+}
+
+func (r *loggerRef) debugf(format string, args ...interface{}) {
+	l := r.get()
+	if nil == l {
+		l = globalLogger.get()
+	}
+	if nil != l {
+		l.Debugf(format, args...)
+	}
+}
+
+var globalLogger loggerRef
+
+// SetLogger sets the Logger of the SNMP objects, the servers and the
+// pingers which have no Logger of their own, nil disables the logging,
+// which is the default.
+func SetLogger(logger Logger) {
+	globalLogger.set(logger)
+}
+
+// SetLogger sets the Logger of the SNMP object, nil falls back to the
+// global Logger.
+func (s *SNMP) SetLogger(logger Logger) {
+	s.logger.set(logger)
+}
+
+func (s *SNMP) currentLogger() Logger {
+	if l := s.logger.get(); l != nil {
+		return l
+	}
+	return globalLogger.get()
+}
+
+// debugf and warnf are called on the rare paths only, such as the failures
+// and the discovery, nothing is logged on the path of a successful request.
+func (s *SNMP) debugf(format string, args ...interface{}) {
+	if l := s.currentLogger(); l != nil {
+		l.Debugf(format, args...)
+	}
+}
+
+func (s *SNMP) warnf(format string, args ...interface{}) {
+	if l := s.currentLogger(); l != nil {
+		l.Warnf(format, args...)
+	}
+}
+
+// SetLogger sets the Logger of the UdpServer, nil falls back to the global
+// Logger.
+func (self *UdpServer) SetLogger(logger Logger) {
+	self.logger.set(logger)
+}
+
+func (self *UdpServer) debugf(format string, args ...interface{}) {
+	self.logger.debugf("["+self.name+"]"+format, args...)
+}
+
+func (self *UdpServer) warnf(format string, args ...interface{}) {
+	self.logger.warnf("["+self.name+"]"+format, args...)
+}
+
+// SetLogger sets the Logger of the TrapServer, nil falls back to the global
+// Logger.
+func (self *TrapServer) SetLogger(logger Logger) {
+	self.logger.set(logger)
+}
+
+func (self *TrapServer) warnf(format string, args ...interface{}) {
+	self.logger.warnf("["+self.name+"]"+format, args...)
+}
+
+// SetLogger sets the Logger of the Pingers, nil falls back to the global
+// Logger.
+func (self *Pingers) SetLogger(logger Logger) {
+	self.logger.set(logger)
+}
+
+// SetLogger sets the Logger of the Pinger, nil falls back to the global
+// Logger.
+func (self *Pinger) SetLogger(logger Logger) {
+	self.logger.set(logger)
+}
+
+func (self *internal_pinger) warnf(format string, args ...interface{}) {
+	self.logger.warnf(format, args...)
+}
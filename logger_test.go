@@ -0,0 +1,130 @@
+package snmpclient2_test
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/runner-mei/snmpclient2"
+)
+
+type recordLogger struct {
+	mutex sync.Mutex
+	lines []string
+}
+
+func (l *recordLogger) Debugf(format string, args ...interface{}) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.lines = append(l.lines, "DEBUG "+fmt.Sprintf(format, args...))
+}
+
+func (l *recordLogger) Warnf(format string, args ...interface{}) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.lines = append(l.lines, "WARN "+fmt.Sprintf(format, args...))
+}
+
+func (l *recordLogger) contains(s string) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for _, line := range l.lines {
+		if strings.Contains(line, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestLogger(t *testing.T) {
+	dialer := newMemDialer(func([]byte) [][]byte { return nil })
+	snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:161", snmpclient2.Arguments{
+		Version:   snmpclient2.V2c,
+		Community: "public",
+		Timeout:   10 * time.Millisecond,
+		Retries:   1,
+		Dialer:    dialer,
+	})
+	defer snmp.Close()
+
+	var global recordLogger
+	snmpclient2.SetLogger(&global)
+	defer snmpclient2.SetLogger(nil)
+
+	snmp.GetRequest(snmpclient2.MustParseOids("1.3.6.1.2.1.1.1.0"))
+	for _, expected := range []string{"DEBUG attempt 1 of the GetRequest", "DEBUG attempt 2 of the GetRequest"} {
+		if !global.contains(expected) {
+			t.Errorf("SetLogger() - expected [%s], actual %v", expected, global.lines)
+		}
+	}
+
+	var local recordLogger
+	snmp.SetLogger(&local)
+	snmp.GetRequest(snmpclient2.MustParseOids("1.3.6.1.2.1.1.1.0"))
+	if !local.contains("DEBUG attempt 1 of the GetRequest") || len(global.lines) != 2 {
+		t.Errorf("SNMP.SetLogger() - expected the local logger, actual %v and %v", local.lines, global.lines)
+	}
+}
+
+func TestLoggerV3(t *testing.T) {
+	srv := newV3Server(t)
+	defer srv.Close()
+	var srvLogger recordLogger
+	srv.SetLogger(&srvLogger)
+
+	var logger recordLogger
+	snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:"+srv.GetPort(), v3Arguments(snmpclient2.UsmUser{UserName: "md5",
+		AuthProtocol: snmpclient2.Md5, AuthPassword: "md5-password"}))
+	defer snmp.Close()
+	snmp.SetLogger(&logger)
+	if _, err := snmp.GetRequest(snmpclient2.MustParseOids("1.3.6.1.2.1.1.1.0")); err != nil {
+		t.Fatalf("GetRequest() - has error %v", err)
+	}
+	for _, expected := range []string{
+		"DEBUG received a report from 127.0.0.1:" + srv.GetPort() + " - UsmStatsUnknownEngineIDs",
+		"DEBUG the engine of 127.0.0.1:" + srv.GetPort() + " is discovered - id [80001f880473696d], boots [3]",
+	} {
+		if !logger.contains(expected) {
+			t.Errorf("SetLogger() - expected [%s], actual %v", expected, logger.lines)
+		}
+	}
+
+	conn, err := net.Dial("udp", "127.0.0.1:"+srv.GetPort())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte{0x04, 0x01, 0x00})
+	for i := 0; i < 100 && !srvLogger.contains("WARN [v3]Invalid MessageV3 object"); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !srvLogger.contains("WARN [v3]Invalid MessageV3 object") {
+		t.Errorf("UdpServer.SetLogger() - expected a warning of the malformed message, actual %v", srvLogger.lines)
+	}
+}
+
+func TestTrapServerLogger(t *testing.T) {
+	srv, err := snmpclient2.NewTrapServer("trap", "127.0.0.1:0", func(net.Addr, snmpclient2.PDU) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	var logger recordLogger
+	srv.SetLogger(&logger)
+
+	conn, err := net.Dial("udp", "127.0.0.1:"+srv.GetPort())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte{0x04, 0x01, 0x00})
+	for i := 0; i < 100 && !logger.contains("WARN [trap]Failed to Unmarshal message"); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !logger.contains("WARN [trap]Failed to Unmarshal message") {
+		t.Errorf("TrapServer.SetLogger() - expected a warning of the malformed message, actual %v", logger.lines)
+	}
+}
@@ -29,6 +29,7 @@ type Message interface {
 	PduBytes() []byte
 	SetPduBytes([]byte)
 	Marshal() ([]byte, error)
+	AppendMarshal([]byte) ([]byte, error)
 	Unmarshal([]byte) ([]byte, error)
 	String() string
 }
@@ -61,23 +62,44 @@ func (msg *MessageV1) SetPduBytes(b []byte) {
 }
 
 func (msg *MessageV1) Marshal() (b []byte, err error) {
-	var buf []byte
-	raw := asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSequence, IsCompound: true}
+	return msg.AppendMarshal(nil)
+}
 
-	buf, err = asn1.Marshal(msg.version)
+// AppendMarshal appends the encoded message to b, the buffer of a previous
+// message can be reused.
+func (msg *MessageV1) AppendMarshal(b []byte) ([]byte, error) {
+	version, err := asn1.Marshal(msg.version)
 	if err != nil {
-		return
+		return nil, err
 	}
-	raw.Bytes = append(raw.Bytes, buf...)
-
-	buf, err = asn1.Marshal(msg.Community)
+	community, err := asn1.Marshal(msg.Community)
 	if err != nil {
-		return
+		return nil, err
 	}
-	raw.Bytes = append(raw.Bytes, buf...)
 
-	raw.Bytes = append(raw.Bytes, msg.pduBytes...)
-	return asn1.Marshal(raw)
+	b = appendHeader(b, sequenceIdentifier, len(version)+len(community)+len(msg.pduBytes))
+	b = append(b, version...)
+	b = append(b, community...)
+	return append(b, msg.pduBytes...), nil
+}
+
+// the identifier octet of a constructed SEQUENCE
+const sequenceIdentifier = 0x20 | asn1.TagSequence
+
+// appendHeader appends the identifier and the length octets of a TLV of n
+// octets of contents to b, the length is in the minimum number of octets.
+func appendHeader(b []byte, identifier byte, n int) []byte {
+	switch {
+	case n < 0x80:
+		return append(b, identifier, byte(n))
+	case n <= 0xff:
+		return append(b, identifier, 0x81, byte(n))
+	case n <= 0xffff:
+		return append(b, identifier, 0x82, byte(n>>8), byte(n))
+	case n <= 0xffffff:
+		return append(b, identifier, 0x83, byte(n>>16), byte(n>>8), byte(n))
+	}
+	return append(b, identifier, 0x84, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
 }
 
 func (msg *MessageV1) Unmarshal(b []byte) (rest []byte, err error) {
@@ -126,12 +148,15 @@ type securityModel int
 
 const (
 	securityUsm = 3
+	securityTsm = 4
 )
 
 func (s securityModel) String() string {
 	switch s {
 	case securityUsm:
 		return "USM"
+	case securityTsm:
+		return "TSM"
 	default:
 		return "Unknown"
 	}
@@ -326,32 +351,34 @@ type MessageV3 struct {
 }
 
 func (msg *MessageV3) Marshal() (b []byte, err error) {
-	var buf []byte
-	raw := asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSequence, IsCompound: true}
+	return msg.AppendMarshal(nil)
+}
 
-	buf, err = asn1.Marshal(msg.version)
+// AppendMarshal appends the encoded message to b, the buffer of a previous
+// message can be reused.
+func (msg *MessageV3) AppendMarshal(b []byte) ([]byte, error) {
+	version, err := asn1.Marshal(msg.version)
 	if err != nil {
-		return
+		return nil, err
 	}
-	raw.Bytes = buf
-
-	buf, err = msg.globalDataV3.Marshal()
+	globalData, err := msg.globalDataV3.Marshal()
 	if err != nil {
-		return
+		return nil, err
 	}
-	raw.Bytes = append(raw.Bytes, buf...)
-
-	buf, err = msg.securityParameterV3.Marshal()
-	if err != nil {
-		return
+	var securityParameter []byte
+	if msg.SecurityModel == securityTsm {
+		// TSM has no security parameters (RFC5591 Section 4.2)
+		securityParameter = []byte{asn1.TagOctetString, 0}
+	} else if securityParameter, err = msg.securityParameterV3.Marshal(); err != nil {
+		return nil, err
 	}
-	raw.Bytes = append(raw.Bytes, buf...)
 
-	// if 0 == len(msg.pduBytes) {
-	// 	panic("pdu bytes is empty.")
-	// }
-	raw.Bytes = append(raw.Bytes, msg.pduBytes...)
-	return asn1.Marshal(raw)
+	b = appendHeader(b, sequenceIdentifier,
+		len(version)+len(globalData)+len(securityParameter)+len(msg.pduBytes))
+	b = append(b, version...)
+	b = append(b, globalData...)
+	b = append(b, securityParameter...)
+	return append(b, msg.pduBytes...), nil
 }
 
 func (msg *MessageV3) Unmarshal(b []byte) (rest []byte, err error) {
@@ -379,7 +406,12 @@ func (msg *MessageV3) Unmarshal(b []byte) (rest []byte, err error) {
 		return
 	}
 
-	next, err = msg.securityParameterV3.Unmarshal(next)
+	if msg.SecurityModel == securityTsm {
+		var params []byte
+		next, err = asn1.Unmarshal(next, &params)
+	} else {
+		next, err = msg.securityParameterV3.Unmarshal(next)
+	}
 	if err != nil {
 		return
 	}
@@ -430,7 +462,7 @@ func (mp *messageProcessingV1) Security() Security {
 func (mp *messageProcessingV1) PrepareOutgoingMessage(
 	snmp *SNMP, pdu PDU) (msg Message, err error) {
 
-	pdu.SetRequestId(genRequestId())
+	setRequestId(snmp, pdu)
 	msg = NewMessage(snmp.args.Version, pdu)
 
 	err = mp.security.GenerateRequestMessage(&snmp.args, msg)
@@ -440,9 +472,12 @@ func (mp *messageProcessingV1) PrepareOutgoingMessage(
 func (mp *messageProcessingV1) PrepareDataElements(
 	snmp *SNMP, sendMsg Message, b []byte) (pdu PDU, err error) {
 
-	pdu = &PduV1{}
+	if snmp.args.LenientDecoding {
+		b = clampTLV(b)
+	}
+	pdu = &PduV1{lenient: snmp.args.LenientDecoding}
 	recvMsg := NewMessage(snmp.args.Version, pdu)
-	_, err = recvMsg.Unmarshal(b)
+	rest, err := recvMsg.Unmarshal(b)
 	if err != nil {
 		return nil, ResponseError{
 			Cause:   err,
@@ -450,6 +485,9 @@ func (mp *messageProcessingV1) PrepareDataElements(
 			Detail:  fmt.Sprintf("message Bytes - [%s]", ToHexStr(b, " ")),
 		}
 	}
+	if err = checkTrailing(b, rest, snmp.args.LenientDecoding); err != nil {
+		return nil, err
+	}
 
 	if sendMsg.Version() != recvMsg.Version() {
 		return nil, ResponseError{
@@ -472,15 +510,27 @@ func (mp *messageProcessingV1) PrepareDataElements(
 		}
 	}
 	if sendMsg.PDU().RequestId() != recvMsg.PDU().RequestId() {
-		return nil, ResponseError{
+		return nil, responseMismatchError{ResponseError{
 			Message: fmt.Sprintf("RequestId mismatch - expected [%d], actual [%d]",
 				sendMsg.PDU().RequestId(), recvMsg.PDU().RequestId()),
 			Detail: fmt.Sprintf("%s vs %s", sendMsg, recvMsg),
-		}
+		}}
 	}
 	return
 }
 
+// checkTrailing returns an error if the message is followed by the
+// trailing octets, which are ignored if lenient is true
+func checkTrailing(b, rest []byte, lenient bool) error {
+	if len(rest) == 0 || lenient {
+		return nil
+	}
+	return ResponseError{
+		Message: fmt.Sprintf("The message has [%d] trailing octets", len(rest)),
+		Detail:  fmt.Sprintf("message Bytes - [%s]", ToHexStr(b, " ")),
+	}
+}
+
 type messageProcessingV3 struct {
 	security Security
 }
@@ -492,11 +542,11 @@ func (mp *messageProcessingV3) Security() Security {
 func (mp *messageProcessingV3) PrepareOutgoingMessage(
 	snmp *SNMP, pdu PDU) (msg Message, err error) {
 
-	pdu.SetRequestId(genRequestId())
+	setRequestId(snmp, pdu)
 	msg = NewMessage(snmp.args.Version, pdu)
 
 	m := msg.(*MessageV3)
-	m.MessageId = genMessageId()
+	m.MessageId = snmp.args.messageId()
 	m.MessageMaxSize = snmp.args.MessageMaxSize
 	m.SecurityModel = securityUsm
 	m.SetReportable(confirmedType(pdu.PduType()))
@@ -514,9 +564,12 @@ func (mp *messageProcessingV3) PrepareOutgoingMessage(
 func (mp *messageProcessingV3) PrepareDataElements(
 	snmp *SNMP, sendMsg Message, b []byte) (pdu PDU, err error) {
 
-	pdu = &ScopedPdu{}
+	if snmp.args.LenientDecoding {
+		b = clampTLV(b)
+	}
+	pdu = &ScopedPdu{PduV1: PduV1{lenient: snmp.args.LenientDecoding}}
 	recvMsg := NewMessage(snmp.args.Version, pdu)
-	_, err = recvMsg.Unmarshal(b)
+	rest, err := recvMsg.Unmarshal(b)
 	if err != nil {
 		return nil, ResponseError{
 			Cause:   err,
@@ -524,6 +577,9 @@ func (mp *messageProcessingV3) PrepareDataElements(
 			Detail:  fmt.Sprintf("message Bytes - [%s]", ToHexStr(b, " ")),
 		}
 	}
+	if err = checkTrailing(b, rest, snmp.args.LenientDecoding); err != nil {
+		return nil, err
+	}
 
 	sm := sendMsg.(*MessageV3)
 	rm := recvMsg.(*MessageV3)
@@ -535,13 +591,13 @@ func (mp *messageProcessingV3) PrepareDataElements(
 		}
 	}
 	if sm.MessageId != rm.MessageId {
-		return nil, ResponseError{
+		return nil, responseMismatchError{ResponseError{
 			Message: fmt.Sprintf(
 				"MessageId mismatch - expected [%d], actual [%d]", sm.MessageId, rm.MessageId),
 			Detail: fmt.Sprintf("%s vs %s", sm, rm),
-		}
+		}}
 	}
-	if rm.SecurityModel != securityUsm {
+	if rm.SecurityModel != sm.SecurityModel {
 		return nil, ResponseError{
 			Message: fmt.Sprintf("Unknown SecurityModel, value [%d]", rm.SecurityModel),
 		}
@@ -555,11 +611,11 @@ func (mp *messageProcessingV3) PrepareDataElements(
 	switch t := rm.PDU().PduType(); t {
 	case GetResponse:
 		if sm.PDU().RequestId() != rm.PDU().RequestId() {
-			return nil, ResponseError{
+			return nil, responseMismatchError{ResponseError{
 				Message: fmt.Sprintf("RequestId mismatch - expected [%d], actual [%d]",
 					sm.PDU().RequestId(), rm.PDU().RequestId()),
 				Detail: fmt.Sprintf("%s vs %s", sm, rm),
-			}
+			}}
 		}
 	case Report:
 		if sm.Reportable() {
@@ -28,6 +28,11 @@ func TestMessageV1(t *testing.T) {
 		t.Errorf("Marshal() - expected [%s], actual [%s]",
 			snmpclient2.ToHexStr(expBuf, " "), snmpclient2.ToHexStr(buf, " "))
 	}
+	appended, err := msg.AppendMarshal([]byte{0xff})
+	if err != nil || !bytes.Equal(append([]byte{0xff}, expBuf...), appended) {
+		t.Errorf("AppendMarshal() - expected [ff %s], actual [%s] %v",
+			snmpclient2.ToHexStr(expBuf, " "), snmpclient2.ToHexStr(appended, " "), err)
+	}
 
 	expStr := `{"Version": "2c", "Community": "MyCommunity", ` +
 		`"PDU": {"Type": "GetRequest", "RequestId": "0", "ErrorStatus": ` +
@@ -0,0 +1,352 @@
+// Package mib parses the MIB modules of SMIv1 and SMIv2 and translates
+// between the OIDs and the names of the objects, e.g. "IF-MIB::ifInOctets.3"
+// and 1.3.6.1.2.1.2.2.1.10.3.
+//
+// Only the OID assignments are kept: OBJECT IDENTIFIER values, the
+// OBJECT-TYPE, OBJECT-IDENTITY, MODULE-IDENTITY, NOTIFICATION-TYPE,
+// TRAP-TYPE, the group and the compliance macros. A MIB is an OidResolver
+// of snmpclient2.
+//
+//	m := mib.New()
+//	if err := m.LoadDir("/usr/share/snmp/mibs"); err != nil {
+//		...
+//	}
+//	snmpclient2.SetOidResolver(m)
+package mib
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/runner-mei/snmpclient2"
+)
+
+// the nodes of SNMPv2-SMI, so that the modules are resolved without it
+const smiBase = `SNMPv2-SMI DEFINITIONS ::= BEGIN
+org            OBJECT IDENTIFIER ::= { iso 3 }
+dod            OBJECT IDENTIFIER ::= { org 6 }
+internet       OBJECT IDENTIFIER ::= { dod 1 }
+directory      OBJECT IDENTIFIER ::= { internet 1 }
+mgmt           OBJECT IDENTIFIER ::= { internet 2 }
+mib-2          OBJECT IDENTIFIER ::= { mgmt 1 }
+transmission   OBJECT IDENTIFIER ::= { mib-2 10 }
+experimental   OBJECT IDENTIFIER ::= { internet 3 }
+private        OBJECT IDENTIFIER ::= { internet 4 }
+enterprises    OBJECT IDENTIFIER ::= { private 1 }
+security       OBJECT IDENTIFIER ::= { internet 5 }
+snmpV2         OBJECT IDENTIFIER ::= { internet 6 }
+snmpDomains    OBJECT IDENTIFIER ::= { snmpV2 1 }
+snmpProxys     OBJECT IDENTIFIER ::= { snmpV2 2 }
+snmpModules    OBJECT IDENTIFIER ::= { snmpV2 3 }
+zeroDotZero    OBJECT IDENTIFIER ::= { 0 0 }
+END
+`
+
+// the roots of the OID tree (X.660)
+var roots = map[string]int{"ccitt": 0, "iso": 1, "joint-iso-ccitt": 2}
+
+// A Node is an object of a MIB module
+type Node struct {
+	Module string
+	Name   string
+	Oid    snmpclient2.Oid
+}
+
+// String returns the qualified name, e.g. "IF-MIB::ifInOctets"
+func (n *Node) String() string {
+	return n.Module + "::" + n.Name
+}
+
+// A MIB is the objects of the loaded modules, it is safe for concurrent use
+type MIB struct {
+	mutex      sync.RWMutex
+	modules    map[string]*module
+	nodes      map[string]*Node   // "MODULE::name" -> node
+	byName     map[string][]*Node // name -> nodes
+	byOid      map[string]*Node   // oid -> node
+	unresolved []string
+}
+
+// New returns a MIB of the nodes of SNMPv2-SMI
+func New() *MIB {
+	m := &MIB{modules: map[string]*module{}}
+	modules, err := parseModules(smiBase)
+	if err != nil {
+		panic(err)
+	}
+	m.add(modules)
+	m.build()
+	return m
+}
+
+// Load parses the modules of a MIB file, a module replaces the loaded one
+// of the same name
+func (m *MIB) Load(r io.Reader) error {
+	modules, err := readModules(r)
+	if err != nil {
+		return err
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.add(modules)
+	m.build()
+	return nil
+}
+
+// LoadFile is Load reading a file
+func (m *MIB) LoadFile(file string) error {
+	return m.LoadFiles(file)
+}
+
+// LoadFiles loads the files, the objects are resolved after all of them
+// are parsed, so they may be in any order
+func (m *MIB) LoadFiles(files ...string) error {
+	var modules []*module
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		ms, err := readModules(f)
+		f.Close()
+		if err != nil {
+			return &os.PathError{Op: "parse", Path: file, Err: err}
+		}
+		modules = append(modules, ms...)
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.add(modules)
+	m.build()
+	return nil
+}
+
+// LoadDir loads the files of the directory, the files which are not MIB
+// modules (e.g. an index) are skipped
+func (m *MIB) LoadDir(dir string) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var modules []*module
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		b, err := ioutil.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+		if !strings.Contains(string(b), "DEFINITIONS") {
+			continue
+		}
+		ms, err := parseModules(string(b))
+		if err != nil {
+			return &os.PathError{Op: "parse", Path: filepath.Join(dir, entry.Name()), Err: err}
+		}
+		modules = append(modules, ms...)
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.add(modules)
+	m.build()
+	return nil
+}
+
+func readModules(r io.Reader) ([]*module, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return parseModules(string(b))
+}
+
+// Modules returns the names of the loaded modules
+func (m *MIB) Modules() []string {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	names := make([]string, 0, len(m.modules))
+	for name := range m.modules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Unresolved returns the qualified names of the objects whose parents are
+// unknown, e.g. they are imported from a module which is not loaded
+func (m *MIB) Unresolved() []string {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return append([]string(nil), m.unresolved...)
+}
+
+// Node returns the object of the name, which is qualified by the module
+// (e.g. "IF-MIB::ifInOctets") or not
+func (m *MIB) Node(name string) (*Node, bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	n := m.node(name)
+	return n, n != nil
+}
+
+func (m *MIB) node(name string) *Node {
+	if strings.Contains(name, "::") {
+		return m.nodes[name]
+	}
+	if nodes := m.byName[name]; len(nodes) > 0 {
+		return nodes[0]
+	}
+	return nil
+}
+
+// Resolve returns the OID of the name, which is qualified by the module or
+// not and may be followed by the sub-identifiers of an index, e.g.
+// "IF-MIB::ifInOctets.3" or "ifInOctets.3". A dotted OID is parsed as is.
+func (m *MIB) Resolve(name string) (snmpclient2.Oid, error) {
+	if name != "" && (name[0] == '.' || name[0] >= '0' && name[0] <= '9') {
+		return snmpclient2.ParseOidFromString(name)
+	}
+	base, suffix := name, ""
+	start := 0
+	if idx := strings.Index(name, "::"); idx >= 0 {
+		start = idx + 2
+	}
+	if idx := strings.IndexByte(name[start:], '.'); idx >= 0 {
+		base, suffix = name[:start+idx], name[start+idx+1:]
+	}
+
+	m.mutex.RLock()
+	n := m.node(base)
+	m.mutex.RUnlock()
+	if n == nil {
+		return snmpclient2.Oid{}, snmpclient2.ArgumentError{Value: name, Message: "Unknown name"}
+	}
+	subs := append([]int(nil), n.Oid.Value...)
+	if suffix != "" {
+		index, err := snmpclient2.ParseIntsFromString(suffix)
+		if err != nil {
+			return snmpclient2.Oid{}, snmpclient2.ArgumentError{Value: name, Message: "Illegal sub-identifiers"}
+		}
+		subs = append(subs, index...)
+	}
+	return snmpclient2.NewOid(subs), nil
+}
+
+// Lookup returns the qualified name of the OID, the sub-identifiers
+// following the longest known prefix are kept numeric, e.g.
+// "IF-MIB::ifInOctets.3"
+func (m *MIB) Lookup(oid snmpclient2.Oid) (string, bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	for i := len(oid.Value); i > 0; i-- {
+		prefix := snmpclient2.NewOid(oid.Value[:i])
+		if n, ok := m.byOid[prefix.ToString()]; ok {
+			if i == len(oid.Value) {
+				return n.String(), true
+			}
+			suffix := snmpclient2.NewOid(oid.Value[i:])
+			return n.String() + "." + suffix.ToString(), true
+		}
+	}
+	return "", false
+}
+
+func (m *MIB) add(modules []*module) {
+	for _, mod := range modules {
+		m.modules[mod.name] = mod
+	}
+}
+
+// build resolves the definitions of all the modules
+func (m *MIB) build() {
+	r := &resolver{mib: m, oids: map[*definition][]int{}, visiting: map[*definition]bool{}}
+	m.nodes = map[string]*Node{}
+	m.byName = map[string][]*Node{}
+	m.byOid = map[string]*Node{}
+	m.unresolved = nil
+
+	names := make([]string, 0, len(m.modules))
+	for name := range m.modules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	r.names = names
+
+	for _, modName := range names {
+		mod := m.modules[modName]
+		for _, name := range mod.names {
+			subs, ok := r.resolve(mod, mod.defs[name])
+			if !ok {
+				m.unresolved = append(m.unresolved, modName+"::"+name)
+				continue
+			}
+			n := &Node{Module: modName, Name: name, Oid: snmpclient2.NewOid(subs)}
+			m.nodes[n.String()] = n
+			m.byName[name] = append(m.byName[name], n)
+			if key := n.Oid.ToString(); m.byOid[key] == nil {
+				m.byOid[key] = n
+			}
+		}
+	}
+}
+
+type resolver struct {
+	mib      *MIB
+	names    []string // the modules in order
+	oids     map[*definition][]int
+	visiting map[*definition]bool
+}
+
+func (r *resolver) resolve(mod *module, def *definition) ([]int, bool) {
+	if subs, ok := r.oids[def]; ok {
+		return subs, subs != nil
+	}
+	if r.visiting[def] {
+		return nil, false
+	}
+	r.visiting[def] = true
+	defer delete(r.visiting, def)
+
+	var subs []int
+	if def.parent != "" {
+		parent, ok := r.reference(mod, def.parent)
+		if !ok {
+			r.oids[def] = nil
+			return nil, false
+		}
+		subs = append(subs, parent...)
+	}
+	subs = append(subs, def.subs...)
+	r.oids[def] = subs
+	return subs, true
+}
+
+// reference resolves the name referred by the module: its definition, the
+// definition of the module which it is imported from, a root, or the
+// definition of any module
+func (r *resolver) reference(mod *module, name string) ([]int, bool) {
+	if def, ok := mod.defs[name]; ok {
+		return r.resolve(mod, def)
+	}
+	if from, ok := r.mib.modules[mod.imports[name]]; ok {
+		if def, ok := from.defs[name]; ok {
+			return r.resolve(from, def)
+		}
+	}
+	if n, ok := roots[name]; ok {
+		return []int{n}, true
+	}
+	for _, modName := range r.names {
+		other := r.mib.modules[modName]
+		if def, ok := other.defs[name]; ok && other != mod {
+			return r.resolve(other, def)
+		}
+	}
+	return nil, false
+}
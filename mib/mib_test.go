@@ -0,0 +1,90 @@
+package mib_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/runner-mei/snmpclient2"
+	"github.com/runner-mei/snmpclient2/mib"
+)
+
+func TestMIB(t *testing.T) {
+	m := mib.New()
+	if err := m.LoadDir("testdata"); err != nil {
+		t.Fatalf("LoadDir() - has error %v", err)
+	}
+	if modules := m.Modules(); !reflect.DeepEqual(modules, []string{"ACME-MIB", "IF-MIB", "SNMPv2-SMI"}) {
+		t.Errorf("Modules() - unexpected %v", modules)
+	}
+
+	for _, test := range []struct {
+		name string
+		oid  string
+	}{
+		{"IF-MIB::ifInOctets.3", "1.3.6.1.2.1.2.2.1.10.3"},
+		{"ifInOctets.3", "1.3.6.1.2.1.2.2.1.10.3"},
+		{"IF-MIB::ifAdminStatus", "1.3.6.1.2.1.2.2.1.7"},
+		{"IF-MIB::ifCompliance3", "1.3.6.1.2.1.31.2.2.3"},
+		{"ACME-MIB::acme", "1.3.6.1.4.1.99999"},
+		{"ACME-MIB::acmeAlarm", "1.3.6.1.4.1.99999.0.3"},
+		{"enterprises", "1.3.6.1.4.1"},
+		{"zeroDotZero", "0.0"},
+		{"1.3.6.1.2.1.1.1.0", "1.3.6.1.2.1.1.1.0"},
+	} {
+		oid, err := m.Resolve(test.name)
+		if err != nil {
+			t.Errorf("Resolve(%s) - has error %v", test.name, err)
+			continue
+		}
+		if oid.ToString() != test.oid {
+			t.Errorf("Resolve(%s) - expected [%s], actual [%s]", test.name, test.oid, oid.ToString())
+		}
+	}
+
+	for _, name := range []string{"ifOutOctets", "IF-MIB::acme", "ifInOctets.x", "acmeLost"} {
+		if _, err := m.Resolve(name); err == nil {
+			t.Errorf("Resolve(%s) - expected an error", name)
+		}
+	}
+	if unresolved := m.Unresolved(); !reflect.DeepEqual(unresolved, []string{"ACME-MIB::acmeLost"}) {
+		t.Errorf("Unresolved() - unexpected %v", unresolved)
+	}
+
+	for _, test := range []struct {
+		oid  string
+		name string
+	}{
+		{"1.3.6.1.2.1.2.2.1.10.3", "IF-MIB::ifInOctets.3"},
+		{"1.3.6.1.2.1.2.2.1.2", "IF-MIB::ifDescr"},
+		{"1.3.6.1.2.1.1.1.0", "SNMPv2-SMI::mib-2.1.1.0"},
+	} {
+		oid := snmpclient2.MustParseOidFromString(test.oid)
+		if name, ok := m.Lookup(oid); !ok || name != test.name {
+			t.Errorf("Lookup(%s) - expected [%s], actual [%s]", test.oid, test.name, name)
+		}
+	}
+	if name, ok := m.Lookup(snmpclient2.MustParseOidFromString("2.5")); ok {
+		t.Errorf("Lookup(2.5) - expected not found, actual [%s]", name)
+	}
+
+	snmpclient2.SetOidResolver(m)
+	defer snmpclient2.SetOidResolver(nil)
+	oids, err := snmpclient2.NewOids([]string{"IF-MIB::ifDescr.1"})
+	if err != nil || oids[0].ToString() != "1.3.6.1.2.1.2.2.1.2.1" {
+		t.Errorf("NewOids() - unexpected %v, %v", oids, err)
+	}
+}
+
+func TestMIBErrors(t *testing.T) {
+	for _, src := range []string{
+		"BROKEN-MIB DEFINITIONS ::= BEGIN\nfoo OBJECT IDENTIFIER ::= { mib-2 1 }\n",
+		"BROKEN-MIB DEFINITIONS ::= BEGIN\nfoo OBJECT IDENTIFIER ::= { mib-2 x(y) }\nEND\n",
+		"BROKEN-MIB DEFINITIONS ::= BEGIN\nfoo OBJECT-TYPE DESCRIPTION \"unterminated\nEND\n",
+		"BROKEN-MIB ::= BEGIN\nEND\n",
+	} {
+		if err := mib.New().Load(strings.NewReader(src)); err == nil {
+			t.Errorf("Load() - expected an error, %q", src)
+		}
+	}
+}
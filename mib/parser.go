@@ -0,0 +1,333 @@
+package mib
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type token struct {
+	text string
+	line int
+}
+
+// tokenize splits a MIB file into the identifiers, the numbers and the
+// symbols, the comments are skipped and a quoted string is a single token
+// of '"'
+func tokenize(src string) ([]token, error) {
+	var tokens []token
+	line := 1
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r' || c == '\f':
+			i++
+		case strings.HasPrefix(src[i:], "--"):
+			// a comment ends at the line end or the next "--"
+			i += 2
+			for i < len(src) && src[i] != '\n' {
+				if strings.HasPrefix(src[i:], "--") {
+					i += 2
+					break
+				}
+				i++
+			}
+		case c == '"':
+			start := line
+			end := strings.IndexByte(src[i+1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: the string is not terminated", start)
+			}
+			line += strings.Count(src[i+1:i+1+end], "\n")
+			tokens = append(tokens, token{`"`, start})
+			i += end + 2
+		case c == '\'':
+			// a binary or a hexadecimal string, e.g. '0A'H
+			end := strings.IndexByte(src[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: the string is not terminated", line)
+			}
+			i += end + 2
+			if i < len(src) && (src[i] == 'H' || src[i] == 'h' || src[i] == 'B' || src[i] == 'b') {
+				i++
+			}
+			tokens = append(tokens, token{"'", line})
+		case strings.HasPrefix(src[i:], "::="):
+			tokens = append(tokens, token{"::=", line})
+			i += 3
+		case strings.HasPrefix(src[i:], ".."):
+			tokens = append(tokens, token{"..", line})
+			i += 2
+		case isWordChar(c):
+			start := i
+			for i < len(src) && isWordChar(src[i]) && !strings.HasPrefix(src[i:], "--") {
+				i++
+			}
+			tokens = append(tokens, token{src[start:i], line})
+		default:
+			tokens = append(tokens, token{string(c), line})
+			i++
+		}
+	}
+	return tokens, nil
+}
+
+func isWordChar(c byte) bool {
+	return c == '-' || c == '_' || c < 0x80 && (unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c)))
+}
+
+// the macros whose values are OIDs
+var oidMacros = map[string]bool{
+	"OBJECT-TYPE":        true,
+	"OBJECT-IDENTITY":    true,
+	"MODULE-IDENTITY":    true,
+	"NOTIFICATION-TYPE":  true,
+	"OBJECT-GROUP":       true,
+	"NOTIFICATION-GROUP": true,
+	"MODULE-COMPLIANCE":  true,
+	"AGENT-CAPABILITIES": true,
+}
+
+// definition is an OID assigned by a module, it is the OID of parent
+// followed by subs, parent is empty if the OID is absolute
+type definition struct {
+	name   string
+	parent string
+	subs   []int
+}
+
+type module struct {
+	name    string
+	imports map[string]string // symbol -> module
+	defs    map[string]*definition
+	names   []string // the definitions in order
+}
+
+func (m *module) define(name, parent string, subs ...int) {
+	if _, ok := m.defs[name]; !ok {
+		m.names = append(m.names, name)
+	}
+	m.defs[name] = &definition{name: name, parent: parent, subs: subs}
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek(n int) string {
+	if p.pos+n < len(p.tokens) {
+		return p.tokens[p.pos+n].text
+	}
+	return ""
+}
+
+func (p *parser) next() string {
+	s := p.peek(0)
+	p.pos++
+	return s
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	line := 0
+	if p.pos < len(p.tokens) {
+		line = p.tokens[p.pos].line
+	} else if len(p.tokens) > 0 {
+		line = p.tokens[len(p.tokens)-1].line
+	}
+	return fmt.Errorf("line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+// skipTo skips the tokens until s, it fails at the end of the tokens
+func (p *parser) skipTo(s string) error {
+	for p.pos < len(p.tokens) {
+		if p.next() == s {
+			return nil
+		}
+	}
+	return p.errorf("'%s' is missing", s)
+}
+
+// parseModules returns the modules of a MIB file
+func parseModules(src string) ([]*module, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	var modules []*module
+	for p.pos < len(p.tokens) {
+		m, err := p.parseModule()
+		if err != nil {
+			return nil, err
+		}
+		modules = append(modules, m)
+	}
+	return modules, nil
+}
+
+// parseModule parses "NAME DEFINITIONS ::= BEGIN ... END"
+func (p *parser) parseModule() (*module, error) {
+	m := &module{name: p.next(), imports: map[string]string{}, defs: map[string]*definition{}}
+	if p.peek(0) == "{" {
+		// the OID of the module, e.g. in the modules of ASN.1
+		if err := p.skipTo("}"); err != nil {
+			return nil, err
+		}
+	}
+	if p.next() != "DEFINITIONS" {
+		return nil, p.errorf("DEFINITIONS of module %s is missing", m.name)
+	}
+	if err := p.skipTo("BEGIN"); err != nil {
+		return nil, err
+	}
+
+	for {
+		switch tok := p.peek(0); {
+		case tok == "":
+			return nil, p.errorf("END of module %s is missing", m.name)
+		case tok == "END":
+			p.next()
+			return m, nil
+		case tok == "IMPORTS":
+			p.next()
+			if err := p.parseImports(m); err != nil {
+				return nil, err
+			}
+		case tok == "EXPORTS":
+			if err := p.skipTo(";"); err != nil {
+				return nil, err
+			}
+		case p.peek(1) == "MACRO":
+			if err := p.skipTo("END"); err != nil {
+				return nil, err
+			}
+		case isValueName(tok) && p.peek(1) == "OBJECT" && p.peek(2) == "IDENTIFIER" && p.peek(3) == "::=":
+			p.pos += 4
+			if err := p.parseOid(m, tok); err != nil {
+				return nil, err
+			}
+		case isValueName(tok) && p.peek(1) == "TRAP-TYPE":
+			if err := p.parseTrapType(m, tok); err != nil {
+				return nil, err
+			}
+		case isValueName(tok) && oidMacros[p.peek(1)]:
+			if err := p.skipTo("::="); err != nil {
+				return nil, err
+			}
+			if err := p.parseOid(m, tok); err != nil {
+				return nil, err
+			}
+		default:
+			p.next()
+		}
+	}
+}
+
+// isValueName reports whether s is the name of a value, which starts with a
+// lowercase letter
+func isValueName(s string) bool {
+	return s != "" && s[0] >= 'a' && s[0] <= 'z'
+}
+
+// parseImports parses "a, b FROM X c FROM Y ;"
+func (p *parser) parseImports(m *module) error {
+	var symbols []string
+	for {
+		switch tok := p.next(); tok {
+		case "":
+			return p.errorf("';' of IMPORTS is missing")
+		case ";":
+			return nil
+		case ",":
+		case "FROM":
+			from := p.next()
+			for _, s := range symbols {
+				m.imports[s] = from
+			}
+			symbols = symbols[:0]
+		default:
+			symbols = append(symbols, tok)
+		}
+	}
+}
+
+// parseOid parses the value "{ parent 1 name(2) 3 }" of name, the named
+// components define the intermediate nodes
+func (p *parser) parseOid(m *module, name string) error {
+	if p.next() != "{" {
+		return p.errorf("the value of %s is not an OID", name)
+	}
+	parent := ""
+	var subs []int
+	for first := true; ; first = false {
+		tok := p.next()
+		switch {
+		case tok == "}":
+			if parent == "" && len(subs) == 0 {
+				return p.errorf("the value of %s is empty", name)
+			}
+			m.define(name, parent, subs...)
+			return nil
+		case tok == "":
+			return p.errorf("'}' of %s is missing", name)
+		case isNumber(tok):
+			n, err := strconv.Atoi(tok)
+			if err != nil {
+				return p.errorf("illegal sub-identifier %s of %s", tok, name)
+			}
+			subs = append(subs, n)
+		case p.peek(0) == "(":
+			// name(number)
+			p.next()
+			n, err := strconv.Atoi(p.next())
+			if err != nil || p.next() != ")" {
+				return p.errorf("illegal component %s of %s", tok, name)
+			}
+			if first {
+				m.define(tok, "", n)
+			} else {
+				m.define(tok, parent, append(subs, n)...)
+			}
+			parent, subs = tok, nil
+		case first:
+			parent = tok
+		default:
+			return p.errorf("illegal component %s of %s", tok, name)
+		}
+	}
+}
+
+// parseTrapType parses the TRAP-TYPE of SMIv1, the OID of the trap is
+// enterprise.0.specific-trap (RFC3584 Section 3)
+func (p *parser) parseTrapType(m *module, name string) error {
+	enterprise := ""
+	for {
+		switch tok := p.next(); tok {
+		case "":
+			return p.errorf("the value of %s is missing", name)
+		case "ENTERPRISE":
+			enterprise = p.next()
+		case "::=":
+			n, err := strconv.Atoi(p.next())
+			if err != nil || enterprise == "" {
+				return p.errorf("illegal TRAP-TYPE %s", name)
+			}
+			m.define(name, enterprise, 0, n)
+			return nil
+		}
+	}
+}
+
+func isNumber(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -1,94 +1,156 @@
 package main
 
 import (
-	"encoding/binary"
 	"errors"
 	"fmt"
+	"math/big"
 	"net"
 	"strings"
 )
 
 type IPRange struct {
-	start uint32
-	end   uint32
-	cur   uint32
+	start *big.Int
+	end   *big.Int
+	cur   *big.Int
+	v6    bool
+	zone  string
 }
 
 func (self *IPRange) Reset() {
-	self.cur = self.start - 1
+	self.cur = new(big.Int).Sub(self.start, bigOne)
 }
 
 func (self *IPRange) HasNext() bool {
 again:
-	if self.cur >= self.end {
+	if self.cur.Cmp(self.end) >= 0 {
 		return false
 	}
-	self.cur++
+	self.cur.Add(self.cur, bigOne)
 
-	var b [4]byte
-	binary.BigEndian.PutUint32(b[:], self.cur)
-	if b[3] == 0 || b[3] == 255 {
-		goto again
+	if !self.v6 {
+		// the network and broadcast addresses of IPv4
+		if low := self.cur.Uint64() & 0xff; low == 0 || low == 255 {
+			goto again
+		}
 	}
 	return true
 }
 
 func (self *IPRange) Current() net.IP {
-	var b [4]byte
-	binary.BigEndian.PutUint32(b[:], self.cur)
-	return net.IPv4(b[0], b[1], b[2], b[3])
+	return self.toIP(self.cur)
+}
+
+// Host returns the current address with the zone of the range, e.g.
+// "fe80::1%eth0"
+func (self *IPRange) Host() string {
+	if "" == self.zone {
+		return self.Current().String()
+	}
+	return self.Current().String() + "%" + self.zone
+}
+
+// IsIPv6 returns true if the range is of IPv6 addresses
+func (self *IPRange) IsIPv6() bool {
+	return self.v6
+}
+
+func (self *IPRange) toIP(i *big.Int) net.IP {
+	size := net.IPv4len
+	if self.v6 {
+		size = net.IPv6len
+	}
+	b := i.Bytes()
+	ip := make(net.IP, size)
+	if len(b) <= size {
+		copy(ip[size-len(b):], b)
+	}
+	return ip
 }
 
-// Parses a dotted octet IP address into an unsigned 32-bit int
-func parseIPV4(s string) uint32 {
+var bigOne = big.NewInt(1)
+
+// Parses an IP address into an unsigned integer, v6 is false if it is an
+// IPv4 address
+func parseIP(s string) (i *big.Int, v6 bool) {
 	ip := net.ParseIP(s)
 	if nil == ip {
-		return 0
+		return nil, false
+	}
+	if ip4 := ip.To4(); nil != ip4 && !strings.Contains(s, ":") {
+		return new(big.Int).SetBytes(ip4), false
 	}
-	return binary.BigEndian.Uint32(ip.To4())
+	return new(big.Int).SetBytes(ip.To16()), true
 }
 
-// Parses a string IP address range into an IPRange
+// Parses a string IP address range into an IPRange, it is an address, a
+// range "start-end" or a CIDR of IPv4 or IPv6. The IPv6 range may end with
+// a zone, e.g. "fe80::1-fe80::9%eth0".
 func ParseIPRange(raw string) (*IPRange, error) {
-	start, end := uint32(0), uint32(0)
+	expr, zone := raw, ""
+	if idx := strings.LastIndexByte(raw, '%'); idx > 0 {
+		expr, zone = raw[:idx], raw[idx+1:]
+	}
 
-	fields := strings.Split(raw, "-")
+	var start, end *big.Int
+	var v6, endV6 bool
+
+	fields := strings.Split(expr, "-")
 	if 2 != len(fields) {
-		ip := parseIPV4(raw)
-		if 0 != ip {
-			return &IPRange{start: ip, end: ip, cur: ip - 1}, nil
+		if ip, isV6 := parseIP(expr); nil != ip && 0 != ip.Sign() {
+			return newIPRange(ip, ip, isV6, zone)
 		}
-		_, ipNet, e := net.ParseCIDR(raw)
+		_, ipNet, e := net.ParseCIDR(expr)
 		if nil != e {
 			return nil, errors.New("syntex error: please input corrent sytex, such 'xxx.xxx.xxx.xxx-yyy.yyy.yyy.yyy - '" + raw + "'")
 		}
-		start = binary.BigEndian.Uint32(ipNet.IP.To4())
+		v6 = strings.Contains(expr, ":")
+		ip := ipNet.IP.To4()
+		if v6 {
+			ip = ipNet.IP.To16()
+		}
+		start = new(big.Int).SetBytes(ip)
 		ones, bits := ipNet.Mask.Size()
-		end = start + (uint32(1) << uint32(bits-ones))
+		end = new(big.Int).Add(start, new(big.Int).Lsh(bigOne, uint(bits-ones)))
+		if v6 {
+			// the IPv6 prefix has no broadcast address
+			end.Sub(end, bigOne)
+		}
+		endV6 = v6
 	} else {
-		start = parseIPV4(fields[0])
-		end = parseIPV4(fields[1])
+		start, v6 = parseIP(fields[0])
+		end, endV6 = parseIP(fields[1])
 	}
-	if 0 == start {
+	if nil == start || (0 == start.Sign() && !v6) {
 		return nil, errors.New("start address is syntex error - '" + raw + "'")
 	}
-	if 0 == end {
+	if nil == end || (0 == end.Sign() && !endV6) {
 		return nil, errors.New("end address is syntex error - '" + raw + "'")
 	}
-	if start > end {
+	if v6 != endV6 {
+		return nil, errors.New("start address and end address are different families - '" + raw + "'")
+	}
+	if start.Cmp(end) > 0 {
 		return nil, errors.New("start address geater than end address - '" + raw + "'")
 	}
-	return &IPRange{start: start, end: end, cur: start - 1}, nil
+	return newIPRange(start, end, v6, zone)
 }
 
-// Returns a dotted octet format of the ip address
-func ipString(ip uint32) string {
-	return fmt.Sprintf("%d.%d.%d.%d", ip>>24&0xFF, ip>>16&0xFF, ip>>8&0xFF, ip&0xFF)
+func newIPRange(start, end *big.Int, v6 bool, zone string) (*IPRange, error) {
+	if "" != zone && !v6 {
+		return nil, errors.New("zone is unsupported by IPv4 - '" + zone + "'")
+	}
+	r := &IPRange{start: start, end: end, v6: v6, zone: zone}
+	r.Reset()
+	return r, nil
 }
 
 // Returns the start and end IP's of an IPRange
 func (ipr IPRange) String() string {
-	return fmt.Sprintf("%s-%s", ipString(ipr.start), ipString(ipr.end))
+	s := fmt.Sprintf("%s-%s", ipr.toIP(ipr.start), ipr.toIP(ipr.end))
+	if "" != ipr.zone {
+		s += "%" + ipr.zone
+	}
+	return s
 }
 
 // // package main
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 )
@@ -58,3 +61,137 @@ func TestIPRanage(t *testing.T) {
 	//	t.Error(ips.Current().String())
 	//}
 }
+
+func TestIPRangeV6(t *testing.T) {
+	for _, test := range []struct {
+		expr   string
+		hosts  []string
+		expr2  string
+		hasErr bool
+	}{
+		{"2001:db8::1", []string{"2001:db8::1"}, "2001:db8::1-2001:db8::1", false},
+		{"2001:db8::ff-2001:db8::101", []string{"2001:db8::ff", "2001:db8::100", "2001:db8::101"}, "2001:db8::ff-2001:db8::101", false},
+		{"2001:db8::/126", []string{"2001:db8::", "2001:db8::1", "2001:db8::2", "2001:db8::3"}, "2001:db8::-2001:db8::3", false},
+		{"fe80::1%eth0", []string{"fe80::1%eth0"}, "fe80::1-fe80::1%eth0", false},
+		{"192.168.1.1-2001:db8::1", nil, "", true},
+		{"192.168.1.1%eth0", nil, "", true},
+	} {
+		r, e := ParseIPRange(test.expr)
+		if test.hasErr {
+			if nil == e {
+				t.Errorf("ParseIPRange(%s) - expected an error", test.expr)
+			}
+			continue
+		}
+		if nil != e {
+			t.Errorf("ParseIPRange(%s) - %v", test.expr, e)
+			continue
+		}
+		if !r.IsIPv6() {
+			t.Errorf("ParseIPRange(%s) - expected an IPv6 range", test.expr)
+		}
+		var hosts []string
+		for r.HasNext() {
+			hosts = append(hosts, r.Host())
+		}
+		if !reflect.DeepEqual(hosts, test.hosts) {
+			t.Errorf("ParseIPRange(%s) - expected %v, actual %v", test.expr, test.hosts, hosts)
+		}
+		if test.expr2 != r.String() {
+			t.Errorf("String() - expected %s, actual %s", test.expr2, r.String())
+		}
+	}
+}
+
+func TestIPRanges(t *testing.T) {
+	for _, test := range []struct {
+		targets  []string
+		excludes []string
+		hosts    []string
+		expr     string
+	}{
+		{[]string{"192.168.1.1-192.168.1.3", "192.168.1.2-192.168.1.5", "192.168.1.4"}, nil,
+			[]string{"192.168.1.1", "192.168.1.2", "192.168.1.3", "192.168.1.4", "192.168.1.5"},
+			"192.168.1.1-192.168.1.5"},
+		{[]string{"192.168.1.9", "192.168.1.1-192.168.1.2", "192.168.1.3"}, nil,
+			[]string{"192.168.1.1", "192.168.1.2", "192.168.1.3", "192.168.1.9"},
+			"192.168.1.1-192.168.1.3,192.168.1.9-192.168.1.9"},
+		{[]string{"192.168.1.1-192.168.1.6"}, []string{"192.168.1.1", "192.168.1.3-192.168.1.4", "192.168.1.9"},
+			[]string{"192.168.1.2", "192.168.1.5", "192.168.1.6"},
+			"192.168.1.2-192.168.1.2,192.168.1.5-192.168.1.6"},
+		{[]string{"192.168.1.1-192.168.1.3"}, []string{"192.168.1.0/24"}, nil, ""},
+		{[]string{"192.168.1.254-192.168.2.1"}, nil, []string{"192.168.1.254", "192.168.2.1"}, "192.168.1.254-192.168.2.1"},
+		{[]string{"2001:db8::1-2001:db8::3"}, []string{"2001:db8::2"}, []string{"2001:db8::1", "2001:db8::3"},
+			"2001:db8::1-2001:db8::1,2001:db8::3-2001:db8::3"},
+	} {
+		r, e := ParseIPRanges(test.targets, test.excludes)
+		if nil != e {
+			t.Errorf("ParseIPRanges(%v, %v) - %v", test.targets, test.excludes, e)
+			continue
+		}
+		for i := 0; i < 2; i++ {
+			var hosts []string
+			for r.HasNext() {
+				hosts = append(hosts, r.Host())
+			}
+			if !reflect.DeepEqual(hosts, test.hosts) {
+				t.Errorf("ParseIPRanges(%v, %v) - expected %v, actual %v", test.targets, test.excludes, test.hosts, hosts)
+			}
+			r.Reset()
+		}
+		if count := r.Count().Int64(); count != int64(len(test.hosts)) {
+			t.Errorf("Count(%v, %v) - expected %d, actual %d", test.targets, test.excludes, len(test.hosts), count)
+		}
+		if test.expr != r.String() {
+			t.Errorf("String() - expected %s, actual %s", test.expr, r.String())
+		}
+	}
+
+	r, e := ParseIPRanges([]string{"10.0.0.0/16"}, []string{"10.0.1.0/24"})
+	if nil != e {
+		t.Fatal(e)
+	}
+	if count := r.Count().Int64(); count != 254*255 {
+		t.Errorf("Count() - expected %d, actual %d", 254*255, count)
+	}
+
+	for _, test := range []struct {
+		targets  []string
+		excludes []string
+	}{
+		{nil, nil},
+		{[]string{"192.168.1.1", "2001:db8::1"}, nil},
+		{[]string{"fe80::1%eth0", "fe80::2%eth1"}, nil},
+		{[]string{"192.168.1.1"}, []string{"2001:db8::1"}},
+		{[]string{"192.168.1.1"}, []string{"192.168.1"}},
+	} {
+		if _, e := ParseIPRanges(test.targets, test.excludes); nil == e {
+			t.Errorf("ParseIPRanges(%v, %v) - expected an error", test.targets, test.excludes)
+		}
+	}
+}
+
+func TestReadTargets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nping")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "targets.txt")
+	content := "# the core switches\n10.0.0.1\n\n  10.0.1.0/24  # the access layer\n192.168.1.1-192.168.1.9\n"
+	if err = ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	targets, err := ReadTargets(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"10.0.0.1", "10.0.1.0/24", "192.168.1.1-192.168.1.9"}
+	if !reflect.DeepEqual(targets, expected) {
+		t.Errorf("ReadTargets() - expected %v, actual %v", expected, targets)
+	}
+	if _, err = ReadTargets(filepath.Join(dir, "missing.txt")); err == nil {
+		t.Error("ReadTargets() - expected an error")
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"sort"
+	"strings"
+)
+
+// IPRanges is the union of the targets minus the excluded ranges, the
+// overlapping targets are merged so that no address is iterated twice. All
+// the ranges must be of the same family and zone.
+type IPRanges struct {
+	ranges []*IPRange
+	idx    int
+	v6     bool
+	zone   string
+}
+
+// ParseIPRanges parses the targets and the excluded ranges, each of them
+// is an address, a range or a CIDR, see ParseIPRange.
+func ParseIPRanges(targets, excludes []string) (*IPRanges, error) {
+	if 0 == len(targets) {
+		return nil, errors.New("targets is missing")
+	}
+	included, err := parseIPRanges(targets)
+	if nil != err {
+		return nil, err
+	}
+	excluded, err := parseIPRanges(excludes)
+	if nil != err {
+		return nil, err
+	}
+
+	self := &IPRanges{v6: included[0].v6, zone: included[0].zone}
+	for _, r := range append(included, excluded...) {
+		if r.v6 != self.v6 || r.zone != self.zone {
+			return nil, errors.New("targets are different families or zones - '" + r.String() + "'")
+		}
+	}
+	for _, r := range subtractIPRanges(mergeIPRanges(included), mergeIPRanges(excluded)) {
+		r.Reset()
+		self.ranges = append(self.ranges, r)
+	}
+	return self, nil
+}
+
+func parseIPRanges(exprs []string) ([]*IPRange, error) {
+	ranges := make([]*IPRange, 0, len(exprs))
+	for _, expr := range exprs {
+		r, err := ParseIPRange(expr)
+		if nil != err {
+			return nil, err
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges, nil
+}
+
+// ReadTargets reads the targets of the file, one address, range or CIDR per
+// line, the blank lines and the comments started with '#' are ignored.
+func ReadTargets(file string) ([]string, error) {
+	f, err := os.Open(file)
+	if nil != err {
+		return nil, err
+	}
+	defer f.Close()
+
+	var targets []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if idx := strings.IndexByte(line, '#'); idx >= 0 {
+			line = line[:idx]
+		}
+		if line = strings.TrimSpace(line); "" != line {
+			targets = append(targets, line)
+		}
+	}
+	return targets, scanner.Err()
+}
+
+// mergeIPRanges sorts the ranges and merges the overlapping and the
+// adjacent ones
+func mergeIPRanges(ranges []*IPRange) []*IPRange {
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].start.Cmp(ranges[j].start) < 0
+	})
+	merged := make([]*IPRange, 0, len(ranges))
+	for _, r := range ranges {
+		if n := len(merged); n > 0 {
+			last := merged[n-1]
+			if r.start.Cmp(new(big.Int).Add(last.end, bigOne)) <= 0 {
+				if r.end.Cmp(last.end) > 0 {
+					last.end = r.end
+				}
+				continue
+			}
+		}
+		merged = append(merged, &IPRange{start: r.start, end: r.end, v6: r.v6, zone: r.zone})
+	}
+	return merged
+}
+
+// subtractIPRanges removes the excluded ranges from the ranges, both of
+// them are merged
+func subtractIPRanges(ranges, excludes []*IPRange) []*IPRange {
+	results := make([]*IPRange, 0, len(ranges))
+	for _, r := range ranges {
+		start := r.start
+		for _, ex := range excludes {
+			if ex.end.Cmp(start) < 0 {
+				continue
+			}
+			if ex.start.Cmp(r.end) > 0 {
+				break
+			}
+			if ex.start.Cmp(start) > 0 {
+				results = append(results, &IPRange{start: start, end: new(big.Int).Sub(ex.start, bigOne), v6: r.v6, zone: r.zone})
+			}
+			start = new(big.Int).Add(ex.end, bigOne)
+		}
+		if start.Cmp(r.end) <= 0 {
+			results = append(results, &IPRange{start: start, end: r.end, v6: r.v6, zone: r.zone})
+		}
+	}
+	return results
+}
+
+func (self *IPRanges) Reset() {
+	for _, r := range self.ranges {
+		r.Reset()
+	}
+	self.idx = 0
+}
+
+func (self *IPRanges) HasNext() bool {
+	for ; self.idx < len(self.ranges); self.idx++ {
+		if self.ranges[self.idx].HasNext() {
+			return true
+		}
+	}
+	return false
+}
+
+func (self *IPRanges) Current() net.IP {
+	return self.ranges[self.idx].Current()
+}
+
+// Host returns the current address with the zone, see IPRange.Host
+func (self *IPRanges) Host() string {
+	return self.ranges[self.idx].Host()
+}
+
+// IsIPv6 returns true if the ranges are of IPv6 addresses
+func (self *IPRanges) IsIPv6() bool {
+	return self.v6
+}
+
+// Count returns the number of the addresses which are iterated, the
+// network and broadcast addresses of IPv4 are not counted.
+func (self *IPRanges) Count() *big.Int {
+	count := new(big.Int)
+	for _, r := range self.ranges {
+		count.Add(count, new(big.Int).Sub(r.end, r.start))
+		count.Add(count, bigOne)
+		if !self.v6 {
+			count.Sub(count, big.NewInt(int64(skippedIPv4(r.end.Uint64())-skippedIPv4(r.start.Uint64()-1))))
+		}
+	}
+	return count
+}
+
+// skippedIPv4 returns the number of the addresses ended with 0 or 255 in
+// [0, n]
+func skippedIPv4(n uint64) uint64 {
+	skipped := n/256*2 + 1
+	if n%256 == 255 {
+		skipped++
+	}
+	return skipped
+}
+
+// Returns the merged ranges, e.g. "192.168.1.1-192.168.1.9,192.168.2.0-192.168.3.0"
+func (self IPRanges) String() string {
+	s := make([]string, 0, len(self.ranges))
+	for _, r := range self.ranges {
+		s = append(s, r.String())
+	}
+	return strings.Join(s, ",")
+}
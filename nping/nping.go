@@ -4,6 +4,7 @@ import (
 	"flag"
 	"fmt"
 	"net"
+	"os"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -14,25 +15,63 @@ import (
 )
 
 var (
-	laddr       = flag.String("laddr", "0.0.0.0:0", "the address of bind, default: '0.0.0.0:0'")
-	network     = flag.String("network", "udp4", "the family of address, default: 'udp4'")
+	laddr       = flag.String("laddr", "0.0.0.0:0", "the address of bind, default: '0.0.0.0:0' ('[::]:0' for IPv6 targets)")
+	network     = flag.String("network", "udp4", "the family of address, default: 'udp4' ('udp6' for IPv6 targets)")
 	timeout     = flag.Int("timeout", 5, "the second of timeout, default: '5'")
 	port        = flag.String("port", "161", "the port of address, default: '161'")
 	communities = flag.String("communities", "public;public1", "the community of snmp")
 	version     = flag.String("version", "v2c", "the version of snmp")
 	username    = flag.String("username", "", "the username of snmp v3")
+	rate        = flag.Int("rate", 0, "the packets per second of sending, default: '0' (unlimited)")
+	retries     = flag.Int("retries", 0, "the retransmissions of a probe, default: '0'")
+	output      = flag.String("output", "text", "the format of output, json|csv|text, default: 'text'")
+	all         = flag.Bool("all", false, "report each community which a host answers, default: only the first one")
+	targetsFile = flag.String("targets", "", "the file of targets, one address, range or CIDR per line")
+	excludes    stringList
 )
 
+func init() {
+	flag.Var(&excludes, "exclude", "the address, range or CIDR which is not probed, it may be repeated")
+}
+
+// stringList is a flag which may be repeated
+type stringList []string
+
+func (self *stringList) String() string {
+	return strings.Join(*self, ",")
+}
+
+func (self *stringList) Set(s string) error {
+	*self = append(*self, s)
+	return nil
+}
+
 func main() {
 	flag.Parse()
 
 	targets := flag.Args()
-	if nil == targets || 1 != len(targets) {
+	if "" != *targetsFile {
+		lines, err := ReadTargets(*targetsFile)
+		if nil != err {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		targets = append(targets, lines...)
+	}
+	if 0 == len(targets) {
 		flag.Usage()
-		return
+		os.Exit(2)
+	}
+
+	writer, err := newRecordWriter(*output, os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
 	}
 
 	scanner := snmpclient2.NewPingers(256)
+	scanner.SetRate(*rate)
+	scanner.SetRetransmission(*retries, time.Duration(*timeout)*time.Second/time.Duration(*retries+1))
 
 	version, err := snmpclient2.ParseVersion(*version)
 	if err != nil {
@@ -40,6 +79,21 @@ func main() {
 		return
 	}
 
+	ip_range, err := ParseIPRanges(targets, excludes)
+	if nil != err {
+		fmt.Println(err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "targets: %s\n", ip_range.Count())
+	if ip_range.IsIPv6() {
+		if "udp4" == *network {
+			*network = "udp6"
+		}
+		if "0.0.0.0:0" == *laddr {
+			*laddr = "[::]:0"
+		}
+	}
+
 	if version == snmpclient2.V3 {
 		e := scanner.ListenV3(*network, *laddr, *username)
 		if nil != e {
@@ -48,7 +102,7 @@ func main() {
 		}
 	} else {
 		for _, community := range strings.Split(*communities, ";") {
-			e := scanner.Listen(*network, *laddr, snmpclient2.V2c, community)
+			e := scanner.Listen(*network, *laddr, version, community)
 			if nil != e {
 				fmt.Println(e)
 				return
@@ -58,13 +112,10 @@ func main() {
 
 	defer scanner.Close()
 
-	ip_range, err := ParseIPRange(targets[0])
-	if nil != err {
-		fmt.Println(err)
-		return
-	}
 	var wait sync.WaitGroup
 	is_stopped := int32(0)
+	probed := 0
+	started_at := time.Now()
 	go func() {
 		for i := 0; i < scanner.Length(); i++ {
 			ip_range.Reset()
@@ -74,11 +125,14 @@ func main() {
 			}
 
 			for ip_range.HasNext() {
-				err = scanner.Send(i, net.JoinHostPort(ip_range.Current().String(), *port))
+				err := scanner.Send(i, net.JoinHostPort(ip_range.Host(), *port), oidSysDescr, oidSysObjectID)
 				if nil != err {
-					fmt.Println(err)
+					fmt.Fprintln(os.Stderr, err)
 					goto end
 				}
+				if 0 == i {
+					probed++
+				}
 			}
 		}
 	end:
@@ -87,17 +141,41 @@ func main() {
 	}()
 	wait.Add(1)
 
+	responders := map[string]bool{}
+	duplicates := 0
+	idle_at := time.Now()
 	for {
-		ra, t, err := scanner.Recv(time.Duration(*timeout) * time.Second)
+		res, err := scanner.RecvResult(100 * time.Millisecond)
 		if nil != err {
-			if err == snmpclient2.TimeoutError {
-				fmt.Println(err)
-			} else if 0 == atomic.LoadInt32(&is_stopped) {
-				continue
+			if 1 == atomic.LoadInt32(&is_stopped) &&
+				(0 == scanner.Pending() || time.Since(idle_at) > time.Duration(*timeout)*time.Second) {
+				break
 			}
+			continue
+		}
+		idle_at = time.Now()
+
+		r := newRecord(&res)
+		if responders[r.Address] && !*all {
+			duplicates++
+			continue
+		}
+		responders[r.Address] = true
+		if err = writer.Write(r); err != nil {
+			fmt.Fprintln(os.Stderr, err)
 			break
 		}
-		fmt.Println(ra, t)
 	}
 	wait.Wait()
+	writer.Flush()
+
+	fmt.Fprintf(os.Stderr, "targets: %d, responders: %d, timeouts: %d, elapsed: %v\n",
+		probed, len(responders), probed-len(responders), time.Since(started_at))
+	if 0 != duplicates {
+		fmt.Fprintf(os.Stderr, "%d responses of the other communities are suppressed, use -all to report them\n", duplicates)
+	}
+	if 0 == len(responders) {
+		scanner.Close()
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/runner-mei/snmpclient2"
+)
+
+var (
+	oidSysDescr    = snmpclient2.MustParseOidFromString("1.3.6.1.2.1.1.1.0")
+	oidSysObjectID = snmpclient2.MustParseOidFromString("1.3.6.1.2.1.1.2.0")
+)
+
+// record is the output of a responding host
+type record struct {
+	Address   string  `json:"address"`
+	LatencyMs float64 `json:"latency_ms"`
+	Version   string  `json:"version"`
+	Community string  `json:"community,omitempty"`
+	Username  string  `json:"username,omitempty"`
+	SysDescr  string  `json:"sys_descr,omitempty"`
+	Error     string  `json:"error,omitempty"`
+}
+
+func newRecord(res *snmpclient2.PingResult) *record {
+	r := &record{
+		LatencyMs: float64(res.Latency) / float64(time.Millisecond),
+		Version:   "v" + res.Version.String(),
+		Community: res.Community,
+		Username:  res.Username,
+	}
+	if nil != res.Addr {
+		r.Address = res.Addr.String()
+	}
+	if vb := res.VariableBindings.MatchOid(oidSysDescr); nil != vb {
+		if v, ok := vb.Variable.(*snmpclient2.OctetString); ok {
+			r.SysDescr = string(v.Value)
+		}
+	}
+	if nil != res.AuthError {
+		r.Error = res.AuthError.Error()
+	}
+	return r
+}
+
+type recordWriter interface {
+	Write(r *record) error
+	Flush() error
+}
+
+// newRecordWriter returns the writer of the format, it is one of "text",
+// "csv" and "json" (newline-delimited objects).
+func newRecordWriter(format string, w io.Writer) (recordWriter, error) {
+	switch format {
+	case "", "text":
+		return &textWriter{w: w}, nil
+	case "csv":
+		return &csvWriter{w: csv.NewWriter(w)}, nil
+	case "json":
+		return &jsonWriter{enc: json.NewEncoder(w)}, nil
+	}
+	return nil, fmt.Errorf("unknown output format - '%s'", format)
+}
+
+type textWriter struct {
+	w io.Writer
+}
+
+func (self *textWriter) Write(r *record) error {
+	name := r.Community
+	if "" == name {
+		name = r.Username
+	}
+	s := fmt.Sprintf("%s %.3fms %s %s", r.Address, r.LatencyMs, r.Version, name)
+	if "" != r.SysDescr {
+		s += " " + strconv.Quote(r.SysDescr)
+	}
+	if "" != r.Error {
+		s += " error: " + r.Error
+	}
+	_, err := fmt.Fprintln(self.w, s)
+	return err
+}
+
+func (self *textWriter) Flush() error {
+	return nil
+}
+
+type csvWriter struct {
+	w             *csv.Writer
+	headerWritten bool
+}
+
+func (self *csvWriter) Write(r *record) error {
+	if !self.headerWritten {
+		self.headerWritten = true
+		if err := self.w.Write([]string{"address", "latency_ms", "version",
+			"community", "username", "sys_descr", "error"}); err != nil {
+			return err
+		}
+	}
+	err := self.w.Write([]string{r.Address, strconv.FormatFloat(r.LatencyMs, 'f', 3, 64),
+		r.Version, r.Community, r.Username, r.SysDescr, r.Error})
+	if err != nil {
+		return err
+	}
+	// flush each record so that the output is streamed
+	self.w.Flush()
+	return self.w.Error()
+}
+
+func (self *csvWriter) Flush() error {
+	self.w.Flush()
+	return self.w.Error()
+}
+
+type jsonWriter struct {
+	enc *json.Encoder
+}
+
+func (self *jsonWriter) Write(r *record) error {
+	return self.enc.Encode(r)
+}
+
+func (self *jsonWriter) Flush() error {
+	return nil
+}
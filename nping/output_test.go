@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/runner-mei/snmpclient2"
+)
+
+func TestRecordWriter(t *testing.T) {
+	res := &snmpclient2.PingResult{
+		Addr:      &net.UDPAddr{IP: net.IPv4(192, 168, 1, 1), Port: 161},
+		Version:   snmpclient2.V2c,
+		Community: "public",
+		Latency:   1500 * time.Microsecond,
+		VariableBindings: snmpclient2.VariableBindings{
+			snmpclient2.NewVarBind(oidSysDescr, snmpclient2.NewOctetString([]byte("Cisco, IOS"))),
+		},
+	}
+
+	for _, test := range []struct {
+		format   string
+		expected string
+	}{
+		{"text", "192.168.1.1:161 1.500ms v2c public \"Cisco, IOS\"\n"},
+		{"csv", "address,latency_ms,version,community,username,sys_descr,error\n" +
+			"192.168.1.1:161,1.500,v2c,public,,\"Cisco, IOS\",\n"},
+		{"json", `{"address":"192.168.1.1:161","latency_ms":1.5,"version":"v2c","community":"public","sys_descr":"Cisco, IOS"}` + "\n"},
+	} {
+		var buf bytes.Buffer
+		w, err := newRecordWriter(test.format, &buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = w.Write(newRecord(res)); err != nil {
+			t.Fatal(err)
+		}
+		w.Flush()
+		if buf.String() != test.expected {
+			t.Errorf("%s - expected [%s], actual [%s]", test.format, test.expected, buf.String())
+		}
+	}
+
+	if _, err := newRecordWriter("xml", &bytes.Buffer{}); err == nil {
+		t.Error("newRecordWriter(xml) - expected an error")
+	}
+}
@@ -0,0 +1,280 @@
+package snmpclient2
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// the link types of the captured packets (http://www.tcpdump.org/linktypes.html)
+const (
+	linkTypeNull      = 0
+	linkTypeEthernet  = 1
+	linkTypeRaw       = 101
+	linkTypeLoop      = 108
+	linkTypeLinuxSLL  = 113
+	linkTypeIPv4      = 228
+	linkTypeIPv6      = 229
+	linkTypeLinuxSLL2 = 276
+)
+
+// the block types of pcapng
+const (
+	pcapngSectionHeader        = 0x0a0d0d0a
+	pcapngInterfaceDescription = 1
+	pcapngSimplePacket         = 3
+	pcapngEnhancedPacket       = 6
+)
+
+// isPcap reports whether text starts with the magic number of a pcap or a
+// pcapng file
+func isPcap(text []byte) bool {
+	if len(text) < 4 {
+		return false
+	}
+	switch binary.LittleEndian.Uint32(text) {
+	case 0xa1b2c3d4, 0xd4c3b2a1, 0xa1b23c4d, 0x4d3cb2a1, pcapngSectionHeader:
+		return true
+	}
+	return false
+}
+
+// ReadPcap reads the variable bindings of the SNMP responses captured in a
+// pcap or a pcapng file, so that a capture of an agent is the data of the
+// simulator. The v1, v2c and the unencrypted v3 responses over UDP of IPv4
+// or IPv6 are decoded, the other packets, the exceptions and the responses
+// of errors are skipped. An OID has the value of its last response.
+func ReadPcap(reader io.Reader, cb func(oid Oid, value Variable) error) error {
+	bs, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+
+	var oids []Oid
+	values := map[string]Variable{}
+	collect := func(linkType uint32, packet []byte) {
+		for _, vb := range responseBindings(udpPayload(linkType, packet)) {
+			key := vb.Oid.ToString()
+			if _, ok := values[key]; !ok {
+				oids = append(oids, vb.Oid)
+			}
+			values[key] = vb.Variable
+		}
+	}
+	if len(bs) >= 4 && pcapngSectionHeader == binary.LittleEndian.Uint32(bs) {
+		err = readPcapng(bs, collect)
+	} else {
+		err = readPcap(bs, collect)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, oid := range oids {
+		if err = cb(oid, values[oid.ToString()]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readPcap calls packet with the packets of a pcap file
+func readPcap(bs []byte, packet func(linkType uint32, data []byte)) error {
+	if len(bs) < 24 {
+		return errors.New("pcap header is truncated")
+	}
+	var order binary.ByteOrder
+	switch binary.LittleEndian.Uint32(bs) {
+	case 0xa1b2c3d4, 0xa1b23c4d:
+		order = binary.LittleEndian
+	case 0xd4c3b2a1, 0x4d3cb2a1:
+		order = binary.BigEndian
+	default:
+		return errors.New("it is not a pcap file")
+	}
+	// the upper bits are the FCS length
+	linkType := order.Uint32(bs[20:]) & 0xffff
+
+	for n, next := 1, bs[24:]; len(next) > 0; n++ {
+		if len(next) < 16 {
+			return fmt.Errorf("packet %d: the header is truncated", n)
+		}
+		size := order.Uint32(next[8:])
+		if uint64(size) > uint64(len(next)-16) {
+			return fmt.Errorf("packet %d: the data is truncated", n)
+		}
+		packet(linkType, next[16:16+size])
+		next = next[16+size:]
+	}
+	return nil
+}
+
+// readPcapng calls packet with the packets of the enhanced and the simple
+// packet blocks of a pcapng file
+func readPcapng(bs []byte, packet func(linkType uint32, data []byte)) error {
+	var order binary.ByteOrder = binary.LittleEndian
+	var linkTypes []uint32 // the interfaces of the section
+	for n := 1; len(bs) > 0; n++ {
+		if len(bs) < 12 {
+			return fmt.Errorf("block %d: the header is truncated", n)
+		}
+		blockType := order.Uint32(bs)
+		if pcapngSectionHeader == blockType {
+			switch binary.LittleEndian.Uint32(bs[8:]) {
+			case 0x1a2b3c4d:
+				order = binary.LittleEndian
+			case 0x4d3c2b1a:
+				order = binary.BigEndian
+			default:
+				return fmt.Errorf("block %d: the byte-order magic is invalid", n)
+			}
+			linkTypes = nil
+		}
+		size := order.Uint32(bs[4:])
+		if size < 12 || uint64(size) > uint64(len(bs)) {
+			return fmt.Errorf("block %d: the length is invalid", n)
+		}
+		body := bs[8 : size-4]
+
+		switch blockType {
+		case pcapngInterfaceDescription:
+			if len(body) < 8 {
+				return fmt.Errorf("block %d: the interface is truncated", n)
+			}
+			linkTypes = append(linkTypes, uint32(order.Uint16(body)))
+		case pcapngEnhancedPacket:
+			if len(body) < 20 {
+				return fmt.Errorf("block %d: the packet is truncated", n)
+			}
+			id, captured := order.Uint32(body), order.Uint32(body[12:])
+			if uint64(id) >= uint64(len(linkTypes)) || uint64(captured) > uint64(len(body)-20) {
+				return fmt.Errorf("block %d: the packet is invalid", n)
+			}
+			packet(linkTypes[id], body[20:20+captured])
+		case pcapngSimplePacket:
+			if len(body) < 4 || len(linkTypes) == 0 {
+				return fmt.Errorf("block %d: the packet is invalid", n)
+			}
+			// the data is padded to 32 bits
+			data := body[4:]
+			if length := order.Uint32(body); uint64(length) < uint64(len(data)) {
+				data = data[:length]
+			}
+			packet(linkTypes[0], data)
+		}
+		bs = bs[size:]
+	}
+	return nil
+}
+
+// udpPayload returns the payload of the UDP datagram of a captured packet,
+// it is nil if the packet is not UDP. The IP fragments are not reassembled.
+func udpPayload(linkType uint32, data []byte) []byte {
+	etherType := uint16(0)
+	switch linkType {
+	case linkTypeEthernet:
+		if len(data) < 14 {
+			return nil
+		}
+		etherType, data = binary.BigEndian.Uint16(data[12:]), data[14:]
+		for (0x8100 == etherType || 0x88a8 == etherType) && len(data) >= 4 {
+			// the VLAN tags
+			etherType, data = binary.BigEndian.Uint16(data[2:]), data[4:]
+		}
+	case linkTypeNull, linkTypeLoop:
+		// the address family, the IP version is checked below
+		if len(data) < 4 {
+			return nil
+		}
+		data = data[4:]
+	case linkTypeLinuxSLL:
+		if len(data) < 16 {
+			return nil
+		}
+		etherType, data = binary.BigEndian.Uint16(data[14:]), data[16:]
+	case linkTypeLinuxSLL2:
+		if len(data) < 20 {
+			return nil
+		}
+		etherType, data = binary.BigEndian.Uint16(data), data[20:]
+	case linkTypeRaw, linkTypeIPv4, linkTypeIPv6:
+	default:
+		return nil
+	}
+	if 0 != etherType && 0x0800 != etherType && 0x86dd != etherType {
+		return nil
+	}
+	if len(data) == 0 {
+		return nil
+	}
+
+	var segment []byte
+	switch data[0] >> 4 {
+	case 4:
+		if len(data) < 20 {
+			return nil
+		}
+		ihl, total := int(data[0]&0x0f)*4, int(binary.BigEndian.Uint16(data[2:]))
+		if ihl < 20 || total < ihl || total > len(data) || 17 != data[9] {
+			return nil
+		}
+		// the more fragments flag and the fragment offset
+		if 0 != binary.BigEndian.Uint16(data[6:])&0x3fff {
+			return nil
+		}
+		segment = data[ihl:total]
+	case 6:
+		// the extension headers are not supported
+		if len(data) < 40 || 17 != data[6] {
+			return nil
+		}
+		length := int(binary.BigEndian.Uint16(data[4:]))
+		if 40+length > len(data) {
+			return nil
+		}
+		segment = data[40 : 40+length]
+	default:
+		return nil
+	}
+
+	if len(segment) < 8 {
+		return nil
+	}
+	length := int(binary.BigEndian.Uint16(segment[4:]))
+	if length < 8 || length > len(segment) {
+		return nil
+	}
+	return segment[8:length]
+}
+
+// responseBindings returns the variable bindings of a GetResponse without
+// errors, the exceptions are skipped. It is nil if the datagram is not such
+// a response or it is encrypted.
+func responseBindings(bs []byte) VariableBindings {
+	if len(bs) == 0 {
+		return nil
+	}
+	msg, err := decodeMessage(bs)
+	if err != nil {
+		return nil
+	}
+	if v3, ok := msg.(*MessageV3); ok && v3.Privacy() {
+		return nil
+	}
+	pdu := msg.PDU()
+	if GetResponse != pdu.PduType() || NoError != pdu.ErrorStatus() {
+		return nil
+	}
+
+	var vbs VariableBindings
+	for _, vb := range pdu.VariableBindings() {
+		switch vb.Variable.(type) {
+		case *NoSucheObject, *NoSucheInstance, *EndOfMibView:
+			continue
+		}
+		vbs = append(vbs, vb)
+	}
+	return vbs
+}
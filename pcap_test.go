@@ -0,0 +1,225 @@
+package snmpclient2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func marshalCapturedMessage(t *testing.T, pduType PduType, vbs VariableBindings) []byte {
+	pdu := NewPduWithVarBinds(V2c, pduType, vbs)
+	pduBytes, err := pdu.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := &MessageV1{version: V2c, Community: []byte("public"), pduBytes: pduBytes}
+	b, err := msg.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// ipv4Packet returns the IPv4 packet of the UDP datagram of payload
+func ipv4Packet(payload []byte) []byte {
+	udp := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint16(udp[0:], 161)
+	binary.BigEndian.PutUint16(udp[2:], 40000)
+	binary.BigEndian.PutUint16(udp[4:], uint16(8+len(payload)))
+	udp = append(udp, payload...)
+
+	ip := make([]byte, 20, 20+len(udp))
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:], uint16(20+len(udp)))
+	ip[8], ip[9] = 64, 17
+	copy(ip[12:], []byte{10, 0, 0, 1})
+	copy(ip[16:], []byte{10, 0, 0, 2})
+	return append(ip, udp...)
+}
+
+// ipv6Packet returns the IPv6 packet of the UDP datagram of payload
+func ipv6Packet(payload []byte) []byte {
+	ip := make([]byte, 48, 48+len(payload))
+	ip[0] = 0x60
+	binary.BigEndian.PutUint16(ip[4:], uint16(8+len(payload)))
+	ip[6], ip[7] = 17, 64
+	ip[23], ip[39] = 1, 2
+	binary.BigEndian.PutUint16(ip[40:], 161)
+	binary.BigEndian.PutUint16(ip[42:], 40000)
+	binary.BigEndian.PutUint16(ip[44:], uint16(8+len(payload)))
+	return append(ip, payload...)
+}
+
+func ethernetFrame(packet []byte) []byte {
+	frame := make([]byte, 18, 18+len(packet))
+	// a VLAN tag
+	binary.BigEndian.PutUint16(frame[12:], 0x8100)
+	binary.BigEndian.PutUint16(frame[16:], 0x0800)
+	return append(frame, packet...)
+}
+
+func pcapFile(linkType uint32, packets ...[]byte) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, []uint32{0xa1b2c3d4, 0x00040002, 0, 0, 65535, linkType})
+	for _, p := range packets {
+		binary.Write(&buf, binary.LittleEndian, []uint32{0, 0, uint32(len(p)), uint32(len(p))})
+		buf.Write(p)
+	}
+	return buf.Bytes()
+}
+
+func pcapngBlock(order binary.ByteOrder, blockType uint32, body []byte) []byte {
+	for len(body)%4 != 0 {
+		body = append(body, 0)
+	}
+	b := make([]byte, 8, 12+len(body))
+	order.PutUint32(b, blockType)
+	order.PutUint32(b[4:], uint32(12+len(body)))
+	b = append(b, body...)
+	return append(b, b[4:8]...)
+}
+
+func pcapngFile(order binary.ByteOrder, linkType uint16, packets ...[]byte) []byte {
+	shb := make([]byte, 16)
+	order.PutUint32(shb, 0x1a2b3c4d)
+	order.PutUint16(shb[4:], 1)
+	for i := 8; i < 16; i++ {
+		shb[i] = 0xff
+	}
+	idb := make([]byte, 8)
+	order.PutUint16(idb, linkType)
+	order.PutUint32(idb[4:], 65535)
+
+	b := pcapngBlock(order, pcapngSectionHeader, shb)
+	b = append(b, pcapngBlock(order, pcapngInterfaceDescription, idb)...)
+	for _, p := range packets {
+		epb := make([]byte, 20, 20+len(p))
+		order.PutUint32(epb[12:], uint32(len(p)))
+		order.PutUint32(epb[16:], uint32(len(p)))
+		b = append(b, pcapngBlock(order, pcapngEnhancedPacket, append(epb, p...))...)
+	}
+	return b
+}
+
+func capturedPayloads(t *testing.T) [][]byte {
+	sysDescr, _ := ParseOidFromString("1.3.6.1.2.1.1.1.0")
+	sysName, _ := ParseOidFromString("1.3.6.1.2.1.1.5.0")
+	ifInOctets, _ := ParseOidFromString("1.3.6.1.2.1.2.2.1.10.1")
+	sysLocation, _ := ParseOidFromString("1.3.6.1.2.1.1.6.0")
+
+	return [][]byte{
+		marshalCapturedMessage(t, GetRequest, VariableBindings{{Oid: sysDescr, Variable: NewNull()}}),
+		marshalCapturedMessage(t, GetResponse, VariableBindings{
+			{Oid: sysDescr, Variable: NewOctetString([]byte("Cisco IOS"))},
+			{Oid: ifInOctets, Variable: NewCounter32(100)},
+			{Oid: sysLocation, Variable: NewNoSucheInstance()},
+		}),
+		[]byte("not a SNMP message"),
+		marshalCapturedMessage(t, GetResponse, VariableBindings{
+			{Oid: ifInOctets, Variable: NewCounter32(200)},
+			{Oid: sysName, Variable: NewOctetString([]byte("router"))},
+		}),
+	}
+}
+
+// tracedPcap returns the messages of capturedPayloads written by PcapWriter
+func tracedPcap(t *testing.T) []byte {
+	var buf bytes.Buffer
+	w, err := NewPcapWriter(&buf, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range capturedPayloads(t) {
+		w.Trace(DirectionReceived, p, nil, nil)
+	}
+	if err = w.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+var captured_values = []struct {
+	oid   string
+	value string
+}{
+	{oid: "1.3.6.1.2.1.1.1.0", value: "[octets]436973636f20494f53"},
+	{oid: "1.3.6.1.2.1.2.2.1.10.1", value: "[counter32]200"},
+	{oid: "1.3.6.1.2.1.1.5.0", value: "[octets]726f75746572"},
+}
+
+func TestReadPcap(t *testing.T) {
+	var ethernet, raw [][]byte
+	for _, p := range capturedPayloads(t) {
+		ethernet = append(ethernet, ethernetFrame(ipv4Packet(p)))
+		raw = append(raw, ipv6Packet(p))
+	}
+
+	for _, test := range []struct {
+		name string
+		file []byte
+	}{
+		{"pcap", pcapFile(linkTypeEthernet, ethernet...)},
+		{"pcapng", pcapngFile(binary.LittleEndian, linkTypeRaw, raw...)},
+		{"pcapng big endian", pcapngFile(binary.BigEndian, linkTypeEthernet, ethernet...)},
+		{"PcapWriter", tracedPcap(t)},
+	} {
+		if format := DetectMibFormat(test.file); MibFormatPcap != format {
+			t.Errorf("%s: DetectMibFormat() - expected [pcap], actual [%v]", test.name, format)
+		}
+
+		var actual []string
+		e := ReadPcap(bytes.NewReader(test.file), func(oid Oid, value Variable) error {
+			actual = append(actual, oid.ToString()+" "+value.String())
+			return nil
+		})
+		if nil != e {
+			t.Errorf("%s: ReadPcap() - has error %v", test.name, e)
+			continue
+		}
+		if len(actual) != len(captured_values) {
+			t.Errorf("%s: ReadPcap() - expected %d values, actual %v", test.name, len(captured_values), actual)
+			continue
+		}
+		for i, expected := range captured_values {
+			if s := expected.oid + " " + expected.value; actual[i] != s {
+				t.Errorf("%s: ReadPcap() - expected [%s], actual [%s]", test.name, s, actual[i])
+			}
+		}
+	}
+
+	truncated := pcapFile(linkTypeEthernet, ethernet...)
+	if e := ReadPcap(bytes.NewReader(truncated[:len(truncated)-1]), func(Oid, Variable) error { return nil }); nil == e {
+		t.Errorf("ReadPcap() - expected error of a truncated file")
+	}
+}
+
+func TestUdpServerFromPcap(t *testing.T) {
+	var packets [][]byte
+	for _, p := range capturedPayloads(t) {
+		packets = append(packets, ethernetFrame(ipv4Packet(p)))
+	}
+	dir, err := ioutil.TempDir("", "snmp_pcap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "agent.pcap")
+	if err = ioutil.WriteFile(file, pcapFile(linkTypeEthernet, packets...), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	srv, e := NewUdpServerFromFile("a", "127.0.0.1:0", file, false)
+	if nil != e {
+		t.Fatalf("NewUdpServerFromFile() - has error %v", e)
+	}
+	defer srv.Close()
+	for _, expected := range captured_values {
+		oid, _ := ParseOidFromString(expected.oid)
+		if v := srv.GetValueByOid(srv.mibs, oid); nil == v || v.String() != expected.value {
+			t.Errorf("%s - expected [%s], actual [%v]", expected.oid, expected.value, v)
+		}
+	}
+}
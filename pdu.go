@@ -134,6 +134,12 @@ func (v *VariableBinding) String() string {
 		vtype = ToSyntexString(v.Variable.Syntex())
 		value = escape(v.Variable.ToString())
 	}
+	if r := GetOidResolver(); r != nil {
+		if name, ok := r.Lookup(v.Oid); ok {
+			return fmt.Sprintf(`{"Oid": "%s", "Name": "%s", "Variable": {"Type": "%s", "Value": %s}}`,
+				v.Oid.ToString(), name, vtype, value)
+		}
+	}
 	return fmt.Sprintf(`{"Oid": "%s", "Variable": {"Type": "%s", "Value": %s}}`,
 		v.Oid.ToString(), vtype, value)
 }
@@ -145,6 +151,20 @@ func NewVarBind(oid Oid, val Variable) VariableBinding {
 	}
 }
 
+// NewVarBindFromStrings returns the variable binding of the OID and the
+// value of the type character of snmpset, see NewVariableFromString
+func NewVarBindFromStrings(oid, typeCode, value string) (VariableBinding, error) {
+	o, err := ParseOidFromString(oid)
+	if nil != err {
+		return VariableBinding{}, err
+	}
+	v, err := NewVariableFromString(typeCode, value)
+	if nil != err {
+		return VariableBinding{}, err
+	}
+	return NewVarBind(o, v), nil
+}
+
 type VariableBindings []VariableBinding
 
 // Gets a VariableBinding that matches
@@ -164,7 +184,7 @@ func (v VariableBindings) MatchBaseOids(prefix Oid) VariableBindings {
 	}
 	result := make(VariableBindings, 0)
 	for _, o := range v {
-		if o.Oid.Contains(&prefix) {
+		if prefix.IsPrefixOf(o.Oid) {
 			result = append(result, o)
 		}
 	}
@@ -175,7 +195,7 @@ func (v VariableBindings) MatchBaseOids(prefix Oid) VariableBindings {
 func (v VariableBindings) Sort() VariableBindings {
 	c := make(VariableBindings, len(v))
 	copy(c, v)
-	sort.Sort(sortableVarBinds{c})
+	sort.Stable(sortableVarBinds{c})
 	return c
 }
 
@@ -219,7 +239,7 @@ func (v sortableVarBinds) Swap(i, j int) {
 }
 
 func (v sortableVarBinds) Less(i, j int) bool {
-	return v.VariableBindings[i].Oid.Compare(&v.VariableBindings[j].Oid) < 1
+	return v.VariableBindings[i].Oid.CompareTo(v.VariableBindings[j].Oid) < 0
 }
 
 // The protocol data unit of SNMP
@@ -252,6 +272,7 @@ type PDU interface {
 	SetMaxRepetitions(int)
 	AppendVariableBinding(Oid, Variable)
 	VariableBindings() VariableBindings
+	DecodeWarnings() []string
 	Marshal() ([]byte, error)
 	Unmarshal([]byte) (rest []byte, err error)
 	String() string
@@ -269,6 +290,9 @@ type PduV1 struct {
 	GenericTrap      int
 	SpecificTrap     int
 	Timestamp        int
+
+	lenient        bool
+	decodeWarnings []string
 }
 
 func (pdu *PduV1) PduType() PduType {
@@ -322,6 +346,12 @@ func (pdu *PduV1) VariableBindings() VariableBindings {
 	return pdu.variableBindings
 }
 
+// DecodeWarnings returns the variable bindings which are skipped by the
+// lenient decoding, see Arguments.LenientDecoding
+func (pdu *PduV1) DecodeWarnings() []string {
+	return pdu.decodeWarnings
+}
+
 func (pdu *PduV1) Marshal() (b []byte, err error) {
 	var buf []byte
 	raw := asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: int(pdu.pduType), IsCompound: true}
@@ -351,7 +381,8 @@ func (pdu *PduV1) Marshal() (b []byte, err error) {
 		}
 		raw.Bytes = append(raw.Bytes, buf...)
 
-		buf, err = asn1.Marshal(pdu.Timestamp)
+		// time-stamp is TimeTicks
+		buf, err = NewTimeTicks(uint32(pdu.Timestamp)).Marshal()
 		if err != nil {
 			return
 		}
@@ -394,6 +425,9 @@ func (pdu *PduV1) Marshal() (b []byte, err error) {
 }
 
 func (pdu *PduV1) Unmarshal(b []byte) (rest []byte, err error) {
+	if pdu.lenient {
+		b = clampTLV(b)
+	}
 	var raw asn1.RawValue
 	rest, err = asn1.Unmarshal(b, &raw)
 	if err != nil {
@@ -455,8 +489,14 @@ func (pdu *PduV1) Unmarshal(b []byte) (rest []byte, err error) {
 		if err != nil {
 			return
 		}
-		var t asn1.RawValue
-		next, err = asn1.Unmarshal(next, &t)
+		// some agents encode the time-stamp as INTEGER
+		if len(next) > 0 && next[0] == asn1.TagTimeticks {
+			var t TimeTicks
+			next, err = t.Unmarshal(next)
+			timestamp = int(t.Value)
+		} else {
+			next, err = asn1.Unmarshal(next, &timestamp)
+		}
 		if err != nil {
 			return
 		}
@@ -477,6 +517,9 @@ func (pdu *PduV1) Unmarshal(b []byte) (rest []byte, err error) {
 		}
 	}
 
+	if pdu.lenient {
+		next = clampTLV(next)
+	}
 	var VariableBindings asn1.RawValue
 	_, err = asn1.Unmarshal(next, &VariableBindings)
 	if err != nil {
@@ -489,6 +532,12 @@ func (pdu *PduV1) Unmarshal(b []byte) (rest []byte, err error) {
 	}
 
 	next = VariableBindings.Bytes
+	if pdu.lenient {
+		if err = pdu.unmarshalVariableBindingsLenient(next); err != nil {
+			return
+		}
+		next = nil
+	}
 	for len(next) > 0 {
 		var variableBinding VariableBinding
 		next, err = variableBinding.Unmarshal(next)
@@ -553,6 +602,9 @@ func (pdu *ScopedPdu) Marshal() (b []byte, err error) {
 }
 
 func (pdu *ScopedPdu) Unmarshal(b []byte) (rest []byte, err error) {
+	if pdu.lenient {
+		b = clampTLV(b)
+	}
 	var raw asn1.RawValue
 	rest, err = asn1.Unmarshal(b, &raw)
 	if err != nil {
@@ -578,7 +630,7 @@ func (pdu *ScopedPdu) Unmarshal(b []byte) (rest []byte, err error) {
 		return
 	}
 
-	var pduV1 PduV1
+	pduV1 := PduV1{lenient: pdu.lenient}
 	_, err = (&pduV1).Unmarshal(next)
 	if err != nil {
 		return
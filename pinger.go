@@ -2,7 +2,6 @@ package snmpclient2
 
 import (
 	"fmt"
-	"log"
 	"net"
 	"os"
 	"strings"
@@ -24,42 +23,87 @@ func init() {
 	}
 }
 
+// PingResult is a response received by the pinger, Index is the index of
+// the listener which received it, Community and Username are the
+// credential which the agent answered, Latency is measured from the Send of
+// the request and VariableBindings are the values of the probed oids. A
+// host which answers the probes of several listeners is received once by
+// each of them.
 type PingResult struct {
-	Id        int
-	Addr      net.Addr
-	Version   SnmpVersion
-	Community string
-	Username  string
-	Error     error
-	Timestamp time.Time
+	Id               int
+	Index            int
+	Addr             net.Addr
+	Version          SnmpVersion
+	Community        string
+	Username         string
+	Error            error
+	Timestamp        time.Time
+	Latency          time.Duration
+	VariableBindings VariableBindings
+
+	// AuthError is set if the agent answered the discovery but the
+	// authenticated request failed, e.g. a report or time out (V3 specific)
+	AuthError error
+}
+
+// sentKey identifies a request sent by the pinger
+type sentKey struct {
+	addr string
+	id   int
+}
+
+// pingRequest is an outstanding request of the pinger
+type pingRequest struct {
+	at       time.Time // time of the Send
+	oids     []Oid
+	addr     net.Addr
+	bytes    []byte
+	sentAt   time.Time // time of the last transmission
+	retries  int
+	auth     bool // the authenticated request after the discovery (V3 specific)
+	resynced bool
 }
 
 type internal_pinger struct {
 	network      string
 	id           int
+	index        int
 	args         *Arguments
 	conn         net.PacketConn
 	wait         *sync.WaitGroup
 	ch           chan *PingResult
 	is_running   int32
 	cached_bytes []byte
+	logger       *loggerRef
 	mpv1         Security
 	mpv3         Security
+	oids         []Oid
+
+	mutex      sync.Mutex
+	sent       map[sentKey]*pingRequest
+	engines    map[string]*pingEngine
+	master     [2][]byte
+	last_sweep time.Time
+	retries    int
+	interval   time.Duration
 }
 
 // make(chan *PingResult, capacity)
-func newPinger(network, laddr string, wait *sync.WaitGroup, ch chan *PingResult, args *Arguments) (*internal_pinger, error) {
-	c, err := net.ListenPacket(network, laddr)
+func newPinger(network, laddr string, index int, wait *sync.WaitGroup, ch chan *PingResult, args *Arguments, logger *loggerRef) (*internal_pinger, error) {
+	c, err := listenPacket(args.Dialer, network, laddr)
 	if err != nil {
 		return nil, fmt.Errorf("ListenPacket(%q, %q) failed: %v", network, laddr, err)
 	}
 	internal_pinger := &internal_pinger{network: network,
 		id:         1,
+		index:      index,
 		wait:       wait,
 		conn:       c,
 		ch:         ch,
 		args:       args,
+		logger:     logger,
 		is_running: 1,
+		interval:   timeoutDefault,
 		mpv1:       NewCommunity(),
 		mpv3:       NewUsm()}
 
@@ -94,27 +138,54 @@ func (self *internal_pinger) GetChannel() <-chan *PingResult {
 var emptyParams = map[string]string{}
 
 func (self *internal_pinger) SendWith(raddr string) error {
-	ra, err := net.ResolveUDPAddr(self.network, raddr)
+	ra, err := self.resolve(raddr)
 	if err != nil {
-		return fmt.Errorf("ResolveIPAddr(%q, %q) failed: %v", self.network, raddr, err)
+		return err
 	}
 	return self.Send(0, ra, nil)
 }
 
-func (self *internal_pinger) Send(id int, ra *net.UDPAddr, args *Arguments) error {
+// resolve resolves the address of the target, an IPv6 literal may be
+// without the brackets and may have a zone, e.g. "fe80::1%eth0".
+func (self *internal_pinger) resolve(raddr string) (*net.UDPAddr, error) {
+	address, err := normalizeAddress(raddr, "161")
+	if err != nil {
+		return nil, err
+	}
+	ra, err := net.ResolveUDPAddr(self.network, address)
+	if err != nil {
+		return nil, fmt.Errorf("ResolveIPAddr(%q, %q) failed: %v", self.network, raddr, err)
+	}
+	return ra, nil
+}
+
+// Send sends a GetRequest of the oids to ra, the test oid is requested if
+// no oid is given.
+func (self *internal_pinger) Send(id int, ra *net.UDPAddr, args *Arguments, oids ...Oid) error {
 	if 0 == id {
-		self.id++
-		id = self.id
+		id = self.nextId()
 	}
 	if args == nil {
 		args = self.args
 	}
+	if 0 == len(oids) {
+		oids = self.oids
+	}
+	if 0 == len(oids) {
+		oids = []Oid{Oid{Value: testOid}}
+	}
+	req := &pingRequest{at: time.Now(), oids: oids}
+	if args == self.args && self.isAuth() {
+		if engine := self.engine(ra.String()); nil != engine {
+			return self.sendAuth(ra, req, engine)
+		}
+	}
 
 	var msg Message
 	switch args.Version {
 	case V1, V2c:
 		//requestId: id, community: community
-		pdu := NewPduWithOids(args.Version, GetRequest, []Oid{Oid{Value: testOid}})
+		pdu := NewPduWithOids(args.Version, GetRequest, oids)
 		pdu.SetRequestId(id)
 		m := &MessageV1{
 			version: args.Version,
@@ -151,7 +222,7 @@ func (self *internal_pinger) Send(id int, ra *net.UDPAddr, args *Arguments) erro
 
 		//pdu = &V3PDU{op: GetRequest, requestId: id, identifier: id,
 		//	securityModel: &USM{auth_proto: SNMP_AUTH_NOAUTH, priv_proto: SNMP_PRIV_NOPRIV}}
-		pdu := NewPdu(args.Version, GetRequest).(*ScopedPdu)
+		pdu := NewPduWithOids(args.Version, GetRequest, oids).(*ScopedPdu)
 		pdu.SetRequestId(id)
 		msg = NewMessage(args.Version, pdu)
 		m := msg.(*MessageV3)
@@ -188,9 +259,10 @@ func (self *internal_pinger) Send(id int, ra *net.UDPAddr, args *Arguments) erro
 		return fmt.Errorf("EncodePDU failed: %v", e)
 	}
 
-	//before_at := time.Now()
+	req.addr = ra
+	req.bytes = bytes
+	self.markSent(ra.String(), id, req)
 	l, err := self.conn.WriteTo(bytes, ra)
-	//send_elapsed = time.Now().Sub(before_at)
 	if err != nil {
 		return fmt.Errorf("WriteTo failed: %v", err)
 	}
@@ -200,6 +272,99 @@ func (self *internal_pinger) Send(id int, ra *net.UDPAddr, args *Arguments) erro
 	return nil
 }
 
+func (self *internal_pinger) nextId() int {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.id++
+	return self.id
+}
+
+func (self *internal_pinger) markSent(addr string, id int, req *pingRequest) {
+	req.sentAt = time.Now()
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if nil == self.sent {
+		self.sent = map[sentKey]*pingRequest{}
+	}
+	self.sent[sentKey{addr: addr, id: id}] = req
+}
+
+func (self *internal_pinger) setRetransmission(retries int, interval time.Duration) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.retries = retries
+	self.interval = interval
+}
+
+func (self *internal_pinger) pending() int {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return len(self.sent)
+}
+
+// sweep retransmits the requests which are not answered in the interval,
+// and drops them if the retries are exhausted. It returns the time to wait
+// before the next sweep.
+func (self *internal_pinger) sweep() time.Duration {
+	now := time.Now()
+	var resend, expired []*pingRequest
+
+	self.mutex.Lock()
+	wait := self.interval
+	if wait > pingSweepInterval {
+		wait = pingSweepInterval
+	} else if wait < 10*time.Millisecond {
+		wait = 10 * time.Millisecond
+	}
+	if now.Sub(self.last_sweep) < wait {
+		self.mutex.Unlock()
+		return wait
+	}
+	self.last_sweep = now
+	for k, req := range self.sent {
+		if now.Sub(req.sentAt) < self.interval {
+			continue
+		}
+		if req.retries < self.retries {
+			req.retries++
+			req.sentAt = now
+			resend = append(resend, req)
+			continue
+		}
+		delete(self.sent, k)
+		if req.auth {
+			expired = append(expired, req)
+		}
+	}
+	self.mutex.Unlock()
+
+	for _, req := range resend {
+		if _, err := self.conn.WriteTo(req.bytes, req.addr); err != nil {
+			self.warnf("[snmp-pinger] failed to retransmit, %v", err)
+		}
+	}
+	for _, req := range expired {
+		self.emitAuth(req.addr, req, nil, TimeoutError)
+	}
+	return wait
+}
+
+// take removes the request of the response, it returns nil if the request
+// is not sent by the pinger.
+func (self *internal_pinger) take(addr net.Addr, id int) *pingRequest {
+	key := sentKey{addr: addr.String(), id: id}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	req, ok := self.sent[key]
+	if !ok {
+		return nil
+	}
+	delete(self.sent, key)
+	return req
+}
+
 func (self *internal_pinger) Recv(timeout time.Duration) (net.Addr, SnmpVersion, error) {
 	select {
 	case res := <-self.ch:
@@ -216,8 +381,13 @@ func (self *internal_pinger) serve() {
 	cached := make([]byte, 4000)
 
 	for 1 == atomic.LoadInt32(&self.is_running) {
+		self.conn.SetReadDeadline(time.Now().Add(self.sweep()))
+
 		l, ra, err := self.conn.ReadFrom(cached)
 		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				continue
+			}
 			if strings.Contains(err.Error(), "No service is operating") { //Port Unreachable
 				continue
 			}
@@ -231,13 +401,13 @@ func (self *internal_pinger) serve() {
 
 		var raw asn1.RawValue
 		if _, err = asn1.Unmarshal(recv_bytes, &raw); err != nil {
-			log.Printf("[snmp-pinger] Invalid Message object - %s : [%s]",
+			self.warnf("[snmp-pinger] Invalid Message object - %s : [%s]",
 				err.Error(), ToHexStr(recv_bytes, " "))
 			continue
 		}
 
 		if raw.Class != asn1.ClassUniversal || raw.Tag != asn1.TagSequence || !raw.IsCompound {
-			log.Printf("[snmp-pinger] Invalid Message object - Class [%02x], Tag [%02x] : [%s]",
+			self.warnf("[snmp-pinger] Invalid Message object - Class [%02x], Tag [%02x] : [%s]",
 				raw.FullBytes[0], raw.Tag, ToHexStr(recv_bytes, " "))
 			continue
 		}
@@ -246,34 +416,45 @@ func (self *internal_pinger) serve() {
 		var version int
 		next, err = asn1.Unmarshal(next, &version)
 		if err != nil {
-			log.Printf("[snmp-pinger] Invalid Message object - %s : [%s]",
+			self.warnf("[snmp-pinger] Invalid Message object - %s : [%s]",
 				err.Error(), ToHexStr(recv_bytes, " "))
 			continue
 		}
 
-		if SnmpVersion(version) == V3 {
-
-			var raw asn1.RawValue
-			_, err := asn1.Unmarshal(next, &raw)
+		if SnmpVersion(version) == V3 && self.isAuth() {
+			self.onAuthResponse(ra, recv_bytes)
+		} else if SnmpVersion(version) == V3 {
+			pdu := &ScopedPdu{}
+			recvMsg := NewMessage(V3, pdu).(*MessageV3)
+			_, err = recvMsg.Unmarshal(recv_bytes)
 			if err != nil {
-				log.Printf("[snmp-pinger/globalDataV3] Failed to Unmarshal message - %s : [%s]",
+				self.warnf("[snmp-pinger/globalDataV3] Failed to Unmarshal message - %s : [%s]",
 					err.Error(), ToHexStr(recv_bytes, " "))
-				return
+				continue
 			}
 
-			var managedId int
-			next, err = asn1.Unmarshal(raw.Bytes, &managedId)
-			if err != nil {
-				log.Printf("[snmp-pinger/managedId] Failed to Unmarshal message - %s : [%s]",
-					err.Error(), ToHexStr(recv_bytes, " "))
+			var vbs VariableBindings
+			if !recvMsg.Privacy() {
+				if _, err = pdu.Unmarshal(recvMsg.PduBytes()); err == nil {
+					vbs = pdu.VariableBindings()
+				}
+			}
+
+			// the response is a duplicate or is too late
+			req := self.take(ra, recvMsg.MessageId)
+			if nil == req {
 				continue
 			}
 
-			self.ch <- &PingResult{Id: managedId,
-				Addr:      ra,
-				Version:   SnmpVersion(version),
-				Username:  self.args.UserName,
-				Timestamp: time.Now()}
+			now := time.Now()
+			self.ch <- &PingResult{Id: recvMsg.MessageId,
+				Index:            self.index,
+				Addr:             ra,
+				Version:          SnmpVersion(version),
+				Username:         self.args.UserName,
+				Timestamp:        now,
+				Latency:          now.Sub(req.at),
+				VariableBindings: vbs}
 		} else {
 			pdu := &PduV1{}
 			recvMsg := &MessageV1{
@@ -282,53 +463,152 @@ func (self *internal_pinger) serve() {
 			}
 			_, err = recvMsg.Unmarshal(recv_bytes)
 			if err != nil {
-				log.Printf("[snmp-pinger] Failed to Unmarshal message - %s : [%s]",
+				self.warnf("[snmp-pinger] Failed to Unmarshal message - %s : [%s]",
 					err.Error(), ToHexStr(recv_bytes, " "))
 				continue
 			}
 
 			_, err = pdu.Unmarshal(recvMsg.PduBytes())
 			if err != nil {
-				log.Printf("[snmp-pinger] Failed to Unmarshal PDU - %s : [%s]",
+				self.warnf("[snmp-pinger] Failed to Unmarshal PDU - %s : [%s]",
 					err.Error(), ToHexStr(recv_bytes, " "))
 				continue
 			}
+			// the response is a duplicate or is too late
+			req := self.take(ra, pdu.RequestId())
+			if nil == req {
+				continue
+			}
+
+			now := time.Now()
 			self.ch <- &PingResult{Id: pdu.RequestId(),
-				Addr:      ra,
-				Version:   SnmpVersion(version),
-				Community: string(recvMsg.Community),
-				Timestamp: time.Now()}
+				Index:            self.index,
+				Addr:             ra,
+				Version:          SnmpVersion(version),
+				Community:        string(recvMsg.Community),
+				Timestamp:        now,
+				Latency:          now.Sub(req.at),
+				VariableBindings: pdu.VariableBindings()}
 		}
 
 	}
 }
 
+// rateLimiter spaces the packets evenly at the rate, it is unlimited if
+// the rate is not positive.
+type rateLimiter struct {
+	mutex    sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func (l *rateLimiter) setRate(packetsPerSecond int) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if packetsPerSecond <= 0 {
+		l.interval = 0
+	} else {
+		l.interval = time.Second / time.Duration(packetsPerSecond)
+	}
+	l.next = time.Time{}
+}
+
+// reserve reserves the next slot and returns the delay before it, nothing
+// is reserved and false is returned if block is false and the slot is not
+// available now.
+func (l *rateLimiter) reserve(block bool) (time.Duration, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if 0 == l.interval {
+		return 0, true
+	}
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	if delay > 0 && !block {
+		return 0, false
+	}
+	l.next = l.next.Add(l.interval)
+	return delay, true
+}
+
+func (l *rateLimiter) wait() {
+	if delay, _ := l.reserve(true); delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
 type Pingers struct {
 	internals []*internal_pinger
 	ch        chan *PingResult
 	wait      sync.WaitGroup
+	dialer    Dialer
+	logger    loggerRef
+	limiter   rateLimiter
+	retries   int
+	interval  time.Duration
 }
 
 func NewPingers(capacity int) *Pingers {
-	return &Pingers{internals: make([]*internal_pinger, 0, 10), ch: make(chan *PingResult, capacity)}
+	return &Pingers{internals: make([]*internal_pinger, 0, 10),
+		ch:       make(chan *PingResult, capacity),
+		interval: timeoutDefault}
+}
+
+// SetRetransmission retransmits each probe up to retries times every
+// interval until the target answers. A probe is pending until it is
+// answered, or the interval is elapsed after the last transmission, the
+// duplicate and the late responses are dropped. The default is no
+// retransmission and 5 seconds.
+func (self *Pingers) SetRetransmission(retries int, interval time.Duration) {
+	if interval <= 0 {
+		interval = timeoutDefault
+	}
+	self.retries = retries
+	self.interval = interval
+	for _, p := range self.internals {
+		p.setRetransmission(retries, interval)
+	}
+}
+
+// Pending returns the number of the probes which are neither answered nor
+// timed out, the sweep is drained if it is 0.
+func (self *Pingers) Pending() int {
+	count := 0
+	for _, p := range self.internals {
+		count += p.pending()
+	}
+	return count
+}
+
+func (self *Pingers) add(p *internal_pinger) {
+	p.setRetransmission(self.retries, self.interval)
+	self.internals = append(self.internals, p)
+}
+
+// SetDialer sets the dialer used by the subsequent Listen calls, the
+// socket is opened by it when it is also a PacketListener.
+func (self *Pingers) SetDialer(dialer Dialer) {
+	self.dialer = dialer
 }
 
 func (self *Pingers) Listen(network, laddr string, version SnmpVersion, community string) error {
-	p, e := newPinger(network, laddr, &self.wait, self.ch, &Arguments{Version: version, Community: community})
+	p, e := newPinger(network, laddr, len(self.internals), &self.wait, self.ch, &Arguments{Version: version, Community: community, Dialer: self.dialer}, &self.logger)
 	if nil != e {
 		return e
 	}
-	self.internals = append(self.internals, p)
+	self.add(p)
 	return nil
 }
 
 func (self *Pingers) ListenV3(network, laddr, userName string) error {
-	p, e := newPinger(network, laddr, &self.wait, self.ch, &Arguments{Version: V3, UserName: userName})
+	p, e := newPinger(network, laddr, len(self.internals), &self.wait, self.ch, &Arguments{Version: V3, UserName: userName, Dialer: self.dialer}, &self.logger)
 	if nil != e {
 		return e
 	}
-
-	self.internals = append(self.internals, p)
+	self.add(p)
 	return nil
 }
 
@@ -348,14 +628,49 @@ func (self *Pingers) Length() int {
 	return len(self.internals)
 }
 
-func (self *Pingers) SendWith(idx int, raddr *net.UDPAddr) error {
-	return self.internals[idx].Send(0, raddr, nil)
+// SetRate limits the probes of all the listeners to packetsPerSecond, Send
+// blocks until the packet is allowed. It is unlimited if packetsPerSecond
+// is not positive, which is the default.
+func (self *Pingers) SetRate(packetsPerSecond int) {
+	self.limiter.setRate(packetsPerSecond)
+}
+
+// SendWith sends a probe by the listener idx, the oids are requested if
+// they are given, otherwise the test oid is requested.
+func (self *Pingers) SendWith(idx int, raddr *net.UDPAddr, oids ...Oid) error {
+	self.limiter.wait()
+	return self.internals[idx].Send(0, raddr, nil, oids...)
+}
+
+// Send sends a probe by the listener idx, the oids are requested if they
+// are given, otherwise the test oid is requested.
+func (self *Pingers) Send(idx int, raddr string, oids ...Oid) error {
+	ra, err := self.resolve(idx, raddr)
+	if err != nil {
+		return err
+	}
+	return self.SendWith(idx, ra, oids...)
+}
+
+// TrySend is same as Send, but it returns WouldBlockError instead of
+// blocking if the rate is exceeded.
+func (self *Pingers) TrySend(idx int, raddr string, oids ...Oid) error {
+	ra, err := self.resolve(idx, raddr)
+	if err != nil {
+		return err
+	}
+	if _, ok := self.limiter.reserve(false); !ok {
+		return WouldBlockError
+	}
+	return self.internals[idx].Send(0, ra, nil, oids...)
 }
 
-func (self *Pingers) Send(idx int, raddr string) error {
-	return self.internals[idx].SendWith(raddr)
+func (self *Pingers) resolve(idx int, raddr string) (*net.UDPAddr, error) {
+	return self.internals[idx].resolve(raddr)
 }
 
+// Recv returns the address and the version of the next response, use
+// RecvResult for the listener and the credential which are answered.
 func (self *Pingers) Recv(timeout time.Duration) (net.Addr, SnmpVersion, error) {
 	timer := time.NewTimer(timeout)
 	select {
@@ -368,16 +683,37 @@ func (self *Pingers) Recv(timeout time.Duration) (net.Addr, SnmpVersion, error)
 	return nil, 0, TimeoutError
 }
 
+// RecvResult returns the next response, the error is TimeoutError if no
+// response is received in the timeout.
+func (self *Pingers) RecvResult(timeout time.Duration) (PingResult, error) {
+	return recvResult(self.ch, timeout)
+}
+
+func recvResult(ch <-chan *PingResult, timeout time.Duration) (PingResult, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case res, ok := <-ch:
+		if !ok {
+			return PingResult{}, fmt.Errorf("pinger is closed")
+		}
+		return *res, res.Error
+	case <-timer.C:
+		return PingResult{}, TimeoutError
+	}
+}
+
 type Pinger struct {
 	internal *internal_pinger
 	ch       chan *PingResult
 	wait     sync.WaitGroup
+	logger   loggerRef
 }
 
 func NewPinger(network, laddr string, capacity int) (*Pinger, error) {
 	self := &Pinger{}
 	self.ch = make(chan *PingResult, capacity)
-	p, e := newPinger(network, laddr, &self.wait, self.ch, &Arguments{Version: V2c, Community: "public"})
+	p, e := newPinger(network, laddr, 0, &self.wait, self.ch, &Arguments{Version: V2c, Community: "public"}, &self.logger)
 	if nil != e {
 		return nil, e
 	}
@@ -405,25 +741,27 @@ func (self *Pinger) SendV2(id int, ra *net.UDPAddr, version SnmpVersion, communi
 }
 
 func (self *Pinger) SendV2With(id int, raddr string, version SnmpVersion, community string) error {
-	ra, err := net.ResolveUDPAddr(self.internal.network, raddr)
+	ra, err := self.internal.resolve(raddr)
 	if err != nil {
-		return fmt.Errorf("ResolveIPAddr(%q, %q) failed: %v", self.internal.network, raddr, err)
+		return err
 	}
 
 	return self.SendV2(id, ra, version, community)
 }
 
 func (self *Pinger) SendV3(id int, raddr, username string) error {
-	ra, err := net.ResolveUDPAddr(self.internal.network, raddr)
+	ra, err := self.internal.resolve(raddr)
 	if err != nil {
-		return fmt.Errorf("ResolveIPAddr(%q, %q) failed: %v", self.internal.network, raddr, err)
+		return err
 	}
 
 	return self.Send(id, ra, &Arguments{Version: V3, UserName: username})
 }
 
-func (self *Pinger) Send(id int, ra *net.UDPAddr, args *Arguments) error {
-	return self.internal.Send(id, ra, args)
+// Send sends a probe to ra, the oids are requested if they are given,
+// otherwise the test oid is requested.
+func (self *Pinger) Send(id int, ra *net.UDPAddr, args *Arguments, oids ...Oid) error {
+	return self.internal.Send(id, ra, args, oids...)
 }
 
 func (self *Pinger) Recv(timeout time.Duration) (net.Addr, SnmpVersion, error) {
@@ -435,3 +773,9 @@ func (self *Pinger) Recv(timeout time.Duration) (net.Addr, SnmpVersion, error) {
 	}
 	return nil, 0, TimeoutError
 }
+
+// RecvResult returns the next response, the error is TimeoutError if no
+// response is received in the timeout.
+func (self *Pinger) RecvResult(timeout time.Duration) (PingResult, error) {
+	return recvResult(self.ch, timeout)
+}
@@ -0,0 +1,279 @@
+package snmpclient2_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/runner-mei/snmpclient2"
+)
+
+func TestPingersRecvResult(t *testing.T) {
+	srv, err := snmpclient2.NewUdpServerFromString("pinger", "127.0.0.1:0",
+		`iso.3.6.1.2.1.1.1.0 = STRING: "Cisco IOS"
+iso.3.6.1.2.1.1.2.0 = OID: iso.3.6.1.4.1.9.1.1`, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	pingers := snmpclient2.NewPingers(16)
+	defer pingers.Close()
+	for _, community := range []string{"public", "private"} {
+		if err := pingers.Listen("udp4", "127.0.0.1:0", snmpclient2.V2c, community); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sysDescr, _ := snmpclient2.ParseOidFromString("1.3.6.1.2.1.1.1.0")
+	sysObjectID, _ := snmpclient2.ParseOidFromString("1.3.6.1.2.1.1.2.0")
+	if err := pingers.Send(1, "127.0.0.1:"+srv.GetPort(), sysDescr, sysObjectID); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := pingers.RecvResult(2 * time.Second)
+	if err != nil {
+		t.Fatalf("RecvResult() - has error %v", err)
+	}
+	if res.Index != 1 || res.Community != "private" || res.Version != snmpclient2.V2c {
+		t.Errorf("RecvResult() - expected [1 private v2c], actual [%d %s %v]", res.Index, res.Community, res.Version)
+	}
+	if res.Latency <= 0 || res.Latency > 2*time.Second {
+		t.Errorf("RecvResult() - latency is invalid, actual [%v]", res.Latency)
+	}
+	if vb := res.VariableBindings.MatchOid(sysDescr); vb == nil || vb.Variable.String() != `[octets]436973636f20494f53` {
+		t.Errorf("RecvResult() - expected [sysDescr], actual [%v]", res.VariableBindings)
+	}
+	if vb := res.VariableBindings.MatchOid(sysObjectID); vb == nil || vb.Variable.String() != "[oid]1.3.6.1.4.1.9.1.1" {
+		t.Errorf("RecvResult() - expected [sysObjectID], actual [%v]", res.VariableBindings)
+	}
+
+	if _, err := pingers.RecvResult(10 * time.Millisecond); err != snmpclient2.TimeoutError {
+		t.Errorf("RecvResult() - expected [%v], actual [%v]", snmpclient2.TimeoutError, err)
+	}
+}
+
+func TestPingersRecvEachCommunity(t *testing.T) {
+	srv, err := snmpclient2.NewUdpServer("pinger", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	for _, community := range []string{"public", "cisco"} {
+		if err = srv.LoadCommunityFromString(community, `iso.3.6.1.2.1.1.1.0 = STRING: "Cisco IOS"`); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pingers := snmpclient2.NewPingers(16)
+	defer pingers.Close()
+	communities := []string{"public", "private", "cisco"}
+	for _, community := range communities {
+		if err = pingers.Listen("udp4", "127.0.0.1:0", snmpclient2.V2c, community); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := range communities {
+		if err = pingers.Send(i, "127.0.0.1:"+srv.GetPort()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	answered := map[int]string{}
+	for i := 0; i < 2; i++ {
+		res, err := pingers.RecvResult(2 * time.Second)
+		if err != nil {
+			t.Fatalf("RecvResult() - has error %v", err)
+		}
+		if res.Community != communities[res.Index] {
+			t.Errorf("RecvResult() - expected [%s] of listener [%d], actual [%s]", communities[res.Index], res.Index, res.Community)
+		}
+		answered[res.Index] = res.Community
+	}
+	if len(answered) != 2 || answered[0] != "public" || answered[2] != "cisco" {
+		t.Errorf("RecvResult() - expected [public cisco], actual %v", answered)
+	}
+	if res, err := pingers.RecvResult(100 * time.Millisecond); err != snmpclient2.TimeoutError {
+		t.Errorf("RecvResult() - expected [%v], actual [%d %s %v]", snmpclient2.TimeoutError, res.Index, res.Community, err)
+	}
+}
+
+func TestPingersRate(t *testing.T) {
+	pingers := snmpclient2.NewPingers(256)
+	defer pingers.Close()
+	if err := pingers.Listen("udp4", "127.0.0.1:0", snmpclient2.V2c, "public"); err != nil {
+		t.Fatal(err)
+	}
+	if err := pingers.Listen("udp4", "127.0.0.1:0", snmpclient2.V2c, "private"); err != nil {
+		t.Fatal(err)
+	}
+
+	// unlimited by default
+	for i := 0; i < 10; i++ {
+		if err := pingers.TrySend(i%2, "127.0.0.1:9"); err != nil {
+			t.Fatalf("TrySend() - has error %v", err)
+		}
+	}
+
+	pingers.SetRate(100)
+	started := time.Now()
+	for i := 0; i < 11; i++ {
+		if err := pingers.Send(i%2, "127.0.0.1:9"); err != nil {
+			t.Fatalf("Send() - has error %v", err)
+		}
+	}
+	if elapsed := time.Since(started); elapsed < 90*time.Millisecond {
+		t.Errorf("Send() - expected [100ms] at least, actual [%v]", elapsed)
+	}
+	if err := pingers.TrySend(0, "127.0.0.1:9"); err != snmpclient2.WouldBlockError {
+		t.Errorf("TrySend() - expected [%v], actual [%v]", snmpclient2.WouldBlockError, err)
+	}
+
+	pingers.SetRate(0)
+	if err := pingers.TrySend(1, "127.0.0.1:9"); err != nil {
+		t.Errorf("TrySend() - has error %v", err)
+	}
+}
+
+func TestPingersListenV3Auth(t *testing.T) {
+	srv, err := snmpclient2.NewUdpServerFromString("pinger", "127.0.0.1:0",
+		`iso.3.6.1.2.1.1.1.0 = STRING: "Cisco IOS"`, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	if err = srv.AddUser(snmpclient2.UsmUser{
+		UserName:     "admin",
+		AuthProtocol: snmpclient2.Sha,
+		AuthPassword: "authpassword",
+		PrivProtocol: snmpclient2.Aes,
+		PrivPassword: "privpassword",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	pingers := snmpclient2.NewPingers(16)
+	defer pingers.Close()
+	if err = pingers.ListenV3Auth("udp4", "127.0.0.1:0", "admin", snmpclient2.AuthPriv,
+		snmpclient2.Sha, "authpassword", snmpclient2.Aes, "privpassword"); err != nil {
+		t.Fatal(err)
+	}
+	if err = pingers.ListenV3Auth("udp4", "127.0.0.1:0", "admin", snmpclient2.AuthPriv,
+		snmpclient2.Sha, "wrongpassword", snmpclient2.Aes, "privpassword"); err != nil {
+		t.Fatal(err)
+	}
+
+	sysDescr, _ := snmpclient2.ParseOidFromString("1.3.6.1.2.1.1.1.0")
+	for i := 0; i < 2; i++ {
+		// the engine is cached by the first time
+		if err = pingers.Send(0, "127.0.0.1:"+srv.GetPort()); err != nil {
+			t.Fatal(err)
+		}
+		res, err := pingers.RecvResult(2 * time.Second)
+		if err != nil {
+			t.Fatalf("RecvResult() - has error %v", err)
+		}
+		if res.AuthError != nil || res.Username != "admin" || res.Version != snmpclient2.V3 {
+			t.Errorf("RecvResult() - expected [admin v3], actual [%s %v %v]", res.Username, res.Version, res.AuthError)
+		}
+		if vb := res.VariableBindings.MatchOid(sysDescr); vb == nil || string(vb.Variable.Bytes()) != "Cisco IOS" {
+			t.Errorf("RecvResult() - expected [sysDescr], actual [%v]", res.VariableBindings)
+		}
+	}
+
+	// alive, but auth failed
+	if err = pingers.Send(1, "127.0.0.1:"+srv.GetPort()); err != nil {
+		t.Fatal(err)
+	}
+	res, err := pingers.RecvResult(2 * time.Second)
+	if err != nil {
+		t.Fatalf("RecvResult() - has error %v", err)
+	}
+	if res.Index != 1 || res.AuthError == nil || res.Addr == nil {
+		t.Errorf("RecvResult() - expected [1 AuthError], actual [%d %v]", res.Index, res.AuthError)
+	} else if rerr, ok := res.AuthError.(snmpclient2.ResponseError); !ok || rerr.Report != "1.3.6.1.6.3.15.1.1.5.0" {
+		t.Errorf("RecvResult() - expected [wrongDigests], actual [%v]", res.AuthError)
+	}
+}
+
+// lossyAgent drops the first requests, and answers the others twice by the
+// simulator
+func lossyAgent(t *testing.T, drops int, agent string) net.PacketConn {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		buf := make([]byte, 4096)
+		for i := 0; ; i++ {
+			n, ra, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if i < drops {
+				continue
+			}
+			c, err := net.Dial("udp4", agent)
+			if err != nil {
+				return
+			}
+			c.Write(buf[:n])
+			c.SetReadDeadline(time.Now().Add(time.Second))
+			res := make([]byte, 4096)
+			if n, err = c.Read(res); err == nil {
+				conn.WriteTo(res[:n], ra)
+				conn.WriteTo(res[:n], ra)
+			}
+			c.Close()
+		}
+	}()
+	return conn
+}
+
+func TestPingersRetransmission(t *testing.T) {
+	srv, err := snmpclient2.NewUdpServerFromString("pinger", "127.0.0.1:0",
+		`iso.3.6.1.2.1.1.2.0 = OID: iso.3.6.1.4.1.9.1.1`, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	lossy := lossyAgent(t, 2, "127.0.0.1:"+srv.GetPort())
+	defer lossy.Close()
+	silent, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+
+	pingers := snmpclient2.NewPingers(16)
+	defer pingers.Close()
+	if err = pingers.Listen("udp4", "127.0.0.1:0", snmpclient2.V2c, "public"); err != nil {
+		t.Fatal(err)
+	}
+	pingers.SetRetransmission(2, 50*time.Millisecond)
+
+	if err = pingers.Send(0, lossy.LocalAddr().String()); err != nil {
+		t.Fatal(err)
+	}
+	if err = pingers.Send(0, silent.LocalAddr().String()); err != nil {
+		t.Fatal(err)
+	}
+	if pending := pingers.Pending(); pending != 2 {
+		t.Errorf("Pending() - expected [2], actual [%d]", pending)
+	}
+
+	res, err := pingers.RecvResult(2 * time.Second)
+	if err != nil {
+		t.Fatalf("RecvResult() - has error %v", err)
+	}
+	if res.Addr.String() != lossy.LocalAddr().String() {
+		t.Errorf("RecvResult() - expected [%s], actual [%s]", lossy.LocalAddr(), res.Addr)
+	}
+	// the duplicate is dropped and the silent target is given up
+	if res, err = pingers.RecvResult(500 * time.Millisecond); err != snmpclient2.TimeoutError {
+		t.Errorf("RecvResult() - expected [%v], actual [%v %v]", snmpclient2.TimeoutError, res.Addr, err)
+	}
+	if pending := pingers.Pending(); pending != 0 {
+		t.Errorf("Pending() - expected [0], actual [%d]", pending)
+	}
+}
@@ -0,0 +1,260 @@
+package snmpclient2
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"fmt"
+	"net"
+	"time"
+)
+
+var oidSysDescr = []int{1, 3, 6, 1, 2, 1, 1, 1, 0}
+
+const (
+	// the discovered engines are discovered again after pingEngineExpire
+	pingEngineExpire = 10 * time.Minute
+	// the outstanding requests are checked every pingSweepInterval at least
+	pingSweepInterval = 500 * time.Millisecond
+)
+
+// pingEngine is the authoritative engine of a target of the pinger
+type pingEngine struct {
+	id           []byte
+	boots        int64
+	time         int64
+	updatedAt    time.Time
+	discoveredAt time.Time
+	authKey      []byte
+	privKey      []byte
+}
+
+// ListenV3Auth listens a pinger of the SNMPv3 user, the engine of each
+// target is discovered at first, and then an authenticated (and encrypted
+// if level is AuthPriv) GetRequest of sysDescr is sent. The engines are
+// cached for a while. The target which answers the discovery only is
+// received with the AuthError.
+func (self *Pingers) ListenV3Auth(network, laddr, userName string, level SecurityLevel,
+	authProto AuthProtocol, authPass string, privProto PrivProtocol, privPass string) error {
+	args := &Arguments{
+		Version:       V3,
+		UserName:      userName,
+		SecurityLevel: level,
+		AuthProtocol:  authProto,
+		AuthPassword:  authPass,
+		PrivProtocol:  privProto,
+		PrivPassword:  privPass,
+		Dialer:        self.dialer,
+	}
+	if err := args.validate(); err != nil {
+		return err
+	}
+	args.setDefault()
+
+	p, e := newPinger(network, laddr, len(self.internals), &self.wait, self.ch, args, &self.logger)
+	if nil != e {
+		return e
+	}
+	p.oids = []Oid{Oid{Value: oidSysDescr}}
+	self.add(p)
+	return nil
+}
+
+func (self *internal_pinger) isAuth() bool {
+	return V3 == self.args.Version && self.args.SecurityLevel > NoAuthNoPriv
+}
+
+// engine returns the cached engine of the target, it is nil if the engine
+// is not discovered or is expired.
+func (self *internal_pinger) engine(addr string) *pingEngine {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	e := self.engines[addr]
+	if nil == e || time.Since(e.discoveredAt) > pingEngineExpire {
+		return nil
+	}
+	copied := *e
+	return &copied
+}
+
+// learnEngine caches the engine of the message and localizes the keys
+func (self *internal_pinger) learnEngine(addr string, msg *MessageV3) *pingEngine {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	now := time.Now()
+	if nil == self.engines {
+		self.engines = map[string]*pingEngine{}
+	}
+	if len(self.engines) >= 4096 {
+		for k, e := range self.engines {
+			if now.Sub(e.discoveredAt) > pingEngineExpire {
+				delete(self.engines, k)
+			}
+		}
+	}
+
+	e := self.engines[addr]
+	if nil == e || !bytes.Equal(e.id, msg.AuthEngineId) {
+		e = &pingEngine{id: append([]byte(nil), msg.AuthEngineId...), discoveredAt: now}
+		if nil == self.master[0] {
+			self.master[0] = passwordToMasterKey(self.args.AuthProtocol, self.args.AuthPassword)
+			if self.args.SecurityLevel >= AuthPriv {
+				self.master[1] = passwordToMasterKey(self.args.AuthProtocol, self.args.PrivPassword)
+			}
+		}
+		e.authKey = localizeKey(self.args.AuthProtocol, self.master[0], e.id)
+		if nil != self.master[1] {
+			e.privKey = extendPrivKey(self.args.AuthProtocol, self.args.PrivProtocol,
+				localizeKey(self.args.AuthProtocol, self.master[1], e.id), e.id)
+		}
+		self.engines[addr] = e
+	}
+	e.boots = msg.AuthEngineBoots
+	e.time = msg.AuthEngineTime
+	e.updatedAt = now
+
+	copied := *e
+	return &copied
+}
+
+// sendAuth sends the authenticated request to the discovered engine
+func (self *internal_pinger) sendAuth(ra net.Addr, req *pingRequest, engine *pingEngine) error {
+	id := self.nextId()
+	pdu := NewPduWithOids(V3, GetRequest, req.oids)
+	pdu.SetRequestId(id)
+	msg := NewMessage(V3, pdu)
+
+	usm := &USM{
+		AuthEngineId:    engine.id,
+		AuthEngineBoots: engine.boots,
+		AuthEngineTime:  engine.time,
+		UpdatedTime:     engine.updatedAt,
+	}
+	args := *self.args
+	args.AuthKey = engine.authKey
+	args.PrivKey = engine.privKey
+	if err := usm.GenerateRequestMessage(&args, msg); err != nil {
+		return err
+	}
+	b, err := msg.Marshal()
+	if err != nil {
+		return fmt.Errorf("EncodePDU failed: %v", err)
+	}
+
+	req.addr = ra
+	req.bytes = b
+	req.auth = true
+	req.retries = 0
+	self.markSent(ra.String(), id, req)
+	if _, err = self.conn.WriteTo(b, ra); err != nil {
+		return fmt.Errorf("WriteTo failed: %v", err)
+	}
+	return nil
+}
+
+// onAuthResponse processes the response of the discovery or of the
+// authenticated request
+func (self *internal_pinger) onAuthResponse(ra net.Addr, recv_bytes []byte) {
+	pdu := &ScopedPdu{}
+	msg := NewMessage(V3, pdu).(*MessageV3)
+	if _, err := msg.Unmarshal(recv_bytes); err != nil {
+		self.warnf("[snmp-pinger/globalDataV3] Failed to Unmarshal message - %s : [%s]",
+			err.Error(), ToHexStr(recv_bytes, " "))
+		return
+	}
+
+	req := self.take(ra, msg.MessageId)
+	if nil == req {
+		return
+	}
+
+	engine := self.engine(ra.String())
+	if !req.auth || nil == engine || !bytes.Equal(engine.id, msg.AuthEngineId) {
+		// the response of the discovery, or the engine is changed
+		if msg.Privacy() {
+			return
+		}
+		if _, err := pdu.Unmarshal(msg.PduBytes()); err != nil {
+			self.warnf("[snmp-pinger] Failed to Unmarshal PDU - %s : [%s]",
+				err.Error(), ToHexStr(recv_bytes, " "))
+			return
+		}
+		if !isReportOf(pdu, usmStatsUnknownEngineIDs) || len(msg.AuthEngineId) == 0 {
+			self.emitAuth(ra, req, pdu, nil)
+			return
+		}
+		if req.auth {
+			if req.resynced {
+				self.emitAuth(ra, req, pdu, nil)
+				return
+			}
+			req.resynced = true
+		}
+		if err := self.sendAuth(ra, req, self.learnEngine(ra.String(), msg)); err != nil {
+			self.emitAuth(ra, req, nil, err)
+		}
+		return
+	}
+
+	args := *self.args
+	args.AuthKey = engine.authKey
+	args.PrivKey = engine.privKey
+	if msg.Authentication() {
+		digest, err := mac(msg, args.AuthProtocol, args.AuthKey)
+		if err != nil || !hmac.Equal(msg.AuthParameter, digest) {
+			self.emitAuth(ra, req, nil, ResponseError{Message: "Failed to authenticate the response"})
+			return
+		}
+	}
+	usm := &USM{AuthEngineId: engine.id}
+	if err := usm.ProcessIncomingMessage(&args, msg); err != nil {
+		self.emitAuth(ra, req, nil, err)
+		return
+	}
+
+	// perhaps the agent has rebooted, follow its boots and time once
+	if isReportOf(pdu, usmStatsNotInTimeWindows) && msg.Authentication() && !req.resynced {
+		req.resynced = true
+		if err := self.sendAuth(ra, req, self.learnEngine(ra.String(), msg)); err != nil {
+			self.emitAuth(ra, req, nil, err)
+		}
+		return
+	}
+	self.emitAuth(ra, req, pdu, nil)
+}
+
+// emitAuth sends the result of the target to the channel, the AuthError is
+// err or the error of the report.
+func (self *internal_pinger) emitAuth(ra net.Addr, req *pingRequest, pdu PDU, err error) {
+	now := time.Now()
+	res := &PingResult{
+		Index:     self.index,
+		Addr:      ra,
+		Version:   V3,
+		Username:  self.args.UserName,
+		Timestamp: now,
+		Latency:   now.Sub(req.at),
+		AuthError: err,
+	}
+	if nil != pdu {
+		res.Id = pdu.RequestId()
+		if Report == pdu.PduType() {
+			res.AuthError = pingReportError(pdu)
+		} else {
+			res.VariableBindings = pdu.VariableBindings()
+		}
+	}
+	self.ch <- res
+}
+
+func pingReportError(pdu PDU) error {
+	var oid string
+	if vbs := pdu.VariableBindings(); len(vbs) > 0 {
+		oid = vbs[0].Oid.ToString()
+	}
+	return ResponseError{
+		Message: fmt.Sprintf("Received a report from the agent - %s(%s)", reportStatusOid(oid), oid),
+		Detail:  fmt.Sprintf("PDU - %s", pdu),
+		Report:  oid,
+	}
+}
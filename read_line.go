@@ -183,16 +183,7 @@ func ParseLine(ss []string, is_end bool) (*Oid, Variable, []string, error) {
 		return nil, nil, nil, empty_line
 	}
 
-	oid_str := strings.Replace(sa[0], "iso", "1", 1)
-	if strings.HasPrefix(oid_str, "so.") {
-		oid_str = "1." + strings.TrimPrefix(oid_str, "so.")
-	}
-	if strings.HasPrefix(oid_str, "o.") {
-		oid_str = "1." + strings.TrimPrefix(oid_str, "o.")
-	}
-	oid_str = strings.Trim(oid_str, ".")
-	oid_str = strings.TrimSpace(oid_str)
-	oid, e := ParseOidFromString(oid_str)
+	oid, e := parseWalkOid(sa[0])
 	if nil != e {
 		return nil, nil, nil, errors.New("parse `" + strings.Join(ss, "\r\n") + "` failed, " + e.Error())
 	}
@@ -220,7 +211,12 @@ func ParseLine(ss []string, is_end bool) (*Oid, Variable, []string, error) {
 	if "Opaque" == t {
 		tv = strings.SplitN(tv[1], ":", 2)
 		if 2 == len(tv) && "Float" == strings.TrimSpace(tv[0]) {
-			return &oid, NewOctetString(bytes.TrimSpace([]byte(tv[1]))), nil, nil
+			v, e := NewFloatFromString(tv[1])
+			return &oid, v, nil, e
+		}
+		if 2 == len(tv) && "Double" == strings.TrimSpace(tv[0]) {
+			v, e := NewDoubleFromString(tv[1])
+			return &oid, v, nil, e
 		}
 
 		v, rr, e := ParseString(ss, is_end, tv[1])
@@ -281,23 +277,65 @@ func ParseLine(ss []string, is_end bool) (*Oid, Variable, []string, error) {
 	return &oid, v, nil, e
 }
 
+// parseWalkOid parses the OID of a snmpwalk line, e.g. "iso.3.6.1.2.1.1.1.0"
+func parseWalkOid(s string) (Oid, error) {
+	oid_str := strings.Replace(s, "iso", "1", 1)
+	if strings.HasPrefix(oid_str, "so.") {
+		oid_str = "1." + strings.TrimPrefix(oid_str, "so.")
+	}
+	if strings.HasPrefix(oid_str, "o.") {
+		oid_str = "1." + strings.TrimPrefix(oid_str, "o.")
+	}
+	oid_str = strings.Trim(oid_str, ".")
+	oid_str = strings.TrimSpace(oid_str)
+	return ParseOidFromString(oid_str)
+}
+
 func Read(reader io.Reader, cb func(oid Oid, value Variable) error) error {
+	return readWalk(reader, false, cb)
+}
+
+// ReadNumeric reads the output of 'snmpwalk -On', unlike Read the lines
+// which can not be parsed are errors with their line numbers.
+func ReadNumeric(reader io.Reader, cb func(oid Oid, value Variable) error) error {
+	return readWalk(reader, true, cb)
+}
+
+func readWalk(reader io.Reader, strict bool, cb func(oid Oid, value Variable) error) error {
 	rd := textproto.NewReader(bufio.NewReader(reader))
 	var line string
 	var s []string
 	var e error
+	var lineno int
+
+	// the line number of s[0]
+	first := func() int {
+		return lineno - len(s) + 1
+	}
+	report := func(e error, n int) error {
+		e = fmt.Errorf("line %d: %v", n, e)
+		if strict {
+			return e
+		}
+		globalLogger.warnf("%v", e)
+		return nil
+	}
+
 	for {
 		line, e = rd.ReadLine()
 		if io.EOF == e {
+			lineno++
 			for nil != s {
+				n := first() - 1
 				oid, value, remain, e := ParseLine(append(s, line), true)
 				if nil != e {
 					if empty_line == e {
 						s = remain
 						continue
 					}
-					// return e
-					fmt.Println(e)
+					if e = report(e, n); nil != e {
+						return e
+					}
 
 					s = remain
 					continue
@@ -318,6 +356,14 @@ func Read(reader io.Reader, cb func(oid Oid, value Variable) error) error {
 		if nil != e {
 			return e
 		}
+		lineno++
+		if strict && 0 == len(s) {
+			simple_line := strings.TrimSpace(line)
+			if "" != simple_line && !strings.HasPrefix(simple_line, "#") &&
+				"End of MIB" != simple_line && !strings.Contains(simple_line, "=") {
+				return fmt.Errorf("line %d: '%s' is not \"oid = type: value\"", lineno, line)
+			}
+		}
 		s = append(s, line)
 	retry:
 		oid, value, remain, e := ParseLine(s, false)
@@ -330,8 +376,9 @@ func Read(reader io.Reader, cb func(oid Oid, value Variable) error) error {
 				continue
 			}
 
-			//return e
-			fmt.Println(e)
+			if e = report(e, first()); nil != e {
+				return e
+			}
 
 			s = remain
 			continue
@@ -37,6 +37,12 @@ func TestParseLine(t *testing.T) {
 		{line: []string{"iso.3.6.1.2.1.2.2.1.10.2 = IpAddress: 12.12.12.0"},
 			oid:   "[oid]1.3.6.1.2.1.2.2.1.10.2",
 			value: "[ip]12.12.12.0"},
+		{line: []string{"iso.3.6.1.4.1.2021.10.1.6.1 = Opaque: Float: 0.080000"},
+			oid:   "[oid]1.3.6.1.4.1.2021.10.1.6.1",
+			value: "[float]0.08"},
+		{line: []string{"iso.3.6.1.4.1.2021.10.1.6.1 = Opaque: Double: 0.080000"},
+			oid:   "[oid]1.3.6.1.4.1.2021.10.1.6.1",
+			value: "[double]0.08"},
 
 		{line: []string{"iso.3.6.1.2.1.1.4.0 = STRING: \"800-810-9119\""},
 			oid:   "[oid]1.3.6.1.2.1.1.4.0",
@@ -0,0 +1,91 @@
+package snmpclient2
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"math"
+	"sync"
+)
+
+// A RequestIdGenerator generates the request ids of the PDUs and the
+// message ids of SNMPv3, the ids are in [1, math.MaxInt32]. It is shared by
+// the requests of an SNMP, so it must be safe for concurrent use.
+type RequestIdGenerator interface {
+	Next() int32
+}
+
+type sequentialRequestIds struct {
+	mutex sync.Mutex
+	last  int32
+}
+
+// NewSequentialRequestIds returns a RequestIdGenerator of the sequential
+// ids from a random id, the ids of two generators differ even if they are
+// created at the same time. The id after math.MaxInt32 is 1.
+func NewSequentialRequestIds() RequestIdGenerator {
+	return &sequentialRequestIds{last: cryptoRandomId() - 1}
+}
+
+func (g *sequentialRequestIds) Next() int32 {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.last >= math.MaxInt32 {
+		g.last = 0
+	}
+	g.last++
+	return g.last
+}
+
+type randomRequestIds struct{}
+
+// NewRandomRequestIds returns a RequestIdGenerator of the ids read from
+// crypto/rand, which are unpredictable to an off-path attacker
+func NewRandomRequestIds() RequestIdGenerator {
+	return randomRequestIds{}
+}
+
+func (randomRequestIds) Next() int32 {
+	return cryptoRandomId()
+}
+
+// cryptoRandomId returns a random id in [1, math.MaxInt32], it falls back
+// to math/rand if crypto/rand fails
+func cryptoRandomId() int32 {
+	var b [4]byte
+	for {
+		var id int32
+		if _, err := rand.Read(b[:]); err == nil {
+			id = int32(binary.BigEndian.Uint32(b[:]) & math.MaxInt32)
+		} else {
+			id = int32(genRequestId())
+		}
+		if id != 0 {
+			return id
+		}
+	}
+}
+
+// requestId returns the next request id by RequestIdGenerator
+func (a *Arguments) requestId() int {
+	if nil != a.RequestIdGenerator {
+		return int(a.RequestIdGenerator.Next())
+	}
+	return genRequestId()
+}
+
+// setRequestId sets a new request id of the PDU. The retransmissions of an
+// InformRequest keep the id, so that the acknowledgment of any of them is
+// accepted
+func setRequestId(snmp *SNMP, pdu PDU) {
+	if pdu.PduType() != InformRequest || pdu.RequestId() == 0 {
+		pdu.SetRequestId(snmp.args.requestId())
+	}
+}
+
+// messageId returns the next message id by RequestIdGenerator (V3 specific)
+func (a *Arguments) messageId() int {
+	if nil != a.RequestIdGenerator {
+		return int(a.RequestIdGenerator.Next())
+	}
+	return genMessageId()
+}
@@ -0,0 +1,100 @@
+package snmpclient2_test
+
+import (
+	"math"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/runner-mei/snmpclient2"
+)
+
+type countingRequestIds struct {
+	last int32
+}
+
+func (g *countingRequestIds) Next() int32 {
+	return atomic.AddInt32(&g.last, 1)
+}
+
+func TestRequestIdGenerator(t *testing.T) {
+	srv, err := snmpclient2.NewUdpServerFromString("ids", "127.0.0.1:0", `iso.3.6.1.2.1.1.5.0 = STRING: "router"`, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	var mutex sync.Mutex
+	var ids []int
+	srv.SetRequestHandlerHook(func(src net.Addr, reqPdu, resPdu snmpclient2.PDU, decodeErr error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		ids = append(ids, reqPdu.RequestId())
+	})
+
+	generator := &countingRequestIds{last: 1000}
+	snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:"+srv.GetPort(), snmpclient2.Arguments{
+		Version:            snmpclient2.V2c,
+		Community:          "public",
+		Timeout:            time.Second,
+		RequestIdGenerator: generator,
+	})
+	defer snmp.Close()
+
+	oids := snmpclient2.MustParseOids("1.3.6.1.2.1.1.5.0")
+	for i := 0; i < 3; i++ {
+		pdu, err := snmp.GetRequest(oids)
+		if err != nil {
+			t.Fatalf("GetRequest() - has error %v", err)
+		}
+		if pdu.RequestId() != 1001+i {
+			t.Errorf("GetRequest() - expected the request id [%d], actual [%d]", 1001+i, pdu.RequestId())
+		}
+	}
+	mutex.Lock()
+	if len(ids) != 3 || ids[0] != 1001 || ids[2] != 1003 {
+		t.Errorf("RequestId() - expected [1001 1002 1003], actual %v", ids)
+	}
+	mutex.Unlock()
+
+	// the message ids of SNMPv3 are generated too
+	v3 := newV3Server(t)
+	defer v3.Close()
+	generator = &countingRequestIds{}
+	args := v3Arguments(snmpclient2.UsmUser{UserName: "md5", AuthProtocol: snmpclient2.Md5, AuthPassword: "md5-password"})
+	args.RequestIdGenerator = generator
+	snmp, _ = snmpclient2.NewSNMP("udp", "127.0.0.1:"+v3.GetPort(), args)
+	defer snmp.Close()
+	if _, err = snmp.GetRequest(oids); err != nil {
+		t.Fatalf("GetRequest(v3) - has error %v", err)
+	}
+	// the request id and the message id of the discovery and the request
+	if n := atomic.LoadInt32(&generator.last); n != 4 {
+		t.Errorf("Next() - expected [4] ids, actual [%d]", n)
+	}
+}
+
+func TestSequentialRequestIds(t *testing.T) {
+	a, b := snmpclient2.NewSequentialRequestIds(), snmpclient2.NewSequentialRequestIds()
+	first, second := a.Next(), a.Next()
+	if first <= 0 || (second != first+1 && !(first == math.MaxInt32 && second == 1)) {
+		t.Errorf("Next() - expected the sequential ids, actual [%d %d]", first, second)
+	}
+	if other := b.Next(); other == first || other == second {
+		t.Errorf("Next() - expected the different ids, actual [%d] and [%d %d]", other, first, second)
+	}
+
+	random := snmpclient2.NewRandomRequestIds()
+	seen := map[int32]bool{}
+	for i := 0; i < 1000; i++ {
+		id := random.Next()
+		if id <= 0 {
+			t.Fatalf("Next() - expected a positive id, actual [%d]", id)
+		}
+		seen[id] = true
+	}
+	if len(seen) < 990 {
+		t.Errorf("Next() - expected the random ids, actual [%d] distinct ids", len(seen))
+	}
+}
@@ -0,0 +1,252 @@
+package snmpclient2
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// An OidResolver translates between the OIDs and the symbolic names
+type OidResolver interface {
+	// Lookup returns the name of oid, e.g. "sysDescr.0" for 1.3.6.1.2.1.1.1.0
+	Lookup(oid Oid) (name string, ok bool)
+	// Resolve returns the OID of name, e.g. 1.3.6.1.2.1.1.1.0 for "sysDescr.0"
+	Resolve(name string) (Oid, error)
+}
+
+var resolverMutex sync.RWMutex
+var resolver OidResolver
+
+// SetOidResolver installs the package-level resolver, nil uninstalls it
+func SetOidResolver(r OidResolver) {
+	resolverMutex.Lock()
+	resolver = r
+	resolverMutex.Unlock()
+}
+
+// GetOidResolver returns the package-level resolver, or nil
+func GetOidResolver() OidResolver {
+	resolverMutex.RLock()
+	defer resolverMutex.RUnlock()
+	return resolver
+}
+
+// ParseOidOrName parses a dotted OID, or a name resolved by the installed
+// OidResolver. NewOids accepts the names too.
+func ParseOidOrName(s string) (Oid, error) {
+	oid, err := ParseOidFromString(s)
+	if err == nil {
+		return oid, nil
+	}
+	if r := GetOidResolver(); r != nil {
+		return r.Resolve(s)
+	}
+	return oid, err
+}
+
+// Name returns the symbolic name of the OID if an OidResolver is installed
+// and knows it, otherwise returns the dotted OID
+func (v *Oid) Name() string {
+	if r := GetOidResolver(); r != nil {
+		if name, ok := r.Lookup(*v); ok {
+			return name
+		}
+	}
+	return v.ToString()
+}
+
+// MapOidResolver is an OidResolver of the names of the objects, the
+// sub-identifiers following an object (e.g. an index) are kept numeric.
+type MapOidResolver struct {
+	names map[string]string // oid -> name
+	oids  map[string]Oid    // name -> oid
+}
+
+// NewMapOidResolver creates a MapOidResolver from the map of name to OID
+func NewMapOidResolver(m map[string]string) (*MapOidResolver, error) {
+	r := &MapOidResolver{names: map[string]string{}, oids: map[string]Oid{}}
+	for name, s := range m {
+		if err := r.Add(name, s); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// LoadOidResolver reads the "name=oid" lines, the blank lines and the lines
+// starting with '#' are ignored.
+func LoadOidResolver(rd io.Reader) (*MapOidResolver, error) {
+	r := &MapOidResolver{names: map[string]string{}, oids: map[string]Oid{}}
+	scanner := bufio.NewScanner(rd)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		idx := strings.IndexByte(line, '=')
+		if idx < 0 {
+			return nil, fmt.Errorf("line %d: '=' is missing - %s", n, line)
+		}
+		if err := r.Add(strings.TrimSpace(line[:idx]), strings.TrimSpace(line[idx+1:])); err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// LoadOidResolverFromFile is LoadOidResolver reading a file
+func LoadOidResolverFromFile(file string) (*MapOidResolver, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return LoadOidResolver(f)
+}
+
+// Add registers name of the oid
+func (r *MapOidResolver) Add(name, oid string) error {
+	if name == "" || strings.ContainsAny(name, ". \t") {
+		return ArgumentError{Value: name, Message: "Illegal name"}
+	}
+	o, err := ParseOidFromString(oid)
+	if err != nil {
+		return err
+	}
+	r.names[o.ToString()] = name
+	r.oids[name] = o
+	return nil
+}
+
+func (r *MapOidResolver) Lookup(oid Oid) (string, bool) {
+	// the longest registered prefix
+	for i := len(oid.Value); i > 0; i-- {
+		prefix := NewOid(oid.Value[:i])
+		if name, ok := r.names[prefix.ToString()]; ok {
+			if i == len(oid.Value) {
+				return name, true
+			}
+			suffix := NewOid(oid.Value[i:])
+			return name + "." + suffix.ToString(), true
+		}
+	}
+	return "", false
+}
+
+func (r *MapOidResolver) Resolve(name string) (Oid, error) {
+	base, suffix := name, ""
+	if idx := strings.IndexByte(name, '.'); idx >= 0 {
+		base, suffix = name[:idx], name[idx+1:]
+	}
+	oid, ok := r.oids[base]
+	if !ok {
+		return Oid{}, ArgumentError{Value: name, Message: "Unknown name"}
+	}
+	if suffix == "" {
+		return NewOid(append([]int(nil), oid.Value...)), nil
+	}
+	subs, err := ParseIntsFromString(suffix)
+	if err != nil {
+		return Oid{}, ArgumentError{Value: name, Message: "Illegal sub-identifiers"}
+	}
+	return NewOid(append(append([]int(nil), oid.Value...), subs...)), nil
+}
+
+// the objects of MIB-2 (RFC1213, RFC2863, RFC3418) known by
+// NewMib2Resolver
+var mib2Names = map[string]string{
+	"sysDescr":           "1.3.6.1.2.1.1.1",
+	"sysObjectID":        "1.3.6.1.2.1.1.2",
+	"sysUpTime":          "1.3.6.1.2.1.1.3",
+	"sysContact":         "1.3.6.1.2.1.1.4",
+	"sysName":            "1.3.6.1.2.1.1.5",
+	"sysLocation":        "1.3.6.1.2.1.1.6",
+	"sysServices":        "1.3.6.1.2.1.1.7",
+	"ifNumber":           "1.3.6.1.2.1.2.1",
+	"ifIndex":            "1.3.6.1.2.1.2.2.1.1",
+	"ifDescr":            "1.3.6.1.2.1.2.2.1.2",
+	"ifType":             "1.3.6.1.2.1.2.2.1.3",
+	"ifMtu":              "1.3.6.1.2.1.2.2.1.4",
+	"ifSpeed":            "1.3.6.1.2.1.2.2.1.5",
+	"ifPhysAddress":      "1.3.6.1.2.1.2.2.1.6",
+	"ifAdminStatus":      "1.3.6.1.2.1.2.2.1.7",
+	"ifOperStatus":       "1.3.6.1.2.1.2.2.1.8",
+	"ifLastChange":       "1.3.6.1.2.1.2.2.1.9",
+	"ifInOctets":         "1.3.6.1.2.1.2.2.1.10",
+	"ifInUcastPkts":      "1.3.6.1.2.1.2.2.1.11",
+	"ifInDiscards":       "1.3.6.1.2.1.2.2.1.13",
+	"ifInErrors":         "1.3.6.1.2.1.2.2.1.14",
+	"ifOutOctets":        "1.3.6.1.2.1.2.2.1.16",
+	"ifOutUcastPkts":     "1.3.6.1.2.1.2.2.1.17",
+	"ifOutDiscards":      "1.3.6.1.2.1.2.2.1.19",
+	"ifOutErrors":        "1.3.6.1.2.1.2.2.1.20",
+	"ipForwarding":       "1.3.6.1.2.1.4.1",
+	"ipAdEntAddr":        "1.3.6.1.2.1.4.20.1.1",
+	"ipAdEntIfIndex":     "1.3.6.1.2.1.4.20.1.2",
+	"ipAdEntNetMask":     "1.3.6.1.2.1.4.20.1.3",
+	"snmpInPkts":         "1.3.6.1.2.1.11.1",
+	"snmpOutPkts":        "1.3.6.1.2.1.11.2",
+	"ifName":             "1.3.6.1.2.1.31.1.1.1.1",
+	"ifHCInOctets":       "1.3.6.1.2.1.31.1.1.1.6",
+	"ifHCOutOctets":      "1.3.6.1.2.1.31.1.1.1.10",
+	"ifHighSpeed":        "1.3.6.1.2.1.31.1.1.1.15",
+	"ifAlias":            "1.3.6.1.2.1.31.1.1.1.18",
+	"snmpTrapOID":        "1.3.6.1.6.3.1.1.4.1",
+	"snmpTrapAddress":    "1.3.6.1.6.3.18.1.3",
+	"snmpTrapEnterprise": "1.3.6.1.6.3.1.1.4.3",
+}
+
+// NewMib2Resolver returns a MapOidResolver of the common objects of MIB-2,
+// e.g. sysUpTime and ifInOctets
+func NewMib2Resolver() *MapOidResolver {
+	r, err := NewMapOidResolver(mib2Names)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// NameBy returns the symbolic name of the OID known by r, r is the
+// package-level resolver if it is nil
+func (v *Oid) NameBy(r OidResolver) string {
+	if r == nil {
+		return v.Name()
+	}
+	if name, ok := r.Lookup(*v); ok {
+		return name
+	}
+	return v.ToString()
+}
+
+// Format returns the text of the variable binding like snmpget, e.g.
+// "sysUpTime.0 = 12345", the OID is named by r or the package-level
+// resolver if r is nil
+func (v *VariableBinding) Format(r OidResolver) string {
+	value := ""
+	if v.Variable != nil {
+		value = v.Variable.ToString()
+	}
+	return v.Oid.NameBy(r) + " = " + value
+}
+
+// Format returns the texts of the variable bindings by lines, see
+// VariableBinding.Format
+func (v VariableBindings) Format(r OidResolver) string {
+	lines := make([]string, 0, len(v))
+	for i := range v {
+		lines = append(lines, v[i].Format(r))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Format returns the texts of the variable bindings of the PDU by lines,
+// the OIDs are named by OidResolver of the Arguments
+func (s *SNMP) Format(pdu PDU) string {
+	return pdu.VariableBindings().Format(s.args.OidResolver)
+}
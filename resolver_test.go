@@ -0,0 +1,79 @@
+package snmpclient2_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/runner-mei/snmpclient2"
+)
+
+func TestOidResolver(t *testing.T) {
+	r, err := snmpclient2.LoadOidResolver(strings.NewReader(`
+# MIB-2 system group
+sysDescr = 1.3.6.1.2.1.1.1
+sysUpTime=1.3.6.1.2.1.1.3
+ifDescr=1.3.6.1.2.1.2.2.1.2
+`))
+	if err != nil {
+		t.Fatalf("LoadOidResolver() - has error %v", err)
+	}
+	snmpclient2.SetOidResolver(r)
+	defer snmpclient2.SetOidResolver(nil)
+
+	oids, err := snmpclient2.NewOids([]string{"sysDescr.0", "ifDescr.3", "1.3.6.1.2.1.1.5.0"})
+	if err != nil {
+		t.Fatalf("NewOids() - has error %v", err)
+	}
+	expected := []string{"1.3.6.1.2.1.1.1.0", "1.3.6.1.2.1.2.2.1.2.3", "1.3.6.1.2.1.1.5.0"}
+	for i, oid := range oids {
+		if oid.ToString() != expected[i] {
+			t.Errorf("NewOids() - expected [%s], actual [%s]", expected[i], oid.ToString())
+		}
+	}
+
+	if name := oids[1].Name(); name != "ifDescr.3" {
+		t.Errorf("Name() - expected [%s], actual [%s]", "ifDescr.3", name)
+	}
+	if name := oids[2].Name(); name != "1.3.6.1.2.1.1.5.0" {
+		t.Errorf("Name() - expected [%s], actual [%s]", "1.3.6.1.2.1.1.5.0", name)
+	}
+
+	vb := snmpclient2.VariableBinding{Oid: oids[0], Variable: snmpclient2.NewOctetString([]byte("x"))}
+	if s := vb.String(); !strings.Contains(s, `"Name": "sysDescr.0"`) {
+		t.Errorf("String() - expected the name, actual [%s]", s)
+	}
+
+	if _, err = snmpclient2.ParseOidOrName("sysName.0"); err == nil {
+		t.Error("ParseOidOrName() - no error for an unknown name")
+	}
+	if _, err = snmpclient2.LoadOidResolver(strings.NewReader("sysDescr 1.3.6")); err == nil ||
+		!strings.Contains(err.Error(), "line 1") {
+		t.Errorf("LoadOidResolver() - expected a line numbered error, actual [%v]", err)
+	}
+}
+
+func TestMib2Resolver(t *testing.T) {
+	r := snmpclient2.NewMib2Resolver()
+	oids, _ := snmpclient2.NewOids([]string{"1.3.6.1.2.1.1.3.0", "1.3.6.1.2.1.31.1.1.1.6.2", "1.3.6.1.4.1.9.1"})
+	if name := oids[1].NameBy(r); name != "ifHCInOctets.2" {
+		t.Errorf("NameBy() - expected [%s], actual [%s]", "ifHCInOctets.2", name)
+	}
+
+	vbs := snmpclient2.VariableBindings{
+		{Oid: oids[0], Variable: snmpclient2.NewTimeTicks(12345)},
+		{Oid: oids[2], Variable: snmpclient2.NewInteger(7)},
+	}
+	expected := "sysUpTime.0 = 12345\n1.3.6.1.4.1.9.1 = 7"
+	if s := vbs.Format(r); s != expected {
+		t.Errorf("Format() - expected [%s], actual [%s]", expected, s)
+	}
+
+	snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1", snmpclient2.Arguments{
+		Version:     snmpclient2.V2c,
+		OidResolver: r,
+	})
+	pdu := snmpclient2.NewPduWithVarBinds(snmpclient2.V2c, snmpclient2.GetResponse, vbs[:1])
+	if s := snmp.Format(pdu); s != "sysUpTime.0 = 12345" {
+		t.Errorf("Format() - expected [%s], actual [%s]", "sysUpTime.0 = 12345", s)
+	}
+}
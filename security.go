@@ -8,6 +8,8 @@ import (
 	"crypto/hmac"
 	"crypto/md5"
 	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -102,6 +104,37 @@ type USM struct {
 	// AuthKey         []byte
 	// PrivKey         []byte
 	UpdatedTime time.Time
+
+	// the keys localized to keyEngineId
+	keyEngineId []byte
+	authKey     []byte
+	privKey     []byte
+}
+
+// localizedKeys returns the keys of args, the keys are localized from the
+// passwords to the authoritative engine if they are not set, and are kept
+// until the engine changes.
+func (u *USM) localizedKeys(args *Arguments) (authKey, privKey []byte) {
+	if !bytes.Equal(u.keyEngineId, u.AuthEngineId) {
+		u.keyEngineId = append([]byte(nil), u.AuthEngineId...)
+		u.authKey, u.privKey = nil, nil
+	}
+
+	authKey, privKey = args.AuthKey, args.PrivKey
+	if len(authKey) == 0 {
+		if u.authKey == nil {
+			u.authKey = PasswordToKey(args.AuthProtocol, args.AuthPassword, u.AuthEngineId)
+		}
+		authKey = u.authKey
+	}
+	if len(privKey) == 0 && args.SecurityLevel >= AuthPriv {
+		if u.privKey == nil {
+			u.privKey = extendPrivKey(args.AuthProtocol, args.PrivProtocol,
+				PasswordToKey(args.AuthProtocol, args.PrivPassword, u.AuthEngineId), u.AuthEngineId)
+		}
+		privKey = u.privKey
+	}
+	return
 }
 
 func (u *USM) IsDiscover() bool {
@@ -120,7 +153,7 @@ func (u *USM) GenerateRequestMessage(args *Arguments, sendMsg Message) (err erro
 	if args.MessageMaxSize > 256 {
 		m.MessageMaxSize = args.MessageMaxSize
 	} else {
-		m.MessageMaxSize = 65507
+		m.MessageMaxSize = udpMessageSizeMax
 	}
 	m.SecurityModel = securityUsm
 
@@ -137,9 +170,11 @@ func (u *USM) GenerateRequestMessage(args *Arguments, sendMsg Message) (err erro
 	m.AuthEngineId = u.AuthEngineId
 	//}
 	// if u.DiscoveryStatus > NoSynchronized {
-	err = u.UpdateEngineBootsTime()
-	if err != nil {
-		return err
+	if !u.UpdatedTime.IsZero() {
+		err = u.UpdateEngineBootsTime()
+		if err != nil {
+			return err
+		}
 	}
 	m.AuthEngineBoots = u.AuthEngineBoots
 	m.AuthEngineTime = u.AuthEngineTime
@@ -164,23 +199,16 @@ func (u *USM) GenerateRequestMessage(args *Arguments, sendMsg Message) (err erro
 	m.SetPduBytes(pduBytes)
 
 	if m.Authentication() {
+		authKey, privKey := u.localizedKeys(args)
+
 		// encrypt PDU
 		if m.Privacy() {
-			privKey := args.PrivKey
-			if len(privKey) == 0 {
-				privKey = PasswordToKey(args.AuthProtocol, args.PrivPassword, u.AuthEngineId)
-			}
 			err = encrypt(m, args.PrivProtocol, privKey)
 			if err != nil {
 				return err
 			}
 		}
 
-		authKey := args.AuthKey
-		if len(authKey) == 0 {
-			authKey = PasswordToKey(args.AuthProtocol, args.AuthPassword, u.AuthEngineId)
-		}
-
 		// get digest of whole message
 		digest, err := mac(m, args.AuthProtocol, authKey)
 		if err != nil {
@@ -257,10 +285,7 @@ func (u *USM) ProcessIncomingMessage(args *Arguments, recvMsg Message) (err erro
 
 		// decrypt PDU
 		if rm.Privacy() {
-			privKey := args.PrivKey
-			if len(privKey) == 0 {
-				privKey = PasswordToKey(args.AuthProtocol, args.PrivPassword, u.AuthEngineId)
-			}
+			_, privKey := u.localizedKeys(args)
 
 			// PrivKey := PasswordToKey(args.AuthProtocol, args.PrivPassword, u.AuthEngineId)
 			e := decrypt(rm, args.PrivProtocol, privKey, rm.PrivParameter)
@@ -309,6 +334,17 @@ func (u *USM) ProcessIncomingMessage(args *Arguments, recvMsg Message) (err erro
 	}
 	p := rm.PDU().(*ScopedPdu)
 
+	// learn the authoritative engine, or follow it after a reboot
+	if len(u.AuthEngineId) == 0 || isReportOf(p, usmStatsUnknownEngineIDs) {
+		u.AuthEngineId = rm.AuthEngineId
+		u.SynchronizeEngineBootsTime(rm.AuthEngineBoots, rm.AuthEngineTime)
+	} else if rm.Authentication() && bytes.Equal(u.AuthEngineId, rm.AuthEngineId) &&
+		(rm.AuthEngineBoots > u.AuthEngineBoots ||
+			(rm.AuthEngineBoots == u.AuthEngineBoots && rm.AuthEngineTime > u.AuthEngineTime) ||
+			isReportOf(p, usmStatsNotInTimeWindows)) {
+		u.SynchronizeEngineBootsTime(rm.AuthEngineBoots, rm.AuthEngineTime)
+	}
+
 	if p.PduType() == GetResponse {
 		// var cxtId []byte
 		// if args.ContextEngineId != "" {
@@ -347,6 +383,14 @@ func (u *USM) ProcessIncomingMessage(args *Arguments, recvMsg Message) (err erro
 // 	}
 // }
 
+func isReportOf(pdu PDU, oid reportStatusOid) bool {
+	if pdu.PduType() != Report {
+		return false
+	}
+	vbs := pdu.VariableBindings()
+	return len(vbs) > 0 && reportStatusOid(vbs[0].Oid.ToString()) == oid
+}
+
 func (u *USM) UpdateEngineBootsTime() error {
 	now := time.Now()
 	u.AuthEngineTime += int64(now.Sub(u.UpdatedTime).Seconds())
@@ -391,8 +435,13 @@ func (u *USM) String() string {
 }
 
 func mac(msg *MessageV3, proto AuthProtocol, key []byte) ([]byte, error) {
+	newHash, macLen := authHash(proto)
+	if newHash == nil {
+		return nil, errors.New("'" + fmt.Sprint(proto) + "' is unsupported hash.")
+	}
+
 	tmp := msg.AuthParameter
-	msg.AuthParameter = padding([]byte{}, 12)
+	msg.AuthParameter = padding([]byte{}, macLen)
 	msgBytes, err := msg.Marshal()
 	msg.AuthParameter = tmp
 	if err != nil {
@@ -402,17 +451,37 @@ func mac(msg *MessageV3, proto AuthProtocol, key []byte) ([]byte, error) {
 	// fmt.Println("=========")
 	// fmt.Println(ToHexStr(msgBytes, ""))
 
-	var h hash.Hash
+	h := hmac.New(newHash, key)
+	h.Write(msgBytes)
+	return h.Sum(nil)[:macLen], nil
+}
+
+// authHash returns the hash of the authentication protocol and the length
+// of the truncated HMAC (RFC3414 Section 6 and 7, RFC7860 Section 4.2.1),
+// the hash is nil if the protocol is unsupported
+func authHash(proto AuthProtocol) (func() hash.Hash, int) {
 	switch proto {
 	case Md5:
-		h = hmac.New(md5.New, key)
+		return md5.New, 12
 	case Sha:
-		h = hmac.New(sha1.New, key)
+		return sha1.New, 12
+	case Sha224:
+		return sha256.New224, 16
+	case Sha256:
+		return sha256.New, 24
+	case Sha384:
+		return sha512.New384, 32
+	case Sha512:
+		return sha512.New, 48
 	default:
-		return nil, errors.New("'" + fmt.Sprint(proto) + "' is unsupported hash.")
+		return nil, 0
 	}
-	h.Write(msgBytes)
-	return h.Sum(nil)[:12], nil
+}
+
+// isAuthProtocol reports whether the authentication protocol is supported
+func isAuthProtocol(proto AuthProtocol) bool {
+	newHash, _ := authHash(proto)
+	return newHash != nil
 }
 
 func encrypt(msg *MessageV3, proto PrivProtocol, key []byte) (err error) {
@@ -425,6 +494,8 @@ func encrypt(msg *MessageV3, proto PrivProtocol, key []byte) (err error) {
 	case Aes:
 		dst, priv, err = EncryptAES(
 			src, key, int32(msg.AuthEngineBoots), int32(msg.AuthEngineTime), genSalt64())
+	case TripleDes:
+		dst, priv, err = EncryptTripleDES(src, key, int32(msg.AuthEngineBoots), genSalt32())
 	default:
 		err = errors.New("'" + fmt.Sprint(proto) + "' is unsupported crypto.")
 	}
@@ -461,6 +532,8 @@ func decrypt(msg *MessageV3, proto PrivProtocol, key, privParam []byte) (err err
 	case Aes:
 		dst, err = DecryptAES(
 			raw.Bytes, key, privParam, int32(msg.AuthEngineBoots), int32(msg.AuthEngineTime))
+	case TripleDes:
+		dst, err = DecryptTripleDES(raw.Bytes, key, privParam)
 	default:
 		err = errors.New("'" + fmt.Sprint(proto) + "' is unsupported crypto.")
 	}
@@ -476,12 +549,17 @@ func EncryptDES(src, key []byte, engineBoots, salt int32) (dst, privParam []byte
 	if err != nil {
 		return
 	}
+	return encryptCBC(block, key[8:16], src, engineBoots, salt)
+}
 
+// encryptCBC encrypts src by the block cipher of DES or DES-EDE3 in CBC
+// mode, the IV is preIV XOR the salt (RFC3414 Section 8.1.1.1)
+func encryptCBC(block cipher.Block, preIV, src []byte, engineBoots, salt int32) (dst, privParam []byte, err error) {
 	var buf bytes.Buffer
 	binary.Write(&buf, binary.BigEndian, engineBoots)
 	binary.Write(&buf, binary.BigEndian, salt)
 	privParam = buf.Bytes()
-	iv := xor(key[8:16], privParam)
+	iv := xor(preIV, privParam)
 
 	src = padding(src, des.BlockSize)
 	dst = make([]byte, len(src))
@@ -492,6 +570,15 @@ func EncryptDES(src, key []byte, engineBoots, salt int32) (dst, privParam []byte
 }
 
 func DecryptDES(src, key, privParam []byte) (dst []byte, err error) {
+	block, err := des.NewCipher(key[:8])
+	if err != nil {
+		return
+	}
+	return decryptCBC(block, key[8:16], src, privParam)
+}
+
+// decryptCBC decrypts src by the block cipher of DES or DES-EDE3 in CBC mode
+func decryptCBC(block cipher.Block, preIV, src, privParam []byte) (dst []byte, err error) {
 	if len(src)%des.BlockSize != 0 {
 		err = ArgumentError{
 			Value:   len(src),
@@ -507,12 +594,7 @@ func DecryptDES(src, key, privParam []byte) (dst []byte, err error) {
 		return
 	}
 
-	block, err := des.NewCipher(key[:8])
-	if err != nil {
-		return
-	}
-
-	iv := xor(key[8:16], privParam)
+	iv := xor(preIV, privParam)
 	dst = make([]byte, len(src))
 
 	mode := cipher.NewCBCDecrypter(block, iv)
@@ -520,6 +602,41 @@ func DecryptDES(src, key, privParam []byte) (dst []byte, err error) {
 	return
 }
 
+// EncryptTripleDES encrypts src by DES-EDE3 in CBC mode, the first 24 octets
+// of the key are the keys of DES-EDE3 and the next 8 octets are the pre-IV
+// (draft-reeder-snmpv3-usm-3desede Section 5.1.1.1)
+func EncryptTripleDES(src, key []byte, engineBoots, salt int32) (dst, privParam []byte, err error) {
+	if err = checkTripleDESKey(key); err != nil {
+		return
+	}
+	block, err := des.NewTripleDESCipher(key[:24])
+	if err != nil {
+		return
+	}
+	return encryptCBC(block, key[24:32], src, engineBoots, salt)
+}
+
+func DecryptTripleDES(src, key, privParam []byte) (dst []byte, err error) {
+	if err = checkTripleDESKey(key); err != nil {
+		return
+	}
+	block, err := des.NewTripleDESCipher(key[:24])
+	if err != nil {
+		return
+	}
+	return decryptCBC(block, key[24:32], src, privParam)
+}
+
+func checkTripleDESKey(key []byte) error {
+	if len(key) < 32 {
+		return ArgumentError{
+			Value:   len(key),
+			Message: "Invalid 3DES key length",
+		}
+	}
+	return nil
+}
+
 func EncryptAES(src, key []byte, engineBoots, engineTime int32, salt int64) (
 	dst, privParam []byte, err error) {
 
@@ -572,17 +689,57 @@ func DecryptAES(src, key, privParam []byte, engineBoots, engineTime int32) (
 	return
 }
 
+// isPrivProtocol reports whether the privacy protocol is supported
+func isPrivProtocol(proto PrivProtocol) bool {
+	return proto == Des || proto == Aes || proto == TripleDes
+}
+
+// privKeyLen returns the octets of the localized key used by the privacy
+// protocol
+func privKeyLen(proto PrivProtocol) int {
+	if proto == TripleDes {
+		return 32
+	}
+	return 16
+}
+
+// extendPrivKey extends the localized key to the length of the privacy
+// protocol, the password-to-key algorithm is chained with the previous key
+// as the password (draft-reeder-snmpv3-usm-3desede Section 2.1)
+func extendPrivKey(auth AuthProtocol, priv PrivProtocol, key, engineId []byte) []byte {
+	for last := key; len(key) < privKeyLen(priv); {
+		last = PasswordToKey(auth, string(last), engineId)
+		key = append(key, last...)
+	}
+	return key
+}
+
+// PasswordToKey returns the key of the password localized to the engine
+// (RFC3414 Section 2.6), which is Arguments.AuthKey of the password. It
+// panics if the authentication protocol is unsupported.
 func PasswordToKey(proto AuthProtocol, password string, engineId []byte) []byte {
-	var h hash.Hash
-	switch proto {
-	case Md5:
-		h = md5.New()
-	case Sha:
-		h = sha1.New()
-	default:
+	return localizeKey(proto, passwordToMasterKey(proto, password), engineId)
+}
+
+// PasswordToPrivKey returns Arguments.PrivKey of the privacy password, it
+// is PasswordToKey extended to the length of the privacy protocol, e.g. 32
+// octets of 3DES.
+func PasswordToPrivKey(auth AuthProtocol, priv PrivProtocol, password string, engineId []byte) []byte {
+	return extendPrivKey(auth, priv, PasswordToKey(auth, password, engineId), engineId)
+}
+
+func newKeyHash(proto AuthProtocol) hash.Hash {
+	newHash, _ := authHash(proto)
+	if newHash == nil {
 		panic("unknow auth protocol")
 	}
+	return newHash()
+}
 
+// passwordToMasterKey returns the Ku of the password (RFC 3414 A.2), it
+// is localized to the engines by localizeKey.
+func passwordToMasterKey(proto AuthProtocol, password string) []byte {
+	h := newKeyHash(proto)
 	pass := []byte(password)
 	plen := len(pass)
 	for i := mega / plen; i > 0; i-- {
@@ -592,13 +749,16 @@ func PasswordToKey(proto AuthProtocol, password string, engineId []byte) []byte
 	if remain > 0 {
 		h.Write(pass[:remain])
 	}
-	ku := h.Sum(nil)
+	return h.Sum(nil)
+}
 
+// localizeKey returns the Kul of the master key ku for the engine
+func localizeKey(proto AuthProtocol, ku, engineId []byte) []byte {
 	// fmt.Println(ToHexStr(ku, ""))
 	// bs, e := generate_keys(crypto.MD5, password)
 	// fmt.Println(ToHexStr(bs, ""), e)
 
-	h.Reset()
+	h := newKeyHash(proto)
 	h.Write(ku)
 	h.Write(engineId)
 	h.Write(ku)
@@ -37,6 +37,19 @@ func TestPasswordToKey(t *testing.T) {
 		t.Errorf("PasswordToKey(Aes) - expected [%s], actual [%s]",
 			snmpclient2.ToHexStr(expBuf, " "), snmpclient2.ToHexStr(key, " "))
 	}
+
+	expBuf, _ = hex.DecodeString("8982e0e549e866db361a6b625d84cccc11162d453ee8ce3a6445c2d6776f0f8b")
+	key = snmpclient2.PasswordToKey(snmpclient2.Sha256, password, engineId)
+	if !bytes.Equal(expBuf, key) {
+		t.Errorf("PasswordToKey(Sha256) - expected [%s], actual [%s]",
+			snmpclient2.ToHexStr(expBuf, " "), snmpclient2.ToHexStr(key, " "))
+	}
+	for proto, size := range map[snmpclient2.AuthProtocol]int{
+		snmpclient2.Sha224: 28, snmpclient2.Sha384: 48, snmpclient2.Sha512: 64} {
+		if key = snmpclient2.PasswordToKey(proto, password, engineId); len(key) != size {
+			t.Errorf("PasswordToKey(%s) - expected [%d] octets, actual [%d]", proto, size, len(key))
+		}
+	}
 }
 
 func TestCipher(t *testing.T) {
@@ -71,6 +84,22 @@ func TestCipher(t *testing.T) {
 	if bytes.Equal(original, result) {
 		t.Errorf("AES Encrypt, Decrypt - expected [%s], actual [%s]", original, result)
 	}
+
+	if _, _, err = snmpclient2.EncryptTripleDES(original, key, engineBoots, 100); err == nil {
+		t.Errorf("3DES Encrypt - expected an error of the key of [%d] octets", len(key))
+	}
+	key = append(key, snmpclient2.PasswordToKey(snmpclient2.Sha, string(key), engineId)...)
+	cipher, priv, err = snmpclient2.EncryptTripleDES(original, key, engineBoots, 100)
+	if err != nil {
+		t.Errorf("3DES Encrypt err %v", err)
+	}
+	result, err = snmpclient2.DecryptTripleDES(cipher, key, priv)
+	if err != nil {
+		t.Errorf("3DES Decrypt err %v", err)
+	}
+	if !bytes.HasPrefix(result, original) || len(cipher)%8 != 0 {
+		t.Errorf("3DES Encrypt, Decrypt - expected [%s], actual [%s]", original, result)
+	}
 }
 
 func TestCommunity(t *testing.T) {
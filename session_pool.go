@@ -0,0 +1,180 @@
+package snmpclient2
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+)
+
+var errPoolClosed = errors.New("SessionPool is closed")
+
+// A SessionPool keeps the idle SNMP objects of the targets, so that a poller
+// of many agents reuses the connections and the discovered engines instead
+// of creating them per poll. The target is the network, the address and the
+// Arguments, the fields which are not marshaled to JSON, e.g. Dialer and
+// TLSConfig, are compared by their identity. A SessionPool is safe for
+// concurrent use.
+type SessionPool struct {
+	mutex       sync.Mutex
+	maxIdle     int
+	maxLifetime time.Duration
+	idles       map[string][]*pooledSession
+	actives     map[*SNMP]*pooledSession
+	closed      bool
+}
+
+type pooledSession struct {
+	snmp    *SNMP
+	key     string
+	created time.Time
+}
+
+// NewSessionPool returns a SessionPool which keeps maxIdle sessions of a
+// target at most, a session is closed after maxLifetime since it is
+// created. The sessions never expire if maxLifetime is 0.
+func NewSessionPool(maxIdle int, maxLifetime time.Duration) *SessionPool {
+	return &SessionPool{
+		maxIdle:     maxIdle,
+		maxLifetime: maxLifetime,
+		idles:       map[string][]*pooledSession{},
+		actives:     map[*SNMP]*pooledSession{},
+	}
+}
+
+func sessionPoolKey(network, address string, args *Arguments) string {
+	return network + "\x00" + address + "\x00" + args.String() + "\x00" +
+		identityOf(args.Dialer) + "\x00" + identityOf(args.TLSConfig) + "\x00" +
+		identityOf(args.EngineCache) + "\x00" + identityOf(args.EngineConfig) + "\x00" +
+		identityOf(args.RequestIdGenerator) + "\x00" + identityOf(args.OidResolver)
+}
+
+// identityOf returns the address of a reference value, or the value itself
+// if it is not a reference
+func identityOf(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Chan, reflect.Func, reflect.Slice, reflect.UnsafePointer:
+		if rv.IsNil() {
+			return ""
+		}
+		return fmt.Sprintf("%T@%x", v, rv.Pointer())
+	}
+	return fmt.Sprintf("%T%#v", v, v)
+}
+
+func (p *SessionPool) expired(ps *pooledSession, now time.Time) bool {
+	return p.maxLifetime > 0 && now.Sub(ps.created) >= p.maxLifetime
+}
+
+// Get returns an idle session of the target or a new one, a new session is
+// opened by its first request. The session must be returned by Put.
+func (p *SessionPool) Get(network, address string, args Arguments) (*SNMP, error) {
+	key := sessionPoolKey(network, address, &args)
+	now := time.Now()
+
+	p.mutex.Lock()
+	if p.closed {
+		p.mutex.Unlock()
+		return nil, errPoolClosed
+	}
+	var expired []*pooledSession
+	for idles := p.idles[key]; len(idles) > 0; {
+		ps := idles[len(idles)-1]
+		idles = idles[:len(idles)-1]
+		p.setIdles(key, idles)
+		if p.expired(ps, now) {
+			expired = append(expired, ps)
+			continue
+		}
+		p.actives[ps.snmp] = ps
+		p.mutex.Unlock()
+		closeSessions(expired)
+		return ps.snmp, nil
+	}
+	p.mutex.Unlock()
+	closeSessions(expired)
+
+	snmp, err := NewSNMP(network, address, args)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mutex.Lock()
+	if p.closed {
+		p.mutex.Unlock()
+		snmp.Close()
+		return nil, errPoolClosed
+	}
+	p.actives[snmp] = &pooledSession{snmp: snmp, key: key, created: now}
+	p.mutex.Unlock()
+	return snmp, nil
+}
+
+// Put returns the session of Get to the pool, it is closed if the idle
+// sessions of the target are full or it is expired.
+func (p *SessionPool) Put(snmp *SNMP) {
+	p.mutex.Lock()
+	ps := p.actives[snmp]
+	delete(p.actives, snmp)
+	if ps != nil && !p.closed && !p.expired(ps, time.Now()) && len(p.idles[ps.key]) < p.maxIdle {
+		p.idles[ps.key] = append(p.idles[ps.key], ps)
+		p.mutex.Unlock()
+		return
+	}
+	p.mutex.Unlock()
+	snmp.Close()
+}
+
+// Do calls fn with a session of the target, and returns the session to the
+// pool after fn returns
+func (p *SessionPool) Do(network, address string, args Arguments, fn func(*SNMP) error) error {
+	snmp, err := p.Get(network, address, args)
+	if err != nil {
+		return err
+	}
+	defer p.Put(snmp)
+	return fn(snmp)
+}
+
+// Idle returns the number of the idle sessions
+func (p *SessionPool) Idle() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	n := 0
+	for _, idles := range p.idles {
+		n += len(idles)
+	}
+	return n
+}
+
+// Close closes the idle sessions, the sessions in use are closed by Put
+func (p *SessionPool) Close() {
+	p.mutex.Lock()
+	var sessions []*pooledSession
+	for key, idles := range p.idles {
+		sessions = append(sessions, idles...)
+		delete(p.idles, key)
+	}
+	p.closed = true
+	p.mutex.Unlock()
+	closeSessions(sessions)
+}
+
+func (p *SessionPool) setIdles(key string, idles []*pooledSession) {
+	if len(idles) == 0 {
+		delete(p.idles, key)
+	} else {
+		p.idles[key] = idles
+	}
+}
+
+func closeSessions(sessions []*pooledSession) {
+	for _, ps := range sessions {
+		ps.snmp.Close()
+	}
+}
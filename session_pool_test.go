@@ -0,0 +1,79 @@
+package snmpclient2_test
+
+import (
+	"crypto/tls"
+	"testing"
+	"time"
+
+	"github.com/runner-mei/snmpclient2"
+)
+
+func TestSessionPool(t *testing.T) {
+	srv, err := snmpclient2.NewUdpServerFromString("pool", "127.0.0.1:0",
+		"iso.3.6.1.2.1.1.1.0 = STRING: \"Test Agent\"\n", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	address := "127.0.0.1:" + srv.GetPort()
+	args := snmpclient2.Arguments{Version: snmpclient2.V2c, Community: "public", Timeout: time.Second}
+	pool := snmpclient2.NewSessionPool(1, 200*time.Millisecond)
+	defer pool.Close()
+
+	first, err := pool.Get("udp", address, args)
+	if err != nil {
+		t.Fatalf("Get() - has error %v", err)
+	}
+	second, _ := pool.Get("udp", address, args)
+	if first == second {
+		t.Error("Get() - expected the different sessions in use")
+	}
+	oids, _ := snmpclient2.NewOids([]string{"1.3.6.1.2.1.1.1.0"})
+	if _, err = first.GetRequest(oids); err != nil {
+		t.Errorf("GetRequest() - has error %v", err)
+	}
+
+	pool.Put(first)
+	pool.Put(second)
+	if n := pool.Idle(); n != 1 {
+		t.Errorf("Idle() - expected [%d], actual [%d]", 1, n)
+	}
+	if snmp, _ := pool.Get("udp", address, args); snmp != first {
+		t.Error("Get() - expected the idle session")
+	} else {
+		pool.Put(snmp)
+	}
+
+	args.Community = "private"
+	if snmp, _ := pool.Get("udp", address, args); snmp == first {
+		t.Error("Get() - expected a new session of other Arguments")
+	}
+	args.Community = "public"
+
+	args.TLSConfig = &tls.Config{}
+	if snmp, _ := pool.Get("udp", address, args); snmp == first {
+		t.Error("Get() - expected a new session of other TLSConfig")
+	}
+	args.TLSConfig = nil
+
+	time.Sleep(250 * time.Millisecond)
+	err = pool.Do("udp", address, args, func(snmp *snmpclient2.SNMP) error {
+		if snmp == first {
+			t.Error("Do() - expected a new session after the lifetime")
+		}
+		_, err := snmp.GetRequest(oids)
+		return err
+	})
+	if err != nil {
+		t.Errorf("Do() - has error %v", err)
+	}
+
+	pool.Close()
+	if n := pool.Idle(); n != 0 {
+		t.Errorf("Idle() - expected [%d], actual [%d]", 0, n)
+	}
+	if _, err = pool.Get("udp", address, args); err == nil {
+		t.Error("Get() - expected an error after Close")
+	}
+}
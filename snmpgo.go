@@ -1,10 +1,16 @@
 package snmpclient2
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"math"
+	"math/rand"
 	"net"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -12,20 +18,88 @@ import (
 type Arguments struct {
 	Version          SnmpVersion   // SNMP version to use
 	Timeout          time.Duration // Request timeout (The default is 5sec)
+	ConnectTimeout   time.Duration // Timeout of dialing and of the engine discovery (The default is Timeout)
 	Retries          uint          // Number of retries (The default is `0`)
+	RetryBackoff     time.Duration // Wait before the first retry, doubled on each retry (The default is `0`)
+	RetryJitter      bool          // Randomize the wait before a retry by ±50%
+	HealthTimeout    time.Duration // Timeout of HealthCheck (The default is 2sec)
 	MessageMaxSize   int           // Maximum size of an SNMP message (The default is `1400`)
 	Community        string        // Community (V1 or V2c specific)
 	UserName         string        // Security name (V3 specific)
-	SecurityLevel    SecurityLevel // Security level (V3 specific)
+	SecurityLevel    SecurityLevel // Security level, always AuthPriv on "tls" and "dtls" (V3 specific)
 	AuthPassword     string        // Authentication protocol pass phrase (V3 specific)
 	AuthProtocol     AuthProtocol  // Authentication protocol (V3 specific)
-	AuthKey          []byte
-	PrivPassword     string       // Privacy protocol pass phrase (V3 specific)
-	PrivProtocol     PrivProtocol // Privacy protocol (V3 specific)
-	PrivKey          []byte
-	SecurityEngineId string // Security engine ID (V3 specific)
-	ContextEngineId  string // Context engine ID (V3 specific)
-	ContextName      string // Context name (V3 specific)
+	AuthKey          []byte        // Authentication key localized to the engine instead of AuthPassword (V3 specific)
+	PrivPassword     string        // Privacy protocol pass phrase (V3 specific)
+	PrivProtocol     PrivProtocol  // Privacy protocol (V3 specific)
+	PrivKey          []byte        // Privacy key localized to the engine instead of PrivPassword (V3 specific)
+	SecurityEngineId string        // Security engine ID (V3 specific)
+	ContextEngineId  string        // Context engine ID (V3 specific)
+	ContextName      string        // Context name (V3 specific)
+	Dialer           Dialer        `json:"-"` // Dialer used by Open (The default is a net.Dialer)
+	LocalAddress     string        // Local IP address (and port) to bind, it is ignored by a custom Dialer
+	CertFile         string        // PEM file of the certificate of the client on "tls" and "dtls" (TSM specific)
+	KeyFile          string        // PEM file of the private key of CertFile (TSM specific)
+	CAFile           string        // PEM file of the CAs of the agent, the system roots if empty (TSM specific)
+	TLSConfig        *tls.Config   `json:"-"` // TLS configuration on "tls" and "dtls", the files above are added to a clone of it (TSM specific)
+
+	// Called whenever the authoritative engine of the agent is learned or
+	// changes (V3 specific)
+	OnEngineDiscovered func(address string, engineId []byte, boots, time int32) `json:"-"`
+	// Accept an engine which differs from SecurityEngineId (V3 specific)
+	AllowEngineIdMismatch bool
+	// Shared cache of the discovered engines, Open skips the discovery if
+	// the engine of the agent is cached (V3 specific)
+	EngineCache *EngineCache `json:"-"`
+	// Local authoritative engine which sends the traps, its boots are kept
+	// over the restarts. SecurityEngineId is the engine ID of the traps
+	// with the boots 1 if it is nil (V3 specific)
+	EngineConfig *EngineConfig `json:"-"`
+	// Do not retransmit a request once when the agent reports that it is
+	// not in the time window, the report synchronizes the engine boots and
+	// time (V3 specific)
+	DisableTimeWindowResync bool
+	// Do not discover the engine again and retransmit a request once when
+	// the agent reports that the engine ID is unknown, e.g. the agent is
+	// replaced (V3 specific)
+	DisableRediscovery bool
+	// Split the request in halves when the agent answers tooBig, and merge
+	// the responses. GetBulkRequest is sent again with the half of
+	// maxRepetitions instead
+	SplitOnTooBig bool
+	// Adapt maxRepetitions of the GetBulkRequests of a walk: it is halved
+	// when the agent answers tooBig or the response is truncated, and is
+	// doubled up to the last failed value while the responses are full.
+	// The next walk of the SNMP starts with the value learned
+	AdaptiveRepetitions bool
+	// Tolerate the malformed BER of non-conformant agents: the non-minimal
+	// integers are accepted, the over-long lengths are clamped to the
+	// available bytes, and a variable binding which is unable to decode is
+	// skipped and is noted in DecodeWarnings of the PDU
+	LenientDecoding bool
+	// Reject the response of GetRequest, GetNextRequest and SetRequest
+	// which does not have the variable bindings of the request, i.e. the
+	// same number of them, and the same OIDs in the same order except of
+	// GetNextRequest
+	StrictResponse bool
+	// GetRequest returns the error status of the response as the error of
+	// ErrorFromPdu, with the response. SetRequest always does
+	ReturnPduErrors bool
+	// Generator of the request ids and the message ids of SNMPv3, e.g.
+	// NewSequentialRequestIds (The default is random ids of math/rand
+	// seeded by crypto/rand)
+	RequestIdGenerator RequestIdGenerator `json:"-"`
+	// Limit of the variable bindings of a walk, the walk is stopped with
+	// a WalkTruncatedError when the agent returns more (The default is
+	// `1000000`)
+	MaxWalkVarBinds int
+	// Limit of the duration of a walk, the walk is stopped with
+	// a WalkTruncatedError before the next request after it (The default
+	// is no limit)
+	MaxWalkDuration time.Duration
+	// Resolver of the symbolic names of the OIDs used by Format of the SNMP
+	// (The default is the package-level resolver of SetOidResolver)
+	OidResolver OidResolver `json:"-"`
 }
 
 func (a *Arguments) setDefault() {
@@ -35,18 +109,76 @@ func (a *Arguments) setDefault() {
 	if a.Timeout <= 0 {
 		a.Timeout = timeoutDefault
 	}
+	if a.ConnectTimeout == 0 {
+		a.ConnectTimeout = a.Timeout
+	}
 	if a.MessageMaxSize == 0 {
 		a.MessageMaxSize = msgSizeDefault
 	}
+	if a.HealthTimeout <= 0 {
+		a.HealthTimeout = healthTimeoutDefault
+	}
+	if a.MaxWalkVarBinds <= 0 {
+		a.MaxWalkVarBinds = maxWalkVarBindsDefault
+	}
+}
+
+// recvSize returns the size of the buffer to receive a datagram
+func (a *Arguments) recvSize() int {
+	if a.MessageMaxSize < recvBufferSize {
+		return recvBufferSize
+	}
+	return a.MessageMaxSize
+}
+
+// newBufferPool returns a pool of the buffers of size octets
+func newBufferPool(size int) *sync.Pool {
+	return &sync.Pool{New: func() interface{} {
+		b := make([]byte, size)
+		return &b
+	}}
+}
+
+// backoff returns the wait before the n-th retry
+func (a *Arguments) backoff(n int) time.Duration {
+	if a.RetryBackoff <= 0 || n < 1 {
+		return 0
+	}
+	d := a.RetryBackoff
+	for i := 1; i < n && d < time.Hour; i++ {
+		d *= 2
+	}
+	if a.RetryJitter {
+		d = d/2 + time.Duration(rand.Int63n(int64(d)))
+	}
+	return d
 }
 
 func (a *Arguments) validate() error {
+	return a.validateFor("udp")
+}
+
+// validateFor validates the Arguments on the network, the protocols and the
+// keys of USM are not used on "tls" and "dtls", which are secured by TSM
+func (a *Arguments) validateFor(network string) error {
 	if v := a.Version; v != V1 && v != V2c && v != V3 {
 		return ArgumentError{
 			Value:   v,
 			Message: "Unknown SNMP Version",
 		}
 	}
+	if a.RetryBackoff < 0 {
+		return ArgumentError{
+			Value:   a.RetryBackoff,
+			Message: "RetryBackoff must not be negative",
+		}
+	}
+	if a.ConnectTimeout < 0 {
+		return ArgumentError{
+			Value:   a.ConnectTimeout,
+			Message: "ConnectTimeout must not be negative",
+		}
+	}
 	// RFC3412 Section 6
 	if m := a.MessageMaxSize; (m != 0 && m < msgSizeMinimum) || m > math.MaxInt32 {
 		return ArgumentError{
@@ -55,6 +187,10 @@ func (a *Arguments) validate() error {
 				msgSizeMinimum, math.MaxInt32),
 		}
 	}
+	if err := a.validateTransport(network); err != nil {
+		return err
+	}
+	usm := !isTsm(network)
 	if a.Version == V3 {
 		// RFC3414 Section 5
 		if l := len(a.UserName); l < 1 || l > 32 {
@@ -63,47 +199,38 @@ func (a *Arguments) validate() error {
 				Message: "UserName length is range 1..32",
 			}
 		}
-		if a.SecurityLevel > NoAuthNoPriv {
-			// RFC3414 Section 11.2
-			if len(a.AuthPassword) < 8 {
-				return ArgumentError{
-					Value:   a.AuthPassword,
-					Message: "AuthPassword is at least 8 characters in length",
-				}
-			}
-			if p := a.AuthProtocol; p != Md5 && p != Sha {
+		if a.SecurityLevel > NoAuthNoPriv && usm {
+			if p := a.AuthProtocol; !isAuthProtocol(p) {
 				return ArgumentError{
 					Value:   a.AuthProtocol,
 					Message: "Illegal AuthProtocol",
 				}
 			}
-		}
-		if a.SecurityLevel > AuthNoPriv {
-			// RFC3414 Section 11.2
-			if len(a.PrivPassword) < 8 {
-				return ArgumentError{
-					Value:   a.PrivPassword,
-					Message: "PrivPassword is at least 8 characters in length",
-				}
+			if err := validateKey("Auth", a.AuthPassword, a.AuthKey, a.AuthProtocol, newKeyHash(a.AuthProtocol).Size()); err != nil {
+				return err
 			}
-			if p := a.PrivProtocol; p != Des && p != Aes {
+		}
+		if a.SecurityLevel > AuthNoPriv && usm {
+			if p := a.PrivProtocol; !isPrivProtocol(p) {
 				return ArgumentError{
 					Value:   a.PrivProtocol,
 					Message: "Illegal PrivProtocol",
 				}
 			}
+			// DES and AES take the first 16 octets of the key, 3DES takes 32
+			if err := validateKey("Priv", a.PrivPassword, a.PrivKey, a.AuthProtocol, privKeyLen(a.PrivProtocol)); err != nil {
+				return err
+			}
 		}
 		if a.SecurityEngineId != "" {
 			a.SecurityEngineId = StripHexPrefix(a.SecurityEngineId)
-			_, err := engineIdToBytes(a.SecurityEngineId)
-			if err != nil {
+			if _, err := ParseEngineId(a.SecurityEngineId); err != nil {
 				return err
 			}
 		}
 		if a.ContextEngineId != "" {
 			a.ContextEngineId = StripHexPrefix(a.ContextEngineId)
-			_, err := engineIdToBytes(a.ContextEngineId)
-			if err != nil {
+			if _, err := ParseEngineId(a.ContextEngineId); err != nil {
 				return err
 			}
 		}
@@ -111,55 +238,264 @@ func (a *Arguments) validate() error {
 	return nil
 }
 
+// validateKey checks the password or the localized key of the protocol,
+// only one of them is accepted. The key is the digest of AuthProtocol
+// (RFC3414 Section 2.6), at least minLen octets of it are required.
+func validateKey(name, password string, key []byte, proto AuthProtocol, minLen int) error {
+	if len(key) == 0 {
+		// RFC3414 Section 11.2
+		if len(password) < 8 {
+			return ArgumentError{
+				Value:   password,
+				Message: name + "Password is at least 8 characters in length",
+			}
+		}
+		return nil
+	}
+	if password != "" {
+		return ArgumentError{
+			Value:   password,
+			Message: name + "Password and " + name + "Key are mutually exclusive",
+		}
+	}
+	max := newKeyHash(proto).Size()
+	if max < minLen {
+		// the key is extended to twice the digest, see extendPrivKey
+		max *= 2
+	}
+	if l := len(key); l < minLen || l > max {
+		return ArgumentError{
+			Value:   l,
+			Message: fmt.Sprintf("%sKey length of %s is range %d..%d", name, proto, minLen, max),
+		}
+	}
+	return nil
+}
+
+// validateBulk checks the version and the arguments of GetBulkRequest
+func (a *Arguments) validateBulk(nonRepeaters, maxRepetitions int) error {
+	if a.Version < V2c {
+		return ArgumentError{
+			Value:   a.Version,
+			Message: "Unsupported SNMP Version",
+		}
+	}
+	// RFC 3416 Section 3
+	if nonRepeaters < 0 || nonRepeaters > math.MaxInt32 {
+		return ArgumentError{
+			Value:   nonRepeaters,
+			Message: fmt.Sprintf("NonRepeaters is range %d..%d", 0, math.MaxInt32),
+		}
+	}
+	if maxRepetitions < 0 || maxRepetitions > math.MaxInt32 {
+		return ArgumentError{
+			Value:   maxRepetitions,
+			Message: fmt.Sprintf("MaxRepetitions is range %d..%d", 0, math.MaxInt32),
+		}
+	}
+	return nil
+}
+
 func (a *Arguments) String() string {
 	return escape(a)
 }
 
-// SNMP Object provides functions for the SNMP Client
+// SNMP Object provides functions for the SNMP Client, it is safe for
+// concurrent use by multiple goroutines, the requests are serialized on the
+// connection.
 type SNMP struct {
-	Network string
-	Address string
-	args    Arguments
-	mp      MessageProcessing
-	conn    net.Conn
+	Network  string
+	Address  string
+	args     Arguments
+	mp       MessageProcessing
+	conn     net.Conn
+	engineId []byte
+	mutex    sync.Mutex // guards the connection and the engine
+
+	localAddr net.Addr
+	tracer    tracer
+	logger    loggerRef
+	stats     *snmpStats
+	sendBuf   []byte      // marshal buffer of the requests, guarded by mutex
+	tlsConfig *tls.Config // the TLS configuration of "tls" and "dtls", nil on the others
+	recvBufs  *sync.Pool  // receive buffers of recvSize octets
+
+	repetitions int32 // maxRepetitions learned by AdaptiveRepetitions
 }
 
 // Open a connection
 func (s *SNMP) Open() (err error) {
+	return s.OpenContext(context.Background())
+}
+
+// OpenContext is Open that aborts when ctx is done, e.g. the discovery of
+// SNMPv3
+func (s *SNMP) OpenContext(ctx context.Context) (err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.open(ctx)
+}
+
+func (s *SNMP) open(ctx context.Context) (err error) {
 	if s.conn != nil {
 		return
 	}
+	if err = s.connect(ctx); err != nil {
+		return
+	}
+
+	err = retry(ctx, int(s.args.Retries), s.args.backoff, func() error {
+		if e := ctx.Err(); e != nil {
+			return canceledError(e)
+		}
+		if s.args.Version == V3 {
+			if s.loadEngine() {
+				return s.checkEngine()
+			}
+			if e := s.discover(ctx); e != nil {
+				s.warnf("failed to discover the engine of %s - %v%s", s.Address, e,
+					correlationNote(CorrelationFromContext(ctx)))
+				return e
+			}
+			s.storeEngine()
+		}
+		return nil
+	})
+	if err != nil {
+		s.close()
+		return
+	}
+	return
+}
+
+// connect dials the agent without the discovery
+func (s *SNMP) connect(ctx context.Context) error {
+	if s.conn != nil {
+		return nil
+	}
 	if "" == s.Network {
 		s.Network = "udp"
 	}
-
-	err = retry(int(s.args.Retries), func() error {
-		conn, e := net.DialTimeout(s.Network, s.Address, s.args.Timeout)
+	return retry(ctx, int(s.args.Retries), s.args.backoff, func() error {
+		if s.tlsConfig != nil {
+			conn, e := s.dialTls(ctx)
+			if e == nil {
+				s.conn = conn
+				s.mp = &messageProcessingV3{security: &TSM{}}
+			}
+			return e
+		}
+		conn, e := dial(ctx, s.args.Dialer, s.Network, s.Address, s.args.ConnectTimeout, s.localAddr)
 		if e == nil {
 			s.conn = conn
 			s.mp = NewMessageProcessing(s.args.Version)
 		}
 		return e
 	})
-	if err != nil {
+}
+
+// discover learns the authoritative engine of the agent, and synchronizes
+// the engine boots/time when the messages are authenticated (RFC3414 Section 4)
+func (s *SNMP) discover(ctx context.Context) (err error) {
+	usm, ok := s.mp.Security().(*USM)
+	if !ok {
+		return nil
+	}
+	usm.AuthEngineId = nil
+	usm.SynchronizeEngineBootsTime(0, 0)
+	usm.UpdatedTime = time.Time{}
+
+	args := s.args
+	args.UserName = ""
+	args.SecurityLevel = NoAuthNoPriv
+	args.ContextEngineId = ""
+	args.ContextName = ""
+	if _, err = s.probe(args).sendPdu(ctx, NewPdu(V3, GetRequest)); err != nil {
 		return
 	}
+	if len(usm.AuthEngineId) == 0 {
+		return ResponseError{
+			Message: "Failed to discover the authoritative engine",
+			Detail:  fmt.Sprintf("USM - %s", usm),
+		}
+	}
 
-	err = retry(int(s.args.Retries), func() error {
-		if s.args.Version == V3 {
-			return errors.New("discover is not implemented.") // s.mp.Security().Discover(&s.args)
+	if s.args.SecurityLevel > NoAuthNoPriv && usm.AuthEngineBoots == 0 && usm.AuthEngineTime == 0 {
+		if _, err = s.probe(s.args).sendPdu(ctx, NewPdu(V3, GetRequest)); err != nil {
+			return
 		}
-		return nil
-	})
-	if err != nil {
-		s.Close()
+	}
+	s.debugf("the engine of %s is discovered - id [%s], boots [%d], time [%d]%s", s.Address,
+		ToHexStr(usm.AuthEngineId, ""), usm.AuthEngineBoots, usm.AuthEngineTime,
+		correlationNote(CorrelationFromContext(ctx)))
+	return s.checkEngine()
+}
+
+// probe returns the SNMP of the discovery on the connection, the requests
+// wait for ConnectTimeout instead of Timeout
+func (s *SNMP) probe(args Arguments) *SNMP {
+	args.Timeout = args.ConnectTimeout
+	args.DisableRediscovery = true
+	probe := &SNMP{Network: s.Network, Address: s.Address, args: args, mp: s.mp, conn: s.conn,
+		stats: s.stats, recvBufs: s.recvBufs}
+	probe.tracer.set(s.tracer.handler())
+	probe.logger.set(s.logger.get())
+	return probe
+}
+
+// loadEngine restores the engine of the agent from the EngineCache
+func (s *SNMP) loadEngine() bool {
+	usm, ok := s.mp.Security().(*USM)
+	if !ok || s.args.EngineCache == nil {
+		return false
+	}
+	return usm.load(s.args.EngineCache, s.Address, &s.args)
+}
+
+// storeEngine saves the engine of the agent to the EngineCache
+func (s *SNMP) storeEngine() {
+	usm, ok := s.mp.Security().(*USM)
+	if !ok || s.args.EngineCache == nil || len(usm.AuthEngineId) == 0 {
 		return
 	}
-	return
+	usm.store(s.args.EngineCache, s.Address, &s.args)
+}
+
+// checkEngine reports a newly learned engine to OnEngineDiscovered, and
+// verifies it against the configured SecurityEngineId
+func (s *SNMP) checkEngine() error {
+	usm, ok := s.mp.Security().(*USM)
+	if !ok || len(usm.AuthEngineId) == 0 || bytes.Equal(usm.AuthEngineId, s.engineId) {
+		return nil
+	}
+	s.engineId = append([]byte(nil), usm.AuthEngineId...)
+
+	if s.args.OnEngineDiscovered != nil {
+		s.args.OnEngineDiscovered(s.Address, s.engineId,
+			int32(usm.AuthEngineBoots), int32(usm.AuthEngineTime))
+	}
+
+	if s.args.SecurityEngineId != "" && !s.args.AllowEngineIdMismatch {
+		expected, _ := engineIdToBytes(s.args.SecurityEngineId)
+		if !bytes.Equal(expected, s.engineId) {
+			return EngineIdMismatchError{
+				Address:  s.Address,
+				Expected: expected,
+				Actual:   s.engineId,
+			}
+		}
+	}
+	return nil
 }
 
 // Close a connection
 func (s *SNMP) Close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.close()
+}
+
+func (s *SNMP) close() {
 	if s.conn != nil {
 		s.conn.Close()
 		s.conn = nil
@@ -167,81 +503,199 @@ func (s *SNMP) Close() {
 	}
 }
 
+// SetRequest writes the variable bindings to the agent. The error status of
+// the response, e.g. notWritable, is returned as the error of ErrorFromPdu
+// with the index and the OID of the failed variable binding, and with the
+// response.
 func (s *SNMP) SetRequest(variableBindings VariableBindings) (result PDU, err error) {
-	pdu := NewPduWithVarBinds(s.args.Version, SetRequest, variableBindings)
+	return s.SetRequestContext(context.Background(), variableBindings)
+}
 
-	retry(int(s.args.Retries), func() error {
-		result, err = s.sendPdu(pdu)
-		return err
-	})
+// SetRequestContext is SetRequest that aborts when ctx is done
+func (s *SNMP) SetRequestContext(ctx context.Context, variableBindings VariableBindings) (result PDU, err error) {
+	pdu := NewPduWithVarBinds(s.args.Version, SetRequest, variableBindings)
+	result, _, err = s.request(ctx, pdu)
+	if err == nil {
+		err = ErrorFromPdu(pdu, result)
+	}
 	return
 }
 
 func (s *SNMP) GetRequest(oids Oids) (result PDU, err error) {
-	pdu := NewPduWithOids(s.args.Version, GetRequest, oids)
+	return s.GetRequestContext(context.Background(), oids)
+}
 
-	retry(int(s.args.Retries), func() error {
-		result, err = s.sendPdu(pdu)
-		return err
-	})
+// GetRequestContext is GetRequest that aborts when ctx is done
+func (s *SNMP) GetRequestContext(ctx context.Context, oids Oids) (result PDU, err error) {
+	result, err = s.requestSplit(ctx, GetRequest, oids)
+	if err == nil && s.args.ReturnPduErrors {
+		err = ErrorFromPdu(NewPduWithOids(s.args.Version, GetRequest, oids), result)
+	}
 	return
 }
 
 func (s *SNMP) GetNextRequest(oids Oids) (result PDU, err error) {
-	pdu := NewPduWithOids(s.args.Version, GetNextRequest, oids)
+	return s.GetNextRequestContext(context.Background(), oids)
+}
 
-	retry(int(s.args.Retries), func() error {
-		result, err = s.sendPdu(pdu)
-		return err
-	})
-	return
+// GetNextRequestContext is GetNextRequest that aborts when ctx is done
+func (s *SNMP) GetNextRequestContext(ctx context.Context, oids Oids) (result PDU, err error) {
+	return s.requestSplit(ctx, GetNextRequest, oids)
 }
 
-func (s *SNMP) GetBulkRequest(oids Oids, nonRepeaters, maxRepetitions int) (result PDU, err error) {
+// requestSplit sends the request of the oids, the oids are split in halves
+// recursively if the agent answers tooBig and SplitOnTooBig is set. The
+// variable bindings of the halves are merged in the order of the oids.
+func (s *SNMP) requestSplit(ctx context.Context, pduType PduType, oids Oids) (result PDU, err error) {
+	pdu := NewPduWithOids(s.args.Version, pduType, oids)
+	result, _, err = s.request(ctx, pdu)
+	if err != nil || !s.args.SplitOnTooBig || result.ErrorStatus() != TooBig || len(oids) < 2 {
+		return
+	}
 
-	if s.args.Version < V2c {
-		return nil, ArgumentError{
-			Value:   s.args.Version,
-			Message: "Unsupported SNMP Version",
-		}
+	half := len(oids) / 2
+	result, err = s.requestSplit(ctx, pduType, oids[:half])
+	if err != nil {
+		return nil, err
 	}
-	// RFC 3416 Section 3
-	if nonRepeaters < 0 || nonRepeaters > math.MaxInt32 {
-		return nil, ArgumentError{
-			Value:   nonRepeaters,
-			Message: fmt.Sprintf("NonRepeaters is range %d..%d", 0, math.MaxInt32),
-		}
+	rest, err := s.requestSplit(ctx, pduType, oids[half:])
+	if err != nil {
+		return nil, err
 	}
-	if maxRepetitions < 0 || maxRepetitions > math.MaxInt32 {
-		return nil, ArgumentError{
-			Value:   maxRepetitions,
-			Message: fmt.Sprintf("NonRepeaters is range %d..%d", 0, math.MaxInt32),
+	for _, vb := range rest.VariableBindings() {
+		result.AppendVariableBinding(vb.Oid, vb.Variable)
+	}
+	if result.ErrorStatus() == NoError && rest.ErrorStatus() != NoError {
+		result.SetErrorStatus(rest.ErrorStatus())
+		if idx := rest.ErrorIndex(); idx > 0 {
+			result.SetErrorIndex(idx + half)
 		}
 	}
+	return
+}
+
+func (s *SNMP) GetBulkRequest(oids Oids, nonRepeaters, maxRepetitions int) (result PDU, err error) {
+	return s.GetBulkRequestContext(context.Background(), oids, nonRepeaters, maxRepetitions)
+}
 
-	pdu := NewPduWithOids(s.args.Version, GetBulkRequest, oids)
-	pdu.SetNonrepeaters(nonRepeaters)
-	pdu.SetMaxRepetitions(maxRepetitions)
+// GetBulkRequestContext is GetBulkRequest that aborts when ctx is done
+func (s *SNMP) GetBulkRequestContext(ctx context.Context, oids Oids, nonRepeaters, maxRepetitions int) (result PDU, err error) {
+	if err = s.args.validateBulk(nonRepeaters, maxRepetitions); err != nil {
+		return nil, err
+	}
 
-	retry(int(s.args.Retries), func() error {
-		result, err = s.sendPdu(pdu)
-		return err
-	})
-	return
+	for {
+		pdu := NewPduWithOids(s.args.Version, GetBulkRequest, oids)
+		pdu.SetNonrepeaters(nonRepeaters)
+		pdu.SetMaxRepetitions(maxRepetitions)
+
+		result, _, err = s.request(ctx, pdu)
+		if err != nil || !s.args.SplitOnTooBig || result.ErrorStatus() != TooBig || maxRepetitions < 2 {
+			return
+		}
+		maxRepetitions /= 2
+	}
 }
 
 // This method inquire about OID subtrees by repeatedly using GetBulkRequest.
 // Returned PDU contains the VariableBinding list of all subtrees.
 // however, if the ErrorStatus of PDU is not the NoError, return only the last query result.
+// If the agent returns an OID which does not increase in a subtree, the walk
+// is aborted, the bindings collected so far are returned with a ResponseError.
+// If the walk reaches MaxWalkVarBinds or MaxWalkDuration, the bindings
+// collected so far are returned with a WalkTruncatedError.
 func (s *SNMP) GetBulkWalk(oids Oids, nonRepeaters, maxRepetitions int) (result PDU, err error) {
+	return s.GetBulkWalkContext(context.Background(), oids, nonRepeaters, maxRepetitions)
+}
+
+// GetBulkWalkContext is GetBulkWalk that aborts when ctx is done
+func (s *SNMP) GetBulkWalkContext(ctx context.Context, oids Oids, nonRepeaters, maxRepetitions int) (result PDU, err error) {
 	var nonRepBinds, resBinds VariableBindings
 
-	oids = append(oids[:nonRepeaters], oids[nonRepeaters:].Sort().UniqBase()...)
+	result, err = s.bulkWalk(ctx, oids, nonRepeaters, maxRepetitions, func(vb VariableBinding) error {
+		if len(nonRepBinds) < nonRepeaters {
+			nonRepBinds = append(nonRepBinds, vb)
+		} else {
+			resBinds = append(resBinds, vb)
+		}
+		return nil
+	})
+	switch e := err.(type) {
+	case walkAbortedError:
+		err = e.ResponseError
+	case WalkTruncatedError:
+	default:
+		if result != nil || err != nil {
+			return
+		}
+	}
+
+	resBinds = append(nonRepBinds, resBinds.Sort().Uniq()...)
+	return NewPduWithVarBinds(s.args.Version, GetResponse, resBinds), err
+}
+
+// StopWalk is returned by the callback of GetBulkWalkFunc to stop the walk
+// without an error
+var StopWalk = errors.New("stop walk")
+
+// GetBulkWalkFunc is GetBulkWalk which passes each VariableBinding to fn as the
+// responses arrive instead of accumulating them, the bindings of nonRepeaters
+// come first. The walk stops when fn returns an error, StopWalk stops it
+// without an error. If the ErrorStatus of a response is not the NoError,
+// a ResponseError is returned, and a WalkTruncatedError is returned if the
+// walk reaches MaxWalkVarBinds or MaxWalkDuration.
+func (s *SNMP) GetBulkWalkFunc(oids Oids, nonRepeaters, maxRepetitions int, fn func(VariableBinding) error) error {
+	return s.GetBulkWalkFuncContext(context.Background(), oids, nonRepeaters, maxRepetitions, fn)
+}
+
+// GetBulkWalkFuncContext is GetBulkWalkFunc that aborts when ctx is done
+func (s *SNMP) GetBulkWalkFuncContext(ctx context.Context, oids Oids, nonRepeaters, maxRepetitions int,
+	fn func(VariableBinding) error) error {
+	return walkFuncError(s.bulkWalk(ctx, oids, nonRepeaters, maxRepetitions, fn))
+}
+
+// walkFuncError returns the error of a walk of a callback, the response is
+// of an error status
+func walkFuncError(pdu PDU, err error) error {
+	if err == StopWalk {
+		return nil
+	}
+	if e, ok := err.(walkAbortedError); ok {
+		return e.ResponseError
+	}
+	if err == nil && pdu != nil {
+		err = ResponseError{
+			Message: fmt.Sprintf("Received an error status from the agent - %s(%d)",
+				pdu.ErrorStatus(), pdu.ErrorIndex()),
+			Detail: fmt.Sprintf("PDU - %s", pdu),
+		}
+	}
+	return err
+}
+
+// bulkWalk passes the bindings in the subtrees to fn, it returns the response
+// if the ErrorStatus of the response is not the NoError.
+func (s *SNMP) bulkWalk(ctx context.Context, oids Oids, nonRepeaters, maxRepetitions int,
+	fn func(VariableBinding) error) (PDU, error) {
+
+	oids = append(oids[:nonRepeaters:nonRepeaters], oids[nonRepeaters:].Sort().UniqBase()...)
 	reqOids := make(Oids, len(oids))
 	copy(reqOids, oids)
+	limits := s.newWalkLimits()
+	adapter := s.newRepetitionsAdapter(maxRepetitions)
+	if adapter != nil {
+		maxRepetitions = adapter.repetitions
+	}
 
 	for len(reqOids) > 0 {
-		pdu, err := s.GetBulkRequest(reqOids, nonRepeaters, maxRepetitions)
+		if err := limits.expired(oids, reqOids); err != nil {
+			return nil, err
+		}
+		pdu, err := s.GetBulkRequestContext(ctx, reqOids, nonRepeaters, maxRepetitions)
+		if adapter != nil && adapter.tooBig(pdu, err) {
+			maxRepetitions = adapter.repetitions
+			continue
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -253,13 +707,25 @@ func (s *SNMP) GetBulkWalk(oids Oids, nonRepeaters, maxRepetitions int) (result
 		VariableBindings := pdu.VariableBindings()
 
 		if nonRepeaters > 0 {
-			nonRepBinds = append(nonRepBinds, VariableBindings[:nonRepeaters]...)
-			VariableBindings = VariableBindings[nonRepeaters:]
+			n := nonRepeaters
+			if n > len(VariableBindings) {
+				n = len(VariableBindings)
+			}
+			for _, val := range VariableBindings[:n] {
+				if err = limits.add(fn, val, oids, reqOids); err != nil {
+					return nil, err
+				}
+			}
+			VariableBindings = VariableBindings[n:]
 			oids = oids[nonRepeaters:]
 			reqOids = reqOids[nonRepeaters:]
 			nonRepeaters = 0
 		}
 
+		if err = checkWalkOrder(VariableBindings, oids, reqOids); err != nil {
+			return nil, err
+		}
+
 		filled := len(VariableBindings) == len(reqOids)*maxRepetitions
 		VariableBindings = VariableBindings.Sort().Uniq()
 
@@ -267,7 +733,8 @@ func (s *SNMP) GetBulkWalk(oids Oids, nonRepeaters, maxRepetitions int) (result
 			matched := VariableBindings.MatchBaseOids(oids[i])
 			mLength := len(matched)
 
-			if mLength == 0 || resBinds.MatchOid(matched[mLength-1].Oid) != nil {
+			// the agent does not advance, avoid an infinite loop
+			if mLength == 0 || matched[mLength-1].Oid.CompareTo(reqOids[i]) <= 0 {
 				reqOids[i] = NewOid(nil)
 				continue
 			}
@@ -278,7 +745,12 @@ func (s *SNMP) GetBulkWalk(oids Oids, nonRepeaters, maxRepetitions int) (result
 				case *NoSucheObject, *NoSucheInstance, *EndOfMibView:
 					hasError = true
 				default:
-					resBinds = append(resBinds, val)
+					if val.Oid.CompareTo(reqOids[i]) <= 0 {
+						continue
+					}
+					if err = limits.add(fn, val, oids, reqOids); err != nil {
+						return nil, err
+					}
 					reqOids[i] = val.Oid
 				}
 			}
@@ -295,45 +767,390 @@ func (s *SNMP) GetBulkWalk(oids Oids, nonRepeaters, maxRepetitions int) (result
 				oids = append(oids[:i], oids[i+1:]...)
 			}
 		}
+		if adapter != nil && filled {
+			maxRepetitions = adapter.rampUp()
+		}
 	}
+	return nil, nil
+}
 
-	resBinds = append(nonRepBinds, resBinds.Sort().Uniq()...)
-	return NewPduWithVarBinds(s.args.Version, GetResponse, resBinds), nil
+// checkWalkOrder returns a walkAbortedError if the agent returns an OID which
+// does not increase in a subtree. The bindings of a GetBulkRequest are in
+// rows of the columns of reqOids, a column is checked until it leaves the
+// subtree of oids.
+func checkWalkOrder(variableBindings VariableBindings, oids, reqOids Oids) error {
+	for i := range reqOids {
+		last := reqOids[i]
+		for j := i; j < len(variableBindings); j += len(reqOids) {
+			val := variableBindings[j]
+			if val.Variable.IsError() || !oids[i].IsPrefixOf(val.Oid) {
+				break
+			}
+			if val.Oid.CompareTo(last) <= 0 {
+				return walkAbortedError{walkOrderError(val.Oid, last)}
+			}
+			last = val.Oid
+		}
+	}
+	return nil
+}
+
+func walkOrderError(oid, last Oid) ResponseError {
+	return ResponseError{
+		Message: fmt.Sprintf("The agent returned a non-increasing OID [%s] after [%s]",
+			oid.ToString(), last.ToString()),
+	}
+}
+
+// the detail of the ResponseError of a response larger than the buffer
+const truncatedDetail = "MessageMaxSize is less than the size of the response"
+
+// repetitionsAdapter adapts maxRepetitions of a walk by AdaptiveRepetitions
+type repetitionsAdapter struct {
+	s           *SNMP
+	repetitions int
+	ceiling     int // the largest value which has not failed
+}
+
+// newRepetitionsAdapter returns nil unless AdaptiveRepetitions is set, the
+// walk starts with the value learned by the last walk if it is less than
+// maxRepetitions
+func (s *SNMP) newRepetitionsAdapter(maxRepetitions int) *repetitionsAdapter {
+	if !s.args.AdaptiveRepetitions || maxRepetitions < 1 {
+		return nil
+	}
+	a := &repetitionsAdapter{s: s, repetitions: maxRepetitions, ceiling: maxRepetitions}
+	if learned := int(atomic.LoadInt32(&s.repetitions)); learned > 0 && learned < maxRepetitions {
+		a.repetitions = learned
+	}
+	return a
+}
+
+// tooBig halves the repetitions if the agent answers tooBig or the response
+// is truncated, it returns true if the request is sent again
+func (a *repetitionsAdapter) tooBig(pdu PDU, err error) bool {
+	if a.repetitions < 2 {
+		return false
+	}
+	if err != nil {
+		if e, ok := err.(ResponseError); !ok || e.Detail != truncatedDetail {
+			return false
+		}
+	} else if pdu.ErrorStatus() != TooBig {
+		return false
+	}
+	a.ceiling = a.repetitions - 1
+	a.repetitions /= 2
+	atomic.StoreInt32(&a.s.repetitions, int32(a.repetitions))
+	a.s.debugf("the response from %s is too big, maxRepetitions is reduced to %d", a.s.Address, a.repetitions)
+	return true
+}
+
+// rampUp doubles the repetitions up to the ceiling after a full response
+func (a *repetitionsAdapter) rampUp() int {
+	if a.repetitions < a.ceiling {
+		a.repetitions *= 2
+		if a.repetitions > a.ceiling {
+			a.repetitions = a.ceiling
+		}
+		atomic.StoreInt32(&a.s.repetitions, int32(a.repetitions))
+	}
+	return a.repetitions
+}
+
+// walkLimits stops a walk at MaxWalkVarBinds or MaxWalkDuration
+type walkLimits struct {
+	maxVarBinds int
+	maxDuration time.Duration
+	start       time.Time
+	count       int
+}
+
+func (s *SNMP) newWalkLimits() *walkLimits {
+	return &walkLimits{
+		maxVarBinds: s.args.MaxWalkVarBinds,
+		maxDuration: s.args.MaxWalkDuration,
+		start:       time.Now(),
+	}
+}
+
+// add passes vb to fn, a WalkTruncatedError is returned instead if the walk
+// has MaxWalkVarBinds bindings
+func (l *walkLimits) add(fn func(VariableBinding) error, vb VariableBinding, oids, reqOids Oids) error {
+	if l.maxVarBinds > 0 && l.count >= l.maxVarBinds {
+		return l.truncated("MaxWalkVarBinds", oids, reqOids)
+	}
+	l.count++
+	return fn(vb)
+}
+
+// expired returns a WalkTruncatedError if the walk takes MaxWalkDuration
+func (l *walkLimits) expired(oids, reqOids Oids) error {
+	if l.maxDuration > 0 && time.Since(l.start) >= l.maxDuration {
+		return l.truncated("MaxWalkDuration", oids, reqOids)
+	}
+	return nil
+}
+
+// truncated returns a WalkTruncatedError, the base OIDs of which the
+// reqOids are not completed are incomplete
+func (l *walkLimits) truncated(limit string, oids, reqOids Oids) error {
+	var incomplete Oids
+	for i := range reqOids {
+		if reqOids[i].Value != nil {
+			incomplete = append(incomplete, oids[i])
+		}
+	}
+	return WalkTruncatedError{Limit: limit, Count: l.count, Incomplete: incomplete}
+}
+
+// This method inquire about OID subtrees by repeatedly using GetNextRequest,
+// it works with the SNMPv1 agents that do not support GetBulkRequest.
+// Returned PDU contains the VariableBinding list of all subtrees.
+// however, if the ErrorStatus of PDU is not the NoError, return only the last query result.
+// The walk is aborted or is truncated as GetBulkWalk is.
+func (s *SNMP) GetNextWalk(oids Oids) (result PDU, err error) {
+	return s.GetNextWalkContext(context.Background(), oids)
+}
+
+// GetNextWalkContext is GetNextWalk that aborts when ctx is done
+func (s *SNMP) GetNextWalkContext(ctx context.Context, oids Oids) (result PDU, err error) {
+	var resBinds VariableBindings
+	result, err = s.nextWalk(ctx, oids, func(vb VariableBinding) error {
+		resBinds = append(resBinds, vb)
+		return nil
+	})
+	switch e := err.(type) {
+	case walkAbortedError:
+		err = e.ResponseError
+	case WalkTruncatedError:
+	default:
+		if result != nil || err != nil {
+			return
+		}
+	}
+	return NewPduWithVarBinds(s.args.Version, GetResponse, resBinds.Sort().Uniq()), err
+}
+
+// nextWalk passes the bindings in the subtrees to fn, it returns the
+// response if the ErrorStatus of the response is not the NoError.
+func (s *SNMP) nextWalk(ctx context.Context, oids Oids, fn func(VariableBinding) error) (PDU, error) {
+	limits := s.newWalkLimits()
+
+	oids = oids.Sort().UniqBase()
+	reqOids := make(Oids, len(oids))
+	copy(reqOids, oids)
+
+	for len(reqOids) > 0 {
+		if err := limits.expired(oids, reqOids); err != nil {
+			return nil, err
+		}
+		pdu, err := s.GetNextRequestContext(ctx, reqOids)
+		if err != nil {
+			return nil, err
+		}
+		if s := pdu.ErrorStatus(); s != NoError {
+			// the SNMPv1 agent reports the end of the MIB view by NoSuchName
+			i := pdu.ErrorIndex() - 1
+			if s != NoSuchName || i < 0 || i >= len(reqOids) {
+				return pdu, nil
+			}
+			reqOids = append(reqOids[:i], reqOids[i+1:]...)
+			oids = append(oids[:i], oids[i+1:]...)
+			continue
+		}
+
+		VariableBindings := pdu.VariableBindings()
+		if len(VariableBindings) != len(reqOids) {
+			return nil, ResponseError{
+				Message: fmt.Sprintf("Illegal VariableBindings length - expected [%d], actual [%d]",
+					len(reqOids), len(VariableBindings)),
+				Detail: fmt.Sprintf("PDU - %s", pdu),
+			}
+		}
+
+		for i, val := range VariableBindings {
+			// leaves the subtree, or reaches the end of the MIB view
+			if !oids[i].IsPrefixOf(val.Oid) || val.Variable.IsError() {
+				reqOids[i] = NewOid(nil)
+				continue
+			}
+			// the agent does not advance, avoid an infinite loop
+			if val.Oid.CompareTo(reqOids[i]) <= 0 {
+				return nil, walkAbortedError{walkOrderError(val.Oid, reqOids[i])}
+			}
+			if err = limits.add(fn, val, oids, reqOids); err != nil {
+				return nil, err
+			}
+			reqOids[i] = val.Oid
+		}
+
+		// sweep completed oids
+		for i := len(reqOids) - 1; i >= 0; i-- {
+			if reqOids[i].Value == nil {
+				reqOids = append(reqOids[:i], reqOids[i+1:]...)
+				oids = append(oids[:i], oids[i+1:]...)
+			}
+		}
+	}
+	return nil, nil
+}
+
+// WalkUntil walks the subtree of base and passes each VariableBinding to
+// pred in the order of the OIDs, it uses GetNextRequests for SNMPv1 and
+// GetBulkRequests of maxRepetitions for the others. The walk stops without
+// a further request when pred returns stop or an error, which is returned,
+// the rest of the response is not passed. The other errors are of
+// GetBulkWalkFunc.
+func (s *SNMP) WalkUntil(base Oid, maxRepetitions int, pred func(VariableBinding) (stop bool, err error)) error {
+	return s.WalkUntilContext(context.Background(), base, maxRepetitions, pred)
+}
+
+// WalkUntilContext is WalkUntil that aborts when ctx is done
+func (s *SNMP) WalkUntilContext(ctx context.Context, base Oid, maxRepetitions int,
+	pred func(VariableBinding) (stop bool, err error)) error {
+	fn := func(vb VariableBinding) error {
+		stop, err := pred(vb)
+		if err == nil && stop {
+			err = StopWalk
+		}
+		return err
+	}
+	if s.args.Version == V1 {
+		return walkFuncError(s.nextWalk(ctx, Oids{base}, fn))
+	}
+	return walkFuncError(s.bulkWalk(ctx, Oids{base}, 0, maxRepetitions, fn))
+}
+
+// GetNextWalkFunc is GetNextWalk which passes each VariableBinding to fn as
+// the responses arrive instead of accumulating them, the walk is stopped
+// and the errors are returned as GetBulkWalkFunc.
+func (s *SNMP) GetNextWalkFunc(oids Oids, fn func(VariableBinding) error) error {
+	return s.GetNextWalkFuncContext(context.Background(), oids, fn)
+}
+
+// GetNextWalkFuncContext is GetNextWalkFunc that aborts when ctx is done
+func (s *SNMP) GetNextWalkFuncContext(ctx context.Context, oids Oids, fn func(VariableBinding) error) error {
+	return walkFuncError(s.nextWalk(ctx, oids, fn))
+}
+
+// WalkFunc walks the subtrees of the oids and passes each VariableBinding to
+// fn as the responses arrive, so a large table (e.g. the routing table) is
+// walked without holding it in memory. It uses GetNextWalkFunc for SNMPv1
+// and GetBulkWalkFunc of 10 repetitions for the others, fn returns
+// StopWalk to stop the walk without an error.
+func (s *SNMP) WalkFunc(oids Oids, fn func(VariableBinding) error) error {
+	return s.WalkFuncContext(context.Background(), oids, fn)
+}
+
+// WalkFuncContext is WalkFunc that aborts when ctx is done
+func (s *SNMP) WalkFuncContext(ctx context.Context, oids Oids, fn func(VariableBinding) error) error {
+	if s.args.Version == V1 {
+		return s.GetNextWalkFuncContext(ctx, oids, fn)
+	}
+	return s.GetBulkWalkFuncContext(ctx, oids, 0, 10, fn)
+}
+
+// GetByOidString is GetRequest of the dotted OID strings, an ArgumentError
+// is returned if a string cannot be parsed
+func (s *SNMP) GetByOidString(oids ...string) (PDU, error) {
+	o, err := parseOidStrings(oids)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetRequest(o)
+}
+
+// GetNextByOidString is GetNextRequest of the dotted OID strings
+func (s *SNMP) GetNextByOidString(oids ...string) (PDU, error) {
+	o, err := parseOidStrings(oids)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetNextRequest(o)
+}
+
+// WalkByOidString walks the subtrees of the dotted OID strings, it uses
+// GetNextWalk for SNMPv1 and GetBulkWalk for the others.
+func (s *SNMP) WalkByOidString(oids ...string) (PDU, error) {
+	o, err := parseOidStrings(oids)
+	if err != nil {
+		return nil, err
+	}
+	if s.args.Version == V1 {
+		return s.GetNextWalk(o)
+	}
+	return s.GetBulkWalk(o, 0, 10)
 }
 
 func (s *SNMP) V2Trap(VariableBindings VariableBindings) error {
-	return s.v2trap(SNMPTrapV2, VariableBindings)
+	return s.V2TrapContext(context.Background(), VariableBindings)
+}
+
+// V2TrapContext is V2Trap that aborts when ctx is done
+func (s *SNMP) V2TrapContext(ctx context.Context, VariableBindings VariableBindings) error {
+	return s.v2trap(ctx, SNMPTrapV2, VariableBindings)
 }
 
-func (s *SNMP) V1Trap(enterprise Oid, agentAddress Ipaddress, genericTrap int,
-	specificTrap int, VariableBindings VariableBindings) error {
+// V1Trap sends the Trap-PDU of RFC1157, timestamp is the sysUpTime of the
+// agent when the trap is generated. The agent address is 0.0.0.0 if
+// agentAddr is nil. genericTrap is one of ColdStart to EnterpriseSpecific.
+func (s *SNMP) V1Trap(enterprise Oid, agentAddr net.IP, genericTrap, specificTrap int,
+	timestamp uint32, VariableBindings VariableBindings) error {
+	return s.V1TrapContext(context.Background(), enterprise, agentAddr, genericTrap, specificTrap,
+		timestamp, VariableBindings)
+}
+
+// V1TrapContext is V1Trap that aborts when ctx is done
+func (s *SNMP) V1TrapContext(ctx context.Context, enterprise Oid, agentAddr net.IP, genericTrap, specificTrap int,
+	timestamp uint32, VariableBindings VariableBindings) error {
 	if s.args.Version != V1 {
 		return ArgumentError{
 			Value:   s.args.Version,
 			Message: "Unsupported SNMP Version",
 		}
 	}
+	addr := net.IPv4zero.To4()
+	if agentAddr != nil {
+		if addr = agentAddr.To4(); addr == nil {
+			return ArgumentError{
+				Value:   agentAddr,
+				Message: "AgentAddress must be an IPv4 address",
+			}
+		}
+	}
+	if genericTrap < ColdStart || genericTrap > EnterpriseSpecific {
+		return ArgumentError{
+			Value:   genericTrap,
+			Message: fmt.Sprintf("GenericTrap is out of range [%d..%d]", ColdStart, EnterpriseSpecific),
+		}
+	}
 
 	pdu := NewPduWithVarBinds(s.args.Version, Trap, VariableBindings).(*PduV1)
 	pdu.Enterprise = enterprise
-	pdu.AgentAddress = agentAddress
+	pdu.AgentAddress = *NewIpaddress(addr[0], addr[1], addr[2], addr[3])
 	pdu.GenericTrap = genericTrap
 	pdu.SpecificTrap = specificTrap
-	pdu.Timestamp = 0
+	pdu.Timestamp = int(timestamp)
 
-	var err error
-	retry(int(s.args.Retries), func() error {
-		_, err = s.sendPdu(pdu)
-		return err
-	})
+	_, _, err := s.request(ctx, pdu)
 	return err
 }
 
+// InformRequest sends the InformRequest and waits for the acknowledgment
+// of the receiver. It is sent again with the same request id by Retries and
+// RetryBackoff, an InformNotAcknowledgedError is returned if no attempt is
+// acknowledged or the receiver responds with an error status.
 func (s *SNMP) InformRequest(VariableBindings VariableBindings) error {
-	return s.v2trap(InformRequest, VariableBindings)
+	return s.InformRequestContext(context.Background(), VariableBindings)
 }
 
-func (s *SNMP) v2trap(pduType PduType, VariableBindings VariableBindings) (err error) {
+// InformRequestContext is InformRequest that aborts when ctx is done
+func (s *SNMP) InformRequestContext(ctx context.Context, VariableBindings VariableBindings) error {
+	return s.v2trap(ctx, InformRequest, VariableBindings)
+}
+
+func (s *SNMP) v2trap(ctx context.Context, pduType PduType, VariableBindings VariableBindings) (err error) {
 	if s.args.Version < V2c {
 		return ArgumentError{
 			Value:   s.args.Version,
@@ -343,56 +1160,307 @@ func (s *SNMP) v2trap(pduType PduType, VariableBindings VariableBindings) (err e
 
 	pdu := NewPduWithVarBinds(s.args.Version, pduType, VariableBindings)
 
-	retry(int(s.args.Retries), func() error {
-		_, err = s.sendPdu(pdu)
+	if s.args.Version == V3 && pduType == SNMPTrapV2 && s.tlsConfig == nil {
+		return s.v3trap(ctx, pdu)
+	}
+	if pduType == InformRequest {
+		return s.inform(ctx, pdu)
+	}
+	_, _, err = s.request(ctx, pdu)
+	return
+}
+
+// inform sends the InformRequest until it is acknowledged, the response is
+// matched by the request id which is kept by the retransmissions
+func (s *SNMP) inform(ctx context.Context, pdu PDU) error {
+	pdu.SetRequestId(s.args.requestId())
+	result, info, err := s.request(ctx, pdu)
+	if err == nil {
+		err = ErrorFromPdu(pdu, result)
+	} else if e, ok := err.(net.Error); !ok || !e.Timeout() {
+		return err
+	}
+	if err != nil {
+		return InformNotAcknowledgedError{Attempts: info.Attempts, Cause: err}
+	}
+	return nil
+}
+
+// the local engine is booted when the process is started
+var localEngineStarted = time.Now()
+
+// v3trap sends the trap as the authoritative engine, which is the
+// EngineConfig or the SecurityEngineId, to the receiver (RFC3414 Section
+// 1.5.1). The receiver is not discovered, unlike the InformRequest.
+func (s *SNMP) v3trap(ctx context.Context, pdu PDU) (err error) {
+	var engineId []byte
+	var engineBoots, engineTime int64
+	if c := s.args.EngineConfig; c != nil {
+		engineId = c.EngineId()
+		if engineBoots, engineTime, err = c.EngineBootsTime(); err != nil {
+			return
+		}
+	} else {
+		if s.args.SecurityEngineId == "" {
+			return ArgumentError{
+				Value:   s.args.SecurityEngineId,
+				Message: "SecurityEngineId or EngineConfig is required to send a V3 trap",
+			}
+		}
+		if engineId, err = engineIdToBytes(s.args.SecurityEngineId); err != nil {
+			return
+		}
+		engineBoots, engineTime = 1, int64(time.Since(localEngineStarted).Seconds())
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err = s.connect(ctx); err != nil {
+		return
+	}
+
+	mp := NewMessageProcessing(V3)
+	usm := mp.Security().(*USM)
+	usm.AuthEngineId = engineId
+	usm.SynchronizeEngineBootsTime(engineBoots, engineTime)
+
+	sender := &SNMP{Network: s.Network, Address: s.Address, args: s.args, mp: mp, conn: s.conn,
+		stats: s.stats, recvBufs: s.recvBufs}
+	sender.tracer.set(s.tracer.handler())
+	sender.logger.set(s.logger.get())
+	_, err = sender.sendPduOnce(ctx, pdu)
+	if sender.conn == nil {
+		// the broken stream is closed
+		s.conn, s.mp = nil, nil
+	}
+	return
+}
+
+// Do sends a prepared PDU with the retries of the session. The returned
+// RequestInfo carries the correlation value attached to ctx by
+// WithCorrelation, it is never sent to the agent.
+func (s *SNMP) Do(ctx context.Context, pdu PDU) (PDU, RequestInfo, error) {
+	return s.request(ctx, pdu)
+}
+
+func (s *SNMP) request(ctx context.Context, pdu PDU) (result PDU, info RequestInfo, err error) {
+	info.Correlation = CorrelationFromContext(ctx)
+	start := time.Now()
+	err = retry(ctx, int(s.args.Retries), s.args.backoff, func() error {
+		if e := ctx.Err(); e != nil {
+			return canceledError(e)
+		}
+		info.Attempts++
+		if info.Attempts > 1 {
+			s.stats.add(&s.stats.retries, 1)
+		}
+		s.mutex.Lock()
+		result, err = s.sendPdu(ctx, pdu)
+		s.mutex.Unlock()
+		if err != nil && contextErr(ctx) != nil {
+			return canceledError(contextErr(ctx))
+		}
+		if err != nil {
+			s.debugf("attempt %d of the %s to %s is failed - %v%s", info.Attempts, pdu.PduType(), s.Address, err,
+				correlationNote(info.Correlation))
+		}
 		return err
 	})
+	info.RequestId = pdu.RequestId()
+	info.Elapsed = time.Since(start)
+	if err != nil {
+		result = nil
+		err = withCorrelation(err, info.Correlation)
+	}
 	return
 }
 
-func (s *SNMP) sendPdu(pdu PDU) (result PDU, err error) {
-	if err = s.Open(); err != nil {
+func (s *SNMP) sendPdu(ctx context.Context, pdu PDU) (result PDU, err error) {
+	result, err = s.sendPduOnce(ctx, pdu)
+	if _, ok := err.(notInTimeWindowError); ok && !s.args.DisableTimeWindowResync && ctx.Err() == nil {
+		// the engine boots and time are synchronized by the report, e.g.
+		// the agent has rebooted, so the request is sent again at once
+		if r, e := s.sendPduOnce(ctx, pdu); e == nil {
+			s.storeEngine()
+			return r, nil
+		}
+	}
+	if e, ok := err.(unknownEngineIdError); ok {
+		err = e.ResponseError
+		if !s.args.DisableRediscovery && ctx.Err() == nil {
+			result, err = s.rediscover(ctx, pdu, err)
+		}
+	}
+	return
+}
+
+// rediscover discovers the engine of the agent which has reported that the
+// engine ID is unknown, and sends the request again
+func (s *SNMP) rediscover(ctx context.Context, pdu PDU, reportErr error) (PDU, error) {
+	s.stats.add(&s.stats.rediscoveries, 1)
+	note := correlationNote(CorrelationFromContext(ctx))
+	s.debugf("the engine of %s is unknown, discovering it again - %v%s", s.Address, reportErr, note)
+	if err := s.discover(ctx); err != nil {
+		s.warnf("failed to discover the engine of %s - %v%s", s.Address, err, note)
+		return nil, err
+	}
+	s.storeEngine()
+
+	result, err := s.sendPduOnce(ctx, pdu)
+	if e, ok := err.(unknownEngineIdError); ok {
+		err = e.ResponseError
+	}
+	return result, err
+}
+
+func (s *SNMP) sendPduOnce(ctx context.Context, pdu PDU) (result PDU, err error) {
+	if err = s.open(ctx); err != nil {
 		return
 	}
+	deadline := time.Now().Add(s.args.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if ctx.Done() != nil {
+		// unblock the Read when ctx is canceled
+		done := make(chan struct{})
+		defer close(done)
+		go func(conn net.Conn) {
+			select {
+			case <-ctx.Done():
+				conn.SetDeadline(time.Now())
+			case <-done:
+			}
+		}(s.conn)
+	}
 
+	correlation := CorrelationFromContext(ctx)
 	var sendMsg Message
 	sendMsg, err = s.mp.PrepareOutgoingMessage(s, pdu)
 	if err != nil {
+		s.stats.add(&s.stats.marshalErrors, 1)
 		return
 	}
 
 	var buf []byte
-	buf, err = sendMsg.Marshal()
+	buf, err = sendMsg.AppendMarshal(s.sendBuf[:0])
 	if err != nil {
+		s.stats.add(&s.stats.marshalErrors, 1)
 		return
 	}
+	s.sendBuf = buf
+	s.tracer.sent(buf, sendMsg, correlation)
 
-	s.conn.SetWriteDeadline(time.Now().Add(s.args.Timeout))
-	_, err = s.conn.Write(buf)
-	if !confirmedType(pdu.PduType()) || err != nil {
-		return
+	stream, framed := isStream(s.Network), false
+	if stream {
+		// a stream broken in the middle of a message is not recoverable
+		defer func() {
+			if err != nil && !framed && s.conn != nil {
+				s.close()
+			}
+		}()
 	}
 
-	size := s.args.MessageMaxSize
-	if size < recvBufferSize {
-		size = recvBufferSize
-	}
-	buf = make([]byte, size)
-	s.conn.SetReadDeadline(time.Now().Add(s.args.Timeout))
-	_, err = s.conn.Read(buf)
+	s.conn.SetWriteDeadline(deadline)
+	err = writeMessage(s.conn, buf)
 	if err != nil {
 		return
 	}
+	sentTime := time.Now()
+	s.stats.add(&s.stats.requestsSent, 1)
+	s.stats.add(&s.stats.bytesSent, uint64(len(buf)))
+	if !confirmedType(pdu.PduType()) {
+		return
+	}
 
-	result, err = s.mp.PrepareDataElements(s, sendMsg, buf)
+	size := s.args.recvSize()
+	if stream && size < mega {
+		size = mega
+	}
+	if !stream {
+		// the decoded PDU does not refer to the buffer
+		b := s.recvBufs.Get().(*[]byte)
+		defer s.recvBufs.Put(b)
+		buf = *b
+	}
+	s.conn.SetReadDeadline(deadline)
+	for {
+		n := 0
+		if stream {
+			buf, err = readMessage(s.conn, size)
+			framed, n = err == nil, len(buf)
+		} else if n, err = s.conn.Read(buf); err == nil && n == len(buf) {
+			// the datagram is larger than the buffer of recvSize octets
+			err = ResponseError{
+				Message: fmt.Sprintf("The response may be truncated to [%d] octets", n),
+				Detail:  truncatedDetail,
+			}
+			s.stats.add(&s.stats.unmarshalErrors, 1)
+			s.tracer.received(buf[:n], err, correlation)
+			return
+		}
+		if err != nil {
+			if e, ok := err.(net.Error); ok && e.Timeout() && contextErr(ctx) == nil {
+				s.stats.add(&s.stats.timeouts, 1)
+			}
+			return
+		}
+		s.stats.roundTrip(time.Since(sentTime))
+		s.stats.add(&s.stats.responsesReceived, 1)
+		s.stats.add(&s.stats.bytesReceived, uint64(n))
+
+		result, err = s.mp.PrepareDataElements(s, sendMsg, buf[:n])
+		s.tracer.received(buf[:n], err, correlation)
+		if _, ok := err.(responseMismatchError); !ok {
+			break
+		}
+		// a late response to a previous request, the response is still
+		// expected until the deadline
+		s.debugf("the response from %s is skipped - %v%s", s.Address, err, correlationNote(correlation))
+	}
+	if err != nil {
+		s.stats.add(&s.stats.unmarshalErrors, 1)
+		s.warnf("the response from %s is dropped - %v%s", s.Address, err, correlationNote(correlation))
+	} else if result.PduType() == Report && len(result.VariableBindings()) > 0 {
+		s.stats.add(&s.stats.reports, 1)
+		oid := result.VariableBindings()[0].Oid.ToString()
+		s.debugf("received a report from %s - %s(%s)%s", s.Address, reportStatusOid(oid), oid,
+			correlationNote(correlation))
+	}
 	if result != nil && len(pdu.VariableBindings()) != 0 {
-		if err = s.checkPdu(result); err != nil {
+		if err = s.checkPdu(result); err == nil && s.args.StrictResponse {
+			err = checkResponse(pdu, result)
+		}
+		if err != nil {
 			result = nil
 		}
 	}
+	if s.engineId != nil {
+		if e := s.checkEngine(); e != nil {
+			return nil, e
+		}
+	}
 	return
 }
 
+// contextErr is ctx.Err(), which is DeadlineExceeded as soon as the deadline
+// has passed, a deadline of the connection may expire before ctx does.
+func contextErr(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if d, ok := ctx.Deadline(); ok && !time.Now().Before(d) {
+		return context.DeadlineExceeded
+	}
+	return nil
+}
+
+func canceledError(err error) error {
+	return ResponseError{
+		Cause:   err,
+		Message: "Request is canceled",
+	}
+}
+
 func (s *SNMP) checkPdu(pdu PDU) (err error) {
 	VariableBindings := pdu.VariableBindings()
 	if s.args.Version == V3 && pdu.PduType() == Report && len(VariableBindings) > 0 {
@@ -401,15 +1469,60 @@ func (s *SNMP) checkPdu(pdu PDU) (err error) {
 		err = ResponseError{
 			Message: fmt.Sprintf("Received a report from the agent - %s(%s)", rep, oid),
 			Detail:  fmt.Sprintf("PDU - %s", pdu),
+			Report:  oid,
 		}
 		// perhaps the agent has rebooted after the previous communication
 		if rep == usmStatsNotInTimeWindows {
 			err = notInTimeWindowError{err.(ResponseError)}
 		}
+		// perhaps the agent is replaced
+		if rep == usmStatsUnknownEngineIDs {
+			err = unknownEngineIdError{err.(ResponseError)}
+		}
+		// the cached engine is out of date
+		if (rep == usmStatsNotInTimeWindows || rep == usmStatsUnknownEngineIDs) && s.args.EngineCache != nil {
+			s.args.EngineCache.Invalidate(s.Address, s.args.UserName)
+		}
 	}
 	return
 }
 
+// checkResponse checks that the response has the variable bindings of the
+// request, the response of tooBig has no variable binding (RFC3416 Section
+// 4.2.1)
+func checkResponse(req, res PDU) error {
+	if res.PduType() != GetResponse || res.ErrorStatus() == TooBig {
+		return nil
+	}
+	switch req.PduType() {
+	case GetRequest, GetNextRequest, SetRequest:
+	default:
+		return nil
+	}
+
+	reqVbs, resVbs := req.VariableBindings(), res.VariableBindings()
+	if len(reqVbs) != len(resVbs) {
+		return ResponseError{
+			Message: fmt.Sprintf("The response has [%d] variable bindings, expected [%d]",
+				len(resVbs), len(reqVbs)),
+			Detail: fmt.Sprintf("PDU - %s", res),
+		}
+	}
+	if req.PduType() == GetNextRequest {
+		return nil
+	}
+	for i := range reqVbs {
+		if !reqVbs[i].Oid.Equal(&resVbs[i].Oid) {
+			return ResponseError{
+				Message: fmt.Sprintf("The response has OID [%s] at [%d], expected [%s]",
+					resVbs[i].Oid.ToString(), i, reqVbs[i].Oid.ToString()),
+				Detail: fmt.Sprintf("PDU - %s", res),
+			}
+		}
+	}
+	return nil
+}
+
 func (s *SNMP) String() string {
 	if s.conn == nil {
 		return fmt.Sprintf(`{"conn": false, "args": %s}`, s.args.String())
@@ -419,13 +1532,54 @@ func (s *SNMP) String() string {
 	}
 }
 
-// Create a SNMP Object
+// Create a SNMP Object, network is "udp" (the default) or the others of
+// net.Dial. The messages on "tcp", "tcp4" and "tcp6" are framed by the
+// BER length of the message (RFC3430), a response may be up to 1MB then.
+// "tls", "tls4" and "tls6" are the TLS transport over TCP of SNMPv3, and
+// "dtls", "dtls4" and "dtls6" are the DTLS transport over UDP (RFC6353).
+// The messages are secured by TSM instead of USM, SecurityLevel is AuthPriv
+// then. The default port is 10161 and the certificates are of CertFile,
+// KeyFile and CAFile.
 func NewSNMP(network, address string, args Arguments) (*SNMP, error) {
-	if err := args.validate(); err != nil {
+	if err := args.validateFor(network); err != nil {
 		return nil, err
 	}
 	args.setDefault()
+
+	defaultPort := "161"
+	if isTsm(network) {
+		defaultPort = "10161"
+		// the transport authenticates and encrypts the messages
+		args.SecurityLevel = AuthPriv
+	}
+	address, err := normalizeAddress(address, defaultPort)
+	if err != nil {
+		return nil, err
+	}
+	var localAddr net.Addr
+	if args.LocalAddress != "" {
+		if "" == network {
+			network = "udp"
+		}
+		localNetwork := network
+		if isTsm(network) {
+			localNetwork = tlsUnderlying(network)
+		}
+		if localAddr, err = resolveLocalAddr(localNetwork, args.LocalAddress, address); err != nil {
+			return nil, err
+		}
+	}
+	var tlsConfig *tls.Config
+	if isTsm(network) {
+		if tlsConfig, err = args.newTlsConfig(address); err != nil {
+			return nil, err
+		}
+	}
 	return &SNMP{Network: network,
-		Address: address,
-		args:    args}, nil
+		Address:   address,
+		args:      args,
+		localAddr: localAddr,
+		stats:     &snmpStats{},
+		recvBufs:  newBufferPool(args.recvSize()),
+		tlsConfig: tlsConfig}, nil
 }
@@ -1,8 +1,17 @@
 package snmpclient2_test
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"math"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/runner-mei/snmpclient2"
 )
@@ -93,6 +102,68 @@ func TestSNMPArguments(t *testing.T) {
 	}
 }
 
+func TestLocalizedKeys(t *testing.T) {
+	engineId := []byte{0x80, 0x00, 0x1f, 0x88, 0x04, 's', 'i', 'm'}
+	authKey := snmpclient2.PasswordToKey(snmpclient2.Sha, "sha-password", engineId)
+	privKey := snmpclient2.PasswordToPrivKey(snmpclient2.Sha, snmpclient2.Aes, "aes-password", engineId)
+	if !bytes.Equal(privKey, snmpclient2.PasswordToKey(snmpclient2.Sha, "aes-password", engineId)) {
+		t.Errorf("PasswordToPrivKey(AES) - expected the key of PasswordToKey, actual [%x]", privKey)
+	}
+	desKey := snmpclient2.PasswordToPrivKey(snmpclient2.Md5, snmpclient2.TripleDes, "des-password", engineId)
+	if !bytes.Equal(desKey[:16], snmpclient2.PasswordToKey(snmpclient2.Md5, "des-password", engineId)) || len(desKey) != 32 {
+		t.Errorf("PasswordToPrivKey(3DES) - expected the extended key, actual [%x]", desKey)
+	}
+
+	for _, test := range []struct {
+		authPassword string
+		authKey      []byte
+		privKey      []byte
+		valid        bool
+	}{
+		{"", authKey, privKey, true},
+		{"", authKey, privKey[:16], true},
+		{"sha-password", authKey, privKey, false},
+		{"", authKey[:16], privKey, false},
+		{"", append(authKey, 0), privKey, false},
+		{"", authKey, privKey[:8], false},
+	} {
+		args := &snmpclient2.Arguments{
+			Version:       snmpclient2.V3,
+			UserName:      "shaAes",
+			SecurityLevel: snmpclient2.AuthPriv,
+			AuthProtocol:  snmpclient2.Sha,
+			AuthPassword:  test.authPassword,
+			AuthKey:       test.authKey,
+			PrivProtocol:  snmpclient2.Aes,
+			PrivKey:       test.privKey,
+		}
+		if err := snmpclient2.ArgsValidate(args); (err == nil) != test.valid {
+			t.Errorf("validate(%q, %d, %d) - expected valid [%v], actual %v",
+				test.authPassword, len(test.authKey), len(test.privKey), test.valid, err)
+		}
+	}
+
+	srv := newV3Server(t)
+	defer srv.Close()
+
+	args := v3Arguments(snmpclient2.UsmUser{UserName: "shaAes", AuthProtocol: snmpclient2.Sha,
+		AuthPassword: "sha-password", PrivProtocol: snmpclient2.Aes, PrivPassword: "aes-password"})
+	args.AuthPassword, args.AuthKey = "", authKey
+	args.PrivPassword, args.PrivKey = "", privKey
+	snmp, err := snmpclient2.NewSNMP("udp", "127.0.0.1:"+srv.GetPort(), args)
+	if err != nil {
+		t.Fatalf("NewSNMP() - has error %v", err)
+	}
+	defer snmp.Close()
+	pdu, err := snmp.GetRequest(snmpclient2.MustParseOids("1.3.6.1.2.1.1.1.0"))
+	if err != nil {
+		t.Fatalf("GetRequest() - has error %v", err)
+	}
+	if vbs := pdu.VariableBindings(); len(vbs) != 1 || vbs[0].Variable.IsError() {
+		t.Errorf("GetRequest() - expected the value of the localized keys, actual %v", vbs)
+	}
+}
+
 func TestSNMP(t *testing.T) {
 	snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1", snmpclient2.Arguments{
 		Version:       snmpclient2.V3,
@@ -117,3 +188,1308 @@ func TestSNMP(t *testing.T) {
 		t.Error("checkPdu() - report oid")
 	}
 }
+
+func TestSendPdu(t *testing.T) {
+	oids, _ := snmpclient2.NewOids([]string{
+		"1.3.6.1.2.1.1.1.0",
+		"1.3.6.1.2.1.1.2.0",
+	})
+	dialer := newMemDialer(memAgent(t, map[string]snmpclient2.Variable{
+		"1.3.6.1.2.1.1.1.0": snmpclient2.NewOctetString([]byte("Test Agent")),
+	}))
+	snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:161", snmpclient2.Arguments{
+		Version:   snmpclient2.V2c,
+		Community: "public",
+		Dialer:    dialer,
+	})
+	defer snmp.Close()
+
+	pdu, err := snmp.GetRequest(oids)
+	if err != nil {
+		t.Fatalf("GetRequest() - has error %v", err)
+	}
+	if pdu.PduType() != snmpclient2.GetResponse {
+		t.Errorf("GetRequest() - expected [%s], actual [%s]", snmpclient2.GetResponse, pdu.PduType())
+	}
+	vb := pdu.VariableBindings().MatchOid(oids[0])
+	if vb == nil || string(vb.Variable.Bytes()) != "Test Agent" {
+		t.Errorf("GetRequest() - expected [%s], actual [%v]", "Test Agent", vb)
+	}
+	vb = pdu.VariableBindings().MatchOid(oids[1])
+	if vb == nil || !vb.Variable.IsError() {
+		t.Errorf("GetRequest() - expected NoSucheObject, actual [%v]", vb)
+	}
+}
+
+func TestSendPduTimeout(t *testing.T) {
+	var requests int32
+	dialer := newMemDialer(func([]byte) [][]byte {
+		atomic.AddInt32(&requests, 1)
+		return nil
+	})
+	snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:161", snmpclient2.Arguments{
+		Version:   snmpclient2.V2c,
+		Community: "public",
+		Timeout:   10 * time.Millisecond,
+		Retries:   2,
+		Dialer:    dialer,
+	})
+	defer snmp.Close()
+
+	oids, _ := snmpclient2.NewOids([]string{"1.3.6.1.2.1.1.1.0"})
+	_, err := snmp.GetRequest(oids)
+	if e, ok := err.(net.Error); !ok || !e.Timeout() {
+		t.Errorf("GetRequest() - expected timeout, actual [%v]", err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 3 {
+		t.Errorf("GetRequest() - expected [%d] requests, actual [%d]", 3, n)
+	}
+}
+
+// deadlineDialer records the deadline of the context of the dial
+type deadlineDialer struct {
+	*memDialer
+	timeout time.Duration
+}
+
+func (d *deadlineDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		d.timeout = time.Until(deadline)
+	}
+	return d.memDialer.DialContext(ctx, network, address)
+}
+
+func TestConnectTimeout(t *testing.T) {
+	dialer := &deadlineDialer{memDialer: newMemDialer(func([]byte) [][]byte { return nil })}
+	snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:161", snmpclient2.Arguments{
+		Version:        snmpclient2.V3,
+		UserName:       "MyName",
+		Timeout:        5 * time.Second,
+		ConnectTimeout: 20 * time.Millisecond,
+		Dialer:         dialer,
+	})
+	start := time.Now()
+	err := snmp.Open()
+	snmp.Close()
+	if e, ok := err.(net.Error); !ok || !e.Timeout() {
+		t.Errorf("Open() - expected timeout, actual [%v]", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Open() - expected the discovery in ConnectTimeout, elapsed [%s]", elapsed)
+	}
+	if dialer.timeout <= 0 || dialer.timeout > 20*time.Millisecond {
+		t.Errorf("Open() - expected the dial in ConnectTimeout, actual [%s]", dialer.timeout)
+	}
+
+	// the requests wait for Timeout
+	agent := memAgent(t, map[string]snmpclient2.Variable{
+		"1.3.6.1.2.1.1.1.0": snmpclient2.NewOctetString([]byte("Slow Agent")),
+	})
+	snmp, _ = snmpclient2.NewSNMP("udp", "127.0.0.1:161", snmpclient2.Arguments{
+		Version:        snmpclient2.V2c,
+		Community:      "public",
+		Timeout:        time.Second,
+		ConnectTimeout: 20 * time.Millisecond,
+		Dialer: newMemDialer(func(req []byte) [][]byte {
+			time.Sleep(50 * time.Millisecond)
+			return agent(req)
+		}),
+	})
+	defer snmp.Close()
+	if _, err = snmp.GetRequest(snmpclient2.MustParseOids("1.3.6.1.2.1.1.1.0")); err != nil {
+		t.Errorf("GetRequest() - has error %v", err)
+	}
+	if args := snmp.String(); !strings.Contains(args, `"Timeout":1000000000`) ||
+		!strings.Contains(args, `"ConnectTimeout":20000000`) {
+		t.Errorf("String() - expected Timeout and ConnectTimeout, actual %s", args)
+	}
+}
+
+func TestEngineDiscovered(t *testing.T) {
+	var engineId atomic.Value
+	engineId.Store([]byte{0x80, 0x00, 0x1f, 0x88, 0x01})
+	mibs := map[string]snmpclient2.Variable{
+		"1.3.6.1.2.1.1.1.0": snmpclient2.NewOctetString([]byte("Test Agent")),
+	}
+
+	var discovered [][]byte
+	args := snmpclient2.Arguments{
+		Version:       snmpclient2.V3,
+		UserName:      "MyName",
+		SecurityLevel: snmpclient2.NoAuthNoPriv,
+		Timeout:       time.Second,
+		Dialer:        newMemDialer(memAgentV3(t, &engineId, mibs)),
+		OnEngineDiscovered: func(address string, id []byte, boots, time int32) {
+			if address != "127.0.0.1:161" || boots != 3 || time != 1000 {
+				t.Errorf("OnEngineDiscovered() - unexpected [%s] [%d] [%d]", address, boots, time)
+			}
+			discovered = append(discovered, id)
+		},
+	}
+	snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:161", args)
+
+	oids, _ := snmpclient2.NewOids([]string{"1.3.6.1.2.1.1.1.0"})
+	pdu, err := snmp.GetRequest(oids)
+	if err != nil {
+		t.Fatalf("GetRequest() - has error %v", err)
+	}
+	if vb := pdu.VariableBindings().MatchOid(oids[0]); vb == nil || string(vb.Variable.Bytes()) != "Test Agent" {
+		t.Errorf("GetRequest() - expected [%s], actual [%v]", "Test Agent", vb)
+	}
+	snmp.Close()
+
+	// the agent is replaced between the connections
+	engineId.Store([]byte{0x80, 0x00, 0x1f, 0x88, 0x02})
+	if err = snmp.Open(); err != nil {
+		t.Fatalf("Open() - has error %v", err)
+	}
+	snmp.Close()
+
+	if len(discovered) != 2 ||
+		!bytes.Equal(discovered[0], []byte{0x80, 0x00, 0x1f, 0x88, 0x01}) ||
+		!bytes.Equal(discovered[1], []byte{0x80, 0x00, 0x1f, 0x88, 0x02}) {
+		t.Errorf("OnEngineDiscovered() - unexpected engines %v", discovered)
+	}
+
+	// a configured engine must match unless explicitly allowed
+	args.OnEngineDiscovered = nil
+	args.SecurityEngineId = "80001f880101"
+	snmp, _ = snmpclient2.NewSNMP("udp", "127.0.0.1:161", args)
+	err = snmp.Open()
+	if e, ok := err.(snmpclient2.EngineIdMismatchError); !ok {
+		t.Errorf("Open() - expected EngineIdMismatchError, actual [%v]", err)
+	} else if !bytes.Equal(e.Actual, []byte{0x80, 0x00, 0x1f, 0x88, 0x02}) {
+		t.Errorf("Open() - unexpected engine [%x]", e.Actual)
+	}
+	snmp.Close()
+
+	args.AllowEngineIdMismatch = true
+	snmp, _ = snmpclient2.NewSNMP("udp", "127.0.0.1:161", args)
+	if err = snmp.Open(); err != nil {
+		t.Errorf("Open() - has error %v", err)
+	}
+	snmp.Close()
+}
+
+func TestGetNextWalk(t *testing.T) {
+	mibs := map[string]snmpclient2.Variable{
+		"1.3.6.1.2.1.1.1.0":      snmpclient2.NewOctetString([]byte("Test Agent")),
+		"1.3.6.1.2.1.1.3.0":      snmpclient2.NewTimeTicks(1000),
+		"1.3.6.1.2.1.2.2.1.1.1":  snmpclient2.NewInteger(1),
+		"1.3.6.1.2.1.2.2.1.1.2":  snmpclient2.NewInteger(2),
+		"1.3.6.1.2.1.2.2.1.2.1":  snmpclient2.NewOctetString([]byte("lo")),
+		"1.3.6.1.2.1.2.2.1.2.2":  snmpclient2.NewOctetString([]byte("eth0")),
+		"1.3.6.1.2.1.31.1.1.1.1": snmpclient2.NewOctetString([]byte("lo")),
+	}
+	snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:161", snmpclient2.Arguments{
+		Version:   snmpclient2.V1,
+		Community: "public",
+		Dialer:    newMemDialer(memWalkAgent(t, mibs)),
+	})
+	defer snmp.Close()
+
+	oids, _ := snmpclient2.NewOids([]string{
+		"1.3.6.1.2.1.2.2.1.1",
+		"1.3.6.1.2.1.1",
+		"1.3.6.1.2.1.31.1.1.1.1",
+		"1.3.6.1.2.1.2.2.1.2",
+	})
+	pdu, err := snmp.GetNextWalk(oids)
+	if err != nil {
+		t.Fatalf("GetNextWalk() - has error %v", err)
+	}
+	if pdu.ErrorStatus() != snmpclient2.NoError {
+		t.Fatalf("GetNextWalk() - unexpected error status [%s]", pdu.ErrorStatus())
+	}
+
+	expected := []string{
+		"1.3.6.1.2.1.1.1.0",
+		"1.3.6.1.2.1.1.3.0",
+		"1.3.6.1.2.1.2.2.1.1.1",
+		"1.3.6.1.2.1.2.2.1.1.2",
+		"1.3.6.1.2.1.2.2.1.2.1",
+		"1.3.6.1.2.1.2.2.1.2.2",
+	}
+	vbs := pdu.VariableBindings()
+	if len(vbs) != len(expected) {
+		t.Fatalf("GetNextWalk() - expected [%d] bindings, actual [%d] %v", len(expected), len(vbs), vbs)
+	}
+	for i, vb := range vbs {
+		if vb.Oid.ToString() != expected[i] {
+			t.Errorf("GetNextWalk() - expected [%s], actual [%s]", expected[i], vb.Oid.ToString())
+		}
+	}
+}
+
+func TestRequestContext(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	snmp, _ := snmpclient2.NewSNMP("udp", conn.LocalAddr().String(), snmpclient2.Arguments{
+		Version:   snmpclient2.V2c,
+		Community: "public",
+		Timeout:   5 * time.Second,
+		Retries:   3,
+	})
+	defer snmp.Close()
+
+	oids, _ := snmpclient2.NewOids([]string{"1.3.6.1.2.1.1.1.0"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	_, err = snmp.GetRequestContext(ctx, oids)
+	if e, ok := err.(snmpclient2.ResponseError); !ok || e.Cause != context.Canceled {
+		t.Errorf("GetRequestContext() - expected [%v], actual [%v]", context.Canceled, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("GetRequestContext() - not aborted, elapsed [%s]", elapsed)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	_, err = snmp.GetBulkWalkContext(ctx, oids, 0, 10)
+	if e, ok := err.(snmpclient2.ResponseError); !ok || e.Cause != context.DeadlineExceeded {
+		t.Errorf("GetBulkWalkContext() - expected [%v], actual [%v]", context.DeadlineExceeded, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("GetBulkWalkContext() - not aborted, elapsed [%s]", elapsed)
+	}
+}
+
+func TestContextVariants(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	newSNMP := func(version snmpclient2.SnmpVersion) *snmpclient2.SNMP {
+		snmp, err := snmpclient2.NewSNMP("udp", conn.LocalAddr().String(), snmpclient2.Arguments{
+			Version:       version,
+			Community:     "public",
+			UserName:      "MyName",
+			SecurityLevel: snmpclient2.NoAuthNoPriv,
+			Timeout:       5 * time.Second,
+			Retries:       3,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return snmp
+	}
+	base := snmpclient2.MustParseOidFromString("1.3.6.1.2.1.1")
+	vbs := snmpclient2.VariableBindings{
+		snmpclient2.NewVarBind(snmpclient2.OidSysUpTime, snmpclient2.NewTimeTicks(1)),
+	}
+
+	for _, test := range []struct {
+		name    string
+		version snmpclient2.SnmpVersion
+		call    func(ctx context.Context, snmp *snmpclient2.SNMP) error
+	}{
+		{"OpenContext", snmpclient2.V3, func(ctx context.Context, snmp *snmpclient2.SNMP) error {
+			return snmp.OpenContext(ctx)
+		}},
+		{"GetNextWalkContext", snmpclient2.V1, func(ctx context.Context, snmp *snmpclient2.SNMP) error {
+			_, err := snmp.GetNextWalkContext(ctx, snmpclient2.Oids{base})
+			return err
+		}},
+		{"GetBulkWalkFuncContext", snmpclient2.V2c, func(ctx context.Context, snmp *snmpclient2.SNMP) error {
+			return snmp.GetBulkWalkFuncContext(ctx, snmpclient2.Oids{base}, 0, 10, func(snmpclient2.VariableBinding) error {
+				return nil
+			})
+		}},
+		{"WalkUntilContext", snmpclient2.V2c, func(ctx context.Context, snmp *snmpclient2.SNMP) error {
+			return snmp.WalkUntilContext(ctx, base, 10, func(snmpclient2.VariableBinding) (bool, error) {
+				return false, nil
+			})
+		}},
+		{"WalkAllContext", snmpclient2.V1, func(ctx context.Context, snmp *snmpclient2.SNMP) error {
+			_, err := snmp.WalkAllContext(ctx, base)
+			return err
+		}},
+		{"WalkTableContext", snmpclient2.V2c, func(ctx context.Context, snmp *snmpclient2.SNMP) error {
+			_, err := snmp.WalkTableContext(ctx, base, nil, 10)
+			return err
+		}},
+		{"InformRequestContext", snmpclient2.V2c, func(ctx context.Context, snmp *snmpclient2.SNMP) error {
+			return snmp.InformRequestContext(ctx, vbs)
+		}},
+	} {
+		snmp := newSNMP(test.version)
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(20*time.Millisecond, cancel)
+		start := time.Now()
+		err := test.call(ctx, snmp)
+		if e, ok := err.(snmpclient2.ResponseError); !ok || e.Cause != context.Canceled {
+			t.Errorf("%s() - expected [%v], actual [%v]", test.name, context.Canceled, err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("%s() - not aborted, elapsed [%s]", test.name, elapsed)
+		}
+		cancel()
+		snmp.Close()
+	}
+}
+
+func TestInformRequestRetries(t *testing.T) {
+	vbs := snmpclient2.VariableBindings{{Oid: snmpclient2.OidSysUpTime, Variable: snmpclient2.NewTimeTicks(100)}}
+	for _, test := range []struct {
+		name     string
+		acked    int // the attempt which is acknowledged, 0 if none
+		status   snmpclient2.ErrorStatus
+		attempts int
+	}{
+		{"acknowledged", 1, snmpclient2.NoError, 1},
+		{"retransmitted", 2, snmpclient2.NoError, 2},
+		{"lost", 0, snmpclient2.NoError, 3},
+		{"rejected", 1, snmpclient2.GenError, 1},
+	} {
+		test := test
+		var mu sync.Mutex
+		var ids []int
+		snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:162", snmpclient2.Arguments{
+			Version:   snmpclient2.V2c,
+			Community: "public",
+			Timeout:   20 * time.Millisecond,
+			Retries:   2,
+			Dialer: newMemDialer(func(req []byte) [][]byte {
+				reqPdu := &snmpclient2.PduV1{}
+				reqMsg := snmpclient2.NewMessage(snmpclient2.V2c, reqPdu).(*snmpclient2.MessageV1)
+				reqMsg.Unmarshal(req)
+				reqPdu.Unmarshal(reqMsg.PduBytes())
+				mu.Lock()
+				ids = append(ids, reqPdu.RequestId())
+				attempt := len(ids)
+				mu.Unlock()
+				if attempt != test.acked {
+					return nil
+				}
+				resPdu := snmpclient2.NewPduWithVarBinds(snmpclient2.V2c, snmpclient2.GetResponse, reqPdu.VariableBindings())
+				resPdu.SetRequestId(reqPdu.RequestId())
+				resPdu.SetErrorStatus(test.status)
+				return [][]byte{marshalV1Message(t, snmpclient2.V2c, "public", resPdu)}
+			}),
+		})
+		err := snmp.InformRequest(vbs)
+		snmp.Close()
+
+		if test.acked > 0 && test.status == snmpclient2.NoError {
+			if err != nil {
+				t.Errorf("InformRequest(%s) - has error %v", test.name, err)
+			}
+		} else if e, ok := err.(snmpclient2.InformNotAcknowledgedError); !ok || e.Attempts != test.attempts {
+			t.Errorf("InformRequest(%s) - expected not acknowledged after [%d] attempts, actual [%v]",
+				test.name, test.attempts, err)
+		}
+		mu.Lock()
+		if len(ids) != test.attempts {
+			t.Errorf("InformRequest(%s) - expected [%d] attempts, actual %v", test.name, test.attempts, ids)
+		}
+		for _, id := range ids {
+			if id != ids[0] {
+				t.Errorf("InformRequest(%s) - expected the same request id, actual %v", test.name, ids)
+				break
+			}
+		}
+		mu.Unlock()
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	var mu sync.Mutex
+	var sent []time.Time
+	dialer := newMemDialer(func([]byte) [][]byte {
+		mu.Lock()
+		sent = append(sent, time.Now())
+		mu.Unlock()
+		return nil
+	})
+	snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:161", snmpclient2.Arguments{
+		Version:      snmpclient2.V2c,
+		Community:    "public",
+		Timeout:      10 * time.Millisecond,
+		Retries:      2,
+		RetryBackoff: 50 * time.Millisecond,
+		Dialer:       dialer,
+	})
+	defer snmp.Close()
+
+	oids, _ := snmpclient2.NewOids([]string{"1.3.6.1.2.1.1.1.0"})
+	if _, err := snmp.GetRequest(oids); err == nil {
+		t.Fatal("GetRequest() - expected timeout")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(sent) != 3 {
+		t.Fatalf("GetRequest() - expected [%d] requests, actual [%d]", 3, len(sent))
+	}
+	if d := sent[1].Sub(sent[0]); d < 60*time.Millisecond {
+		t.Errorf("GetRequest() - expected the first retry after [%s], actual [%s]", 60*time.Millisecond, d)
+	}
+	if d := sent[2].Sub(sent[1]); d < 110*time.Millisecond {
+		t.Errorf("GetRequest() - expected the second retry after [%s], actual [%s]", 110*time.Millisecond, d)
+	}
+}
+
+func TestGetBulkArguments(t *testing.T) {
+	args := snmpclient2.Arguments{Version: snmpclient2.V2c, Community: "public", Timeout: time.Second}
+	snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:161", args)
+	defer snmp.Close()
+	async, _ := snmpclient2.NewAsyncSNMP("udp", "127.0.0.1:161", args)
+	defer async.Close()
+	oids := snmpclient2.MustParseOids("1.3.6.1.2.1.1")
+	for _, test := range []struct {
+		nonRepeaters   int
+		maxRepetitions int
+		message        string
+	}{
+		{-1, 10, "NonRepeaters is range 0..2147483647"},
+		{0, -1, "MaxRepetitions is range 0..2147483647"},
+	} {
+		_, err := snmp.GetBulkRequest(oids, test.nonRepeaters, test.maxRepetitions)
+		if e, ok := err.(snmpclient2.ArgumentError); !ok || e.Message != test.message {
+			t.Errorf("GetBulkRequest() - expected [%s], actual [%v]", test.message, err)
+		}
+		_, err = async.GetBulkRequest(oids, test.nonRepeaters, test.maxRepetitions)
+		if e, ok := err.(snmpclient2.ArgumentError); !ok || e.Message != test.message {
+			t.Errorf("AsyncSNMP.GetBulkRequest() - expected [%s], actual [%v]", test.message, err)
+		}
+	}
+}
+
+func TestGetBulkWalkFunc(t *testing.T) {
+	mibs := map[string]snmpclient2.Variable{
+		"1.3.6.1.2.1.1.3.0":     snmpclient2.NewTimeTicks(1000),
+		"1.3.6.1.2.1.2.2.1.1.1": snmpclient2.NewInteger(1),
+		"1.3.6.1.2.1.2.2.1.1.2": snmpclient2.NewInteger(2),
+		"1.3.6.1.2.1.2.2.1.1.3": snmpclient2.NewInteger(3),
+		"1.3.6.1.2.1.2.2.1.2.1": snmpclient2.NewOctetString([]byte("lo")),
+		"1.3.6.1.2.1.2.2.1.2.2": snmpclient2.NewOctetString([]byte("eth0")),
+		"1.3.6.1.2.1.2.2.1.2.3": snmpclient2.NewOctetString([]byte("eth1")),
+	}
+	snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:161", snmpclient2.Arguments{
+		Version:   snmpclient2.V2c,
+		Community: "public",
+		Dialer:    newMemDialer(memWalkAgent(t, mibs)),
+	})
+	defer snmp.Close()
+
+	oids, _ := snmpclient2.NewOids([]string{
+		"1.3.6.1.2.1.1.2.0",
+		"1.3.6.1.2.1.2.2.1.2",
+		"1.3.6.1.2.1.2.2.1.1",
+	})
+	var walked []string
+	err := snmp.GetBulkWalkFunc(oids, 1, 2, func(vb snmpclient2.VariableBinding) error {
+		walked = append(walked, vb.Oid.ToString())
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("GetBulkWalkFunc() - has error %v", err)
+	}
+	expected := []string{
+		"1.3.6.1.2.1.1.3.0",
+		"1.3.6.1.2.1.2.2.1.1.1",
+		"1.3.6.1.2.1.2.2.1.1.2",
+		"1.3.6.1.2.1.2.2.1.2.1",
+		"1.3.6.1.2.1.2.2.1.2.2",
+		"1.3.6.1.2.1.2.2.1.1.3",
+		"1.3.6.1.2.1.2.2.1.2.3",
+	}
+	if len(walked) != len(expected) {
+		t.Fatalf("GetBulkWalkFunc() - expected %v, actual %v", expected, walked)
+	}
+	for i := range expected {
+		if walked[i] != expected[i] {
+			t.Errorf("GetBulkWalkFunc() - expected [%s], actual [%s]", expected[i], walked[i])
+		}
+	}
+
+	pdu, err := snmp.GetBulkWalk(oids, 1, 2)
+	if err != nil {
+		t.Fatalf("GetBulkWalk() - has error %v", err)
+	}
+	if vbs := pdu.VariableBindings(); len(vbs) != len(expected) || vbs[0].Oid.ToString() != expected[0] {
+		t.Errorf("GetBulkWalk() - unexpected bindings %v", vbs)
+	}
+
+	walked = nil
+	err = snmp.GetBulkWalkFunc(oids[1:], 0, 2, func(vb snmpclient2.VariableBinding) error {
+		walked = append(walked, vb.Oid.ToString())
+		if len(walked) == 3 {
+			return snmpclient2.StopWalk
+		}
+		return nil
+	})
+	if err != nil || len(walked) != 3 {
+		t.Errorf("GetBulkWalkFunc() - expected [%d] bindings, actual %v %v", 3, walked, err)
+	}
+}
+
+func TestWalkFunc(t *testing.T) {
+	mibs := map[string]snmpclient2.Variable{
+		"1.3.6.1.2.1.4.21.1.1.10.0.0.0":   snmpclient2.NewIpaddress(10, 0, 0, 0),
+		"1.3.6.1.2.1.4.21.1.1.172.16.0.0": snmpclient2.NewIpaddress(172, 16, 0, 0),
+		"1.3.6.1.2.1.4.21.1.1.192.0.2.0":  snmpclient2.NewIpaddress(192, 0, 2, 0),
+		"1.3.6.1.2.1.4.21.1.2.10.0.0.0":   snmpclient2.NewInteger(1),
+	}
+	base, _ := snmpclient2.NewOids([]string{"1.3.6.1.2.1.4.21.1.1"})
+	for _, version := range []snmpclient2.SnmpVersion{snmpclient2.V1, snmpclient2.V2c} {
+		snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:161", snmpclient2.Arguments{
+			Version:   version,
+			Community: "public",
+			Dialer:    newMemDialer(memWalkAgent(t, mibs)),
+		})
+
+		var walked []string
+		err := snmp.WalkFunc(base, func(vb snmpclient2.VariableBinding) error {
+			walked = append(walked, vb.Oid.ToString())
+			return nil
+		})
+		if err != nil || len(walked) != 3 || walked[2] != "1.3.6.1.2.1.4.21.1.1.192.0.2.0" {
+			t.Errorf("WalkFunc(%s) - unexpected bindings %v, %v", version, walked, err)
+		}
+
+		walked = nil
+		err = snmp.WalkFunc(base, func(vb snmpclient2.VariableBinding) error {
+			walked = append(walked, vb.Oid.ToString())
+			return snmpclient2.StopWalk
+		})
+		if err != nil || len(walked) != 1 {
+			t.Errorf("WalkFunc(%s) - expected [%d] binding, actual %v %v", version, 1, walked, err)
+		}
+
+		aborted := errors.New("aborted")
+		err = snmp.WalkFunc(base, func(vb snmpclient2.VariableBinding) error {
+			return aborted
+		})
+		if err != aborted {
+			t.Errorf("WalkFunc(%s) - expected [%v], actual [%v]", version, aborted, err)
+		}
+		snmp.Close()
+	}
+}
+
+func TestWalkLoop(t *testing.T) {
+	// the agent goes back to the first row after the second row
+	rows := map[string][]string{
+		"1.3.6.1.2.1.2.2.1.1":   {"1.3.6.1.2.1.2.2.1.1.1", "1.3.6.1.2.1.2.2.1.1.2"},
+		"1.3.6.1.2.1.2.2.1.1.1": {"1.3.6.1.2.1.2.2.1.1.2"},
+		"1.3.6.1.2.1.2.2.1.1.2": {"1.3.6.1.2.1.2.2.1.1.1", "1.3.6.1.2.1.2.2.1.1.2"},
+	}
+	agent := func(req []byte) [][]byte {
+		reqPdu := &snmpclient2.PduV1{}
+		reqMsg := snmpclient2.NewMessage(snmpclient2.V1, reqPdu).(*snmpclient2.MessageV1)
+		if _, err := reqMsg.Unmarshal(req); err != nil {
+			t.Errorf("agent: Unmarshal() - has error %v", err)
+			return nil
+		}
+		if _, err := reqPdu.Unmarshal(reqMsg.PduBytes()); err != nil {
+			t.Errorf("agent: Unmarshal() - has error %v", err)
+			return nil
+		}
+		resPdu := snmpclient2.NewPdu(reqMsg.Version(), snmpclient2.GetResponse)
+		resPdu.SetRequestId(reqPdu.RequestId())
+		oids := rows[reqPdu.VariableBindings()[0].Oid.ToString()]
+		if reqPdu.PduType() == snmpclient2.GetNextRequest {
+			oids = oids[:1]
+		}
+		for i, oid := range oids {
+			resPdu.AppendVariableBinding(snmpclient2.MustParseOidFromString(oid), snmpclient2.NewInteger(int32(i)))
+		}
+		return [][]byte{marshalV1Message(t, reqMsg.Version(), string(reqMsg.Community), resPdu)}
+	}
+	oids := snmpclient2.MustParseOids("1.3.6.1.2.1.2.2.1.1")
+
+	for _, version := range []snmpclient2.SnmpVersion{snmpclient2.V1, snmpclient2.V2c} {
+		snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:161", snmpclient2.Arguments{
+			Version:   version,
+			Community: "public",
+			Dialer:    newMemDialer(agent),
+		})
+		defer snmp.Close()
+
+		var pdu snmpclient2.PDU
+		var err error
+		if version == snmpclient2.V1 {
+			pdu, err = snmp.GetNextWalk(oids)
+		} else {
+			pdu, err = snmp.GetBulkWalk(oids, 0, 2)
+		}
+		expected := "The agent returned a non-increasing OID [1.3.6.1.2.1.2.2.1.1.1] after [1.3.6.1.2.1.2.2.1.1.2]"
+		if e, ok := err.(snmpclient2.ResponseError); !ok || e.Message != expected {
+			t.Errorf("Walk(%s) - expected [%s], actual [%v]", version, expected, err)
+		}
+		if pdu == nil || len(pdu.VariableBindings()) != 2 {
+			t.Errorf("Walk(%s) - expected [2] bindings collected so far, actual %v", version, pdu)
+		}
+	}
+}
+
+func TestWalkLimits(t *testing.T) {
+	mibs := map[string]snmpclient2.Variable{
+		"1.3.6.1.2.1.2.2.1.1.1": snmpclient2.NewInteger(1),
+		"1.3.6.1.2.1.2.2.1.1.2": snmpclient2.NewInteger(2),
+		"1.3.6.1.2.1.2.2.1.1.3": snmpclient2.NewInteger(3),
+	}
+	oids := snmpclient2.MustParseOids("1.3.6.1.2.1.2.2.1.1", "1.3.6.1.2.1.2.2.1.2")
+	snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:161", snmpclient2.Arguments{
+		Version:         snmpclient2.V2c,
+		Community:       "public",
+		Dialer:          newMemDialer(memWalkAgent(t, mibs)),
+		MaxWalkVarBinds: 2,
+	})
+	defer snmp.Close()
+	pdu, err := snmp.GetBulkWalk(oids, 0, 10)
+	e, ok := err.(snmpclient2.WalkTruncatedError)
+	if !ok || e.Limit != "MaxWalkVarBinds" || e.Count != 2 ||
+		len(e.Incomplete) != 2 || e.Incomplete[0].ToString() != "1.3.6.1.2.1.2.2.1.1" {
+		t.Errorf("GetBulkWalk() - expected a WalkTruncatedError of both subtrees, actual %v", err)
+	}
+	if pdu == nil || len(pdu.VariableBindings()) != 2 {
+		t.Errorf("GetBulkWalk() - expected [2] bindings collected so far, actual %v", pdu)
+	}
+	var walked int
+	err = snmp.GetBulkWalkFunc(oids, 0, 10, func(snmpclient2.VariableBinding) error {
+		walked++
+		return nil
+	})
+	if _, ok := err.(snmpclient2.WalkTruncatedError); !ok || walked != 2 {
+		t.Errorf("GetBulkWalkFunc() - expected [2] bindings and a WalkTruncatedError, actual [%d] %v", walked, err)
+	}
+
+	agent := memWalkAgent(t, mibs)
+	for _, version := range []snmpclient2.SnmpVersion{snmpclient2.V1, snmpclient2.V2c} {
+		snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:161", snmpclient2.Arguments{
+			Version:   version,
+			Community: "public",
+			Dialer: newMemDialer(func(req []byte) [][]byte {
+				time.Sleep(20 * time.Millisecond)
+				return agent(req)
+			}),
+			MaxWalkDuration: 10 * time.Millisecond,
+		})
+		defer snmp.Close()
+
+		if version == snmpclient2.V1 {
+			pdu, err = snmp.GetNextWalk(oids[:1])
+		} else {
+			pdu, err = snmp.GetBulkWalk(oids[:1], 0, 1)
+		}
+		if e, ok := err.(snmpclient2.WalkTruncatedError); !ok || e.Limit != "MaxWalkDuration" || e.Count != 1 {
+			t.Errorf("Walk(%s) - expected a WalkTruncatedError of MaxWalkDuration, actual %v", version, err)
+		}
+		if pdu == nil || len(pdu.VariableBindings()) != 1 {
+			t.Errorf("Walk(%s) - expected [1] binding collected so far, actual %v", version, pdu)
+		}
+	}
+}
+
+func TestRequestByOidString(t *testing.T) {
+	srv, err := snmpclient2.NewUdpServerFromString("by_string", "127.0.0.1:0",
+		`iso.3.6.1.2.1.1.1.0 = STRING: "Test Agent"
+iso.3.6.1.2.1.1.5.0 = STRING: "router"
+iso.3.6.1.2.1.2.2.1.2.1 = STRING: "lo"
+iso.3.6.1.2.1.2.2.1.2.2 = STRING: "eth0"
+iso.3.6.1.2.1.2.2.1.3.1 = INTEGER: 24`, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:"+srv.GetPort(), snmpclient2.Arguments{
+		Version:   snmpclient2.V2c,
+		Community: "public",
+	})
+	defer snmp.Close()
+
+	pdu, err := snmp.GetByOidString(".1.3.6.1.2.1.1.1.0", "iso.3.6.1.2.1.1.5.0")
+	if err != nil {
+		t.Fatalf("GetByOidString() - has error %v", err)
+	}
+	if vbs := pdu.VariableBindings(); len(vbs) != 2 || string(vbs[1].Variable.Bytes()) != "router" {
+		t.Errorf("GetByOidString() - unexpected bindings %v", vbs)
+	}
+
+	pdu, err = snmp.GetNextByOidString("1.3.6.1.2.1.1.1.0")
+	if err != nil {
+		t.Fatalf("GetNextByOidString() - has error %v", err)
+	}
+	if vbs := pdu.VariableBindings(); len(vbs) != 1 || vbs[0].Oid.ToString() != "1.3.6.1.2.1.1.5.0" {
+		t.Errorf("GetNextByOidString() - unexpected bindings %v", vbs)
+	}
+
+	pdu, err = snmp.WalkByOidString("iso.3.6.1.2.1.2.2.1.2")
+	if err != nil {
+		t.Fatalf("WalkByOidString() - has error %v", err)
+	}
+	if vbs := pdu.VariableBindings(); len(vbs) != 2 || vbs[1].Oid.ToString() != "1.3.6.1.2.1.2.2.1.2.2" {
+		t.Errorf("WalkByOidString() - unexpected bindings %v", vbs)
+	}
+
+	_, err = snmp.GetByOidString("1.3.6.1.2.1.1.1.0", "1.3.6.x.1")
+	if aerr, ok := err.(snmpclient2.ArgumentError); !ok || aerr.Value != "1.3.6.x.1" {
+		t.Errorf("GetByOidString() - expected [ArgumentError 1.3.6.x.1], actual [%v]", err)
+	}
+}
+
+func TestMustParseOids(t *testing.T) {
+	oids := snmpclient2.MustParseOids(".1.3.6.1.2.1.1.1.0", "iso.3.6.1.2.1.1.5.0")
+	if len(oids) != 2 || oids[0].ToString() != "1.3.6.1.2.1.1.1.0" || oids[1].ToString() != "1.3.6.1.2.1.1.5.0" {
+		t.Errorf("MustParseOids() - unexpected oids %v", oids)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("MustParseOids() - expected a panic")
+		}
+	}()
+	snmpclient2.MustParseOids("1.3.6.x.1")
+}
+
+func TestLenientDecoding(t *testing.T) {
+	tlv := func(tag byte, contents ...[]byte) []byte {
+		b := bytes.Join(contents, nil)
+		return append([]byte{tag, byte(len(b))}, b...)
+	}
+	oid := func(last byte) []byte {
+		return tlv(0x06, []byte{0x2b, 0x06, 0x01, 0x02, 0x01, 0x01, last, 0x00})
+	}
+
+	agent := func(req []byte) [][]byte {
+		reqPdu := &snmpclient2.PduV1{}
+		reqMsg := snmpclient2.NewMessage(snmpclient2.V2c, reqPdu)
+		if _, err := reqMsg.Unmarshal(req); err != nil {
+			t.Errorf("agent: Unmarshal() - has error %v", err)
+			return nil
+		}
+		if _, err := reqPdu.Unmarshal(reqMsg.PduBytes()); err != nil {
+			t.Errorf("agent: Unmarshal() - has error %v", err)
+			return nil
+		}
+		id := uint32(reqPdu.RequestId())
+
+		varBinds := tlv(0x30,
+			// an Integer with a non-minimal length
+			tlv(0x30, oid(1), []byte{0x02, 0x05, 0x00, 0x00, 0x00, 0x00, 0x2a}),
+			// an OctetString whose length exceeds the available bytes by one
+			tlv(0x30, oid(2), []byte{0x04, 0x04, 'a', 'b', 'c'}),
+			// an empty Counter32 is unable to decode
+			tlv(0x30, oid(3), []byte{0x41, 0x00}),
+			// a Counter32 with a leading 0x00
+			tlv(0x30, oid(4), []byte{0x41, 0x05, 0x00, 0x00, 0x00, 0x00, 0x07}),
+		)
+		return [][]byte{tlv(0x30,
+			[]byte{0x02, 0x01, 0x01},
+			tlv(0x04, []byte("public")),
+			tlv(0xa2,
+				[]byte{0x02, 0x05, 0x00, byte(id >> 24), byte(id >> 16), byte(id >> 8), byte(id)},
+				[]byte{0x02, 0x01, 0x00, 0x02, 0x01, 0x00},
+				varBinds))}
+	}
+	oids := snmpclient2.MustParseOids("1.3.6.1.2.1.1.1.0")
+
+	strict, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:161", snmpclient2.Arguments{
+		Version:   snmpclient2.V2c,
+		Community: "public",
+		Dialer:    newMemDialer(agent),
+	})
+	defer strict.Close()
+	if _, err := strict.GetRequest(oids); err == nil {
+		t.Error("GetRequest() - expected an error in the strict mode")
+	}
+
+	lenient, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:161", snmpclient2.Arguments{
+		Version:         snmpclient2.V2c,
+		Community:       "public",
+		Dialer:          newMemDialer(agent),
+		LenientDecoding: true,
+	})
+	defer lenient.Close()
+	pdu, err := lenient.GetRequest(oids)
+	if err != nil {
+		t.Fatalf("GetRequest() - has error %v", err)
+	}
+
+	vbs := pdu.VariableBindings()
+	var actual []string
+	for _, vb := range vbs {
+		actual = append(actual, vb.Oid.ToString()+"="+vb.AsString())
+	}
+	expected := []string{"1.3.6.1.2.1.1.1.0=42", "1.3.6.1.2.1.1.2.0=abc", "1.3.6.1.2.1.1.4.0=7"}
+	if len(actual) != len(expected) {
+		t.Fatalf("VariableBindings() - expected %v, actual %v", expected, actual)
+	}
+	for i := range expected {
+		if actual[i] != expected[i] {
+			t.Errorf("VariableBindings() - expected [%s], actual [%s]", expected[i], actual[i])
+		}
+	}
+	if warnings := pdu.DecodeWarnings(); len(warnings) != 1 {
+		t.Errorf("DecodeWarnings() - expected 1 warning, actual %v", warnings)
+	}
+}
+
+func TestEngineCache(t *testing.T) {
+	var engineId atomic.Value
+	engineId.Store([]byte{0x80, 0x00, 0x1f, 0x88, 0x01})
+	mibs := map[string]snmpclient2.Variable{
+		"1.3.6.1.2.1.1.1.0": snmpclient2.NewOctetString([]byte("Test Agent")),
+	}
+	var requests int32
+	agent := memAgentV3(t, &engineId, mibs)
+	cache := snmpclient2.NewEngineCache(time.Minute)
+	args := snmpclient2.Arguments{
+		Version:       snmpclient2.V3,
+		UserName:      "MyName",
+		SecurityLevel: snmpclient2.NoAuthNoPriv,
+		Timeout:       time.Second,
+		EngineCache:   cache,
+		Dialer: newMemDialer(func(req []byte) [][]byte {
+			atomic.AddInt32(&requests, 1)
+			return agent(req)
+		}),
+	}
+	oids := snmpclient2.MustParseOids("1.3.6.1.2.1.1.1.0")
+
+	for i, expected := range []int32{2, 1} {
+		atomic.StoreInt32(&requests, 0)
+		snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:161", args)
+		if _, err := snmp.GetRequest(oids); err != nil {
+			t.Fatalf("GetRequest(%d) - has error %v", i, err)
+		}
+		snmp.Close()
+		if actual := atomic.LoadInt32(&requests); actual != expected {
+			t.Errorf("GetRequest(%d) - expected %d messages, actual %d", i, expected, actual)
+		}
+	}
+	if entry, ok := cache.Get("127.0.0.1:161", "MyName"); !ok ||
+		!bytes.Equal(entry.EngineId, []byte{0x80, 0x00, 0x1f, 0x88, 0x01}) || entry.EngineBoots != 3 {
+		t.Errorf("Get() - unexpected entry %v", entry)
+	}
+
+	// the agent is replaced, the cached engine is invalidated by the report
+	engineId.Store([]byte{0x80, 0x00, 0x1f, 0x88, 0x02})
+	args.DisableRediscovery = true
+	snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:161", args)
+	_, err := snmp.GetRequest(oids)
+	snmp.Close()
+	if e, ok := err.(snmpclient2.ResponseError); !ok || e.Report != "1.3.6.1.6.3.15.1.1.4.0" {
+		t.Errorf("GetRequest() - expected the unknownEngineIDs report, actual [%v]", err)
+	}
+	if cache.Len() != 0 {
+		t.Errorf("Len() - expected 0, actual %d", cache.Len())
+	}
+	// the engine is discovered again if the cached one is replaced
+	args.DisableRediscovery = false
+	for i, id := range []byte{0x02, 0x03} {
+		engineId.Store([]byte{0x80, 0x00, 0x1f, 0x88, id})
+		snmp, _ = snmpclient2.NewSNMP("udp", "127.0.0.1:161", args)
+		_, err = snmp.GetRequest(oids)
+		snmp.Close()
+		if err != nil {
+			t.Errorf("GetRequest(%d) - has error %v", i, err)
+		}
+		if stats := snmp.Stats(); stats.Rediscoveries != uint64(i) {
+			t.Errorf("GetRequest(%d) - expected [%d] rediscoveries, actual %+v", i, i, stats)
+		}
+	}
+	if entry, ok := cache.Get("127.0.0.1:161", "MyName"); !ok ||
+		!bytes.Equal(entry.EngineId, []byte{0x80, 0x00, 0x1f, 0x88, 0x03}) {
+		t.Errorf("Get() - expected the engine discovered again, actual %v", entry)
+	}
+
+	// the localized keys are cached
+	srv := newV3Server(t)
+	defer srv.Close()
+	args = v3Arguments(snmpclient2.UsmUser{UserName: "shaAes", AuthProtocol: snmpclient2.Sha,
+		AuthPassword: "sha-password", PrivProtocol: snmpclient2.Aes, PrivPassword: "aes-password"})
+	args.EngineCache = cache
+	for i := 0; i < 2; i++ {
+		snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:"+srv.GetPort(), args)
+		pdu, err := snmp.GetRequest(oids)
+		snmp.Close()
+		if err != nil {
+			t.Fatalf("GetRequest(%d) - has error %v", i, err)
+		}
+		if vb := pdu.VariableBindings().MatchOid(oids[0]); vb == nil || string(vb.Variable.Bytes()) != "USM agent" {
+			t.Errorf("GetRequest(%d) - expected [%s], actual [%v]", i, "USM agent", pdu)
+		}
+	}
+	if entry, ok := cache.Get("127.0.0.1:"+srv.GetPort(), "shaAes"); !ok ||
+		!bytes.Equal(entry.EngineId, srv.EngineId()) || len(entry.AuthKey) == 0 || len(entry.PrivKey) == 0 {
+		t.Errorf("Get() - unexpected entry %v", entry)
+	}
+
+	cache.Put("127.0.0.1:162", "MyName", snmpclient2.EngineEntry{UpdatedTime: time.Now().Add(-2 * time.Minute)})
+	if n := cache.Purge(); n != 1 || cache.Len() != 2 {
+		t.Errorf("Purge() - expected 1 entry removed and 2 kept, actual %d and %d", n, cache.Len())
+	}
+}
+
+func TestSplitOnTooBig(t *testing.T) {
+	mibs := map[string]snmpclient2.Variable{}
+	var names []string
+	for i := 1; i <= 7; i++ {
+		name := fmt.Sprintf("1.3.6.1.2.1.2.2.1.2.%d", i)
+		mibs[name] = snmpclient2.NewOctetString([]byte(fmt.Sprintf("if%d", i)))
+		names = append(names, name)
+	}
+	get, walk := memAgent(t, mibs), memWalkAgent(t, mibs)
+	var repetitions []int
+	agent := func(req []byte) [][]byte {
+		reqPdu := &snmpclient2.PduV1{}
+		reqMsg := snmpclient2.NewMessage(snmpclient2.V2c, reqPdu)
+		reqMsg.Unmarshal(req)
+		reqPdu.Unmarshal(reqMsg.PduBytes())
+
+		tooBig := len(reqPdu.VariableBindings()) > 2
+		if reqPdu.PduType() == snmpclient2.GetBulkRequest {
+			repetitions = append(repetitions, reqPdu.ErrorIndex())
+			tooBig = reqPdu.ErrorIndex() > 2
+		}
+		if tooBig {
+			resPdu := snmpclient2.NewPdu(snmpclient2.V2c, snmpclient2.GetResponse)
+			resPdu.SetRequestId(reqPdu.RequestId())
+			resPdu.SetErrorStatus(snmpclient2.TooBig)
+			return [][]byte{marshalV1Message(t, snmpclient2.V2c, "public", resPdu)}
+		}
+		if reqPdu.PduType() == snmpclient2.GetRequest {
+			return get(req)
+		}
+		return walk(req)
+	}
+
+	for _, split := range []bool{false, true} {
+		snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:161", snmpclient2.Arguments{
+			Version:       snmpclient2.V2c,
+			Community:     "public",
+			Dialer:        newMemDialer(agent),
+			SplitOnTooBig: split,
+		})
+
+		pdu, err := snmp.GetRequest(snmpclient2.MustParseOids(names...))
+		if err != nil {
+			t.Fatalf("GetRequest() - has error %v", err)
+		}
+		if !split {
+			if pdu.ErrorStatus() != snmpclient2.TooBig {
+				t.Errorf("GetRequest() - expected tooBig, actual %s", pdu)
+			}
+			snmp.Close()
+			continue
+		}
+		if pdu.ErrorStatus() != snmpclient2.NoError || len(pdu.VariableBindings()) != len(names) {
+			t.Fatalf("GetRequest() - unexpected %s", pdu)
+		}
+		for i, vb := range pdu.VariableBindings() {
+			if vb.Oid.ToString() != names[i] || vb.AsString() != fmt.Sprintf("if%d", i+1) {
+				t.Errorf("GetRequest() - expected [%s], actual %s", names[i], vb.String())
+			}
+		}
+
+		pdu, err = snmp.GetBulkRequest(snmpclient2.MustParseOids("1.3.6.1.2.1.2.2.1.2"), 0, 10)
+		if err != nil {
+			t.Fatalf("GetBulkRequest() - has error %v", err)
+		}
+		if pdu.ErrorStatus() != snmpclient2.NoError || len(pdu.VariableBindings()) != 2 {
+			t.Errorf("GetBulkRequest() - unexpected %s", pdu)
+		}
+		if fmt.Sprint(repetitions) != "[10 5 2]" {
+			t.Errorf("GetBulkRequest() - expected the repetitions [10 5 2], actual %v", repetitions)
+		}
+		snmp.Close()
+	}
+}
+
+func TestAdaptiveRepetitions(t *testing.T) {
+	mibs := map[string]snmpclient2.Variable{}
+	for i := 1; i <= 20; i++ {
+		mibs[fmt.Sprintf("1.3.6.1.2.1.2.2.1.2.%d", i)] = snmpclient2.NewOctetString([]byte(fmt.Sprintf("if%d", i)))
+	}
+	walk := memWalkAgent(t, mibs)
+	var repetitions []int
+	agent := func(req []byte) [][]byte {
+		reqPdu := &snmpclient2.PduV1{}
+		reqMsg := snmpclient2.NewMessage(snmpclient2.V2c, reqPdu)
+		reqMsg.Unmarshal(req)
+		reqPdu.Unmarshal(reqMsg.PduBytes())
+
+		repetitions = append(repetitions, reqPdu.ErrorIndex())
+		if reqPdu.ErrorIndex() > 3 {
+			resPdu := snmpclient2.NewPdu(snmpclient2.V2c, snmpclient2.GetResponse)
+			resPdu.SetRequestId(reqPdu.RequestId())
+			resPdu.SetErrorStatus(snmpclient2.TooBig)
+			return [][]byte{marshalV1Message(t, snmpclient2.V2c, "public", resPdu)}
+		}
+		return walk(req)
+	}
+
+	snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:161", snmpclient2.Arguments{
+		Version:             snmpclient2.V2c,
+		Community:           "public",
+		Dialer:              newMemDialer(agent),
+		AdaptiveRepetitions: true,
+	})
+	defer snmp.Close()
+
+	oids := snmpclient2.MustParseOids("1.3.6.1.2.1.2.2.1.2")
+	pdu, err := snmp.GetBulkWalk(oids, 0, 16)
+	if err != nil || pdu.ErrorStatus() != snmpclient2.NoError || len(pdu.VariableBindings()) != 20 {
+		t.Fatalf("GetBulkWalk() - unexpected %v, %v", pdu, err)
+	}
+	if s := fmt.Sprint(repetitions[:6]); s != "[16 8 4 2 3 3]" {
+		t.Errorf("GetBulkWalk() - expected the repetitions [16 8 4 2 3 3], actual %v", repetitions)
+	}
+	for _, n := range repetitions[4:] {
+		if n != 3 {
+			t.Errorf("GetBulkWalk() - expected the repetitions of 3, actual %v", repetitions)
+			break
+		}
+	}
+
+	// the next walk starts with the value learned
+	repetitions = nil
+	if _, err = snmp.GetBulkWalk(oids, 0, 16); err != nil {
+		t.Fatalf("GetBulkWalk() - has error %v", err)
+	}
+	if repetitions[0] != 3 {
+		t.Errorf("GetBulkWalk() - expected the repetitions from 3, actual %v", repetitions)
+	}
+}
+
+func TestConcurrentRequests(t *testing.T) {
+	var mibs bytes.Buffer
+	for i := 1; i <= 50; i++ {
+		fmt.Fprintf(&mibs, "iso.3.6.1.2.1.2.2.1.2.%d = STRING: \"if%d\"\n", i, i)
+	}
+	srv, err := snmpclient2.NewUdpServerFromString("concurrent", "127.0.0.1:0", mibs.String(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:"+srv.GetPort(), snmpclient2.Arguments{
+		Version: snmpclient2.V2c, Community: "public", Timeout: 2 * time.Second, Retries: 2})
+	defer snmp.Close()
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				oid := fmt.Sprintf("1.3.6.1.2.1.2.2.1.2.%d", i)
+				pdu, err := snmp.GetRequest(snmpclient2.MustParseOids(oid))
+				if err != nil {
+					t.Errorf("GetRequest(%s) - has error %v", oid, err)
+					return
+				}
+				vbs := pdu.VariableBindings()
+				if len(vbs) != 1 || vbs[0].Oid.ToString() != oid || vbs[0].AsString() != fmt.Sprintf("if%d", i) {
+					t.Errorf("GetRequest(%s) - expected [if%d], actual %v", oid, i, vbs)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestStaleResponse(t *testing.T) {
+	agent := memAgent(t, map[string]snmpclient2.Variable{
+		"1.3.6.1.2.1.1.1.0": snmpclient2.NewOctetString([]byte("Test Agent")),
+	})
+	dialer := newMemDialer(func(req []byte) [][]byte {
+		// a late response to a previous request comes first
+		stale := snmpclient2.NewPdu(snmpclient2.V2c, snmpclient2.GetResponse)
+		stale.SetRequestId(1)
+		stale.AppendVariableBinding(snmpclient2.MustParseOidFromString("1.3.6.1.2.1.1.5.0"),
+			snmpclient2.NewOctetString([]byte("stale")))
+		return append([][]byte{marshalV1Message(t, snmpclient2.V2c, "public", stale)}, agent(req)...)
+	})
+	snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:161", snmpclient2.Arguments{
+		Version:   snmpclient2.V2c,
+		Community: "public",
+		Timeout:   time.Second,
+		Dialer:    dialer,
+	})
+	defer snmp.Close()
+
+	pdu, err := snmp.GetRequest(snmpclient2.MustParseOids("1.3.6.1.2.1.1.1.0"))
+	if err != nil {
+		t.Fatalf("GetRequest() - has error %v", err)
+	}
+	if vbs := pdu.VariableBindings(); len(vbs) != 1 || vbs[0].AsString() != "Test Agent" {
+		t.Errorf("GetRequest() - expected [Test Agent], actual %v", vbs)
+	}
+	if stats := snmp.Stats(); stats.ResponsesReceived != 2 || stats.Retries != 0 {
+		t.Errorf("GetRequest() - expected the stale response is skipped, actual %+v", stats)
+	}
+}
+
+func TestStrictResponse(t *testing.T) {
+	// the agent answers the sysName of every request
+	dialer := newMemDialer(func(req []byte) [][]byte {
+		reqPdu := &snmpclient2.PduV1{}
+		reqMsg := snmpclient2.NewMessage(snmpclient2.V2c, reqPdu).(*snmpclient2.MessageV1)
+		if _, err := reqMsg.Unmarshal(req); err != nil {
+			t.Errorf("agent: Unmarshal() - has error %v", err)
+			return nil
+		}
+		if _, err := reqPdu.Unmarshal(reqMsg.PduBytes()); err != nil {
+			t.Errorf("agent: Unmarshal() - has error %v", err)
+			return nil
+		}
+		resPdu := snmpclient2.NewPdu(snmpclient2.V2c, snmpclient2.GetResponse)
+		resPdu.SetRequestId(reqPdu.RequestId())
+		resPdu.AppendVariableBinding(snmpclient2.MustParseOidFromString("1.3.6.1.2.1.1.5.0"),
+			snmpclient2.NewOctetString([]byte("router")))
+		return [][]byte{marshalV1Message(t, snmpclient2.V2c, "public", resPdu)}
+	})
+	args := snmpclient2.Arguments{
+		Version:   snmpclient2.V2c,
+		Community: "public",
+		Timeout:   time.Second,
+		Dialer:    dialer,
+	}
+	snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:161", args)
+	defer snmp.Close()
+	if _, err := snmp.GetRequest(snmpclient2.MustParseOids("1.3.6.1.2.1.1.1.0")); err != nil {
+		t.Errorf("GetRequest() - has error %v", err)
+	}
+
+	args.StrictResponse = true
+	strict, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:161", args)
+	defer strict.Close()
+	_, err := strict.GetRequest(snmpclient2.MustParseOids("1.3.6.1.2.1.1.1.0"))
+	if e, ok := err.(snmpclient2.ResponseError); !ok ||
+		e.Message != "The response has OID [1.3.6.1.2.1.1.5.0] at [0], expected [1.3.6.1.2.1.1.1.0]" {
+		t.Errorf("GetRequest() - expected the mismatched OID, actual [%v]", err)
+	}
+	_, err = strict.GetRequest(snmpclient2.MustParseOids("1.3.6.1.2.1.1.1.0", "1.3.6.1.2.1.1.5.0"))
+	if e, ok := err.(snmpclient2.ResponseError); !ok ||
+		e.Message != "The response has [1] variable bindings, expected [2]" {
+		t.Errorf("GetRequest() - expected the mismatched number, actual [%v]", err)
+	}
+	if _, err = strict.GetNextRequest(snmpclient2.MustParseOids("1.3.6.1.2.1.1.1.0")); err != nil {
+		t.Errorf("GetNextRequest() - has error %v", err)
+	}
+}
+
+func TestReturnPduErrors(t *testing.T) {
+	srv, err := snmpclient2.NewUdpServer("errors", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	if err = srv.LoadCommunityFromString("public", `iso.3.6.1.2.1.1.1.0 = STRING: "Test Agent"`); err != nil {
+		t.Fatal(err)
+	}
+	srv.Register(snmpclient2.MustParseOidFromString("1.3.6.1.2.1.1.5.0"), func(snmpclient2.PDU) (snmpclient2.Variable, error) {
+		return nil, snmpclient2.PduError{Status: snmpclient2.NoSuchName}
+	})
+
+	args := snmpclient2.Arguments{Version: snmpclient2.V2c, Community: "public", Timeout: time.Second}
+	snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:"+srv.GetPort(), args)
+	defer snmp.Close()
+	oids := snmpclient2.MustParseOids("1.3.6.1.2.1.1.1.0", "1.3.6.1.2.1.1.5.0")
+	if pdu, err := snmp.GetRequest(oids); err != nil || pdu.ErrorStatus() != snmpclient2.NoSuchName {
+		t.Errorf("GetRequest() - expected NoSuchName in the PDU, actual %v %v", pdu, err)
+	}
+
+	// SetRequest returns the error status without ReturnPduErrors
+	pdu, err := snmp.SetRequest(snmpclient2.VariableBindings{snmpclient2.NewVarBind(
+		snmpclient2.MustParseOidFromString("1.3.6.1.2.1.1.4.0"), snmpclient2.NewOctetString([]byte("admin")))})
+	var pduErr snmpclient2.PduError
+	if !errors.As(err, &pduErr) || pduErr.Status != snmpclient2.NotWritable || pduErr.Index != 1 || pdu == nil {
+		t.Errorf("SetRequest() - expected PduError of NotWritable, actual [%v]", err)
+	}
+	if expected := "Received an error status from the agent - NotWritable, index [1] oid [1.3.6.1.2.1.1.4.0]"; err == nil ||
+		err.Error() != expected {
+		t.Errorf("SetRequest() - expected [%s], actual [%v]", expected, err)
+	}
+
+	args.ReturnPduErrors = true
+	snmp, _ = snmpclient2.NewSNMP("udp", "127.0.0.1:"+srv.GetPort(), args)
+	defer snmp.Close()
+	pdu, err = snmp.GetRequest(oids)
+	var noSuchName snmpclient2.NoSuchNameError
+	if !errors.As(err, &noSuchName) || noSuchName.Index != 2 || !noSuchName.Oid.Equal(&oids[1]) || pdu == nil {
+		t.Errorf("GetRequest() - expected NoSuchNameError of [%s], actual [%v]", oids[1].ToString(), err)
+	}
+	if _, err = snmp.GetRequest(oids[:1]); err != nil {
+		t.Errorf("GetRequest() - has error %v", err)
+	}
+
+}
+
+func TestRediscovery(t *testing.T) {
+	srv := newV3Server(t)
+	defer srv.Close()
+
+	oids := snmpclient2.MustParseOids("1.3.6.1.2.1.1.1.0")
+	args := v3Arguments(snmpclient2.UsmUser{UserName: "md5", AuthProtocol: snmpclient2.Md5,
+		AuthPassword: "md5-password"})
+	snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:"+srv.GetPort(), args)
+	defer snmp.Close()
+	args.DisableRediscovery = true
+	strict, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:"+srv.GetPort(), args)
+	defer strict.Close()
+	for _, s := range []*snmpclient2.SNMP{snmp, strict} {
+		if _, err := s.GetRequest(oids); err != nil {
+			t.Fatalf("GetRequest() - has error %v", err)
+		}
+	}
+
+	// the agent is replaced
+	srv.SetEngineId([]byte{0x80, 0x00, 0x1f, 0x88, 0x04, 'n', 'e', 'w'})
+	pdu, err := snmp.GetRequest(oids)
+	if err != nil {
+		t.Fatalf("GetRequest() - has error %v", err)
+	}
+	if vbs := pdu.VariableBindings(); len(vbs) != 1 || vbs[0].Variable.IsError() {
+		t.Errorf("GetRequest() - expected the value after the rediscovery, actual %v", vbs)
+	}
+	if stats := snmp.Stats(); stats.Rediscoveries != 1 {
+		t.Errorf("Stats() - expected [1] rediscovery, actual %+v", stats)
+	}
+
+	_, err = strict.GetRequest(oids)
+	if e, ok := err.(snmpclient2.ResponseError); !ok || e.Report != "1.3.6.1.6.3.15.1.1.4.0" {
+		t.Errorf("GetRequest() - expected the report of usmStatsUnknownEngineIDs, actual [%v]", err)
+	}
+	if stats := strict.Stats(); stats.Rediscoveries != 0 {
+		t.Errorf("Stats() - expected no rediscovery, actual %+v", stats)
+	}
+}
+
+func BenchmarkGetRequest(b *testing.B) {
+	srv, err := snmpclient2.NewUdpServerFromString("bench", "127.0.0.1:0",
+		`iso.3.6.1.2.1.1.1.0 = STRING: "Test Agent"
+iso.3.6.1.2.1.1.3.0 = Timeticks: (1000) 0:00:10.00`, false)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer srv.Close()
+
+	snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:"+srv.GetPort(), snmpclient2.Arguments{
+		Version: snmpclient2.V2c, Community: "public", Timeout: time.Second})
+	defer snmp.Close()
+	oids := snmpclient2.MustParseOids("1.3.6.1.2.1.1.1.0", "1.3.6.1.2.1.1.3.0")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := snmp.GetRequest(oids); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package snmpclient2
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// MibFormat is the format of the data files of the simulator
+type MibFormat int
+
+const (
+	// MibFormatAuto detects the format by the first data line
+	MibFormatAuto MibFormat = iota
+	// MibFormatSnmpwalk is the output of snmpwalk, e.g.
+	//  iso.3.6.1.2.1.1.5.0 = STRING: "router"
+	MibFormatSnmpwalk
+	// MibFormatNumeric is the output of 'snmpwalk -On', e.g.
+	//  .1.3.6.1.2.1.1.5.0 = STRING: "router"
+	MibFormatNumeric
+	// MibFormatSnmprec is the .snmprec format of snmpsim, e.g.
+	//  1.3.6.1.2.1.1.5.0|4|router
+	MibFormatSnmprec
+	// MibFormatJSON is the JSON array of the variable bindings, e.g.
+	//  [{"oid":"1.3.6.1.2.1.1.5.0","type":"OctetString","value":"router"}]
+	MibFormatJSON
+	// MibFormatPcap is a pcap or a pcapng capture of the SNMP responses
+	MibFormatPcap
+)
+
+func (f MibFormat) String() string {
+	switch f {
+	case MibFormatAuto:
+		return "auto"
+	case MibFormatSnmpwalk:
+		return "snmpwalk"
+	case MibFormatNumeric:
+		return "numeric"
+	case MibFormatSnmprec:
+		return "snmprec"
+	case MibFormatJSON:
+		return "json"
+	case MibFormatPcap:
+		return "pcap"
+	default:
+		return "unknown(" + strconv.Itoa(int(f)) + ")"
+	}
+}
+
+// DetectMibFormat returns the format of the first data line, the blank
+// lines and the comments are skipped. A capture is detected by its magic
+// number.
+func DetectMibFormat(text []byte) MibFormat {
+	if isPcap(text) {
+		return MibFormatPcap
+	}
+	if isJSONArray(text) {
+		return MibFormatJSON
+	}
+	scanner := bufio.NewScanner(strings.NewReader(string(text)))
+	scanner.Buffer(nil, mega)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if idx := strings.IndexByte(line, '|'); idx > 0 {
+			if eq := strings.IndexByte(line, '='); eq < 0 || eq > idx {
+				return MibFormatSnmprec
+			}
+		}
+		if strings.HasPrefix(line, ".") {
+			return MibFormatNumeric
+		}
+		return MibFormatSnmpwalk
+	}
+	return MibFormatSnmpwalk
+}
+
+// ReadSnmprec reads the "oid|tag|value" lines of the .snmprec format, a
+// tag with the 'x' suffix means the value is hex encoded. The lines which
+// can not be parsed are errors with their line numbers.
+func ReadSnmprec(reader io.Reader, cb func(oid Oid, value Variable) error) error {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(nil, mega)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		oid, value, err := ParseSnmprecLine(line)
+		if err != nil {
+			return fmt.Errorf("line %d: %v", n, err)
+		}
+		if err = cb(oid, value); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// ParseSnmprecLine parses a "oid|tag|value" line. The variation modules of
+// snmpsim are not simulated, the value of a "tag:module" line is the static
+// one of its "value" or "initial" parameter, e.g.
+//
+//	1.3.6.1.2.1.2.2.1.10.1|65:numeric|initial=100,rate=10
+func ParseSnmprecLine(line string) (Oid, Variable, error) {
+	fields := strings.SplitN(line, "|", 3)
+	if len(fields) != 3 {
+		return Oid{}, nil, fmt.Errorf("'%s' is not \"oid|tag|value\"", line)
+	}
+
+	oid, err := ParseOidFromString(strings.Trim(strings.TrimSpace(fields[0]), "."))
+	if err != nil {
+		return Oid{}, nil, err
+	}
+
+	tag, value := strings.TrimSpace(fields[1]), fields[2]
+	if idx := strings.IndexByte(tag, ':'); idx >= 0 {
+		if value, err = variationValue(tag[idx+1:], value); err != nil {
+			return Oid{}, nil, err
+		}
+		tag = tag[:idx]
+	}
+	isHex := strings.HasSuffix(tag, "x")
+	if isHex {
+		tag = strings.TrimSuffix(tag, "x")
+	}
+	code, err := strconv.Atoi(tag)
+	if err != nil {
+		return Oid{}, nil, fmt.Errorf("tag '%s' is not supported", fields[1])
+	}
+
+	var raw []byte
+	if isHex {
+		if raw, err = hex.DecodeString(strings.TrimSpace(value)); err != nil {
+			return Oid{}, nil, fmt.Errorf("value '%s' is not hex - %v", value, err)
+		}
+		value = string(raw)
+	}
+
+	var v Variable
+	switch code {
+	case 2:
+		v, err = NewIntegerFromString(strings.TrimSpace(value))
+	case 4:
+		v = NewOctetString([]byte(value))
+	case 5:
+		v = NewNull()
+	case 6:
+		v, err = NewOidFromString(strings.Trim(strings.TrimSpace(value), "."))
+	case 64:
+		if isHex {
+			if len(raw) != 4 {
+				return Oid{}, nil, fmt.Errorf("value '%s' is not an IpAddress", fields[2])
+			}
+			v = NewIpaddress(raw[0], raw[1], raw[2], raw[3])
+		} else {
+			v, err = NewIPAddressFromString(strings.TrimSpace(value))
+		}
+	case 65:
+		v, err = NewCounter32FromString(strings.TrimSpace(value))
+	case 66:
+		v, err = NewGauge32FromString(strings.TrimSpace(value))
+	case 67:
+		v, err = NewTimeticksFromString(strings.TrimSpace(value))
+	case 68:
+		v = NewOpaque([]byte(value))
+	case 70:
+		v, err = NewCounter64FromString(strings.TrimSpace(value))
+	case 128:
+		v = NewNoSucheObject()
+	case 129:
+		v = NewNoSucheInstance()
+	case 130:
+		v = NewEndOfMibView()
+	default:
+		return Oid{}, nil, fmt.Errorf("tag '%s' is not supported", fields[1])
+	}
+	if err != nil {
+		return Oid{}, nil, err
+	}
+	return oid, v, nil
+}
+
+// variationValue returns the static value of the parameters of a variation
+// module, e.g. "initial=100,rate=10"
+func variationValue(module, params string) (string, error) {
+	initial, found := "", false
+	for _, param := range strings.Split(params, ",") {
+		kv := strings.SplitN(param, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch strings.TrimSpace(kv[0]) {
+		case "value":
+			return kv[1], nil
+		case "initial":
+			initial, found = kv[1], true
+		}
+	}
+	if !found {
+		return "", fmt.Errorf("variation '%s' has no static value", module)
+	}
+	return initial, nil
+}
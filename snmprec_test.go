@@ -0,0 +1,115 @@
+package snmpclient2
+
+import (
+	"strings"
+	"testing"
+)
+
+const snmprec_string = `# captured from a router
+1.3.6.1.2.1.1.1.0|4|Cisco IOS
+1.3.6.1.2.1.1.2.0|6|1.3.6.1.4.1.9.1.1
+1.3.6.1.2.1.1.3.0|67|123456
+1.3.6.1.2.1.2.1.0|2|-2
+1.3.6.1.2.1.2.2.1.6.1|4x|00225d0eef00
+1.3.6.1.2.1.2.2.1.10.1|65|4294967295
+1.3.6.1.2.1.2.2.1.5.1|66|100000000
+1.3.6.1.2.1.31.1.1.1.6.1|70|18446744073709551615
+1.3.6.1.2.1.4.20.1.1.10.0.0.1|64|10.0.0.1
+1.3.6.1.2.1.4.20.1.1.10.0.0.2|64x|0a000002
+1.3.6.1.2.1.2.2.1.16.1|65:numeric|initial=12,rate=100
+1.3.6.1.2.1.2.2.1.2.1|4x:writecache|value=65746830
+`
+
+const numeric_string = `.1.3.6.1.2.1.1.1.0 = STRING: "Cisco IOS"
+.1.3.6.1.2.1.1.2.0 = OID: .1.3.6.1.4.1.9.1.1
+.1.3.6.1.2.1.1.3.0 = Timeticks: (123456) 0:20:34.56
+.1.3.6.1.2.1.2.1.0 = INTEGER: -2
+.1.3.6.1.2.1.2.2.1.6.1 = Hex-STRING: 00 22 5D 0E EF 00
+.1.3.6.1.2.1.2.2.1.10.1 = Counter32: 4294967295
+.1.3.6.1.2.1.2.2.1.5.1 = Gauge32: 100000000
+.1.3.6.1.2.1.31.1.1.1.6.1 = Counter64: 18446744073709551615
+.1.3.6.1.2.1.4.20.1.1.10.0.0.1 = IpAddress: 10.0.0.1
+.1.3.6.1.2.1.4.20.1.1.10.0.0.2 = IpAddress: 10.0.0.2
+`
+
+var formatted_values = []struct {
+	oid   string
+	value string
+}{
+	{oid: "1.3.6.1.2.1.1.1.0", value: "[octets]436973636f20494f53"},
+	{oid: "1.3.6.1.2.1.1.2.0", value: "[oid]1.3.6.1.4.1.9.1.1"},
+	{oid: "1.3.6.1.2.1.1.3.0", value: "[timeticks]123456"},
+	{oid: "1.3.6.1.2.1.2.1.0", value: "[int]-2"},
+	{oid: "1.3.6.1.2.1.2.2.1.6.1", value: "[octets]00225d0eef00"},
+	{oid: "1.3.6.1.2.1.2.2.1.10.1", value: "[counter32]4294967295"},
+	{oid: "1.3.6.1.2.1.2.2.1.5.1", value: "[gauge32]100000000"},
+	{oid: "1.3.6.1.2.1.31.1.1.1.6.1", value: "[counter64]18446744073709551615"},
+	{oid: "1.3.6.1.2.1.4.20.1.1.10.0.0.1", value: "[ip]10.0.0.1"},
+	{oid: "1.3.6.1.2.1.4.20.1.1.10.0.0.2", value: "[ip]10.0.0.2"},
+}
+
+// the values of the variations in snmprec_string
+var variation_values = []struct {
+	oid   string
+	value string
+}{
+	{oid: "1.3.6.1.2.1.2.2.1.16.1", value: "[counter32]12"},
+	{oid: "1.3.6.1.2.1.2.2.1.2.1", value: "[octets]65746830"},
+}
+
+func TestLoadFormats(t *testing.T) {
+	for _, test := range []struct {
+		format MibFormat
+		text   string
+	}{
+		{MibFormatSnmprec, snmprec_string},
+		{MibFormatNumeric, numeric_string},
+	} {
+		if format := DetectMibFormat([]byte(test.text)); format != test.format {
+			t.Errorf("DetectMibFormat() - expected [%v], actual [%v]", test.format, format)
+		}
+
+		srv, e := NewUdpServerFromString("a", "127.0.0.1:0", test.text, false)
+		if nil != e {
+			t.Errorf("NewUdpServerFromString(%v) - has error %v", test.format, e)
+			continue
+		}
+		for _, expected := range formatted_values {
+			oid, _ := ParseOidFromString(expected.oid)
+			v := srv.GetValueByOid(srv.mibs, oid)
+			if nil == v {
+				t.Errorf("%v: %s is not found", test.format, expected.oid)
+			} else if v.String() != expected.value {
+				t.Errorf("%v: %s - expected [%s], actual [%s]", test.format, expected.oid, expected.value, v.String())
+			}
+		}
+		if MibFormatSnmprec == test.format {
+			for _, expected := range variation_values {
+				oid, _ := ParseOidFromString(expected.oid)
+				if v := srv.GetValueByOid(srv.mibs, oid); nil == v || v.String() != expected.value {
+					t.Errorf("%v: %s - expected [%s], actual [%v]", test.format, expected.oid, expected.value, v)
+				}
+			}
+		}
+		srv.Close()
+	}
+}
+
+func TestLoadFormatsLineError(t *testing.T) {
+	for _, test := range []struct {
+		format MibFormat
+		text   string
+	}{
+		{MibFormatSnmprec, "1.3.6.1.2.1.1.1.0|4|Cisco IOS\n\n1.3.6.1.2.1.1.2.0|99|x\n"},
+		{MibFormatSnmprec, "1.3.6.1.2.1.1.1.0|4|Cisco IOS\n# comment\nsysName.0 router\n"},
+		{MibFormatSnmprec, "1.3.6.1.2.1.1.1.0|4|Cisco IOS\n\n1.3.6.1.2.1.1.3.0|67:involatilecache|key=1\n"},
+		{MibFormatNumeric, ".1.3.6.1.2.1.1.1.0 = STRING: \"Cisco IOS\"\n\ngarbage\n"},
+		{MibFormatNumeric, ".1.3.6.1.2.1.1.1.0 = STRING: \"Cisco IOS\"\n\n.1.3.6.1.2.1.1.3.0 = Bits: 01\n"},
+	} {
+		srv := &UdpServer{mibs: NewMibTree()}
+		e := srv.LoadMibsWithFormat("", strings.NewReader(test.text), test.format, false)
+		if nil == e || !strings.HasPrefix(e.Error(), "line 3: ") {
+			t.Errorf("LoadMibsWithFormat(%v) - expected [line 3: ...], actual [%v]", test.format, e)
+		}
+	}
+}
@@ -0,0 +1,420 @@
+// Package socks provides a SOCKS5 (RFC 1928) Dialer for snmpclient2.
+//
+// UDP networks are dialed with UDP ASSOCIATE so that SNMP datagrams are
+// relayed by the proxy, TCP networks are dialed with CONNECT.
+//
+//	snmp, err := snmpclient2.NewSNMP("udp", "10.0.0.1:161", snmpclient2.Arguments{
+//		Version:   snmpclient2.V2c,
+//		Community: "public",
+//		Dialer:    &socks.Dialer{ProxyAddress: "bastion:1080"},
+//	})
+package socks
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	socksVersion = 0x05
+
+	authNone         = 0x00
+	authPassword     = 0x02
+	authNoAcceptable = 0xff
+
+	cmdConnect      = 0x01
+	cmdUdpAssociate = 0x03
+
+	atypIPv4   = 0x01
+	atypDomain = 0x03
+	atypIPv6   = 0x04
+)
+
+var replyMessages = map[byte]string{
+	0x01: "general SOCKS server failure",
+	0x02: "connection not allowed by ruleset",
+	0x03: "network unreachable",
+	0x04: "host unreachable",
+	0x05: "connection refused",
+	0x06: "TTL expired",
+	0x07: "command not supported",
+	0x08: "address type not supported",
+}
+
+// An Error suggests that the proxy could not be used, it is never a
+// timeout of the target so that the SNMP retry logic does not retry it.
+type Error struct {
+	Op    string // Operation that failed, "connect", "auth" or "associate"
+	Proxy string // Address of the proxy
+	Err   error  // Cause of the error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("socks %s %s: %v", e.Op, e.Proxy, e.Err)
+}
+
+// A Dialer dials through a SOCKS5 proxy.
+type Dialer struct {
+	ProxyAddress string        // Address of the proxy, "host:port"
+	UserName     string        // User name, empty means no authentication
+	Password     string        // Password of the user
+	Timeout      time.Duration // Timeout of the proxy handshake (The default is 5sec)
+
+	// Forward is used to connect to the proxy (The default is a net.Dialer)
+	Forward interface {
+		DialContext(ctx context.Context, network, address string) (net.Conn, error)
+	}
+}
+
+// DialContext connects to address via the proxy.
+func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+		return d.dialTcp(ctx, address)
+	case "udp", "udp4", "udp6":
+		return d.dialUdp(ctx, network, address)
+	}
+	return nil, &Error{Op: "connect", Proxy: d.ProxyAddress,
+		Err: errors.New("unsupported network - " + network)}
+}
+
+func (d *Dialer) dialTcp(ctx context.Context, address string) (net.Conn, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	conn, err := d.handshake(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = d.request(ctx, conn, cmdConnect, address); err != nil {
+		conn.Close()
+		return nil, &Error{Op: "connect", Proxy: d.ProxyAddress, Err: err}
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// dialUdp associates with the proxy, a host name of address is resolved by
+// the proxy so that the names known behind it only are reachable
+func (d *Dialer) dialUdp(ctx context.Context, network, address string) (net.Conn, error) {
+	header, err := marshalAddr(address)
+	if err != nil {
+		return nil, err
+	}
+	var target net.Addr = &targetAddr{network: network, address: address}
+	if host, _, _ := net.SplitHostPort(address); net.ParseIP(host) != nil {
+		if target, err = net.ResolveUDPAddr(network, address); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	ctrl, err := d.handshake(ctx)
+	if err != nil {
+		return nil, err
+	}
+	relay, err := d.request(ctx, ctrl, cmdUdpAssociate, "0.0.0.0:0")
+	if err != nil {
+		ctrl.Close()
+		return nil, &Error{Op: "associate", Proxy: d.ProxyAddress, Err: err}
+	}
+
+	// RFC 1928 Section 6, an unspecified address means the proxy itself
+	if relay.IP.IsUnspecified() {
+		if host, _, e := net.SplitHostPort(d.ProxyAddress); e == nil {
+			if ips, e := net.DefaultResolver.LookupIPAddr(ctx, host); e == nil && len(ips) > 0 {
+				relay.IP = ips[0].IP
+			}
+		}
+	}
+
+	pc, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: relay.IP, Port: relay.Port})
+	if err != nil {
+		ctrl.Close()
+		return nil, &Error{Op: "associate", Proxy: d.ProxyAddress, Err: err}
+	}
+	ctrl.SetDeadline(time.Time{})
+
+	// RFC 1928 Section 7, RSV, FRAG and the address of the target
+	c := &udpConn{UDPConn: pc, ctrl: ctrl, target: target, header: append([]byte{0, 0, 0}, header...)}
+	go c.watch()
+	return c, nil
+}
+
+// withTimeout limits ctx by the timeout of the proxy handshake
+func (d *Dialer) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := d.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+func (d *Dialer) handshake(ctx context.Context) (net.Conn, error) {
+	var forward = d.Forward
+	if forward == nil {
+		forward = &net.Dialer{}
+	}
+	conn, err := forward.DialContext(ctx, "tcp", d.ProxyAddress)
+	if err != nil {
+		return nil, &Error{Op: "connect", Proxy: d.ProxyAddress, Err: err}
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if err = d.authenticate(conn); err != nil {
+		conn.Close()
+		return nil, &Error{Op: "auth", Proxy: d.ProxyAddress, Err: err}
+	}
+	return conn, nil
+}
+
+func (d *Dialer) authenticate(conn net.Conn) error {
+	method := byte(authNone)
+	if d.UserName != "" {
+		method = authPassword
+	}
+	if _, err := conn.Write([]byte{socksVersion, 1, method}); err != nil {
+		return err
+	}
+
+	var buf [2]byte
+	if _, err := io.ReadFull(conn, buf[:]); err != nil {
+		return err
+	}
+	if buf[0] != socksVersion {
+		return fmt.Errorf("unexpected version %d", buf[0])
+	}
+	switch buf[1] {
+	case authNone:
+		return nil
+	case authPassword:
+		if len(d.UserName) > 255 || len(d.Password) > 255 {
+			return errors.New("user name or password is too long")
+		}
+		// RFC 1929
+		b := []byte{0x01, byte(len(d.UserName))}
+		b = append(b, d.UserName...)
+		b = append(b, byte(len(d.Password)))
+		b = append(b, d.Password...)
+		if _, err := conn.Write(b); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, buf[:]); err != nil {
+			return err
+		}
+		if buf[1] != 0 {
+			return errors.New("user name or password is rejected")
+		}
+		return nil
+	case authNoAcceptable:
+		return errors.New("no acceptable authentication methods")
+	}
+	return fmt.Errorf("unsupported authentication method %d", buf[1])
+}
+
+func (d *Dialer) request(ctx context.Context, conn net.Conn, cmd byte, address string) (*net.UDPAddr, error) {
+	addr, err := marshalAddr(address)
+	if err != nil {
+		return nil, err
+	}
+	b := append([]byte{socksVersion, cmd, 0}, addr...)
+	if _, err = conn.Write(b); err != nil {
+		return nil, err
+	}
+
+	var head [3]byte
+	if _, err = io.ReadFull(conn, head[:]); err != nil {
+		return nil, err
+	}
+	if head[0] != socksVersion {
+		return nil, fmt.Errorf("unexpected version %d", head[0])
+	}
+	if head[1] != 0 {
+		if msg, ok := replyMessages[head[1]]; ok {
+			return nil, errors.New(msg)
+		}
+		return nil, fmt.Errorf("unknown reply %d", head[1])
+	}
+	return readAddr(ctx, conn)
+}
+
+func marshalAddr(address string) ([]byte, error) {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, errors.New("invalid port - " + portStr)
+	}
+
+	var b []byte
+	if ip := net.ParseIP(host); ip == nil {
+		if len(host) > 255 {
+			return nil, errors.New("host name is too long - " + host)
+		}
+		b = append([]byte{atypDomain, byte(len(host))}, host...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		b = append([]byte{atypIPv4}, ip4...)
+	} else {
+		b = append([]byte{atypIPv6}, ip.To16()...)
+	}
+	return append(b, byte(port>>8), byte(port)), nil
+}
+
+// readAddr reads the address of a reply, a host name is resolved
+func readAddr(ctx context.Context, r io.Reader) (*net.UDPAddr, error) {
+	atyp, host, port, err := readRawAddr(r)
+	if err != nil {
+		return nil, err
+	}
+
+	addr := &net.UDPAddr{Port: port}
+	if atyp == atypDomain {
+		ips, err := net.DefaultResolver.LookupIPAddr(ctx, string(host))
+		if err != nil {
+			return nil, err
+		}
+		addr.IP = ips[0].IP
+	} else {
+		addr.IP = net.IP(host)
+	}
+	return addr, nil
+}
+
+func readRawAddr(r io.Reader) (byte, []byte, int, error) {
+	var atyp [1]byte
+	if _, err := io.ReadFull(r, atyp[:]); err != nil {
+		return 0, nil, 0, err
+	}
+
+	var host []byte
+	switch atyp[0] {
+	case atypIPv4:
+		host = make([]byte, net.IPv4len)
+	case atypIPv6:
+		host = make([]byte, net.IPv6len)
+	case atypDomain:
+		var l [1]byte
+		if _, err := io.ReadFull(r, l[:]); err != nil {
+			return 0, nil, 0, err
+		}
+		host = make([]byte, l[0])
+	default:
+		return 0, nil, 0, fmt.Errorf("unknown address type %d", atyp[0])
+	}
+	var port [2]byte
+	if _, err := io.ReadFull(r, host); err != nil {
+		return 0, nil, 0, err
+	}
+	if _, err := io.ReadFull(r, port[:]); err != nil {
+		return 0, nil, 0, err
+	}
+	return atyp[0], host, int(binary.BigEndian.Uint16(port[:])), nil
+}
+
+// targetAddr is the address of a target resolved by the proxy
+type targetAddr struct {
+	network string
+	address string
+}
+
+func (a *targetAddr) Network() string { return a.network }
+func (a *targetAddr) String() string  { return a.address }
+
+// udpConn is a datagram connection relayed by the proxy, the association
+// lasts as long as the control connection.
+type udpConn struct {
+	*net.UDPConn
+	ctrl   net.Conn
+	target net.Addr
+	header []byte
+
+	mu        sync.Mutex
+	closeErr  error
+	closeOnce sync.Once
+}
+
+func (c *udpConn) watch() {
+	io.Copy(io.Discard, c.ctrl)
+	c.mu.Lock()
+	if c.closeErr == nil {
+		c.closeErr = errors.New("association is closed by the proxy")
+	}
+	c.mu.Unlock()
+	c.Close()
+}
+
+func (c *udpConn) Read(b []byte) (int, error) {
+	buf := make([]byte, len(b)+len(c.header)+256)
+	for {
+		n, err := c.UDPConn.Read(buf)
+		if err != nil {
+			c.mu.Lock()
+			if c.closeErr != nil {
+				err = &Error{Op: "associate", Proxy: c.ctrl.RemoteAddr().String(), Err: c.closeErr}
+			}
+			c.mu.Unlock()
+			return 0, err
+		}
+		// RFC 1928 Section 7, fragments are not supported
+		if n < 4 || buf[2] != 0 {
+			continue
+		}
+		rd := &byteReader{b: buf[3:n]}
+		if _, _, _, err = readRawAddr(rd); err != nil {
+			continue
+		}
+		return copy(b, rd.b), nil
+	}
+}
+
+func (c *udpConn) Write(b []byte) (int, error) {
+	_, err := c.UDPConn.Write(append(append([]byte{}, c.header...), b...))
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *udpConn) RemoteAddr() net.Addr {
+	return c.target
+}
+
+func (c *udpConn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		c.mu.Lock()
+		if c.closeErr == nil {
+			c.closeErr = errors.New("use of closed connection")
+		}
+		c.mu.Unlock()
+		c.ctrl.Close()
+		err = c.UDPConn.Close()
+	})
+	return err
+}
+
+type byteReader struct {
+	b []byte
+}
+
+func (r *byteReader) Read(p []byte) (int, error) {
+	if len(r.b) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, r.b)
+	r.b = r.b[n:]
+	return n, nil
+}
@@ -0,0 +1,280 @@
+package socks_test
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/runner-mei/snmpclient2"
+	"github.com/runner-mei/snmpclient2/socks"
+)
+
+// socksServer is a minimal SOCKS5 server supporting CONNECT and UDP ASSOCIATE.
+type socksServer struct {
+	ln       net.Listener
+	userName string
+	password string
+	hosts    map[string]net.IP // names resolved by the proxy only
+}
+
+func newSocksServer(t *testing.T, userName, password string) *socksServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &socksServer{ln: ln, userName: userName, password: password}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *socksServer) Addr() string { return s.ln.Addr().String() }
+func (s *socksServer) Close()       { s.ln.Close() }
+
+func (s *socksServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	var head [2]byte
+	if _, err := io.ReadFull(conn, head[:]); err != nil {
+		return
+	}
+	methods := make([]byte, head[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return
+	}
+	if s.userName == "" {
+		conn.Write([]byte{5, 0})
+	} else {
+		conn.Write([]byte{5, 2})
+		var l [2]byte
+		io.ReadFull(conn, l[:])
+		user := make([]byte, l[1])
+		io.ReadFull(conn, user)
+		io.ReadFull(conn, l[:1])
+		pass := make([]byte, l[0])
+		io.ReadFull(conn, pass)
+		if string(user) != s.userName || string(pass) != s.password {
+			conn.Write([]byte{1, 1})
+			return
+		}
+		conn.Write([]byte{1, 0})
+	}
+
+	var req [4]byte
+	if _, err := io.ReadFull(conn, req[:]); err != nil {
+		return
+	}
+	dst := readAddr(conn, req[3])
+
+	switch req[1] {
+	case 1: // CONNECT
+		target, err := net.Dial("tcp", dst.String())
+		if err != nil {
+			conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+			return
+		}
+		defer target.Close()
+		conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+		go io.Copy(target, conn)
+		io.Copy(conn, target)
+	case 3: // UDP ASSOCIATE
+		relay, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			return
+		}
+		defer relay.Close()
+		port := relay.LocalAddr().(*net.UDPAddr).Port
+		conn.Write([]byte{5, 0, 0, 1, 127, 0, 0, 1, byte(port >> 8), byte(port)})
+		go s.relay(relay)
+		io.Copy(io.Discard, conn)
+	default:
+		conn.Write([]byte{5, 7, 0, 1, 0, 0, 0, 0, 0, 0})
+	}
+}
+
+func (s *socksServer) relay(relay *net.UDPConn) {
+	var client *net.UDPAddr
+	buf := make([]byte, 65535)
+	for {
+		n, from, err := relay.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		if client == nil || from.String() == client.String() {
+			client = from
+			if n < 10 {
+				continue
+			}
+			switch buf[3] {
+			case 1:
+				dst := &net.UDPAddr{IP: net.IP(buf[4:8]), Port: int(binary.BigEndian.Uint16(buf[8:10]))}
+				relay.WriteToUDP(buf[10:n], dst)
+			case 3:
+				l := int(buf[4])
+				ip, ok := s.hosts[string(buf[5:5+l])]
+				if !ok {
+					continue
+				}
+				dst := &net.UDPAddr{IP: ip, Port: int(binary.BigEndian.Uint16(buf[5+l : 7+l]))}
+				relay.WriteToUDP(buf[7+l:n], dst)
+			}
+			continue
+		}
+		b := []byte{0, 0, 0, 1}
+		b = append(b, from.IP.To4()...)
+		b = append(b, byte(from.Port>>8), byte(from.Port))
+		relay.WriteToUDP(append(b, buf[:n]...), client)
+	}
+}
+
+func readAddr(r io.Reader, atyp byte) *net.UDPAddr {
+	var ip []byte
+	switch atyp {
+	case 1:
+		ip = make([]byte, 4)
+	case 4:
+		ip = make([]byte, 16)
+	default:
+		return &net.UDPAddr{}
+	}
+	io.ReadFull(r, ip)
+	var port [2]byte
+	io.ReadFull(r, port[:])
+	return &net.UDPAddr{IP: ip, Port: int(binary.BigEndian.Uint16(port[:]))}
+}
+
+const mibs = `iso.3.6.1.2.1.1.1.0 = STRING: "Behind the bastion"`
+
+func TestUdpAssociate(t *testing.T) {
+	srv, err := snmpclient2.NewUdpServerFromString("socks", "127.0.0.1:0", mibs, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	proxy := newSocksServer(t, "monitor", "secret")
+	defer proxy.Close()
+
+	snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:"+srv.GetPort(), snmpclient2.Arguments{
+		Version:   snmpclient2.V2c,
+		Community: "public",
+		Timeout:   time.Second,
+		Dialer: &socks.Dialer{
+			ProxyAddress: proxy.Addr(),
+			UserName:     "monitor",
+			Password:     "secret",
+		},
+	})
+	defer snmp.Close()
+
+	oids, _ := snmpclient2.NewOids([]string{"1.3.6.1.2.1.1.1.0"})
+	pdu, err := snmp.GetRequest(oids)
+	if err != nil {
+		t.Fatalf("GetRequest() - has error %v", err)
+	}
+	vb := pdu.VariableBindings().MatchOid(oids[0])
+	if vb == nil || string(vb.Variable.Bytes()) != "Behind the bastion" {
+		t.Errorf("GetRequest() - expected [%s], actual [%v]", "Behind the bastion", vb)
+	}
+}
+
+func TestUdpAssociateHostName(t *testing.T) {
+	srv, err := snmpclient2.NewUdpServerFromString("socks", "127.0.0.1:0", mibs, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	proxy := newSocksServer(t, "", "")
+	proxy.hosts = map[string]net.IP{"agent.behind.bastion.invalid": net.IPv4(127, 0, 0, 1).To4()}
+	defer proxy.Close()
+
+	snmp, _ := snmpclient2.NewSNMP("udp", "agent.behind.bastion.invalid:"+srv.GetPort(), snmpclient2.Arguments{
+		Version:   snmpclient2.V2c,
+		Community: "public",
+		Timeout:   time.Second,
+		Dialer:    &socks.Dialer{ProxyAddress: proxy.Addr()},
+	})
+	defer snmp.Close()
+
+	oids, _ := snmpclient2.NewOids([]string{"1.3.6.1.2.1.1.1.0"})
+	pdu, err := snmp.GetRequest(oids)
+	if err != nil {
+		t.Fatalf("GetRequest() - has error %v", err)
+	}
+	if vb := pdu.VariableBindings().MatchOid(oids[0]); vb == nil {
+		t.Errorf("GetRequest() - expected [%s], actual %s", "Behind the bastion", pdu)
+	}
+}
+
+func TestAssociateFailure(t *testing.T) {
+	proxy := newSocksServer(t, "monitor", "secret")
+	defer proxy.Close()
+
+	snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:161", snmpclient2.Arguments{
+		Version:   snmpclient2.V2c,
+		Community: "public",
+		Retries:   3,
+		Dialer: &socks.Dialer{
+			ProxyAddress: proxy.Addr(),
+			UserName:     "monitor",
+			Password:     "wrong",
+		},
+	})
+	defer snmp.Close()
+
+	err := snmp.Open()
+	e, ok := err.(*socks.Error)
+	if !ok {
+		t.Fatalf("Open() - expected *socks.Error, actual [%v]", err)
+	}
+	if e.Op != "auth" {
+		t.Errorf("Open() - expected [%s], actual [%s]", "auth", e.Op)
+	}
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		t.Error("Open() - association failure must not be a timeout")
+	}
+}
+
+func TestConnect(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(conn, conn)
+	}()
+
+	proxy := newSocksServer(t, "", "")
+	defer proxy.Close()
+
+	d := &socks.Dialer{ProxyAddress: proxy.Addr()}
+	conn, err := d.DialContext(context.Background(), "tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("DialContext() - has error %v", err)
+	}
+	defer conn.Close()
+
+	conn.Write([]byte("ping"))
+	buf := make([]byte, 4)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err = io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+		t.Errorf("DialContext() - expected [%s], actual [%s] %v", "ping", buf, err)
+	}
+}
@@ -0,0 +1,111 @@
+package snmpclient2
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a snapshot of the counters of an SNMP object, the counters are
+// cumulative since the SNMP object is created.
+type Stats struct {
+	RequestsSent      uint64        // Messages sent, including the retries and the discovery
+	ResponsesReceived uint64        // Messages received
+	Retries           uint64        // Requests sent again after a failure
+	Timeouts          uint64        // Requests which are not answered in time
+	Reports           uint64        // Report PDUs received
+	Rediscoveries     uint64        // Engines discovered again after a report of an unknown engine ID
+	MarshalErrors     uint64        // Requests which are unable to encode
+	UnmarshalErrors   uint64        // Responses which are unable to decode or to verify
+	BytesSent         uint64        // Octets of the messages sent
+	BytesReceived     uint64        // Octets of the messages received
+	RoundTrips        time.Duration // Cumulative round-trip time of the responses received
+	LastRoundTrip     time.Duration // Round-trip time of the last response received
+}
+
+// snmpStats are the counters of an SNMP object, they are shared by the SNMP
+// objects which are derived from it, such as the discovery probe.
+type snmpStats struct {
+	requestsSent      uint64
+	responsesReceived uint64
+	retries           uint64
+	timeouts          uint64
+	reports           uint64
+	rediscoveries     uint64
+	marshalErrors     uint64
+	unmarshalErrors   uint64
+	bytesSent         uint64
+	bytesReceived     uint64
+	roundTrips        int64
+	lastRoundTrip     int64
+}
+
+func (st *snmpStats) add(counter *uint64, delta uint64) {
+	if st != nil {
+		atomic.AddUint64(counter, delta)
+	}
+}
+
+func (st *snmpStats) roundTrip(rtt time.Duration) {
+	if st != nil {
+		atomic.AddInt64(&st.roundTrips, int64(rtt))
+		atomic.StoreInt64(&st.lastRoundTrip, int64(rtt))
+	}
+}
+
+// Stats returns a snapshot of the counters, it is safe to call while the
+// requests are in flight.
+func (s *SNMP) Stats() Stats {
+	st := s.stats
+	if st == nil {
+		return Stats{}
+	}
+	return Stats{
+		RequestsSent:      atomic.LoadUint64(&st.requestsSent),
+		ResponsesReceived: atomic.LoadUint64(&st.responsesReceived),
+		Retries:           atomic.LoadUint64(&st.retries),
+		Timeouts:          atomic.LoadUint64(&st.timeouts),
+		Reports:           atomic.LoadUint64(&st.reports),
+		Rediscoveries:     atomic.LoadUint64(&st.rediscoveries),
+		MarshalErrors:     atomic.LoadUint64(&st.marshalErrors),
+		UnmarshalErrors:   atomic.LoadUint64(&st.unmarshalErrors),
+		BytesSent:         atomic.LoadUint64(&st.bytesSent),
+		BytesReceived:     atomic.LoadUint64(&st.bytesReceived),
+		RoundTrips:        time.Duration(atomic.LoadInt64(&st.roundTrips)),
+		LastRoundTrip:     time.Duration(atomic.LoadInt64(&st.lastRoundTrip)),
+	}
+}
+
+// ServerStats is a snapshot of the counters of an UdpServer
+type ServerStats struct {
+	Requests           map[PduType]uint64 // Requests served by the PDU type
+	UnknownCommunities uint64             // Requests with an unknown community
+	DecodeFailures     uint64             // Messages which are unable to decode
+	InjectedDrops      uint64             // Requests dropped by the Faults
+	InjectedDuplicates uint64             // Responses sent twice by the Faults
+}
+
+// Stats returns a snapshot of the counters of the UdpServer
+func (self *UdpServer) Stats() ServerStats {
+	stats := ServerStats{
+		Requests:           map[PduType]uint64{},
+		UnknownCommunities: atomic.LoadUint64(&self.rejected),
+		DecodeFailures:     atomic.LoadUint64(&self.decodeFailures),
+		InjectedDrops:      atomic.LoadUint64(&self.injectedDrops),
+		InjectedDuplicates: atomic.LoadUint64(&self.injectedDuplicates),
+	}
+	for t := range self.served {
+		if n := atomic.LoadUint64(&self.served[t]); n > 0 {
+			stats.Requests[PduType(t)] = n
+		}
+	}
+	return stats
+}
+
+// decodeFailed counts and logs a message which is unable to decode, the
+// message is returned as an error
+func (self *UdpServer) decodeFailed(format string, args ...interface{}) error {
+	atomic.AddUint64(&self.decodeFailures, 1)
+	self.warnf(format, args...)
+	return fmt.Errorf(format, args...)
+}
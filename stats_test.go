@@ -0,0 +1,76 @@
+package snmpclient2_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/runner-mei/snmpclient2"
+)
+
+func TestStats(t *testing.T) {
+	srv, err := snmpclient2.NewUdpServer("stats", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	if err = srv.LoadCommunityFromString("public", `iso.3.6.1.2.1.1.1.0 = STRING: "Test Agent"`); err != nil {
+		t.Fatal(err)
+	}
+
+	snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:"+srv.GetPort(), snmpclient2.Arguments{
+		Version: snmpclient2.V2c, Community: "public", Timeout: time.Second})
+	defer snmp.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			snmp.Stats()
+		}
+	}()
+	for i := 0; i < 2; i++ {
+		if _, err = snmp.GetRequest(snmpclient2.MustParseOids("1.3.6.1.2.1.1.1.0")); err != nil {
+			t.Fatalf("GetRequest() - has error %v", err)
+		}
+	}
+	<-done
+
+	stats := snmp.Stats()
+	if stats.RequestsSent != 2 || stats.ResponsesReceived != 2 || stats.Retries != 0 || stats.Timeouts != 0 {
+		t.Errorf("Stats() - expected [2] requests and responses, actual %+v", stats)
+	}
+	if stats.BytesSent == 0 || stats.BytesReceived <= stats.BytesSent ||
+		stats.RoundTrips < stats.LastRoundTrip || stats.LastRoundTrip <= 0 {
+		t.Errorf("Stats() - unexpected octets or round-trip time, actual %+v", stats)
+	}
+
+	other, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:"+srv.GetPort(), snmpclient2.Arguments{
+		Version: snmpclient2.V2c, Community: "private", Timeout: 20 * time.Millisecond, Retries: 1})
+	defer other.Close()
+	if _, err = other.GetRequest(snmpclient2.MustParseOids("1.3.6.1.2.1.1.1.0")); err == nil {
+		t.Fatal("GetRequest() - expected an error of the unknown community")
+	}
+	stats = other.Stats()
+	if stats.RequestsSent != 2 || stats.Retries != 1 || stats.Timeouts != 2 || stats.ResponsesReceived != 0 {
+		t.Errorf("Stats() - expected [2] timeouts and [1] retry, actual %+v", stats)
+	}
+
+	conn, err := net.Dial("udp", "127.0.0.1:"+srv.GetPort())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte{0x04, 0x01, 0x00})
+	for i := 0; i < 100 && srv.Stats().DecodeFailures == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	srvStats := srv.Stats()
+	if srvStats.Requests[snmpclient2.GetRequest] != 2 || len(srvStats.Requests) != 1 {
+		t.Errorf("UdpServer.Stats() - expected [2] GetRequests, actual %v", srvStats.Requests)
+	}
+	if srvStats.UnknownCommunities != 2 || srvStats.DecodeFailures != 1 {
+		t.Errorf("UdpServer.Stats() - expected [2] unknown communities and [1] decode failure, actual %+v", srvStats)
+	}
+}
@@ -0,0 +1,138 @@
+package snmpclient2
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// WalkTable walks the columns of a conceptual table and groups the values
+// by the row index, rows["3"][2] is the value of the column 2 in the row 3.
+// columns are the OIDs of the columns (tableOid.1.N), all of the columns are
+// walked if none is specified. The missing cells of a sparse table are
+// absent from the rows.
+func (s *SNMP) WalkTable(tableOid Oid, columns []Oid) (map[string]map[int]Variable, error) {
+	return s.WalkTableWithRepetitions(tableOid, columns, 10)
+}
+
+// WalkTableWithRepetitions is WalkTable using maxRepetitions for the
+// GetBulkRequests (ignored by V1 which walks with GetNextRequests)
+func (s *SNMP) WalkTableWithRepetitions(tableOid Oid, columns []Oid, maxRepetitions int) (map[string]map[int]Variable, error) {
+	return s.WalkTableContext(context.Background(), tableOid, columns, maxRepetitions)
+}
+
+// WalkTableContext is WalkTableWithRepetitions that aborts when ctx is done
+func (s *SNMP) WalkTableContext(ctx context.Context, tableOid Oid, columns []Oid,
+	maxRepetitions int) (map[string]map[int]Variable, error) {
+	rows := map[string]map[int]Variable{}
+	err := s.walkTable(ctx, tableOid, columns, maxRepetitions, func(column int, index []int, v Variable) {
+		key := joinSubIds(index)
+		row := rows[key]
+		if row == nil {
+			row = map[int]Variable{}
+			rows[key] = row
+		}
+		row[column] = v
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// A Row is a row of a conceptual table, Columns[2] is the value of the
+// column 2 (tableOid.1.2.Index)
+type Row struct {
+	Index   Oid
+	Columns map[int]Variable
+}
+
+// GetTable walks all of the columns of a conceptual table and returns the
+// rows in the order of the indexes, the missing cells of a sparse table are
+// absent from the Columns
+func (s *SNMP) GetTable(tableOid Oid) ([]Row, error) {
+	return s.GetTableContext(context.Background(), tableOid, nil, 10)
+}
+
+// GetTableContext is GetTable of the columns (all of the columns if none is
+// specified) using maxRepetitions, which aborts when ctx is done
+func (s *SNMP) GetTableContext(ctx context.Context, tableOid Oid, columns []Oid,
+	maxRepetitions int) ([]Row, error) {
+	var rows []Row
+	positions := map[string]int{}
+	err := s.walkTable(ctx, tableOid, columns, maxRepetitions, func(column int, index []int, v Variable) {
+		key := joinSubIds(index)
+		pos, ok := positions[key]
+		if !ok {
+			pos = len(rows)
+			positions[key] = pos
+			rows = append(rows, Row{Index: NewOid(append([]int(nil), index...)), Columns: map[int]Variable{}})
+		}
+		rows[pos].Columns[column] = v
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].Index.Compare(&rows[j].Index) < 0
+	})
+	return rows, nil
+}
+
+// walkTable walks the columns of the table and calls fn with the column,
+// the index and the value of the cells
+func (s *SNMP) walkTable(ctx context.Context, tableOid Oid, columns []Oid, maxRepetitions int,
+	fn func(column int, index []int, v Variable)) error {
+	entry := NewOid(append(append([]int(nil), tableOid.Value...), 1))
+	oids := Oids(columns)
+	if len(oids) == 0 {
+		oids = Oids{entry}
+	}
+	for _, column := range oids {
+		if !column.Contains(&entry) {
+			return ArgumentError{
+				Value:   column.ToString(),
+				Message: fmt.Sprintf("Column is not in the table %s", tableOid.ToString()),
+			}
+		}
+	}
+
+	add := func(vb VariableBinding) error {
+		sub := vb.Oid.Value
+		if !vb.Oid.Contains(&entry) || len(sub) < len(entry.Value)+2 {
+			return nil
+		}
+		fn(sub[len(entry.Value)], sub[len(entry.Value)+1:], vb.Variable)
+		return nil
+	}
+
+	if s.args.Version == V1 {
+		pdu, err := s.GetNextWalkContext(ctx, oids)
+		if err != nil {
+			return err
+		}
+		if pdu.ErrorStatus() != NoError {
+			return ResponseError{
+				Message: fmt.Sprintf("Failed to walk the table %s - %s",
+					tableOid.ToString(), pdu.ErrorStatus()),
+				Detail: fmt.Sprintf("PDU - %s", pdu),
+			}
+		}
+		for _, vb := range pdu.VariableBindings() {
+			add(vb)
+		}
+		return nil
+	}
+
+	return s.GetBulkWalkFuncContext(ctx, oids, 0, maxRepetitions, add)
+}
+
+func joinSubIds(subs []int) string {
+	ss := make([]string, len(subs))
+	for i, sub := range subs {
+		ss[i] = strconv.Itoa(sub)
+	}
+	return strings.Join(ss, ".")
+}
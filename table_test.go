@@ -0,0 +1,98 @@
+package snmpclient2_test
+
+import (
+	"testing"
+
+	"github.com/runner-mei/snmpclient2"
+)
+
+func TestWalkTable(t *testing.T) {
+	mibs := map[string]snmpclient2.Variable{
+		"1.3.6.1.2.1.2.1.0":     snmpclient2.NewInteger(3),
+		"1.3.6.1.2.1.2.2.1.1.1": snmpclient2.NewInteger(1),
+		"1.3.6.1.2.1.2.2.1.1.3": snmpclient2.NewInteger(3),
+		"1.3.6.1.2.1.2.2.1.2.1": snmpclient2.NewOctetString([]byte("lo")),
+		"1.3.6.1.2.1.2.2.1.2.2": snmpclient2.NewOctetString([]byte("eth0")),
+		"1.3.6.1.2.1.2.2.1.2.3": snmpclient2.NewOctetString([]byte("eth1")),
+		"1.3.6.1.2.1.2.2.1.3.3": snmpclient2.NewInteger(6),
+		"1.3.6.1.2.1.4.1.0":     snmpclient2.NewInteger(1),
+	}
+	table, _ := snmpclient2.ParseOidFromString("1.3.6.1.2.1.2.2")
+	ifIndex, _ := snmpclient2.ParseOidFromString("1.3.6.1.2.1.2.2.1.1")
+	ifDescr, _ := snmpclient2.ParseOidFromString("1.3.6.1.2.1.2.2.1.2")
+
+	for _, version := range []snmpclient2.SnmpVersion{snmpclient2.V1, snmpclient2.V2c} {
+		snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:161", snmpclient2.Arguments{
+			Version:   version,
+			Community: "public",
+			Dialer:    newMemDialer(memWalkAgent(t, mibs)),
+		})
+
+		rows, err := snmp.WalkTableWithRepetitions(table, []snmpclient2.Oid{ifIndex, ifDescr}, 2)
+		if err != nil {
+			t.Fatalf("WalkTable(%s) - has error %v", version, err)
+		}
+		if len(rows) != 3 {
+			t.Errorf("WalkTable(%s) - expected [%d] rows, actual %v", version, 3, rows)
+		}
+		if v := rows["3"][2]; v == nil || string(v.Bytes()) != "eth1" {
+			t.Errorf("WalkTable(%s) - expected [%s], actual [%v]", version, "eth1", v)
+		}
+		if _, ok := rows["2"][1]; ok {
+			t.Errorf("WalkTable(%s) - unexpected ifIndex of the row 2", version)
+		}
+		if _, ok := rows["3"][3]; ok {
+			t.Errorf("WalkTable(%s) - unexpected column 3", version)
+		}
+
+		rows, err = snmp.WalkTable(table, nil)
+		if err != nil {
+			t.Fatalf("WalkTable(%s) - has error %v", version, err)
+		}
+		if v := rows["3"][3]; v == nil || v.Int() != 6 {
+			t.Errorf("WalkTable(%s) - expected [%d], actual [%v]", version, 6, v)
+		}
+		snmp.Close()
+	}
+}
+
+func TestGetTable(t *testing.T) {
+	mibs := map[string]snmpclient2.Variable{
+		"1.3.6.1.2.1.4.20.1.1.10.0.0.1":  snmpclient2.NewIpaddress(10, 0, 0, 1),
+		"1.3.6.1.2.1.4.20.1.1.127.0.0.1": snmpclient2.NewIpaddress(127, 0, 0, 1),
+		"1.3.6.1.2.1.4.20.1.2.10.0.0.1":  snmpclient2.NewInteger(2),
+		"1.3.6.1.2.1.4.20.1.2.127.0.0.1": snmpclient2.NewInteger(1),
+		"1.3.6.1.2.1.4.20.1.2.9.9.9.9":   snmpclient2.NewInteger(3),
+		"1.3.6.1.2.1.4.21.1.1.0.0.0.0":   snmpclient2.NewIpaddress(0, 0, 0, 0),
+	}
+	table, _ := snmpclient2.ParseOidFromString("1.3.6.1.2.1.4.20")
+
+	for _, version := range []snmpclient2.SnmpVersion{snmpclient2.V1, snmpclient2.V2c} {
+		snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:161", snmpclient2.Arguments{
+			Version:   version,
+			Community: "public",
+			Dialer:    newMemDialer(memWalkAgent(t, mibs)),
+		})
+
+		rows, err := snmp.GetTable(table)
+		if err != nil {
+			t.Fatalf("GetTable(%s) - has error %v", version, err)
+		}
+		expected := []string{"9.9.9.9", "10.0.0.1", "127.0.0.1"}
+		if len(rows) != len(expected) {
+			t.Fatalf("GetTable(%s) - expected [%d] rows, actual %v", version, len(expected), rows)
+		}
+		for i, row := range rows {
+			if index := row.Index.ToString(); index != expected[i] {
+				t.Errorf("GetTable(%s) - expected the index [%s], actual [%s]", version, expected[i], index)
+			}
+		}
+		if v := rows[1].Columns[2]; v == nil || v.Int() != 2 {
+			t.Errorf("GetTable(%s) - expected [%d], actual [%v]", version, 2, v)
+		}
+		if _, ok := rows[0].Columns[1]; ok || len(rows[0].Columns) != 1 {
+			t.Errorf("GetTable(%s) - unexpected columns of the sparse row %v", version, rows[0].Columns)
+		}
+		snmp.Close()
+	}
+}
@@ -0,0 +1,178 @@
+package snmpclient2
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+
+	"github.com/runner-mei/snmpclient2/dtls"
+)
+
+// the context engine ID of the agent which receives the message, the agent
+// substitutes its own snmpEngineID (RFC5343 Section 3.1)
+var localEngineId = []byte{0x80, 0x00, 0x00, 0x00, 0x06}
+
+// isTls reports whether network is the TLS transport of SNMP (RFC6353), which
+// is "tls", "tls4" or "tls6"
+func isTls(network string) bool {
+	return network == "tls" || network == "tls4" || network == "tls6"
+}
+
+// isDtls reports whether network is the DTLS transport of SNMP (RFC6353),
+// which is "dtls", "dtls4" or "dtls6"
+func isDtls(network string) bool {
+	return network == "dtls" || network == "dtls4" || network == "dtls6"
+}
+
+// isTsm reports whether the messages on network are secured by TSM, which
+// are the TLS and the DTLS transports
+func isTsm(network string) bool {
+	return isTls(network) || isDtls(network)
+}
+
+// tlsUnderlying returns the network under the TLS or the DTLS transport,
+// e.g. "tcp4" of "tls4" and "udp6" of "dtls6"
+func tlsUnderlying(network string) string {
+	if isDtls(network) {
+		return "udp" + strings.TrimPrefix(network, "dtls")
+	}
+	return "tcp" + strings.TrimPrefix(network, "tls")
+}
+
+// validateTransport checks the network of the Arguments, the TLS and the
+// DTLS transports require SNMPv3
+func (a *Arguments) validateTransport(network string) error {
+	if isTsm(network) && a.Version != V3 {
+		return ArgumentError{
+			Value:   a.Version,
+			Message: "TLS and DTLS transports require SNMP Version 3",
+		}
+	}
+	return nil
+}
+
+// newTlsConfig returns the TLS configuration of the agent at address, it is
+// a clone of TLSConfig with the certificates of CertFile, KeyFile and CAFile
+func (a *Arguments) newTlsConfig(address string) (*tls.Config, error) {
+	config := &tls.Config{}
+	if a.TLSConfig != nil {
+		config = a.TLSConfig.Clone()
+	}
+	if config.MinVersion == 0 {
+		// TLS 1.2 at least (RFC9456)
+		config.MinVersion = tls.VersionTLS12
+	}
+	if config.ServerName == "" {
+		if host, _, err := net.SplitHostPort(address); err == nil {
+			config.ServerName = host
+		}
+	}
+
+	if a.CertFile != "" || a.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(a.CertFile, a.KeyFile)
+		if err != nil {
+			return nil, ArgumentError{
+				Value:   a.CertFile,
+				Message: "Failed to load the certificate - " + err.Error(),
+			}
+		}
+		config.Certificates = append(config.Certificates, cert)
+	}
+	if a.CAFile != "" {
+		pem, err := ioutil.ReadFile(a.CAFile)
+		if err != nil {
+			return nil, ArgumentError{
+				Value:   a.CAFile,
+				Message: "Failed to load the CAs - " + err.Error(),
+			}
+		}
+		pool := x509.NewCertPool()
+		if config.RootCAs != nil {
+			pool = config.RootCAs.Clone()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, ArgumentError{
+				Value:   a.CAFile,
+				Message: "CAFile has no certificate",
+			}
+		}
+		config.RootCAs = pool
+	}
+	return config, nil
+}
+
+// dialTls dials the agent over TCP, or over UDP on "dtls", and completes
+// the handshake within ConnectTimeout
+func (s *SNMP) dialTls(ctx context.Context) (net.Conn, error) {
+	conn, err := dial(ctx, s.args.Dialer, tlsUnderlying(s.Network), s.Address, s.args.ConnectTimeout, s.localAddr)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.args.ConnectTimeout)
+	defer cancel()
+	if isDtls(s.Network) {
+		dtlsConn := dtls.Client(conn, s.tlsConfig)
+		if err = dtlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return dtlsConn, nil
+	}
+	tlsConn := tls.Client(conn, s.tlsConfig)
+	if err = tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// TSM is the Transport Security Model (RFC5591), the messages are secured by
+// the TLS or the DTLS transport instead of USM. The security parameters are
+// empty, the scoped PDU is not encrypted by the message, and the agent maps
+// the certificate of the client to the security name. The flags of the
+// messages are always AuthPriv since the transport authenticates and
+// encrypts them, the agents grant the access by the security level of the
+// message (RFC5591 Section 4.2).
+type TSM struct{}
+
+func (t *TSM) GenerateRequestMessage(args *Arguments, sendMsg Message) error {
+	m := sendMsg.(*MessageV3)
+	m.SecurityModel = securityTsm
+
+	p := sendMsg.PDU().(*ScopedPdu)
+	if args.ContextEngineId != "" {
+		p.ContextEngineId, _ = engineIdToBytes(args.ContextEngineId)
+	} else {
+		p.ContextEngineId = localEngineId
+	}
+	if args.ContextName != "" {
+		p.ContextName = []byte(args.ContextName)
+	}
+
+	pduBytes, err := p.Marshal()
+	if err != nil {
+		return err
+	}
+	m.SetPduBytes(pduBytes)
+	return nil
+}
+
+func (t *TSM) ProcessIncomingMessage(args *Arguments, recvMsg Message) error {
+	rm := recvMsg.(*MessageV3)
+	if _, err := rm.PDU().Unmarshal(rm.PduBytes()); err != nil {
+		return ResponseError{
+			Cause:   err,
+			Message: "Failed to Unmarshal PDU",
+			Detail:  fmt.Sprintf("PDU Bytes - [%s]", ToHexStr(rm.PduBytes(), " ")),
+		}
+	}
+	return nil
+}
+
+func (t *TSM) String() string {
+	return "{}"
+}
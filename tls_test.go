@@ -0,0 +1,324 @@
+package snmpclient2_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/runner-mei/snmpclient2"
+	"github.com/runner-mei/snmpclient2/dtls"
+)
+
+// newCertificate returns a certificate of the name signed by parent, it is
+// self-signed if parent is nil
+func newCertificate(t *testing.T, name string, parent *tls.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  parent == nil,
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	signer, signerKey := template, interface{}(key)
+	if parent != nil {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _ := x509.ParseCertificate(der)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+// writeCertificate writes the certificate and the key in PEM to dir
+func writeCertificate(t *testing.T, dir, name string, cert tls.Certificate) (certFile, keyFile string) {
+	certFile, keyFile = filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	der, err := x509.MarshalECPrivateKey(cert.PrivateKey.(*ecdsa.PrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+// tsmResponse returns the response of the agent to the request of TSM, nil
+// if the request is invalid
+func tsmResponse(t *testing.T, req []byte) []byte {
+	reqPdu := &snmpclient2.ScopedPdu{}
+	reqMsg := snmpclient2.NewMessage(snmpclient2.V3, reqPdu).(*snmpclient2.MessageV3)
+	if _, err := reqMsg.Unmarshal(req); err != nil {
+		t.Errorf("agent: Unmarshal() - has error %v", err)
+		return nil
+	}
+	if reqMsg.SecurityModel.String() != "TSM" || len(reqMsg.UserName) != 0 {
+		t.Errorf("agent: expected the message of TSM, actual %s", reqMsg)
+	}
+	if !reqMsg.Authentication() || !reqMsg.Privacy() {
+		t.Errorf("agent: expected the message of authPriv, actual %s", reqMsg)
+	}
+	if _, err := reqPdu.Unmarshal(reqMsg.PduBytes()); err != nil {
+		t.Errorf("agent: Unmarshal() - has error %v", err)
+		return nil
+	}
+	if !bytes.Equal(reqPdu.ContextEngineId, []byte{0x80, 0, 0, 0, 6}) {
+		t.Errorf("agent: expected the localEngineID, actual [%x]", reqPdu.ContextEngineId)
+	}
+
+	resPdu := &snmpclient2.ScopedPdu{ContextEngineId: []byte{0x80, 0, 0x1f, 0x88, 4, 1}}
+	resPdu.PduV1 = *snmpclient2.NewPdu(snmpclient2.V2c, snmpclient2.GetResponse).(*snmpclient2.PduV1)
+	resPdu.SetRequestId(reqPdu.RequestId())
+	for _, vb := range reqPdu.VariableBindings() {
+		resPdu.AppendVariableBinding(vb.Oid, snmpclient2.NewOctetString([]byte("Test Agent")))
+	}
+	resMsg := snmpclient2.NewMessage(snmpclient2.V3, resPdu).(*snmpclient2.MessageV3)
+	resMsg.MessageId = reqMsg.MessageId
+	resMsg.MessageMaxSize = reqMsg.MessageMaxSize
+	resMsg.MessageFlags = reqMsg.MessageFlags
+	resMsg.SetReportable(false)
+	resMsg.SecurityModel = reqMsg.SecurityModel
+	b, _ := resPdu.Marshal()
+	resMsg.SetPduBytes(b)
+	b, err := resMsg.Marshal()
+	if err != nil {
+		t.Errorf("agent: Marshal() - has error %v", err)
+		return nil
+	}
+	return b
+}
+
+func TestTlsTransport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snmp-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca := newCertificate(t, "ca", nil)
+	agentCert := newCertificate(t, "agent", &ca)
+	clientCert := newCertificate(t, "monitor", &ca)
+	caFile, _ := writeCertificate(t, dir, "ca", ca)
+	certFile, keyFile := writeCertificate(t, dir, "monitor", clientCert)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{agentCert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	peers := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		tlsConn := conn.(*tls.Conn)
+		if err = tlsConn.Handshake(); err != nil {
+			return
+		}
+		peers <- tlsConn.ConnectionState().PeerCertificates[0].Subject.CommonName
+
+		for {
+			head := make([]byte, 2)
+			if _, err := io.ReadFull(conn, head); err != nil {
+				return
+			}
+			length := int(head[1])
+			if length&0x80 != 0 {
+				ext := make([]byte, length&0x7f)
+				io.ReadFull(conn, ext)
+				head = append(head, ext...)
+				length = 0
+				for _, b := range ext {
+					length = length<<8 | int(b)
+				}
+			}
+			req := make([]byte, length)
+			if _, err := io.ReadFull(conn, req); err != nil {
+				return
+			}
+
+			b := tsmResponse(t, append(head, req...))
+			if b == nil {
+				return
+			}
+			conn.Write(b)
+		}
+	}()
+
+	snmp, err := snmpclient2.NewSNMP("tls", ln.Addr().String(), snmpclient2.Arguments{
+		Version:       snmpclient2.V3,
+		UserName:      "monitor",
+		SecurityLevel: snmpclient2.AuthPriv,
+		Timeout:       time.Second,
+		CertFile:      certFile,
+		KeyFile:       keyFile,
+		CAFile:        caFile,
+	})
+	if err != nil {
+		t.Fatalf("NewSNMP() - has error %v", err)
+	}
+	defer snmp.Close()
+
+	oids, _ := snmpclient2.NewOids([]string{"1.3.6.1.2.1.1.1.0"})
+	for i := 0; i < 2; i++ {
+		pdu, err := snmp.GetRequest(oids)
+		if err != nil {
+			t.Fatalf("GetRequest() - has error %v", err)
+		}
+		if vbs := pdu.VariableBindings(); len(vbs) != 1 || vbs[0].AsString() != "Test Agent" {
+			t.Errorf("GetRequest() - unexpected response %s", pdu)
+		}
+	}
+	select {
+	case name := <-peers:
+		if name != "monitor" {
+			t.Errorf("agent: expected the certificate [monitor], actual [%s]", name)
+		}
+	default:
+		t.Error("agent: expected the certificate of the client")
+	}
+
+	for _, test := range []struct {
+		network string
+		args    snmpclient2.Arguments
+	}{
+		{"tls", snmpclient2.Arguments{Version: snmpclient2.V2c, Community: "public"}},
+		{"dtls", snmpclient2.Arguments{Version: snmpclient2.V2c, Community: "public"}},
+		{"tls", snmpclient2.Arguments{Version: snmpclient2.V3, UserName: "monitor", CertFile: filepath.Join(dir, "missing.crt")}},
+		{"tls", snmpclient2.Arguments{Version: snmpclient2.V3, UserName: "monitor", CAFile: keyFile}},
+	} {
+		if _, err = snmpclient2.NewSNMP(test.network, "127.0.0.1", test.args); err == nil {
+			t.Errorf("NewSNMP(%s) - expected an error, %s", test.network, test.args.String())
+		}
+	}
+}
+
+// peerConn is the datagrams of the first peer of a packet conn
+type peerConn struct {
+	*net.UDPConn
+	peer net.Addr
+}
+
+func (c *peerConn) Read(b []byte) (int, error) {
+	for {
+		n, addr, err := c.ReadFrom(b)
+		if err != nil {
+			return 0, err
+		}
+		if c.peer == nil {
+			c.peer = addr
+		}
+		if addr.String() == c.peer.String() {
+			return n, nil
+		}
+	}
+}
+
+func (c *peerConn) Write(b []byte) (int, error) { return c.WriteTo(b, c.peer) }
+func (c *peerConn) RemoteAddr() net.Addr        { return c.peer }
+
+func TestDtlsTransport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snmp-dtls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca := newCertificate(t, "ca", nil)
+	agentCert := newCertificate(t, "agent", &ca)
+	clientCert := newCertificate(t, "monitor", &ca)
+	caFile, _ := writeCertificate(t, dir, "ca", ca)
+	certFile, keyFile := writeCertificate(t, dir, "monitor", clientCert)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+	udp, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	agent := dtls.Server(&peerConn{UDPConn: udp}, &tls.Config{
+		Certificates: []tls.Certificate{agentCert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	})
+	defer agent.Close()
+
+	go func() {
+		if err := agent.Handshake(); err != nil {
+			t.Errorf("agent: Handshake() - has error %v", err)
+			return
+		}
+		buf := make([]byte, 2048)
+		for {
+			n, err := agent.Read(buf)
+			if err != nil {
+				return
+			}
+			if b := tsmResponse(t, buf[:n]); b != nil {
+				agent.Write(b)
+			}
+		}
+	}()
+
+	// SecurityLevel is AuthPriv by default
+	snmp, err := snmpclient2.NewSNMP("dtls", udp.LocalAddr().String(), snmpclient2.Arguments{
+		Version:  snmpclient2.V3,
+		UserName: "monitor",
+		Timeout:  time.Second,
+		CertFile: certFile,
+		KeyFile:  keyFile,
+		CAFile:   caFile,
+	})
+	if err != nil {
+		t.Fatalf("NewSNMP() - has error %v", err)
+	}
+	defer snmp.Close()
+
+	oids, _ := snmpclient2.NewOids([]string{"1.3.6.1.2.1.1.1.0"})
+	for i := 0; i < 2; i++ {
+		pdu, err := snmp.GetRequest(oids)
+		if err != nil {
+			t.Fatalf("GetRequest() - has error %v", err)
+		}
+		if vbs := pdu.VariableBindings(); len(vbs) != 1 || vbs[0].AsString() != "Test Agent" {
+			t.Errorf("GetRequest() - unexpected response %s", pdu)
+		}
+	}
+	if certs := agent.PeerCertificates(); len(certs) != 1 || certs[0].Subject.CommonName != "monitor" {
+		t.Errorf("agent: expected the certificate [monitor], actual %v", certs)
+	}
+}
@@ -0,0 +1,241 @@
+package snmpclient2
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/runner-mei/snmpclient2/asn1"
+)
+
+// Direction is the direction of a traced message
+type Direction int
+
+const (
+	DirectionSent Direction = iota
+	DirectionReceived
+)
+
+func (d Direction) String() string {
+	switch d {
+	case DirectionSent:
+		return "sent"
+	case DirectionReceived:
+		return "received"
+	default:
+		return "unknown"
+	}
+}
+
+// A TraceHandler is called with every message sent or received, raw is the
+// exact bytes on the wire and msg is the decoded message, msg is nil if it
+// is unable to decode. The PDU of an encrypted SNMPv3 message is not
+// decoded. err is the error of processing the received message.
+//
+// The handler is called on the request path, and raw is reused after the
+// handler returns. A heavy handler should copy raw and hand it off to
+// another goroutine.
+type TraceHandler func(direction Direction, raw []byte, msg Message, err error)
+
+// A CorrelatedTraceHandler is a TraceHandler which also receives the value
+// attached to the context of the request by WithCorrelation, it is nil if
+// there is none, e.g. of the messages of an UdpServer.
+type CorrelatedTraceHandler func(direction Direction, raw []byte, msg Message, err error, correlation interface{})
+
+type traceHolder struct {
+	handler CorrelatedTraceHandler
+}
+
+// tracer keeps a CorrelatedTraceHandler which is set while the messages
+// are traced
+type tracer struct {
+	value atomic.Value
+}
+
+func (t *tracer) set(handler CorrelatedTraceHandler) {
+	t.value.Store(traceHolder{handler})
+}
+
+func (t *tracer) setUncorrelated(handler TraceHandler) {
+	if handler == nil {
+		t.set(nil)
+		return
+	}
+	t.set(func(direction Direction, raw []byte, msg Message, err error, correlation interface{}) {
+		handler(direction, raw, msg, err)
+	})
+}
+
+func (t *tracer) handler() CorrelatedTraceHandler {
+	h, _ := t.value.Load().(traceHolder)
+	return h.handler
+}
+
+func (t *tracer) sent(raw []byte, msg Message, correlation interface{}) {
+	if h := t.handler(); h != nil {
+		h(DirectionSent, raw, msg, nil, correlation)
+	}
+}
+
+// received decodes raw for the handler, err is the error of processing raw
+func (t *tracer) received(raw []byte, err error, correlation interface{}) {
+	h := t.handler()
+	if h == nil {
+		return
+	}
+	msg, e := decodeMessage(raw)
+	if err == nil {
+		err = e
+	}
+	h(DirectionReceived, raw, msg, err, correlation)
+}
+
+// decodeMessage decodes a message of any version, the PDU of an encrypted
+// SNMPv3 message is left undecoded.
+func decodeMessage(raw []byte) (Message, error) {
+	var seq asn1.RawValue
+	var version int
+	if _, err := asn1.Unmarshal(raw, &seq); err != nil {
+		return nil, err
+	}
+	if _, err := asn1.Unmarshal(seq.Bytes, &version); err == nil && SnmpVersion(version) != V3 {
+		pdu := &PduV1{}
+		msg := &MessageV1{pdu: pdu}
+		if _, err := msg.Unmarshal(raw); err != nil {
+			return nil, err
+		}
+		_, err := pdu.Unmarshal(msg.PduBytes())
+		return msg, err
+	}
+
+	scoped := &ScopedPdu{}
+	msgV3 := NewMessage(V3, scoped).(*MessageV3)
+	if _, err := msgV3.Unmarshal(raw); err != nil {
+		return nil, err
+	}
+	if !msgV3.Privacy() {
+		if _, err := scoped.Unmarshal(msgV3.PduBytes()); err != nil {
+			return msgV3, err
+		}
+	}
+	return msgV3, nil
+}
+
+// SetTraceHandler sets the handler of the messages sent and received by the
+// SNMP object, nil stops tracing.
+func (s *SNMP) SetTraceHandler(handler TraceHandler) {
+	s.tracer.setUncorrelated(handler)
+}
+
+// SetCorrelatedTraceHandler is SetTraceHandler of a handler which receives
+// the correlation values of the requests, nil stops tracing.
+func (s *SNMP) SetCorrelatedTraceHandler(handler CorrelatedTraceHandler) {
+	s.tracer.set(handler)
+}
+
+// SetTraceHandler sets the handler of the messages received and sent by the
+// UdpServer, nil stops tracing.
+func (self *UdpServer) SetTraceHandler(handler TraceHandler) {
+	self.tracer.setUncorrelated(handler)
+}
+
+// A PcapWriter writes the traced messages in the pcap format, the messages
+// are in the UDP datagrams over IPv4 between Local and Remote, so that they
+// are decoded by the tools such as Wireshark. Trace is a TraceHandler.
+type PcapWriter struct {
+	mutex  sync.Mutex
+	w      io.Writer
+	local  *net.UDPAddr
+	remote *net.UDPAddr
+	id     uint16
+	err    error
+}
+
+// NewPcapWriter writes the pcap header to w and returns the PcapWriter, the
+// local address is of the traced side, e.g. the client of SNMP. The local
+// address is 127.0.0.1:50000 and the remote address is 127.0.0.1:161 if
+// they are nil.
+func NewPcapWriter(w io.Writer, local, remote *net.UDPAddr) (*PcapWriter, error) {
+	if local == nil {
+		local = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 50000}
+	}
+	if remote == nil {
+		remote = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 161}
+	}
+	for _, addr := range []*net.UDPAddr{local, remote} {
+		if addr.IP.To4() == nil {
+			return nil, ArgumentError{
+				Value:   addr,
+				Message: "PcapWriter supports IPv4 addresses only",
+			}
+		}
+	}
+
+	var header [24]byte
+	binary.LittleEndian.PutUint32(header[0:], 0xa1b2c3d4)
+	binary.LittleEndian.PutUint16(header[4:], 2)
+	binary.LittleEndian.PutUint16(header[6:], 4)
+	binary.LittleEndian.PutUint32(header[16:], 65535)
+	binary.LittleEndian.PutUint32(header[20:], 101) // LINKTYPE_RAW
+	if _, err := w.Write(header[:]); err != nil {
+		return nil, err
+	}
+	return &PcapWriter{w: w, local: local, remote: remote}, nil
+}
+
+// Trace writes a packet of raw, it is a TraceHandler
+func (p *PcapWriter) Trace(direction Direction, raw []byte, msg Message, err error) {
+	src, dst := p.local, p.remote
+	if direction == DirectionReceived {
+		src, dst = dst, src
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.err != nil {
+		return
+	}
+	p.id++
+
+	packet := make([]byte, 16+28+len(raw))
+	now := time.Now()
+	binary.LittleEndian.PutUint32(packet[0:], uint32(now.Unix()))
+	binary.LittleEndian.PutUint32(packet[4:], uint32(now.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(packet[8:], uint32(28+len(raw)))
+	binary.LittleEndian.PutUint32(packet[12:], uint32(28+len(raw)))
+
+	ip := packet[16:36]
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:], uint16(28+len(raw)))
+	binary.BigEndian.PutUint16(ip[4:], p.id)
+	ip[8] = 64
+	ip[9] = 17 // UDP
+	copy(ip[12:16], src.IP.To4())
+	copy(ip[16:20], dst.IP.To4())
+	var sum uint32
+	for i := 0; i < len(ip); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(ip[i:]))
+	}
+	for sum > 0xffff {
+		sum = sum&0xffff + sum>>16
+	}
+	binary.BigEndian.PutUint16(ip[10:], ^uint16(sum))
+
+	udp := packet[36:44]
+	binary.BigEndian.PutUint16(udp[0:], uint16(src.Port))
+	binary.BigEndian.PutUint16(udp[2:], uint16(dst.Port))
+	binary.BigEndian.PutUint16(udp[4:], uint16(8+len(raw)))
+	copy(packet[44:], raw)
+
+	_, p.err = p.w.Write(packet)
+}
+
+// Err returns the first error of writing
+func (p *PcapWriter) Err() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.err
+}
@@ -0,0 +1,164 @@
+package snmpclient2_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/runner-mei/snmpclient2"
+)
+
+type traceRecord struct {
+	direction snmpclient2.Direction
+	raw       []byte
+	msg       snmpclient2.Message
+	err       error
+}
+
+type traceRecorder struct {
+	mutex   sync.Mutex
+	records []traceRecord
+}
+
+func (r *traceRecorder) trace(direction snmpclient2.Direction, raw []byte, msg snmpclient2.Message, err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.records = append(r.records, traceRecord{direction, append([]byte(nil), raw...), msg, err})
+}
+
+func (r *traceRecorder) get() []traceRecord {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]traceRecord(nil), r.records...)
+}
+
+func TestTraceHandler(t *testing.T) {
+	srv, err := snmpclient2.NewUdpServerFromString("trace", "127.0.0.1:0",
+		`iso.3.6.1.2.1.1.1.0 = STRING: "Test Agent"`, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	var server traceRecorder
+	srv.SetTraceHandler(server.trace)
+
+	snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:"+srv.GetPort(), snmpclient2.Arguments{
+		Version: snmpclient2.V2c, Community: "public", Timeout: time.Second})
+	defer snmp.Close()
+	var client traceRecorder
+	snmp.SetTraceHandler(client.trace)
+
+	if _, err = snmp.GetRequest(snmpclient2.MustParseOids("1.3.6.1.2.1.1.1.0")); err != nil {
+		t.Fatalf("GetRequest() - has error %v", err)
+	}
+
+	records := client.get()
+	if len(records) != 2 {
+		t.Fatalf("SetTraceHandler() - expected [%d] records, actual [%d]", 2, len(records))
+	}
+	for i, expected := range []struct {
+		direction snmpclient2.Direction
+		pduType   snmpclient2.PduType
+	}{
+		{snmpclient2.DirectionSent, snmpclient2.GetRequest},
+		{snmpclient2.DirectionReceived, snmpclient2.GetResponse},
+	} {
+		r := records[i]
+		if r.direction != expected.direction || r.err != nil {
+			t.Errorf("SetTraceHandler() - expected [%s], actual [%s] %v", expected.direction, r.direction, r.err)
+		}
+		if r.msg == nil || r.msg.PDU().PduType() != expected.pduType {
+			t.Errorf("SetTraceHandler() - expected [%s], actual %v", expected.pduType, r.msg)
+		}
+	}
+	if vb := records[1].msg.PDU().VariableBindings(); len(vb) != 1 || vb[0].AsString() != "Test Agent" {
+		t.Errorf("SetTraceHandler() - expected [Test Agent], actual %v", vb)
+	}
+
+	srvRecords := server.get()
+	if len(srvRecords) != 2 {
+		t.Fatalf("UdpServer.SetTraceHandler() - expected [%d] records, actual [%d]", 2, len(srvRecords))
+	}
+	if srvRecords[0].direction != snmpclient2.DirectionReceived || !bytes.Equal(srvRecords[0].raw, records[0].raw) {
+		t.Errorf("UdpServer.SetTraceHandler() - expected the request [% x], actual [% x]", records[0].raw, srvRecords[0].raw)
+	}
+	if srvRecords[1].direction != snmpclient2.DirectionSent || !bytes.Equal(srvRecords[1].raw, records[1].raw) {
+		t.Errorf("UdpServer.SetTraceHandler() - expected the response [% x], actual [% x]", records[1].raw, srvRecords[1].raw)
+	}
+
+	snmp.SetTraceHandler(nil)
+	if _, err = snmp.GetRequest(snmpclient2.MustParseOids("1.3.6.1.2.1.1.1.0")); err != nil {
+		t.Fatalf("GetRequest() - has error %v", err)
+	}
+	if n := len(client.get()); n != 2 {
+		t.Errorf("SetTraceHandler(nil) - expected [%d] records, actual [%d]", 2, n)
+	}
+}
+
+func TestTraceHandlerV3(t *testing.T) {
+	srv := newV3Server(t)
+	defer srv.Close()
+
+	snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:"+srv.GetPort(), v3Arguments(snmpclient2.UsmUser{UserName: "shaAes",
+		AuthProtocol: snmpclient2.Sha, AuthPassword: "sha-password",
+		PrivProtocol: snmpclient2.Aes, PrivPassword: "aes-password"}))
+	defer snmp.Close()
+	var client traceRecorder
+	snmp.SetTraceHandler(client.trace)
+
+	if _, err := snmp.GetRequest(snmpclient2.MustParseOids("1.3.6.1.2.1.1.1.0")); err != nil {
+		t.Fatalf("GetRequest() - has error %v", err)
+	}
+	records := client.get()
+	if len(records) < 2 {
+		t.Fatalf("SetTraceHandler() - expected the discovery and the request, actual [%d] records", len(records))
+	}
+	// the discovery is in plain text
+	if msg, ok := records[0].msg.(*snmpclient2.MessageV3); !ok || msg.PDU().PduType() != snmpclient2.GetRequest ||
+		msg.Authentication() || len(msg.PDU().VariableBindings()) != 0 {
+		t.Errorf("SetTraceHandler() - expected a discovery, actual %v", records[0].msg)
+	}
+	if msg, ok := records[1].msg.(*snmpclient2.MessageV3); !ok || msg.PDU().PduType() != snmpclient2.Report {
+		t.Errorf("SetTraceHandler() - expected a report, actual %v", records[1].msg)
+	}
+	last := records[len(records)-1]
+	if msg, ok := last.msg.(*snmpclient2.MessageV3); !ok || !msg.Privacy() || last.err != nil {
+		t.Errorf("SetTraceHandler() - expected an encrypted response, actual %v %v", last.msg, last.err)
+	}
+}
+
+func TestPcapWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := snmpclient2.NewPcapWriter(&buf, nil, nil)
+	if err != nil {
+		t.Fatalf("NewPcapWriter() - has error %v", err)
+	}
+	if buf.Len() != 24 || binary.LittleEndian.Uint32(buf.Bytes()) != 0xa1b2c3d4 ||
+		binary.LittleEndian.Uint32(buf.Bytes()[20:]) != 101 {
+		t.Fatalf("NewPcapWriter() - invalid header [% x]", buf.Bytes())
+	}
+
+	raw := []byte{0x30, 0x03, 0x02, 0x01, 0x01}
+	w.Trace(snmpclient2.DirectionReceived, raw, nil, nil)
+	if w.Err() != nil {
+		t.Fatalf("Trace() - has error %v", w.Err())
+	}
+	record := buf.Bytes()[24:]
+	if len(record) != 16+28+len(raw) || binary.LittleEndian.Uint32(record[8:]) != uint32(28+len(raw)) {
+		t.Fatalf("Trace() - invalid record [% x]", record)
+	}
+	packet := record[16:]
+	if srcPort, dstPort := binary.BigEndian.Uint16(packet[20:]), binary.BigEndian.Uint16(packet[22:]); srcPort != 161 || dstPort != 50000 {
+		t.Errorf("Trace() - expected the ports [161 -> 50000], actual [%d -> %d]", srcPort, dstPort)
+	}
+	if !bytes.Equal(packet[28:], raw) {
+		t.Errorf("Trace() - expected [% x], actual [% x]", raw, packet[28:])
+	}
+
+	if _, err = snmpclient2.NewPcapWriter(&buf, &net.UDPAddr{IP: net.ParseIP("::1")}, nil); err == nil {
+		t.Error("NewPcapWriter() - expected an error of the IPv6 address")
+	}
+}
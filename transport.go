@@ -0,0 +1,192 @@
+package snmpclient2
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Dialer opens the connection that a SNMP object talks over.
+// *net.Dialer satisfies this interface, tests and special transports
+// may provide their own implementation.
+type Dialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// A PacketListener opens the unconnected socket used by Pingers.
+// *net.ListenConfig satisfies this interface. A Dialer that also
+// implements it is used by the Pingers.
+type PacketListener interface {
+	ListenPacket(ctx context.Context, network, address string) (net.PacketConn, error)
+}
+
+func newDefaultDialer(timeout time.Duration, localAddr net.Addr) Dialer {
+	return &net.Dialer{Timeout: timeout, LocalAddr: localAddr}
+}
+
+func dial(ctx context.Context, dialer Dialer, network, address string, timeout time.Duration,
+	localAddr net.Addr) (net.Conn, error) {
+	if dialer == nil {
+		dialer = newDefaultDialer(timeout, localAddr)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return dialer.DialContext(ctx, network, address)
+}
+
+// isIPLiteral reports whether s is an IP address, with an optional zone
+func isIPLiteral(s string) bool {
+	if idx := strings.IndexByte(s, '%'); idx > 0 {
+		s = s[:idx]
+	}
+	return net.ParseIP(s) != nil
+}
+
+// normalizeAddress returns the address with the port. An IP literal as a
+// whole gets defaultPort, and an IPv6 literal followed by a port is
+// enclosed in the brackets, e.g. "2001:db8::1:16100" is "[2001:db8::1]:16100".
+func normalizeAddress(address, defaultPort string) (string, error) {
+	if _, _, err := net.SplitHostPort(address); err == nil {
+		return address, nil
+	}
+	if isIPLiteral(address) {
+		return net.JoinHostPort(address, defaultPort), nil
+	}
+	if idx := strings.LastIndexByte(address, ':'); idx > 0 {
+		host, port := address[:idx], address[idx+1:]
+		if _, err := strconv.ParseUint(port, 10, 16); err == nil &&
+			strings.Contains(host, ":") && isIPLiteral(host) {
+			return net.JoinHostPort(host, port), nil
+		}
+	}
+	if strings.Count(address, ":") > 1 {
+		return "", ArgumentError{
+			Value:   address,
+			Message: "Invalid IPv6 address, it is such as '[2001:db8::1]:161'",
+		}
+	}
+	return address, nil
+}
+
+// resolveLocalAddr resolves the local address to bind for the network, the
+// port is 0 if it is omitted. The family of the address must agree with
+// the network and with the IP literal of the remote address.
+func resolveLocalAddr(network, localAddress, remoteAddress string) (net.Addr, error) {
+	host, port, err := net.SplitHostPort(localAddress)
+	if err != nil {
+		host, port = strings.Trim(localAddress, "[]"), "0"
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil, ArgumentError{
+			Value:   localAddress,
+			Message: "LocalAddress must be an IP address",
+		}
+	}
+	conflict := ip.To4() == nil && strings.HasSuffix(network, "4") ||
+		ip.To4() != nil && strings.HasSuffix(network, "6")
+	if h, _, e := net.SplitHostPort(remoteAddress); e == nil {
+		if remote := net.ParseIP(h); remote != nil && (remote.To4() == nil) != (ip.To4() == nil) {
+			conflict = true
+		}
+	}
+	if conflict {
+		return nil, ArgumentError{
+			Value:   localAddress,
+			Message: fmt.Sprintf("LocalAddress conflicts with the address family of %s %s", network, remoteAddress),
+		}
+	}
+
+	address := net.JoinHostPort(ip.String(), port)
+	var addr net.Addr
+	switch {
+	case strings.HasPrefix(network, "udp"):
+		addr, err = net.ResolveUDPAddr(network, address)
+	case strings.HasPrefix(network, "tcp"):
+		addr, err = net.ResolveTCPAddr(network, address)
+	default:
+		return nil, ArgumentError{
+			Value:   network,
+			Message: "LocalAddress is unsupported by the network",
+		}
+	}
+	if err != nil {
+		return nil, ArgumentError{
+			Value:   localAddress,
+			Message: err.Error(),
+		}
+	}
+	return addr, nil
+}
+
+func listenPacket(dialer Dialer, network, address string) (net.PacketConn, error) {
+	if l, ok := dialer.(PacketListener); ok {
+		return l.ListenPacket(context.Background(), network, address)
+	}
+	return net.ListenPacket(network, address)
+}
+
+// isStream reports whether messages over network need a framing (RFC3430)
+func isStream(network string) bool {
+	return strings.HasPrefix(network, "tcp") || isTls(network)
+}
+
+// writeMessage writes b completely
+func writeMessage(w io.Writer, b []byte) error {
+	for len(b) > 0 {
+		n, err := w.Write(b)
+		if err != nil {
+			return err
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+// readMessage reads one BER encoded message from a stream, the length of
+// the message is taken from the header of the outer SEQUENCE (RFC3430 Section 2.1)
+func readMessage(r io.Reader, maxSize int) ([]byte, error) {
+	head := make([]byte, 2, 6)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, err
+	}
+	if head[0] != 0x30 {
+		return nil, ResponseError{
+			Message: fmt.Sprintf("Invalid message header - Tag [%02x]", head[0]),
+		}
+	}
+
+	length := int(head[1])
+	if length&0x80 != 0 {
+		n := length & 0x7f
+		if n == 0 || n > 4 {
+			return nil, ResponseError{
+				Message: fmt.Sprintf("Invalid message header - Length [%02x]", head[1]),
+			}
+		}
+		head = head[:2+n]
+		if _, err := io.ReadFull(r, head[2:]); err != nil {
+			return nil, err
+		}
+		length = 0
+		for _, b := range head[2:] {
+			length = length<<8 | int(b)
+		}
+	}
+	if length < 0 || length > maxSize {
+		return nil, ResponseError{
+			Message: fmt.Sprintf("Message size is range 0..%d, value [%d]", maxSize, length),
+		}
+	}
+
+	buf := make([]byte, len(head)+length)
+	copy(buf, head)
+	if _, err := io.ReadFull(r, buf[len(head):]); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
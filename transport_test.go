@@ -0,0 +1,512 @@
+package snmpclient2_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/runner-mei/snmpclient2"
+)
+
+type memTimeoutError struct{}
+
+func (memTimeoutError) Error() string   { return "memconn: i/o timeout" }
+func (memTimeoutError) Timeout() bool   { return true }
+func (memTimeoutError) Temporary() bool { return true }
+
+type memAddr string
+
+func (a memAddr) Network() string { return "mem" }
+func (a memAddr) String() string  { return string(a) }
+
+// memConn is one end of an in-memory datagram connection, every Write is
+// delivered to the peer as a single message.
+type memConn struct {
+	in     chan []byte
+	out    chan []byte
+	closed chan struct{}
+	once   *sync.Once
+
+	mu        sync.Mutex
+	rDeadline time.Time
+}
+
+func newMemConnPair() (*memConn, *memConn) {
+	a, b := make(chan []byte, 16), make(chan []byte, 16)
+	closed, once := make(chan struct{}), &sync.Once{}
+	return &memConn{in: a, out: b, closed: closed, once: once},
+		&memConn{in: b, out: a, closed: closed, once: once}
+}
+
+func (c *memConn) Read(b []byte) (int, error) {
+	c.mu.Lock()
+	deadline := c.rDeadline
+	c.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(deadline.Sub(time.Now()))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case msg := <-c.in:
+		return copy(b, msg), nil
+	case <-c.closed:
+		return 0, errors.New("memconn: use of closed connection")
+	case <-timeout:
+		return 0, memTimeoutError{}
+	}
+}
+
+func (c *memConn) Write(b []byte) (int, error) {
+	select {
+	case <-c.closed:
+		return 0, errors.New("memconn: use of closed connection")
+	default:
+	}
+	select {
+	case c.out <- append([]byte(nil), b...):
+	default:
+		// the queue is full, drop it like a congested network
+	}
+	return len(b), nil
+}
+
+func (c *memConn) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	return nil
+}
+
+func (c *memConn) LocalAddr() net.Addr  { return memAddr("local") }
+func (c *memConn) RemoteAddr() net.Addr { return memAddr("remote") }
+
+func (c *memConn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+func (c *memConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.rDeadline = t
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *memConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// memDialer is a Dialer returning in-memory connections, the requests
+// written to them are answered by handler.
+type memDialer struct {
+	handler func(req []byte) [][]byte
+	dials   int32
+}
+
+func newMemDialer(handler func(req []byte) [][]byte) *memDialer {
+	return &memDialer{handler: handler}
+}
+
+func (d *memDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	atomic.AddInt32(&d.dials, 1)
+	client, server := newMemConnPair()
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, err := server.Read(buf)
+			if err != nil {
+				return
+			}
+			for _, res := range d.handler(append([]byte(nil), buf[:n]...)) {
+				server.Write(res)
+			}
+		}
+	}()
+	return client, nil
+}
+
+// memAgent returns a handler answering v1/v2c requests with the values
+// from mibs, missing oids are answered with NoSuchObject.
+func memAgent(t *testing.T, mibs map[string]snmpclient2.Variable) func([]byte) [][]byte {
+	return func(req []byte) [][]byte {
+		reqPdu := &snmpclient2.PduV1{}
+		reqMsg := snmpclient2.NewMessage(snmpclient2.V2c, reqPdu).(*snmpclient2.MessageV1)
+		if _, err := reqMsg.Unmarshal(req); err != nil {
+			t.Errorf("agent: Unmarshal() - has error %v", err)
+			return nil
+		}
+		if _, err := reqPdu.Unmarshal(reqMsg.PduBytes()); err != nil {
+			t.Errorf("agent: Unmarshal() - has error %v", err)
+			return nil
+		}
+
+		resPdu := snmpclient2.NewPdu(reqMsg.Version(), snmpclient2.GetResponse)
+		resPdu.SetRequestId(reqPdu.RequestId())
+		for _, vb := range reqPdu.VariableBindings() {
+			v, ok := mibs[vb.Oid.ToString()]
+			if !ok {
+				v = snmpclient2.NewNoSucheObject()
+			}
+			resPdu.AppendVariableBinding(vb.Oid, v)
+		}
+		return [][]byte{marshalV1Message(t, reqMsg.Version(), string(reqMsg.Community), resPdu)}
+	}
+}
+
+func marshalV1Message(t *testing.T, ver snmpclient2.SnmpVersion, community string, pdu snmpclient2.PDU) []byte {
+	msg := snmpclient2.NewMessage(ver, pdu).(*snmpclient2.MessageV1)
+	msg.Community = []byte(community)
+	b, err := pdu.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal() - has error %v", err)
+	}
+	msg.SetPduBytes(b)
+	b, err = msg.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal() - has error %v", err)
+	}
+	return b
+}
+
+func TestDialer(t *testing.T) {
+	dialer := newMemDialer(func([]byte) [][]byte { return nil })
+	snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:161", snmpclient2.Arguments{
+		Version:   snmpclient2.V2c,
+		Community: "public",
+		Dialer:    dialer,
+	})
+	if err := snmp.Open(); err != nil {
+		t.Fatalf("Open() - has error %v", err)
+	}
+	defer snmp.Close()
+
+	if n := atomic.LoadInt32(&dialer.dials); n != 1 {
+		t.Errorf("Open() - expected [%d] dials, actual [%d]", 1, n)
+	}
+}
+
+func TestLocalAddress(t *testing.T) {
+	for _, test := range []struct {
+		network, address, local string
+	}{
+		{"udp4", "127.0.0.1:161", "::1"},
+		{"udp6", "[::1]:161", "127.0.0.1"},
+		{"udp", "[::1]:161", "127.0.0.1:0"},
+		{"udp", "127.0.0.1:161", "localhost"},
+	} {
+		_, err := snmpclient2.NewSNMP(test.network, test.address, snmpclient2.Arguments{
+			Version: snmpclient2.V2c, LocalAddress: test.local})
+		if _, ok := err.(snmpclient2.ArgumentError); !ok {
+			t.Errorf("NewSNMP(%s, %s, %s) - expected an ArgumentError, actual [%v]",
+				test.network, test.address, test.local, err)
+		}
+	}
+
+	// a free port of the client
+	l, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	local := l.LocalAddr().String()
+	l.Close()
+
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	snmp, err := snmpclient2.NewSNMP("udp", conn.LocalAddr().String(), snmpclient2.Arguments{
+		Version: snmpclient2.V2c, Community: "public", LocalAddress: local})
+	if err != nil {
+		t.Fatalf("NewSNMP() - has error %v", err)
+	}
+	defer snmp.Close()
+	if !strings.Contains(snmp.String(), local) {
+		t.Errorf("String() - expected [%s] in %s", local, snmp.String())
+	}
+	if err = snmp.V2Trap(nil); err != nil {
+		t.Fatalf("V2Trap() - has error %v", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 1500)
+	_, addr, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("ReadFrom() - has error %v", err)
+	}
+	if addr.String() != local {
+		t.Errorf("ReadFrom() - expected the source [%s], actual [%s]", local, addr)
+	}
+}
+
+// memAgentV3 returns a handler answering noAuthNoPriv v3 requests, the
+// authoritative engine ID is read from engineId on every request so that
+// tests can simulate the agent being replaced.
+func memAgentV3(t *testing.T, engineId *atomic.Value, mibs map[string]snmpclient2.Variable) func([]byte) [][]byte {
+	return func(req []byte) [][]byte {
+		reqPdu := &snmpclient2.ScopedPdu{}
+		reqMsg := snmpclient2.NewMessage(snmpclient2.V3, reqPdu).(*snmpclient2.MessageV3)
+		if _, err := reqMsg.Unmarshal(req); err != nil {
+			t.Errorf("agent: Unmarshal() - has error %v", err)
+			return nil
+		}
+		if _, err := reqPdu.Unmarshal(reqMsg.PduBytes()); err != nil {
+			t.Errorf("agent: Unmarshal() - has error %v", err)
+			return nil
+		}
+
+		id := engineId.Load().([]byte)
+		resPdu := &snmpclient2.ScopedPdu{ContextEngineId: id, ContextName: reqPdu.ContextName}
+		resPdu.SetRequestId(reqPdu.RequestId())
+		if !bytes.Equal(reqMsg.AuthEngineId, id) {
+			resPdu.PduV1 = *snmpclient2.NewPdu(snmpclient2.V2c, snmpclient2.Report).(*snmpclient2.PduV1)
+			resPdu.SetRequestId(reqPdu.RequestId())
+			oid, _ := snmpclient2.ParseOidFromString("1.3.6.1.6.3.15.1.1.4.0")
+			resPdu.AppendVariableBinding(oid, snmpclient2.NewCounter32(1))
+		} else {
+			resPdu.PduV1 = *snmpclient2.NewPdu(snmpclient2.V2c, snmpclient2.GetResponse).(*snmpclient2.PduV1)
+			resPdu.SetRequestId(reqPdu.RequestId())
+			for _, vb := range reqPdu.VariableBindings() {
+				v, ok := mibs[vb.Oid.ToString()]
+				if !ok {
+					v = snmpclient2.NewNoSucheObject()
+				}
+				resPdu.AppendVariableBinding(vb.Oid, v)
+			}
+		}
+
+		resMsg := snmpclient2.NewMessage(snmpclient2.V3, resPdu).(*snmpclient2.MessageV3)
+		resMsg.MessageId = reqMsg.MessageId
+		resMsg.MessageMaxSize = reqMsg.MessageMaxSize
+		resMsg.SecurityModel = reqMsg.SecurityModel
+		resMsg.AuthEngineId = id
+		resMsg.AuthEngineBoots = 3
+		resMsg.AuthEngineTime = 1000
+		resMsg.UserName = reqMsg.UserName
+		b, err := resPdu.Marshal()
+		if err != nil {
+			t.Fatalf("Marshal() - has error %v", err)
+		}
+		resMsg.SetPduBytes(b)
+		if b, err = resMsg.Marshal(); err != nil {
+			t.Fatalf("Marshal() - has error %v", err)
+		}
+		return [][]byte{b}
+	}
+}
+
+// memWalkAgent returns a handler answering GetNextRequests and GetBulkRequests
+// from mibs. The end of the MIB view is reported by NoSuchName to v1 requests,
+// and by EndOfMibView to v2c requests.
+func memWalkAgent(t *testing.T, mibs map[string]snmpclient2.Variable) func([]byte) [][]byte {
+	var keys []string
+	for k := range mibs {
+		keys = append(keys, k)
+	}
+	oids, _ := snmpclient2.NewOids(keys)
+	oids = oids.Sort()
+
+	next := func(oid snmpclient2.Oid) *snmpclient2.Oid {
+		for j := range oids {
+			if oids[j].Compare(&oid) > 0 {
+				return &oids[j]
+			}
+		}
+		return nil
+	}
+
+	return func(req []byte) [][]byte {
+		reqPdu := &snmpclient2.PduV1{}
+		reqMsg := snmpclient2.NewMessage(snmpclient2.V1, reqPdu).(*snmpclient2.MessageV1)
+		if _, err := reqMsg.Unmarshal(req); err != nil {
+			t.Errorf("agent: Unmarshal() - has error %v", err)
+			return nil
+		}
+		if _, err := reqPdu.Unmarshal(reqMsg.PduBytes()); err != nil {
+			t.Errorf("agent: Unmarshal() - has error %v", err)
+			return nil
+		}
+
+		resPdu := snmpclient2.NewPdu(reqMsg.Version(), snmpclient2.GetResponse)
+		resPdu.SetRequestId(reqPdu.RequestId())
+		reqBinds := reqPdu.VariableBindings()
+
+		nonRepeaters, maxRepetitions := len(reqBinds), 1
+		if reqPdu.PduType() == snmpclient2.GetBulkRequest {
+			// GetBulkRequest keeps them in the error status and index fields
+			nonRepeaters, maxRepetitions = int(reqPdu.ErrorStatus()), reqPdu.ErrorIndex()
+			if nonRepeaters > len(reqBinds) {
+				nonRepeaters = len(reqBinds)
+			}
+		}
+
+		appendNext := func(i int, oid snmpclient2.Oid) (snmpclient2.Oid, bool) {
+			n := next(oid)
+			if n != nil {
+				resPdu.AppendVariableBinding(*n, mibs[n.ToString()])
+				return *n, true
+			}
+			if reqMsg.Version() == snmpclient2.V1 {
+				resPdu = snmpclient2.NewPduWithVarBinds(reqMsg.Version(),
+					snmpclient2.GetResponse, reqBinds)
+				resPdu.SetRequestId(reqPdu.RequestId())
+				resPdu.SetErrorStatus(snmpclient2.NoSuchName)
+				resPdu.SetErrorIndex(i + 1)
+				return oid, false
+			}
+			resPdu.AppendVariableBinding(oid, snmpclient2.NewEndOfMibView())
+			return oid, true
+		}
+
+		for i := 0; i < nonRepeaters; i++ {
+			if _, ok := appendNext(i, reqBinds[i].Oid); !ok {
+				goto done
+			}
+		}
+		if repeaters := reqBinds[nonRepeaters:]; len(repeaters) > 0 {
+			last := make([]snmpclient2.Oid, len(repeaters))
+			for i, vb := range repeaters {
+				last[i] = vb.Oid
+			}
+			for r := 0; r < maxRepetitions; r++ {
+				for i := range repeaters {
+					var ok bool
+					if last[i], ok = appendNext(nonRepeaters+i, last[i]); !ok {
+						goto done
+					}
+				}
+			}
+		}
+	done:
+		return [][]byte{marshalV1Message(t, reqMsg.Version(), string(reqMsg.Community), resPdu)}
+	}
+}
+
+func TestTcpFraming(t *testing.T) {
+	large := bytes.Repeat([]byte("x"), 5000)
+	handler := memAgent(t, map[string]snmpclient2.Variable{
+		"1.3.6.1.2.1.1.1.0": snmpclient2.NewOctetString(large),
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			head := make([]byte, 2)
+			if _, err := io.ReadFull(conn, head); err != nil {
+				return
+			}
+			length := int(head[1])
+			if length&0x80 != 0 {
+				ext := make([]byte, length&0x7f)
+				io.ReadFull(conn, ext)
+				head = append(head, ext...)
+				length = 0
+				for _, b := range ext {
+					length = length<<8 | int(b)
+				}
+			}
+			req := make([]byte, length)
+			if _, err := io.ReadFull(conn, req); err != nil {
+				return
+			}
+			// deliver the response in several segments
+			for _, res := range handler(append(head, req...)) {
+				for len(res) > 0 {
+					n := 1000
+					if n > len(res) {
+						n = len(res)
+					}
+					conn.Write(res[:n])
+					res = res[n:]
+					time.Sleep(time.Millisecond)
+				}
+			}
+		}
+	}()
+
+	snmp, _ := snmpclient2.NewSNMP("tcp", ln.Addr().String(), snmpclient2.Arguments{
+		Version:   snmpclient2.V2c,
+		Community: "public",
+		Timeout:   time.Second,
+	})
+	defer snmp.Close()
+
+	oids, _ := snmpclient2.NewOids([]string{"1.3.6.1.2.1.1.1.0"})
+	for i := 0; i < 2; i++ {
+		pdu, err := snmp.GetRequest(oids)
+		if err != nil {
+			t.Fatalf("GetRequest() - has error %v", err)
+		}
+		vb := pdu.VariableBindings().MatchOid(oids[0])
+		if vb == nil || !bytes.Equal(vb.Variable.Bytes(), large) {
+			t.Errorf("GetRequest() - unexpected value %v", vb)
+		}
+	}
+}
+
+func TestTrailingOctets(t *testing.T) {
+	agent := memAgent(t, map[string]snmpclient2.Variable{
+		"1.3.6.1.2.1.1.1.0": snmpclient2.NewOctetString([]byte("Test Agent")),
+		"1.3.6.1.2.1.1.4.0": snmpclient2.NewOctetString(bytes.Repeat([]byte("x"), 3000)),
+	})
+	trailing := func(req []byte) [][]byte {
+		res := agent(req)
+		for i := range res {
+			res[i] = append(res[i], 0x00, 0x00, 0x05)
+		}
+		return res
+	}
+	sysDescr, _ := snmpclient2.NewOids([]string{"1.3.6.1.2.1.1.1.0"})
+
+	for _, lenient := range []bool{false, true} {
+		snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:161", snmpclient2.Arguments{
+			Version:         snmpclient2.V2c,
+			Community:       "public",
+			Timeout:         time.Second,
+			LenientDecoding: lenient,
+			Dialer:          newMemDialer(trailing),
+		})
+		defer snmp.Close()
+
+		pdu, err := snmp.GetRequest(sysDescr)
+		if lenient {
+			if err != nil || pdu.VariableBindings().MatchOid(sysDescr[0]) == nil {
+				t.Errorf("GetRequest(lenient) - expected the trailing octets are ignored, actual [%v] %v", pdu, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), "[3] trailing octets") {
+			t.Errorf("GetRequest() - expected the error of the trailing octets, actual [%v] %v", pdu, err)
+		}
+	}
+
+	// the datagram is larger than the receive buffer
+	snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:161", snmpclient2.Arguments{
+		Version:   snmpclient2.V2c,
+		Community: "public",
+		Timeout:   time.Second,
+		Dialer:    newMemDialer(agent),
+	})
+	defer snmp.Close()
+	sysContact, _ := snmpclient2.NewOids([]string{"1.3.6.1.2.1.1.4.0"})
+	if pdu, err := snmp.GetRequest(sysContact); err == nil || !strings.Contains(err.Error(), "truncated") {
+		t.Errorf("GetRequest() - expected the error of the truncation, actual [%v] %v", pdu, err)
+	}
+}
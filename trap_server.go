@@ -0,0 +1,199 @@
+package snmpclient2
+
+import (
+	"net"
+	"strconv"
+	"sync"
+)
+
+// A TrapHandler is called for every trap and inform accepted by a TrapServer.
+// The handlers are called sequentially from the receiving goroutine.
+type TrapHandler func(src net.Addr, pdu PDU)
+
+// An InformFilter decides whether an InformRequest is accepted. A rejected
+// inform is neither acknowledged nor passed to the TrapHandler, so that the
+// sender knows it is not delivered.
+type InformFilter func(src net.Addr, pdu PDU) bool
+
+// TrapServer receives SNMPv1 traps, SNMPv2c traps and InformRequests.
+// The InformRequests are acknowledged before the handler is called.
+type TrapServer struct {
+	name       string
+	origin     string
+	conn       net.PacketConn
+	listenAddr net.Addr
+	waitGroup  sync.WaitGroup
+	closeOnce  sync.Once
+	closeErr   error
+	handler    TrapHandler
+	logger     loggerRef
+
+	mu           sync.RWMutex
+	communities  map[string]bool // nil accepts all communities
+	informFilter InformFilter
+}
+
+// Create a TrapServer listening on addr, and start it
+func NewTrapServer(nm, addr string, handler TrapHandler) (*TrapServer, error) {
+	if handler == nil {
+		return nil, ArgumentError{
+			Value:   handler,
+			Message: "TrapHandler is required",
+		}
+	}
+
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	srv := &TrapServer{name: nm,
+		origin:     addr,
+		conn:       conn,
+		listenAddr: conn.LocalAddr(),
+		handler:    handler}
+	srv.waitGroup.Add(1)
+	go srv.serve()
+	return srv, nil
+}
+
+// SetCommunities limits the accepted messages to the given communities,
+// no communities accepts all of them (The default).
+func (self *TrapServer) SetCommunities(communities ...string) {
+	var accepted map[string]bool
+	if len(communities) > 0 {
+		accepted = make(map[string]bool, len(communities))
+		for _, c := range communities {
+			accepted[c] = true
+		}
+	}
+
+	self.mu.Lock()
+	self.communities = accepted
+	self.mu.Unlock()
+}
+
+// SetInformFilter sets the filter of the InformRequests, nil accepts all of
+// them (The default).
+func (self *TrapServer) SetInformFilter(filter InformFilter) {
+	self.mu.Lock()
+	self.informFilter = filter
+	self.mu.Unlock()
+}
+
+func (self *TrapServer) isInformAccepted(addr net.Addr, pdu PDU) bool {
+	self.mu.RLock()
+	filter := self.informFilter
+	self.mu.RUnlock()
+	return filter == nil || filter(addr, pdu)
+}
+
+func (self *TrapServer) isAccepted(community []byte) bool {
+	self.mu.RLock()
+	defer self.mu.RUnlock()
+	return self.communities == nil || self.communities[string(community)]
+}
+
+func (self *TrapServer) GetPort() string {
+	_, port, _ := net.SplitHostPort(self.listenAddr.String())
+	return port
+}
+
+func (self *TrapServer) GetIntPort() int {
+	i, _ := strconv.Atoi(self.GetPort())
+	return i
+}
+
+// Close stops the server, it waits the receiving goroutine. Close is safe
+// to call more than once and from multiple goroutines.
+func (self *TrapServer) Close() error {
+	self.closeOnce.Do(func() {
+		self.closeErr = self.conn.Close()
+		self.waitGroup.Wait()
+	})
+	return self.closeErr
+}
+
+func (self *TrapServer) serve() {
+	defer self.waitGroup.Done()
+
+	var cached_bytes [65535]byte
+	for {
+		n, addr, err := self.conn.ReadFrom(cached_bytes[:])
+		if nil != err {
+			return
+		}
+		self.on_message(addr, cached_bytes[:n])
+	}
+}
+
+func (self *TrapServer) on_message(addr net.Addr, recv_bytes []byte) {
+	pdu := &PduV1{}
+	recvMsg := &MessageV1{pdu: pdu}
+	_, err := recvMsg.Unmarshal(recv_bytes)
+	if err != nil {
+		self.warnf("Failed to Unmarshal message - %s : [%s]",
+			err.Error(), ToHexStr(recv_bytes, " "))
+		return
+	}
+	if v := recvMsg.Version(); v != V1 && v != V2c {
+		self.warnf("Failed to process incoming message - %s message is unsupported : [%s]",
+			v, ToHexStr(recv_bytes, " "))
+		return
+	}
+	if !self.isAccepted(recvMsg.Community) {
+		self.warnf("community '%s' from %s is not accepted", recvMsg.Community, addr)
+		return
+	}
+
+	_, err = pdu.Unmarshal(recvMsg.PduBytes())
+	if err != nil {
+		self.warnf("Failed to Unmarshal PDU - %s : [%s]",
+			err.Error(), ToHexStr(recv_bytes, " "))
+		return
+	}
+
+	switch t := pdu.PduType(); t {
+	case Trap:
+		if recvMsg.Version() != V1 {
+			self.warnf("%s is unsupported by %s", t, recvMsg.Version())
+			return
+		}
+	case SNMPTrapV2:
+	case InformRequest:
+		if !self.isInformAccepted(addr, pdu) {
+			self.warnf("%s from %s is rejected", t, addr)
+			return
+		}
+		self.acknowledge(addr, recvMsg)
+	default:
+		self.warnf("%s is unsupported", t)
+		return
+	}
+
+	self.handler(addr, pdu)
+}
+
+// acknowledge an InformRequest with the GetResponse (RFC3416 Section 4.2.7)
+func (self *TrapServer) acknowledge(addr net.Addr, inform *MessageV1) {
+	pdu := NewPduWithVarBinds(inform.Version(), GetResponse, inform.PDU().VariableBindings())
+	pdu.SetRequestId(inform.PDU().RequestId())
+
+	res := NewMessage(inform.Version(), pdu).(*MessageV1)
+	res.Community = inform.Community
+	buf, err := pdu.Marshal()
+	if err != nil {
+		self.warnf(" failed to marshal, %v", err)
+		return
+	}
+	res.SetPduBytes(buf)
+
+	buf, err = res.Marshal()
+	if err != nil {
+		self.warnf(" failed to marshal, %v", err)
+		return
+	}
+	if _, err = self.conn.WriteTo(buf, addr); err != nil {
+		self.warnf(" failed to write response, %v", err)
+	}
+}
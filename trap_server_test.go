@@ -0,0 +1,158 @@
+package snmpclient2_test
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/runner-mei/snmpclient2"
+)
+
+func TestTrapServer(t *testing.T) {
+	received := make(chan snmpclient2.PDU, 10)
+	srv, err := snmpclient2.NewTrapServer("trap", "127.0.0.1:0", func(src net.Addr, pdu snmpclient2.PDU) {
+		received <- pdu
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	srv.SetCommunities("public")
+
+	address := "127.0.0.1:" + srv.GetPort()
+	vbs := snmpclient2.VariableBindings{}
+	vbs = append(vbs, snmpclient2.VariableBinding{
+		Oid: snmpclient2.OidSysUpTime, Variable: snmpclient2.NewTimeTicks(100)})
+
+	// rejected community
+	snmp, _ := snmpclient2.NewSNMP("udp", address, snmpclient2.Arguments{
+		Version: snmpclient2.V2c, Community: "private"})
+	if err = snmp.V2Trap(vbs); err != nil {
+		t.Fatalf("V2Trap() - has error %v", err)
+	}
+	snmp.Close()
+
+	snmp, _ = snmpclient2.NewSNMP("udp", address, snmpclient2.Arguments{
+		Version: snmpclient2.V2c, Community: "public", Timeout: time.Second})
+	defer snmp.Close()
+	if err = snmp.V2Trap(vbs); err != nil {
+		t.Fatalf("V2Trap() - has error %v", err)
+	}
+	if err = snmp.InformRequest(vbs); err != nil {
+		t.Fatalf("InformRequest() - has error %v", err)
+	}
+
+	v1, _ := snmpclient2.NewSNMP("udp", address, snmpclient2.Arguments{
+		Version: snmpclient2.V1, Community: "public"})
+	defer v1.Close()
+	enterprise, _ := snmpclient2.ParseOidFromString("1.3.6.1.4.1.9")
+	if err = v1.V1Trap(enterprise, net.IPv4(10, 0, 0, 1), snmpclient2.EnterpriseSpecific, 1, 4200, vbs); err != nil {
+		t.Fatalf("V1Trap() - has error %v", err)
+	}
+	if err = v1.V1Trap(enterprise, net.ParseIP("::1"), 6, 1, 4200, vbs); err == nil {
+		t.Error("V1Trap() - expected an error of the IPv6 agent address")
+	}
+	if err = v1.V1Trap(enterprise, nil, 7, 1, 4200, vbs); err == nil {
+		t.Error("V1Trap() - expected an error of the generic trap [7]")
+	}
+	if err = snmp.V1Trap(enterprise, nil, 6, 1, 4200, vbs); err == nil {
+		t.Error("V1Trap() - expected an error of the V2c session")
+	}
+
+	expected := []snmpclient2.PduType{snmpclient2.SNMPTrapV2, snmpclient2.InformRequest, snmpclient2.Trap}
+	for _, typ := range expected {
+		select {
+		case pdu := <-received:
+			if pdu.PduType() != typ {
+				t.Errorf("TrapHandler - expected [%s], actual [%s]", typ, pdu.PduType())
+			}
+			if vb := pdu.VariableBindings().MatchOid(snmpclient2.OidSysUpTime); vb == nil {
+				t.Errorf("TrapHandler - sysUpTime is missing in %s", pdu)
+			}
+			if typ == snmpclient2.Trap {
+				trap := pdu.(*snmpclient2.PduV1)
+				if !trap.Enterprise.Equal(&enterprise) {
+					t.Errorf("TrapHandler - expected [%s], actual [%s]", enterprise.ToString(), trap.Enterprise.ToString())
+				}
+				if trap.AgentAddress.ToString() != "10.0.0.1" || trap.GenericTrap != 6 ||
+					trap.SpecificTrap != 1 || trap.Timestamp != 4200 {
+					t.Errorf("TrapHandler - unexpected trap [%s] [%d] [%d] [%d]", trap.AgentAddress.ToString(),
+						trap.GenericTrap, trap.SpecificTrap, trap.Timestamp)
+				}
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("TrapHandler - [%s] is not received", typ)
+		}
+	}
+
+	select {
+	case pdu := <-received:
+		t.Errorf("TrapHandler - unexpected %s", pdu)
+	default:
+	}
+}
+
+func TestTrapServerInformFilter(t *testing.T) {
+	received := make(chan snmpclient2.PDU, 10)
+	srv, err := snmpclient2.NewTrapServer("trap", "127.0.0.1:0", func(src net.Addr, pdu snmpclient2.PDU) {
+		received <- pdu
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	// the informs without sysUpTime are malformed
+	srv.SetInformFilter(func(src net.Addr, pdu snmpclient2.PDU) bool {
+		return pdu.VariableBindings().MatchOid(snmpclient2.OidSysUpTime) != nil
+	})
+
+	snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:"+srv.GetPort(), snmpclient2.Arguments{
+		Version: snmpclient2.V2c, Community: "public", Timeout: 100 * time.Millisecond})
+	defer snmp.Close()
+
+	malformed := snmpclient2.VariableBindings{{Oid: snmpclient2.MustParseOidFromString("1.3.6.1.2.1.1.5.0"),
+		Variable: snmpclient2.NewOctetString([]byte("router"))}}
+	if err = snmp.InformRequest(malformed); err == nil {
+		t.Error("InformRequest() - expected the rejected inform is not acknowledged")
+	} else if _, ok := err.(snmpclient2.InformNotAcknowledgedError); !ok {
+		t.Errorf("InformRequest() - expected InformNotAcknowledgedError, actual [%v]", err)
+	}
+
+	vbs := snmpclient2.VariableBindings{{Oid: snmpclient2.OidSysUpTime, Variable: snmpclient2.NewTimeTicks(100)}}
+	if err = snmp.InformRequest(vbs); err != nil {
+		t.Fatalf("InformRequest() - has error %v", err)
+	}
+	select {
+	case pdu := <-received:
+		if pdu.VariableBindings().MatchOid(snmpclient2.OidSysUpTime) == nil {
+			t.Errorf("TrapHandler - unexpected %s", pdu)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("TrapHandler - the inform is not received")
+	}
+	select {
+	case pdu := <-received:
+		t.Errorf("TrapHandler - unexpected %s", pdu)
+	default:
+	}
+}
+
+func TestTrapServerClose(t *testing.T) {
+	srv, err := snmpclient2.NewTrapServer("trap", "127.0.0.1:0", func(net.Addr, snmpclient2.PDU) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			srv.Close()
+		}()
+	}
+	wg.Wait()
+	if err = srv.Close(); err != nil {
+		t.Errorf("Close() - has error %v", err)
+	}
+}
@@ -3,10 +3,11 @@ package snmpclient2
 import (
 	"archive/zip"
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"os"
@@ -14,6 +15,8 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/runner-mei/snmpclient2/asn1"
 )
@@ -21,6 +24,16 @@ import (
 type OidAndValue struct {
 	Oid   Oid
 	Value Variable
+	// Dynamic generates the value if it is not nil
+	Dynamic ValueGenerator
+}
+
+// ValueAt returns the value at the time now
+func (sv *OidAndValue) ValueAt(now time.Time) Variable {
+	if nil != sv.Dynamic {
+		return sv.Dynamic(now)
+	}
+	return sv.Value
 }
 
 func compareOidAdValue(a1, b1 Item) int {
@@ -75,19 +88,6 @@ func convertOid(a interface{}) *Oid {
 	panic("a1 is not OidAndValue")
 }
 
-func compareOidAdValueWith(a1, b1 Item) int {
-	r := compareOidAdValue(a1, b1)
-	if r > 0 {
-		fmt.Println(convertOid(a1).String() + ">" + convertOid(b1).String())
-	} else if r < 0 {
-		fmt.Println(convertOid(a1).String() + "<" + convertOid(b1).String())
-	} else {
-		fmt.Println(convertOid(a1).String() + "==" + convertOid(b1).String())
-	}
-
-	return r
-}
-
 func NewMibTree() *Tree {
 	return NewTree(compareOidAdValue)
 }
@@ -95,21 +95,51 @@ func NewMibTree() *Tree {
 // ******************************************
 //  It is for test.
 type UdpServer struct {
-	miss       int
-	name       string
-	origin     string
-	conn       net.PacketConn
-	listenAddr net.Addr
-	waitGroup  sync.WaitGroup
-	mpv1       Security
+	rejected           uint64 // first for the 64-bit alignment of atomic
+	decodeFailures     uint64
+	injectedDrops      uint64
+	injectedDuplicates uint64
+	served             [Report + 1]uint64
+	miss               int
+	name               string
+	origin             string
+	conn               net.PacketConn
+	listenAddr         net.Addr
+	waitGroup          sync.WaitGroup
+	lifecycle          sync.Mutex // guards conn, closing and done
+	closing            bool
+	done               chan struct{}
+	mpv1               Security
 	//priv_type  PrivType
 	//priv_key []byte
 
-	return_error_if_oid_not_exists bool
-	is_update_mibs                 bool
-	community                      string
-	mibsByEngine                   map[string]*Tree
-	mibs                           *Tree
+	return_error_if_oid_not_exists    bool
+	return_error_if_community_unknown bool
+	is_update_mibs                    bool
+	read_only                         bool
+	no_access                         []Oid
+	community                         string
+	mibsByEngine                      map[string]*Tree
+	mibs                              *Tree
+	mibsMutex                         sync.RWMutex
+	v3                                usmAgent
+	created_at                        time.Time
+	tracer                            tracer
+	logger                            loggerRef
+	hook                              requestHookRef
+	handlers                          oidHandlers
+	faults                            faultInjector
+}
+
+// NewUdpServer creates a server without any data, the data sets are
+// loaded by the communities with LoadCommunity.
+func NewUdpServer(nm, addr string) (*UdpServer, error) {
+	srv := &UdpServer{name: nm,
+		origin:       addr,
+		mibsByEngine: map[string]*Tree{},
+		mpv1:         NewCommunity(),
+		created_at:   time.Now()}
+	return srv, srv.start()
 }
 
 func NewUdpServerFromFile(nm, addr, file string, is_update_mibs bool) (*UdpServer, error) {
@@ -118,7 +148,8 @@ func NewUdpServerFromFile(nm, addr, file string, is_update_mibs bool) (*UdpServe
 		is_update_mibs: is_update_mibs,
 		mibs:           NewMibTree(),
 		mibsByEngine:   map[string]*Tree{},
-		mpv1:           NewCommunity()}
+		mpv1:           NewCommunity(),
+		created_at:     time.Now()}
 	if err := srv.LoadFile(file); err != nil {
 		return nil, err
 	}
@@ -131,7 +162,8 @@ func NewUdpServerFromString(nm, addr, mibs string, is_update_mibs bool) (*UdpSer
 		is_update_mibs: is_update_mibs,
 		mibs:           NewMibTree(),
 		mibsByEngine:   map[string]*Tree{},
-		mpv1:           NewCommunity()}
+		mpv1:           NewCommunity(),
+		created_at:     time.Now()}
 	if e := srv.LoadMibsFromString(mibs); nil != e {
 		return nil, e
 	}
@@ -146,11 +178,85 @@ func (self *UdpServer) SetMiss(miss int) {
 	self.miss = miss
 }
 
+// SetReadOnly refuses all SetRequests if readOnly is true
+func (self *UdpServer) SetReadOnly(readOnly bool) {
+	self.mibsMutex.Lock()
+	defer self.mibsMutex.Unlock()
+	self.read_only = readOnly
+}
+
+// SetNoAccess refuses the SetRequests of the OIDs under the bases by
+// noAccess (noSuchName of SNMPv1), e.g. the objects of MAX-ACCESS
+// not-accessible. No bases accept all of them (The default).
+func (self *UdpServer) SetNoAccess(bases ...Oid) {
+	self.mibsMutex.Lock()
+	defer self.mibsMutex.Unlock()
+	self.no_access = bases
+}
+
+func (self *UdpServer) isNoAccess(oid Oid) bool {
+	for _, base := range self.no_access {
+		if base.IsPrefixOf(oid) {
+			return true
+		}
+	}
+	return false
+}
+
+// ReturnErrorIfCommunityUnknown answers the requests with an unknown
+// community by authorizationError (noSuchName of v1) instead of dropping them
+func (self *UdpServer) ReturnErrorIfCommunityUnknown(status bool) *UdpServer {
+	self.mibsMutex.Lock()
+	defer self.mibsMutex.Unlock()
+	self.return_error_if_community_unknown = status
+	return self
+}
+
+// Rejected returns the number of the requests with an unknown community
+func (self *UdpServer) Rejected() uint64 {
+	return atomic.LoadUint64(&self.rejected)
+}
+
+// LoadCommunity replaces the data set of the community by the file
+func (self *UdpServer) LoadCommunity(community, file string) error {
+	return self.LoadFileTo(community, file, true)
+}
+
+// LoadCommunityFromString replaces the data set of the community by mibs
+func (self *UdpServer) LoadCommunityFromString(community, mibs string) error {
+	return self.LoadMibsIntoEngine(community, bytes.NewReader([]byte(mibs)), true)
+}
+
+// LoadContext replaces the data set of the context name of SNMPv3 by the
+// file. A request of an unknown context is answered by the default data
+// set. The contexts and the communities are the same data sets, so that a
+// device is emulated for all the versions by one of them.
+func (self *UdpServer) LoadContext(contextName, file string) error {
+	return self.LoadFileTo(contextName, file, true)
+}
+
+// LoadContextFromString replaces the data set of the context name by mibs
+func (self *UdpServer) LoadContextFromString(contextName, mibs string) error {
+	return self.LoadMibsIntoEngine(contextName, bytes.NewReader([]byte(mibs)), true)
+}
+
 func (self *UdpServer) ReturnErrorIfOidNotExists(status bool) *UdpServer {
 	self.return_error_if_oid_not_exists = status
 	return self
 }
 
+// Reload replaces the default data set by the file without closing the
+// socket, the old data is kept if the file can not be loaded. The values set
+// by SetDynamic are dropped.
+func (self *UdpServer) Reload(file string) error {
+	return self.LoadFileTo("", file, true)
+}
+
+// ReloadFromReader is Reload reading rd
+func (self *UdpServer) ReloadFromReader(rd io.Reader) error {
+	return self.LoadMibsIntoEngine("", rd, true)
+}
+
 func (self *UdpServer) ReloadMibsFromFile(file string) error {
 	return self.LoadFileTo("", file, true)
 }
@@ -176,7 +282,7 @@ func (self *UdpServer) LoadFileTo(engineID, filename string, isReset bool) error
 			return errors.New(resp.Status)
 		}
 
-		return self.LoadMibsIntoEngine(engineID, resp.Body, isReset)
+		return self.LoadMibsWithFormat(engineID, resp.Body, formatOfFile(filename), isReset)
 	}
 
 	ext := filepath.Ext(filename)
@@ -185,7 +291,7 @@ func (self *UdpServer) LoadFileTo(engineID, filename string, isReset bool) error
 		if err != nil {
 			return err
 		}
-		return self.LoadMibsIntoEngine(engineID, r, isReset)
+		return self.LoadMibsWithFormat(engineID, r, formatOfFile(filename), isReset)
 	}
 
 	r, err := zip.OpenReader(filename)
@@ -199,17 +305,30 @@ func (self *UdpServer) LoadFileTo(engineID, filename string, isReset bool) error
 	}
 
 	if len(r.File) > 1 {
+		names := make([]string, 0, len(r.File))
 		for idx := range r.File {
-			fmt.Println(r.File[idx].Name)
+			names = append(names, r.File[idx].Name)
 		}
-		return errors.New("'" + filename + "' is muti files")
+		return errors.New("'" + filename + "' is muti files - " + strings.Join(names, ", "))
 	}
 
 	rc, err := r.File[0].Open()
 	if err != nil {
 		return err
 	}
-	return self.LoadMibsIntoEngine(engineID, rc, isReset)
+	return self.LoadMibsWithFormat(engineID, rc, formatOfFile(r.File[0].Name), isReset)
+}
+
+func formatOfFile(filename string) MibFormat {
+	switch ext := filepath.Ext(filename); {
+	case strings.EqualFold(ext, ".snmprec"):
+		return MibFormatSnmprec
+	case strings.EqualFold(ext, ".json"):
+		return MibFormatJSON
+	case strings.EqualFold(ext, ".pcap"), strings.EqualFold(ext, ".pcapng"), strings.EqualFold(ext, ".cap"):
+		return MibFormatPcap
+	}
+	return MibFormatAuto
 }
 
 func (self *UdpServer) LoadMibsFromString(mibs string) error {
@@ -217,6 +336,12 @@ func (self *UdpServer) LoadMibsFromString(mibs string) error {
 }
 
 func (self *UdpServer) LoadMibsIntoEngine(engineID string, rd io.Reader, isReset bool) error {
+	return self.LoadMibsWithFormat(engineID, rd, MibFormatAuto, isReset)
+}
+
+// LoadMibsWithFormat loads the data of the format, MibFormatAuto detects
+// the format by the first data line.
+func (self *UdpServer) LoadMibsWithFormat(engineID string, rd io.Reader, format MibFormat, isReset bool) error {
 	defer func() {
 		if f, ok := rd.(*os.File); ok {
 			if f != nil {
@@ -231,9 +356,44 @@ func (self *UdpServer) LoadMibsIntoEngine(engineID string, rd io.Reader, isReset
 		}
 	}()
 
+	bs, e := ioutil.ReadAll(rd)
+	if nil != e {
+		return e
+	}
+	if MibFormatAuto == format {
+		format = DetectMibFormat(bs)
+	}
+	bs, annotations, e := stripAnnotations(bs, format)
+	if nil != e {
+		return e
+	}
+
+	if isReset {
+		// the requests are served by the old data until the new one is loaded
+		mibs := NewMibTree()
+		if e = self.loadInto(mibs, bs, format, annotations); nil != e {
+			return e
+		}
+
+		self.mibsMutex.Lock()
+		defer self.mibsMutex.Unlock()
+		if engineID == "" || engineID == self.community {
+			self.mibs = mibs
+		} else {
+			if self.mibsByEngine == nil {
+				self.mibsByEngine = map[string]*Tree{}
+			}
+			self.mibsByEngine[engineID] = mibs
+		}
+		return nil
+	}
+
+	self.mibsMutex.Lock()
+	defer self.mibsMutex.Unlock()
+
 	var mibs *Tree
 	if engineID == "" || engineID == self.community {
-		if isReset {
+		if nil == self.mibs {
 			self.mibs = NewMibTree()
 		}
 		mibs = self.mibs
@@ -242,19 +402,33 @@ func (self *UdpServer) LoadMibsIntoEngine(engineID string, rd io.Reader, isReset
 			self.mibsByEngine = map[string]*Tree{}
 		}
 
-		if isReset {
+		mibs = self.mibsByEngine[engineID]
+		if mibs == nil {
 			mibs = NewMibTree()
 			self.mibsByEngine[engineID] = mibs
-		} else {
-			mibs = self.mibsByEngine[engineID]
-			if mibs == nil {
-				mibs = NewMibTree()
-				self.mibsByEngine[engineID] = mibs
-			}
 		}
 	}
+	return self.loadInto(mibs, bs, format, annotations)
+}
 
-	if e := Read(rd, func(oid Oid, value Variable) error {
+func (self *UdpServer) loadInto(mibs *Tree, bs []byte, format MibFormat, annotations map[string]annotation) error {
+	var read func(io.Reader, func(Oid, Variable) error) error
+	switch format {
+	case MibFormatSnmpwalk:
+		read = Read
+	case MibFormatNumeric:
+		read = ReadNumeric
+	case MibFormatSnmprec:
+		read = ReadSnmprec
+	case MibFormatJSON:
+		read = ReadJSON
+	case MibFormatPcap:
+		read = ReadPcap
+	default:
+		return errors.New("mibs format '" + format.String() + "' is unsupported")
+	}
+
+	if e := read(bytes.NewReader(bs), func(oid Oid, value Variable) error {
 		if ok := mibs.Insert(&OidAndValue{Oid: oid,
 			Value: value}); !ok {
 
@@ -274,8 +448,22 @@ func (self *UdpServer) LoadMibsIntoEngine(engineID string, rd io.Reader, isReset
 	}); nil != e {
 		return e
 	}
+
+	for s, a := range annotations {
+		oid, _ := ParseOidFromString(s)
+		item, ok := mibs.Get(oid).(*OidAndValue)
+		if !ok {
+			continue
+		}
+		gen, e := a.generator(item.Value)
+		if nil != e {
+			return errors.New("'" + s + "' is invalid, " + e.Error())
+		}
+		item.Dynamic = gen
+	}
 	return nil
 }
+
 func (self *UdpServer) GetPort() string {
 	s := self.listenAddr.String()
 	_, port, _ := net.SplitHostPort(s)
@@ -291,26 +479,62 @@ func (self *UdpServer) GetIntPort() int {
 	return i
 }
 
+// Close closes the socket, and waits until the datagram being processed is
+// finished. It is safe to call Close more than once.
 func (self *UdpServer) Close() error {
-	if self.conn != nil {
+	self.lifecycle.Lock()
+	if nil != self.conn {
+		self.closing = true
 		self.conn.Close()
-		self.waitGroup.Wait()
-		self.conn = nil
 	}
+	self.lifecycle.Unlock()
 
+	self.waitGroup.Wait()
 	return nil
 }
 
+// Shutdown stops reading the datagrams, and waits until the datagram being
+// processed is finished or ctx is done, then closes the socket. ctx.Err() is
+// returned if ctx is done first.
+func (self *UdpServer) Shutdown(ctx context.Context) error {
+	self.lifecycle.Lock()
+	conn, done := self.conn, self.done
+	if nil != conn {
+		self.closing = true
+		// unblock the ReadFrom, the serving loop exits then
+		conn.SetReadDeadline(time.Now())
+	}
+	self.lifecycle.Unlock()
+	if nil == conn {
+		return nil
+	}
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		conn.Close()
+		return ctx.Err()
+	}
+}
+
+// Done returns a channel which is closed when the UdpServer stops serving
+func (self *UdpServer) Done() <-chan struct{} {
+	self.lifecycle.Lock()
+	defer self.lifecycle.Unlock()
+	return self.done
+}
+
 func (self *UdpServer) Pause() error {
 	self.Close()
-	log.Println("udp server is exited - ", self.listenAddr)
+	self.debugf(" udp server is exited - %v", self.listenAddr)
 	return nil
 }
 
 func (self *UdpServer) Resume() error {
-	err := self.start()
+	err := self.Start()
 	if err == nil {
-		log.Println("udp server is resumed, listen at", self.listenAddr)
+		self.debugf(" udp server is resumed, listen at %v", self.listenAddr)
 	}
 	return err
 }
@@ -319,14 +543,26 @@ func (self *UdpServer) Restart() error {
 	self.Close()
 
 	self.listenAddr = nil
-	log.Println("udp server is exited")
-	err := self.start()
+	self.debugf(" udp server is exited")
+	err := self.Start()
 	if err == nil {
-		log.Println("udp server is restarted, listen at", self.listenAddr.String())
+		self.debugf(" udp server is restarted, listen at %v", self.listenAddr)
 	}
 	return err
 }
 
+// Start starts serving, it does nothing if the UdpServer is serving
+func (self *UdpServer) Start() error {
+	self.lifecycle.Lock()
+	defer self.lifecycle.Unlock()
+	if nil != self.conn {
+		return nil
+	}
+	return self.start()
+}
+
+// start listens and starts the serving loop, the caller locks the lifecycle
+// unless the UdpServer is being created
 func (self *UdpServer) start() error {
 	var conn net.PacketConn
 	var e error
@@ -342,16 +578,22 @@ func (self *UdpServer) start() error {
 
 	self.conn = conn
 	self.listenAddr = conn.LocalAddr()
+	self.closing = false
+	self.done = make(chan struct{})
 
 	self.waitGroup.Add(1)
-	go self.serve()
+	go self.serve(conn, self.done)
 
 	return nil
 }
 
-func (self *UdpServer) serve() {
+func (self *UdpServer) serve(conn net.PacketConn, done chan struct{}) {
 	defer func() {
+		conn.Close()
+		self.lifecycle.Lock()
 		self.conn = nil
+		self.lifecycle.Unlock()
+		close(done)
 		self.waitGroup.Done()
 	}()
 
@@ -360,77 +602,50 @@ func (self *UdpServer) serve() {
 	count := 0
 
 	for {
-		n, addr, err := self.conn.ReadFrom(cached_bytes[:])
+		n, addr, err := conn.ReadFrom(cached_bytes[:])
 		if nil != err {
-			log.Println("[", self.name, "]", err.Error())
+			self.lifecycle.Lock()
+			closing := self.closing
+			self.lifecycle.Unlock()
+			if !closing {
+				self.warnf(" %v", err)
+			}
 			break
 		}
 
 		count++
+		self.tracer.received(cached_bytes[:n], nil, nil)
 
-		if self.miss > 1 && count%self.miss == 0 {
+		if (self.miss > 1 && count%self.miss == 0) || self.injectLoss(addr) {
+			if hook := self.hook.handler(); nil != hook {
+				hook(addr, nil, nil, DroppedError)
+			}
 			continue
 		}
 
-		func(recv_bytes []byte) {
+		reqPdu, resPdu, err := func(recv_bytes []byte) (PDU, PDU, error) {
 			var raw asn1.RawValue
-			_, err = asn1.Unmarshal(recv_bytes, &raw)
+			_, err := asn1.Unmarshal(recv_bytes, &raw)
 			if err != nil {
-				log.Printf("["+self.name+"]Invalid MessageV3 object - %s : [%s]",
+				return nil, nil, self.decodeFailed("Invalid MessageV3 object - %s : [%s]",
 					err.Error(), ToHexStr(recv_bytes, " "))
-				return
 			}
 
 			if raw.Class != asn1.ClassUniversal || raw.Tag != asn1.TagSequence || !raw.IsCompound {
-				log.Printf("["+self.name+"]Invalid MessageV3 object - Class [%02x], Tag [%02x] : [%s]",
+				return nil, nil, self.decodeFailed("Invalid MessageV3 object - Class [%02x], Tag [%02x] : [%s]",
 					raw.FullBytes[0], raw.Tag, ToHexStr(recv_bytes, " "))
-				return
 			}
 			next := raw.Bytes
 
 			var version int
 			next, err = asn1.Unmarshal(next, &version)
 			if err != nil {
-				log.Printf("["+self.name+"]Invalid MessageV3 object - %s : [%s]",
+				return nil, nil, self.decodeFailed("Invalid MessageV3 object - %s : [%s]",
 					err.Error(), ToHexStr(recv_bytes, " "))
-				return
 			}
 
 			if SnmpVersion(version) == V3 {
-				// var managedId int
-				// next, err = asn1.Unmarshal(next, &managedId)
-				// if err != nil {
-				// 	return
-				// }
-
-				// pdu := &ScopedPdu{}
-				// recvMsg := NewMessage(SnmpVersion(version), pdu)
-				// _, err = recvMsg.Unmarshal(recv_bytes)
-				// if err != nil {
-				// 	log.Printf(client.logCtx, "Failed to Unmarshal message - %s : [%s]",
-				// 		err.Error(), ToHexStr(recv_bytes, " "))
-				// 	return
-				// }
-
-				// var ok bool
-				// request, ok = client.pendings[managedId]
-				// if !ok {
-				// 	log.Printf(client.logCtx, "request with requestId was", managedId, "is not exists.")
-				// 	return
-				// }
-				// delete(client.pendings, managedId)
-				// request.response = pdu
-
-				// err = client.mpv3.ProcessIncomingMessage(snmp, nil, recvMsg)
-				// if err != nil {
-				// 	log.Printf(client.logCtx, "Failed to process incoming message - %s : [%s]",
-				// 		err.Error(), ToHexStr(recv_bytes, " "))
-				// 	return
-				// }
-
-				log.Printf("["+self.name+"]Failed to process incoming message - v3 message is unsupported : [%s]",
-					ToHexStr(recv_bytes, " "))
-				return
+				return self.on_v3(addr, recv_bytes)
 			}
 			recvMsg := &MessageV1{
 				version: SnmpVersion(version),
@@ -438,24 +653,28 @@ func (self *UdpServer) serve() {
 			}
 			_, err = recvMsg.Unmarshal(recv_bytes)
 			if err != nil {
-				log.Printf("["+self.name+"]Failed to Unmarshal message - %s : [%s]",
+				return nil, nil, self.decodeFailed("Failed to Unmarshal message - %s : [%s]",
 					err.Error(), ToHexStr(recv_bytes, " "))
-				return
 			}
 
 			err = self.mpv1.ProcessIncomingMessage(nil, recvMsg)
 			if err != nil {
-				log.Printf("["+self.name+"]Failed to process incoming message - %s : [%s]",
+				return nil, nil, self.decodeFailed("Failed to process incoming message - %s : [%s]",
 					err.Error(), ToHexStr(recv_bytes, " "))
-				return
 			}
-			self.on_v2(addr, recvMsg, recv_bytes)
-
+			return recvMsg.PDU(), self.on_v2(addr, recvMsg, recv_bytes), nil
 		}(cached_bytes[:n])
+
+		// the mibs are unlocked
+		if hook := self.hook.handler(); nil != hook {
+			hook(addr, reqPdu, resPdu, err)
+		}
 	}
 }
 
-func (self *UdpServer) on_v2(addr net.Addr, p *MessageV1, cached_bytes []byte) {
+// on_v2 answers a request of V1 or V2c, the response is returned, it is nil
+// if the request is dropped
+func (self *UdpServer) on_v2(addr net.Addr, p *MessageV1, cached_bytes []byte) PDU {
 	pdu := &PduV1{
 		pduType:   GetResponse,
 		requestId: p.PDU().RequestId(),
@@ -466,6 +685,8 @@ func (self *UdpServer) on_v2(addr net.Addr, p *MessageV1, cached_bytes []byte) {
 		pdu:     pdu,
 	}
 
+	defer self.lockMibs(p.PDU().PduType())()
+
 	var mibs *Tree
 	if self.mibsByEngine != nil {
 		mibs = self.mibsByEngine[string(p.Community)]
@@ -473,74 +694,298 @@ func (self *UdpServer) on_v2(addr net.Addr, p *MessageV1, cached_bytes []byte) {
 	if mibs == nil {
 		if self.community == "" || self.community == string(p.Community) {
 			mibs = self.mibs
-		} else {
-			log.Println("community isnot match")
 		}
 	}
 
 	if mibs == nil {
-		for key := range self.mibsByEngine {
-			fmt.Println(key)
+		atomic.AddUint64(&self.rejected, 1)
+		if !self.return_error_if_community_unknown {
+			return nil
 		}
-		return
+		if V1 == p.Version() {
+			pdu.SetErrorStatus(NoSuchName)
+		} else {
+			pdu.SetErrorStatus(AuthorizationError)
+		}
+	} else {
+		//res.SetMaxMsgSize(p.GetMaxMsgSize())
+
+		// the message header is about 32 octets besides the community
+		self.respond(p.Version(), mibs, p.PDU(), pdu, udpMessageSizeMax-32-len(p.Community))
+	}
+
+	err := NewCommunity().GenerateRequestMessage(&Arguments{Community: string(p.Community)}, res)
+	if err != nil {
+		self.warnf(" failed to generate request, %v", err)
+		return nil
+	}
+
+	s, err := res.Marshal()
+	if err != nil {
+		self.warnf(" failed to marshal, %v", err)
+		return nil
+	}
+	self.tracer.sent(s, res, nil)
+	if e := self.writeTo(self.conn, s, addr, p.PDU()); nil != e {
+		self.warnf(" failed to write response, %v", e)
+		return nil
+	}
+	return pdu
+}
+
+// lockMibs locks the mibs for a request, SetRequest writes the mibs
+func (self *UdpServer) lockMibs(t PduType) (unlock func()) {
+	if SetRequest == t {
+		self.mibsMutex.Lock()
+		return self.mibsMutex.Unlock
 	}
+	self.mibsMutex.RLock()
+	return self.mibsMutex.RUnlock
+}
 
-	//res.SetMaxMsgSize(p.GetMaxMsgSize())
+// respond fills the variable bindings of the response to req, the encoded
+// variable bindings of a GetBulkRequest are limited to maxSize octets. The
+// caller locks the mibs by lockMibs.
+func (self *UdpServer) respond(version SnmpVersion, mibs *Tree, req, res PDU, maxSize int) {
+	if t := req.PduType(); t >= 0 && t <= Report {
+		atomic.AddUint64(&self.served[t], 1)
+	}
+	// the dynamic values of a request are generated at the same time
+	now := time.Now()
+	if n := self.faults.varBindsLimit(); n > 0 && len(req.VariableBindings()) > n {
+		res.SetErrorStatus(TooBig)
+		return
+	}
 
-	switch p.PDU().PduType() {
+	switch req.PduType() {
 	case GetRequest:
-		for _, vb := range p.PDU().VariableBindings() {
+		var results VariableBindings
+		for idx, vb := range req.VariableBindings() {
+			status, exception := self.faults.errorOf(vb.Oid)
+			if NoError == status && nil != exception && V1 == version {
+				status = NoSuchName
+			}
+			if NoError != status {
+				self.answerError(req, res, idx, handlerErrorStatus(version, PduError{Status: status}))
+				return
+			}
+			if nil != exception {
+				results = append(results, VariableBinding{Oid: vb.Oid, Variable: exception})
+				continue
+			}
 
-			v := self.GetValueByOid(mibs, vb.Oid)
+			v, err := self.lookup(mibs, req, vb.Oid, now)
+			if nil != err {
+				self.fail(version, req, res, idx, err)
+				return
+			}
 			if nil == v {
 				if self.return_error_if_oid_not_exists {
-					pdu.SetErrorStatus(NoSuchName)
+					res.SetErrorStatus(NoSuchName)
 					break
 				}
 				continue
 			}
-			res.PDU().AppendVariableBinding(vb.Oid, v)
+			results = append(results, VariableBinding{Oid: vb.Oid, Variable: v})
+		}
+		for _, vb := range results {
+			res.AppendVariableBinding(vb.Oid, vb.Variable)
 		}
 	case GetNextRequest:
-		for _, vb := range p.PDU().VariableBindings() {
-			o, v := self.GetNextValueByOid(mibs, vb.Oid)
+		var results VariableBindings
+		for idx, vb := range req.VariableBindings() {
+			o, v, err := self.lookupNext(mibs, req, vb.Oid, now)
+			if nil != err {
+				self.fail(version, req, res, idx, err)
+				return
+			}
 			if nil == v {
 				continue
 			}
-			res.PDU().AppendVariableBinding(*o, v)
+			results = append(results, VariableBinding{Oid: *o, Variable: v})
+		}
+		for _, vb := range results {
+			res.AppendVariableBinding(vb.Oid, vb.Variable)
+		}
+	case GetBulkRequest:
+		self.bulk(version, mibs, req, res, maxSize, now)
+	case SetRequest:
+		self.set(version, mibs, req, res)
+	case InformRequest:
+		// acknowledge with the variable bindings (RFC3416 Section 4.2.7)
+		for _, vb := range req.VariableBindings() {
+			res.AppendVariableBinding(vb.Oid, vb.Variable)
 		}
 	default:
-		log.Println("[", self.name, "] snmp type is not supported.")
+		self.warnf(" %s is not supported", req.PduType())
 	}
+}
 
-	err := NewCommunity().GenerateRequestMessage(&Arguments{Community: ""}, res)
-	if err != nil {
-		log.Println("[", self.name, "] failed to generate request,", err)
-		return
+// fail answers the request by the error of the handler of the idx-th
+// variable binding, the variable bindings of the request are returned
+func (self *UdpServer) fail(version SnmpVersion, req, res PDU, idx int, err error) {
+	self.warnf(" failed to handle %s - %v", req.VariableBindings()[idx].Oid.ToString(), err)
+	self.answerError(req, res, idx, handlerErrorStatus(version, err))
+}
+
+// answerError answers the request by the error status at the idx-th
+// variable binding, the variable bindings of the request are returned
+func (self *UdpServer) answerError(req, res PDU, idx int, status ErrorStatus) {
+	res.SetErrorStatus(status)
+	res.SetErrorIndex(idx + 1)
+	for _, vb := range req.VariableBindings() {
+		res.AppendVariableBinding(vb.Oid, vb.Variable)
 	}
+}
 
-	s, err := res.Marshal()
-	if err != nil {
-		log.Println("[", self.name, "] failed to marshal,", err)
+// bulk answers a GetBulkRequest (RFC 3416 Section 4.2.3), the repetitions
+// exceeding maxSize octets are dropped as a whole
+func (self *UdpServer) bulk(version SnmpVersion, mibs *Tree, req, res PDU, maxSize int, now time.Time) {
+	vbs := req.VariableBindings()
+	// GetBulkRequest keeps them in the error status and index fields
+	nonRepeaters, maxRepetitions := int(req.ErrorStatus()), req.ErrorIndex()
+	if nonRepeaters < 0 {
+		nonRepeaters = 0
+	}
+	if nonRepeaters > len(vbs) {
+		nonRepeaters = len(vbs)
+	}
+
+	size := 0
+	fits := func(row VariableBindings) bool {
+		n := 0
+		for idx := range row {
+			b, _ := row[idx].Marshal()
+			n += len(b)
+		}
+		if size+n > maxSize {
+			return false
+		}
+		size += n
+		return true
+	}
+	var err error
+	failed := -1
+	next := func(idx int, oid Oid) VariableBinding {
+		o, v, e := self.lookupNext(mibs, req, oid, now)
+		if nil != e {
+			if failed < 0 {
+				failed, err = idx, e
+			}
+		} else if nil != v {
+			return VariableBinding{Oid: *o, Variable: v}
+		}
+		return VariableBinding{Oid: oid, Variable: NewEndOfMibView()}
+	}
+
+	var results VariableBindings
+	for idx, vb := range vbs[:nonRepeaters] {
+		results = append(results, next(idx, vb.Oid))
+	}
+	if failed >= 0 {
+		self.fail(version, req, res, failed, err)
 		return
 	}
-	if _, e := self.conn.WriteTo(s, addr); nil != e {
-		log.Println("[", self.name, "] failed to write response,", e)
+	if !fits(results) {
+		res.SetErrorStatus(TooBig)
 		return
 	}
+
+	var last []Oid
+	for _, vb := range vbs[nonRepeaters:] {
+		last = append(last, vb.Oid)
+	}
+	for r := 0; r < maxRepetitions && 0 != len(last); r++ {
+		row := make(VariableBindings, 0, len(last))
+		ended := true
+		for idx := range last {
+			vb := next(nonRepeaters+idx, last[idx])
+			if _, ok := vb.Variable.(*EndOfMibView); !ok {
+				ended = false
+			}
+			row = append(row, vb)
+			last[idx] = vb.Oid
+		}
+		if failed >= 0 {
+			self.fail(version, req, res, failed, err)
+			return
+		}
+		if !fits(row) {
+			break
+		}
+		results = append(results, row...)
+		if ended {
+			break
+		}
+	}
+
+	for _, vb := range results {
+		res.AppendVariableBinding(vb.Oid, vb.Variable)
+	}
+}
+
+// set updates the mibs if all the variable bindings are writable, or
+// returns the error of the first one
+func (self *UdpServer) set(version SnmpVersion, mibs *Tree, req, res PDU) {
+	vbs := req.VariableBindings()
+	items := make([]*OidAndValue, 0, len(vbs))
+	for idx, vb := range vbs {
+		var status ErrorStatus
+		item, _ := mibs.Get(vb.Oid).(*OidAndValue)
+		if self.isNoAccess(vb.Oid) {
+			status = NoAccess
+			if V1 == version {
+				status = NoSuchName
+			}
+		} else if self.read_only || nil == item {
+			status = NotWritable
+			if V1 == version {
+				status = NoSuchName
+			}
+		} else if item.Value.Syntex() != vb.Variable.Syntex() {
+			status = WrongType
+			if V1 == version {
+				status = BadValue
+			}
+		}
+		if NoError != status {
+			res.SetErrorStatus(status)
+			res.SetErrorIndex(idx + 1)
+			break
+		}
+		items = append(items, item)
+	}
+
+	if NoError == res.ErrorStatus() {
+		for idx, item := range items {
+			item.Value = vbs[idx].Variable
+			item.Dynamic = nil
+		}
+	}
+	for _, vb := range vbs {
+		res.AppendVariableBinding(vb.Oid, vb.Variable)
+	}
 }
 
 func (self *UdpServer) GetValueByOid(mibs *Tree, oid Oid) Variable {
+	return self.getValue(mibs, oid, time.Now())
+}
+
+func (self *UdpServer) GetNextValueByOid(mibs *Tree, oid Oid) (*Oid, Variable) {
+	return self.getNextValue(mibs, oid, time.Now())
+}
+
+func (self *UdpServer) getValue(mibs *Tree, oid Oid, now time.Time) Variable {
 	if v := mibs.Get(oid); nil != v {
 		if sv, ok := v.(*OidAndValue); ok {
-			return sv.Value
+			return sv.ValueAt(now)
 		}
 		panic(fmt.Sprintf("it is not a Variable - [%T]%v", v, v))
 	}
 	return nil
 }
 
-func (self *UdpServer) GetNextValueByOid(mibs *Tree, oid Oid) (*Oid, Variable) {
+func (self *UdpServer) getNextValue(mibs *Tree, oid Oid, now time.Time) (*Oid, Variable) {
 	it := mibs.FindGE(oid)
 	if it.Limit() {
 		return nil, nil
@@ -555,7 +1000,7 @@ func (self *UdpServer) GetNextValueByOid(mibs *Tree, oid Oid) (*Oid, Variable) {
 	}
 
 	if 0 != compareOidAdValue(oid, sv.Oid) {
-		return &sv.Oid, sv.Value
+		return &sv.Oid, sv.ValueAt(now)
 	}
 	it = it.Next()
 	if it.Limit() {
@@ -567,7 +1012,7 @@ func (self *UdpServer) GetNextValueByOid(mibs *Tree, oid Oid) (*Oid, Variable) {
 	}
 	sv, ok = v.(*OidAndValue)
 	if ok {
-		return &sv.Oid, sv.Value
+		return &sv.Oid, sv.ValueAt(now)
 	}
 	panic(fmt.Sprintf("it is not a Variable - [%T]%v", v, v))
 }
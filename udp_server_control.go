@@ -0,0 +1,253 @@
+package snmpclient2
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SetValue sets the value of the oid in the default data set, the oid is
+// added if it is not exists. The generator of the oid is removed.
+func (self *UdpServer) SetValue(oid Oid, value Variable) {
+	self.mibsMutex.Lock()
+	defer self.mibsMutex.Unlock()
+
+	if nil == self.mibs {
+		self.mibs = NewMibTree()
+	}
+	if item, ok := self.mibs.Get(oid).(*OidAndValue); ok {
+		item.Value = value
+		item.Dynamic = nil
+		return
+	}
+	self.mibs.Insert(&OidAndValue{Oid: oid, Value: value})
+}
+
+// RemoveValue removes the oid from the default data set, it returns false
+// if the oid is not exists
+func (self *UdpServer) RemoveValue(oid Oid) bool {
+	self.mibsMutex.Lock()
+	defer self.mibsMutex.Unlock()
+
+	if nil == self.mibs {
+		return false
+	}
+	return self.mibs.DeleteWithKey(oid)
+}
+
+// A TrapRequest is the body of "POST /traps" of the control API, the
+// variables follow sysUpTime.0 of the server and snmpTrapOID.0.
+type TrapRequest struct {
+	// DSN is the receiver of ParseTarget, e.g.
+	// "snmp://public@127.0.0.1:162?version=2c". The trap of the version 1
+	// is the Trap-PDU of the snmpTrapOID.0 value (RFC 3584 Section 3.2)
+	DSN       string           `json:"dsn"`
+	TrapOid   string           `json:"trap_oid"`
+	Inform    bool             `json:"inform,omitempty"`
+	Variables VariableBindings `json:"variables,omitempty"`
+}
+
+// ControlHandler returns the HTTP API which steers the default data set of
+// the server at runtime, e.g. by the test harnesses:
+//
+//	GET    /oids         all the values in the JSON format of the data files
+//	GET    /oids/{oid}   the value, e.g. {"oid":"1.3.6.1.2.1.1.5.0","type":"OctetString","value":"router"}
+//	PUT    /oids/{oid}   sets the value, e.g. {"type":"Counter32","value":5}
+//	DELETE /oids/{oid}   removes the value
+//	POST   /reload       replaces the data set by the body, or by file if the body is empty
+//	POST   /traps        sends the trap of the TrapRequest
+//
+// The handler is not authenticated, it should listen on a private address.
+func (self *UdpServer) ControlHandler(file string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oids", self.serveValues)
+	mux.HandleFunc("/oids/", self.serveValue)
+	mux.HandleFunc("/reload", func(w http.ResponseWriter, r *http.Request) {
+		self.serveReload(w, r, file)
+	})
+	mux.HandleFunc("/traps", self.serveTrap)
+	return mux
+}
+
+func (self *UdpServer) serveValues(w http.ResponseWriter, r *http.Request) {
+	if http.MethodGet != r.Method {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method is not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	now := time.Now()
+	vbs := VariableBindings{}
+	self.mibsMutex.RLock()
+	if nil != self.mibs {
+		for it := self.mibs.Min(); !it.Limit(); it = it.Next() {
+			if item, ok := it.Item().(*OidAndValue); ok {
+				vbs = append(vbs, VariableBinding{Oid: item.Oid, Variable: item.ValueAt(now)})
+			}
+		}
+	}
+	self.mibsMutex.RUnlock()
+	writeJSON(w, http.StatusOK, vbs)
+}
+
+func (self *UdpServer) serveValue(w http.ResponseWriter, r *http.Request) {
+	s := strings.TrimPrefix(r.URL.Path, "/oids/")
+	oid, err := ParseOidFromString(strings.Trim(s, "."))
+	if err != nil {
+		http.Error(w, "oid '"+s+"' is invalid - "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		self.mibsMutex.RLock()
+		var value Variable
+		if nil != self.mibs {
+			value = self.GetValueByOid(self.mibs, oid)
+		}
+		self.mibsMutex.RUnlock()
+		if nil == value {
+			http.Error(w, "oid '"+oid.ToString()+"' is not found", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, VariableBinding{Oid: oid, Variable: value})
+	case http.MethodPut:
+		var jv jsonVariableBinding
+		if err = json.NewDecoder(r.Body).Decode(&jv); err != nil {
+			http.Error(w, "body is invalid - "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		value, err := jv.variable()
+		if err != nil {
+			http.Error(w, "value of '"+oid.ToString()+"' is invalid - "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		self.SetValue(oid, value)
+		writeJSON(w, http.StatusOK, VariableBinding{Oid: oid, Variable: value})
+	case http.MethodDelete:
+		if !self.RemoveValue(oid) {
+			http.Error(w, "oid '"+oid.ToString()+"' is not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		http.Error(w, "method is not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (self *UdpServer) serveReload(w http.ResponseWriter, r *http.Request, file string) {
+	if http.MethodPost != r.Method {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method is not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(body) > 0 {
+		err = self.ReloadMibsFromString(string(body))
+	} else if "" != file {
+		err = self.Reload(file)
+	} else {
+		http.Error(w, "body is required, the server has no data file", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "reload failed - "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (self *UdpServer) serveTrap(w http.ResponseWriter, r *http.Request) {
+	if http.MethodPost != r.Method {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method is not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req TrapRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "body is invalid - "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	trapOid, err := ParseOidFromString(strings.Trim(req.TrapOid, "."))
+	if err != nil {
+		http.Error(w, "trap_oid '"+req.TrapOid+"' is invalid - "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	network, address, args, err := ParseTarget(req.DSN)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if V1 == args.Version && req.Inform {
+		http.Error(w, "InformRequest requires SNMP Version 2c or 3", http.StatusBadRequest)
+		return
+	}
+
+	upTime := self.UpTimeGenerator()(time.Now())
+	vbs := VariableBindings{
+		{Oid: OidSysUpTime, Variable: upTime},
+		{Oid: OidSnmpTrap, Variable: &trapOid},
+	}
+	vbs = append(vbs, req.Variables...)
+
+	snmp, err := NewSNMP(network, address, args)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer snmp.Close()
+	if V1 == args.Version {
+		enterprise, genericTrap, specificTrap := v1TrapOf(trapOid)
+		err = snmp.V1TrapContext(r.Context(), enterprise, nil, genericTrap, specificTrap,
+			uint32(upTime.Uint()), req.Variables)
+	} else if req.Inform {
+		err = snmp.InformRequestContext(r.Context(), vbs)
+	} else {
+		err = snmp.V2TrapContext(r.Context(), vbs)
+	}
+	if err != nil {
+		http.Error(w, "send failed - "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+var oidSnmpTraps = MustParseOidFromString("1.3.6.1.6.3.1.1.5")
+
+// v1TrapOf returns the fields of the Trap-PDU of the snmpTrapOID.0 value
+// (RFC 3584 Section 3.2)
+func v1TrapOf(trapOid Oid) (enterprise Oid, genericTrap, specificTrap int) {
+	n := len(trapOid.Value)
+	if n == len(oidSnmpTraps.Value)+1 && oidSnmpTraps.IsPrefixOf(trapOid) {
+		if last := trapOid.Value[n-1]; last >= 1 && last <= EnterpriseSpecific {
+			return oidSnmpTraps, last - 1, 0
+		}
+	}
+	if n < 2 {
+		return trapOid, EnterpriseSpecific, 0
+	}
+	enterprise = trapOid.Parent()
+	if n > 2 && 0 == trapOid.Value[n-2] {
+		enterprise = enterprise.Parent()
+	}
+	return enterprise, EnterpriseSpecific, trapOid.Value[n-1]
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(b)
+}
@@ -0,0 +1,298 @@
+package snmpclient2
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Faults are injected into the requests and the responses of an UdpServer
+// to test the timeouts and the retries of a client. The zero value injects
+// nothing.
+type Faults struct {
+	// The response is delayed for a duration in [MinDelay, MaxDelay], it is
+	// MinDelay if MaxDelay is not greater
+	MinDelay time.Duration
+	MaxDelay time.Duration
+	// The fraction of the requests which are dropped silently
+	LossRate float64
+	// The fraction of the responses which are sent twice
+	DuplicateRate float64
+}
+
+// faultInjector keeps the Faults of an UdpServer, the decisions are made by
+// a single source so that they are deterministic with a seed.
+type faultInjector struct {
+	mutex  sync.Mutex
+	rand   *rand.Rand
+	faults Faults
+	byHost map[string]Faults
+
+	// the errors answered to the GetRequests, see SetError and SetException
+	statuses    map[string]ErrorStatus
+	exceptions  map[string]Variable
+	maxVarBinds int
+
+	// the delays of the requests of the OIDs, see SetOidDelay
+	delays map[string]oidDelay
+}
+
+type oidDelay struct {
+	oid   Oid
+	delay time.Duration
+}
+
+// get returns the faults of the source address, ok is false if nothing is
+// injected
+func (f *faultInjector) get(addr net.Addr) (faults Faults, ok bool) {
+	faults = f.faults
+	if nil != f.byHost {
+		if a, isUdp := addr.(*net.UDPAddr); isUdp {
+			if byHost, found := f.byHost[a.IP.String()]; found {
+				faults = byHost
+			}
+		}
+	}
+	return faults, Faults{} != faults
+}
+
+func (f *faultInjector) random() *rand.Rand {
+	if nil == f.rand {
+		f.rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return f.rand
+}
+
+// drop returns true if the request from addr should be dropped
+func (f *faultInjector) drop(addr net.Addr) bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	faults, ok := f.get(addr)
+	if !ok || faults.LossRate <= 0 {
+		return false
+	}
+	return f.random().Float64() < faults.LossRate
+}
+
+// response returns the delay of the response to addr and whether it is
+// sent twice
+func (f *faultInjector) response(addr net.Addr) (delay time.Duration, duplicate bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	faults, ok := f.get(addr)
+	if !ok {
+		return 0, false
+	}
+	delay = faults.MinDelay
+	if faults.MaxDelay > faults.MinDelay {
+		delay += time.Duration(f.random().Int63n(int64(faults.MaxDelay - faults.MinDelay + 1)))
+	}
+	if faults.DuplicateRate > 0 {
+		duplicate = f.random().Float64() < faults.DuplicateRate
+	}
+	return delay, duplicate
+}
+
+// delayOf returns the longest delay of the OIDs of the request
+func (f *faultInjector) delayOf(req PDU) (delay time.Duration) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if 0 == len(f.delays) || nil == req {
+		return 0
+	}
+	for _, vb := range req.VariableBindings() {
+		for _, d := range f.delays {
+			if d.delay > delay && d.oid.IsPrefixOf(vb.Oid) {
+				delay = d.delay
+			}
+		}
+	}
+	return delay
+}
+
+// SetFaults sets the faults injected into the requests from all the
+// sources, Faults{} removes them
+func (self *UdpServer) SetFaults(faults Faults) {
+	self.faults.mutex.Lock()
+	defer self.faults.mutex.Unlock()
+	self.faults.faults = faults
+}
+
+// SetFaultsFor sets the faults injected into the requests from the host,
+// which override the faults of SetFaults
+func (self *UdpServer) SetFaultsFor(host string, faults Faults) {
+	if ip := net.ParseIP(host); nil != ip {
+		host = ip.String()
+	}
+	self.faults.mutex.Lock()
+	defer self.faults.mutex.Unlock()
+	if nil == self.faults.byHost {
+		self.faults.byHost = map[string]Faults{}
+	}
+	self.faults.byHost[host] = faults
+}
+
+// SetFaultSeed seeds the random decisions of the faults, so that the same
+// sequence of the requests gets the same faults
+func (self *UdpServer) SetFaultSeed(seed int64) {
+	self.faults.mutex.Lock()
+	defer self.faults.mutex.Unlock()
+	self.faults.rand = rand.New(rand.NewSource(seed))
+}
+
+// SetDelay delays all the responses for d
+func (self *UdpServer) SetDelay(d time.Duration) {
+	self.SetDelayRange(d, d)
+}
+
+// SetDelayRange delays all the responses for a random duration in [min, max]
+func (self *UdpServer) SetDelayRange(min, max time.Duration) {
+	self.faults.mutex.Lock()
+	defer self.faults.mutex.Unlock()
+	self.faults.faults.MinDelay, self.faults.faults.MaxDelay = min, max
+}
+
+// SetLossRate drops the fraction p of the requests silently, they are
+// counted by InjectedDrops of Stats
+func (self *UdpServer) SetLossRate(p float64) {
+	self.faults.mutex.Lock()
+	defer self.faults.mutex.Unlock()
+	self.faults.faults.LossRate = p
+}
+
+// SetDuplicateRate sends the fraction p of the responses twice
+func (self *UdpServer) SetDuplicateRate(p float64) {
+	self.faults.mutex.Lock()
+	defer self.faults.mutex.Unlock()
+	self.faults.faults.DuplicateRate = p
+}
+
+// injectLoss returns true if the request from addr is dropped by the faults
+func (self *UdpServer) injectLoss(addr net.Addr) bool {
+	if !self.faults.drop(addr) {
+		return false
+	}
+	atomic.AddUint64(&self.injectedDrops, 1)
+	return true
+}
+
+// SetOidDelay delays the responses to the requests of the OIDs under oid
+// for d, in addition to the delay of the faults, e.g. a slow table of an
+// agent. 0 removes the delay.
+func (self *UdpServer) SetOidDelay(oid Oid, d time.Duration) {
+	self.faults.mutex.Lock()
+	defer self.faults.mutex.Unlock()
+	if d <= 0 {
+		delete(self.faults.delays, oid.ToString())
+		return
+	}
+	if nil == self.faults.delays {
+		self.faults.delays = map[string]oidDelay{}
+	}
+	self.faults.delays[oid.ToString()] = oidDelay{oid: oid, delay: d}
+}
+
+// writeTo sends the response of req to addr, it is delayed or is
+// duplicated by the faults. The delayed response is sent in background,
+// Close waits for it.
+func (self *UdpServer) writeTo(conn net.PacketConn, b []byte, addr net.Addr, req PDU) error {
+	delay, duplicate := self.faults.response(addr)
+	delay += self.faults.delayOf(req)
+	if duplicate {
+		atomic.AddUint64(&self.injectedDuplicates, 1)
+	}
+	if delay <= 0 {
+		if _, err := conn.WriteTo(b, addr); nil != err {
+			return err
+		}
+		if duplicate {
+			conn.WriteTo(b, addr)
+		}
+		return nil
+	}
+
+	self.waitGroup.Add(1)
+	time.AfterFunc(delay, func() {
+		defer self.waitGroup.Done()
+		_, err := conn.WriteTo(b, addr)
+		if nil == err && duplicate {
+			_, err = conn.WriteTo(b, addr)
+		}
+		if nil != err && !errors.Is(err, net.ErrClosed) {
+			self.warnf(" failed to write the delayed response, %v", err)
+		}
+	})
+	return nil
+}
+
+// errorOf returns the error status or the exception of the OID, which are
+// answered to a GetRequest
+func (f *faultInjector) errorOf(oid Oid) (ErrorStatus, Variable) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if 0 == len(f.statuses) && 0 == len(f.exceptions) {
+		return NoError, nil
+	}
+	key := oid.ToString()
+	return f.statuses[key], f.exceptions[key]
+}
+
+func (f *faultInjector) varBindsLimit() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.maxVarBinds
+}
+
+// SetError answers the GetRequests of the OID by the error status, the
+// error index is the position of the OID in the request. The status of
+// SNMPv2 is answered by the status of SNMPv1 to a request of SNMPv1, e.g.
+// NoSuchName of NoAccess. NoError removes the error.
+func (self *UdpServer) SetError(oid Oid, status ErrorStatus) {
+	self.faults.mutex.Lock()
+	defer self.faults.mutex.Unlock()
+	if NoError == status {
+		delete(self.faults.statuses, oid.ToString())
+		return
+	}
+	if nil == self.faults.statuses {
+		self.faults.statuses = map[string]ErrorStatus{}
+	}
+	self.faults.statuses[oid.ToString()] = status
+}
+
+// SetException answers the GetRequests of the OID by the exception, e.g.
+// NoSuchObject or NoSuchInstance, which is NoSuchName for SNMPv1. nil
+// removes the exception.
+func (self *UdpServer) SetException(oid Oid, exception Variable) {
+	self.faults.mutex.Lock()
+	defer self.faults.mutex.Unlock()
+	if nil == exception {
+		delete(self.faults.exceptions, oid.ToString())
+		return
+	}
+	if nil == self.faults.exceptions {
+		self.faults.exceptions = map[string]Variable{}
+	}
+	self.faults.exceptions[oid.ToString()] = exception
+}
+
+// SetMaxVarBinds answers TooBig to the requests of more than n variable
+// bindings, it is unlimited if n is not positive
+func (self *UdpServer) SetMaxVarBinds(n int) {
+	self.faults.mutex.Lock()
+	defer self.faults.mutex.Unlock()
+	self.faults.maxVarBinds = n
+}
+
+// ClearErrors removes the errors of SetError, SetException and
+// SetMaxVarBinds
+func (self *UdpServer) ClearErrors() {
+	self.faults.mutex.Lock()
+	defer self.faults.mutex.Unlock()
+	self.faults.statuses = nil
+	self.faults.exceptions = nil
+	self.faults.maxVarBinds = 0
+}
@@ -0,0 +1,238 @@
+package snmpclient2
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// A ScalarHandler computes the value of a registered OID for the request,
+// a nil Variable is a missing OID.
+type ScalarHandler func(req PDU) (Variable, error)
+
+// A SubtreeHandler computes the values of a registered subtree. op is
+// GetRequest for the value of oid, nextOid is ignored then, or
+// GetNextRequest for the first OID after oid in the subtree, oid precedes
+// the subtree if the walk enters it. A nil Variable is a missing OID, or the
+// end of the subtree.
+type SubtreeHandler func(op PduType, oid Oid) (nextOid Oid, v Variable, err error)
+
+// The error of a handler is answered by GenError, unless it has the method
+// ErrorStatus which returns the error status to answer, e.g. PduError.
+type errorStatusCarrier interface {
+	ErrorStatus() ErrorStatus
+}
+
+type registeredOid struct {
+	oid     Oid
+	scalar  ScalarHandler
+	subtree SubtreeHandler
+}
+
+// oidHandlers are the handlers registered on an UdpServer, they are sorted
+// by the OIDs
+type oidHandlers struct {
+	mutex    sync.RWMutex
+	handlers []registeredOid
+}
+
+// register replaces the handlers by a copy, the snapshots are unchanged
+func (h *oidHandlers) register(r registeredOid) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	i := sort.Search(len(h.handlers), func(i int) bool {
+		return h.handlers[i].oid.Compare(&r.oid) >= 0
+	})
+	handlers := make([]registeredOid, 0, len(h.handlers)+1)
+	handlers = append(handlers, h.handlers[:i]...)
+	handlers = append(handlers, r)
+	if i < len(h.handlers) && h.handlers[i].oid.Equal(&r.oid) {
+		i++
+	}
+	h.handlers = append(handlers, h.handlers[i:]...)
+}
+
+func (h *oidHandlers) unregister(oid Oid) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for i := range h.handlers {
+		if h.handlers[i].oid.Equal(&oid) {
+			handlers := make([]registeredOid, 0, len(h.handlers)-1)
+			handlers = append(handlers, h.handlers[:i]...)
+			h.handlers = append(handlers, h.handlers[i+1:]...)
+			return
+		}
+	}
+}
+
+// snapshot returns the handlers, they are called without the lock so that
+// a handler is able to register
+func (h *oidHandlers) snapshot() []registeredOid {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return h.handlers
+}
+
+// Register registers the handler of a scalar OID for all the communities
+// and the contexts, the handler takes precedence over the loaded data. It
+// is safe to register while the UdpServer is serving.
+func (self *UdpServer) Register(oid Oid, handler func(req PDU) (Variable, error)) {
+	self.handlers.register(registeredOid{oid: oid, scalar: handler})
+}
+
+// RegisterSubtree registers the handler of the OIDs under base, see
+// SubtreeHandler. The OIDs of the subtree are walked in the order with the
+// loaded data, the handler takes precedence at an OID of both.
+func (self *UdpServer) RegisterSubtree(base Oid, handler func(op PduType, oid Oid) (nextOid Oid, v Variable, err error)) {
+	self.handlers.register(registeredOid{oid: base, subtree: handler})
+}
+
+// RegisterTable registers the rows of a conceptual table, see Row. The
+// rows are returned by rows for every request and may be in any order, the
+// cells are walked column by column in the order of the indexes.
+func (self *UdpServer) RegisterTable(tableOid Oid, rows func() ([]Row, error)) {
+	self.RegisterSubtree(tableOid, tableHandler(tableOid, rows))
+}
+
+// tableHandler is the SubtreeHandler of the cells tableOid.1.column.index
+func tableHandler(tableOid Oid, provider func() ([]Row, error)) SubtreeHandler {
+	entry := tableOid.AppendSubIds(1)
+	return func(op PduType, oid Oid) (Oid, Variable, error) {
+		rows, err := provider()
+		if nil != err {
+			return oid, nil, err
+		}
+
+		if GetRequest == op {
+			if len(oid.Value) <= len(entry.Value)+1 || !entry.IsPrefixOf(oid) {
+				return oid, nil, nil
+			}
+			column := oid.Value[len(entry.Value)]
+			index := NewOid(oid.Value[len(entry.Value)+1:])
+			for _, row := range rows {
+				if row.Index.Equal(&index) {
+					return oid, row.Columns[column], nil
+				}
+			}
+			return oid, nil, nil
+		}
+
+		sorted := append([]Row(nil), rows...)
+		sort.Slice(sorted, func(i, j int) bool {
+			return sorted[i].Index.Compare(&sorted[j].Index) < 0
+		})
+		var columns []int
+		seen := map[int]bool{}
+		for _, row := range sorted {
+			for column := range row.Columns {
+				if !seen[column] {
+					seen[column] = true
+					columns = append(columns, column)
+				}
+			}
+		}
+		sort.Ints(columns)
+
+		for _, column := range columns {
+			for _, row := range sorted {
+				v := row.Columns[column]
+				if nil == v {
+					continue
+				}
+				next := entry.AppendSubIds(append([]int{column}, row.Index.Value...)...)
+				if next.Compare(&oid) > 0 {
+					return next, v, nil
+				}
+			}
+		}
+		return oid, nil, nil
+	}
+}
+
+// Unregister removes the handler registered at the OID by Register,
+// RegisterSubtree or RegisterTable
+func (self *UdpServer) Unregister(oid Oid) {
+	self.handlers.unregister(oid)
+}
+
+// lookup returns the value of oid by the handlers or the mibs
+func (self *UdpServer) lookup(mibs *Tree, req PDU, oid Oid, now time.Time) (Variable, error) {
+	for _, r := range self.handlers.snapshot() {
+		if nil != r.scalar && r.oid.Equal(&oid) {
+			return r.scalar(req)
+		}
+		if nil != r.subtree && r.oid.IsPrefixOf(oid) {
+			_, v, err := r.subtree(GetRequest, oid)
+			return v, err
+		}
+	}
+	return self.getValue(mibs, oid, now), nil
+}
+
+// lookupNext returns the first OID after oid of the handlers and the mibs
+func (self *UdpServer) lookupNext(mibs *Tree, req PDU, oid Oid, now time.Time) (*Oid, Variable, error) {
+	o, v := self.getNextValue(mibs, oid, now)
+	// the mibs come first if its OID is before the registered one
+	before := func(next Oid) bool {
+		return nil != o && o.Compare(&next) < 0
+	}
+
+	for _, r := range self.handlers.snapshot() {
+		if nil != r.scalar {
+			if r.oid.Compare(&oid) <= 0 {
+				continue
+			}
+			if before(r.oid) {
+				break
+			}
+			sv, err := r.scalar(req)
+			if nil != err {
+				return nil, nil, err
+			}
+			if nil == sv {
+				continue
+			}
+			next := r.oid
+			return &next, sv, nil
+		}
+
+		if r.oid.Compare(&oid) <= 0 && !r.oid.IsPrefixOf(oid) {
+			continue
+		}
+		if before(r.oid) && !r.oid.IsPrefixOf(*o) {
+			break
+		}
+		next, sv, err := r.subtree(GetNextRequest, oid)
+		if nil != err {
+			return nil, nil, err
+		}
+		if nil == sv || next.Compare(&oid) <= 0 || !r.oid.IsPrefixOf(next) {
+			// the end of the subtree
+			continue
+		}
+		if before(next) {
+			break
+		}
+		return &next, sv, nil
+	}
+	return o, v, nil
+}
+
+// handlerErrorStatus returns the error status of the error of a handler,
+// the statuses of SNMPv2 are mapped to SNMPv1 (RFC 3584 Section 4.4)
+func handlerErrorStatus(version SnmpVersion, err error) ErrorStatus {
+	status := GenError
+	if e, ok := err.(errorStatusCarrier); ok && e.ErrorStatus() != NoError {
+		status = e.ErrorStatus()
+	}
+	if V1 != version || status <= GenError {
+		return status
+	}
+	switch status {
+	case WrongValue, WrongEncoding, WrongType, WrongLength, InconsistentValue:
+		return BadValue
+	case NoAccess, NotWritable, NoCreation, InconsistentName, AuthorizationError:
+		return NoSuchName
+	}
+	return GenError
+}
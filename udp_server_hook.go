@@ -0,0 +1,98 @@
+package snmpclient2
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A RequestHook is called for every datagram received by an UdpServer.
+// resPdu is the response or the report sent, it is nil if the request is
+// dropped, e.g. of an unknown community. decodeErr is the error of
+// a datagram which is unable to decode, reqPdu is nil then. A datagram
+// dropped before it is decoded, by SetMiss or the injected loss, has the
+// decodeErr DroppedError.
+//
+// The hook is called after the data sets are unlocked, a slow hook delays
+// the next datagram but does not block the updates of the data sets.
+type RequestHook func(src net.Addr, reqPdu PDU, resPdu PDU, decodeErr error)
+
+// DroppedError is the decodeErr of a RequestHook of a datagram dropped
+// before it is decoded
+var DroppedError = errors.New("dropped")
+
+type requestHookHolder struct {
+	hook RequestHook
+}
+
+// requestHookRef keeps the RequestHook of an UdpServer
+type requestHookRef struct {
+	value atomic.Value
+}
+
+func (r *requestHookRef) set(hook RequestHook) {
+	r.value.Store(requestHookHolder{hook})
+}
+
+func (r *requestHookRef) handler() RequestHook {
+	h, _ := r.value.Load().(requestHookHolder)
+	return h.hook
+}
+
+// SetRequestHandlerHook sets the hook which observes the requests, nil
+// removes it
+func (self *UdpServer) SetRequestHandlerHook(hook RequestHook) {
+	self.hook.set(hook)
+}
+
+// NewAccessLog returns a RequestHook which writes a line per request to w,
+// e.g.
+//
+//	2026-10-17T01:02:03.456Z 127.0.0.1:50000 GetRequest(1234) [1.3.6.1.2.1.1.1.0] -> GetResponse NoError(0) 1 bindings
+//	2026-10-17T01:02:03.457Z 127.0.0.1:50000 GetRequest(1235) [1.3.6.1.2.1.1.1.0] -> dropped
+//	2026-10-17T01:02:03.458Z 127.0.0.1:50000 dropped
+//	2026-10-17T01:02:03.459Z 127.0.0.1:50000 decode error - Invalid MessageV3 object ...
+func NewAccessLog(w io.Writer) RequestHook {
+	var mutex sync.Mutex
+	return func(src net.Addr, reqPdu PDU, resPdu PDU, decodeErr error) {
+		var line bytes.Buffer
+		line.WriteString(time.Now().UTC().Format("2006-01-02T15:04:05.000Z07:00"))
+		line.WriteString(" ")
+		if nil != src {
+			line.WriteString(src.String())
+		} else {
+			line.WriteString("-")
+		}
+
+		if nil == reqPdu && DroppedError == decodeErr {
+			line.WriteString(" dropped")
+		} else if nil == reqPdu {
+			fmt.Fprintf(&line, " decode error - %v", decodeErr)
+		} else {
+			fmt.Fprintf(&line, " %s(%d) [", reqPdu.PduType(), reqPdu.RequestId())
+			for i, vb := range reqPdu.VariableBindings() {
+				if i > 0 {
+					line.WriteString(" ")
+				}
+				line.WriteString(vb.Oid.ToString())
+			}
+			line.WriteString("] -> ")
+			if nil == resPdu {
+				line.WriteString("dropped")
+			} else {
+				fmt.Fprintf(&line, "%s %s(%d) %d bindings", resPdu.PduType(),
+					resPdu.ErrorStatus(), resPdu.ErrorIndex(), len(resPdu.VariableBindings()))
+			}
+		}
+		line.WriteString("\n")
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		w.Write(line.Bytes())
+	}
+}
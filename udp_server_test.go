@@ -0,0 +1,1329 @@
+package snmpclient2_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/runner-mei/snmpclient2"
+)
+
+const v3Mibs = `iso.3.6.1.2.1.1.1.0 = STRING: "USM agent"
+iso.3.6.1.2.1.1.5.0 = STRING: "simulator"`
+
+func newV3Server(t *testing.T) *snmpclient2.UdpServer {
+	srv, err := snmpclient2.NewUdpServerFromString("v3", "127.0.0.1:0", v3Mibs, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.SetEngineId([]byte{0x80, 0x00, 0x1f, 0x88, 0x04, 's', 'i', 'm'})
+	srv.SetEngineBootsTime(3, 100)
+	for _, user := range []snmpclient2.UsmUser{
+		{UserName: "noAuth"},
+		{UserName: "md5", AuthProtocol: snmpclient2.Md5, AuthPassword: "md5-password"},
+		{UserName: "shaDes", AuthProtocol: snmpclient2.Sha, AuthPassword: "sha-password",
+			PrivProtocol: snmpclient2.Des, PrivPassword: "des-password"},
+		{UserName: "shaAes", AuthProtocol: snmpclient2.Sha, AuthPassword: "sha-password",
+			PrivProtocol: snmpclient2.Aes, PrivPassword: "aes-password"},
+		{UserName: "sha224", AuthProtocol: snmpclient2.Sha224, AuthPassword: "sha-password"},
+		{UserName: "sha256Aes", AuthProtocol: snmpclient2.Sha256, AuthPassword: "sha-password",
+			PrivProtocol: snmpclient2.Aes, PrivPassword: "aes-password"},
+		{UserName: "sha384Des", AuthProtocol: snmpclient2.Sha384, AuthPassword: "sha-password",
+			PrivProtocol: snmpclient2.Des, PrivPassword: "des-password"},
+		{UserName: "sha512Aes", AuthProtocol: snmpclient2.Sha512, AuthPassword: "sha-password",
+			PrivProtocol: snmpclient2.Aes, PrivPassword: "aes-password"},
+		{UserName: "md5TripleDes", AuthProtocol: snmpclient2.Md5, AuthPassword: "md5-password",
+			PrivProtocol: snmpclient2.TripleDes, PrivPassword: "3des-password"},
+		{UserName: "shaTripleDes", AuthProtocol: snmpclient2.Sha, AuthPassword: "sha-password",
+			PrivProtocol: snmpclient2.TripleDes, PrivPassword: "3des-password"},
+	} {
+		if err = srv.AddUser(user); err != nil {
+			t.Fatalf("AddUser() - has error %v", err)
+		}
+	}
+	return srv
+}
+
+func v3Arguments(user snmpclient2.UsmUser) snmpclient2.Arguments {
+	args := snmpclient2.Arguments{
+		Version:      snmpclient2.V3,
+		Timeout:      time.Second,
+		UserName:     user.UserName,
+		AuthProtocol: user.AuthProtocol,
+		AuthPassword: user.AuthPassword,
+		PrivProtocol: user.PrivProtocol,
+		PrivPassword: user.PrivPassword,
+	}
+	if user.AuthPassword != "" {
+		args.SecurityLevel = snmpclient2.AuthNoPriv
+	}
+	if user.PrivPassword != "" {
+		args.SecurityLevel = snmpclient2.AuthPriv
+	}
+	return args
+}
+
+func TestUdpServerV3(t *testing.T) {
+	srv := newV3Server(t)
+	defer srv.Close()
+
+	oids, _ := snmpclient2.NewOids([]string{"1.3.6.1.2.1.1.1.0"})
+	for _, user := range []snmpclient2.UsmUser{
+		{UserName: "noAuth"},
+		{UserName: "md5", AuthProtocol: snmpclient2.Md5, AuthPassword: "md5-password"},
+		{UserName: "shaDes", AuthProtocol: snmpclient2.Sha, AuthPassword: "sha-password",
+			PrivProtocol: snmpclient2.Des, PrivPassword: "des-password"},
+		{UserName: "shaAes", AuthProtocol: snmpclient2.Sha, AuthPassword: "sha-password",
+			PrivProtocol: snmpclient2.Aes, PrivPassword: "aes-password"},
+		{UserName: "sha224", AuthProtocol: snmpclient2.Sha224, AuthPassword: "sha-password"},
+		{UserName: "sha256Aes", AuthProtocol: snmpclient2.Sha256, AuthPassword: "sha-password",
+			PrivProtocol: snmpclient2.Aes, PrivPassword: "aes-password"},
+		{UserName: "sha384Des", AuthProtocol: snmpclient2.Sha384, AuthPassword: "sha-password",
+			PrivProtocol: snmpclient2.Des, PrivPassword: "des-password"},
+		{UserName: "sha512Aes", AuthProtocol: snmpclient2.Sha512, AuthPassword: "sha-password",
+			PrivProtocol: snmpclient2.Aes, PrivPassword: "aes-password"},
+		{UserName: "md5TripleDes", AuthProtocol: snmpclient2.Md5, AuthPassword: "md5-password",
+			PrivProtocol: snmpclient2.TripleDes, PrivPassword: "3des-password"},
+		{UserName: "shaTripleDes", AuthProtocol: snmpclient2.Sha, AuthPassword: "sha-password",
+			PrivProtocol: snmpclient2.TripleDes, PrivPassword: "3des-password"},
+	} {
+		var discovered []byte
+		var boots int32
+		args := v3Arguments(user)
+		args.OnEngineDiscovered = func(address string, engineId []byte, engineBoots, engineTime int32) {
+			discovered, boots = engineId, engineBoots
+		}
+		snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:"+srv.GetPort(), args)
+
+		pdu, err := snmp.GetRequest(oids)
+		if err != nil {
+			t.Errorf("GetRequest(%s) - has error %v", user.UserName, err)
+			snmp.Close()
+			continue
+		}
+		if vb := pdu.VariableBindings().MatchOid(oids[0]); vb == nil || string(vb.Variable.Bytes()) != "USM agent" {
+			t.Errorf("GetRequest(%s) - expected [%s], actual [%v]", user.UserName, "USM agent", pdu)
+		}
+		if !bytes.Equal(discovered, srv.EngineId()) || boots != 3 {
+			t.Errorf("GetRequest(%s) - expected engine [%x/3], actual [%x/%d]",
+				user.UserName, srv.EngineId(), discovered, boots)
+		}
+		snmp.Close()
+	}
+}
+
+func TestUdpServerV3Reports(t *testing.T) {
+	srv := newV3Server(t)
+	defer srv.Close()
+
+	oids, _ := snmpclient2.NewOids([]string{"1.3.6.1.2.1.1.1.0"})
+	for _, test := range []struct {
+		user   snmpclient2.UsmUser
+		report string
+	}{
+		{snmpclient2.UsmUser{UserName: "nobody"}, "1.3.6.1.6.3.15.1.1.3.0"},
+		{snmpclient2.UsmUser{UserName: "noAuth", AuthProtocol: snmpclient2.Md5,
+			AuthPassword: "md5-password"}, "1.3.6.1.6.3.15.1.1.1.0"},
+		{snmpclient2.UsmUser{UserName: "md5", AuthProtocol: snmpclient2.Md5,
+			AuthPassword: "wrong-password"}, "1.3.6.1.6.3.15.1.1.5.0"},
+		// the level of the message is the one of the user
+		{snmpclient2.UsmUser{UserName: "shaAes"}, "1.3.6.1.6.3.15.1.1.1.0"},
+		{snmpclient2.UsmUser{UserName: "shaAes", AuthProtocol: snmpclient2.Sha,
+			AuthPassword: "sha-password"}, "1.3.6.1.6.3.15.1.1.1.0"},
+	} {
+		snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:"+srv.GetPort(), v3Arguments(test.user))
+		_, err := snmp.GetRequest(oids)
+		snmp.Close()
+
+		e, ok := err.(snmpclient2.ResponseError)
+		if !ok || e.Report != test.report {
+			t.Errorf("GetRequest(%s) - expected report [%s], actual [%v]", test.user.UserName, test.report, err)
+		}
+	}
+
+	sysName, _ := snmpclient2.ParseOidFromString("1.3.6.1.2.1.1.5.0")
+	snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:"+srv.GetPort(), v3Arguments(snmpclient2.UsmUser{UserName: "shaAes"}))
+	_, err := snmp.SetRequest(snmpclient2.VariableBindings{
+		{Oid: sysName, Variable: snmpclient2.NewOctetString([]byte("pwned"))}})
+	snmp.Close()
+	if e, ok := err.(snmpclient2.ResponseError); !ok || e.Report != "1.3.6.1.6.3.15.1.1.1.0" {
+		t.Errorf("SetRequest(shaAes) - expected report [1.3.6.1.6.3.15.1.1.1.0], actual [%v]", err)
+	}
+	snmp, _ = snmpclient2.NewSNMP("udp", "127.0.0.1:"+srv.GetPort(), v3Arguments(snmpclient2.UsmUser{UserName: "shaAes",
+		AuthProtocol: snmpclient2.Sha, AuthPassword: "sha-password", PrivProtocol: snmpclient2.Aes, PrivPassword: "aes-password"}))
+	defer snmp.Close()
+	pdu, err := snmp.GetRequest(snmpclient2.Oids{sysName})
+	if err != nil {
+		t.Fatalf("GetRequest() - has error %v", err)
+	}
+	if vb := pdu.VariableBindings().MatchOid(sysName); vb == nil || string(vb.Variable.Bytes()) != "simulator" {
+		t.Errorf("GetRequest() - expected [%s], actual [%v]", "simulator", pdu)
+	}
+}
+
+func TestUdpServerV3Reboot(t *testing.T) {
+	srv := newV3Server(t)
+	defer srv.Close()
+
+	args := v3Arguments(snmpclient2.UsmUser{UserName: "md5",
+		AuthProtocol: snmpclient2.Md5, AuthPassword: "md5-password"})
+	args.Retries = 1
+	snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:"+srv.GetPort(), args)
+	defer snmp.Close()
+
+	oids, _ := snmpclient2.NewOids([]string{"1.3.6.1.2.1.1.5.0"})
+	if _, err := snmp.GetRequest(oids); err != nil {
+		t.Fatalf("GetRequest() - has error %v", err)
+	}
+
+	// the request is out of the time window after the reboot, the client
+	// synchronizes by the report and retries
+	srv.SetEngineBootsTime(4, 0)
+	pdu, err := snmp.GetRequest(oids)
+	if err != nil {
+		t.Fatalf("GetRequest() - has error %v", err)
+	}
+	if vb := pdu.VariableBindings().MatchOid(oids[0]); vb == nil || string(vb.Variable.Bytes()) != "simulator" {
+		t.Errorf("GetRequest() - expected [%s], actual [%v]", "simulator", pdu)
+	}
+}
+
+func TestUdpServerV3TimeWindowResync(t *testing.T) {
+	srv := newV3Server(t)
+	defer srv.Close()
+
+	oids, _ := snmpclient2.NewOids([]string{"1.3.6.1.2.1.1.5.0"})
+	for _, disabled := range []bool{false, true} {
+		args := v3Arguments(snmpclient2.UsmUser{UserName: "md5",
+			AuthProtocol: snmpclient2.Md5, AuthPassword: "md5-password"})
+		args.DisableTimeWindowResync = disabled
+		snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:"+srv.GetPort(), args)
+		if _, err := snmp.GetRequest(oids); err != nil {
+			t.Fatalf("GetRequest() - has error %v", err)
+		}
+
+		// the request is out of the time window after the reboot
+		boots, _ := srv.EngineBootsTime()
+		srv.SetEngineBootsTime(boots+1, 0)
+		pdu, err := snmp.GetRequest(oids)
+		snmp.Close()
+		if disabled {
+			if e, ok := err.(snmpclient2.ResponseError); !ok || e.Report != "1.3.6.1.6.3.15.1.1.2.0" {
+				t.Errorf("GetRequest() - expected the notInTimeWindows report, actual [%v]", err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("GetRequest() - has error %v", err)
+		}
+		if vb := pdu.VariableBindings().MatchOid(oids[0]); vb == nil || string(vb.Variable.Bytes()) != "simulator" {
+			t.Errorf("GetRequest() - expected [%s], actual [%v]", "simulator", pdu)
+		}
+	}
+}
+
+func TestUdpServerContexts(t *testing.T) {
+	srv := newV3Server(t)
+	defer srv.Close()
+	if err := srv.LoadContextFromString("switch", `iso.3.6.1.2.1.1.1.0 = STRING: "Switch"`); err != nil {
+		t.Fatal(err)
+	}
+
+	sysDescr := snmpclient2.MustParseOids("1.3.6.1.2.1.1.1.0")
+	get := func(args snmpclient2.Arguments) string {
+		snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:"+srv.GetPort(), args)
+		defer snmp.Close()
+		pdu, err := snmp.GetRequest(sysDescr)
+		if err != nil {
+			t.Fatalf("GetRequest() - has error %v", err)
+		}
+		return pdu.VariableBindings()[0].AsString()
+	}
+
+	for _, test := range []struct {
+		contextName string
+		expected    string
+	}{
+		{"switch", "Switch"},
+		{"", "USM agent"},
+		{"unknown", "USM agent"},
+	} {
+		args := v3Arguments(snmpclient2.UsmUser{UserName: "noAuth"})
+		args.ContextName = test.contextName
+		if actual := get(args); actual != test.expected {
+			t.Errorf("GetRequest(%s) - expected [%s], actual [%s]", test.contextName, test.expected, actual)
+		}
+	}
+	// the community of the same data set
+	if actual := get(snmpclient2.Arguments{Version: snmpclient2.V2c, Community: "switch", Timeout: time.Second}); actual != "Switch" {
+		t.Errorf("GetRequest(switch) - expected [Switch], actual [%s]", actual)
+	}
+}
+
+func TestUdpServerV3Notifications(t *testing.T) {
+	srv := newV3Server(t)
+	defer srv.Close()
+	received := make(chan snmpclient2.PDU, 10)
+	srv.SetTrapHandler(func(src net.Addr, pdu snmpclient2.PDU) {
+		received <- pdu
+	})
+
+	vbs := snmpclient2.VariableBindings{{Oid: snmpclient2.OidSysUpTime, Variable: snmpclient2.NewTimeTicks(100)}}
+	for _, user := range []snmpclient2.UsmUser{
+		{UserName: "noAuth"},
+		{UserName: "md5", AuthProtocol: snmpclient2.Md5, AuthPassword: "md5-password"},
+		{UserName: "shaAes", AuthProtocol: snmpclient2.Sha, AuthPassword: "sha-password",
+			PrivProtocol: snmpclient2.Aes, PrivPassword: "aes-password"},
+	} {
+		// the receiver of the InformRequest is discovered
+		snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:"+srv.GetPort(), v3Arguments(user))
+		if err := snmp.InformRequest(vbs); err != nil {
+			t.Errorf("InformRequest(%s) - has error %v", user.UserName, err)
+		}
+		if err := snmp.V2Trap(vbs); err == nil {
+			t.Errorf("V2Trap(%s) - expected an error without SecurityEngineId", user.UserName)
+		}
+		snmp.Close()
+
+		// the sender of the trap is authoritative
+		args := v3Arguments(user)
+		args.SecurityEngineId = "80001f88046c6f63616c"
+		snmp, _ = snmpclient2.NewSNMP("udp", "127.0.0.1:"+srv.GetPort(), args)
+		if err := snmp.V2Trap(vbs); err != nil {
+			t.Errorf("V2Trap(%s) - has error %v", user.UserName, err)
+		}
+		snmp.Close()
+
+		select {
+		case pdu := <-received:
+			if pdu.PduType() != snmpclient2.SNMPTrapV2 || pdu.VariableBindings().MatchOid(snmpclient2.OidSysUpTime) == nil {
+				t.Errorf("TrapHandler(%s) - unexpected %s", user.UserName, pdu)
+			}
+			if p := pdu.(*snmpclient2.ScopedPdu); string(p.ContextEngineId) != "\x80\x00\x1f\x88\x04local" {
+				t.Errorf("TrapHandler(%s) - unexpected ContextEngineId [%x]", user.UserName, p.ContextEngineId)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("TrapHandler(%s) - the trap is not received", user.UserName)
+		}
+	}
+}
+
+func TestUdpServerV3EngineConfig(t *testing.T) {
+	srv := newV3Server(t)
+	defer srv.Close()
+	received := make(chan snmpclient2.PDU, 10)
+	srv.SetTrapHandler(func(src net.Addr, pdu snmpclient2.PDU) {
+		received <- pdu
+	})
+	dir, err := ioutil.TempDir("", "snmp-engine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "engine")
+
+	if _, err = snmpclient2.LoadEngineConfig("", file); err == nil {
+		t.Error("LoadEngineConfig() - expected an error without the engine ID")
+	}
+	// the boots are incremented by each restart
+	var config *snmpclient2.EngineConfig
+	for i, engineId := range []string{"80001f88046c6f63616c", ""} {
+		if config, err = snmpclient2.LoadEngineConfig(engineId, file); err != nil {
+			t.Fatalf("LoadEngineConfig(%d) - has error %v", i, err)
+		}
+		if boots, _, _ := config.EngineBootsTime(); boots != int64(i+1) {
+			t.Errorf("EngineBootsTime(%d) - expected [%d], actual [%d]", i, i+1, boots)
+		}
+	}
+	if engineId, boots, err := (snmpclient2.FileEngineStore{Path: file}).Load(); err != nil ||
+		string(engineId) != "\x80\x00\x1f\x88\x04local" || boots != 2 {
+		t.Errorf("Load() - unexpected [%x] [%d] %v", engineId, boots, err)
+	}
+
+	args := v3Arguments(snmpclient2.UsmUser{UserName: "md5", AuthProtocol: snmpclient2.Md5, AuthPassword: "md5-password"})
+	args.EngineConfig = config
+	snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:"+srv.GetPort(), args)
+	defer snmp.Close()
+	vbs := snmpclient2.VariableBindings{{Oid: snmpclient2.OidSysUpTime, Variable: snmpclient2.NewTimeTicks(100)}}
+	if err = snmp.V2Trap(vbs); err != nil {
+		t.Fatalf("V2Trap() - has error %v", err)
+	}
+	select {
+	case pdu := <-received:
+		if p := pdu.(*snmpclient2.ScopedPdu); string(p.ContextEngineId) != "\x80\x00\x1f\x88\x04local" {
+			t.Errorf("TrapHandler - unexpected ContextEngineId [%x]", p.ContextEngineId)
+		}
+	case <-time.After(time.Second):
+		t.Error("TrapHandler - the trap is not received")
+	}
+}
+
+func TestUdpServerSet(t *testing.T) {
+	srv, err := snmpclient2.NewUdpServerFromString("set", "127.0.0.1:0", v3Mibs, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	sysName, _ := snmpclient2.ParseOidFromString("1.3.6.1.2.1.1.5.0")
+	missing, _ := snmpclient2.ParseOidFromString("1.3.6.1.2.1.1.6.0")
+	set := func(version snmpclient2.SnmpVersion, vbs snmpclient2.VariableBindings) snmpclient2.PDU {
+		snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:"+srv.GetPort(), snmpclient2.Arguments{
+			Version:   version,
+			Community: "public",
+			Timeout:   time.Second,
+		})
+		defer snmp.Close()
+		pdu, err := snmp.SetRequest(vbs)
+		if pdu == nil {
+			t.Fatalf("SetRequest() - has error %v", err)
+		}
+		if (err != nil) != (pdu.ErrorStatus() != snmpclient2.NoError) {
+			t.Errorf("SetRequest() - expected the error of [%v], actual [%v]", pdu.ErrorStatus(), err)
+		}
+		return pdu
+	}
+
+	// the reads keep going during the writes
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:"+srv.GetPort(), snmpclient2.Arguments{
+			Version:   snmpclient2.V2c,
+			Community: "public",
+			Timeout:   time.Second,
+		})
+		defer snmp.Close()
+		for i := 0; i < 20; i++ {
+			if _, err := snmp.GetRequest(snmpclient2.Oids{sysName}); err != nil {
+				t.Errorf("GetRequest() - has error %v", err)
+				return
+			}
+		}
+	}()
+
+	for _, test := range []struct {
+		version snmpclient2.SnmpVersion
+		vbs     snmpclient2.VariableBindings
+		status  snmpclient2.ErrorStatus
+		index   int
+	}{
+		{snmpclient2.V2c, snmpclient2.VariableBindings{
+			{Oid: sysName, Variable: snmpclient2.NewOctetString([]byte("renamed"))}}, snmpclient2.NoError, 0},
+		{snmpclient2.V2c, snmpclient2.VariableBindings{
+			{Oid: sysName, Variable: snmpclient2.NewOctetString([]byte("again"))},
+			{Oid: missing, Variable: snmpclient2.NewOctetString([]byte("x"))}}, snmpclient2.NotWritable, 2},
+		{snmpclient2.V2c, snmpclient2.VariableBindings{
+			{Oid: sysName, Variable: snmpclient2.NewInteger(1)}}, snmpclient2.WrongType, 1},
+		{snmpclient2.V1, snmpclient2.VariableBindings{
+			{Oid: missing, Variable: snmpclient2.NewOctetString([]byte("x"))}}, snmpclient2.NoSuchName, 1},
+		{snmpclient2.V1, snmpclient2.VariableBindings{
+			{Oid: sysName, Variable: snmpclient2.NewInteger(1)}}, snmpclient2.BadValue, 1},
+	} {
+		pdu := set(test.version, test.vbs)
+		if pdu.ErrorStatus() != test.status || pdu.ErrorIndex() != test.index {
+			t.Errorf("SetRequest(%v) - expected [%v/%d], actual [%v/%d]",
+				test.vbs, test.status, test.index, pdu.ErrorStatus(), pdu.ErrorIndex())
+		}
+	}
+	<-done
+
+	srv.SetNoAccess(snmpclient2.MustParseOidFromString("1.3.6.1.2.1.1.1"))
+	for version, expected := range map[snmpclient2.SnmpVersion]snmpclient2.ErrorStatus{
+		snmpclient2.V2c: snmpclient2.NoAccess,
+		snmpclient2.V1:  snmpclient2.NoSuchName,
+	} {
+		pdu := set(version, snmpclient2.VariableBindings{
+			{Oid: snmpclient2.MustParseOidFromString("1.3.6.1.2.1.1.1.0"), Variable: snmpclient2.NewOctetString([]byte("x"))}})
+		if pdu.ErrorStatus() != expected || pdu.ErrorIndex() != 1 {
+			t.Errorf("SetRequest(%v) - expected [%v/1], actual [%v/%d]", version, expected, pdu.ErrorStatus(), pdu.ErrorIndex())
+		}
+	}
+
+	srv.SetReadOnly(true)
+	pdu := set(snmpclient2.V2c, snmpclient2.VariableBindings{
+		{Oid: sysName, Variable: snmpclient2.NewOctetString([]byte("read only"))}})
+	if pdu.ErrorStatus() != snmpclient2.NotWritable {
+		t.Errorf("SetRequest() - expected [%v], actual [%v]", snmpclient2.NotWritable, pdu.ErrorStatus())
+	}
+
+	// the failed requests change nothing
+	snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:"+srv.GetPort(), snmpclient2.Arguments{
+		Version:   snmpclient2.V2c,
+		Community: "public",
+		Timeout:   time.Second,
+	})
+	defer snmp.Close()
+	pdu, err = snmp.GetRequest(snmpclient2.Oids{sysName})
+	if err != nil {
+		t.Fatalf("GetRequest() - has error %v", err)
+	}
+	if vb := pdu.VariableBindings().MatchOid(sysName); vb == nil || string(vb.Variable.Bytes()) != "renamed" {
+		t.Errorf("GetRequest() - expected [%s], actual [%v]", "renamed", pdu)
+	}
+}
+
+func TestUdpServerGetBulk(t *testing.T) {
+	mibs := `iso.3.6.1.2.1.1.1.0 = STRING: "sysDescr"
+iso.3.6.1.2.1.1.5.0 = STRING: "sysName"
+iso.3.6.1.2.1.2.2.1.2.1 = STRING: "eth0"
+iso.3.6.1.2.1.2.2.1.2.2 = STRING: "eth1"
+iso.3.6.1.2.1.2.2.1.2.3 = STRING: "eth2"
+iso.3.6.1.2.1.2.2.1.10.1 = Counter32: 1
+iso.3.6.1.2.1.2.2.1.10.2 = Counter32: 2
+iso.3.6.1.2.1.2.2.1.10.3 = Counter32: 3`
+	srv, err := snmpclient2.NewUdpServerFromString("bulk", "127.0.0.1:0", mibs, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:"+srv.GetPort(), snmpclient2.Arguments{
+		Version:   snmpclient2.V2c,
+		Community: "public",
+		Timeout:   time.Second,
+	})
+	defer snmp.Close()
+
+	for _, test := range []struct {
+		oids           []string
+		nonRepeaters   int
+		maxRepetitions int
+		expected       []string
+	}{
+		{[]string{"1.3.6.1.2.1.1", "1.3.6.1.2.1.2.2.1.2", "1.3.6.1.2.1.2.2.1.10"}, 1, 3, []string{
+			"1.3.6.1.2.1.1.1.0",
+			"1.3.6.1.2.1.2.2.1.2.1", "1.3.6.1.2.1.2.2.1.10.1",
+			"1.3.6.1.2.1.2.2.1.2.2", "1.3.6.1.2.1.2.2.1.10.2",
+			"1.3.6.1.2.1.2.2.1.2.3", "1.3.6.1.2.1.2.2.1.10.3"}},
+		{[]string{"1.3.6.1.2.1.2.2.1.10.2"}, 0, 4, []string{
+			"1.3.6.1.2.1.2.2.1.10.3", "1.3.6.1.2.1.2.2.1.10.3"}},
+		{[]string{"1.3.6.1.2.1.2.2.1.10.3", "1.3.6.1.2.1.1.1.0"}, 0, 3, []string{
+			"1.3.6.1.2.1.2.2.1.10.3", "1.3.6.1.2.1.1.5.0",
+			"1.3.6.1.2.1.2.2.1.10.3", "1.3.6.1.2.1.2.2.1.2.1",
+			"1.3.6.1.2.1.2.2.1.10.3", "1.3.6.1.2.1.2.2.1.2.2"}},
+	} {
+		oids, _ := snmpclient2.NewOids(test.oids)
+		pdu, err := snmp.GetBulkRequest(oids, test.nonRepeaters, test.maxRepetitions)
+		if err != nil {
+			t.Errorf("GetBulkRequest(%v) - has error %v", test.oids, err)
+			continue
+		}
+		var actual []string
+		for _, vb := range pdu.VariableBindings() {
+			actual = append(actual, vb.Oid.ToString())
+		}
+		if strings.Join(actual, ",") != strings.Join(test.expected, ",") {
+			t.Errorf("GetBulkRequest(%v) - expected [%v], actual [%v]", test.oids, test.expected, actual)
+		}
+	}
+
+	// the variable after the last one is EndOfMibView
+	oids, _ := snmpclient2.NewOids([]string{"1.3.6.1.2.1.2.2.1.10.2"})
+	pdu, _ := snmp.GetBulkRequest(oids, 0, 4)
+	if vbs := pdu.VariableBindings(); len(vbs) != 2 || vbs[1].Variable.Syntex() != snmpclient2.NewEndOfMibView().Syntex() {
+		t.Errorf("GetBulkRequest() - expected EndOfMibView, actual [%v]", vbs)
+	}
+}
+
+func TestUdpServerGetBulkMaxSize(t *testing.T) {
+	var mibs []string
+	for i := 1; i <= 50; i++ {
+		mibs = append(mibs, fmt.Sprintf(`iso.3.6.1.2.1.2.2.1.2.%d = STRING: "%s"`, i, strings.Repeat("x", 40)))
+	}
+	srv, err := snmpclient2.NewUdpServerFromString("bulk", "127.0.0.1:0", strings.Join(mibs, "\n"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	srv.AddUser(snmpclient2.UsmUser{UserName: "noAuth"})
+
+	snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:"+srv.GetPort(), snmpclient2.Arguments{
+		Version:        snmpclient2.V3,
+		UserName:       "noAuth",
+		Timeout:        time.Second,
+		MessageMaxSize: 484,
+	})
+	defer snmp.Close()
+
+	oids, _ := snmpclient2.NewOids([]string{"1.3.6.1.2.1.2.2.1.2", "1.3.6.1.2.1.2.2.1.2.25"})
+	pdu, err := snmp.GetBulkRequest(oids, 0, 20)
+	if err != nil {
+		t.Fatalf("GetBulkRequest() - has error %v", err)
+	}
+	vbs := pdu.VariableBindings()
+	if len(vbs) == 0 || len(vbs) >= 40 || len(vbs)%2 != 0 {
+		t.Errorf("GetBulkRequest() - expected whole rows less than 20, actual [%d]", len(vbs))
+	}
+	b, _ := pdu.Marshal()
+	if len(b) > 484 {
+		t.Errorf("GetBulkRequest() - expected less than 484 octets, actual [%d]", len(b))
+	}
+}
+
+func TestUdpServerCommunities(t *testing.T) {
+	srv, err := snmpclient2.NewUdpServer("communities", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	if err = srv.LoadCommunityFromString("cisco-sw1", `iso.3.6.1.2.1.1.1.0 = STRING: "Cisco IOS"`); err != nil {
+		t.Fatal(err)
+	}
+	if err = srv.LoadCommunityFromString("juniper-r1", `iso.3.6.1.2.1.1.1.0 = STRING: "JUNOS"`); err != nil {
+		t.Fatal(err)
+	}
+
+	sysDescr, _ := snmpclient2.ParseOidFromString("1.3.6.1.2.1.1.1.0")
+	get := func(community string) (snmpclient2.PDU, error) {
+		snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:"+srv.GetPort(), snmpclient2.Arguments{
+			Version:   snmpclient2.V2c,
+			Community: community,
+			Timeout:   200 * time.Millisecond,
+		})
+		defer snmp.Close()
+		return snmp.GetRequest(snmpclient2.Oids{sysDescr})
+	}
+
+	for community, expected := range map[string]string{"cisco-sw1": "Cisco IOS", "juniper-r1": "JUNOS"} {
+		pdu, err := get(community)
+		if err != nil {
+			t.Errorf("GetRequest(%s) - has error %v", community, err)
+			continue
+		}
+		if vb := pdu.VariableBindings().MatchOid(sysDescr); vb == nil || string(vb.Variable.Bytes()) != expected {
+			t.Errorf("GetRequest(%s) - expected [%s], actual [%v]", community, expected, pdu)
+		}
+	}
+
+	if _, err = get("public"); err == nil {
+		t.Error("GetRequest(public) - expected a timeout")
+	}
+	if srv.Rejected() != 1 {
+		t.Errorf("Rejected() - expected [1], actual [%d]", srv.Rejected())
+	}
+
+	srv.ReturnErrorIfCommunityUnknown(true)
+	pdu, err := get("public")
+	if err != nil {
+		t.Fatalf("GetRequest(public) - has error %v", err)
+	}
+	if pdu.ErrorStatus() != snmpclient2.AuthorizationError {
+		t.Errorf("GetRequest(public) - expected [%v], actual [%v]", snmpclient2.AuthorizationError, pdu.ErrorStatus())
+	}
+	if srv.Rejected() != 2 {
+		t.Errorf("Rejected() - expected [2], actual [%d]", srv.Rejected())
+	}
+}
+
+func TestUdpServerReload(t *testing.T) {
+	srv, err := snmpclient2.NewUdpServerFromString("reload", "127.0.0.1:0", `iso.3.6.1.2.1.1.5.0 = STRING: "v0"`, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	port := srv.GetPort()
+
+	sysName, _ := snmpclient2.ParseOidFromString("1.3.6.1.2.1.1.5.0")
+	snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:"+port, snmpclient2.Arguments{
+		Version:   snmpclient2.V2c,
+		Community: "public",
+		Timeout:   time.Second,
+	})
+	defer snmp.Close()
+
+	// poll during the reloads, no request is lost
+	stop := make(chan struct{})
+	done := make(chan int)
+	go func() {
+		polls := 0
+		defer func() { done <- polls }()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			pdu, err := snmp.GetRequest(snmpclient2.Oids{sysName})
+			if err != nil {
+				t.Errorf("GetRequest() - has error %v", err)
+				return
+			}
+			if vb := pdu.VariableBindings().MatchOid(sysName); vb == nil {
+				t.Errorf("GetRequest() - expected [%s], actual [%v]", sysName.ToString(), pdu)
+				return
+			}
+			polls++
+		}
+	}()
+
+	for i := 1; i <= 20; i++ {
+		err := srv.ReloadFromReader(strings.NewReader(fmt.Sprintf(`iso.3.6.1.2.1.1.5.0 = STRING: "v%d"`, i)))
+		if err != nil {
+			t.Fatalf("ReloadFromReader() - has error %v", err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(stop)
+	if polls := <-done; polls == 0 {
+		t.Error("GetRequest() - no request is served")
+	}
+
+	// the old data is kept after a parse error
+	err = srv.ReloadFromReader(strings.NewReader(".1.3.6.1.2.1.1.5.0 = STRING: \"broken\"\ngarbage\n"))
+	if err == nil {
+		t.Error("ReloadFromReader() - expected an error")
+	}
+	pdu, err := snmp.GetRequest(snmpclient2.Oids{sysName})
+	if err != nil {
+		t.Fatalf("GetRequest() - has error %v", err)
+	}
+	if vb := pdu.VariableBindings().MatchOid(sysName); vb == nil || string(vb.Variable.Bytes()) != "v20" {
+		t.Errorf("GetRequest() - expected [%s], actual [%v]", "v20", pdu)
+	}
+	if srv.GetPort() != port {
+		t.Errorf("GetPort() - expected [%s], actual [%s]", port, srv.GetPort())
+	}
+}
+
+func TestUdpServerIPv6(t *testing.T) {
+	srv, err := snmpclient2.NewUdpServerFromString("v6", "[::1]:0", `iso.3.6.1.2.1.1.1.0 = STRING: "IPv6 agent"
+iso.3.6.1.2.1.2.2.1.1.1 = INTEGER: 1
+iso.3.6.1.2.1.2.2.1.1.2 = INTEGER: 2`, false)
+	if err != nil {
+		t.Skipf("IPv6 is unavailable - %v", err)
+	}
+	defer srv.Close()
+
+	for address, expected := range map[string]string{
+		"::1":               "[::1]:161",
+		"fe80::1%eth0":      "[fe80::1%eth0]:161",
+		"2001:db8::1:16100": "[2001:db8::1]:16100",
+		"[::1]:1161":        "[::1]:1161",
+	} {
+		snmp, err := snmpclient2.NewSNMP("udp", address, snmpclient2.Arguments{Version: snmpclient2.V2c})
+		if err != nil {
+			t.Errorf("NewSNMP(%s) - has error %v", address, err)
+		} else if snmp.Address != expected {
+			t.Errorf("NewSNMP(%s) - expected [%s], actual [%s]", address, expected, snmp.Address)
+		}
+	}
+	if _, err = snmpclient2.NewSNMP("udp", "2001:db8::x:161", snmpclient2.Arguments{Version: snmpclient2.V2c}); err == nil {
+		t.Error("NewSNMP() - expected an error of the invalid IPv6 address")
+	}
+
+	snmp, _ := snmpclient2.NewSNMP("udp", "[::1]:"+srv.GetPort(), snmpclient2.Arguments{
+		Version: snmpclient2.V2c, Community: "public", Timeout: time.Second})
+	defer snmp.Close()
+	pdu, err := snmp.GetRequest(snmpclient2.MustParseOids("1.3.6.1.2.1.1.1.0"))
+	if err != nil {
+		t.Fatalf("GetRequest() - has error %v", err)
+	}
+	if vb := pdu.VariableBindings().MatchOid(snmpclient2.MustParseOidFromString("1.3.6.1.2.1.1.1.0")); vb == nil || vb.AsString() != "IPv6 agent" {
+		t.Errorf("GetRequest() - expected [IPv6 agent], actual %s", pdu)
+	}
+	pdu, err = snmp.GetBulkWalk(snmpclient2.MustParseOids("1.3.6.1.2.1.2.2.1.1"), 0, 10)
+	if err != nil {
+		t.Fatalf("GetBulkWalk() - has error %v", err)
+	}
+	if len(pdu.VariableBindings()) != 2 {
+		t.Errorf("GetBulkWalk() - expected 2 variable bindings, actual %s", pdu)
+	}
+
+	pingers := snmpclient2.NewPingers(16)
+	defer pingers.Close()
+	if err = pingers.Listen("udp6", "[::1]:0", snmpclient2.V2c, "public"); err != nil {
+		t.Fatal(err)
+	}
+	if err = pingers.Send(0, "[::1]:"+srv.GetPort()); err != nil {
+		t.Fatal(err)
+	}
+	res, err := pingers.RecvResult(2 * time.Second)
+	if err != nil {
+		t.Fatalf("RecvResult() - has error %v", err)
+	}
+	if res.Addr.String() != "[::1]:"+srv.GetPort() {
+		t.Errorf("RecvResult() - expected [[::1]:%s], actual [%s]", srv.GetPort(), res.Addr)
+	}
+}
+
+type hookCall struct {
+	reqPdu, resPdu snmpclient2.PDU
+	err            error
+}
+
+func TestUdpServerRequestHook(t *testing.T) {
+	srv, err := snmpclient2.NewUdpServer("hook", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	if err = srv.LoadCommunityFromString("public", `iso.3.6.1.2.1.1.1.0 = STRING: "Test Agent"`); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := make(chan hookCall, 10)
+	var accessLog bytes.Buffer
+	logHook := snmpclient2.NewAccessLog(&accessLog)
+	srv.SetRequestHandlerHook(func(src net.Addr, reqPdu, resPdu snmpclient2.PDU, decodeErr error) {
+		// the data sets are not locked by the hook
+		srv.SetReadOnly(false)
+		logHook(src, reqPdu, resPdu, decodeErr)
+		calls <- hookCall{reqPdu, resPdu, decodeErr}
+	})
+
+	for _, community := range []string{"public", "private"} {
+		snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:"+srv.GetPort(), snmpclient2.Arguments{
+			Version: snmpclient2.V2c, Community: community, Timeout: 50 * time.Millisecond})
+		snmp.GetRequest(snmpclient2.MustParseOids("1.3.6.1.2.1.1.1.0"))
+		snmp.Close()
+	}
+	conn, err := net.Dial("udp", "127.0.0.1:"+srv.GetPort())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte{0x04, 0x01, 0x00})
+
+	var received []hookCall
+	for len(received) < 4 {
+		if 3 == len(received) {
+			srv.SetLossRate(1)
+			conn.Write([]byte{0x04, 0x01, 0x00})
+		}
+		select {
+		case c := <-calls:
+			received = append(received, c)
+		case <-time.After(time.Second):
+			t.Fatalf("SetRequestHandlerHook() - expected [4] calls, actual %v", received)
+		}
+	}
+	if c := received[0]; c.reqPdu == nil || c.reqPdu.PduType() != snmpclient2.GetRequest ||
+		c.resPdu == nil || len(c.resPdu.VariableBindings()) != 1 || c.err != nil {
+		t.Errorf("SetRequestHandlerHook() - expected a request and a response, actual %v", c)
+	}
+	if c := received[1]; c.reqPdu == nil || c.resPdu != nil || c.err != nil {
+		t.Errorf("SetRequestHandlerHook() - expected a dropped request, actual %v", c)
+	}
+	if c := received[2]; c.reqPdu != nil || c.resPdu != nil || c.err == nil {
+		t.Errorf("SetRequestHandlerHook() - expected a decode error, actual %v", c)
+	}
+	if c := received[3]; c.reqPdu != nil || c.resPdu != nil || c.err != snmpclient2.DroppedError {
+		t.Errorf("SetRequestHandlerHook() - expected a dropped datagram, actual %v", c)
+	}
+
+	// the lines are written before the calls are received
+	lines := strings.Split(strings.TrimSpace(accessLog.String()), "\n")
+	if len(lines) != 4 || !strings.Contains(lines[0], "GetRequest(") ||
+		!strings.HasSuffix(lines[0], "[1.3.6.1.2.1.1.1.0] -> GetResponse NoError(0) 1 bindings") ||
+		!strings.HasSuffix(lines[1], "] -> dropped") || !strings.Contains(lines[2], " decode error - ") ||
+		!strings.HasSuffix(lines[3], " dropped") {
+		t.Errorf("NewAccessLog() - unexpected lines %q", lines)
+	}
+}
+
+func TestUdpServerLifecycle(t *testing.T) {
+	srv, err := snmpclient2.NewUdpServerFromString("lifecycle", "127.0.0.1:0",
+		`iso.3.6.1.2.1.1.1.0 = STRING: "Test Agent"`, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := srv.GetPort()
+	if err = srv.Start(); err != nil || srv.GetPort() != port {
+		t.Errorf("Start() - expected no effect on a serving server, actual %v [%s]", err, srv.GetPort())
+	}
+	srv.Close()
+	srv.Close()
+	select {
+	case <-srv.Done():
+	default:
+		t.Error("Done() - expected to be closed after Close()")
+	}
+	if srv.GetPort() != port {
+		t.Errorf("GetPort() - expected [%s] after Close(), actual [%s]", port, srv.GetPort())
+	}
+
+	if err = srv.Start(); err != nil {
+		t.Fatalf("Start() - has error %v", err)
+	}
+	defer srv.Close()
+	entered, release := make(chan struct{}), make(chan struct{})
+	srv.SetRequestHandlerHook(func(net.Addr, snmpclient2.PDU, snmpclient2.PDU, error) {
+		close(entered)
+		<-release
+	})
+	snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:"+srv.GetPort(), snmpclient2.Arguments{
+		Version: snmpclient2.V2c, Community: "public", Timeout: time.Second})
+	defer snmp.Close()
+	blocked, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:"+srv.GetPort(), snmpclient2.Arguments{
+		Version: snmpclient2.V2c, Community: "public", Timeout: 100 * time.Millisecond})
+	defer blocked.Close()
+	go blocked.GetRequest(snmpclient2.MustParseOids("1.3.6.1.2.1.1.1.0"))
+	<-entered
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err = srv.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Shutdown() - expected [%v] while a request is processed, actual [%v]", context.DeadlineExceeded, err)
+	}
+	close(release)
+	srv.Close()
+	select {
+	case <-srv.Done():
+	default:
+		t.Error("Done() - expected to be closed after Close()")
+	}
+
+	srv.SetRequestHandlerHook(nil)
+	if err = srv.Start(); err != nil {
+		t.Fatalf("Start() - has error %v", err)
+	}
+	if _, err = snmp.GetRequest(snmpclient2.MustParseOids("1.3.6.1.2.1.1.1.0")); err != nil {
+		t.Errorf("GetRequest() - has error %v after Start()", err)
+	}
+	if err = srv.Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown() - has error %v", err)
+	}
+	select {
+	case <-srv.Done():
+	default:
+		t.Error("Done() - expected to be closed after Shutdown()")
+	}
+}
+
+type statusError snmpclient2.ErrorStatus
+
+func (e statusError) Error() string                        { return snmpclient2.ErrorStatus(e).String() }
+func (e statusError) ErrorStatus() snmpclient2.ErrorStatus { return snmpclient2.ErrorStatus(e) }
+
+func TestUdpServerHandlers(t *testing.T) {
+	srv, err := snmpclient2.NewUdpServerFromString("handlers", "127.0.0.1:0",
+		`iso.3.6.1.2.1.1.1.0 = STRING: "Test Agent"
+iso.3.6.1.2.1.1.5.0 = STRING: "router"
+iso.3.6.1.2.1.2.2.1.1.3 = INTEGER: 3`, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	srv.Register(snmpclient2.MustParseOidFromString("1.3.6.1.2.1.1.3.0"), func(req snmpclient2.PDU) (snmpclient2.Variable, error) {
+		return snmpclient2.NewTimeTicks(uint32(req.RequestId())), nil
+	})
+	ifIndex := snmpclient2.MustParseOidFromString("1.3.6.1.2.1.2.2.1.1")
+	srv.RegisterSubtree(ifIndex, func(op snmpclient2.PduType, oid snmpclient2.Oid) (snmpclient2.Oid, snmpclient2.Variable, error) {
+		for i := 1; i <= 2; i++ {
+			row := ifIndex.AppendSubIds(i)
+			if (op == snmpclient2.GetRequest && row.Equal(&oid)) ||
+				(op == snmpclient2.GetNextRequest && row.Compare(&oid) > 0) {
+				return row, snmpclient2.NewInteger(int32(i)), nil
+			}
+		}
+		return oid, nil, nil
+	})
+
+	snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:"+srv.GetPort(), snmpclient2.Arguments{
+		Version: snmpclient2.V2c, Community: "public", Timeout: time.Second})
+	defer snmp.Close()
+
+	pdu, err := snmp.GetRequest(snmpclient2.MustParseOids("1.3.6.1.2.1.1.3.0", "1.3.6.1.2.1.2.2.1.1.2"))
+	if err != nil {
+		t.Fatalf("GetRequest() - has error %v", err)
+	}
+	if vbs := pdu.VariableBindings(); len(vbs) != 2 || vbs[0].Variable.Uint() != uint64(pdu.RequestId()) ||
+		vbs[1].Variable.Int() != 2 {
+		t.Errorf("GetRequest() - expected the values of the handlers, actual %v", vbs)
+	}
+
+	pdu, err = snmp.GetBulkWalk(snmpclient2.MustParseOids("1.3.6.1.2.1"), 0, 2)
+	if err != nil {
+		t.Fatalf("GetBulkWalk() - has error %v", err)
+	}
+	expected := []string{
+		"1.3.6.1.2.1.1.1.0",
+		"1.3.6.1.2.1.1.3.0",
+		"1.3.6.1.2.1.1.5.0",
+		"1.3.6.1.2.1.2.2.1.1.1",
+		"1.3.6.1.2.1.2.2.1.1.2",
+		"1.3.6.1.2.1.2.2.1.1.3",
+	}
+	vbs := pdu.VariableBindings()
+	if len(vbs) != len(expected) {
+		t.Fatalf("GetBulkWalk() - expected %v, actual %v", expected, vbs)
+	}
+	for i := range expected {
+		if vbs[i].Oid.ToString() != expected[i] {
+			t.Errorf("GetBulkWalk() - expected [%s], actual [%s]", expected[i], vbs[i].Oid.ToString())
+		}
+	}
+
+	// registered while serving
+	srv.Register(snmpclient2.MustParseOidFromString("1.3.6.1.4.1.1.0"), func(snmpclient2.PDU) (snmpclient2.Variable, error) {
+		return nil, statusError(snmpclient2.NoAccess)
+	})
+	for _, test := range []struct {
+		version  snmpclient2.SnmpVersion
+		expected snmpclient2.ErrorStatus
+	}{
+		{snmpclient2.V2c, snmpclient2.NoAccess},
+		{snmpclient2.V1, snmpclient2.NoSuchName},
+	} {
+		snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:"+srv.GetPort(), snmpclient2.Arguments{
+			Version: test.version, Community: "public", Timeout: time.Second})
+		defer snmp.Close()
+		pdu, err = snmp.GetRequest(snmpclient2.MustParseOids("1.3.6.1.2.1.1.1.0", "1.3.6.1.4.1.1.0"))
+		if err != nil {
+			t.Fatalf("GetRequest() - has error %v", err)
+		}
+		if pdu.ErrorStatus() != test.expected || pdu.ErrorIndex() != 2 {
+			t.Errorf("GetRequest(%s) - expected [%s] at [2], actual [%s] at [%d]",
+				test.version, test.expected, pdu.ErrorStatus(), pdu.ErrorIndex())
+		}
+	}
+
+	srv.Unregister(ifIndex)
+	pdu, err = snmp.GetNextRequest(snmpclient2.MustParseOids("1.3.6.1.2.1.2.2.1.1"))
+	if err != nil || len(pdu.VariableBindings()) != 1 ||
+		pdu.VariableBindings()[0].Oid.ToString() != "1.3.6.1.2.1.2.2.1.1.3" {
+		t.Errorf("GetNextRequest() - expected the loaded data after Unregister(), actual %v %v", pdu, err)
+	}
+}
+
+func TestUdpServerRegisterTable(t *testing.T) {
+	srv, err := snmpclient2.NewUdpServerFromString("table", "127.0.0.1:0", v3Mibs, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	// a sparse table, the rows are not in the order
+	ifTable := snmpclient2.MustParseOidFromString("1.3.6.1.2.1.2.2")
+	srv.RegisterTable(ifTable, func() ([]snmpclient2.Row, error) {
+		return []snmpclient2.Row{
+			{Index: snmpclient2.MustParseOidFromString("10"), Columns: map[int]snmpclient2.Variable{
+				1: snmpclient2.NewInteger(10), 2: snmpclient2.NewOctetString([]byte("eth1"))}},
+			{Index: snmpclient2.MustParseOidFromString("2"), Columns: map[int]snmpclient2.Variable{
+				1: snmpclient2.NewInteger(2)}},
+		}, nil
+	})
+
+	snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:"+srv.GetPort(), snmpclient2.Arguments{
+		Version: snmpclient2.V2c, Community: "public", Timeout: time.Second})
+	defer snmp.Close()
+
+	pdu, err := snmp.GetRequest(snmpclient2.MustParseOids("1.3.6.1.2.1.2.2.1.2.10", "1.3.6.1.2.1.2.2.1.2.2"))
+	if err != nil {
+		t.Fatalf("GetRequest() - has error %v", err)
+	}
+	// the missing cell is omitted as the missing OIDs of the loaded data
+	if vbs := pdu.VariableBindings(); len(vbs) != 1 || vbs[0].AsString() != "eth1" {
+		t.Errorf("GetRequest() - expected the cell, actual %v", vbs)
+	}
+
+	pdu, err = snmp.GetBulkWalk(snmpclient2.MustParseOids("1.3.6.1.2.1"), 0, 2)
+	if err != nil {
+		t.Fatalf("GetBulkWalk() - has error %v", err)
+	}
+	expected := []string{
+		"1.3.6.1.2.1.1.1.0",
+		"1.3.6.1.2.1.1.5.0",
+		"1.3.6.1.2.1.2.2.1.1.2",
+		"1.3.6.1.2.1.2.2.1.1.10",
+		"1.3.6.1.2.1.2.2.1.2.10",
+	}
+	vbs := pdu.VariableBindings()
+	if len(vbs) != len(expected) {
+		t.Fatalf("GetBulkWalk() - expected %v, actual %v", expected, vbs)
+	}
+	for i := range expected {
+		if vbs[i].Oid.ToString() != expected[i] {
+			t.Errorf("GetBulkWalk() - expected [%s], actual [%s]", expected[i], vbs[i].Oid.ToString())
+		}
+	}
+
+	rows, err := snmp.GetTable(ifTable)
+	if err != nil || len(rows) != 2 || rows[0].Index.ToString() != "2" || len(rows[1].Columns) != 2 {
+		t.Errorf("GetTable() - unexpected rows %v %v", rows, err)
+	}
+}
+
+func TestUdpServerFaults(t *testing.T) {
+	srv, err := snmpclient2.NewUdpServerFromString("faults", "127.0.0.1:0", `iso.3.6.1.2.1.1.5.0 = STRING: "router"`, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	sysName := snmpclient2.MustParseOidFromString("1.3.6.1.2.1.1.5.0")
+	get := func(timeout time.Duration, retries uint) error {
+		snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:"+srv.GetPort(), snmpclient2.Arguments{
+			Version:   snmpclient2.V2c,
+			Community: "public",
+			Timeout:   timeout,
+			Retries:   retries,
+		})
+		defer snmp.Close()
+		_, err := snmp.GetRequest(snmpclient2.Oids{sysName})
+		return err
+	}
+
+	srv.SetLossRate(1)
+	if err = get(50*time.Millisecond, 2); err == nil {
+		t.Error("GetRequest() - expected a timeout")
+	}
+	if stats := srv.Stats(); stats.InjectedDrops != 3 || stats.Requests[snmpclient2.GetRequest] != 0 {
+		t.Errorf("Stats() - expected [3] drops, actual %+v", stats)
+	}
+
+	// the faults of the host override the faults of all the sources
+	srv.SetFaultsFor("127.0.0.1", snmpclient2.Faults{MinDelay: 100 * time.Millisecond})
+	start := time.Now()
+	if err = get(time.Second, 0); err != nil {
+		t.Errorf("GetRequest() - has error %v", err)
+	} else if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("GetRequest() - expected the delay of [100ms], actual [%v]", elapsed)
+	}
+
+	srv.SetFaultsFor("127.0.0.1", snmpclient2.Faults{DuplicateRate: 1})
+	for i := 0; i < 3; i++ {
+		if err = get(time.Second, 0); err != nil {
+			t.Errorf("GetRequest() - has error %v", err)
+		}
+	}
+	if stats := srv.Stats(); stats.InjectedDuplicates != 3 {
+		t.Errorf("Stats() - expected [3] duplicates, actual %+v", stats)
+	}
+
+	// the same seed drops the same requests
+	drops := func(seed int64) (dropped []bool) {
+		srv.SetFaultsFor("127.0.0.1", snmpclient2.Faults{LossRate: 0.5})
+		srv.SetFaultSeed(seed)
+		for i := 0; i < 10; i++ {
+			before := srv.Stats().InjectedDrops
+			get(100*time.Millisecond, 0)
+			dropped = append(dropped, srv.Stats().InjectedDrops != before)
+		}
+		return dropped
+	}
+	first, second := drops(7), drops(7)
+	if fmt.Sprint(first) != fmt.Sprint(second) {
+		t.Errorf("SetFaultSeed() - expected the same drops, actual %v and %v", first, second)
+	}
+
+	srv.SetFaults(snmpclient2.Faults{})
+	srv.SetFaultsFor("127.0.0.1", snmpclient2.Faults{})
+	if err = get(time.Second, 0); err != nil {
+		t.Errorf("GetRequest() - has error %v", err)
+	}
+
+	// the requests of the system group time out
+	srv.SetOidDelay(snmpclient2.MustParseOidFromString("1.3.6.1.2.1.1"), 200*time.Millisecond)
+	if err = get(50*time.Millisecond, 0); err == nil {
+		t.Error("GetRequest() - expected a timeout by the delay of the OID")
+	}
+	srv.SetOidDelay(snmpclient2.MustParseOidFromString("1.3.6.1.2.1.1"), 0)
+	if err = get(50*time.Millisecond, 0); err != nil {
+		t.Errorf("GetRequest() - has error %v", err)
+	}
+}
+
+func TestUdpServerErrors(t *testing.T) {
+	srv, err := snmpclient2.NewUdpServerFromString("errors", "127.0.0.1:0", `iso.3.6.1.2.1.1.1.0 = STRING: "Test Agent"
+iso.3.6.1.2.1.1.5.0 = STRING: "router"`, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	sysDescr := snmpclient2.MustParseOidFromString("1.3.6.1.2.1.1.1.0")
+	sysName := snmpclient2.MustParseOidFromString("1.3.6.1.2.1.1.5.0")
+	get := func(version snmpclient2.SnmpVersion, splitOnTooBig bool) (snmpclient2.PDU, error) {
+		snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:"+srv.GetPort(), snmpclient2.Arguments{
+			Version:       version,
+			Community:     "public",
+			Timeout:       time.Second,
+			SplitOnTooBig: splitOnTooBig,
+		})
+		defer snmp.Close()
+		return snmp.GetRequest(snmpclient2.Oids{sysDescr, sysName})
+	}
+
+	srv.SetError(sysName, snmpclient2.NoAccess)
+	for version, expected := range map[snmpclient2.SnmpVersion]snmpclient2.ErrorStatus{
+		snmpclient2.V1:  snmpclient2.NoSuchName,
+		snmpclient2.V2c: snmpclient2.NoAccess,
+	} {
+		pdu, err := get(version, false)
+		if err != nil {
+			t.Fatalf("GetRequest(%s) - has error %v", version, err)
+		}
+		if pdu.ErrorStatus() != expected || pdu.ErrorIndex() != 2 {
+			t.Errorf("GetRequest(%s) - expected [%s 2], actual [%s %d]", version, expected, pdu.ErrorStatus(), pdu.ErrorIndex())
+		}
+	}
+	srv.SetError(sysName, snmpclient2.NoError)
+
+	srv.SetException(sysName, snmpclient2.NewNoSucheInstance())
+	pdu, err := get(snmpclient2.V2c, false)
+	if err != nil {
+		t.Fatalf("GetRequest() - has error %v", err)
+	}
+	if vb := pdu.VariableBindings().MatchOid(sysName); vb == nil || vb.Variable.Syntex() != snmpclient2.NewNoSucheInstance().Syntex() {
+		t.Errorf("GetRequest() - expected [noSuchInstance], actual [%v]", pdu)
+	}
+	if pdu, err = get(snmpclient2.V1, false); err != nil || pdu.ErrorStatus() != snmpclient2.NoSuchName || pdu.ErrorIndex() != 2 {
+		t.Errorf("GetRequest(1) - expected [noSuchName 2], actual [%v] %v", pdu, err)
+	}
+	srv.ClearErrors()
+
+	srv.SetMaxVarBinds(1)
+	if pdu, err = get(snmpclient2.V2c, false); err != nil || pdu.ErrorStatus() != snmpclient2.TooBig {
+		t.Errorf("GetRequest() - expected [tooBig], actual [%v] %v", pdu, err)
+	}
+	if pdu, err = get(snmpclient2.V2c, true); err != nil || pdu.ErrorStatus() != snmpclient2.NoError || len(pdu.VariableBindings()) != 2 {
+		t.Errorf("GetRequest(split) - expected [2] bindings, actual [%v] %v", pdu, err)
+	}
+	srv.ClearErrors()
+
+	if pdu, err = get(snmpclient2.V2c, false); err != nil || pdu.ErrorStatus() != snmpclient2.NoError || len(pdu.VariableBindings()) != 2 {
+		t.Errorf("GetRequest() - expected [2] bindings, actual [%v] %v", pdu, err)
+	}
+}
+
+func TestUdpServerControl(t *testing.T) {
+	srv, err := snmpclient2.NewUdpServerFromString("a", "127.0.0.1:0", v3Mibs, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	dir, err := ioutil.TempDir("", "snmp_control")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "agent.txt")
+	if err = ioutil.WriteFile(file, []byte(v3Mibs), 0644); err != nil {
+		t.Fatal(err)
+	}
+	control := httptest.NewServer(srv.ControlHandler(file))
+	defer control.Close()
+
+	call := func(method, path, body string) (int, string) {
+		req, err := http.NewRequest(method, control.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s - has error %v", method, path, err)
+		}
+		defer res.Body.Close()
+		b, _ := ioutil.ReadAll(res.Body)
+		return res.StatusCode, strings.TrimSpace(string(b))
+	}
+	get := func(oid string) string {
+		snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:"+srv.GetPort(), snmpclient2.Arguments{
+			Version: snmpclient2.V2c, Community: "public", Timeout: time.Second})
+		defer snmp.Close()
+		pdu, err := snmp.GetRequest(snmpclient2.MustParseOids(oid))
+		if err != nil {
+			t.Fatalf("GetRequest() - has error %v", err)
+		}
+		if len(pdu.VariableBindings()) == 0 {
+			return ""
+		}
+		return pdu.VariableBindings()[0].AsString()
+	}
+
+	for _, test := range []struct {
+		method, path, body string
+		status             int
+		response           string
+	}{
+		{"GET", "/oids/1.3.6.1.2.1.1.5.0", "", 200, `{"oid":"1.3.6.1.2.1.1.5.0","type":"OctetString","value":"simulator"}`},
+		{"PUT", "/oids/1.3.6.1.2.1.1.5.0", `{"type":"OctetString","value":"router"}`, 200, `{"oid":"1.3.6.1.2.1.1.5.0","type":"OctetString","value":"router"}`},
+		{"PUT", "/oids/1.3.6.1.2.1.1.6.0", `{"type":"OctetString","value":"lab"}`, 200, `{"oid":"1.3.6.1.2.1.1.6.0","type":"OctetString","value":"lab"}`},
+		{"DELETE", "/oids/1.3.6.1.2.1.1.1.0", "", 204, ""},
+		{"DELETE", "/oids/1.3.6.1.2.1.1.1.0", "", 404, "oid '1.3.6.1.2.1.1.1.0' is not found"},
+		{"GET", "/oids", "", 200, `[{"oid":"1.3.6.1.2.1.1.5.0","type":"OctetString","value":"router"},{"oid":"1.3.6.1.2.1.1.6.0","type":"OctetString","value":"lab"}]`},
+		{"PUT", "/oids/1.3.6.1.2.1.1.5.0", `{"type":"Counter32","value":"x"}`, 400, ""},
+		{"PUT", "/oids/a.b", `{"type":"Counter32","value":1}`, 400, ""},
+		{"POST", "/oids", "", 405, ""},
+	} {
+		status, response := call(test.method, test.path, test.body)
+		if status != test.status || (test.response != "" || status/100 == 2) && response != test.response {
+			t.Errorf("%s %s - expected [%d %s], actual [%d %s]", test.method, test.path, test.status, test.response, status, response)
+		}
+	}
+	if actual := get("1.3.6.1.2.1.1.5.0"); actual != "router" {
+		t.Errorf("GetRequest() - expected [router], actual [%s]", actual)
+	}
+
+	if status, response := call("POST", "/reload", `iso.3.6.1.2.1.1.5.0 = STRING: "reloaded"`); status != 204 {
+		t.Errorf("POST /reload - expected [204], actual [%d %s]", status, response)
+	}
+	if actual := get("1.3.6.1.2.1.1.5.0"); actual != "reloaded" {
+		t.Errorf("GetRequest() - expected [reloaded], actual [%s]", actual)
+	}
+	if status, response := call("POST", "/reload", ""); status != 204 {
+		t.Errorf("POST /reload - expected [204], actual [%d %s]", status, response)
+	}
+	if actual := get("1.3.6.1.2.1.1.1.0"); actual != "USM agent" {
+		t.Errorf("GetRequest() - expected [USM agent], actual [%s]", actual)
+	}
+
+	received := make(chan snmpclient2.PDU, 1)
+	trapSrv, err := snmpclient2.NewTrapServer("trap", "127.0.0.1:0", func(src net.Addr, pdu snmpclient2.PDU) {
+		received <- pdu
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer trapSrv.Close()
+	body := `{"dsn":"snmp://public@127.0.0.1:` + trapSrv.GetPort() + `?version=2c","trap_oid":"1.3.6.1.6.3.1.1.5.3",` +
+		`"variables":[{"oid":"1.3.6.1.2.1.2.2.1.1.1","type":"Integer","value":1}]}`
+	if status, response := call("POST", "/traps", body); status != 204 {
+		t.Fatalf("POST /traps - expected [204], actual [%d %s]", status, response)
+	}
+	select {
+	case pdu := <-received:
+		vbs := pdu.VariableBindings()
+		if len(vbs) != 3 || vbs[0].Oid.ToString() != snmpclient2.OidSysUpTime.ToString() ||
+			vbs[1].Variable.ToString() != "1.3.6.1.6.3.1.1.5.3" || vbs[2].Variable.ToString() != "1" {
+			t.Errorf("POST /traps - unexpected %s", pdu)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("POST /traps - the trap is not received")
+	}
+	body = `{"dsn":"snmp://public@127.0.0.1:` + trapSrv.GetPort() + `?version=1","trap_oid":"1.3.6.1.4.1.9.0.5"}`
+	if status, response := call("POST", "/traps", body); status != 204 {
+		t.Fatalf("POST /traps - expected [204], actual [%d %s]", status, response)
+	}
+	select {
+	case pdu := <-received:
+		v1, ok := pdu.(*snmpclient2.PduV1)
+		if !ok || v1.Enterprise.ToString() != "1.3.6.1.4.1.9" ||
+			v1.GenericTrap != snmpclient2.EnterpriseSpecific || v1.SpecificTrap != 5 {
+			t.Errorf("POST /traps - unexpected %s", pdu)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("POST /traps - the trap is not received")
+	}
+	for _, body := range []string{
+		`{"dsn":"snmp://public@127.0.0.1:162","trap_oid":"x"}`,
+		`{"dsn":"snmp://public@127.0.0.1:162?version=1","trap_oid":"1.3.6.1.6.3.1.1.5.3","inform":true}`,
+		`{"dsn":"snmp://public@127.0.0.1:162?transport=sctp","trap_oid":"1.3.6.1.6.3.1.1.5.3"}`,
+	} {
+		if status, _ := call("POST", "/traps", body); status != 400 {
+			t.Errorf("POST /traps %s - expected [400], actual [%d]", body, status)
+		}
+	}
+}
@@ -0,0 +1,377 @@
+package snmpclient2
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// UsmUser is an user of the SNMPv3 agent of UdpServer, the security level
+// of the user is AuthNoPriv if AuthPassword is set, and AuthPriv if both
+// AuthPassword and PrivPassword are set.
+type UsmUser struct {
+	UserName     string
+	AuthProtocol AuthProtocol
+	AuthPassword string
+	PrivProtocol PrivProtocol
+	PrivPassword string
+}
+
+func (u *UsmUser) securityLevel() SecurityLevel {
+	if u.AuthPassword == "" {
+		return NoAuthNoPriv
+	}
+	if u.PrivPassword == "" {
+		return AuthNoPriv
+	}
+	return AuthPriv
+}
+
+func (u *UsmUser) validate() error {
+	if u.AuthPassword != "" {
+		if len(u.AuthPassword) < 8 {
+			return ArgumentError{
+				Value:   u.AuthPassword,
+				Message: "AuthPassword is at least 8 characters in length",
+			}
+		}
+		if p := u.AuthProtocol; !isAuthProtocol(p) {
+			return ArgumentError{
+				Value:   u.AuthProtocol,
+				Message: "Illegal AuthProtocol",
+			}
+		}
+	}
+	if u.PrivPassword != "" {
+		if u.AuthPassword == "" {
+			return ArgumentError{
+				Value:   u.PrivPassword,
+				Message: "PrivPassword requires AuthPassword",
+			}
+		}
+		if len(u.PrivPassword) < 8 {
+			return ArgumentError{
+				Value:   u.PrivPassword,
+				Message: "PrivPassword is at least 8 characters in length",
+			}
+		}
+		if p := u.PrivProtocol; !isPrivProtocol(p) {
+			return ArgumentError{
+				Value:   u.PrivProtocol,
+				Message: "Illegal PrivProtocol",
+			}
+		}
+	}
+	return nil
+}
+
+type usmAgentUser struct {
+	UsmUser
+	authKey []byte
+	privKey []byte
+}
+
+// usmAgent is the authoritative engine of the UdpServer
+type usmAgent struct {
+	mutex       sync.Mutex
+	engineId    []byte
+	engineBoots int64
+	engineTime  int64
+	startedAt   time.Time
+	users       map[string]*usmAgentUser
+	stats       map[reportStatusOid]uint32
+	trapHandler TrapHandler
+}
+
+// init generates an engine id (RFC 3411 format 128, random octets) if no
+// engine id is configured. The caller holds the mutex.
+func (a *usmAgent) init() {
+	if a.engineId != nil {
+		return
+	}
+	id := []byte{0x80, 0x00, 0x1f, 0x88, 0x80, 0, 0, 0, 0, 0, 0, 0, 0}
+	rand.Read(id[5:])
+	a.engineId = id
+	a.engineBoots = 1
+	a.startedAt = time.Now()
+	a.localizeKeys()
+}
+
+func (a *usmAgent) localizeKeys() {
+	for _, u := range a.users {
+		u.authKey, u.privKey = nil, nil
+		if u.AuthPassword != "" {
+			u.authKey = PasswordToKey(u.AuthProtocol, u.AuthPassword, a.engineId)
+		}
+		if u.PrivPassword != "" {
+			u.privKey = extendPrivKey(u.AuthProtocol, u.PrivProtocol,
+				PasswordToKey(u.AuthProtocol, u.PrivPassword, a.engineId), a.engineId)
+		}
+	}
+}
+
+func (a *usmAgent) bootsTime() (int64, int64) {
+	return a.engineBoots, a.engineTime + int64(time.Since(a.startedAt).Seconds())
+}
+
+// SetEngineId sets the id of the SNMPv3 engine, a random id is generated
+// if it is not set
+func (self *UdpServer) SetEngineId(engineId []byte) {
+	self.v3.mutex.Lock()
+	defer self.v3.mutex.Unlock()
+	self.v3.init()
+	self.v3.engineId = append([]byte(nil), engineId...)
+	self.v3.localizeKeys()
+}
+
+// EngineId returns the id of the SNMPv3 engine
+func (self *UdpServer) EngineId() []byte {
+	self.v3.mutex.Lock()
+	defer self.v3.mutex.Unlock()
+	self.v3.init()
+	return append([]byte(nil), self.v3.engineId...)
+}
+
+// SetEngineBootsTime sets snmpEngineBoots and snmpEngineTime, the engine
+// time keeps increasing from engineTime. Changing the boots simulates a
+// reboot of the agent.
+func (self *UdpServer) SetEngineBootsTime(engineBoots, engineTime int32) {
+	self.v3.mutex.Lock()
+	defer self.v3.mutex.Unlock()
+	self.v3.init()
+	self.v3.engineBoots = int64(engineBoots)
+	self.v3.engineTime = int64(engineTime)
+	self.v3.startedAt = time.Now()
+}
+
+// EngineBootsTime returns snmpEngineBoots and snmpEngineTime
+func (self *UdpServer) EngineBootsTime() (int32, int32) {
+	self.v3.mutex.Lock()
+	defer self.v3.mutex.Unlock()
+	self.v3.init()
+	boots, t := self.v3.bootsTime()
+	return int32(boots), int32(t)
+}
+
+// AddUser adds or replaces an user of the SNMPv3 agent
+func (self *UdpServer) AddUser(user UsmUser) error {
+	if err := user.validate(); err != nil {
+		return err
+	}
+
+	self.v3.mutex.Lock()
+	defer self.v3.mutex.Unlock()
+	self.v3.init()
+	if self.v3.users == nil {
+		self.v3.users = map[string]*usmAgentUser{}
+	}
+	self.v3.users[user.UserName] = &usmAgentUser{UsmUser: user}
+	self.v3.localizeKeys()
+	return nil
+}
+
+// RemoveUser removes an user of the SNMPv3 agent
+func (self *UdpServer) RemoveUser(userName string) {
+	self.v3.mutex.Lock()
+	defer self.v3.mutex.Unlock()
+	delete(self.v3.users, userName)
+}
+
+// SetTrapHandler sets the handler of the SNMPv3 traps received by the
+// UdpServer, the traps are discarded if handler is nil. The sender of a
+// trap is the authoritative engine, the keys of the user are localized to
+// the engine of the sender.
+func (self *UdpServer) SetTrapHandler(handler TrapHandler) {
+	self.v3.mutex.Lock()
+	defer self.v3.mutex.Unlock()
+	self.v3.trapHandler = handler
+}
+
+// on_v3 processes a request as the authoritative engine (RFC 3414 Section 3.2),
+// the request and the response or the report are returned, the response is
+// nil if the request is dropped
+func (self *UdpServer) on_v3(addr net.Addr, recv_bytes []byte) (PDU, PDU, error) {
+	reqPdu := &ScopedPdu{}
+	reqMsg := NewMessage(V3, reqPdu).(*MessageV3)
+	if _, err := reqMsg.Unmarshal(recv_bytes); err != nil {
+		return nil, nil, self.decodeFailed("Failed to Unmarshal message - %s : [%s]",
+			err.Error(), ToHexStr(recv_bytes, " "))
+	}
+	if reqMsg.SecurityModel != securityUsm {
+		return nil, nil, self.decodeFailed("Unknown SecurityModel, value [%d]", reqMsg.SecurityModel)
+	}
+
+	self.v3.mutex.Lock()
+	self.v3.init()
+	engineId := self.v3.engineId
+	engineBoots, engineTime := self.v3.bootsTime()
+	var user *usmAgentUser
+	if u, ok := self.v3.users[string(reqMsg.UserName)]; ok {
+		copied := *u
+		user = &copied
+	}
+	trapHandler := self.v3.trapHandler
+	self.v3.mutex.Unlock()
+
+	level := NoAuthNoPriv
+	if reqMsg.Authentication() {
+		level = AuthNoPriv
+		if reqMsg.Privacy() {
+			level = AuthPriv
+		}
+	}
+
+	send := func(resPdu *ScopedPdu, level SecurityLevel) PDU {
+		resMsg := NewMessage(V3, resPdu).(*MessageV3)
+		resMsg.MessageId = reqMsg.MessageId
+		resMsg.MessageMaxSize = reqMsg.MessageMaxSize
+		resMsg.SecurityModel = securityUsm
+		resMsg.AuthEngineId = engineId
+		resMsg.AuthEngineBoots = engineBoots
+		resMsg.AuthEngineTime = engineTime
+		resMsg.UserName = reqMsg.UserName
+		resMsg.SetAuthentication(level >= AuthNoPriv)
+		resMsg.SetPrivacy(level >= AuthPriv)
+
+		b, err := resPdu.Marshal()
+		if err != nil {
+			self.warnf(" failed to marshal, %v", err)
+			return nil
+		}
+		resMsg.SetPduBytes(b)
+		if level >= AuthPriv {
+			if err = encrypt(resMsg, user.PrivProtocol, user.privKey); err != nil {
+				self.warnf(" failed to encrypt, %v", err)
+				return nil
+			}
+		}
+		if level >= AuthNoPriv {
+			if resMsg.AuthParameter, err = mac(resMsg, user.AuthProtocol, user.authKey); err != nil {
+				self.warnf(" failed to authenticate, %v", err)
+				return nil
+			}
+		}
+
+		if b, err = resMsg.Marshal(); err != nil {
+			self.warnf(" failed to marshal, %v", err)
+			return nil
+		}
+		self.tracer.sent(b, resMsg, nil)
+		if err = self.writeTo(self.conn, b, addr, reqPdu); nil != err {
+			self.warnf(" failed to write response, %v", err)
+			return nil
+		}
+		return resPdu
+	}
+
+	report := func(oid reportStatusOid, level SecurityLevel) PDU {
+		self.v3.mutex.Lock()
+		if self.v3.stats == nil {
+			self.v3.stats = map[reportStatusOid]uint32{}
+		}
+		self.v3.stats[oid]++
+		count := self.v3.stats[oid]
+		self.v3.mutex.Unlock()
+
+		if !reqMsg.Reportable() {
+			return nil
+		}
+		resPdu := &ScopedPdu{
+			ContextEngineId: engineId,
+			ContextName:     reqPdu.ContextName,
+			PduV1:           PduV1{pduType: Report, requestId: reqPdu.RequestId()},
+		}
+		o, _ := ParseOidFromString(string(oid))
+		resPdu.AppendVariableBinding(o, NewCounter32(count))
+		return send(resPdu, level)
+	}
+
+	if !reqMsg.Privacy() {
+		// the request id of the report
+		if _, err := reqPdu.Unmarshal(reqMsg.PduBytes()); err != nil {
+			return nil, nil, self.decodeFailed("Failed to Unmarshal PDU - %s : [%s]",
+				err.Error(), ToHexStr(recv_bytes, " "))
+		}
+	}
+
+	// an unconfirmed message of another engine is a trap of the sender
+	authoritative := bytes.Equal(reqMsg.AuthEngineId, engineId)
+	if !authoritative && (reqMsg.Reportable() || len(reqMsg.AuthEngineId) == 0 || nil == trapHandler) {
+		return reqPdu, report(usmStatsUnknownEngineIDs, NoAuthNoPriv), nil
+	}
+	if user == nil {
+		return reqPdu, report(usmStatsUnknownUserNames, NoAuthNoPriv), nil
+	}
+	// RFC 3414 Section 3.2 5), the level of the message is the one of the user
+	if level != user.securityLevel() {
+		return reqPdu, report(usmStatsUnsupportedSecLevels, NoAuthNoPriv), nil
+	}
+	if !authoritative {
+		user.authKey, user.privKey = nil, nil
+		if user.AuthPassword != "" {
+			user.authKey = PasswordToKey(user.AuthProtocol, user.AuthPassword, reqMsg.AuthEngineId)
+		}
+		if user.PrivPassword != "" {
+			user.privKey = extendPrivKey(user.AuthProtocol, user.PrivProtocol,
+				PasswordToKey(user.AuthProtocol, user.PrivPassword, reqMsg.AuthEngineId), reqMsg.AuthEngineId)
+		}
+	}
+
+	if level >= AuthNoPriv {
+		digest, err := mac(reqMsg, user.AuthProtocol, user.authKey)
+		if err != nil || !hmac.Equal(reqMsg.AuthParameter, digest) {
+			return reqPdu, report(usmStatsWrongDigests, NoAuthNoPriv), nil
+		}
+
+		// RFC 3414 Section 3.2 7) a)
+		if authoritative && (reqMsg.AuthEngineBoots != engineBoots ||
+			reqMsg.AuthEngineTime > engineTime+150 || reqMsg.AuthEngineTime < engineTime-150) {
+			return reqPdu, report(usmStatsNotInTimeWindows, AuthNoPriv), nil
+		}
+	}
+
+	if level >= AuthPriv {
+		if err := decrypt(reqMsg, user.PrivProtocol, user.privKey, reqMsg.PrivParameter); err != nil {
+			return nil, report(usmStatsDecryptionErrors, NoAuthNoPriv), err
+		}
+		if _, err := reqPdu.Unmarshal(reqMsg.PduBytes()); err != nil {
+			return nil, report(usmStatsDecryptionErrors, NoAuthNoPriv), err
+		}
+	}
+
+	if !authoritative {
+		if SNMPTrapV2 != reqPdu.PduType() {
+			self.warnf("%s of the engine [%s] is unsupported",
+				reqPdu.PduType(), ToHexStr(reqMsg.AuthEngineId, ""))
+			return reqPdu, nil, nil
+		}
+		trapHandler(addr, reqPdu)
+		return reqPdu, nil, nil
+	}
+
+	defer self.lockMibs(reqPdu.PduType())()
+
+	mibs := self.mibs
+	if 0 != len(reqPdu.ContextName) && self.mibsByEngine != nil {
+		if m := self.mibsByEngine[string(reqPdu.ContextName)]; m != nil {
+			mibs = m
+		}
+	}
+	if nil == mibs {
+		return reqPdu, report(snmpUnknownContexts, level), nil
+	}
+
+	resPdu := &ScopedPdu{
+		ContextEngineId: engineId,
+		ContextName:     reqPdu.ContextName,
+		PduV1:           PduV1{pduType: GetResponse, requestId: reqPdu.RequestId()},
+	}
+	// approximate overhead of the message header, the security parameters,
+	// the context and the padding of the encryption
+	overhead := 64 + 2*len(engineId) + len(reqMsg.UserName) + len(reqPdu.ContextName) + len(reqMsg.AuthParameter) + 8 + 16
+	self.respond(V3, mibs, reqPdu, resPdu, reqMsg.MessageMaxSize-overhead)
+	return reqPdu, send(resPdu, level), nil
+}
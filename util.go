@@ -2,6 +2,9 @@ package snmpclient2
 
 import (
 	"bytes"
+	"context"
+	cryptorand "crypto/rand"
+	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
@@ -17,23 +20,37 @@ import (
 
 var random *rand.Rand
 var randOnce sync.Once
+var randMutex sync.Mutex // *rand.Rand is not safe for concurrent use
 
+// initRandom seeds the ids by crypto/rand so that they differ across the
+// processes started at the same time
 func initRandom() {
-	random = rand.New(rand.NewSource(time.Now().UnixNano()))
+	seed := time.Now().UnixNano()
+	var b [8]byte
+	if _, err := cryptorand.Read(b[:]); err == nil {
+		seed = int64(binary.BigEndian.Uint64(b[:]))
+	}
+	random = rand.New(rand.NewSource(seed))
 }
 
 func genRequestId() int {
 	randOnce.Do(initRandom)
+	randMutex.Lock()
+	defer randMutex.Unlock()
 	return int(random.Int31())
 }
 
 func genSalt32() int32 {
 	randOnce.Do(initRandom)
+	randMutex.Lock()
+	defer randMutex.Unlock()
 	return random.Int31()
 }
 
 func genSalt64() int64 {
 	randOnce.Do(initRandom)
+	randMutex.Lock()
+	defer randMutex.Unlock()
 	return random.Int63()
 }
 
@@ -45,23 +62,31 @@ func genMessageId() (id int) {
 	mesMutex.Lock()
 	mesId++
 	if mesId == math.MaxInt32 {
+		randMutex.Lock()
 		mesId = int(random.Int31())
+		randMutex.Unlock()
 	}
 	id = mesId
 	mesMutex.Unlock()
 	return
 }
 
-func retry(retries int, f func() error) (err error) {
+// retry calls f until it succeeds or fails with other than a timeout, the
+// n-th retry waits backoff(n) unless ctx is done (backoff may be nil)
+func retry(ctx context.Context, retries int, backoff func(int) time.Duration, f func() error) (err error) {
 	for i := 0; i <= retries; i++ {
-		err = f()
-		switch err.(type) {
-		case net.Error:
-			if err.(net.Error).Timeout() {
-				continue
+		if i > 0 && backoff != nil {
+			if d := backoff(i); d > 0 {
+				timer := time.NewTimer(d)
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					timer.Stop()
+				}
 			}
-		case notInTimeWindowError:
-			err = err.(notInTimeWindowError).ResponseError
+		}
+		var again bool
+		if err, again = retryable(f()); again {
 			continue
 		}
 		return
@@ -69,6 +94,18 @@ func retry(retries int, f func() error) (err error) {
 	return
 }
 
+// retryable returns the error of an attempt and whether the request is
+// sent again, i.e. the attempt is timed out or is not in the time window
+func retryable(err error) (error, bool) {
+	switch e := err.(type) {
+	case net.Error:
+		return err, e.Timeout()
+	case notInTimeWindowError:
+		return e.ResponseError, true
+	}
+	return err, false
+}
+
 func confirmedType(t PduType) bool {
 	if t == GetRequest || t == GetNextRequest || t == SetRequest ||
 		t == GetBulkRequest || t == InformRequest {
@@ -79,12 +116,15 @@ func confirmedType(t PduType) bool {
 
 func engineIdToBytes(engineId string) ([]byte, error) {
 	b, err := hex.DecodeString(engineId)
-	if l := len(b); err != nil || (l < 5 || l > 32) {
+	if err != nil {
 		return nil, ArgumentError{
 			Value:   engineId,
-			Message: "EngineId must be a hexadecimal string and length is range 5..32",
+			Message: "EngineId must be a hexadecimal string - " + err.Error(),
 		}
 	}
+	if _, err = parseEngineId(b); err != nil {
+		return nil, err
+	}
 	return b, nil
 }
 
@@ -154,6 +194,14 @@ func ParseAuthProtocol(s string) (AuthProtocol, error) {
 		return Md5, nil
 	case "sha", "SHA":
 		return Sha, nil
+	case "sha224", "SHA224", "sha-224", "SHA-224":
+		return Sha224, nil
+	case "sha256", "SHA256", "sha-256", "SHA-256":
+		return Sha256, nil
+	case "sha384", "SHA384", "sha-384", "SHA-384":
+		return Sha384, nil
+	case "sha512", "SHA512", "sha-512", "SHA-512":
+		return Sha512, nil
 	default:
 		return "", errors.New("AuthProtocol '" + s + "' is unsupported.")
 	}
@@ -165,6 +213,8 @@ func ParsePrivProtocol(s string) (PrivProtocol, error) {
 		return Des, nil
 	case "aes", "AES":
 		return Aes, nil
+	case "3des", "3DES":
+		return TripleDes, nil
 	default:
 		return "", errors.New("PrivProtocol '" + s + "' is unsupported.")
 	}
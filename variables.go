@@ -1,6 +1,7 @@
 package snmpclient2
 
 import (
+	"encoding/binary"
 	"encoding/hex"
 	"fmt"
 	"math"
@@ -9,6 +10,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/runner-mei/snmpclient2/asn1"
 )
@@ -49,6 +51,10 @@ func NewVariable(s string) (Variable, error) {
 		return NewOctetStringFromString(ss[1])
 	case "opaque":
 		return NewOpaqueFromString(ss[1])
+	case "float":
+		return NewFloatFromString(ss[1])
+	case "double":
+		return NewDoubleFromString(ss[1])
 	case "oid":
 		return NewOidFromString(ss[1])
 	case "ip", "ipaddress":
@@ -69,6 +75,80 @@ func NewVariable(s string) (Variable, error) {
 	return nil, fmt.Errorf("unsupported snmp type - %s", ss[0])
 }
 
+// NewVariableFromString returns the variable of the value by the type
+// character of snmpset:
+//
+//	i: Integer, u: Gauge32, c: Counter32, C: Counter64, t: TimeTicks,
+//	s: OctetString, x: OctetString in hex, d: OctetString in decimal bytes,
+//	a: IpAddress, o: Oid, n: Null, F: Float, D: Double, b: BITS
+//
+// The hex may be separated by spaces or colons, e.g. "0a 1b" or "0a:1b",
+// and the decimal bytes by spaces or dots, e.g. "192 168 0 1". The BITS are
+// the numbers of the set bits separated by spaces or commas, e.g. "0 9" is
+// the OctetString 0x80 0x40, bit 0 is the most significant bit of the
+// first octet.
+func NewVariableFromString(typeCode string, value string) (Variable, error) {
+	var v Variable
+	var err error
+	switch typeCode {
+	case "i":
+		v, err = NewIntegerFromString(value)
+	case "u":
+		v, err = NewGauge32FromString(value)
+	case "c":
+		v, err = NewCounter32FromString(value)
+	case "C":
+		v, err = NewCounter64FromString(value)
+	case "t":
+		v, err = NewTimeticksFromString(value)
+	case "s":
+		v = NewOctetString([]byte(value))
+	case "x":
+		v, err = NewOctetStringFromString(strings.NewReplacer(" ", "", ":", "").Replace(StripHexPrefix(value)))
+	case "d":
+		var b []byte
+		for _, f := range strings.FieldsFunc(value, func(r rune) bool { return r == ' ' || r == '.' }) {
+			i, e := strconv.ParseUint(f, 10, 8)
+			if nil != e {
+				err = e
+				break
+			}
+			b = append(b, byte(i))
+		}
+		v = NewOctetString(b)
+	case "a":
+		v, err = NewIPAddressFromString(value)
+	case "o":
+		v, err = NewOidFromString(value)
+	case "n":
+		v = NewNull()
+	case "F":
+		v, err = NewFloatFromString(value)
+	case "D":
+		v, err = NewDoubleFromString(value)
+	case "b":
+		var b []byte
+		for _, f := range strings.FieldsFunc(value, func(r rune) bool { return r == ' ' || r == ',' }) {
+			i, e := strconv.ParseUint(f, 10, 16)
+			if nil != e {
+				err = e
+				break
+			}
+			for uint64(len(b)) <= i/8 {
+				b = append(b, 0)
+			}
+			b[i/8] |= 0x80 >> (i % 8)
+		}
+		v = NewOctetString(b)
+	default:
+		return nil, fmt.Errorf("type '%s' is unsupported, it is one of i, u, c, C, t, s, x, d, a, o, n, F, D and b", typeCode)
+	}
+	if nil != err {
+		return nil, fmt.Errorf("value '%s' of type '%s' is invalid - %v", value, typeCode, err)
+	}
+	return v, nil
+}
+
 type Variable interface {
 	Int() int64
 	Uint() uint64
@@ -333,7 +413,8 @@ func (v *Oid) Unmarshal(b []byte) (rest []byte, err error) {
 	return
 }
 
-// Returns true if this OID contains the specified OID
+// Returns true if this OID contains the specified OID, that is the
+// specified OID is a prefix of this OID, see IsPrefixOf for the reverse
 func (v *Oid) Contains(o *Oid) bool {
 	if o == nil || len(v.Value) < len(o.Value) {
 		return false
@@ -375,9 +456,47 @@ func (v *Oid) Equal(o *Oid) bool {
 	return asn1.ObjectIdentifier(v.Value).Equal(asn1.ObjectIdentifier(o.Value))
 }
 
-// Returns Oid with additional sub-ids
-func (v *Oid) AppendSubIds(subs []int) Oid {
-	return NewOid(append(v.Value, subs...))
+// Returns true if this OID is a prefix of the specified OID, which is
+// this OID or in the subtree of this OID
+func (v *Oid) IsPrefixOf(child Oid) bool {
+	return child.Contains(v)
+}
+
+// CompareTo is Compare, which is the ordering of Sort and the walks
+func (v *Oid) CompareTo(other Oid) int {
+	return v.Compare(&other)
+}
+
+// Returns a copy of this OID with additional sub-ids
+func (v *Oid) AppendSubIds(ids ...int) Oid {
+	value := make([]int, 0, len(v.Value)+len(ids))
+	value = append(value, v.Value...)
+	return NewOid(append(value, ids...))
+}
+
+// Returns a copy of this OID without the last sub-id, the parent of an
+// empty OID is empty
+func (v *Oid) Parent() Oid {
+	if 0 == len(v.Value) {
+		return NewOid(nil)
+	}
+	return NewOid(append([]int(nil), v.Value[:len(v.Value)-1]...))
+}
+
+// Returns the first OID after the subtree of this OID, the last sub-id
+// is incremented, e.g. 1.3.6.1.2.1.2 of 1.3.6.1.2.1.1. The sub-ids of the
+// maximum value are removed first, the result is empty if there is no
+// OID after the subtree.
+func (v *Oid) NextSibling() Oid {
+	value := append([]int(nil), v.Value...)
+	for len(value) > 0 && uint32(value[len(value)-1]) == math.MaxUint32 {
+		value = value[:len(value)-1]
+	}
+	if 0 == len(value) {
+		return NewOid(nil)
+	}
+	value[len(value)-1]++
+	return NewOid(value)
 }
 
 func ConcatOidString(oid Oid, s string) Oid {
@@ -519,7 +638,7 @@ func (o Oids) UniqBase() Oids {
 		if 0 == len(a.Value) {
 			return false
 		}
-		return b.Contains(&a)
+		return a.IsPrefixOf(b)
 	})
 }
 
@@ -536,12 +655,12 @@ func (o sortableOids) Swap(i, j int) {
 }
 
 func (o sortableOids) Less(i, j int) bool {
-	return o.Oids[i].Compare(&o.Oids[j]) < 1
+	return o.Oids[i].CompareTo(o.Oids[j]) < 0
 }
 
 func NewOids(s []string) (oids Oids, err error) {
 	for _, l := range s {
-		o, e := ParseOidFromString(l)
+		o, e := ParseOidOrName(l)
 		if e != nil {
 			return nil, e
 		}
@@ -550,6 +669,33 @@ func NewOids(s []string) (oids Oids, err error) {
 	return
 }
 
+// parseOidStrings is NewOids, but the error is an ArgumentError of the
+// string which cannot be parsed
+func parseOidStrings(s []string) (Oids, error) {
+	oids := make(Oids, 0, len(s))
+	for _, l := range s {
+		o, e := ParseOidOrName(l)
+		if e != nil {
+			return nil, ArgumentError{
+				Value:   l,
+				Message: "Invalid OID",
+			}
+		}
+		oids = append(oids, o)
+	}
+	return oids, nil
+}
+
+// MustParseOids is like NewOids but panics if an argument cannot be parsed,
+// it is intended for the tests
+func MustParseOids(s ...string) Oids {
+	oids, err := parseOidStrings(s)
+	if err != nil {
+		panic(`snmpgo.MustParseOids: ` + err.Error())
+	}
+	return oids
+}
+
 type Ipaddress struct {
 	OctetString
 }
@@ -722,6 +868,9 @@ type TimeTicks struct {
 	Counter32
 }
 
+// timeTicksUnit is the duration of a tick of TimeTicks
+const timeTicksUnit = 10 * time.Millisecond
+
 func (v *TimeTicks) String() string {
 	return "[timeticks]" + strconv.FormatInt(int64(v.Value), 10)
 }
@@ -750,6 +899,50 @@ func NewTimeTicks(i uint32) *TimeTicks {
 	return &TimeTicks{Counter32{i}}
 }
 
+// Duration returns the ticks, which are hundredths of a second, as
+// time.Duration
+func (v *TimeTicks) Duration() time.Duration {
+	return time.Duration(v.Value) * timeTicksUnit
+}
+
+// Format returns the ticks in the style of net-snmp, e.g.
+// "(12345678) 1 day, 10:17:36.78"
+func (v *TimeTicks) Format() string {
+	ticks := v.Value
+	days := ticks / 8640000
+	hours := ticks / 360000 % 24
+	minutes := ticks / 6000 % 60
+	seconds := ticks / 100 % 60
+	hundredths := ticks % 100
+
+	s := "(" + strconv.FormatUint(uint64(ticks), 10) + ") "
+	switch days {
+	case 0:
+	case 1:
+		s += "1 day, "
+	default:
+		s += strconv.FormatUint(uint64(days), 10) + " days, "
+	}
+	return s + fmt.Sprintf("%d:%02d:%02d.%02d", hours, minutes, seconds, hundredths)
+}
+
+// Sub returns the time elapsed from prev to v, e.g. of two samples of
+// sysUpTime, a single wrap of the 32 bits counter after about 497 days is
+// handled.
+func (v *TimeTicks) Sub(prev *TimeTicks) time.Duration {
+	return time.Duration(v.Value-prev.Value) * timeTicksUnit
+}
+
+// NewTimeTicksFromDuration returns the ticks of d, which is truncated to
+// hundredths of a second, an error is returned if d is negative or is
+// larger than the 32 bits ticks.
+func NewTimeTicksFromDuration(d time.Duration) (*TimeTicks, error) {
+	if d < 0 || d/timeTicksUnit > math.MaxUint32 {
+		return nil, fmt.Errorf("snmpTimeticks style error, duration is %v, it is out of range", d)
+	}
+	return NewTimeTicks(uint32(d / timeTicksUnit)), nil
+}
+
 func NewTimeticksFromString(s string) (Variable, error) {
 	u32, ok := strconv.ParseUint(s, 10, 32)
 	if nil != ok {
@@ -802,6 +995,194 @@ func NewOpaqueFromString(s string) (Variable, error) {
 	return &Opaque{OctetString{bs}}, nil
 }
 
+// the tags of the float and the double in an Opaque, they are the
+// extensions of net-snmp (RFC 6340)
+const (
+	opaqueTagFloat  = 0x78
+	opaqueTagDouble = 0x79
+)
+
+// opaqueValue returns the Float or the Double in the contents of an Opaque,
+// it returns nil if the contents is not a special encoding.
+func opaqueValue(b []byte) Variable {
+	if len(b) < 3 || b[0] != 0x9f || int(b[2]) != len(b)-3 {
+		return nil
+	}
+	switch {
+	case b[1] == opaqueTagFloat && b[2] == 4:
+		return NewFloat(math.Float32frombits(binary.BigEndian.Uint32(b[3:])))
+	case b[1] == opaqueTagDouble && b[2] == 8:
+		return NewDouble(math.Float64frombits(binary.BigEndian.Uint64(b[3:])))
+	}
+	return nil
+}
+
+func marshalOpaque(tag byte, value []byte) []byte {
+	return append([]byte{asn1.TagOpaque, byte(3 + len(value)), 0x9f, tag, byte(len(value))}, value...)
+}
+
+// Float is the float wrapped in an Opaque
+type Float struct {
+	Value float32
+}
+
+func (v *Float) IsError() bool {
+	return false
+}
+
+func (v *Float) ErrorMessage() string {
+	panic(UnsupportedOperation)
+}
+
+func (v *Float) Int() int64 {
+	return int64(v.Value)
+}
+
+func (v *Float) Uint() uint64 {
+	if v.Value < 0 {
+		panic(UnsupportedOperation)
+	}
+	return uint64(v.Value)
+}
+
+// Bytes returns the contents of the Opaque
+func (v *Float) Bytes() []byte {
+	return marshalOpaque(opaqueTagFloat, v.bits())[2:]
+}
+
+func (v *Float) bits() []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, math.Float32bits(v.Value))
+	return b
+}
+
+func (v *Float) ToString() string {
+	return strconv.FormatFloat(float64(v.Value), 'g', -1, 32)
+}
+
+func (v *Float) String() string {
+	return "[float]" + v.ToString()
+}
+
+func (v *Float) MarshalJSON() ([]byte, error) {
+	return []byte("\"" + v.String() + "\""), nil
+}
+
+func (v *Float) Syntex() int {
+	return asn1.TagOpaque
+}
+
+func (v *Float) Marshal() ([]byte, error) {
+	return marshalOpaque(opaqueTagFloat, v.bits()), nil
+}
+
+func (v *Float) Unmarshal(b []byte) (rest []byte, err error) {
+	var o Opaque
+	if rest, err = o.Unmarshal(b); err != nil {
+		return nil, err
+	}
+	f, ok := opaqueValue(o.Value).(*Float)
+	if !ok {
+		return nil, asn1.StructuralError{Msg: fmt.Sprintf(
+			"Invalid Float object : %s", ToHexStr(b, " "))}
+	}
+	v.Value = f.Value
+	return rest, nil
+}
+
+func NewFloat(f float32) *Float {
+	return &Float{f}
+}
+
+func NewFloatFromString(s string) (Variable, error) {
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 32)
+	if nil != err {
+		return nil, fmt.Errorf("float style error, value is %s, exception is %s", s, err.Error())
+	}
+	return &Float{float32(f)}, nil
+}
+
+// Double is the double wrapped in an Opaque
+type Double struct {
+	Value float64
+}
+
+func (v *Double) IsError() bool {
+	return false
+}
+
+func (v *Double) ErrorMessage() string {
+	panic(UnsupportedOperation)
+}
+
+func (v *Double) Int() int64 {
+	return int64(v.Value)
+}
+
+func (v *Double) Uint() uint64 {
+	if v.Value < 0 {
+		panic(UnsupportedOperation)
+	}
+	return uint64(v.Value)
+}
+
+// Bytes returns the contents of the Opaque
+func (v *Double) Bytes() []byte {
+	return marshalOpaque(opaqueTagDouble, v.bits())[2:]
+}
+
+func (v *Double) bits() []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, math.Float64bits(v.Value))
+	return b
+}
+
+func (v *Double) ToString() string {
+	return strconv.FormatFloat(v.Value, 'g', -1, 64)
+}
+
+func (v *Double) String() string {
+	return "[double]" + v.ToString()
+}
+
+func (v *Double) MarshalJSON() ([]byte, error) {
+	return []byte("\"" + v.String() + "\""), nil
+}
+
+func (v *Double) Syntex() int {
+	return asn1.TagOpaque
+}
+
+func (v *Double) Marshal() ([]byte, error) {
+	return marshalOpaque(opaqueTagDouble, v.bits()), nil
+}
+
+func (v *Double) Unmarshal(b []byte) (rest []byte, err error) {
+	var o Opaque
+	if rest, err = o.Unmarshal(b); err != nil {
+		return nil, err
+	}
+	d, ok := opaqueValue(o.Value).(*Double)
+	if !ok {
+		return nil, asn1.StructuralError{Msg: fmt.Sprintf(
+			"Invalid Double object : %s", ToHexStr(b, " "))}
+	}
+	v.Value = d.Value
+	return rest, nil
+}
+
+func NewDouble(d float64) *Double {
+	return &Double{d}
+}
+
+func NewDoubleFromString(s string) (Variable, error) {
+	d, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if nil != err {
+		return nil, fmt.Errorf("double style error, value is %s, exception is %s", s, err.Error())
+	}
+	return &Double{d}, nil
+}
+
 type Counter64 struct {
 	Value uint64
 }
@@ -1057,6 +1438,11 @@ func unmarshalVariable(b []byte) (v Variable, rest []byte, err error) {
 	if v != nil {
 		rest, err = v.Unmarshal(b)
 		if err == nil {
+			if o, ok := v.(*Opaque); ok {
+				if f := opaqueValue(o.Value); f != nil {
+					v = f
+				}
+			}
 			return
 		}
 	} else {
@@ -3,8 +3,13 @@ package snmpclient2_test
 import (
 	"bytes"
 	"encoding/hex"
+	"fmt"
+	"math"
+	"net"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/runner-mei/snmpclient2"
 )
@@ -242,7 +247,38 @@ func TestOidOperation(t *testing.T) {
 		t.Errorf("Failed to Contains()")
 	}
 
-	oid = oid.AppendSubIds([]int{8, 9, 10})
+	if !oids[0].IsPrefixOf(oid) || !oids[1].IsPrefixOf(oid) || oids[2].IsPrefixOf(oid) ||
+		oids[3].IsPrefixOf(oid) || oids[4].IsPrefixOf(oid) {
+		t.Errorf("Failed to IsPrefixOf()")
+	}
+
+	if oid.CompareTo(oids[0]) != 1 || oid.CompareTo(oids[1]) != 0 || oid.CompareTo(oids[2]) != -1 {
+		t.Errorf("Failed to CompareTo()")
+	}
+
+	parent := oid.Parent()
+	if parent.ToString() != "1.2.3.4.5.6" || oid.ToString() != "1.2.3.4.5.6.7" {
+		t.Errorf("Failed to Parent() - %s", parent.ToString())
+	}
+	next := oid.NextSibling()
+	if next.ToString() != "1.2.3.4.5.6.8" || oid.ToString() != "1.2.3.4.5.6.7" {
+		t.Errorf("Failed to NextSibling() - %s", next.ToString())
+	}
+	last := snmpclient2.MustParseOidFromString("1.3.4294967295")
+	if next = last.NextSibling(); next.ToString() != "1.4" {
+		t.Errorf("Failed to NextSibling() - %s", next.ToString())
+	}
+	if empty := snmpclient2.EmptyOID.Parent(); len(empty.Value) != 0 {
+		t.Errorf("Failed to Parent() of the empty OID - %s", empty.ToString())
+	}
+
+	// the result is a copy, which is not shared by the appended OIDs
+	base := parent.AppendSubIds()
+	a, b := base.AppendSubIds(1), base.AppendSubIds(2)
+	if a.ToString() != "1.2.3.4.5.6.1" || b.ToString() != "1.2.3.4.5.6.2" {
+		t.Errorf("Failed to AppendSubIds() - %s, %s", a.ToString(), b.ToString())
+	}
+	oid = oid.AppendSubIds(8, 9, 10)
 	if oid.ToString() != "1.2.3.4.5.6.7.8.9.10" {
 		t.Errorf("Failed to AppendSubIds()")
 	}
@@ -723,3 +759,309 @@ func TestEndOfMibView(t *testing.T) {
 		t.Errorf("Unmarshal() with rest - expected [%s], actual [%s]", expStr, w.ToString())
 	}
 }
+
+func TestAsAccessors(t *testing.T) {
+	sysUpTime := snmpclient2.MustParseOidFromString("1.3.6.1.2.1.1.3.0")
+	sysObjectID := snmpclient2.MustParseOidFromString("1.3.6.1")
+	vbs := snmpclient2.VariableBindings{
+		snmpclient2.NewVarBind(sysUpTime, snmpclient2.NewTimeTicks(123456)),
+	}
+
+	for _, test := range []struct {
+		value  snmpclient2.Variable
+		i64    string
+		u64    string
+		str    string
+		ip     string
+		oid    string
+		nbytes int
+		dur    string
+	}{
+		{snmpclient2.NewInteger(-2), "-2", "error", "-2", "error", "error", 0, "error"},
+		{snmpclient2.NewCounter64(math.MaxUint64), "error", "18446744073709551615", "18446744073709551615", "error", "error", 0, "error"},
+		{snmpclient2.NewTimeTicks(123456), "123456", "123456", "123456", "error", "error", 0, "20m34.56s"},
+		{snmpclient2.NewOctetString([]byte(" 42 ")), "42", "42", " 42 ", "32.52.50.32", "error", 4, "error"},
+		{snmpclient2.NewOctetString([]byte("eth0")), "error", "error", "eth0", "101.116.104.48", "error", 4, "error"},
+		{snmpclient2.NewIpaddress(10, 0, 0, 1), "error", "error", "10.0.0.1", "10.0.0.1", "error", 4, "error"},
+		{snmpclient2.NewOctetString(net.ParseIP("fe80::1")), "error", "error", string(net.ParseIP("fe80::1")), "fe80::1", "error", 16, "error"},
+		{&sysObjectID, "error", "error", "1.3.6.1", "error", "1.3.6.1", 0, "error"},
+	} {
+		vb := snmpclient2.NewVarBind(sysUpTime, test.value)
+		show := func(v interface{}, err error) string {
+			if err != nil {
+				return "error"
+			}
+			return fmt.Sprint(v)
+		}
+		if s := show(vb.AsInt64()); s != test.i64 {
+			t.Errorf("AsInt64(%s) - expected [%s], actual [%s]", test.value, test.i64, s)
+		}
+		if s := show(vb.AsUint64()); s != test.u64 {
+			t.Errorf("AsUint64(%s) - expected [%s], actual [%s]", test.value, test.u64, s)
+		}
+		if s := vb.AsString(); s != test.str {
+			t.Errorf("AsString(%s) - expected [%s], actual [%s]", test.value, test.str, s)
+		}
+		if s := show(vb.AsIP()); s != test.ip {
+			t.Errorf("AsIP(%s) - expected [%s], actual [%s]", test.value, test.ip, s)
+		}
+		oid, err := vb.AsOid()
+		if s := show(oid.ToString(), err); s != test.oid {
+			t.Errorf("AsOid(%s) - expected [%s], actual [%s]", test.value, test.oid, s)
+		}
+		if n := len(vb.AsBytes()); n != test.nbytes {
+			t.Errorf("AsBytes(%s) - expected [%d] octets, actual [%d]", test.value, test.nbytes, n)
+		}
+		if s := show(vb.AsDuration()); s != test.dur {
+			t.Errorf("AsDuration(%s) - expected [%s], actual [%s]", test.value, test.dur, s)
+		}
+	}
+
+	if i, err := vbs.LookupAsInt64(sysUpTime); err != nil || i != 123456 {
+		t.Errorf("LookupAsInt64() - expected [123456], actual [%d %v]", i, err)
+	}
+	if _, err := vbs.LookupAsString(snmpclient2.MustParseOidFromString("1.3.6.1.2.1.1.5.0")); err == nil {
+		t.Error("LookupAsString() - expected an error of the missing oid")
+	}
+}
+
+func TestFloatAndDouble(t *testing.T) {
+	for _, test := range []struct {
+		value  snmpclient2.Variable
+		expStr string
+		expBuf []byte
+	}{
+		{snmpclient2.NewFloat(1.5), "[float]1.5",
+			[]byte{0x44, 0x07, 0x9f, 0x78, 0x04, 0x3f, 0xc0, 0x00, 0x00}},
+		{snmpclient2.NewDouble(-2.25), "[double]-2.25",
+			[]byte{0x44, 0x0b, 0x9f, 0x79, 0x08, 0xc0, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}},
+		// not a special encoding
+		{snmpclient2.NewOpaque([]byte{0x9f, 0x78, 0x03, 0x01, 0x02, 0x03}), "[opaque]9f:78:03:01:02:03",
+			[]byte{0x44, 0x06, 0x9f, 0x78, 0x03, 0x01, 0x02, 0x03}},
+	} {
+		if test.value.String() != test.expStr {
+			t.Errorf("String() - expected [%s], actual [%s]", test.expStr, test.value.String())
+		}
+		buf, err := test.value.Marshal()
+		if err != nil || !bytes.Equal(buf, test.expBuf) {
+			t.Errorf("Marshal() - expected [%s], actual [%s] %v",
+				snmpclient2.ToHexStr(test.expBuf, " "), snmpclient2.ToHexStr(buf, " "), err)
+		}
+
+		// decoded from a PDU
+		pdu := snmpclient2.NewPdu(snmpclient2.V2c, snmpclient2.GetResponse)
+		pdu.AppendVariableBinding(snmpclient2.MustParseOidFromString("1.3.6.1.4.1.2021.10.1.6.1"), test.value)
+		buf, err = pdu.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded := &snmpclient2.PduV1{}
+		if _, err = decoded.Unmarshal(buf); err != nil {
+			t.Fatal(err)
+		}
+		if v := decoded.VariableBindings()[0].Variable; v.String() != test.expStr {
+			t.Errorf("Unmarshal() - expected [%s], actual [%s]", test.expStr, v.String())
+		}
+	}
+
+	v, err := snmpclient2.NewVariable("[float]0.25")
+	if f, ok := v.(*snmpclient2.Float); err != nil || !ok || f.Value != 0.25 {
+		t.Errorf("NewVariable() - expected [float]0.25, actual [%v] %v", v, err)
+	}
+	if f, err := snmpclient2.AsFloat64(snmpclient2.NewDouble(3.5)); err != nil || f != 3.5 {
+		t.Errorf("AsFloat64() - expected [3.5], actual [%v] %v", f, err)
+	}
+}
+
+func TestNewVariableFromString(t *testing.T) {
+	for _, test := range []struct {
+		typeCode, value string
+		expected        string
+	}{
+		{"i", "-42", "[int]-42"},
+		{"u", "4294967295", "[gauge32]4294967295"},
+		{"c", "1", "[counter32]1"},
+		{"C", "18446744073709551615", "[counter64]18446744073709551615"},
+		{"t", "100", "[timeticks]100"},
+		{"s", "router 1", "[octets]726f757465722031"},
+		{"x", "0x0a 1B:2c", "[octets]0a1b2c"},
+		{"d", "192.168.0 1", "[octets]c0a80001"},
+		{"a", "10.0.0.1", "[ip]10.0.0.1"},
+		{"o", "1.3.6.1.2.1", "[oid]1.3.6.1.2.1"},
+		{"n", "", "[null]"},
+		{"b", "0, 9 15", "[octets]8041"},
+		{"b", "", "[octets]"},
+	} {
+		v, err := snmpclient2.NewVariableFromString(test.typeCode, test.value)
+		if err != nil {
+			t.Errorf("NewVariableFromString(%s, %s) - has error %v", test.typeCode, test.value, err)
+		} else if v.String() != test.expected {
+			t.Errorf("NewVariableFromString(%s, %s) - expected [%s], actual [%s]",
+				test.typeCode, test.value, test.expected, v.String())
+		}
+	}
+
+	for _, test := range []struct {
+		typeCode, value string
+	}{
+		{"i", "2147483648"},
+		{"u", "4294967296"},
+		{"c", "-1"},
+		{"x", "0g"},
+		{"d", "1.256"},
+		{"a", "::1"},
+		{"o", "1.a"},
+		{"b", "-1"},
+		{"z", "1"},
+	} {
+		if v, err := snmpclient2.NewVariableFromString(test.typeCode, test.value); err == nil {
+			t.Errorf("NewVariableFromString(%s, %s) - expected an error, actual [%v]", test.typeCode, test.value, v)
+		}
+	}
+
+	vb, err := snmpclient2.NewVarBindFromStrings("1.3.6.1.2.1.1.5.0", "s", "router")
+	if err != nil || vb.Oid.ToString() != "1.3.6.1.2.1.1.5.0" || vb.AsString() != "router" {
+		t.Errorf("NewVarBindFromStrings() - expected [router], actual [%v] %v", vb, err)
+	}
+	if _, err = snmpclient2.NewVarBindFromStrings("1.3.6.1.2.1.1.5.0", "u", "4294967296"); err == nil ||
+		!strings.Contains(err.Error(), "'4294967296' of type 'u'") {
+		t.Errorf("NewVarBindFromStrings() - expected the error of the range, actual %v", err)
+	}
+}
+
+func TestFormatMAC(t *testing.T) {
+	// ifPhysAddress of an Intel NIC and dot1dTpFdbAddress of a Cisco switch
+	for _, test := range []struct {
+		value    string
+		expected string
+	}{
+		{"001b210a0b0c", "00:1b:21:0a:0b:0c"},
+		{"00000c9ff001", "00:00:0c:9f:f0:01"},
+	} {
+		value, _ := snmpclient2.NewOctetStringFromString(test.value)
+		if s, err := snmpclient2.FormatMAC(value); err != nil || s != test.expected {
+			t.Errorf("FormatMAC(%s) - expected [%s], actual [%s] %v", test.value, test.expected, s, err)
+		}
+	}
+
+	for _, value := range []snmpclient2.Variable{
+		snmpclient2.NewOctetString(nil),
+		snmpclient2.NewOctetString([]byte{0x00, 0x1b, 0x21, 0x0a, 0x0b}),
+		snmpclient2.NewOctetString([]byte{0x00, 0x1b, 0x21, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e}),
+		snmpclient2.NewInteger(6),
+	} {
+		if s, err := snmpclient2.FormatMAC(value); err == nil {
+			t.Errorf("FormatMAC(%s) - expected an error, actual [%s]", value, s)
+		}
+	}
+}
+
+func TestParseDateAndTime(t *testing.T) {
+	for _, test := range []struct {
+		value    string
+		expected string
+	}{
+		// hrSystemDate of net-snmp and of Windows
+		{"07e40a110e1e0f002b0800", "2020-10-17T14:30:15+08:00"},
+		{"07e7020c17000105", "2023-02-12T23:00:01.5Z"},
+		{"07d00101000000002d031e", "2000-01-01T00:00:00-03:30"},
+		{"07e50c1f173b3b092b0000", "2021-12-31T23:59:59.9Z"},
+	} {
+		value, _ := snmpclient2.NewOctetStringFromString(test.value)
+		tm, err := snmpclient2.ParseDateAndTime(value)
+		if err != nil {
+			t.Errorf("ParseDateAndTime(%s) - has error %v", test.value, err)
+			continue
+		}
+		if s := tm.Format(time.RFC3339Nano); s != test.expected {
+			t.Errorf("ParseDateAndTime(%s) - expected [%s], actual [%s]", test.value, test.expected, s)
+		}
+	}
+
+	for _, s := range []string{
+		"",
+		"07e40a110e1e0f",
+		"07e40a110e1e0f002b08",
+		"07e40a110e1e0f002b080000",
+		"07e40d110e1e0f00",
+		"07e40a000e1e0f00",
+		"07e40a11181e0f00",
+		"07e40a110e1e0f0a",
+		"07e40a110e1e0f003d0800",
+		"07e40a110e1e0f002b0e00",
+		"07e40a110e1e0f002b083c",
+	} {
+		value, _ := snmpclient2.NewOctetStringFromString(s)
+		if tm, err := snmpclient2.ParseDateAndTime(value); err == nil {
+			t.Errorf("ParseDateAndTime(%s) - expected an error, actual [%s]", s, tm)
+		}
+	}
+	if _, err := snmpclient2.ParseDateAndTime(snmpclient2.NewTimeTicks(100)); err == nil {
+		t.Error("ParseDateAndTime(timeticks) - expected an error")
+	}
+}
+
+func TestIsPrintable(t *testing.T) {
+	for _, test := range []struct {
+		value    snmpclient2.Variable
+		expected bool
+	}{
+		{snmpclient2.NewOctetString([]byte("Linux router 5.4.0 #1 SMP x86_64")), true},
+		{snmpclient2.NewOctetString([]byte("Cisco IOS Software\r\nCopyright (c) 1986-2020\tby Cisco")), true},
+		{snmpclient2.NewOctetString([]byte("\u4ea4\u6362\u673a")), true},
+		{snmpclient2.NewOctetString(nil), true},
+		{snmpclient2.NewOctetString([]byte{0x00, 0x1b, 0x21, 0x0a, 0x0b, 0x0c}), false},
+		{snmpclient2.NewOctetString([]byte{0x07, 0xe4, 0x0a, 0x11, 0x0e, 0x1e, 0x0f, 0x00}), false},
+		{snmpclient2.NewOctetString([]byte("abc\xff")), false},
+		{snmpclient2.NewInteger(65), false},
+	} {
+		if actual := snmpclient2.IsPrintable(test.value); actual != test.expected {
+			t.Errorf("IsPrintable(%s) - expected [%v], actual [%v]", test.value, test.expected, actual)
+		}
+	}
+}
+
+func TestTimeTicksDuration(t *testing.T) {
+	for _, test := range []struct {
+		ticks    uint32
+		duration time.Duration
+		format   string
+	}{
+		{0, 0, "(0) 0:00:00.00"},
+		{100, time.Second, "(100) 0:00:01.00"},
+		{12345678, 123456780 * time.Millisecond, "(12345678) 1 day, 10:17:36.78"},
+		{17280000, 48 * time.Hour, "(17280000) 2 days, 0:00:00.00"},
+		{4294967295, 42949672950 * time.Millisecond, "(4294967295) 497 days, 2:27:52.95"},
+	} {
+		v := snmpclient2.NewTimeTicks(test.ticks)
+		if d := v.Duration(); d != test.duration {
+			t.Errorf("Duration(%d) - expected [%v], actual [%v]", test.ticks, test.duration, d)
+		}
+		if s := v.Format(); s != test.format {
+			t.Errorf("Format(%d) - expected [%s], actual [%s]", test.ticks, test.format, s)
+		}
+		if v, err := snmpclient2.NewTimeTicksFromDuration(test.duration + 5*time.Millisecond); err != nil || v.Value != test.ticks {
+			t.Errorf("NewTimeTicksFromDuration(%v) - expected [%d], actual [%v] %v", test.duration, test.ticks, v, err)
+		}
+	}
+
+	for _, d := range []time.Duration{-time.Millisecond, 42949672960 * time.Millisecond} {
+		if v, err := snmpclient2.NewTimeTicksFromDuration(d); err == nil {
+			t.Errorf("NewTimeTicksFromDuration(%v) - expected an error, actual [%v]", d, v)
+		}
+	}
+
+	for _, test := range []struct {
+		prev, cur uint32
+		elapsed   time.Duration
+	}{
+		{100, 350, 2500 * time.Millisecond},
+		{4294967200, 4, time.Second},
+		{500, 500, 0},
+	} {
+		cur, prev := snmpclient2.NewTimeTicks(test.cur), snmpclient2.NewTimeTicks(test.prev)
+		if d := cur.Sub(prev); d != test.elapsed {
+			t.Errorf("Sub(%d, %d) - expected [%v], actual [%v]", test.cur, test.prev, test.elapsed, d)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package snmpclient2
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// A WalkResult is the variable bindings of the subtree of a walk in the
+// order of the OIDs, see WalkAll
+type WalkResult struct {
+	base             Oid
+	variableBindings VariableBindings
+}
+
+// WalkAll walks the subtree of base, it uses GetNextWalk for SNMPv1 and
+// GetBulkWalk for the others. The error variables, e.g. NoSuchObject, and
+// the OIDs out of the subtree are excluded. The bindings collected before
+// an error, e.g. WalkTruncatedError, are returned with it.
+func (s *SNMP) WalkAll(base Oid) (*WalkResult, error) {
+	return s.WalkAllContext(context.Background(), base)
+}
+
+// WalkAllContext is WalkAll that aborts when ctx is done
+func (s *SNMP) WalkAllContext(ctx context.Context, base Oid) (*WalkResult, error) {
+	var vbs VariableBindings
+	add := func(vb VariableBinding) error {
+		if !vb.Variable.IsError() && base.IsPrefixOf(vb.Oid) {
+			vbs = append(vbs, vb)
+		}
+		return nil
+	}
+
+	var err error
+	if s.args.Version == V1 {
+		var pdu PDU
+		pdu, err = s.GetNextWalkContext(ctx, Oids{base})
+		if nil != pdu {
+			if err == nil && pdu.ErrorStatus() != NoError {
+				err = ResponseError{
+					Message: fmt.Sprintf("Failed to walk %s - %s", base.ToString(), pdu.ErrorStatus()),
+					Detail:  fmt.Sprintf("PDU - %s", pdu),
+				}
+			}
+			for _, vb := range pdu.VariableBindings() {
+				add(vb)
+			}
+		}
+	} else {
+		err = s.GetBulkWalkFuncContext(ctx, Oids{base}, 0, 10, add)
+	}
+	return &WalkResult{base: base, variableBindings: vbs.Sort().Uniq()}, err
+}
+
+// Base returns the OID of the subtree
+func (r *WalkResult) Base() Oid {
+	return r.base
+}
+
+// Len returns the number of the variable bindings
+func (r *WalkResult) Len() int {
+	return len(r.variableBindings)
+}
+
+// VariableBindings returns the variable bindings in the order of the OIDs,
+// they must not be modified
+func (r *WalkResult) VariableBindings() VariableBindings {
+	return r.variableBindings
+}
+
+// Range calls fn with the variable bindings in the order of the OIDs until
+// fn returns false
+func (r *WalkResult) Range(fn func(vb VariableBinding) bool) {
+	for _, vb := range r.variableBindings {
+		if !fn(vb) {
+			return
+		}
+	}
+}
+
+// search returns the index of the first variable binding which is not
+// before oid
+func (r *WalkResult) search(oid Oid) int {
+	return sort.Search(len(r.variableBindings), func(i int) bool {
+		return r.variableBindings[i].Oid.Compare(&oid) >= 0
+	})
+}
+
+// Get returns the variable of the OID
+func (r *WalkResult) Get(oid Oid) (Variable, bool) {
+	i := r.search(oid)
+	if i < len(r.variableBindings) && r.variableBindings[i].Oid.Equal(&oid) {
+		return r.variableBindings[i].Variable, true
+	}
+	return nil, false
+}
+
+// Suffix returns the variable bindings in the subtree of the base followed
+// by the sub-identifiers of suffix, e.g. Suffix(2) of the walk of ifEntry
+// (1.3.6.1.2.1.2.2.1) is the column ifDescr (1.3.6.1.2.1.2.2.1.2).
+func (r *WalkResult) Suffix(suffix Oid) []VariableBinding {
+	prefix := r.base.AppendSubIds(suffix.Value...)
+	i := r.search(prefix)
+	j := i
+	for j < len(r.variableBindings) && prefix.IsPrefixOf(r.variableBindings[j].Oid) {
+		j++
+	}
+	return r.variableBindings[i:j]
+}
@@ -0,0 +1,125 @@
+package snmpclient2_test
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/runner-mei/snmpclient2"
+)
+
+func TestWalkAll(t *testing.T) {
+	mibs := map[string]snmpclient2.Variable{
+		"1.3.6.1.2.1.1.1.0":     snmpclient2.NewOctetString([]byte("Test Agent")),
+		"1.3.6.1.2.1.2.2.1.1.1": snmpclient2.NewInteger(1),
+		"1.3.6.1.2.1.2.2.1.1.2": snmpclient2.NewInteger(2),
+		"1.3.6.1.2.1.2.2.1.2.1": snmpclient2.NewOctetString([]byte("eth0")),
+		"1.3.6.1.2.1.2.2.1.2.2": snmpclient2.NewOctetString([]byte("eth1")),
+		"1.3.6.1.2.1.2.2.1.3.1": snmpclient2.NewInteger(6),
+		"1.3.6.1.2.1.4.1.0":     snmpclient2.NewInteger(2),
+	}
+	base := snmpclient2.MustParseOidFromString("1.3.6.1.2.1.2.2.1")
+
+	for _, version := range []snmpclient2.SnmpVersion{snmpclient2.V1, snmpclient2.V2c} {
+		snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:161", snmpclient2.Arguments{
+			Version:   version,
+			Community: "public",
+			Timeout:   time.Second,
+			Dialer:    newMemDialer(memWalkAgent(t, mibs)),
+		})
+		defer snmp.Close()
+
+		result, err := snmp.WalkAll(base)
+		if err != nil {
+			t.Fatalf("WalkAll(%s) - has error %v", version, err)
+		}
+		if result.Len() != 5 {
+			t.Errorf("WalkAll(%s) - expected [5] bindings, actual %v", version, result.VariableBindings())
+		}
+		var last snmpclient2.Oid
+		result.Range(func(vb snmpclient2.VariableBinding) bool {
+			if last.Compare(&vb.Oid) >= 0 && len(last.Value) > 0 {
+				t.Errorf("Range(%s) - expected the order of the OIDs, [%s] after [%s]", version, vb.Oid.ToString(), last.ToString())
+			}
+			last = vb.Oid
+			return true
+		})
+
+		if v, ok := result.Get(snmpclient2.MustParseOidFromString("1.3.6.1.2.1.2.2.1.2.2")); !ok || string(v.Bytes()) != "eth1" {
+			t.Errorf("Get(%s) - expected [eth1], actual [%v]", version, v)
+		}
+		if v, ok := result.Get(snmpclient2.MustParseOidFromString("1.3.6.1.2.1.2.2.1.2")); ok {
+			t.Errorf("Get(%s) - expected no variable, actual [%v]", version, v)
+		}
+		descrs := result.Suffix(snmpclient2.MustParseOidFromString("2"))
+		if len(descrs) != 2 || descrs[0].AsString() != "eth0" || descrs[1].AsString() != "eth1" {
+			t.Errorf("Suffix(%s) - expected [eth0 eth1], actual %v", version, descrs)
+		}
+		if vbs := result.Suffix(snmpclient2.MustParseOidFromString("4")); len(vbs) != 0 {
+			t.Errorf("Suffix(%s) - expected no binding, actual %v", version, vbs)
+		}
+	}
+}
+
+func TestWalkUntil(t *testing.T) {
+	mibs := map[string]snmpclient2.Variable{}
+	for i := 1; i <= 20; i++ {
+		mibs[fmt.Sprintf("1.3.6.1.2.1.2.2.1.2.%d", i)] = snmpclient2.NewOctetString([]byte(fmt.Sprintf("eth%d", i)))
+	}
+	base := snmpclient2.MustParseOidFromString("1.3.6.1.2.1.2.2.1.2")
+
+	for _, test := range []struct {
+		version  snmpclient2.SnmpVersion
+		requests int32
+	}{
+		{snmpclient2.V1, 3},
+		{snmpclient2.V2c, 1},
+	} {
+		var requests int32
+		agent := memWalkAgent(t, mibs)
+		snmp, _ := snmpclient2.NewSNMP("udp", "127.0.0.1:161", snmpclient2.Arguments{
+			Version:   test.version,
+			Community: "public",
+			Timeout:   time.Second,
+			Dialer: newMemDialer(func(req []byte) [][]byte {
+				atomic.AddInt32(&requests, 1)
+				return agent(req)
+			}),
+		})
+		defer snmp.Close()
+
+		var found []string
+		err := snmp.WalkUntil(base, 5, func(vb snmpclient2.VariableBinding) (bool, error) {
+			found = append(found, vb.AsString())
+			return vb.AsString() == "eth3", nil
+		})
+		if err != nil {
+			t.Errorf("WalkUntil(%s) - has error %v", test.version, err)
+		}
+		if len(found) != 3 || found[2] != "eth3" {
+			t.Errorf("WalkUntil(%s) - expected [eth1 eth2 eth3], actual %v", test.version, found)
+		}
+		if n := atomic.LoadInt32(&requests); n != test.requests {
+			t.Errorf("WalkUntil(%s) - expected [%d] requests, actual [%d]", test.version, test.requests, n)
+		}
+
+		expected := errors.New("stop here")
+		err = snmp.WalkUntil(base, 5, func(vb snmpclient2.VariableBinding) (bool, error) {
+			return false, expected
+		})
+		if err != expected {
+			t.Errorf("WalkUntil(%s) - expected [%v], actual [%v]", test.version, expected, err)
+		}
+
+		found = found[:0]
+		err = snmp.WalkUntil(base, 5, func(vb snmpclient2.VariableBinding) (bool, error) {
+			found = append(found, vb.AsString())
+			return false, nil
+		})
+		if err != nil || len(found) != 20 {
+			t.Errorf("WalkUntil(%s) - expected [20] bindings, actual [%d] %v", test.version, len(found), err)
+		}
+	}
+}